@@ -0,0 +1,334 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/engine"
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	addonsName             = "addons"
+	addonsShortDescription = "Manage the addons of a Kubernetes cluster"
+	addonsLongDescription  = "Enable, disable or update the addons of a deployed Kubernetes cluster and record the change in the apimodel of its deployment directory, or list the addons with their drift from the apimodel"
+
+	addonsEnableName             = "enable"
+	addonsEnableShortDescription = "Enable an addon of a Kubernetes cluster"
+	addonsEnableLongDescription  = "Enable an addon in the apimodel of a deployed Kubernetes cluster, write its manifest to the addons directory of the masters and create its objects"
+
+	addonsDisableName             = "disable"
+	addonsDisableShortDescription = "Disable an addon of a Kubernetes cluster"
+	addonsDisableLongDescription  = "Disable an addon in the apimodel of a deployed Kubernetes cluster, remove its manifest from the addons directory of the masters and delete its objects"
+
+	addonsUpdateName             = "update"
+	addonsUpdateShortDescription = "Update the configuration of an addon of a Kubernetes cluster"
+	addonsUpdateLongDescription  = "Change the containers and the config of an addon in the apimodel of a deployed Kubernetes cluster and roll out its new manifest"
+
+	addonsListName             = "list"
+	addonsListShortDescription = "List the addons of a Kubernetes cluster"
+	addonsListLongDescription  = "List the addons of the apimodel of a deployed Kubernetes cluster, whether they are deployed and how the cluster drifted from the apimodel"
+)
+
+// addonContainerFields are the fields of an addon container --container can set
+var addonContainerFields = []string{"image", "cpuRequests", "memoryRequests", "cpuLimits", "memoryLimits"}
+
+type addonsCmd struct {
+	authArgs
+	addonsArgs
+
+	// user input
+	deploymentDirectory string
+	location            string
+	sshPrivateKeyPath   string
+	containers          []string
+	config              []string
+
+	// derived
+	containerService *api.ContainerService
+	apiVersion       string
+	client           armhelpers.ACSEngineClient
+	sshPrivateKey    []byte
+	change           engine.AddonChange
+	locale           *gotext.Locale
+	result           commandResult
+}
+
+func newAddonsCmd() *cobra.Command {
+	ac := addonsCmd{}
+
+	addonsCmd := &cobra.Command{
+		Use:   addonsName,
+		Short: addonsShortDescription,
+		Long:  addonsLongDescription,
+	}
+
+	f := addonsCmd.PersistentFlags()
+	f.StringVar(&ac.deploymentDirectory, "deployment-dir", "", "the location of the output from `generate`")
+	f.StringVarP(&ac.location, "location", "l", "", "location the cluster is deployed in (defaults to the location of the apimodel)")
+	f.StringVar(&ac.sshPrivateKeyPath, "ssh-private-key-path", "", "ssh private key path (default: <deployment-dir>/id_rsa)")
+	addAuthFlags(&ac.authArgs, f)
+	addAddonsFlags(&ac.addonsArgs, f)
+
+	enableCmd := &cobra.Command{
+		Use:   addonsEnableName + " NAME",
+		Short: addonsEnableShortDescription,
+		Long:  addonsEnableLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ac.runChange(cmd, args, engine.EnableAddon)
+		},
+	}
+
+	disableCmd := &cobra.Command{
+		Use:   addonsDisableName + " NAME",
+		Short: addonsDisableShortDescription,
+		Long:  addonsDisableLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ac.runChange(cmd, args, engine.DisableAddon)
+		},
+	}
+
+	updateCmd := &cobra.Command{
+		Use:   addonsUpdateName + " NAME",
+		Short: addonsUpdateShortDescription,
+		Long:  addonsUpdateLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ac.runChange(cmd, args, func(ctx context.Context, o engine.AddonsOptions, name string) (*engine.AddonsResult, error) {
+				return engine.UpdateAddon(ctx, o, ac.change)
+			})
+		},
+	}
+	uf := updateCmd.Flags()
+	uf.StringArrayVar(&ac.containers, "container", []string{}, fmt.Sprintf("set a field of a container of the addon with NAME:FIELD=VALUE, FIELD among %s (can specify multiple)", strings.Join(addonContainerFields, ", ")))
+	uf.StringArrayVar(&ac.config, "config", []string{}, "set a config value of the addon with KEY=VALUE (can specify multiple)")
+
+	listCmd := &cobra.Command{
+		Use:   addonsListName,
+		Short: addonsListShortDescription,
+		Long:  addonsListLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCommand(cmd, &ac.result, func() error {
+				if err := ac.validate(cmd, args); err != nil {
+					return errors.Wrap(newValidationError(err), "error validating addonsCmd")
+				}
+				if err := ac.load(false); err != nil {
+					return errors.Wrap(err, "error loading the deployment")
+				}
+				return ac.list(cmd)
+			})
+		},
+	}
+
+	addonsCmd.AddCommand(enableCmd, disableCmd, updateCmd, listCmd)
+	return addonsCmd
+}
+
+// runChange runs the engine function changing the addon named by args
+func (ac *addonsCmd) runChange(cmd *cobra.Command, args []string, change func(context.Context, engine.AddonsOptions, string) (*engine.AddonsResult, error)) error {
+	return runCommand(cmd, &ac.result, func() error {
+		if err := ac.validate(cmd, args); err != nil {
+			return errors.Wrap(newValidationError(err), "error validating addonsCmd")
+		}
+		if err := ac.load(true); err != nil {
+			return errors.Wrap(err, "error loading the deployment")
+		}
+		name := args[0]
+		result, err := change(context.Background(), ac.options(), name)
+		if result != nil {
+			ac.result.OutputDirectory = ac.deploymentDirectory
+			ac.result.Artifacts = result.Artifacts
+			ac.result.AppliedObjects = result.Applied
+			ac.result.DeletedObjects = result.Deleted
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error changing addon %s", name)
+		}
+		log.Infof("addon %s changed: %d objects applied and %d deleted, the artifacts in %s are updated", name, len(result.Applied), len(result.Deleted), ac.deploymentDirectory)
+		return nil
+	})
+}
+
+func (ac *addonsCmd) validate(cmd *cobra.Command, args []string) error {
+	var err error
+
+	ac.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if ac.deploymentDirectory == "" {
+		cmd.Usage()
+		return errors.New("--deployment-dir must be specified")
+	}
+	if cmd.Name() == addonsListName {
+		if len(args) > 0 {
+			cmd.Usage()
+			return errors.New("too many arguments were provided to 'addons list'")
+		}
+	} else if len(args) != 1 {
+		cmd.Usage()
+		return errors.Errorf("the name of one addon must be provided to 'addons %s'", cmd.Name())
+	}
+	if cmd.Name() == addonsUpdateName {
+		if len(ac.containers) == 0 && len(ac.config) == 0 {
+			cmd.Usage()
+			return errors.New("--container or --config must be specified")
+		}
+		if ac.change, err = parseAddonChange(args[0], ac.containers, ac.config); err != nil {
+			cmd.Usage()
+			return err
+		}
+	}
+	if ac.location != "" {
+		ac.location = helpers.NormalizeAzureRegion(ac.location)
+	}
+	return nil
+}
+
+// parseAddonChange parses the --container and --config flags of addons update
+func parseAddonChange(name string, containers, config []string) (engine.AddonChange, error) {
+	change := engine.AddonChange{Name: name}
+	for _, c := range containers {
+		i := strings.Index(c, ":")
+		j := strings.Index(c, "=")
+		if i <= 0 || j < i+2 {
+			return change, errors.Errorf("--container must be NAME:FIELD=VALUE, got %s", c)
+		}
+		containerName, field, value := c[:i], c[i+1:j], c[j+1:]
+		spec := api.KubernetesContainerSpec{Name: containerName}
+		switch field {
+		case "image":
+			spec.Image = value
+		case "cpuRequests":
+			spec.CPURequests = value
+		case "memoryRequests":
+			spec.MemoryRequests = value
+		case "cpuLimits":
+			spec.CPULimits = value
+		case "memoryLimits":
+			spec.MemoryLimits = value
+		default:
+			return change, errors.Errorf("--container field must be among %s, got %s", strings.Join(addonContainerFields, ", "), field)
+		}
+		change.Containers = append(change.Containers, spec)
+	}
+	for _, c := range config {
+		i := strings.Index(c, "=")
+		if i <= 0 {
+			return change, errors.Errorf("--config must be KEY=VALUE, got %s", c)
+		}
+		if change.Config == nil {
+			change.Config = map[string]string{}
+		}
+		change.Config[c[:i]] = c[i+1:]
+	}
+	return change, nil
+}
+
+// load reads the apimodel of the deployment directory and, when sshKey is set, the SSH private
+// key of the masters
+func (ac *addonsCmd) load(sshKey bool) error {
+	var err error
+	if err = ac.authArgs.validateAuthArgs(); err != nil {
+		return newValidationError(err)
+	}
+	if ac.client, err = ac.authArgs.getClient(); err != nil {
+		return errors.Wrap(err, "failed to get client")
+	}
+
+	apimodelPath := path.Join(ac.deploymentDirectory, apiModelFilename)
+	if _, err = os.Stat(apimodelPath); os.IsNotExist(err) {
+		return newValidationError(errors.Errorf("specified api model does not exist (%s)", apimodelPath))
+	}
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: ac.locale,
+		},
+	}
+	ac.containerService, ac.apiVersion, err = apiloader.LoadContainerServiceFromFile(apimodelPath, true, true, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+	if err = ac.setAddonRegistry(ac.containerService); err != nil {
+		return newValidationError(err)
+	}
+	if ac.location != "" {
+		if ac.containerService.Location != "" && ac.containerService.Location != ac.location {
+			return newValidationError(errors.Errorf("--location %s does not match the api model location %s", ac.location, ac.containerService.Location))
+		}
+		ac.containerService.Location = ac.location
+	}
+	if ac.containerService.Location == "" {
+		return newValidationError(errors.New("--location must be specified, the api model has no location"))
+	}
+
+	if !sshKey {
+		return nil
+	}
+	if ac.sshPrivateKeyPath == "" {
+		ac.sshPrivateKeyPath = filepath.Join(ac.deploymentDirectory, "id_rsa")
+	}
+	if ac.sshPrivateKey, err = ioutil.ReadFile(ac.sshPrivateKeyPath); err != nil {
+		return newValidationError(errors.Wrapf(err, "error reading the ssh private key %s, set it with --ssh-private-key-path", ac.sshPrivateKeyPath))
+	}
+	return nil
+}
+
+func (ac *addonsCmd) options() engine.AddonsOptions {
+	return engine.AddonsOptions{
+		Client: ac.client,
+		Logger: log.NewEntry(log.StandardLogger()),
+		Translator: &i18n.Translator{
+			Locale: ac.locale,
+		},
+		ContainerService:    ac.containerService,
+		APIVersion:          ac.apiVersion,
+		DeploymentDirectory: ac.deploymentDirectory,
+		Location:            ac.containerService.Location,
+		SSHPrivateKey:       ac.sshPrivateKey,
+		BuildTag:            BuildTag,
+	}
+}
+
+// list writes the addons of the deployment with their drift from the apimodel
+func (ac *addonsCmd) list(cmd *cobra.Command) error {
+	statuses, err := engine.AddonsStatus(context.Background(), ac.options())
+	if err != nil {
+		return errors.Wrap(err, "error getting the status of the addons")
+	}
+	ac.result.OutputDirectory = ac.deploymentDirectory
+	ac.result.Addons = statuses
+	if outputFormat == "json" {
+		return nil
+	}
+	return writeAddonsTable(cmd, statuses)
+}
+
+func writeAddonsTable(cmd *cobra.Command, statuses []engine.AddonStatus) error {
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tENABLED\tDEPLOYED\tDRIFT")
+	for _, s := range statuses {
+		drift := "-"
+		if len(s.Drift) > 0 {
+			drift = strings.Join(s.Drift, "; ")
+		}
+		fmt.Fprintf(w, "%s\t%t\t%t\t%s\n", s.Name, s.Enabled, s.Deployed, drift)
+	}
+	return w.Flush()
+}
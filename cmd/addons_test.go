@@ -0,0 +1,105 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/engine"
+	"github.com/spf13/cobra"
+)
+
+func TestNewAddonsCmd(t *testing.T) {
+	output := newAddonsCmd()
+	if output.Use != addonsName || output.Short != addonsShortDescription || output.Long != addonsLongDescription {
+		t.Fatalf("addons command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, addonsName, output.Short, addonsShortDescription, output.Long, addonsLongDescription)
+	}
+
+	expectedCommands := []string{addonsDisableName, addonsEnableName, addonsListName, addonsUpdateName}
+	commands := output.Commands()
+	if len(commands) != len(expectedCommands) {
+		t.Fatalf("addons command should have %d subcommands, got %d", len(expectedCommands), len(commands))
+	}
+	expectedFlags := []string{"deployment-dir", "location", "ssh-private-key-path", "subscription-id", "addons-dir"}
+	for i, c := range commands {
+		if c.Name() != expectedCommands[i] {
+			t.Fatalf("addons command should have subcommand %s, got %s", expectedCommands[i], c.Name())
+		}
+		for _, f := range expectedFlags {
+			if c.InheritedFlags().Lookup(f) == nil {
+				t.Fatalf("addons %s command should have flag %s", c.Name(), f)
+			}
+		}
+		if c.Name() == addonsUpdateName && (c.Flags().Lookup("container") == nil || c.Flags().Lookup("config") == nil) {
+			t.Fatalf("addons update command should have flags container and config")
+		}
+	}
+}
+
+func TestAddonsCmdValidate(t *testing.T) {
+	cases := []struct {
+		ac          *addonsCmd
+		command     string
+		args        []string
+		expectedErr string
+	}{
+		{&addonsCmd{}, addonsEnableName, []string{"cluster-autoscaler"}, "--deployment-dir must be specified"},
+		{&addonsCmd{deploymentDirectory: "_output/test"}, addonsEnableName, nil, "the name of one addon must be provided to 'addons enable'"},
+		{&addonsCmd{deploymentDirectory: "_output/test"}, addonsDisableName, []string{"a", "b"}, "the name of one addon must be provided to 'addons disable'"},
+		{&addonsCmd{deploymentDirectory: "_output/test"}, addonsListName, []string{"a"}, "too many arguments were provided to 'addons list'"},
+		{&addonsCmd{deploymentDirectory: "_output/test"}, addonsUpdateName, []string{"metrics-server"}, "--container or --config must be specified"},
+		{&addonsCmd{deploymentDirectory: "_output/test", containers: []string{"metrics-server=1"}}, addonsUpdateName, []string{"metrics-server"}, "--container must be NAME:FIELD=VALUE, got metrics-server=1"},
+		{&addonsCmd{deploymentDirectory: "_output/test", containers: []string{"metrics-server:cpu=1"}}, addonsUpdateName, []string{"metrics-server"}, "--container field must be among image, cpuRequests, memoryRequests, cpuLimits, memoryLimits, got cpu"},
+		{&addonsCmd{deploymentDirectory: "_output/test", config: []string{"=1"}}, addonsUpdateName, []string{"cluster-autoscaler"}, "--config must be KEY=VALUE, got =1"},
+		{&addonsCmd{deploymentDirectory: "_output/test", location: "West US"}, addonsEnableName, []string{"cluster-autoscaler"}, ""},
+		{&addonsCmd{deploymentDirectory: "_output/test"}, addonsListName, nil, ""},
+	}
+	for _, c := range cases {
+		err := c.ac.validate(&cobra.Command{Use: c.command}, c.args)
+		if c.expectedErr == "" && err != nil {
+			t.Errorf("unexpected error validating %+v: %s", c.ac, err)
+		}
+		if c.expectedErr != "" && (err == nil || err.Error() != c.expectedErr) {
+			t.Errorf("expected error %q, got %v", c.expectedErr, err)
+		}
+	}
+}
+
+func TestParseAddonChange(t *testing.T) {
+	change, err := parseAddonChange("cluster-autoscaler",
+		[]string{"cluster-autoscaler:image=example.com/ca:v1.3.0", "cluster-autoscaler:memoryLimits=500Mi"},
+		[]string{"max-nodes=10", "scan-interval=1m=2"})
+	if err != nil {
+		t.Fatalf("unexpected error parsing the change: %s", err)
+	}
+	if change.Name != "cluster-autoscaler" || len(change.Containers) != 2 {
+		t.Fatalf("expected a change of two container fields, got %+v", change)
+	}
+	if change.Containers[0].Image != "example.com/ca:v1.3.0" || change.Containers[1].MemoryLimits != "500Mi" || change.Containers[1].Image != "" {
+		t.Errorf("unexpected containers %+v", change.Containers)
+	}
+	if change.Config["max-nodes"] != "10" || change.Config["scan-interval"] != "1m=2" {
+		t.Errorf("unexpected config %v", change.Config)
+	}
+}
+
+func TestWriteAddonsTable(t *testing.T) {
+	r := &cobra.Command{}
+	var out bytes.Buffer
+	r.SetOutput(&out)
+	statuses := []engine.AddonStatus{
+		{Name: "cluster-autoscaler", Enabled: false},
+		{Name: "kubernetes-dashboard", Enabled: true, Deployed: true, Drift: []string{"Service kube-system/kubernetes-dashboard is missing"}},
+	}
+	if err := writeAddonsTable(r, statuses); err != nil {
+		t.Fatalf("unexpected error writing the table: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "NAME") || !strings.HasSuffix(lines[1], "-") ||
+		!strings.HasSuffix(lines[2], "Service kube-system/kubernetes-dashboard is missing") {
+		t.Errorf("unexpected table:\n%s", out.String())
+	}
+}
@@ -47,6 +47,7 @@ type dcosUpgradeCmd struct {
 	locale             *gotext.Locale
 	nameSuffix         string
 	sshPrivateKey      []byte
+	result             commandResult
 }
 
 func newDcosUpgradeCmd() *cobra.Command {
@@ -57,7 +58,9 @@ func newDcosUpgradeCmd() *cobra.Command {
 		Short: dcosUpgradeShortDescription,
 		Long:  dcosUpgradeLongDescription,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return uc.run(cmd, args)
+			return runCommand(cmd, &uc.result, func() error {
+				return uc.run(cmd, args)
+			})
 		},
 	}
 
@@ -201,13 +204,14 @@ func (uc *dcosUpgradeCmd) loadCluster(cmd *cobra.Command) error {
 func (uc *dcosUpgradeCmd) run(cmd *cobra.Command, args []string) error {
 	err := uc.validate(cmd)
 	if err != nil {
-		log.Fatalf("error validating upgrade command: %v", err)
+		return errors.Wrap(newValidationError(err), "error validating upgrade command")
 	}
 
 	err = uc.loadCluster(cmd)
 	if err != nil {
-		log.Fatalf("error loading existing cluster: %v", err)
+		return errors.Wrap(newValidationError(err), "error loading existing cluster")
 	}
+	uc.result.ResourceGroup = uc.resourceGroupName
 
 	upgradeCluster := dcosupgrade.UpgradeCluster{
 		Translator: &i18n.Translator{
@@ -219,7 +223,7 @@ func (uc *dcosUpgradeCmd) run(cmd *cobra.Command, args []string) error {
 
 	if err = upgradeCluster.UpgradeCluster(uc.authArgs.SubscriptionID, uc.resourceGroupName, uc.currentDcosVersion,
 		uc.containerService, uc.nameSuffix, uc.sshPrivateKey); err != nil {
-		log.Fatalf("Error upgrading cluster: %v", err)
+		return errors.Wrap(err, "error upgrading cluster")
 	}
 
 	apiloader := &api.Apiloader{
@@ -238,5 +242,10 @@ func (uc *dcosUpgradeCmd) run(cmd *cobra.Command, args []string) error {
 		},
 	}
 
-	return f.SaveFile(uc.deploymentDirectory, "apimodel.json", b)
+	if err = f.SaveFile(uc.deploymentDirectory, "apimodel.json", b); err != nil {
+		return err
+	}
+	uc.result.OutputDirectory = uc.deploymentDirectory
+	uc.result.Artifacts = []string{path.Join(uc.deploymentDirectory, "apimodel.json")}
+	return nil
 }
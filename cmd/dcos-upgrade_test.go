@@ -28,6 +28,14 @@ var _ = Describe("the upgrade command", func() {
 		Expect(output.Flags().Lookup("upgrade-version")).NotTo(BeNil())
 	})
 
+	It("should return the validation errors of the DCOS upgrade command", func() {
+		command := newDcosUpgradeCmd()
+		command.SetOutput(ioutil.Discard)
+		err := command.RunE(command, []string{})
+		Expect(err).To(HaveOccurred())
+		Expect(ExitCode(err)).To(Equal(exitCodeValidation))
+	})
+
 	It("should validate DCOS upgrade command", func() {
 		r := &cobra.Command{}
 		privKey, err := ioutil.TempFile("", "id_rsa")
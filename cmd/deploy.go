@@ -6,6 +6,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -19,12 +20,9 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
-	"encoding/json"
-
-	"github.com/Azure/acs-engine/pkg/acsengine"
-	"github.com/Azure/acs-engine/pkg/acsengine/transform"
 	"github.com/Azure/acs-engine/pkg/api"
 	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/engine"
 	"github.com/Azure/acs-engine/pkg/helpers"
 	"github.com/Azure/acs-engine/pkg/i18n"
 	"github.com/Azure/azure-sdk-for-go/services/graphrbac/1.6/graphrbac"
@@ -56,7 +54,9 @@ type deployCmd struct {
 	caCertificatePath string
 	caPrivateKeyPath  string
 	parametersOnly    bool
-	set               []string
+	apiModelOverrides
+	addonsArgs
+	diagnosticsFormat string
 
 	// derived
 	containerService *api.ContainerService
@@ -67,6 +67,7 @@ type deployCmd struct {
 	resourceGroup string
 	random        *rand.Rand
 	location      string
+	result        commandResult
 }
 
 func newDeployCmd() *cobra.Command {
@@ -79,19 +80,21 @@ func newDeployCmd() *cobra.Command {
 		Short: deployShortDescription,
 		Long:  deployLongDescription,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := dc.validateArgs(cmd, args); err != nil {
-				log.Fatalf("error validating deployCmd: %s", err.Error())
-			}
-			if err := dc.mergeAPIModel(); err != nil {
-				log.Fatalf("error merging API model in deployCmd: %s", err.Error())
-			}
-			if err := dc.loadAPIModel(cmd, args); err != nil {
-				log.Fatalf("failed to load apimodel: %s", err.Error())
-			}
-			if _, _, err := dc.validateApimodel(); err != nil {
-				log.Fatalf("Failed to validate the apimodel after populating values: %s", err.Error())
-			}
-			return dc.run()
+			return runCommand(cmd, &dc.result, func() error {
+				if err := dc.validateArgs(cmd, args); err != nil {
+					return errors.Wrap(newValidationError(err), "error validating deployCmd")
+				}
+				if err := dc.mergeAPIModel(); err != nil {
+					return errors.Wrap(newValidationError(err), "error merging API model in deployCmd")
+				}
+				if err := dc.loadAPIModel(cmd, args); err != nil {
+					return errors.Wrap(newValidationError(err), "failed to load apimodel")
+				}
+				if _, _, err := dc.validateApimodel(); err != nil {
+					return errors.Wrap(newValidationError(err), "Failed to validate the apimodel after populating values")
+				}
+				return dc.run()
+			})
 		},
 	}
 
@@ -105,7 +108,9 @@ func newDeployCmd() *cobra.Command {
 	f.StringVarP(&dc.resourceGroup, "resource-group", "g", "", "resource group to deploy to (will use the DNS prefix from the apimodel if not specified)")
 	f.StringVarP(&dc.location, "location", "l", "", "location to deploy to (required)")
 	f.BoolVarP(&dc.forceOverwrite, "force-overwrite", "f", false, "automatically overwrite existing files in the output directory")
-	f.StringArrayVar(&dc.set, "set", []string{}, "set values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	addAPIModelOverrideFlags(&dc.apiModelOverrides, f)
+	addAddonsFlags(&dc.addonsArgs, f)
+	f.StringVar(&dc.diagnosticsFormat, "diagnostics-format", "text", "format of the diagnostics printed when the deployment fails (text or json)")
 
 	addAuthFlags(dc.getAuthArgs(), f)
 
@@ -140,6 +145,12 @@ func (dc *deployCmd) validateArgs(cmd *cobra.Command, args []string) error {
 	}
 	dc.location = helpers.NormalizeAzureRegion(dc.location)
 
+	switch dc.diagnosticsFormat {
+	case "", "text", "json":
+	default:
+		return errors.Errorf("--diagnostics-format must be text or json, got %s", dc.diagnosticsFormat)
+	}
+
 	return nil
 }
 
@@ -161,18 +172,10 @@ func (dc *deployCmd) mergeAPIModel() error {
 		dc.apimodelPath = f.Name()
 	}
 
-	// if --set flag has been used
-	if len(dc.set) > 0 {
-		m := make(map[string]transform.APIModelValue)
-		transform.MapValues(m, dc.set)
-
-		// overrides the api model and generates a new file
-		dc.apimodelPath, err = transform.MergeValuesWithAPIModel(dc.apimodelPath, m)
-		if err != nil {
-			return errors.Wrapf(err, "error merging --set values with the api model: %s", dc.apimodelPath)
-		}
-
-		log.Infoln(fmt.Sprintf("new api model file has been generated during merge: %s", dc.apimodelPath))
+	// overrides the api model and generates a new file if --set, --set-file or --values have been used
+	dc.apimodelPath, err = dc.mergeOverrides(dc.apimodelPath)
+	if err != nil {
+		return errors.Wrapf(err, "error merging --set, --set-file and --values with the api model: %s", dc.apimodelPath)
 	}
 
 	return nil
@@ -194,6 +197,9 @@ func (dc *deployCmd) loadAPIModel(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return errors.Wrap(err, "error parsing the api model")
 	}
+	if err = dc.setAddonRegistry(dc.containerService); err != nil {
+		return err
+	}
 
 	if dc.outputDirectory == "" {
 		if dc.containerService.Properties.MasterProfile != nil {
@@ -397,82 +403,68 @@ func (dc *deployCmd) validateApimodel() (*api.ContainerService, string, error) {
 }
 
 func (dc *deployCmd) run() error {
-	ctx := acsengine.Context{
-		Translator: &i18n.Translator{
-			Locale: dc.locale,
-		},
-	}
-
-	templateGenerator, err := acsengine.InitializeTemplateGenerator(ctx)
-	if err != nil {
-		log.Fatalf("failed to initialize template generator: %s", err.Error())
-	}
-
-	certsgenerated, err := dc.containerService.SetPropertiesDefaults(false, false)
-	if err != nil {
-		log.Fatalf("error in SetPropertiesDefaults template %s: %s", dc.apimodelPath, err.Error())
-		os.Exit(1)
-	}
-
-	template, parameters, err := templateGenerator.GenerateTemplate(dc.containerService, acsengine.DefaultGeneratorCode, BuildTag)
-	if err != nil {
-		log.Fatalf("error generating template %s: %s", dc.apimodelPath, err.Error())
-		os.Exit(1)
-	}
-
-	if template, err = transform.PrettyPrintArmTemplate(template); err != nil {
-		log.Fatalf("error pretty printing template: %s \n", err.Error())
-	}
-	var parametersFile string
-	if parametersFile, err = transform.BuildAzureParametersFile(parameters); err != nil {
-		log.Fatalf("error pretty printing template parameters: %s \n", err.Error())
-	}
-
-	writer := &acsengine.ArtifactWriter{
+	ctx := context.Background()
+	generated, err := engine.Generate(ctx, engine.GenerateOptions{
+		ContainerService: dc.containerService,
+		APIVersion:       dc.apiVersion,
+		OutputDirectory:  dc.outputDirectory,
+		ParametersOnly:   dc.parametersOnly,
+		BuildTag:         BuildTag,
 		Translator: &i18n.Translator{
 			Locale: dc.locale,
 		},
-	}
-	if err = writer.WriteTLSArtifacts(dc.containerService, dc.apiVersion, template, parametersFile, dc.outputDirectory, certsgenerated, dc.parametersOnly); err != nil {
-		log.Fatalf("error writing artifacts: %s \n", err.Error())
-	}
-
-	templateJSON := make(map[string]interface{})
-	parametersJSON := make(map[string]interface{})
-
-	err = json.Unmarshal([]byte(template), &templateJSON)
+		Client: dc.client,
+	})
 	if err != nil {
-		log.Fatalln(err)
-	}
-
-	err = json.Unmarshal([]byte(parameters), &parametersJSON)
+		return errors.Wrapf(err, "error generating template %s", dc.apimodelPath)
+	}
+	for _, secret := range generated.Secrets {
+		log.Infof("stored secret %s", secret)
+	}
+	dc.result.OutputDirectory = dc.outputDirectory
+	dc.result.Artifacts = generated.Artifacts
+	dc.result.Secrets = generated.Secrets
+
+	deploymentName := fmt.Sprintf("%s-%d", dc.resourceGroup, dc.random.Int31())
+	dc.result.ResourceGroup = dc.resourceGroup
+	dc.result.DeploymentName = deploymentName
+	_, err = engine.Deploy(ctx, engine.DeployOptions{
+		Client:         dc.client,
+		Logger:         log.NewEntry(log.New()),
+		ResourceGroup:  dc.resourceGroup,
+		DeploymentName: deploymentName,
+		Template:       generated.Template,
+		Parameters:     generated.Parameters,
+	})
 	if err != nil {
-		log.Fatalln(err)
-	}
-
-	deploymentSuffix := dc.random.Int31()
-	cx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
-	defer cancel()
-
-	if res, err := dc.client.DeployTemplate(
-		cx,
-		dc.resourceGroup,
-		fmt.Sprintf("%s-%d", dc.resourceGroup, deploymentSuffix),
-		templateJSON,
-		parametersJSON,
-	); err != nil {
-		if res.Response.Response != nil && res.Body != nil {
-			defer res.Body.Close()
-			body, _ := ioutil.ReadAll(res.Body)
-			log.Errorf(string(body))
+		// with --output json the diagnostics are part of the command result
+		if deploymentErr, ok := err.(*armhelpers.DeploymentError); ok && outputFormat != "json" {
+			if err := dc.writeDiagnostics(os.Stdout, deploymentErr); err != nil {
+				log.Errorf("error writing deployment diagnostics: %s", err.Error())
+			}
 		}
-		log.Fatalln(err)
+		return &deploymentFailedError{deploymentName: deploymentName, err: err}
 	}
 
-	if dc.containerService.Properties.OrchestratorProfile.OrchestratorType == api.OpenShift {
+	if dc.containerService.Properties.OrchestratorProfile.OrchestratorType == api.OpenShift && outputFormat != "json" {
 		// TODO: when the Azure client library is updated, read this from the template `masterFQDN` output
 		fmt.Printf("OpenShift web UI available at https://%s.%s.cloudapp.azure.com:8443/\n", dc.containerService.Properties.MasterProfile.DNSPrefix, dc.location)
 	}
 
 	return nil
 }
+
+// writeDiagnostics writes the categorized failures of a deployment in the format chosen with --diagnostics-format
+func (dc *deployCmd) writeDiagnostics(w io.Writer, deploymentErr *armhelpers.DeploymentError) error {
+	diagnostics := deploymentErr.Diagnostics()
+	if dc.diagnosticsFormat != "json" {
+		_, err := io.WriteString(w, diagnostics.String())
+		return err
+	}
+	b, err := diagnostics.JSON()
+	if err != nil {
+		return errors.Wrap(err, "error marshalling deployment diagnostics")
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
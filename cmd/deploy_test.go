@@ -4,8 +4,11 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 
 	"os"
@@ -99,7 +102,7 @@ func TestNewDeployCmd(t *testing.T) {
 		t.Fatalf("deploy command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, deployName, output.Short, deployShortDescription, output.Long, versionLongDescription)
 	}
 
-	expectedFlags := []string{"api-model", "dns-prefix", "auto-suffix", "output-directory", "ca-private-key-path", "resource-group", "location", "force-overwrite"}
+	expectedFlags := []string{"api-model", "dns-prefix", "auto-suffix", "output-directory", "ca-private-key-path", "resource-group", "location", "force-overwrite", "diagnostics-format", "addons-dir"}
 	for _, f := range expectedFlags {
 		if output.Flags().Lookup(f) == nil {
 			t.Fatalf("deploy command should have flag %s", f)
@@ -192,6 +195,19 @@ func TestValidate(t *testing.T) {
 			args:        []string{},
 			expectedErr: nil,
 		},
+		{
+			dc: &deployCmd{
+				apimodelPath:      apimodelPath,
+				dnsPrefix:         "test",
+				outputDirectory:   "output/test",
+				caCertificatePath: "test",
+				caPrivateKeyPath:  "test",
+				location:          "canadaeast",
+				diagnosticsFormat: "yaml",
+			},
+			args:        []string{},
+			expectedErr: errors.New("--diagnostics-format must be text or json, got yaml"),
+		},
 	}
 
 	for _, c := range cases {
@@ -536,6 +552,22 @@ func TestDeployCmdMergeAPIModel(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error calling mergeAPIModel with one --set flag to override an array property: %s", err.Error())
 	}
+
+	d = &deployCmd{}
+	d.apimodelPath = "../pkg/acsengine/testdata/simple/kubernetes.json"
+	d.values = []string{"../pkg/acsengine/testdata/simple/kubernetes.json"}
+	d.setFiles = []string{"linuxProfile.ssh.publicKeys[0].keyData=../pkg/acsengine/testdata/simple/kubernetes.json"}
+	err = d.mergeAPIModel()
+	if err != nil {
+		t.Fatalf("unexpected error calling mergeAPIModel with --values and --set-file flags: %s", err.Error())
+	}
+
+	d = &deployCmd{}
+	d.apimodelPath = "../pkg/acsengine/testdata/simple/kubernetes.json"
+	d.set = []string{"agentPoolProfiles[5].count=1"}
+	if err = d.mergeAPIModel(); err == nil {
+		t.Fatalf("expected an error calling mergeAPIModel with a --set flag overriding a missing array item")
+	}
 }
 
 func TestDeployCmdRun(t *testing.T) {
@@ -577,3 +609,34 @@ func TestDeployCmdRun(t *testing.T) {
 	}
 
 }
+
+func TestDeployCmdWriteDiagnostics(t *testing.T) {
+	deploymentErr := &armhelpers.DeploymentError{
+		DeploymentName: "contoso-1234",
+		ResourceGroup:  "contoso",
+		Response:       []byte(`{"error":{"code":"InvalidTemplateDeployment","message":"The template deployment is not valid.","details":[{"code":"QuotaExceeded","message":"Operation results in exceeding quota limits of Core."}]}}`),
+	}
+
+	var buf bytes.Buffer
+	d := &deployCmd{}
+	if err := d.writeDiagnostics(&buf, deploymentErr); err != nil {
+		t.Fatalf("unexpected error writing text diagnostics: %s", err.Error())
+	}
+	expected := "deployment contoso-1234 in resource group contoso failed with 1 errors\n- QuotaExceeded\n"
+	if !strings.HasPrefix(buf.String(), expected) {
+		t.Fatalf("expected text diagnostics to start with %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	d.diagnosticsFormat = "json"
+	if err := d.writeDiagnostics(&buf, deploymentErr); err != nil {
+		t.Fatalf("unexpected error writing JSON diagnostics: %s", err.Error())
+	}
+	var diagnostics armhelpers.DeploymentDiagnostics
+	if err := json.Unmarshal(buf.Bytes(), &diagnostics); err != nil {
+		t.Fatalf("expected JSON diagnostics, got %s: %s", buf.String(), err.Error())
+	}
+	if len(diagnostics.Failures) != 1 || diagnostics.Failures[0].Category != armhelpers.FailureQuotaExceeded {
+		t.Fatalf("unexpected JSON diagnostics: %s", buf.String())
+	}
+}
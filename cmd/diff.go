@@ -0,0 +1,196 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/Azure/acs-engine/pkg/acsengine"
+	"github.com/Azure/acs-engine/pkg/acsengine/transform"
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	diffName             = "diff"
+	diffShortDescription = "Preview the changes an updated apimodel makes to an existing deployment"
+	diffLongDescription  = "Generates the Azure Resource Manager template and parameters for an apimodel and compares them, resource by resource, with the ones already in the deployment directory"
+)
+
+type diffCmd struct {
+	apimodelPath        string
+	deploymentDirectory string // can be auto-determined from clusterDefinition
+	apiModelOverrides
+	addonsArgs
+
+	// derived
+	containerService *api.ContainerService
+	apiVersion       string
+	locale           *gotext.Locale
+	result           commandResult
+}
+
+func newDiffCmd() *cobra.Command {
+	dc := diffCmd{}
+
+	diffCmd := &cobra.Command{
+		Use:   diffName,
+		Short: diffShortDescription,
+		Long:  diffLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCommand(cmd, &dc.result, func() error {
+				if err := dc.validate(cmd, args); err != nil {
+					return errors.Wrap(newValidationError(err), "error validating diffCmd")
+				}
+				if err := dc.mergeAPIModel(); err != nil {
+					return errors.Wrap(newValidationError(err), "error merging API model in diffCmd")
+				}
+				if err := dc.loadAPIModel(); err != nil {
+					return errors.Wrap(newValidationError(err), "error loading API model in diffCmd")
+				}
+				return dc.run(cmd)
+			})
+		},
+	}
+
+	f := diffCmd.Flags()
+	f.StringVarP(&dc.apimodelPath, "api-model", "m", "", "path to the updated apimodel file")
+	f.StringVar(&dc.deploymentDirectory, "deployment-dir", "", "the location of the output from generate to compare with (derived from the dns prefix if absent)")
+	addAPIModelOverrideFlags(&dc.apiModelOverrides, f)
+	addAddonsFlags(&dc.addonsArgs, f)
+
+	return diffCmd
+}
+
+func (dc *diffCmd) validate(cmd *cobra.Command, args []string) error {
+	var err error
+
+	dc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if dc.apimodelPath == "" {
+		if len(args) == 1 {
+			dc.apimodelPath = args[0]
+		} else if len(args) > 1 {
+			cmd.Usage()
+			return errors.New("too many arguments were provided to 'diff'")
+		} else {
+			cmd.Usage()
+			return errors.New("--api-model was not supplied, nor was one specified as a positional argument")
+		}
+	}
+
+	if _, err := os.Stat(dc.apimodelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", dc.apimodelPath)
+	}
+
+	return nil
+}
+
+func (dc *diffCmd) mergeAPIModel() error {
+	var err error
+	// overrides the api model and generates a new file if --set, --set-file or --values have been used
+	dc.apimodelPath, err = dc.mergeOverrides(dc.apimodelPath)
+	if err != nil {
+		return errors.Wrap(err, "error merging --set, --set-file and --values with the api model")
+	}
+
+	return nil
+}
+
+func (dc *diffCmd) loadAPIModel() error {
+	var err error
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: dc.locale,
+		},
+	}
+	dc.containerService, dc.apiVersion, err = apiloader.LoadContainerServiceFromFile(dc.apimodelPath, true, false, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+	if err = dc.setAddonRegistry(dc.containerService); err != nil {
+		return err
+	}
+
+	if dc.deploymentDirectory == "" {
+		if dc.containerService.Properties.MasterProfile != nil {
+			dc.deploymentDirectory = path.Join("_output", dc.containerService.Properties.MasterProfile.DNSPrefix)
+		} else {
+			dc.deploymentDirectory = path.Join("_output", dc.containerService.Properties.HostedMasterProfile.DNSPrefix)
+		}
+	}
+
+	return nil
+}
+
+func (dc *diffCmd) run(cmd *cobra.Command) error {
+	existingTemplate, err := readJSONFile(path.Join(dc.deploymentDirectory, "azuredeploy.json"))
+	if err != nil {
+		return errors.Wrap(err, "error reading the existing template")
+	}
+	existingParametersFile, err := readJSONFile(path.Join(dc.deploymentDirectory, "azuredeploy.parameters.json"))
+	if err != nil {
+		return errors.Wrap(err, "error reading the existing template parameters")
+	}
+	existingParameters, _ := existingParametersFile["parameters"].(map[string]interface{})
+
+	ctx := acsengine.Context{
+		Translator: &i18n.Translator{
+			Locale: dc.locale,
+		},
+	}
+	templateGenerator, err := acsengine.InitializeTemplateGenerator(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize template generator")
+	}
+
+	if _, err = dc.containerService.SetPropertiesDefaults(false, false); err != nil {
+		return errors.Wrapf(err, "error in SetPropertiesDefaults template %s", dc.apimodelPath)
+	}
+	template, parameters, err := templateGenerator.GenerateTemplate(dc.containerService, acsengine.DefaultGeneratorCode, BuildTag)
+	if err != nil {
+		return errors.Wrapf(err, "error generating template %s", dc.apimodelPath)
+	}
+
+	templateJSON := make(map[string]interface{})
+	parametersJSON := make(map[string]interface{})
+	if err = json.Unmarshal([]byte(template), &templateJSON); err != nil {
+		return errors.Wrap(err, "error unmarshaling template")
+	}
+	if err = json.Unmarshal([]byte(parameters), &parametersJSON); err != nil {
+		return errors.Wrap(err, "error unmarshaling parameters")
+	}
+
+	log.Infof("Comparing with the deployment in %s...", dc.deploymentDirectory)
+	d := transform.DiffTemplates(existingTemplate, existingParameters, templateJSON, parametersJSON)
+	dc.result.OutputDirectory = dc.deploymentDirectory
+	dc.result.Diff = d
+	if outputFormat == "json" {
+		return nil
+	}
+	return d.Write(cmd.OutOrStdout())
+}
+
+func readJSONFile(filePath string) (map[string]interface{}, error) {
+	contents, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(contents, &m); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", filePath)
+	}
+	return m, nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestNewDiffCmd(t *testing.T) {
+	output := newDiffCmd()
+	if output.Use != diffName || output.Short != diffShortDescription || output.Long != diffLongDescription {
+		t.Fatalf("diff command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, diffName, output.Short, diffShortDescription, output.Long, diffLongDescription)
+	}
+
+	expectedFlags := []string{"api-model", "deployment-dir", "set", "set-file", "values", "addons-dir"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("diff command should have flag %s", f)
+		}
+	}
+}
+
+func TestDiffCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	d := &diffCmd{}
+	if err := d.validate(r, []string{"../pkg/acsengine/testdata/simple/kubernetes.json"}); err != nil {
+		t.Fatalf("unexpected error validating 1 arg: %s", err.Error())
+	}
+
+	d = &diffCmd{}
+	if err := d.validate(r, []string{}); err == nil {
+		t.Fatalf("expected error validating 0 args")
+	}
+
+	d = &diffCmd{}
+	if err := d.validate(r, []string{"../pkg/acsengine/testdata/simple/kubernetes.json", "arg1"}); err == nil {
+		t.Fatalf("expected error validating multiple args")
+	}
+}
+
+func TestDiffCmdRun(t *testing.T) {
+	deploymentDir, err := ioutil.TempDir("", "acs-engine-diff")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(deploymentDir)
+
+	// generate a deployment from the apimodel, then compare it with a scaled out master pool
+	g := &generateCmd{
+		apimodelPath:    "../pkg/acsengine/testdata/simple/kubernetes.json",
+		outputDirectory: deploymentDir,
+	}
+	r := &cobra.Command{}
+	if err = g.validate(r, []string{}); err != nil {
+		t.Fatalf("unexpected error validating generate command: %s", err.Error())
+	}
+	if err = g.loadAPIModel(r, []string{}); err != nil {
+		t.Fatalf("unexpected error loading api model: %s", err.Error())
+	}
+	if err = g.run(); err != nil {
+		t.Fatalf("unexpected error generating templates: %s", err.Error())
+	}
+
+	var out bytes.Buffer
+	r.SetOutput(&out)
+	d := &diffCmd{
+		apimodelPath:        path.Join(deploymentDir, "apimodel.json"),
+		deploymentDirectory: deploymentDir,
+		apiModelOverrides:   apiModelOverrides{set: []string{"agentPoolProfiles[0].count=5"}},
+	}
+	if err = d.validate(r, []string{}); err != nil {
+		t.Fatalf("unexpected error validating diff command: %s", err.Error())
+	}
+	if err = d.mergeAPIModel(); err != nil {
+		t.Fatalf("unexpected error merging api model: %s", err.Error())
+	}
+	if err = d.loadAPIModel(); err != nil {
+		t.Fatalf("unexpected error loading api model: %s", err.Error())
+	}
+	if err = d.run(r); err != nil {
+		t.Fatalf("unexpected error running diff: %s", err.Error())
+	}
+
+	if !strings.Contains(out.String(), "~ agentpool1Count: 3 => 5") {
+		t.Fatalf("expected diff to report the changed agent pool count, got:\n%s", out.String())
+	}
+
+	// with --output json the changes are only part of the result
+	defer func() { outputFormat = "human" }()
+	outputFormat = "json"
+	out.Reset()
+	if err = d.run(r); err != nil {
+		t.Fatalf("unexpected error running diff: %s", err.Error())
+	}
+	if out.Len() != 0 || d.result.Diff == nil || len(d.result.Diff.Parameters) == 0 {
+		t.Fatalf("expected the changes in the result only, got %+v and output %s", d.result.Diff, out.String())
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Azure/acs-engine/pkg/engine"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	exportName             = "export"
+	exportShortDescription = "Export an apimodel with its secrets redacted"
+	exportLongDescription  = "Export an apimodel in any API version with its certificates, keys and passwords replaced by placeholders, optionally sealing them in a file to restore them later"
+)
+
+type exportCmd struct {
+	apimodelPath      string
+	apiVersion        string
+	redact            bool
+	restore           bool
+	sealedSecretsPath string
+	sealKeyPath       string
+	outputFile        string
+
+	// derived
+	apimodel    []byte
+	sealKey     []byte
+	sealed      []byte
+	generateKey bool
+	locale      *gotext.Locale
+	result      commandResult
+}
+
+func newExportCmd() *cobra.Command {
+	ec := exportCmd{}
+
+	exportCmd := &cobra.Command{
+		Use:   exportName,
+		Short: exportShortDescription,
+		Long:  exportLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCommand(cmd, &ec.result, func() error {
+				if err := ec.validate(cmd, args); err != nil {
+					return errors.Wrap(newValidationError(err), "error validating exportCmd")
+				}
+				return ec.run(cmd)
+			})
+		},
+	}
+
+	f := exportCmd.Flags()
+	f.StringVarP(&ec.apimodelPath, "api-model", "m", "", "path to the apimodel file")
+	f.StringVar(&ec.apiVersion, "api-version", "", fmt.Sprintf("API version to export the apimodel in: %s (defaults to the version of the apimodel)", strings.Join(engine.MigrateAPIVersions, ", ")))
+	f.BoolVar(&ec.redact, "redact", false, "replace the certificates, keys and passwords of the apimodel with placeholders")
+	f.BoolVar(&ec.restore, "restore", false, "replace the placeholders of a redacted apimodel with the secrets of --sealed-secrets")
+	f.StringVar(&ec.sealedSecretsPath, "sealed-secrets", "", "file to seal the redacted secrets in with --redact, or to restore them from with --restore")
+	f.StringVar(&ec.sealKeyPath, "seal-key", "", "file holding the key the secrets are sealed with, generated by --redact when it does not exist")
+	f.StringVar(&ec.outputFile, "output-file", "", "file to write the exported apimodel to (defaults to stdout)")
+
+	return exportCmd
+}
+
+func (ec *exportCmd) validate(cmd *cobra.Command, args []string) error {
+	var err error
+
+	ec.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if ec.apimodelPath == "" {
+		if len(args) == 1 {
+			ec.apimodelPath = args[0]
+		} else if len(args) > 1 {
+			cmd.Usage()
+			return errors.New("too many arguments were provided to 'export'")
+		} else {
+			cmd.Usage()
+			return errors.New("--api-model was not supplied, nor was one specified as a positional argument")
+		}
+	}
+
+	if ec.redact && ec.restore {
+		return errors.New("--redact and --restore cannot be used together")
+	}
+	if ec.restore && (ec.sealedSecretsPath == "" || ec.sealKeyPath == "") {
+		return errors.New("--restore requires --sealed-secrets and --seal-key")
+	}
+	if ec.sealedSecretsPath != "" && !ec.redact && !ec.restore {
+		return errors.New("--sealed-secrets requires --redact or --restore")
+	}
+	if ec.redact && ec.sealedSecretsPath != "" && ec.sealKeyPath == "" {
+		return errors.New("--sealed-secrets requires --seal-key")
+	}
+	if ec.outputFile == "" && outputFormat == "json" {
+		return errors.New("--output-file must be specified with --output json")
+	}
+
+	if _, err := os.Stat(ec.apimodelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", ec.apimodelPath)
+	}
+	ec.apimodel, err = ioutil.ReadFile(ec.apimodelPath)
+	if err != nil {
+		return errors.Wrapf(err, "error reading the api model %s", ec.apimodelPath)
+	}
+
+	if ec.sealedSecretsPath == "" {
+		return nil
+	}
+	if ec.restore {
+		if ec.sealed, err = ioutil.ReadFile(ec.sealedSecretsPath); err != nil {
+			return errors.Wrapf(err, "error reading the sealed secrets %s", ec.sealedSecretsPath)
+		}
+	}
+	key, err := ioutil.ReadFile(ec.sealKeyPath)
+	if os.IsNotExist(err) && ec.redact {
+		ec.generateKey = true
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error reading the seal key %s", ec.sealKeyPath)
+	}
+	if ec.sealKey, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(key))); err != nil {
+		return errors.Wrapf(err, "the seal key %s is not base64 encoded", ec.sealKeyPath)
+	}
+	return nil
+}
+
+func (ec *exportCmd) run(cmd *cobra.Command) error {
+	if ec.generateKey {
+		key, err := engine.GenerateSealKey()
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(ec.sealKeyPath, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+			return errors.Wrapf(err, "error writing the seal key %s", ec.sealKeyPath)
+		}
+		ec.sealKey = key
+		ec.result.Artifacts = append(ec.result.Artifacts, ec.sealKeyPath)
+		log.Infof("generated seal key %s", ec.sealKeyPath)
+	}
+
+	result, err := engine.Export(context.Background(), engine.ExportOptions{
+		APIModel:   ec.apimodel,
+		APIVersion: ec.apiVersion,
+		Redact:     ec.redact,
+		SealKey:    ec.sealKey,
+		Sealed:     ec.sealed,
+		Translator: &i18n.Translator{
+			Locale: ec.locale,
+		},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error exporting %s", ec.apimodelPath)
+	}
+	ec.result.RedactedFields = result.RedactedFields
+	ec.result.RestoredFields = result.RestoredFields
+
+	for _, path := range result.RedactedFields {
+		log.Infof("redacted %s", path)
+	}
+	for _, path := range result.RestoredFields {
+		log.Infof("restored %s", path)
+	}
+
+	if result.Sealed != nil {
+		if err := ioutil.WriteFile(ec.sealedSecretsPath, result.Sealed, 0600); err != nil {
+			return errors.Wrapf(err, "error writing the sealed secrets %s", ec.sealedSecretsPath)
+		}
+		ec.result.Artifacts = append(ec.result.Artifacts, ec.sealedSecretsPath)
+		log.Infof("sealed %d secrets in %s", len(result.RedactedFields), ec.sealedSecretsPath)
+	}
+
+	if ec.outputFile == "" {
+		fmt.Fprintln(cmd.OutOrStdout(), string(result.APIModel))
+		return nil
+	}
+	// a restored apimodel holds the secrets of the cluster
+	if err := ioutil.WriteFile(ec.outputFile, result.APIModel, 0600); err != nil {
+		return errors.Wrapf(err, "error writing %s", ec.outputFile)
+	}
+	ec.result.Artifacts = append(ec.result.Artifacts, ec.outputFile)
+	log.Infof("apimodel %s exported in %s", ec.apimodelPath, ec.outputFile)
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestNewExportCmd(t *testing.T) {
+	output := newExportCmd()
+	if output.Use != exportName || output.Short != exportShortDescription || output.Long != exportLongDescription {
+		t.Fatalf("export command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, exportName, output.Short, exportShortDescription, output.Long, exportLongDescription)
+	}
+
+	expectedFlags := []string{"api-model", "api-version", "redact", "restore", "sealed-secrets", "seal-key", "output-file"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("export command should have flag %s", f)
+		}
+	}
+}
+
+func TestExportCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+	apimodel := "../examples/windows/kubernetes.json"
+
+	for _, test := range []struct {
+		desc string
+		e    *exportCmd
+		args []string
+		ok   bool
+	}{
+		{"positional apimodel", &exportCmd{redact: true}, []string{apimodel}, true},
+		{"no apimodel", &exportCmd{}, []string{}, false},
+		{"too many args", &exportCmd{}, []string{apimodel, "arg1"}, false},
+		{"missing apimodel", &exportCmd{apimodelPath: "../examples/does-not-exist.json"}, []string{}, false},
+		{"redact and restore", &exportCmd{apimodelPath: apimodel, redact: true, restore: true}, []string{}, false},
+		{"restore without sealed secrets", &exportCmd{apimodelPath: apimodel, restore: true, sealKeyPath: "key"}, []string{}, false},
+		{"sealed secrets without redact", &exportCmd{apimodelPath: apimodel, sealedSecretsPath: "sealed.json", sealKeyPath: "key"}, []string{}, false},
+		{"sealed secrets without seal key", &exportCmd{apimodelPath: apimodel, redact: true, sealedSecretsPath: "sealed.json"}, []string{}, false},
+	} {
+		err := test.e.validate(r, test.args)
+		if test.ok && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.desc, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: expected an error", test.desc)
+		}
+	}
+}
+
+func TestExportCmdRun(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "acs-engine-export")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(outputDir)
+
+	var buf bytes.Buffer
+	r := &cobra.Command{}
+	r.SetOutput(&buf)
+	sealKey := path.Join(outputDir, "seal.key")
+	sealed := path.Join(outputDir, "sealed.json")
+	redacted := path.Join(outputDir, "redacted.json")
+	e := &exportCmd{apimodelPath: "../examples/windows/kubernetes.json", redact: true, sealedSecretsPath: sealed, sealKeyPath: sealKey, outputFile: redacted}
+	if err := e.validate(r, []string{}); err != nil {
+		t.Fatalf("unexpected error validating: %s", err.Error())
+	}
+	if err := e.run(r); err != nil {
+		t.Fatalf("unexpected error redacting: %s", err.Error())
+	}
+	if len(e.result.Artifacts) != 3 || len(e.result.RedactedFields) != 1 {
+		t.Fatalf("expected the seal key, the sealed secrets and the apimodel to be written, got %v", e.result.Artifacts)
+	}
+	if b, err := ioutil.ReadFile(redacted); err != nil || strings.Contains(string(b), "replacepassword1234$") {
+		t.Fatalf("expected the redacted apimodel without the admin password, got %v", err)
+	}
+
+	e = &exportCmd{apimodelPath: redacted, restore: true, sealedSecretsPath: sealed, sealKeyPath: sealKey}
+	if err := e.validate(r, []string{}); err != nil {
+		t.Fatalf("unexpected error validating: %s", err.Error())
+	}
+	if err := e.run(r); err != nil {
+		t.Fatalf("unexpected error restoring: %s", err.Error())
+	}
+	if !strings.Contains(buf.String(), "replacepassword1234$") || len(e.result.RestoredFields) != 1 {
+		t.Fatalf("expected the restored apimodel on stdout, got %s", buf.String())
+	}
+}
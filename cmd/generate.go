@@ -4,14 +4,19 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/Azure/acs-engine/pkg/acsengine"
-	"github.com/Azure/acs-engine/pkg/acsengine/transform"
 	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/engine"
+	"github.com/Azure/acs-engine/pkg/helpers"
 	"github.com/Azure/acs-engine/pkg/i18n"
 	"github.com/leonelquinteros/gotext"
 	"github.com/pkg/errors"
@@ -23,6 +28,9 @@ const (
 	generateName             = "generate"
 	generateShortDescription = "Generate an Azure Resource Manager template"
 	generateLongDescription  = "Generates an Azure Resource Manager template, parameters file and other assets for a cluster"
+
+	// seedEnvVar is read for the seed when neither --seed nor --seed-file is given
+	seedEnvVar = "ACS_ENGINE_SEED"
 )
 
 type generateCmd struct {
@@ -32,12 +40,23 @@ type generateCmd struct {
 	caPrivateKeyPath  string
 	noPrettyPrint     bool
 	parametersOnly    bool
-	set               []string
+	explainDefaults   bool
+	seed              string
+	seedFile          string
+	notBefore         string
+	reuseSecrets      bool
+	renderAddons      bool
+	apiModelOverrides
+	authArgs
+	addonsArgs
 
 	// derived
 	containerService *api.ContainerService
+	client           armhelpers.ACSEngineClient
 	apiVersion       string
 	locale           *gotext.Locale
+	seedNotBefore    time.Time
+	result           commandResult
 }
 
 func newGenerateCmd() *cobra.Command {
@@ -48,19 +67,21 @@ func newGenerateCmd() *cobra.Command {
 		Short: generateShortDescription,
 		Long:  generateLongDescription,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := gc.validate(cmd, args); err != nil {
-				log.Fatalf(fmt.Sprintf("error validating generateCmd: %s", err.Error()))
-			}
+			return runCommand(cmd, &gc.result, func() error {
+				if err := gc.validate(cmd, args); err != nil {
+					return errors.Wrap(newValidationError(err), "error validating generateCmd")
+				}
 
-			if err := gc.mergeAPIModel(); err != nil {
-				log.Fatalf(fmt.Sprintf("error merging API model in generateCmd: %s", err.Error()))
-			}
+				if err := gc.mergeAPIModel(); err != nil {
+					return errors.Wrap(newValidationError(err), "error merging API model in generateCmd")
+				}
 
-			if err := gc.loadAPIModel(cmd, args); err != nil {
-				log.Fatalf(fmt.Sprintf("error loading API model in generateCmd: %s", err.Error()))
-			}
+				if err := gc.loadAPIModel(cmd, args); err != nil {
+					return errors.Wrap(newValidationError(err), "error loading API model in generateCmd")
+				}
 
-			return gc.run()
+				return gc.run()
+			})
 		},
 	}
 
@@ -69,9 +90,18 @@ func newGenerateCmd() *cobra.Command {
 	f.StringVarP(&gc.outputDirectory, "output-directory", "o", "", "output directory (derived from FQDN if absent)")
 	f.StringVar(&gc.caCertificatePath, "ca-certificate-path", "", "path to the CA certificate to use for Kubernetes PKI assets")
 	f.StringVar(&gc.caPrivateKeyPath, "ca-private-key-path", "", "path to the CA private key to use for Kubernetes PKI assets")
-	f.StringArrayVar(&gc.set, "set", []string{}, "set values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	addAPIModelOverrideFlags(&gc.apiModelOverrides, f)
+	addAddonsFlags(&gc.addonsArgs, f)
 	f.BoolVar(&gc.noPrettyPrint, "no-pretty-print", false, "skip pretty printing the output")
 	f.BoolVar(&gc.parametersOnly, "parameters-only", false, "only output parameters files")
+	f.BoolVar(&gc.explainDefaults, "explain-defaults", false, "write the fields defaulted by acs-engine, with the rules that chose them, to "+engine.DefaultsFileName)
+	f.StringVar(&gc.seed, "seed", "", "secret to derive the generated certificates and keys from, for the same apimodel to always generate the same artifacts; also read from "+seedEnvVar)
+	f.StringVar(&gc.seedFile, "seed-file", "", "path to a file holding the seed, which unlike --seed is not visible in the process list")
+	f.StringVar(&gc.notBefore, "not-before", "", "date the certificates derived from --seed are valid from, such as 2018-10-01; required with --seed unless SOURCE_DATE_EPOCH is set")
+	f.BoolVar(&gc.reuseSecrets, "reuse-secrets", false, "reuse the certificates and keys of the apimodel.json in the output directory, if any")
+	f.BoolVar(&gc.renderAddons, "render-addons", false, "write the manifests of the enabled addons to the "+engine.AddonsDirectoryName+" directory of the output directory, for review")
+	// the credentials are only used to store the secrets of an apimodel with a secrets Key Vault
+	addAuthFlags(&gc.authArgs, f)
 
 	return generateCmd
 }
@@ -100,23 +130,26 @@ func (gc *generateCmd) validate(cmd *cobra.Command, args []string) error {
 		return errors.Errorf("specified api model does not exist (%s)", gc.apimodelPath)
 	}
 
+	if gc.seed, err = readSeed(gc.seed, gc.seedFile); err != nil {
+		return err
+	}
+	if gc.seed != "" {
+		if gc.seedNotBefore, err = seedNotBefore(gc.notBefore); err != nil {
+			return err
+		}
+	} else if gc.notBefore != "" {
+		return errors.New("--not-before can only be used with --seed")
+	}
+
 	return nil
 }
 
 func (gc *generateCmd) mergeAPIModel() error {
 	var err error
-	// if --set flag has been used
-	if gc.set != nil && len(gc.set) > 0 {
-		m := make(map[string]transform.APIModelValue)
-		transform.MapValues(m, gc.set)
-
-		// overrides the api model and generates a new file
-		gc.apimodelPath, err = transform.MergeValuesWithAPIModel(gc.apimodelPath, m)
-		if err != nil {
-			return errors.Wrap(err, "error merging --set values with the api model")
-		}
-
-		log.Infoln(fmt.Sprintf("new api model file has been generated during merge: %s", gc.apimodelPath))
+	// overrides the api model and generates a new file if --set, --set-file or --values have been used
+	gc.apimodelPath, err = gc.mergeOverrides(gc.apimodelPath)
+	if err != nil {
+		return errors.Wrap(err, "error merging --set, --set-file and --values with the api model")
 	}
 
 	return nil
@@ -134,8 +167,12 @@ func (gc *generateCmd) loadAPIModel(cmd *cobra.Command, args []string) error {
 	}
 	gc.containerService, gc.apiVersion, err = apiloader.LoadContainerServiceFromFile(gc.apimodelPath, true, false, nil)
 	if err != nil {
+		logValidationWarnings(err)
 		return errors.Wrap(err, "error parsing the api model")
 	}
+	if err = gc.setAddonRegistry(gc.containerService); err != nil {
+		return err
+	}
 
 	if gc.outputDirectory == "" {
 		if gc.containerService.Properties.MasterProfile != nil {
@@ -166,50 +203,118 @@ func (gc *generateCmd) loadAPIModel(cmd *cobra.Command, args []string) error {
 		prop.CertificateProfile.CaPrivateKey = string(caKeyBytes)
 	}
 
+	if gc.containerService.Properties.SecretsKeyvault != nil {
+		if err = gc.authArgs.validateAuthArgs(); err != nil {
+			return err
+		}
+		if gc.client, err = gc.authArgs.getClient(); err != nil {
+			return errors.Wrap(err, "failed to get client")
+		}
+	}
+
+	if gc.reuseSecrets {
+		existingPath := path.Join(gc.outputDirectory, "apimodel.json")
+		if _, err := os.Stat(existingPath); os.IsNotExist(err) {
+			log.Infof("no secrets to reuse, %s does not exist", existingPath)
+			return nil
+		}
+		existing, _, err := apiloader.LoadContainerServiceFromFile(existingPath, false, false, nil)
+		if err != nil {
+			return errors.Wrapf(err, "error loading the secrets to reuse from %s", existingPath)
+		}
+		if err := gc.containerService.ReuseSecrets(existing); err != nil {
+			return errors.Wrapf(err, "error reusing the secrets of %s", existingPath)
+		}
+	}
+
 	return nil
 }
 
 func (gc *generateCmd) run() error {
 	log.Infoln(fmt.Sprintf("Generating assets into %s...", gc.outputDirectory))
 
-	ctx := acsengine.Context{
+	var secretSource *helpers.SecretSource
+	if gc.seed != "" {
+		// the DNS prefix keeps two clusters generated with the same seed from sharing their keys
+		secretSource = helpers.NewSeededSecretSource(gc.seed, gc.containerService.Properties.GetDNSPrefix(), gc.seedNotBefore)
+	}
+
+	result, err := engine.Generate(context.Background(), engine.GenerateOptions{
+		ContainerService: gc.containerService,
+		APIVersion:       gc.apiVersion,
+		OutputDirectory:  gc.outputDirectory,
+		ParametersOnly:   gc.parametersOnly,
+		NoPrettyPrint:    gc.noPrettyPrint,
+		BuildTag:         BuildTag,
+		ExplainDefaults:  gc.explainDefaults,
+		SecretSource:     secretSource,
 		Translator: &i18n.Translator{
 			Locale: gc.locale,
 		},
-	}
-	templateGenerator, err := acsengine.InitializeTemplateGenerator(ctx)
+		Client:       gc.client,
+		RenderAddons: gc.renderAddons,
+	})
 	if err != nil {
-		log.Fatalf("failed to initialize template generator: %s", err.Error())
+		return errors.Wrapf(err, "error generating template %s", gc.apimodelPath)
 	}
 
-	certsGenerated, err := gc.containerService.SetPropertiesDefaults(false, false)
-	if err != nil {
-		log.Fatalf("error in SetPropertiesDefaults template %s: %s", gc.apimodelPath, err.Error())
-		os.Exit(1)
+	if gc.explainDefaults {
+		log.Infof("%d defaulted fields written to %s", len(result.Defaults), path.Join(gc.outputDirectory, engine.DefaultsFileName))
 	}
-	template, parameters, err := templateGenerator.GenerateTemplate(gc.containerService, acsengine.DefaultGeneratorCode, BuildTag)
-	if err != nil {
-		log.Fatalf("error generating template %s: %s", gc.apimodelPath, err.Error())
-		os.Exit(1)
+
+	if gc.renderAddons {
+		log.Infof("addon manifests written to %s", path.Join(gc.outputDirectory, engine.AddonsDirectoryName))
 	}
 
-	if !gc.noPrettyPrint {
-		if template, err = transform.PrettyPrintArmTemplate(template); err != nil {
-			log.Fatalf("error pretty printing template: %s \n", err.Error())
-		}
-		if parameters, err = transform.BuildAzureParametersFile(parameters); err != nil {
-			log.Fatalf("error pretty printing template parameters: %s \n", err.Error())
-		}
+	for _, secret := range result.Secrets {
+		log.Infof("stored secret %s", secret)
 	}
 
-	writer := &acsengine.ArtifactWriter{
-		Translator: &i18n.Translator{
-			Locale: gc.locale,
-		},
+	gc.result.OutputDirectory = gc.outputDirectory
+	gc.result.Artifacts = result.Artifacts
+	gc.result.Secrets = result.Secrets
+	return nil
+}
+
+// readSeed returns the seed of --seed, otherwise the contents of --seed-file without its trailing
+// newline, otherwise the value of ACS_ENGINE_SEED
+func readSeed(seed, seedFile string) (string, error) {
+	if seedFile == "" {
+		if seed == "" {
+			seed = os.Getenv(seedEnvVar)
+		}
+		return seed, nil
 	}
-	if err = writer.WriteTLSArtifacts(gc.containerService, gc.apiVersion, template, parameters, gc.outputDirectory, certsGenerated, gc.parametersOnly); err != nil {
-		log.Fatalf("error writing artifacts: %s \n", err.Error())
+	if seed != "" {
+		return "", errors.New("--seed and --seed-file cannot be used together")
 	}
+	b, err := ioutil.ReadFile(seedFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading the seed file %s", seedFile)
+	}
+	if seed = strings.TrimRight(string(b), "\r\n"); seed == "" {
+		return "", errors.Errorf("the seed file %s is empty", seedFile)
+	}
+	return seed, nil
+}
 
-	return nil
+// seedNotBefore returns the time the certificates derived from --seed are valid from: the date of
+// --not-before, otherwise SOURCE_DATE_EPOCH. One of them is required, as a default that changes over
+// time would not generate the same certificates on every run.
+func seedNotBefore(date string) (time.Time, error) {
+	if date != "" {
+		notBefore, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return time.Time{}, errors.Errorf("--not-before %s must be a date such as 2018-10-01", date)
+		}
+		return notBefore, nil
+	}
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "error parsing SOURCE_DATE_EPOCH %s", epoch)
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Time{}, errors.New("--seed requires --not-before or SOURCE_DATE_EPOCH to set the date the certificates are valid from")
 }
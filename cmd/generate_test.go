@@ -4,7 +4,13 @@
 package cmd
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -15,7 +21,7 @@ func TestNewGenerateCmd(t *testing.T) {
 		t.Fatalf("generate command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, generateName, output.Short, generateShortDescription, output.Long, generateLongDescription)
 	}
 
-	expectedFlags := []string{"api-model", "output-directory", "ca-certificate-path", "ca-private-key-path", "set", "no-pretty-print", "parameters-only"}
+	expectedFlags := []string{"api-model", "output-directory", "ca-certificate-path", "ca-private-key-path", "set", "set-file", "values", "no-pretty-print", "parameters-only", "explain-defaults", "seed", "seed-file", "not-before", "reuse-secrets", "render-addons", "addons-dir"}
 	for _, f := range expectedFlags {
 		if output.Flags().Lookup(f) == nil {
 			t.Fatalf("generate command should have flag %s", f)
@@ -51,6 +57,24 @@ func TestGenerateCmdValidate(t *testing.T) {
 		t.Fatalf("expected error validating multiple args")
 	}
 
+	g = &generateCmd{seed: "secret", notBefore: "2018-10-01"}
+
+	// validate cmd with --seed and --not-before
+	err = g.validate(r, []string{"../pkg/acsengine/testdata/simple/kubernetes.json"})
+	if err != nil {
+		t.Fatalf("unexpected error validating --seed: %s", err.Error())
+	}
+	if expected := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC); !g.seedNotBefore.Equal(expected) {
+		t.Fatalf("expected the certificates derived from --seed to be valid from %s, got %s", expected, g.seedNotBefore)
+	}
+
+	g = &generateCmd{notBefore: "2018-10-01"}
+
+	// validate cmd with --not-before without --seed
+	err = g.validate(r, []string{"../pkg/acsengine/testdata/simple/kubernetes.json"})
+	if err == nil || err.Error() != "--not-before can only be used with --seed" {
+		t.Fatalf("expected an error validating --not-before without --seed, got %v", err)
+	}
 }
 
 func TestGenerateCmdMergeAPIModel(t *testing.T) {
@@ -118,3 +142,166 @@ func TestGenerateCmdMLoadAPIModel(t *testing.T) {
 		t.Fatalf("unexpected error loading api model: %s", err.Error())
 	}
 }
+
+func TestGenerateCmdLoadAPIModelAddonsDir(t *testing.T) {
+	addonsDir, err := ioutil.TempDir("", "acs-engine-addons")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(addonsDir)
+	if err := os.Mkdir(path.Join(addonsDir, "my-addon"), 0755); err != nil {
+		t.Fatalf("unexpected error creating the addon directory: %s", err.Error())
+	}
+	if err := ioutil.WriteFile(path.Join(addonsDir, "my-addon", "addon.json"), []byte(`{"name": "my-addon", "manifest": "my-addon.yaml"}`), 0644); err != nil {
+		t.Fatalf("unexpected error writing the addon descriptor: %s", err.Error())
+	}
+	if err := ioutil.WriteFile(path.Join(addonsDir, "my-addon", "my-addon.yaml"), []byte("kind: Pod"), 0644); err != nil {
+		t.Fatalf("unexpected error writing the addon manifest: %s", err.Error())
+	}
+
+	r := &cobra.Command{}
+	g := &generateCmd{}
+	g.addonsDirs = []string{addonsDir}
+	g.validate(r, []string{"../pkg/acsengine/testdata/simple/kubernetes.json"})
+	if err := g.loadAPIModel(r, []string{}); err != nil {
+		t.Fatalf("unexpected error loading api model: %s", err.Error())
+	}
+	if g.containerService.AddonRegistry().Get("my-addon") == nil {
+		t.Fatalf("expected the addon of --addons-dir to be registered")
+	}
+
+	g = &generateCmd{}
+	g.addonsDirs = []string{path.Join(addonsDir, "does-not-exist")}
+	g.validate(r, []string{"../pkg/acsengine/testdata/simple/kubernetes.json"})
+	if err := g.loadAPIModel(r, []string{}); err == nil {
+		t.Fatalf("expected an error loading a missing addons directory")
+	}
+}
+
+func TestGenerateCmdLoadAPIModelReportsAllErrors(t *testing.T) {
+	g := &generateCmd{}
+	r := &cobra.Command{}
+
+	g.set = []string{"masterProfile.dnsPrefix=a", "agentPoolProfiles[0].availabilityProfile=Unknown"}
+
+	g.validate(r, []string{"../pkg/acsengine/testdata/simple/kubernetes.json"})
+	g.mergeAPIModel()
+	err := g.loadAPIModel(r, []string{"../pkg/acsengine/testdata/simple/kubernetes.json"})
+	if err == nil {
+		t.Fatalf("expected an error loading an invalid api model")
+	}
+	for _, expected := range []string{"3 validation errors", "properties.masterProfile:", "properties.agentPoolProfiles[0].availabilityProfile:"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected the error to contain %q, got %s", expected, err.Error())
+		}
+	}
+}
+
+func TestReadSeed(t *testing.T) {
+	defer os.Unsetenv(seedEnvVar)
+	f, err := ioutil.TempFile("", "seed")
+	if err != nil {
+		t.Fatalf("unable to create the seed file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString("file secret\n"); err != nil {
+		t.Fatalf("unable to write the seed file: %s", err)
+	}
+	f.Close()
+
+	os.Setenv(seedEnvVar, "env secret")
+	for _, c := range []struct {
+		seed, seedFile, expected string
+	}{
+		{"", "", "env secret"},
+		{"flag secret", "", "flag secret"},
+		{"", f.Name(), "file secret"},
+	} {
+		seed, err := readSeed(c.seed, c.seedFile)
+		if err != nil {
+			t.Fatalf("unexpected error reading the seed: %s", err)
+		}
+		if seed != c.expected {
+			t.Errorf("expected the seed %q, got %q", c.expected, seed)
+		}
+	}
+
+	if _, err = readSeed("flag secret", f.Name()); err == nil {
+		t.Errorf("expected an error with both --seed and --seed-file")
+	}
+	if _, err = readSeed("", f.Name()+".missing"); err == nil {
+		t.Errorf("expected an error reading a missing seed file")
+	}
+}
+
+func TestSeedNotBefore(t *testing.T) {
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+
+	os.Setenv("SOURCE_DATE_EPOCH", "1538352000")
+	notBefore, err := seedNotBefore("")
+	if err != nil {
+		t.Fatalf("unexpected error reading SOURCE_DATE_EPOCH: %s", err)
+	}
+	if expected := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC); !notBefore.Equal(expected) {
+		t.Fatalf("expected %s, got %s", expected, notBefore)
+	}
+
+	// --not-before takes precedence over SOURCE_DATE_EPOCH
+	if notBefore, err = seedNotBefore("2018-11-05"); err != nil {
+		t.Fatalf("unexpected error parsing --not-before: %s", err)
+	}
+	if expected := time.Date(2018, time.November, 5, 0, 0, 0, 0, time.UTC); !notBefore.Equal(expected) {
+		t.Fatalf("expected %s, got %s", expected, notBefore)
+	}
+	if _, err = seedNotBefore("11/05/2018"); err == nil {
+		t.Fatalf("expected an error for an invalid --not-before")
+	}
+
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err = seedNotBefore(""); err == nil {
+		t.Fatalf("expected an error for an invalid SOURCE_DATE_EPOCH")
+	}
+
+	os.Unsetenv("SOURCE_DATE_EPOCH")
+	if _, err = seedNotBefore(""); err == nil || !strings.Contains(err.Error(), "--seed requires --not-before or SOURCE_DATE_EPOCH") {
+		t.Fatalf("expected an error without a date, got %v", err)
+	}
+}
+
+func TestGenerateCmdReuseSecrets(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "acs-engine-generate")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(outputDir)
+
+	b, err := ioutil.ReadFile("../pkg/acsengine/testdata/simple/kubernetes.json")
+	if err != nil {
+		t.Fatalf("unexpected error reading the api model: %s", err.Error())
+	}
+	var apimodel map[string]interface{}
+	if err = json.Unmarshal(b, &apimodel); err != nil {
+		t.Fatalf("unexpected error decoding the api model: %s", err.Error())
+	}
+	apimodel["properties"].(map[string]interface{})["certificateProfile"] = map[string]interface{}{
+		"caCertificate": "caCertificate",
+		"caPrivateKey":  "caPrivateKey",
+	}
+	if b, err = json.Marshal(apimodel); err != nil {
+		t.Fatalf("unexpected error encoding the api model: %s", err.Error())
+	}
+	if err = ioutil.WriteFile(path.Join(outputDir, "apimodel.json"), b, 0600); err != nil {
+		t.Fatalf("unexpected error writing the api model: %s", err.Error())
+	}
+
+	g := &generateCmd{outputDirectory: outputDir, reuseSecrets: true}
+	r := &cobra.Command{}
+	g.validate(r, []string{"../pkg/acsengine/testdata/simple/kubernetes.json"})
+	g.mergeAPIModel()
+	if err = g.loadAPIModel(r, nil); err != nil {
+		t.Fatalf("unexpected error loading api model: %s", err.Error())
+	}
+	if c := g.containerService.Properties.CertificateProfile; c == nil || c.CaPrivateKey != "caPrivateKey" {
+		t.Fatalf("expected the certificate authority of %s to be reused, got %+v", outputDir, c)
+	}
+}
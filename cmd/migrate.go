@@ -0,0 +1,134 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Azure/acs-engine/pkg/api/vlabs"
+	"github.com/Azure/acs-engine/pkg/engine"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	migrateName             = "migrate"
+	migrateShortDescription = "Convert an apimodel to another API version"
+	migrateLongDescription  = "Convert an apimodel to another API version, reporting the fields the target version cannot hold and the fields set by the conversion"
+)
+
+type migrateCmd struct {
+	apimodelPath string
+	apiVersion   string
+	outputFile   string
+
+	// derived
+	apimodel []byte
+	locale   *gotext.Locale
+	result   commandResult
+}
+
+func newMigrateCmd() *cobra.Command {
+	mc := migrateCmd{}
+
+	migrateCmd := &cobra.Command{
+		Use:   migrateName,
+		Short: migrateShortDescription,
+		Long:  migrateLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCommand(cmd, &mc.result, func() error {
+				if err := mc.validate(cmd, args); err != nil {
+					return errors.Wrap(newValidationError(err), "error validating migrateCmd")
+				}
+				return mc.run(cmd)
+			})
+		},
+	}
+
+	f := migrateCmd.Flags()
+	f.StringVarP(&mc.apimodelPath, "api-model", "m", "", "path to the apimodel file")
+	f.StringVar(&mc.apiVersion, "to", vlabs.APIVersion, fmt.Sprintf("API version to convert the apimodel to: %s", strings.Join(engine.MigrateAPIVersions, ", ")))
+	f.StringVar(&mc.outputFile, "output-file", "", "file to write the converted apimodel to (defaults to stdout)")
+
+	return migrateCmd
+}
+
+func (mc *migrateCmd) validate(cmd *cobra.Command, args []string) error {
+	var err error
+
+	mc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if mc.apimodelPath == "" {
+		if len(args) == 1 {
+			mc.apimodelPath = args[0]
+		} else if len(args) > 1 {
+			cmd.Usage()
+			return errors.New("too many arguments were provided to 'migrate'")
+		} else {
+			cmd.Usage()
+			return errors.New("--api-model was not supplied, nor was one specified as a positional argument")
+		}
+	}
+
+	if mc.outputFile == "" && outputFormat == "json" {
+		return errors.New("--output-file must be specified with --output json")
+	}
+
+	if _, err := os.Stat(mc.apimodelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", mc.apimodelPath)
+	}
+	mc.apimodel, err = ioutil.ReadFile(mc.apimodelPath)
+	if err != nil {
+		return errors.Wrapf(err, "error reading the api model %s", mc.apimodelPath)
+	}
+
+	return nil
+}
+
+func (mc *migrateCmd) run(cmd *cobra.Command) error {
+	result, err := engine.Migrate(context.Background(), engine.MigrateOptions{
+		APIModel:   mc.apimodel,
+		APIVersion: mc.apiVersion,
+		Translator: &i18n.Translator{
+			Locale: mc.locale,
+		},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error migrating %s to version %s", mc.apimodelPath, mc.apiVersion)
+	}
+	mc.result.MigrateChanges = result.Changes
+
+	for _, c := range result.Changes {
+		switch c.Kind {
+		case engine.MigrateChangeLost:
+			log.Warnf("%s is lost in version %s: %v", c.Path, mc.apiVersion, c.OldValue)
+		case engine.MigrateChangeDefaulted:
+			log.Infof("%s is defaulted to %v", c.Path, c.NewValue)
+		case engine.MigrateChangeModified:
+			log.Infof("%s is changed from %v to %v", c.Path, c.OldValue, c.NewValue)
+		}
+	}
+
+	if mc.outputFile == "" {
+		fmt.Fprintln(cmd.OutOrStdout(), string(result.APIModel))
+		return nil
+	}
+	// the apimodel holds the secrets of the cluster
+	if err := ioutil.WriteFile(mc.outputFile, result.APIModel, 0600); err != nil {
+		return errors.Wrapf(err, "error writing %s", mc.outputFile)
+	}
+	mc.result.Artifacts = []string{mc.outputFile}
+	log.Infof("apimodel %s migrated from version %s to version %s in %s", mc.apimodelPath, result.SourceAPIVersion, mc.apiVersion, mc.outputFile)
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/engine"
+	"github.com/spf13/cobra"
+)
+
+func TestNewMigrateCmd(t *testing.T) {
+	output := newMigrateCmd()
+	if output.Use != migrateName || output.Short != migrateShortDescription || output.Long != migrateLongDescription {
+		t.Fatalf("migrate command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, migrateName, output.Short, migrateShortDescription, output.Long, migrateLongDescription)
+	}
+
+	expectedFlags := []string{"api-model", "to", "output-file"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("migrate command should have flag %s", f)
+		}
+	}
+}
+
+func TestMigrateCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	m := &migrateCmd{}
+	if err := m.validate(r, []string{"../examples/v20170701/dcos.json"}); err != nil {
+		t.Fatalf("unexpected error validating 1 arg: %s", err.Error())
+	}
+
+	m = &migrateCmd{}
+	if err := m.validate(r, []string{}); err == nil {
+		t.Fatalf("expected error validating 0 args")
+	}
+
+	m = &migrateCmd{}
+	if err := m.validate(r, []string{"../examples/v20170701/dcos.json", "arg1"}); err == nil {
+		t.Fatalf("expected error validating multiple args")
+	}
+
+	m = &migrateCmd{}
+	if err := m.validate(r, []string{"../examples/v20170701/does-not-exist.json"}); err == nil {
+		t.Fatalf("expected error validating a missing apimodel")
+	}
+}
+
+func TestMigrateCmdRun(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "acs-engine-migrate")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(outputDir)
+
+	var buf bytes.Buffer
+	r := &cobra.Command{}
+	r.SetOutput(&buf)
+	m := &migrateCmd{apimodelPath: "../examples/v20170131/dcos.json", apiVersion: "vlabs"}
+	if err := m.validate(r, []string{}); err != nil {
+		t.Fatalf("unexpected error validating: %s", err.Error())
+	}
+	if err := m.run(r); err != nil {
+		t.Fatalf("unexpected error migrating to stdout: %s", err.Error())
+	}
+	var apimodel map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &apimodel); err != nil || apimodel["apiVersion"] != "vlabs" {
+		t.Fatalf("expected the vlabs apimodel on stdout, got %s", buf.String())
+	}
+
+	outputFile := path.Join(outputDir, "apimodel.json")
+	m = &migrateCmd{apimodelPath: "../examples/v20170701/dcos.json", apiVersion: "2016-09-30", outputFile: outputFile}
+	if err := m.validate(r, []string{}); err != nil {
+		t.Fatalf("unexpected error validating: %s", err.Error())
+	}
+	if err := m.run(r); err != nil {
+		t.Fatalf("unexpected error migrating to a file: %s", err.Error())
+	}
+	if _, err := os.Stat(outputFile); err != nil || len(m.result.Artifacts) != 1 {
+		t.Fatalf("expected the apimodel to be written to %s, got artifacts %v", outputFile, m.result.Artifacts)
+	}
+	lost := 0
+	for _, c := range m.result.MigrateChanges {
+		if c.Kind == engine.MigrateChangeLost {
+			lost++
+		}
+	}
+	if lost == 0 {
+		t.Fatalf("expected lost fields migrating to 2016-09-30, got %v", m.result.MigrateChanges)
+	}
+
+	m = &migrateCmd{apimodelPath: "../examples/v20170701/kubernetes.json", apiVersion: "2016-03-30"}
+	if err := m.validate(r, []string{}); err != nil {
+		t.Fatalf("unexpected error validating: %s", err.Error())
+	}
+	if err := m.run(r); ExitCode(err) != exitCodeValidation {
+		t.Fatalf("expected a validation error migrating Kubernetes to 2016-03-30, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Azure/acs-engine/pkg/acsengine/transform"
+	"github.com/Azure/acs-engine/pkg/api/vlabs"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/engine"
+	"github.com/Azure/acs-engine/pkg/operations"
+	"github.com/Azure/acs-engine/pkg/operations/kubernetesupgrade"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// Exit codes of acs-engine commands, documented in docs/acsengine.md
+const (
+	exitCodeFailure    = 1
+	exitCodeValidation = 2
+	exitCodeARM        = 3
+	exitCodeDrain      = 4
+	exitCodeTimeout    = 5
+)
+
+// errorCategory is the category of the error a command failed with
+type errorCategory string
+
+const (
+	errorCategoryFailure    errorCategory = "failure"
+	errorCategoryValidation errorCategory = "validation"
+	errorCategoryARM        errorCategory = "arm"
+	errorCategoryDrain      errorCategory = "drain"
+	errorCategoryTimeout    errorCategory = "timeout"
+)
+
+var exitCodes = map[errorCategory]int{
+	errorCategoryFailure:    exitCodeFailure,
+	errorCategoryValidation: exitCodeValidation,
+	errorCategoryARM:        exitCodeARM,
+	errorCategoryDrain:      exitCodeDrain,
+	errorCategoryTimeout:    exitCodeTimeout,
+}
+
+// commandResult is the document a command writes to its output with --output json
+type commandResult struct {
+	Command         string         `json:"command"`
+	Succeeded       bool           `json:"succeeded"`
+	ExitCode        int            `json:"exitCode"`
+	OutputDirectory string         `json:"outputDirectory,omitempty"`
+	Artifacts       []string       `json:"artifacts,omitempty"`
+	ResourceGroup   string         `json:"resourceGroup,omitempty"`
+	DeploymentName  string         `json:"deploymentName,omitempty"`
+	VMsCreated      []string       `json:"vmsCreated,omitempty"`
+	VMsDeleted      []string       `json:"vmsDeleted,omitempty"`
+	UpgradedNodes   []string       `json:"upgradedNodes,omitempty"`
+	Errors          []commandError `json:"errors,omitempty"`
+	// MigrateChanges are the fields of the apimodel lost, defaulted or modified by migrate
+	MigrateChanges []engine.MigrateChange `json:"migrateChanges,omitempty"`
+	// Certificates are the certificates of the deployment directory reported by rotate-certs --check-expiry
+	Certificates []engine.CertificateInfo `json:"certificates,omitempty"`
+	// RotatedNodes are the nodes rotate-certs copied the new certificates to
+	RotatedNodes []string `json:"rotatedNodes,omitempty"`
+	// Secrets are the references to the secrets generate and deploy stored in the secrets Key Vault
+	Secrets []string `json:"secrets,omitempty"`
+	// RedactedFields are the paths of the fields export --redact replaced with placeholders
+	RedactedFields []string `json:"redactedFields,omitempty"`
+	// RestoredFields are the paths of the fields export --restore restored from the sealed secrets
+	RestoredFields []string `json:"restoredFields,omitempty"`
+	// AppliedObjects are the objects of the addon addons enable and update applied to the cluster
+	AppliedObjects []string `json:"appliedObjects,omitempty"`
+	// DeletedObjects are the objects of the addon addons disable and update deleted from the cluster
+	DeletedObjects []string `json:"deletedObjects,omitempty"`
+	// Addons are the addons listed by addons list with their drift from the apimodel
+	Addons []engine.AddonStatus `json:"addons,omitempty"`
+	// Problems are the schema errors and pre-flight problems validate found in the apimodel
+	Problems []string `json:"problems,omitempty"`
+	// Diff are the changes diff found between the deployment and the updated apimodel
+	Diff *transform.TemplateDiff `json:"diff,omitempty"`
+	// Schema is the JSON Schema of the apimodel printed by schema
+	Schema map[string]interface{} `json:"schema,omitempty"`
+	// Version is the version of acs-engine printed by version
+	Version *versionInfo `json:"version,omitempty"`
+}
+
+// commandError is an error of a command result
+type commandError struct {
+	Category errorCategory `json:"category"`
+	Message  string        `json:"message"`
+	// Failures are the categorized failures of a failed deployment
+	Failures []armhelpers.DeploymentFailure `json:"failures,omitempty"`
+}
+
+// validationError marks errors caused by the flags or the apimodel given to a command
+type validationError struct {
+	err error
+}
+
+// Error implements error interface
+func (e *validationError) Error() string {
+	return e.err.Error()
+}
+
+func newValidationError(err error) error {
+	return &validationError{err: err}
+}
+
+// logValidationWarnings logs the warnings of an apimodel that failed to validate.
+// Its errors are all part of the message of err.
+func logValidationWarnings(err error) {
+	if errs, ok := errors.Cause(err).(vlabs.ValidationErrors); ok {
+		for _, w := range errs.Warnings() {
+			log.Warnf("%s: %s", w.Path, w.Err)
+		}
+	}
+}
+
+// deploymentFailedError is returned by deploy once the diagnostics of the failed deployment were written
+type deploymentFailedError struct {
+	deploymentName string
+	err            error
+}
+
+// Error implements error interface
+func (e *deploymentFailedError) Error() string {
+	return fmt.Sprintf("deployment %s failed", e.deploymentName)
+}
+
+// Cause returns the error the deployment failed with
+func (e *deploymentFailedError) Cause() error {
+	return e.err
+}
+
+// ExitCode returns the exit code acs-engine exits with when a command fails with err
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return exitCodes[categorize(err)]
+}
+
+// categorize walks the chain of causes of err to find out what failed
+func categorize(err error) errorCategory {
+	category := errorCategoryFailure
+	for err != nil {
+		if err == context.DeadlineExceeded {
+			return errorCategoryTimeout
+		}
+		switch e := err.(type) {
+		case *validationError, *engine.ValidationError:
+			return errorCategoryValidation
+		case *operations.DrainError:
+			return errorCategoryDrain
+		case *kubernetesupgrade.TimeoutError:
+			return errorCategoryTimeout
+		case utilerrors.Aggregate:
+			if errs := e.Errors(); len(errs) > 0 {
+				return categorize(errs[0])
+			}
+		case *armhelpers.DeploymentError, *armhelpers.DeploymentValidationError,
+			azure.RequestError, *azure.RequestError, azure.ServiceError, *azure.ServiceError:
+			category = errorCategoryARM
+		case autorest.DetailedError:
+			// the original error tells ARM failures from requests that timed out
+			category = errorCategoryARM
+			err = e.Original
+			continue
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		err = cause.Cause()
+	}
+	return category
+}
+
+// deploymentError returns the deployment error in the chain of causes of err, if any
+func deploymentError(err error) *armhelpers.DeploymentError {
+	if deploymentErr, ok := errors.Cause(err).(*armhelpers.DeploymentError); ok {
+		return deploymentErr
+	}
+	return nil
+}
+
+// commandName is the name of cmd, prefixed with the name of its parent for subcommands such as addons list
+func commandName(cmd *cobra.Command) string {
+	if cmd.HasParent() && cmd.Parent().HasParent() {
+		return cmd.Parent().Name() + " " + cmd.Name()
+	}
+	return cmd.Name()
+}
+
+// runCommand runs a command and completes its result. With --output json the result is
+// written to the output of the command, whether the command succeeded or not.
+func runCommand(cmd *cobra.Command, result *commandResult, run func() error) error {
+	// flags were parsed, errors from now on are not usage errors
+	cmd.SilenceUsage = true
+
+	err := run()
+	result.Command = commandName(cmd)
+	result.Succeeded = err == nil
+	if err != nil {
+		category := categorize(err)
+		result.ExitCode = exitCodes[category]
+		e := commandError{Category: category, Message: err.Error()}
+		if deploymentErr := deploymentError(err); deploymentErr != nil {
+			e.Failures = deploymentErr.Diagnostics().Failures
+		}
+		result.Errors = append(result.Errors, e)
+	}
+
+	if outputFormat == "json" {
+		b, marshalErr := json.MarshalIndent(result, "", "  ")
+		if marshalErr != nil {
+			return errors.Wrap(marshalErr, "error marshalling the command result")
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/engine"
+	"github.com/Azure/acs-engine/pkg/operations"
+	"github.com/Azure/acs-engine/pkg/operations/kubernetesupgrade"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected int
+	}{
+		{nil, 0},
+		{errors.New("something failed"), exitCodeFailure},
+		{errors.Wrap(newValidationError(errors.New("--location must be specified")), "error validating deployCmd"), exitCodeValidation},
+		{errors.Wrap(&engine.ValidationError{Err: errors.New("node pool agentpool3 was not found in the deployed api model")}, "error scaling node pool agentpool3"), exitCodeValidation},
+		{&armhelpers.DeploymentError{TopError: errors.New("DeployTemplate failed")}, exitCodeARM},
+		{&deploymentFailedError{deploymentName: "contoso-1234", err: &armhelpers.DeploymentError{}}, exitCodeARM},
+		{autorest.DetailedError{Original: errors.New("Conflict")}, exitCodeARM},
+		{autorest.DetailedError{Original: context.DeadlineExceeded}, exitCodeTimeout},
+		{errors.Wrapf(&operations.DrainError{NodeName: "k8s-agentpool1-12345678-0", Err: errors.New("Drain did not complete within 1m0s")}, "Node %q failed to drain with error", "k8s-agentpool1-12345678-0"), exitCodeDrain},
+		{errors.Wrap(&kubernetesupgrade.TimeoutError{Timeout: time.Minute, Err: errors.New("DeployTemplate failed")}, "Error upgrading cluster"), exitCodeTimeout},
+		{errors.Wrap(utilerrors.NewAggregate([]error{&operations.DrainError{Err: errors.New("failed")}, errors.New("failed")}), "2 of 2 nodes failed to upgrade"), exitCodeDrain},
+	}
+
+	for _, c := range cases {
+		if code := ExitCode(c.err); code != c.expected {
+			t.Errorf("expected exit code %d for error %v, got %d", c.expected, c.err, code)
+		}
+	}
+}
+
+func TestRunCommandWritesResult(t *testing.T) {
+	defer func() { outputFormat = "human" }()
+	outputFormat = "json"
+
+	var buf bytes.Buffer
+	cmd := &cobra.Command{Use: "deploy"}
+	cmd.SetOutput(&buf)
+	result := &commandResult{}
+	deploymentErr := &armhelpers.DeploymentError{
+		DeploymentName: "contoso-1234",
+		ResourceGroup:  "contoso",
+		Response:       []byte(`{"error":{"code":"SkuNotAvailable","message":"The requested size is not available."}}`),
+	}
+	err := runCommand(cmd, result, func() error {
+		result.DeploymentName = "contoso-1234"
+		return &deploymentFailedError{deploymentName: "contoso-1234", err: deploymentErr}
+	})
+	if err == nil || err.Error() != "deployment contoso-1234 failed" {
+		t.Fatalf("expected the error of the command to be returned, got %v", err)
+	}
+
+	var written commandResult
+	if err := json.Unmarshal(buf.Bytes(), &written); err != nil {
+		t.Fatalf("expected a JSON result document, got %s: %s", buf.String(), err)
+	}
+	if written.Command != "deploy" || written.Succeeded || written.ExitCode != exitCodeARM || written.DeploymentName != "contoso-1234" {
+		t.Fatalf("unexpected result document: %s", buf.String())
+	}
+	if len(written.Errors) != 1 || written.Errors[0].Category != errorCategoryARM || len(written.Errors[0].Failures) != 1 {
+		t.Fatalf("expected the categorized deployment failures in the result document, got %s", buf.String())
+	}
+	if written.Errors[0].Failures[0].Category != armhelpers.FailureSkuNotAvailable {
+		t.Fatalf("unexpected deployment failure: %+v", written.Errors[0].Failures[0])
+	}
+
+	buf.Reset()
+	outputFormat = "human"
+	if err := runCommand(cmd, &commandResult{}, func() error { return nil }); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected no result document without --output json, got %s", buf.String())
+	}
+}
+
+func TestGenerateCmdResult(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "acs-engine-generate")
+	if err != nil {
+		t.Fatalf("unable to create the output directory: %s", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	g := &generateCmd{outputDirectory: outputDirectory}
+	r := &cobra.Command{}
+	if err := g.validate(r, []string{"../pkg/acsengine/testdata/simple/kubernetes.json"}); err != nil {
+		t.Fatalf("unexpected error validating the generate command: %s", err)
+	}
+	if err := g.loadAPIModel(r, []string{}); err != nil {
+		t.Fatalf("unexpected error loading the api model: %s", err)
+	}
+	if err := g.run(); err != nil {
+		t.Fatalf("unexpected error generating the templates: %s", err)
+	}
+
+	if g.result.OutputDirectory != outputDirectory {
+		t.Fatalf("expected the output directory %s in the result, got %s", outputDirectory, g.result.OutputDirectory)
+	}
+	found := false
+	for _, artifact := range g.result.Artifacts {
+		if artifact == path.Join(outputDirectory, "azuredeploy.json") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected azuredeploy.json in the artifacts, got %v", g.result.Artifacts)
+	}
+}
+
+func TestRootCmdOutputFlag(t *testing.T) {
+	defer func() { outputFormat = "human" }()
+
+	root := NewRootCmd()
+	if root.PersistentFlags().Lookup("output") == nil {
+		t.Fatalf("root command should have a persistent output flag")
+	}
+
+	outputFormat = "yaml"
+	err := root.PersistentPreRunE(root, []string{})
+	if err == nil || ExitCode(err) != exitCodeValidation {
+		t.Fatalf("expected an unsupported output format to be a validation failure, got %v", err)
+	}
+}
+
+func TestCommandName(t *testing.T) {
+	root := NewRootCmd()
+	for _, c := range root.Commands() {
+		if c.Name() == addonsName {
+			for _, sub := range c.Commands() {
+				if commandName(sub) != "addons "+sub.Name() {
+					t.Errorf("expected the name of %s to be prefixed with addons, got %s", sub.Name(), commandName(sub))
+				}
+			}
+			continue
+		}
+		if commandName(c) != c.Name() {
+			t.Errorf("expected the name of %s to be unchanged, got %s", c.Name(), commandName(c))
+		}
+	}
+}
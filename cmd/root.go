@@ -5,10 +5,12 @@ package cmd
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 
+	"github.com/Azure/acs-engine/pkg/acsengine/transform"
 	"github.com/Azure/acs-engine/pkg/api"
 	"github.com/Azure/acs-engine/pkg/api/vlabs"
 	"github.com/Azure/acs-engine/pkg/armhelpers"
@@ -39,10 +41,21 @@ func NewRootCmd() *cobra.Command {
 		Use:   rootName,
 		Short: rootShortDescription,
 		Long:  rootLongDescription,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// errors are logged by main, which exits with the code matching the error
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			if debug {
 				log.SetLevel(log.DebugLevel)
 			}
+			switch outputFormat {
+			case "human":
+			case "json":
+				// keep the output of the command a single JSON document
+				log.SetOutput(os.Stderr)
+			default:
+				return newValidationError(errors.Errorf("unsupported output format %s, use one of %s", outputFormat, outputFormatOptions))
+			}
+			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if dumpDefaultModel {
@@ -54,17 +67,29 @@ func NewRootCmd() *cobra.Command {
 
 	p := rootCmd.PersistentFlags()
 	p.BoolVar(&debug, "debug", false, "enable verbose debug logs")
+	p.StringVar(&outputFormat, "output", "human", fmt.Sprintf("output format of the command result: %s", outputFormatOptions))
+
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return newValidationError(err)
+	})
 
 	f := rootCmd.Flags()
 	f.BoolVar(&dumpDefaultModel, "show-default-model", false, "Dump the default API model to stdout")
 
 	rootCmd.AddCommand(newVersionCmd())
 	rootCmd.AddCommand(newGenerateCmd())
+	rootCmd.AddCommand(newValidateCmd())
+	rootCmd.AddCommand(newSchemaCmd())
 	rootCmd.AddCommand(newDeployCmd())
+	rootCmd.AddCommand(newDiffCmd())
+	rootCmd.AddCommand(newMigrateCmd())
+	rootCmd.AddCommand(newExportCmd())
 	rootCmd.AddCommand(newOrchestratorsCmd())
+	rootCmd.AddCommand(newRotateCertsCmd())
 	rootCmd.AddCommand(newUpgradeCmd())
 	rootCmd.AddCommand(newScaleCmd())
 	rootCmd.AddCommand(newDcosUpgradeCmd())
+	rootCmd.AddCommand(newAddonsCmd())
 	rootCmd.AddCommand(getCompletionCmd(rootCmd))
 
 	return rootCmd
@@ -118,6 +143,65 @@ func addAuthFlags(authArgs *authArgs, f *flag.FlagSet) {
 	f.StringVar(&authArgs.language, "language", "en-us", "language to return error messages in")
 }
 
+// apiModelOverrides are the flags that override the values of an apimodel
+type apiModelOverrides struct {
+	set      []string
+	setFiles []string
+	values   []string
+}
+
+func addAPIModelOverrideFlags(o *apiModelOverrides, f *flag.FlagSet) {
+	f.StringArrayVar(&o.set, "set", []string{}, "set values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2, key+=val appends to an array and key=null removes a key)")
+	f.StringArrayVar(&o.setFiles, "set-file", []string{}, "set values to the content of files (can specify multiple or separate values with commas: key1=path1,key2=path2)")
+	f.StringArrayVar(&o.values, "values", []string{}, "merge a partial apimodel JSON file into the apimodel before --set and --set-file (can specify multiple)")
+}
+
+// addonsArgs are the flags of the commands generating templates that load addons from directories
+type addonsArgs struct {
+	addonsDirs []string
+}
+
+func addAddonsFlags(a *addonsArgs, f *flag.FlagSet) {
+	f.StringArrayVar(&a.addonsDirs, "addons-dir", []string{}, "directory holding a subdirectory with an "+api.AddonDescriptorFileName+" file per addon to deploy in addition to the built-in addons (can specify multiple)")
+}
+
+// setAddonRegistry makes cs use the addons of the addons directories in addition to the built-in addons
+func (a *addonsArgs) setAddonRegistry(cs *api.ContainerService) error {
+	if len(a.addonsDirs) == 0 {
+		return nil
+	}
+	registry := api.NewAddonRegistry()
+	for _, dir := range a.addonsDirs {
+		if err := registry.LoadDir(dir); err != nil {
+			return err
+		}
+	}
+	cs.SetAddonRegistry(registry)
+	return nil
+}
+
+// mergeOverrides merges the overrides with the apimodel at apimodelPath into a new file, and returns its path.
+// apimodelPath is returned unchanged when there are no overrides.
+func (o *apiModelOverrides) mergeOverrides(apimodelPath string) (string, error) {
+	if len(o.set) == 0 && len(o.setFiles) == 0 && len(o.values) == 0 {
+		return apimodelPath, nil
+	}
+	values, err := transform.MapValues(o.set)
+	if err != nil {
+		return "", err
+	}
+	fileValues, err := transform.MapFileValues(o.setFiles)
+	if err != nil {
+		return "", err
+	}
+	mergedPath, err := transform.MergeValuesWithAPIModel(apimodelPath, o.values, append(values, fileValues...))
+	if err != nil {
+		return "", err
+	}
+	log.Infoln(fmt.Sprintf("new api model file has been generated during merge: %s", mergedPath))
+	return mergedPath, nil
+}
+
 //this allows the authArgs to be stubbed behind the authProvider interface, and be its own provider when not in tests.
 func (authArgs *authArgs) getAuthArgs() *authArgs {
 	return authArgs
@@ -16,7 +16,7 @@ func TestNewRootCmd(t *testing.T) {
 	if output.Use != rootName || output.Short != rootShortDescription || output.Long != rootLongDescription {
 		t.Fatalf("root command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, rootName, output.Short, rootShortDescription, output.Long, rootLongDescription)
 	}
-	expectedCommands := []*cobra.Command{getCompletionCmd(output), newDcosUpgradeCmd(), newDeployCmd(), newGenerateCmd(), newOrchestratorsCmd(), newScaleCmd(), newUpgradeCmd(), newVersionCmd()}
+	expectedCommands := []*cobra.Command{newAddonsCmd(), getCompletionCmd(output), newDcosUpgradeCmd(), newDeployCmd(), newDiffCmd(), newExportCmd(), newGenerateCmd(), newMigrateCmd(), newOrchestratorsCmd(), newRotateCertsCmd(), newScaleCmd(), newSchemaCmd(), newUpgradeCmd(), newValidateCmd(), newVersionCmd()}
 	rc := output.Commands()
 	for i, c := range expectedCommands {
 		if rc[i].Use != c.Use {
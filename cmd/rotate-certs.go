@@ -0,0 +1,219 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/engine"
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	rotateCertsName             = "rotate-certs"
+	rotateCertsShortDescription = "Rotate the certificates of a Kubernetes cluster"
+	rotateCertsLongDescription  = "Regenerate the certificates of a deployed Kubernetes cluster, copy them to its masters and agents over SSH and update the artifacts of its deployment directory, or report when the certificates of a deployment directory expire"
+)
+
+// certificateExpiryWarning is how long before they expire certificates are reported as expiring
+const certificateExpiryWarning = 30 * 24 * time.Hour
+
+type rotateCertsCmd struct {
+	// user input
+	deploymentDirectory string
+	location            string
+	certificates        []string
+	sshPrivateKeyPath   string
+	rolloutOnly         bool
+	checkExpiry         bool
+
+	// derived
+	containerService *api.ContainerService
+	apiVersion       string
+	sshPrivateKey    []byte
+	locale           *gotext.Locale
+	result           commandResult
+}
+
+func newRotateCertsCmd() *cobra.Command {
+	rc := rotateCertsCmd{}
+
+	rotateCertsCmd := &cobra.Command{
+		Use:   rotateCertsName,
+		Short: rotateCertsShortDescription,
+		Long:  rotateCertsLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCommand(cmd, &rc.result, func() error {
+				if err := rc.validate(cmd); err != nil {
+					return errors.Wrap(newValidationError(err), "error validating rotateCertsCmd")
+				}
+				if rc.checkExpiry {
+					return rc.reportExpiry(cmd)
+				}
+				if err := rc.load(); err != nil {
+					return errors.Wrap(err, "error loading the deployment")
+				}
+				return rc.run()
+			})
+		},
+	}
+
+	f := rotateCertsCmd.Flags()
+	f.StringVar(&rc.deploymentDirectory, "deployment-dir", "", "the location of the output from `generate`")
+	f.StringVarP(&rc.location, "location", "l", "", "location the cluster is deployed in (defaults to the location of the apimodel)")
+	f.StringSliceVar(&rc.certificates, "certificates", nil, fmt.Sprintf("comma-separated list of the certificates to rotate among %s; ca rotates them all (default %s)",
+		strings.Join(api.CertificatePairs, ", "), strings.Join(engine.DefaultRotatedCertificates, ",")))
+	f.StringVar(&rc.sshPrivateKeyPath, "ssh-private-key-path", "", "ssh private key path (default: <deployment-dir>/id_rsa)")
+	f.BoolVar(&rc.rolloutOnly, "rollout-only", false, "copy the certificates of the apimodel to the nodes without generating new ones, to finish a failed rotation")
+	f.BoolVar(&rc.checkExpiry, "check-expiry", false, "report when the certificates of the deployment directory expire, without rotating them")
+
+	return rotateCertsCmd
+}
+
+func (rc *rotateCertsCmd) validate(cmd *cobra.Command) error {
+	var err error
+
+	rc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if rc.deploymentDirectory == "" {
+		cmd.Usage()
+		return errors.New("--deployment-dir must be specified")
+	}
+	if rc.checkExpiry && (len(rc.certificates) > 0 || rc.rolloutOnly) {
+		cmd.Usage()
+		return errors.New("--check-expiry cannot be combined with --certificates or --rollout-only")
+	}
+	if rc.rolloutOnly && len(rc.certificates) > 0 {
+		cmd.Usage()
+		return errors.New("--rollout-only copies every certificate and cannot be combined with --certificates")
+	}
+	for _, c := range rc.certificates {
+		if !isCertificatePair(c) {
+			cmd.Usage()
+			return errors.Errorf("--certificates must be among %s, got %s", strings.Join(api.CertificatePairs, ", "), c)
+		}
+	}
+	if rc.location != "" {
+		rc.location = helpers.NormalizeAzureRegion(rc.location)
+	}
+	return nil
+}
+
+func (rc *rotateCertsCmd) load() error {
+	apimodelPath := path.Join(rc.deploymentDirectory, apiModelFilename)
+	if _, err := os.Stat(apimodelPath); os.IsNotExist(err) {
+		return newValidationError(errors.Errorf("specified api model does not exist (%s)", apimodelPath))
+	}
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: rc.locale,
+		},
+	}
+	var err error
+	rc.containerService, rc.apiVersion, err = apiloader.LoadContainerServiceFromFile(apimodelPath, true, true, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+	if rc.location != "" {
+		if rc.containerService.Location != "" && rc.containerService.Location != rc.location {
+			return newValidationError(errors.Errorf("--location %s does not match the api model location %s", rc.location, rc.containerService.Location))
+		}
+		rc.containerService.Location = rc.location
+	}
+	if rc.containerService.Location == "" {
+		return newValidationError(errors.New("--location must be specified, the api model has no location"))
+	}
+
+	if rc.sshPrivateKeyPath == "" {
+		rc.sshPrivateKeyPath = filepath.Join(rc.deploymentDirectory, "id_rsa")
+	}
+	if rc.sshPrivateKey, err = ioutil.ReadFile(rc.sshPrivateKeyPath); err != nil {
+		return newValidationError(errors.Wrapf(err, "error reading the ssh private key %s, set it with --ssh-private-key-path", rc.sshPrivateKeyPath))
+	}
+	return nil
+}
+
+func (rc *rotateCertsCmd) run() error {
+	result, err := engine.RotateCerts(context.Background(), engine.RotateCertsOptions{
+		Logger: log.NewEntry(log.StandardLogger()),
+		Translator: &i18n.Translator{
+			Locale: rc.locale,
+		},
+		ContainerService:    rc.containerService,
+		APIVersion:          rc.apiVersion,
+		DeploymentDirectory: rc.deploymentDirectory,
+		Certificates:        rc.certificates,
+		RolloutOnly:         rc.rolloutOnly,
+		SSHPrivateKey:       rc.sshPrivateKey,
+		BuildTag:            BuildTag,
+	})
+	if result != nil {
+		rc.result.OutputDirectory = rc.deploymentDirectory
+		rc.result.Artifacts = result.Artifacts
+		rc.result.RotatedNodes = result.Nodes
+	}
+	if err != nil {
+		return errors.Wrap(err, "error rotating the certificates")
+	}
+	log.Infof("certificates %s rotated on %d nodes, the artifacts in %s are updated", strings.Join(result.Rotated, ", "), len(result.Nodes), rc.deploymentDirectory)
+	return nil
+}
+
+// reportExpiry lists the certificates of the deployment directory with their expiry dates
+func (rc *rotateCertsCmd) reportExpiry(cmd *cobra.Command) error {
+	certificates, err := engine.ListCertificates(rc.deploymentDirectory)
+	if err != nil {
+		return errors.Wrapf(err, "error reading the certificates of %s", rc.deploymentDirectory)
+	}
+	if len(certificates) == 0 {
+		return newValidationError(errors.Errorf("no certificates found in %s", rc.deploymentDirectory))
+	}
+	rc.result.OutputDirectory = rc.deploymentDirectory
+	rc.result.Certificates = certificates
+
+	now := time.Now()
+	for _, c := range certificates {
+		if c.NotAfter.Before(now) {
+			log.Warnf("%s expired on %s", c.File, c.NotAfter.Format(time.RFC3339))
+		} else if c.NotAfter.Before(now.Add(certificateExpiryWarning)) {
+			log.Warnf("%s expires on %s", c.File, c.NotAfter.Format(time.RFC3339))
+		}
+	}
+	if outputFormat == "json" {
+		return nil
+	}
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSUBJECT\tISSUER\tNOT BEFORE\tNOT AFTER")
+	for _, c := range certificates {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.File, c.Subject, c.Issuer, c.NotBefore.Format(time.RFC3339), c.NotAfter.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func isCertificatePair(c string) bool {
+	for _, pair := range api.CertificatePairs {
+		if c == pair {
+			return true
+		}
+	}
+	return false
+}
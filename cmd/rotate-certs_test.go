@@ -0,0 +1,85 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/spf13/cobra"
+)
+
+func TestNewRotateCertsCmd(t *testing.T) {
+	output := newRotateCertsCmd()
+	if output.Use != rotateCertsName || output.Short != rotateCertsShortDescription || output.Long != rotateCertsLongDescription {
+		t.Fatalf("rotate-certs command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, rotateCertsName, output.Short, rotateCertsShortDescription, output.Long, rotateCertsLongDescription)
+	}
+
+	expectedFlags := []string{"deployment-dir", "location", "certificates", "ssh-private-key-path", "rollout-only", "check-expiry"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("rotate-certs command should have flag %s", f)
+		}
+	}
+}
+
+func TestRotateCertsCmdValidate(t *testing.T) {
+	cases := []struct {
+		rc          *rotateCertsCmd
+		expectedErr string
+	}{
+		{&rotateCertsCmd{}, "--deployment-dir must be specified"},
+		{&rotateCertsCmd{deploymentDirectory: "_output/test", certificates: []string{"kubelet"}}, "--certificates must be among ca, apiserver, client, kubeconfig, etcd, got kubelet"},
+		{&rotateCertsCmd{deploymentDirectory: "_output/test", certificates: []string{"etcd"}, rolloutOnly: true}, "--rollout-only copies every certificate and cannot be combined with --certificates"},
+		{&rotateCertsCmd{deploymentDirectory: "_output/test", checkExpiry: true, rolloutOnly: true}, "--check-expiry cannot be combined with --certificates or --rollout-only"},
+		{&rotateCertsCmd{deploymentDirectory: "_output/test", certificates: []string{"apiserver", "etcd"}, location: "West US"}, ""},
+	}
+	for _, c := range cases {
+		err := c.rc.validate(&cobra.Command{})
+		if c.expectedErr == "" && err != nil {
+			t.Errorf("unexpected error validating %+v: %s", c.rc, err)
+		}
+		if c.expectedErr != "" && (err == nil || err.Error() != c.expectedErr) {
+			t.Errorf("expected error %q, got %v", c.expectedErr, err)
+		}
+	}
+}
+
+func TestRotateCertsCmdCheckExpiry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acs-engine-rotate-certs")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	ca, err := helpers.CreatePkiKeyCertPair("ca", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating a certificate: %s", err.Error())
+	}
+	if err = ioutil.WriteFile(path.Join(dir, "ca.crt"), []byte(ca.CertificatePem), 0644); err != nil {
+		t.Fatalf("unexpected error writing the certificate: %s", err.Error())
+	}
+
+	rc := &rotateCertsCmd{deploymentDirectory: dir, checkExpiry: true}
+	r := &cobra.Command{}
+	var out bytes.Buffer
+	r.SetOutput(&out)
+	if err = rc.validate(r); err != nil {
+		t.Fatalf("unexpected error validating: %s", err.Error())
+	}
+	if err = rc.reportExpiry(r); err != nil {
+		t.Fatalf("unexpected error reporting the expiry dates: %s", err.Error())
+	}
+	if len(rc.result.Certificates) != 1 || rc.result.Certificates[0].File != "ca.crt" {
+		t.Fatalf("expected ca.crt in the result, got %+v", rc.result.Certificates)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "ca.crt") {
+		t.Fatalf("expected a table listing ca.crt, got %q", out.String())
+	}
+}
@@ -4,26 +4,19 @@
 package cmd
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
-	"math/rand"
 	"os"
 	"path"
-	"sort"
+	"strconv"
 	"strings"
-	"time"
 
-	"github.com/Azure/acs-engine/pkg/acsengine"
-	"github.com/Azure/acs-engine/pkg/acsengine/transform"
 	"github.com/Azure/acs-engine/pkg/api"
 	"github.com/Azure/acs-engine/pkg/armhelpers"
-	"github.com/Azure/acs-engine/pkg/armhelpers/utils"
+	"github.com/Azure/acs-engine/pkg/engine"
 	"github.com/Azure/acs-engine/pkg/helpers"
 	"github.com/Azure/acs-engine/pkg/i18n"
-	"github.com/Azure/acs-engine/pkg/openshift/filesystem"
 	"github.com/Azure/acs-engine/pkg/operations"
 	"github.com/leonelquinteros/gotext"
 	"github.com/pkg/errors"
@@ -33,6 +26,7 @@ import (
 
 type scaleCmd struct {
 	authArgs
+	addonsArgs
 
 	// user input
 	resourceGroupName    string
@@ -41,17 +35,26 @@ type scaleCmd struct {
 	location             string
 	agentPoolToScale     string
 	masterFQDN           string
+	scaleDownPolicy      string
+	pools                []string
+	removeNodes          []string
 
 	// derived
 	containerService *api.ContainerService
 	apiVersion       string
 	apiModelPath     string
-	agentPool        *api.AgentPoolProfile
 	client           armhelpers.ACSEngineClient
 	locale           *gotext.Locale
 	nameSuffix       string
-	agentPoolIndex   int
+	poolCounts       []poolCount
 	logger           *log.Entry
+	result           commandResult
+}
+
+// poolCount is a node pool to scale and its desired number of nodes
+type poolCount struct {
+	name  string
+	count int
 }
 
 const (
@@ -70,7 +73,9 @@ func newScaleCmd() *cobra.Command {
 		Short: scaleShortDescription,
 		Long:  scaleLongDescription,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return sc.run(cmd, args)
+			return runCommand(cmd, &sc.result, func() error {
+				return sc.run(cmd, args)
+			})
 		},
 	}
 
@@ -81,8 +86,13 @@ func newScaleCmd() *cobra.Command {
 	f.IntVarP(&sc.newDesiredAgentCount, "new-node-count", "c", 0, "desired number of nodes")
 	f.StringVar(&sc.agentPoolToScale, "node-pool", "", "node pool to scale")
 	f.StringVar(&sc.masterFQDN, "master-FQDN", "", "FQDN for the master load balancer, Needed to scale down Kubernetes agent pools")
+	f.StringVar(&sc.scaleDownPolicy, "scale-down-policy", string(operations.ScaleDownNewest), "instances to remove when scaling down a VMSS node pool: newest, oldest or least-loaded")
+
+	f.StringArrayVar(&sc.pools, "pool", nil, "node pool to scale and its desired number of nodes, as name=count; can be repeated to scale several node pools in one run")
+	f.StringSliceVar(&sc.removeNodes, "remove-nodes", nil, "comma-separated list of VMs to drain and delete from the node pool, which is then scaled to --new-node-count if given")
 
 	addAuthFlags(&sc.authArgs, f)
+	addAddonsFlags(&sc.addonsArgs, f)
 
 	return scaleCmd
 }
@@ -108,7 +118,27 @@ func (sc *scaleCmd) validate(cmd *cobra.Command) error {
 
 	sc.location = helpers.NormalizeAzureRegion(sc.location)
 
-	if sc.newDesiredAgentCount == 0 {
+	sc.poolCounts = nil
+	if len(sc.pools) > 0 {
+		if sc.agentPoolToScale != "" || sc.newDesiredAgentCount != 0 || len(sc.removeNodes) > 0 {
+			cmd.Usage()
+			return errors.New("--pool cannot be combined with --node-pool, --new-node-count or --remove-nodes")
+		}
+		for _, p := range sc.pools {
+			pool, err := parsePoolCount(p)
+			if err != nil {
+				cmd.Usage()
+				return err
+			}
+			for _, existing := range sc.poolCounts {
+				if existing.name == pool.name {
+					cmd.Usage()
+					return errors.Errorf("--pool %s is specified more than once", pool.name)
+				}
+			}
+			sc.poolCounts = append(sc.poolCounts, pool)
+		}
+	} else if sc.newDesiredAgentCount == 0 && len(sc.removeNodes) == 0 {
 		cmd.Usage()
 		return errors.New("--new-node-count must be specified")
 	}
@@ -118,6 +148,11 @@ func (sc *scaleCmd) validate(cmd *cobra.Command) error {
 		return errors.New("--deployment-dir must be specified")
 	}
 
+	if !isScaleDownPolicy(sc.scaleDownPolicy) {
+		cmd.Usage()
+		return errors.Errorf("--scale-down-policy must be one of %v", operations.ScaleDownPolicies)
+	}
+
 	return nil
 }
 
@@ -147,44 +182,26 @@ func (sc *scaleCmd) load(cmd *cobra.Command) error {
 		return errors.Errorf("specified api model does not exist (%s)", sc.apiModelPath)
 	}
 
-	apiloader := &api.Apiloader{
-		Translator: &i18n.Translator{
-			Locale: sc.locale,
-		},
-	}
-	sc.containerService, sc.apiVersion, err = apiloader.LoadContainerServiceFromFile(sc.apiModelPath, true, true, nil)
-	if err != nil {
-		return errors.Wrap(err, "error parsing the api model")
-	}
-
-	if sc.containerService.Location == "" {
-		sc.containerService.Location = sc.location
-	} else if sc.containerService.Location != sc.location {
-		return errors.New("--location does not match api model location")
+	if err = sc.loadContainerService(); err != nil {
+		return err
 	}
 
-	if sc.agentPoolToScale == "" {
-		agentPoolCount := len(sc.containerService.Properties.AgentPoolProfiles)
-		if agentPoolCount > 1 {
-			return errors.New("--node-pool is required if more than one agent pool is defined in the container service")
-		} else if agentPoolCount == 1 {
-			sc.agentPool = sc.containerService.Properties.AgentPoolProfiles[0]
-			sc.agentPoolIndex = 0
-			sc.agentPoolToScale = sc.containerService.Properties.AgentPoolProfiles[0].Name
-		} else {
-			return errors.New("No node pools found to scale")
-		}
-	} else {
-		agentPoolIndex := -1
-		for i, pool := range sc.containerService.Properties.AgentPoolProfiles {
-			if pool.Name == sc.agentPoolToScale {
-				agentPoolIndex = i
-				sc.agentPool = pool
-				sc.agentPoolIndex = i
+	if len(sc.poolCounts) == 0 {
+		if sc.agentPoolToScale == "" {
+			agentPoolCount := len(sc.containerService.Properties.AgentPoolProfiles)
+			if agentPoolCount > 1 {
+				return errors.New("--node-pool is required if more than one agent pool is defined in the container service")
+			} else if agentPoolCount == 1 {
+				sc.agentPoolToScale = sc.containerService.Properties.AgentPoolProfiles[0].Name
+			} else {
+				return errors.New("No node pools found to scale")
 			}
 		}
-		if agentPoolIndex == -1 {
-			return errors.Errorf("node pool %s was not found in the deployed api model", sc.agentPoolToScale)
+		sc.poolCounts = []poolCount{{name: sc.agentPoolToScale, count: sc.newDesiredAgentCount}}
+	}
+	for _, pool := range sc.poolCounts {
+		if !sc.hasAgentPool(pool.name) {
+			return errors.Errorf("node pool %s was not found in the deployed api model", pool.name)
 		}
 	}
 
@@ -203,234 +220,125 @@ func (sc *scaleCmd) load(cmd *cobra.Command) error {
 	return nil
 }
 
-func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
-	if err := sc.validate(cmd); err != nil {
-		return errors.Wrap(err, "failed to validate scale command")
-	}
-	if err := sc.load(cmd); err != nil {
-		return errors.Wrap(err, "failed to load existing container service")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
-	defer cancel()
-	orchestratorInfo := sc.containerService.Properties.OrchestratorProfile
-	var currentNodeCount, highestUsedIndex, index, winPoolIndex int
-	winPoolIndex = -1
-	indexes := make([]int, 0)
-	indexToVM := make(map[int]string)
-	if sc.agentPool.IsAvailabilitySets() {
-		for vmsListPage, err := sc.client.ListVirtualMachines(ctx, sc.resourceGroupName); vmsListPage.NotDone(); err = vmsListPage.Next() {
-			if err != nil {
-				return errors.Wrap(err, "failed to get vms in the resource group")
-			} else if len(vmsListPage.Values()) < 1 {
-				return errors.New("The provided resource group does not contain any vms")
-			}
-			for _, vm := range vmsListPage.Values() {
-				vmName := *vm.Name
-				if !sc.vmInAgentPool(vmName, vm.Tags) {
-					continue
-				}
-
-				osPublisher := vm.StorageProfile.ImageReference.Publisher
-				if osPublisher != nil && strings.EqualFold(*osPublisher, "MicrosoftWindowsServer") {
-					_, _, winPoolIndex, index, err = utils.WindowsVMNameParts(vmName)
-				} else {
-					_, _, index, err = utils.K8sLinuxVMNameParts(vmName)
-				}
-				if err != nil {
-					return err
-				}
-
-				indexToVM[index] = vmName
-				indexes = append(indexes, index)
-			}
-		}
-		sortedIndexes := sort.IntSlice(indexes)
-		sortedIndexes.Sort()
-		indexes = []int(sortedIndexes)
-		currentNodeCount = len(indexes)
-
-		if currentNodeCount == sc.newDesiredAgentCount {
-			log.Info("Cluster is currently at the desired agent count.")
-			return nil
-		}
-		highestUsedIndex = indexes[len(indexes)-1]
-
-		// Scale down Scenario
-		if currentNodeCount > sc.newDesiredAgentCount {
-			if sc.masterFQDN == "" {
-				cmd.Usage()
-				return errors.New("master-FQDN is required to scale down a kubernetes cluster's agent pool")
-			}
-
-			vmsToDelete := make([]string, 0)
-			for i := currentNodeCount - 1; i >= sc.newDesiredAgentCount; i-- {
-				index = indexes[i]
-				vmsToDelete = append(vmsToDelete, indexToVM[index])
-			}
-
-			switch orchestratorInfo.OrchestratorType {
-			case api.Kubernetes:
-				kubeConfig, err := acsengine.GenerateKubeConfig(sc.containerService.Properties, sc.location)
-				if err != nil {
-					return errors.Wrap(err, "failed to generate kube config")
-				}
-				err = sc.drainNodes(kubeConfig, vmsToDelete)
-				if err != nil {
-					return errors.Wrap(err, "Got error while draining the nodes to be deleted")
-				}
-			case api.OpenShift:
-				bundle := bytes.NewReader(sc.containerService.Properties.OrchestratorProfile.OpenShiftConfig.ConfigBundles["master"])
-				fs, err := filesystem.NewTGZReader(bundle)
-				if err != nil {
-					return errors.Wrap(err, "failed to read master bundle")
-				}
-				kubeConfig, err := fs.ReadFile("etc/origin/master/admin.kubeconfig")
-				if err != nil {
-					return errors.Wrap(err, "failed to read kube config")
-				}
-				err = sc.drainNodes(string(kubeConfig), vmsToDelete)
-				if err != nil {
-					return errors.Wrap(err, "Got error while draining the nodes to be deleted")
-				}
-			}
-
-			errList := operations.ScaleDownVMs(sc.client, sc.logger, sc.SubscriptionID.String(), sc.resourceGroupName, vmsToDelete...)
-			if errList != nil {
-				var err error
-				format := "Node '%s' failed to delete with error: '%s'"
-				for element := errList.Front(); element != nil; element = element.Next() {
-					vmError, ok := element.Value.(*operations.VMScalingErrorDetails)
-					if ok {
-						if err == nil {
-							err = errors.Errorf(format, vmError.Name, vmError.Error.Error())
-						} else {
-							err = errors.Wrapf(err, format, vmError.Name, vmError.Error.Error())
-						}
-					}
-				}
-				return err
-			}
-
-			return sc.saveAPIModel()
-		}
-	} else {
-		for vmssListPage, err := sc.client.ListVirtualMachineScaleSets(ctx, sc.resourceGroupName); vmssListPage.NotDone(); vmssListPage.Next() {
-			if err != nil {
-				return errors.Wrap(err, "failed to get vmss list in the resource group")
-			}
-			for _, vmss := range vmssListPage.Values() {
-				vmName := *vmss.Name
-				if !sc.vmInAgentPool(vmName, vmss.Tags) {
-					continue
-				}
-
-				osPublisher := vmss.VirtualMachineProfile.StorageProfile.ImageReference.Publisher
-				if osPublisher != nil && strings.EqualFold(*osPublisher, "MicrosoftWindowsServer") {
-					_, _, winPoolIndex, _, err = utils.WindowsVMNameParts(vmName)
-					log.Errorln(err)
-				}
-
-				currentNodeCount = int(*vmss.Sku.Capacity)
-				highestUsedIndex = 0
-			}
-		}
-	}
-
-	translator := acsengine.Context{
+// loadContainerService loads the api model from the deployment directory
+func (sc *scaleCmd) loadContainerService() error {
+	var err error
+	apiloader := &api.Apiloader{
 		Translator: &i18n.Translator{
 			Locale: sc.locale,
 		},
 	}
-	templateGenerator, err := acsengine.InitializeTemplateGenerator(translator)
-	if err != nil {
-		return errors.Wrap(err, "failed to initialize template generator")
-	}
-
-	sc.containerService.Properties.AgentPoolProfiles = []*api.AgentPoolProfile{sc.agentPool}
-
-	_, err = sc.containerService.SetPropertiesDefaults(false, true)
+	sc.containerService, sc.apiVersion, err = apiloader.LoadContainerServiceFromFile(sc.apiModelPath, true, true, nil)
 	if err != nil {
-		log.Fatalf("error in SetPropertiesDefaults template %s: %s", sc.apiModelPath, err.Error())
-		os.Exit(1)
+		return errors.Wrap(err, "error parsing the api model")
 	}
-	template, parameters, err := templateGenerator.GenerateTemplate(sc.containerService, acsengine.DefaultGeneratorCode, BuildTag)
-	if err != nil {
-		return errors.Wrapf(err, "error generating template %s", sc.apiModelPath)
+	if err = sc.setAddonRegistry(sc.containerService); err != nil {
+		return err
 	}
 
-	if template, err = transform.PrettyPrintArmTemplate(template); err != nil {
-		return errors.Wrap(err, "error pretty printing template")
+	if sc.containerService.Location == "" {
+		sc.containerService.Location = sc.location
+	} else if sc.containerService.Location != sc.location {
+		return errors.New("--location does not match api model location")
 	}
+	return nil
+}
 
-	templateJSON := make(map[string]interface{})
-	parametersJSON := make(map[string]interface{})
-
-	err = json.Unmarshal([]byte(template), &templateJSON)
-	if err != nil {
-		return errors.Wrap(err, "error unmarshaling template")
+func (sc *scaleCmd) hasAgentPool(name string) bool {
+	for _, pool := range sc.containerService.Properties.AgentPoolProfiles {
+		if pool.Name == name {
+			return true
+		}
 	}
+	return false
+}
 
-	err = json.Unmarshal([]byte(parameters), &parametersJSON)
-	if err != nil {
-		return errors.Wrap(err, "errror unmarshalling parameters")
+func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
+	if err := sc.validate(cmd); err != nil {
+		return errors.Wrap(newValidationError(err), "failed to validate scale command")
 	}
-
-	transformer := transform.Transformer{Translator: translator.Translator}
-	// Our templates generate a range of nodes based on a count and offset, it is possible for there to be holes in the template
-	// So we need to set the count in the template to get enough nodes for the range, if there are holes that number will be larger than the desired count
-	countForTemplate := sc.newDesiredAgentCount
-	if highestUsedIndex != 0 {
-		countForTemplate += highestUsedIndex + 1 - currentNodeCount
+	if err := sc.load(cmd); err != nil {
+		return errors.Wrap(newValidationError(err), "failed to load existing container service")
 	}
-	addValue(parametersJSON, sc.agentPool.Name+"Count", countForTemplate)
+	sc.result.ResourceGroup = sc.resourceGroupName
+	return sc.scalePools()
+}
 
-	if winPoolIndex != -1 {
-		templateJSON["variables"].(map[string]interface{})[sc.agentPool.Name+"Index"] = winPoolIndex
-	}
-	switch orchestratorInfo.OrchestratorType {
-	case api.OpenShift:
-		err = transformer.NormalizeForOpenShiftVMASScalingUp(sc.logger, sc.agentPool.Name, templateJSON)
-		if err != nil {
-			return errors.Wrapf(err, "error tranforming the template for scaling template %s", sc.apiModelPath)
+// scalePools scales each pool of poolCounts in turn and records their new node counts in the api model
+func (sc *scaleCmd) scalePools() error {
+	counts := map[string]int{}
+	var err error
+	for i, pool := range sc.poolCounts {
+		// Scale leaves only the scaled pool in the container service
+		if i > 0 {
+			if err = sc.loadContainerService(); err != nil {
+				break
+			}
 		}
-		if sc.agentPool.IsAvailabilitySets() {
-			addValue(parametersJSON, fmt.Sprintf("%sOffset", sc.agentPool.Name), highestUsedIndex+1)
+		var result *engine.ScaleResult
+		result, err = engine.Scale(context.Background(), engine.ScaleOptions{
+			Client: sc.client,
+			Logger: sc.logger,
+			Translator: &i18n.Translator{
+				Locale: sc.locale,
+			},
+			ContainerService: sc.containerService,
+			SubscriptionID:   sc.SubscriptionID.String(),
+			ResourceGroup:    sc.resourceGroupName,
+			Location:         sc.location,
+			NameSuffix:       sc.nameSuffix,
+			AgentPoolName:    pool.name,
+			NewCount:         pool.count,
+			RemoveNodes:      sc.removeNodes,
+			MasterFQDN:       sc.masterFQDN,
+			ScaleDownPolicy:  operations.ScaleDownPolicy(sc.scaleDownPolicy),
+			BuildTag:         BuildTag,
+		})
+		if result != nil {
+			if result.DeploymentName != "" {
+				sc.result.DeploymentName = result.DeploymentName
+			}
+			sc.result.VMsCreated = append(sc.result.VMsCreated, result.VMsCreated...)
+			sc.result.VMsDeleted = append(sc.result.VMsDeleted, result.VMsDeleted...)
 		}
-	case api.Kubernetes:
-		err = transformer.NormalizeForK8sVMASScalingUp(sc.logger, templateJSON)
 		if err != nil {
-			return errors.Wrapf(err, "error tranforming the template for scaling template %s", sc.apiModelPath)
+			err = errors.Wrapf(err, "error scaling node pool %s", pool.name)
+			break
 		}
-		if sc.agentPool.IsAvailabilitySets() {
-			addValue(parametersJSON, fmt.Sprintf("%sOffset", sc.agentPool.Name), highestUsedIndex+1)
-		}
-	case api.Swarm:
-	case api.SwarmMode:
-	case api.DCOS:
-		if sc.agentPool.IsAvailabilitySets() {
-			return errors.Errorf("scaling isn't supported for orchestrator %q, with availability sets", orchestratorInfo.OrchestratorType)
-		}
-		transformer.NormalizeForVMSSScaling(sc.logger, templateJSON)
+		counts[pool.name] = result.Count
 	}
 
-	random := rand.New(rand.NewSource(time.Now().UnixNano()))
-	deploymentSuffix := random.Int31()
+	// record the pools that were scaled, even when a later one failed
+	if len(counts) > 0 {
+		if saveErr := sc.saveAPIModel(counts); saveErr != nil && err == nil {
+			err = saveErr
+		}
+	}
+	return err
+}
 
-	_, err = sc.client.DeployTemplate(
-		ctx,
-		sc.resourceGroupName,
-		fmt.Sprintf("%s-%d", sc.resourceGroupName, deploymentSuffix),
-		templateJSON,
-		parametersJSON)
-	if err != nil {
-		return err
+// parsePoolCount parses a --pool value of the form name=count
+func parsePoolCount(value string) (poolCount, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) == 2 && parts[0] != "" {
+		if count, err := strconv.Atoi(parts[1]); err == nil && count > 0 {
+			return poolCount{name: parts[0], count: count}, nil
+		}
 	}
+	return poolCount{}, errors.Errorf("--pool %s must be of the form name=count with a count of at least 1", value)
+}
 
-	return sc.saveAPIModel()
+func isScaleDownPolicy(policy string) bool {
+	for _, p := range operations.ScaleDownPolicies {
+		if string(p) == policy {
+			return true
+		}
+	}
+	return false
 }
 
-func (sc *scaleCmd) saveAPIModel() error {
+// saveAPIModel records the node counts of the scaled pools in the apimodel.json of the deployment directory
+func (sc *scaleCmd) saveAPIModel(counts map[string]int) error {
 	var err error
 	apiloader := &api.Apiloader{
 		Translator: &i18n.Translator{
@@ -442,7 +350,11 @@ func (sc *scaleCmd) saveAPIModel() error {
 	if err != nil {
 		return err
 	}
-	sc.containerService.Properties.AgentPoolProfiles[sc.agentPoolIndex].Count = sc.newDesiredAgentCount
+	for _, pool := range sc.containerService.Properties.AgentPoolProfiles {
+		if count, ok := counts[pool.Name]; ok {
+			pool.Count = count
+		}
+	}
 
 	b, err := apiloader.SerializeContainerService(sc.containerService, apiVersion)
 
@@ -458,60 +370,3 @@ func (sc *scaleCmd) saveAPIModel() error {
 
 	return f.SaveFile(sc.deploymentDirectory, apiModelFilename, b)
 }
-
-func (sc *scaleCmd) vmInAgentPool(vmName string, tags map[string]*string) bool {
-	// Try to locate the VM's agent pool by expected tags.
-	if tags != nil {
-		if poolName, ok := tags["poolName"]; ok {
-			if nameSuffix, ok := tags["resourceNameSuffix"]; ok {
-				// Use strings.Contains for the nameSuffix as the Windows Agent Pools use only
-				// a substring of the first 5 characters of the entire nameSuffix.
-				if strings.EqualFold(*poolName, sc.agentPoolToScale) && strings.Contains(sc.nameSuffix, *nameSuffix) {
-					return true
-				}
-			}
-		}
-	}
-
-	// Fall back to checking the VM name to see if it fits the naming pattern.
-	return strings.Contains(vmName, sc.nameSuffix[:5]) && strings.Contains(vmName, sc.agentPoolToScale)
-}
-
-type paramsMap map[string]interface{}
-
-func addValue(m paramsMap, k string, v interface{}) {
-	m[k] = paramsMap{
-		"value": v,
-	}
-}
-
-func (sc *scaleCmd) drainNodes(kubeConfig string, vmsToDelete []string) error {
-	masterURL := sc.masterFQDN
-	if !strings.HasPrefix(masterURL, "https://") {
-		masterURL = fmt.Sprintf("https://%s", masterURL)
-	}
-	numVmsToDrain := len(vmsToDelete)
-	errChan := make(chan *operations.VMScalingErrorDetails, numVmsToDrain)
-	defer close(errChan)
-	for _, vmName := range vmsToDelete {
-		go func(vmName string) {
-			err := operations.SafelyDrainNode(sc.client, sc.logger,
-				masterURL, kubeConfig, vmName, time.Duration(60)*time.Minute)
-			if err != nil {
-				log.Errorf("Failed to drain node %s, got error %v", vmName, err)
-				errChan <- &operations.VMScalingErrorDetails{Error: err, Name: vmName}
-				return
-			}
-			errChan <- nil
-		}(vmName)
-	}
-
-	for i := 0; i < numVmsToDrain; i++ {
-		errDetails := <-errChan
-		if errDetails != nil {
-			return errors.Wrapf(errDetails.Error, "Node %q failed to drain with error", errDetails.Name)
-		}
-	}
-
-	return nil
-}
@@ -4,9 +4,19 @@
 package cmd
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
 	"testing"
 
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -16,7 +26,7 @@ func TestNewScaleCmd(t *testing.T) {
 		t.Fatalf("scale command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, scaleName, output.Short, scaleShortDescription, output.Long, scaleLongDescription)
 	}
 
-	expectedFlags := []string{"location", "resource-group", "deployment-dir", "new-node-count", "node-pool", "master-FQDN"}
+	expectedFlags := []string{"location", "resource-group", "deployment-dir", "new-node-count", "node-pool", "master-FQDN", "scale-down-policy", "pool", "remove-nodes", "addons-dir"}
 	for _, f := range expectedFlags {
 		if output.Flags().Lookup(f) == nil {
 			t.Fatalf("scale command should have flag %s", f)
@@ -82,6 +92,62 @@ func TestScaleCmdValidate(t *testing.T) {
 				agentPoolToScale:     "agentpool1",
 				newDesiredAgentCount: 5,
 				masterFQDN:           "test",
+				scaleDownPolicy:      "random",
+			},
+			expectedErr: errors.New("--scale-down-policy must be one of [newest oldest least-loaded]"),
+		},
+		{
+			sc: &scaleCmd{
+				location:             "centralus",
+				resourceGroupName:    "testRG",
+				deploymentDirectory:  "_output/test",
+				agentPoolToScale:     "agentpool1",
+				newDesiredAgentCount: 5,
+				masterFQDN:           "test",
+				scaleDownPolicy:      "least-loaded",
+			},
+			expectedErr: nil,
+		},
+		{
+			sc: &scaleCmd{
+				location:            "centralus",
+				resourceGroupName:   "testRG",
+				deploymentDirectory: "_output/test",
+				pools:               []string{"agentpool1=3"},
+				removeNodes:         []string{"k8s-agentpool1-12345678-0"},
+				scaleDownPolicy:     "newest",
+			},
+			expectedErr: errors.New("--pool cannot be combined with --node-pool, --new-node-count or --remove-nodes"),
+		},
+		{
+			sc: &scaleCmd{
+				location:            "centralus",
+				resourceGroupName:   "testRG",
+				deploymentDirectory: "_output/test",
+				pools:               []string{"agentpool1=3", "agentpool1=4"},
+				scaleDownPolicy:     "newest",
+			},
+			expectedErr: errors.New("--pool agentpool1 is specified more than once"),
+		},
+		{
+			sc: &scaleCmd{
+				location:            "centralus",
+				resourceGroupName:   "testRG",
+				deploymentDirectory: "_output/test",
+				pools:               []string{"agentpool1=3", "agentpool2=10"},
+				scaleDownPolicy:     "newest",
+			},
+			expectedErr: nil,
+		},
+		{
+			sc: &scaleCmd{
+				location:            "centralus",
+				resourceGroupName:   "testRG",
+				deploymentDirectory: "_output/test",
+				agentPoolToScale:    "agentpool1",
+				removeNodes:         []string{"k8s-agentpool1-12345678-0"},
+				masterFQDN:          "test",
+				scaleDownPolicy:     "newest",
 			},
 			expectedErr: nil,
 		},
@@ -102,3 +168,102 @@ func TestScaleCmdValidate(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePoolCount(t *testing.T) {
+	pool, err := parsePoolCount("linuxpool1=10")
+	if err != nil {
+		t.Fatalf("unexpected error parsing a pool count: %s", err)
+	}
+	if pool.name != "linuxpool1" || pool.count != 10 {
+		t.Fatalf("expected linuxpool1 with 10 nodes, got %+v", pool)
+	}
+
+	for _, value := range []string{"linuxpool1", "=3", "linuxpool1=", "linuxpool1=0", "linuxpool1=three"} {
+		if _, err := parsePoolCount(value); err == nil {
+			t.Fatalf("expected an error parsing the pool count %q", value)
+		}
+	}
+}
+
+func TestScaleCmdScaleDownScaleSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acs-engine-scale")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{},
+	}
+	cs, apiVersion, err := apiloader.LoadContainerServiceFromFile("../pkg/acsengine/testdata/simple/kubernetes.json", true, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error loading the api model: %s", err.Error())
+	}
+	for _, pool := range cs.Properties.AgentPoolProfiles {
+		pool.AvailabilityProfile = api.VirtualMachineScaleSets
+	}
+	b, err := apiloader.SerializeContainerService(cs, apiVersion)
+	if err != nil {
+		t.Fatalf("unexpected error serializing the api model: %s", err.Error())
+	}
+	if err = ioutil.WriteFile(path.Join(dir, apiModelFilename), b, 0644); err != nil {
+		t.Fatalf("unexpected error writing the api model: %s", err.Error())
+	}
+
+	vmssName := "k8s-agentpool1-12345678-vmss"
+	var capacity int64 = 3
+	vms := []compute.VirtualMachineScaleSetVM{}
+	for i := 0; i < 3; i++ {
+		vms = append(vms, compute.VirtualMachineScaleSetVM{
+			InstanceID: helpers.PointerToString(fmt.Sprint(i)),
+			Name:       helpers.PointerToString(fmt.Sprintf("%s_%d", vmssName, i)),
+		})
+	}
+	client := &armhelpers.MockACSEngineClient{
+		MockKubernetesClient: &armhelpers.MockKubernetesClient{},
+		ScaleSets: []compute.VirtualMachineScaleSet{{
+			Name: helpers.PointerToString(vmssName),
+			Tags: map[string]*string{
+				"poolName":           helpers.PointerToString("agentpool1"),
+				"resourceNameSuffix": helpers.PointerToString("12345678"),
+			},
+			Sku:                              &compute.Sku{Capacity: &capacity},
+			VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{},
+		}},
+		ScaleSetVMs: map[string][]compute.VirtualMachineScaleSetVM{vmssName: vms},
+	}
+	sc := &scaleCmd{
+		location:            "westus2",
+		resourceGroupName:   "rg1",
+		deploymentDirectory: dir,
+		masterFQDN:          "masterdns1.westus2.cloudapp.azure.com",
+		apiModelPath:        path.Join(dir, apiModelFilename),
+		client:              client,
+		nameSuffix:          "12345678",
+		poolCounts:          []poolCount{{name: "agentpool1", count: 1}},
+		logger:              log.NewEntry(log.New()),
+	}
+	if err = sc.loadContainerService(); err != nil {
+		t.Fatalf("unexpected error loading the deployed api model: %s", err.Error())
+	}
+	if err = sc.scalePools(); err != nil {
+		t.Fatalf("unexpected error scaling down the scale set: %s", err.Error())
+	}
+	if len(sc.result.VMsDeleted) != 2 {
+		t.Fatalf("expected 2 instances to be deleted, got %v", sc.result.VMsDeleted)
+	}
+
+	saved, _, err := apiloader.LoadContainerServiceFromFile(sc.apiModelPath, false, true, nil)
+	if err != nil {
+		t.Fatalf("unexpected error loading the saved api model: %s", err.Error())
+	}
+	for _, pool := range saved.Properties.AgentPoolProfiles {
+		expected := 3
+		if pool.Name == "agentpool1" {
+			expected = 1
+		}
+		if pool.Count != expected {
+			t.Fatalf("expected the count of %s to be saved as %d, got %d", pool.Name, expected, pool.Count)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Azure/acs-engine/pkg/api/vlabs"
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/spf13/cobra"
+)
+
+const (
+	schemaName             = "schema"
+	schemaShortDescription = "Print the JSON Schema of the vlabs apimodel"
+	schemaLongDescription  = "Print the JSON Schema of the vlabs apimodel, for editors to complete and check apimodels and for CI to lint them"
+)
+
+func newSchemaCmd() *cobra.Command {
+	var result commandResult
+	return &cobra.Command{
+		Use:   schemaName,
+		Short: schemaShortDescription,
+		Long:  schemaLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCommand(cmd, &result, func() error {
+				schema := vlabs.JSONSchema()
+				// with --output json the schema is part of the result
+				if outputFormat == "json" {
+					result.Schema = schema
+					return nil
+				}
+				data, err := helpers.JSONMarshalIndent(schema, "", "  ", false)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), string(data))
+				return nil
+			})
+		},
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/api/vlabs"
+)
+
+func TestSchemaCmd(t *testing.T) {
+	command := newSchemaCmd()
+	if command.Use != schemaName || command.Short != schemaShortDescription || command.Long != schemaLongDescription {
+		t.Fatalf("schema command should have use %s equal %s, short %s equal %s and long %s equal to %s", command.Use, schemaName, command.Short, schemaShortDescription, command.Long, schemaLongDescription)
+	}
+
+	var buf bytes.Buffer
+	command.SetOutput(&buf)
+	if err := command.RunE(command, []string{}); err != nil {
+		t.Fatalf("unexpected error printing the schema: %s", err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &schema); err != nil {
+		t.Fatalf("expected the schema to be printed as JSON: %s", err)
+	}
+	if schema["$schema"] != vlabs.JSONSchemaID || schema["definitions"] == nil {
+		t.Fatalf("unexpected schema: %s", buf.String())
+	}
+
+	// with --output json the schema is part of the result
+	defer func() { outputFormat = "human" }()
+	outputFormat = "json"
+	buf.Reset()
+	if err := command.RunE(command, []string{}); err != nil {
+		t.Fatalf("unexpected error printing the schema: %s", err)
+	}
+	var result commandResult
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("expected the result to be printed as JSON: %s", err)
+	}
+	if !result.Succeeded || result.Command != schemaName || result.Schema["$schema"] != vlabs.JSONSchemaID {
+		t.Fatalf("expected the schema in the result, got %s", buf.String())
+	}
+}
@@ -12,9 +12,9 @@ import (
 	"path"
 	"time"
 
-	"github.com/Azure/acs-engine/pkg/acsengine"
 	"github.com/Azure/acs-engine/pkg/api"
 	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/engine"
 	"github.com/Azure/acs-engine/pkg/helpers"
 	"github.com/Azure/acs-engine/pkg/i18n"
 	"github.com/Azure/acs-engine/pkg/operations/kubernetesupgrade"
@@ -33,13 +33,19 @@ const (
 
 type upgradeCmd struct {
 	authArgs
+	addonsArgs
 
 	// user input
-	resourceGroupName   string
-	deploymentDirectory string
-	upgradeVersion      string
-	location            string
-	timeoutInMinutes    int
+	resourceGroupName       string
+	deploymentDirectory     string
+	upgradeVersion          string
+	location                string
+	timeoutInMinutes        int
+	resume                  bool
+	maxSurge                int
+	maxUnavailable          int
+	concurrency             int
+	upgradeTimeoutInMinutes int
 
 	// derived
 	containerService    *api.ContainerService
@@ -49,6 +55,9 @@ type upgradeCmd struct {
 	nameSuffix          string
 	agentPoolsToUpgrade []string
 	timeout             *time.Duration
+	upgradeTimeout      *time.Duration
+	journal             *kubernetesupgrade.UpgradeJournal
+	result              commandResult
 }
 
 // NewUpgradeCmd run a command to upgrade a Kubernetes cluster
@@ -60,7 +69,9 @@ func newUpgradeCmd() *cobra.Command {
 		Short: upgradeShortDescription,
 		Long:  upgradeLongDescription,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return uc.run(cmd, args)
+			return runCommand(cmd, &uc.result, func() error {
+				return uc.run(cmd, args)
+			})
 		},
 	}
 
@@ -70,7 +81,13 @@ func newUpgradeCmd() *cobra.Command {
 	f.StringVar(&uc.deploymentDirectory, "deployment-dir", "", "the location of the output from `generate` (required)")
 	f.StringVarP(&uc.upgradeVersion, "upgrade-version", "k", "", "desired kubernetes version (required)")
 	f.IntVar(&uc.timeoutInMinutes, "vm-timeout", -1, "how long to wait for each vm to be upgraded in minutes")
+	f.IntVar(&uc.maxSurge, "max-surge", 0, "number of upgraded agent nodes to create and wait for before draining and deleting old ones (0 replaces agent nodes one at a time)")
+	f.IntVar(&uc.maxUnavailable, "max-unavailable", 0, "number of agent nodes a pool can be short of its count during an upgrade with --max-surge")
+	f.IntVar(&uc.concurrency, "concurrency", 1, "number of nodes of a pool to upgrade at the same time, lowered to what PodDisruptionBudgets allow")
+	f.IntVar(&uc.upgradeTimeoutInMinutes, "upgrade-timeout", 0, "how long to wait for the whole upgrade to complete in minutes (0 uses the default of 90)")
+	f.BoolVar(&uc.resume, "resume", false, "resume an interrupted upgrade from the upgrade state file in the deployment directory")
 	addAuthFlags(&uc.authArgs, f)
+	addAddonsFlags(&uc.addonsArgs, f)
 
 	return upgradeCmd
 }
@@ -101,6 +118,31 @@ func (uc *upgradeCmd) validate(cmd *cobra.Command) error {
 		uc.timeout = &timeout
 	}
 
+	if uc.concurrency < 1 {
+		cmd.Usage()
+		return errors.New("--concurrency must be at least 1")
+	}
+
+	if uc.upgradeTimeoutInMinutes < 0 {
+		cmd.Usage()
+		return errors.New("--upgrade-timeout cannot be negative")
+	}
+
+	if uc.upgradeTimeoutInMinutes > 0 {
+		upgradeTimeout := time.Duration(uc.upgradeTimeoutInMinutes) * time.Minute
+		uc.upgradeTimeout = &upgradeTimeout
+	}
+
+	if uc.maxSurge < 0 || uc.maxUnavailable < 0 {
+		cmd.Usage()
+		return errors.New("--max-surge and --max-unavailable cannot be negative")
+	}
+
+	if uc.maxUnavailable > 0 && uc.maxSurge == 0 {
+		cmd.Usage()
+		return errors.New("--max-unavailable requires --max-surge")
+	}
+
 	// TODO(colemick): add in the cmd annotation to help enable autocompletion
 	if uc.upgradeVersion == "" {
 		cmd.Usage()
@@ -150,6 +192,9 @@ func (uc *upgradeCmd) loadCluster(cmd *cobra.Command) error {
 	if err != nil {
 		return errors.Wrap(err, "Error parsing the api model")
 	}
+	if err = uc.setAddonRegistry(uc.containerService); err != nil {
+		return err
+	}
 
 	if uc.containerService.Location == "" {
 		uc.containerService.Location = uc.location
@@ -157,30 +202,6 @@ func (uc *upgradeCmd) loadCluster(cmd *cobra.Command) error {
 		return errors.New("--location does not match api model location")
 	}
 
-	// get available upgrades for container service
-	orchestratorInfo, err := api.GetOrchestratorVersionProfile(uc.containerService.Properties.OrchestratorProfile, uc.containerService.Properties.HasWindows())
-	if err != nil {
-		return errors.Wrap(err, "error getting list of available upgrades")
-	}
-
-	// add the current version if upgrade has failed
-	orchestratorInfo.Upgrades = append(orchestratorInfo.Upgrades, &api.OrchestratorProfile{
-		OrchestratorType:    uc.containerService.Properties.OrchestratorProfile.OrchestratorType,
-		OrchestratorVersion: uc.containerService.Properties.OrchestratorProfile.OrchestratorVersion})
-
-	// validate desired upgrade version and set goal state
-	found := false
-	for _, up := range orchestratorInfo.Upgrades {
-		if up.OrchestratorVersion == uc.upgradeVersion {
-			uc.containerService.Properties.OrchestratorProfile.OrchestratorVersion = uc.upgradeVersion
-			found = true
-			break
-		}
-	}
-	if !found {
-		return errors.Errorf("Upgrading to version %s is not supported. To see a list of available upgrades, use 'acs-engine orchestrators --orchestrator kubernetes --version %s'", uc.upgradeVersion, uc.containerService.Properties.OrchestratorProfile.OrchestratorVersion)
-	}
-
 	// Read name suffix to identify nodes in the resource group that belong
 	// to this cluster.
 	// TODO: Also update to read  namesuffix from the parameters file as
@@ -204,37 +225,70 @@ func (uc *upgradeCmd) loadCluster(cmd *cobra.Command) error {
 	for _, agentPool := range uc.containerService.Properties.AgentPoolProfiles {
 		uc.agentPoolsToUpgrade = append(uc.agentPoolsToUpgrade, agentPool.Name)
 	}
+
+	return uc.loadUpgradeState()
+}
+
+// loadUpgradeState loads the upgrade state file when resuming, or starts a new one
+func (uc *upgradeCmd) loadUpgradeState() error {
+	var err error
+	statePath := path.Join(uc.deploymentDirectory, kubernetesupgrade.UpgradeStateFileName)
+
+	if uc.resume {
+		uc.journal, err = kubernetesupgrade.LoadUpgradeJournal(statePath, uc.upgradeVersion)
+		if err != nil {
+			return errors.Wrap(err, "error loading upgrade state, cannot resume")
+		}
+		log.Infoln(fmt.Sprintf("Resuming upgrade from %s", statePath))
+		return nil
+	}
+
+	if previous, err := kubernetesupgrade.LoadUpgradeJournal(statePath, uc.upgradeVersion); err == nil && !previous.State().Completed {
+		log.Warnln(fmt.Sprintf("Found an unfinished upgrade in %s, use --resume to continue it. Starting a new upgrade", statePath))
+	}
+	uc.journal = kubernetesupgrade.NewUpgradeJournal(statePath, uc.upgradeVersion)
 	return nil
 }
 
 func (uc *upgradeCmd) run(cmd *cobra.Command, args []string) error {
 	err := uc.validate(cmd)
 	if err != nil {
-		log.Fatalf("error validating upgrade command: %v", err)
+		return errors.Wrap(newValidationError(err), "error validating upgrade command")
 	}
 
 	err = uc.loadCluster(cmd)
 	if err != nil {
-		log.Fatalf("error loading existing cluster: %v", err)
+		return errors.Wrap(newValidationError(err), "error loading existing cluster")
 	}
+	uc.result.ResourceGroup = uc.resourceGroupName
 
-	upgradeCluster := kubernetesupgrade.UpgradeCluster{
+	result, err := engine.Upgrade(context.Background(), engine.UpgradeOptions{
+		Client: uc.client,
+		Logger: log.NewEntry(log.New()),
 		Translator: &i18n.Translator{
 			Locale: uc.locale,
 		},
-		Logger:      log.NewEntry(log.New()),
-		Client:      uc.client,
-		StepTimeout: uc.timeout,
+		ContainerService: uc.containerService,
+		SubscriptionID:   uc.authArgs.SubscriptionID,
+		ResourceGroup:    uc.resourceGroupName,
+		Location:         uc.location,
+		NameSuffix:       uc.nameSuffix,
+		UpgradeVersion:   uc.upgradeVersion,
+		AgentPools:       uc.agentPoolsToUpgrade,
+		Journal:          uc.journal,
+		StepTimeout:      uc.timeout,
+		MaxSurge:         uc.maxSurge,
+		MaxUnavailable:   uc.maxUnavailable,
+		Concurrency:      uc.concurrency,
+		UpgradeTimeout:   uc.upgradeTimeout,
+		BuildTag:         BuildTag,
+	})
+	if result != nil {
+		// nodes upgraded before a failure are reported too
+		uc.result.UpgradedNodes = result.UpgradedNodes
 	}
-
-	kubeConfig, err := acsengine.GenerateKubeConfig(uc.containerService.Properties, uc.location)
 	if err != nil {
-		log.Fatalf("failed to generate kube config: %v", err) // TODO: cleanup
-	}
-
-	if err = upgradeCluster.UpgradeCluster(uc.authArgs.SubscriptionID, uc.client, kubeConfig, uc.resourceGroupName,
-		uc.containerService, uc.nameSuffix, uc.agentPoolsToUpgrade, BuildTag); err != nil {
-		log.Fatalf("Error upgrading cluster: %v\n", err)
+		return errors.Wrap(err, "Error upgrading cluster")
 	}
 
 	apiloader := &api.Apiloader{
@@ -4,6 +4,11 @@
 package cmd
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/Azure/acs-engine/pkg/operations/kubernetesupgrade"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
@@ -22,6 +27,11 @@ var _ = Describe("the upgrade command", func() {
 		Expect(output.Flags().Lookup("resource-group")).NotTo(BeNil())
 		Expect(output.Flags().Lookup("deployment-dir")).NotTo(BeNil())
 		Expect(output.Flags().Lookup("upgrade-version")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("resume")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("max-surge")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("max-unavailable")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("concurrency")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("upgrade-timeout")).NotTo(BeNil())
 	})
 
 	It("should validate an upgrade command", func() {
@@ -36,6 +46,7 @@ var _ = Describe("the upgrade command", func() {
 					resourceGroupName:   "",
 					deploymentDirectory: "_output/test",
 					upgradeVersion:      "1.8.9",
+					concurrency:         1,
 					location:            "centralus",
 					timeoutInMinutes:    60,
 				},
@@ -46,6 +57,7 @@ var _ = Describe("the upgrade command", func() {
 					resourceGroupName:   "test",
 					deploymentDirectory: "_output/test",
 					upgradeVersion:      "1.8.9",
+					concurrency:         1,
 					location:            "",
 					timeoutInMinutes:    60,
 				},
@@ -56,6 +68,7 @@ var _ = Describe("the upgrade command", func() {
 					resourceGroupName:   "test",
 					deploymentDirectory: "_output/test",
 					upgradeVersion:      "",
+					concurrency:         1,
 					location:            "southcentralus",
 					timeoutInMinutes:    60,
 				},
@@ -66,6 +79,7 @@ var _ = Describe("the upgrade command", func() {
 					resourceGroupName:   "test",
 					deploymentDirectory: "",
 					upgradeVersion:      "1.9.0",
+					concurrency:         1,
 					location:            "southcentralus",
 					timeoutInMinutes:    60,
 				},
@@ -76,6 +90,7 @@ var _ = Describe("the upgrade command", func() {
 					resourceGroupName:   "test",
 					deploymentDirectory: "",
 					upgradeVersion:      "1.9.0",
+					concurrency:         1,
 					location:            "southcentralus",
 					timeoutInMinutes:    60,
 				},
@@ -86,6 +101,62 @@ var _ = Describe("the upgrade command", func() {
 					resourceGroupName:   "test",
 					deploymentDirectory: "_output/mydir",
 					upgradeVersion:      "1.9.0",
+					concurrency:         1,
+					location:            "southcentralus",
+					maxSurge:            -1,
+				},
+				expectedErr: errors.New("--max-surge and --max-unavailable cannot be negative"),
+			},
+			{
+				uc: &upgradeCmd{
+					resourceGroupName:   "test",
+					deploymentDirectory: "_output/mydir",
+					upgradeVersion:      "1.9.0",
+					concurrency:         1,
+					location:            "southcentralus",
+					maxUnavailable:      1,
+				},
+				expectedErr: errors.New("--max-unavailable requires --max-surge"),
+			},
+			{
+				uc: &upgradeCmd{
+					resourceGroupName:   "test",
+					deploymentDirectory: "_output/mydir",
+					upgradeVersion:      "1.9.0",
+					location:            "southcentralus",
+					concurrency:         0,
+				},
+				expectedErr: errors.New("--concurrency must be at least 1"),
+			},
+			{
+				uc: &upgradeCmd{
+					resourceGroupName:       "test",
+					deploymentDirectory:     "_output/mydir",
+					upgradeVersion:          "1.9.0",
+					location:                "southcentralus",
+					concurrency:             3,
+					upgradeTimeoutInMinutes: 120,
+				},
+				expectedErr: nil,
+			},
+			{
+				uc: &upgradeCmd{
+					resourceGroupName:   "test",
+					deploymentDirectory: "_output/mydir",
+					upgradeVersion:      "1.9.0",
+					concurrency:         1,
+					location:            "southcentralus",
+					maxSurge:            2,
+					maxUnavailable:      1,
+				},
+				expectedErr: nil,
+			},
+			{
+				uc: &upgradeCmd{
+					resourceGroupName:   "test",
+					deploymentDirectory: "_output/mydir",
+					upgradeVersion:      "1.9.0",
+					concurrency:         1,
 					location:            "southcentralus",
 				},
 				expectedErr: nil,
@@ -104,4 +175,29 @@ var _ = Describe("the upgrade command", func() {
 
 	})
 
+	It("should load the upgrade state when resuming", func() {
+		dir, err := ioutil.TempDir("", "upgrade")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+
+		uc := &upgradeCmd{
+			deploymentDirectory: dir,
+			upgradeVersion:      "1.9.0",
+			resume:              true,
+		}
+		err = uc.loadUpgradeState()
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("error loading upgrade state, cannot resume"))
+
+		uc.resume = false
+		Expect(uc.loadUpgradeState()).To(Succeed())
+		Expect(uc.journal.Start("agentpool1", "k8s-agentpool1-12345678-0", 0, kubernetesupgrade.UpgradeStepDrain)).To(Succeed())
+
+		uc.resume = true
+		Expect(uc.loadUpgradeState()).To(Succeed())
+		Expect(uc.journal.IsCompleted("agentpool1", "k8s-agentpool1-12345678-0", kubernetesupgrade.UpgradeStepDrain)).To(BeFalse())
+		Expect(uc.journal.State().Entries).To(HaveLen(1))
+		Expect(path.Join(dir, kubernetesupgrade.UpgradeStateFileName)).To(BeAnExistingFile())
+	})
+
 })
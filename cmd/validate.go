@@ -0,0 +1,222 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/Azure/acs-engine/pkg/operations/preflight"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	validateName             = "validate"
+	validateShortDescription = "Validate an apimodel"
+	validateLongDescription  = "Validate an apimodel against its JSON Schema and the rules of its API version and, with --preflight, check it against the subscription it will be deployed to: quota, VM size availability, custom subnets, service principal permissions and resource provider registration"
+)
+
+type validateCmd struct {
+	authProvider
+	apimodelPath  string
+	location      string
+	resourceGroup string
+	preflight     bool
+	apiModelOverrides
+
+	// derived
+	containerService *api.ContainerService
+	apiVersion       string
+	locale           *gotext.Locale
+	client           armhelpers.ACSEngineClient
+	result           commandResult
+}
+
+func newValidateCmd() *cobra.Command {
+	vc := validateCmd{
+		authProvider: &authArgs{},
+	}
+
+	validateCmd := &cobra.Command{
+		Use:   validateName,
+		Short: validateShortDescription,
+		Long:  validateLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCommand(cmd, &vc.result, func() error {
+				if err := vc.validate(cmd, args); err != nil {
+					return errors.Wrap(newValidationError(err), "error validating validateCmd")
+				}
+				if err := vc.mergeAPIModel(); err != nil {
+					return errors.Wrap(newValidationError(err), "error merging API model in validateCmd")
+				}
+				if err := vc.loadAPIModel(cmd); err != nil {
+					return errors.Wrap(newValidationError(err), "error loading API model in validateCmd")
+				}
+				return vc.run(cmd)
+			})
+		},
+	}
+
+	f := validateCmd.Flags()
+	f.StringVarP(&vc.apimodelPath, "api-model", "m", "", "path to the apimodel file")
+	f.BoolVar(&vc.preflight, "preflight", false, "check the apimodel against the subscription it will be deployed to")
+	f.StringVarP(&vc.location, "location", "l", "", "location to deploy to (defaults to the apimodel location, used with --preflight)")
+	f.StringVarP(&vc.resourceGroup, "resource-group", "g", "", "resource group to deploy to (defaults to the DNS prefix, used with --preflight)")
+	addAPIModelOverrideFlags(&vc.apiModelOverrides, f)
+
+	addAuthFlags(vc.getAuthArgs(), f)
+
+	return validateCmd
+}
+
+func (vc *validateCmd) validate(cmd *cobra.Command, args []string) error {
+	var err error
+
+	vc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if vc.apimodelPath == "" {
+		if len(args) == 1 {
+			vc.apimodelPath = args[0]
+		} else if len(args) > 1 {
+			cmd.Usage()
+			return errors.New("too many arguments were provided to 'validate'")
+		} else {
+			cmd.Usage()
+			return errors.New("--api-model was not supplied, nor was one specified as a positional argument")
+		}
+	}
+
+	if _, err := os.Stat(vc.apimodelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", vc.apimodelPath)
+	}
+
+	return nil
+}
+
+func (vc *validateCmd) mergeAPIModel() error {
+	var err error
+	// overrides the api model and generates a new file if --set, --set-file or --values have been used
+	vc.apimodelPath, err = vc.mergeOverrides(vc.apimodelPath)
+	if err != nil {
+		return errors.Wrap(err, "error merging --set, --set-file and --values with the api model")
+	}
+
+	return nil
+}
+
+func (vc *validateCmd) loadAPIModel(cmd *cobra.Command) error {
+	contents, err := ioutil.ReadFile(vc.apimodelPath)
+	if err != nil {
+		return errors.Wrapf(err, "error reading the api model %s", vc.apimodelPath)
+	}
+	schemaErrs, err := api.ValidateAPIModelSchema(contents)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+	problems := make([]string, len(schemaErrs))
+	for i, e := range schemaErrs {
+		problems[i] = e.Error()
+	}
+	vc.reportProblems(cmd, problems)
+	if len(schemaErrs) > 0 {
+		return errors.Errorf("the api model does not match its schema: %d errors", len(schemaErrs))
+	}
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: vc.locale,
+		},
+	}
+	vc.containerService, vc.apiVersion, err = apiloader.LoadContainerServiceFromFile(vc.apimodelPath, true, false, nil)
+	if err != nil {
+		logValidationWarnings(err)
+		return errors.Wrap(err, "error parsing the api model")
+	}
+
+	if !vc.preflight {
+		return nil
+	}
+
+	if vc.location == "" {
+		vc.location = vc.containerService.Location
+	}
+	if vc.location == "" {
+		return errors.New("--location must be specified when the apimodel has no location")
+	}
+	vc.location = helpers.NormalizeAzureRegion(vc.location)
+
+	if vc.resourceGroup == "" {
+		if vc.containerService.Properties.MasterProfile != nil {
+			vc.resourceGroup = vc.containerService.Properties.MasterProfile.DNSPrefix
+		} else {
+			vc.resourceGroup = vc.containerService.Properties.HostedMasterProfile.DNSPrefix
+		}
+		log.Infof("--resource-group was not specified. Using the DNS prefix from the apimodel as the resource group name: %s", vc.resourceGroup)
+	}
+
+	if err = vc.getAuthArgs().validateAuthArgs(); err != nil {
+		return err
+	}
+
+	vc.client, err = vc.authProvider.getClient()
+	if err != nil {
+		return errors.Wrap(err, "failed to get client")
+	}
+
+	return nil
+}
+
+func (vc *validateCmd) run(cmd *cobra.Command) error {
+	if !vc.preflight {
+		log.Infof("apimodel %s is valid", vc.apimodelPath)
+		return nil
+	}
+
+	checker := &preflight.Checker{
+		Client:         vc.client,
+		Logger:         log.NewEntry(log.New()),
+		SubscriptionID: vc.getAuthArgs().SubscriptionID.String(),
+		ResourceGroup:  vc.resourceGroup,
+		Location:       vc.location,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	report := checker.Run(ctx, vc.containerService)
+
+	problems := make([]string, len(report.Problems))
+	for i, p := range report.Problems {
+		problems[i] = p.String()
+	}
+	vc.reportProblems(cmd, problems)
+	if errs := report.Errors(); errs > 0 {
+		return newValidationError(errors.Errorf("pre-flight validation found %d problems that will make the deployment fail", errs))
+	}
+	log.Infof("apimodel %s passed pre-flight validation", vc.apimodelPath)
+	return nil
+}
+
+// reportProblems writes the problems found in the apimodel to the output of the command,
+// or adds them to the result of the command with --output json
+func (vc *validateCmd) reportProblems(cmd *cobra.Command, problems []string) {
+	vc.result.Problems = append(vc.result.Problems, problems...)
+	if outputFormat == "json" {
+		return
+	}
+	for _, p := range problems {
+		fmt.Fprintln(cmd.OutOrStdout(), p)
+	}
+}
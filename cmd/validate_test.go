@@ -0,0 +1,157 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/azure-sdk-for-go/services/authorization/mgmt/2015-07-01/authorization"
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/spf13/cobra"
+)
+
+func TestNewValidateCmd(t *testing.T) {
+	output := newValidateCmd()
+	if output.Use != validateName || output.Short != validateShortDescription || output.Long != validateLongDescription {
+		t.Fatalf("validate command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, validateName, output.Short, validateShortDescription, output.Long, validateLongDescription)
+	}
+
+	expectedFlags := []string{"api-model", "preflight", "location", "resource-group", "set", "set-file", "values", "subscription-id", "auth-method"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("validate command should have flag %s", f)
+		}
+	}
+}
+
+func TestValidateCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	v := &validateCmd{}
+	if err := v.validate(r, []string{"../pkg/acsengine/testdata/simple/kubernetes.json"}); err != nil {
+		t.Fatalf("unexpected error validating 1 arg: %s", err.Error())
+	}
+
+	v = &validateCmd{}
+	if err := v.validate(r, []string{}); err == nil {
+		t.Fatalf("expected error validating 0 args")
+	}
+
+	v = &validateCmd{}
+	if err := v.validate(r, []string{"../pkg/acsengine/testdata/simple/kubernetes.json", "arg1"}); err == nil {
+		t.Fatalf("expected error validating multiple args")
+	}
+}
+
+func newPreflightValidateCmd(client armhelpers.ACSEngineClient) *validateCmd {
+	return &validateCmd{
+		apimodelPath: "../pkg/acsengine/testdata/simple/kubernetes.json",
+		preflight:    true,
+		location:     "westus2",
+		authProvider: &mockAuthProvider{
+			getClientMock: client,
+			authArgs: &authArgs{
+				rawSubscriptionID:   "11111111-2222-3333-4444-555555555555",
+				RawAzureEnvironment: "AzurePublicCloud",
+			},
+		},
+	}
+}
+
+func TestValidateCmdRun(t *testing.T) {
+	v := &validateCmd{
+		apimodelPath: "../pkg/acsengine/testdata/simple/kubernetes.json",
+	}
+	if err := v.loadAPIModel(&cobra.Command{}); err != nil {
+		t.Fatalf("unexpected error loading the api model: %s", err.Error())
+	}
+	if err := v.run(&cobra.Command{}); err != nil {
+		t.Fatalf("unexpected error validating the api model: %s", err.Error())
+	}
+}
+
+func TestValidateCmdPreflight(t *testing.T) {
+	// an empty subscription offers no VM size and has no registered provider
+	v := newPreflightValidateCmd(&armhelpers.MockACSEngineClient{})
+	if err := v.loadAPIModel(&cobra.Command{}); err != nil {
+		t.Fatalf("unexpected error loading the api model: %s", err.Error())
+	}
+	if v.resourceGroup != "masterdns1" {
+		t.Fatalf("expected the resource group to default to the dns prefix, got %s", v.resourceGroup)
+	}
+	err := v.run(&cobra.Command{})
+	if err == nil {
+		t.Fatalf("expected pre-flight validation to fail")
+	}
+	if err.Error() != "pre-flight validation found 7 problems that will make the deployment fail" {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	client := &armhelpers.MockACSEngineClient{
+		ResourceSkus: []armhelpers.ResourceSku{{
+			ResourceType: "virtualMachines",
+			Name:         "Standard_D2_v2",
+			Locations:    []string{"westus2"},
+		}},
+		Providers: []resources.Provider{
+			{Namespace: to.StringPtr("Microsoft.Compute"), RegistrationState: to.StringPtr("Registered")},
+			{Namespace: to.StringPtr("Microsoft.Storage"), RegistrationState: to.StringPtr("Registered")},
+			{Namespace: to.StringPtr("Microsoft.Network"), RegistrationState: to.StringPtr("Registered")},
+		},
+		RoleAssignments: []authorization.RoleAssignment{{
+			Properties: &authorization.RoleAssignmentPropertiesWithScope{
+				RoleDefinitionID: to.StringPtr("/providers/Microsoft.Authorization/roleDefinitions/" + armhelpers.AADContributorRoleID),
+			},
+		}},
+	}
+	v = newPreflightValidateCmd(client)
+	if err := v.loadAPIModel(&cobra.Command{}); err != nil {
+		t.Fatalf("unexpected error loading the api model: %s", err.Error())
+	}
+	if err := v.run(&cobra.Command{}); err != nil {
+		t.Fatalf("unexpected error running pre-flight validation: %s", err.Error())
+	}
+}
+
+func TestValidateCmdSchema(t *testing.T) {
+	f, err := ioutil.TempFile("", "apimodel")
+	if err != nil {
+		t.Fatalf("unable to create the api model: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"apiVersion": "vlabs", "properties": {"orchestratorProfile": {"orchestratorType": "Kubernetes", "unknown": true}, "masterProfile": {"count": 2}}}`)
+	f.Close()
+
+	v := &validateCmd{apimodelPath: f.Name()}
+	err = v.loadAPIModel(&cobra.Command{})
+	if err == nil || err.Error() != "the api model does not match its schema: 4 errors" {
+		t.Fatalf("expected the api model not to match its schema, got %v", err)
+	}
+
+	// with --output json the schema errors are part of the result, the only output of the command
+	defer func() { outputFormat = "human" }()
+	outputFormat = "json"
+	command := newValidateCmd()
+	var out bytes.Buffer
+	command.SetOutput(&out)
+	if err = command.RunE(command, []string{f.Name()}); err == nil {
+		t.Fatalf("expected the api model not to match its schema")
+	}
+	var result commandResult
+	if err = json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("expected the output to be a JSON result, got %s", out.String())
+	}
+	if result.Succeeded || result.ExitCode != exitCodeValidation || len(result.Problems) != 4 {
+		t.Fatalf("expected the 4 schema errors in a failed result, got %+v", result)
+	}
+	if !command.SilenceUsage {
+		t.Fatalf("expected the usage not to be printed once the flags are parsed")
+	}
+}
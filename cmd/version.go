@@ -7,7 +7,7 @@ import (
 	"fmt"
 
 	"github.com/Azure/acs-engine/pkg/helpers"
-	log "github.com/sirupsen/logrus"
+	"github.com/pkg/errors"
 
 	"github.com/spf13/cobra"
 )
@@ -61,7 +61,7 @@ func getJSONVersion() string {
 	return string(jsonVersion)
 }
 
-func getVersion(outputType string) string {
+func getVersion(outputType string) (string, error) {
 	var output string
 
 	if outputType == "human" {
@@ -69,26 +69,35 @@ func getVersion(outputType string) string {
 	} else if outputType == "json" {
 		output = getJSONVersion()
 	} else {
-		log.Fatalf("unsupported output format: %s\n", outputFormat)
+		return "", newValidationError(errors.Errorf("unsupported output format %s, use one of %s", outputType, outputFormatOptions))
 	}
 
-	return output
+	return output, nil
 }
 
 func newVersionCmd() *cobra.Command {
+	var result commandResult
 	versionCmd := &cobra.Command{
 		Use:   versionName,
 		Short: versionShortDescription,
 		Long:  versionLongDescription,
 
-		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println(getVersion(outputFormat))
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCommand(cmd, &result, func() error {
+				// with --output json the version is part of the result
+				if outputFormat == "json" {
+					result.Version = &version
+					return nil
+				}
+				output, err := getVersion(outputFormat)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), output)
+				return nil
+			})
 		},
 	}
 
-	versionCmdDescription := fmt.Sprintf("Output format to use: %s", outputFormatOptions)
-
-	versionCmd.Flags().StringVarP(&outputFormat, "output", "o", "human", versionCmdDescription)
-
 	return versionCmd
 }
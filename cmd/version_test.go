@@ -17,18 +17,26 @@ var _ = Describe("the version command", func() {
 		Expect(output.Use).Should(Equal(versionName))
 		Expect(output.Short).Should(Equal(versionShortDescription))
 		Expect(output.Long).Should(Equal(versionLongDescription))
-		Expect(output.Flags().Lookup("output")).NotTo(BeNil())
+		// the format is the persistent --output flag of the root command
+		Expect(output.Flags().Lookup("output")).To(BeNil())
+	})
+
+	It("should fail with an unsupported output format", func() {
+		_, err := getVersion("yaml")
+		Expect(err).To(HaveOccurred())
 	})
 
 	It("should print a json version of ACS-Engine", func() {
-		output := getVersion("json")
+		output, err := getVersion("json")
+		Expect(err).NotTo(HaveOccurred())
 
 		expectedOutput, _ := helpers.JSONMarshalIndent(version, "", "  ", false)
 
 		Expect(output).Should(Equal(string(expectedOutput)))
 	})
 	It("should print a humanized version of ACS-Engine", func() {
-		output := getVersion("human")
+		output, err := getVersion("human")
+		Expect(err).NotTo(HaveOccurred())
 
 		expectedOutput := fmt.Sprintf("Version: %s\nGitCommit: %s\nGitTreeState: %s",
 			BuildTag,
@@ -39,7 +47,8 @@ var _ = Describe("the version command", func() {
 	})
 
 	It("should print a json version of ACS-Engine", func() {
-		output := getVersion("json")
+		output, err := getVersion("json")
+		Expect(err).NotTo(HaveOccurred())
 
 		expectedOutput, _ := helpers.JSONMarshalIndent(version, "", "  ", false)
 
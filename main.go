@@ -4,6 +4,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/Azure/acs-engine/cmd"
 	"github.com/mattn/go-colorable"
 	log "github.com/sirupsen/logrus"
@@ -13,6 +15,7 @@ func main() {
 	log.SetFormatter(&log.TextFormatter{ForceColors: true})
 	log.SetOutput(colorable.NewColorableStdout())
 	if err := cmd.NewRootCmd().Execute(); err != nil {
-		log.Fatalln(err)
+		log.Errorln(err)
+		os.Exit(cmd.ExitCode(err))
 	}
 }
@@ -0,0 +1,106 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package acsengine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/pkg/errors"
+)
+
+const (
+	// chartAddonJobAsset is the manifest of the job installing the chart of a chart addon
+	chartAddonJobAsset = "kubernetesmasteraddons-helm-chart-job.yaml"
+	// ChartAddonsPath is where the packaged charts of the chart addons are written on the masters
+	ChartAddonsPath = "/etc/kubernetes/charts"
+)
+
+// chartAddonJob is the data of the template of the job installing a chart addon
+type chartAddonJob struct {
+	Name       string
+	JobName    string
+	Image      string
+	Args       string
+	Packaged   bool
+	ChartsPath string
+}
+
+// renderChartAddon returns the manifest of the job installing the chart of addon with helm, and
+// the packaged chart if any. The job runs the helm client of the tiller image and is named after
+// the hash of the chart and its values, for the addon manager to replace it, and the release to
+// be upgraded, when they change.
+func renderChartAddon(addon api.KubernetesAddon, tillerImage, sourcePath string) (AddonManifest, error) {
+	chart := addon.Chart
+	m := AddonManifest{Name: addon.Name, DestinationFile: addon.Name + "-chart.yaml"}
+	args := []string{"upgrade", "--install", addon.Name}
+	if chart.IsPackaged() {
+		b, err := ioutil.ReadFile(chart.Path)
+		if err != nil {
+			return m, &AddonRenderError{Addon: addon.Name, Err: errors.Wrap(err, "error reading the packaged chart")}
+		}
+		m.Chart = b
+		args = append(args, ChartAddonsPath+"/"+addon.Name+".tgz")
+	} else {
+		args = append(args, chart.Name, "--repo", chart.Repository)
+		if chart.Version != "" {
+			args = append(args, "--version", chart.Version)
+		}
+	}
+	args = append(args, "--namespace", chart.Namespace)
+	keys := make([]string, 0, len(addon.Config))
+	for key := range addon.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--set", key+"="+escapeHelmSetValue(addon.Config[key]))
+	}
+	// a JSON array is a YAML flow sequence
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return m, &AddonRenderError{Addon: addon.Name, Err: err}
+	}
+
+	hash := sha256.New()
+	hash.Write(argsJSON)
+	hash.Write([]byte(tillerImage))
+	hash.Write(m.Chart)
+	job := chartAddonJob{
+		Name:       addon.Name,
+		JobName:    fmt.Sprintf("%s-chart-%x", addon.Name, hash.Sum(nil)[:4]),
+		Image:      tillerImage,
+		Args:       string(argsJSON),
+		Packaged:   chart.IsPackaged(),
+		ChartsPath: ChartAddonsPath,
+	}
+
+	b, err := Asset(sourcePath + "/" + chartAddonJobAsset)
+	if err != nil {
+		return m, &AddonRenderError{Addon: addon.Name, Err: err}
+	}
+	templ, err := template.New(addon.Name).Parse(string(b))
+	if err != nil {
+		return m, &AddonRenderError{Addon: addon.Name, Err: err}
+	}
+	var buffer bytes.Buffer
+	if err := templ.Execute(&buffer, job); err != nil {
+		return m, &AddonRenderError{Addon: addon.Name, Err: err}
+	}
+	m.Content = buffer.String()
+	return m, nil
+}
+
+// escapeHelmSetValue escapes the separators of helm --set in a value
+func escapeHelmSetValue(value string) string {
+	value = strings.Replace(value, "\\", "\\\\", -1)
+	return strings.Replace(value, ",", "\\,", -1)
+}
@@ -0,0 +1,102 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package acsengine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/ghodss/yaml"
+)
+
+func TestRenderChartAddon(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acs-engine-charts")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	chartPath := filepath.Join(dir, "my-packaged-chart-1.0.0.tgz")
+	if err := ioutil.WriteFile(chartPath, []byte("chart"), 0644); err != nil {
+		t.Fatalf("unexpected error writing the chart: %s", err)
+	}
+
+	cs := api.CreateMockContainerService("testcluster", "1.10.8", 1, 3, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.Addons = []api.KubernetesAddon{
+		{
+			Name:   "my-chart",
+			Chart:  &api.HelmChart{Repository: "https://contoso.github.io/charts", Version: "1.0.0"},
+			Config: map[string]string{"replicas": "2", "hosts": "a,b"},
+		},
+		{
+			Name:  "my-packaged-chart",
+			Chart: &api.HelmChart{Path: chartPath},
+		},
+	}
+	cs.SetPropertiesDefaults(false, false)
+	manifests, err := RenderAddons(cs)
+	if err != nil {
+		t.Fatalf("unexpected error rendering the chart addons: %s", err)
+	}
+	rendered := map[string]AddonManifest{}
+	for _, m := range manifests {
+		rendered[m.Name] = m
+	}
+
+	chart := rendered["my-chart"]
+	var job struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Spec struct {
+			Template struct {
+				Spec struct {
+					Containers []struct {
+						Image string   `json:"image"`
+						Args  []string `json:"args"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal([]byte(chart.Content), &job); err != nil {
+		t.Fatalf("unexpected error parsing the job of the chart addon: %s", err)
+	}
+	expectedArgs := "upgrade --install my-chart my-chart --repo https://contoso.github.io/charts --version 1.0.0 --namespace kube-system --set hosts=a\\,b --set replicas=2"
+	containers := job.Spec.Template.Spec.Containers
+	if len(containers) != 1 || strings.Join(containers[0].Args, " ") != expectedArgs || !strings.Contains(containers[0].Image, "tiller") {
+		t.Fatalf("expected the job to install the chart with helm, got %+v", containers)
+	}
+	if chart.DestinationFile != "my-chart-chart.yaml" || chart.Chart != nil || !strings.HasPrefix(job.Metadata.Name, "my-chart-chart-") {
+		t.Fatalf("expected the job of the chart addon, got %+v", chart)
+	}
+
+	packaged := rendered["my-packaged-chart"]
+	if string(packaged.Chart) != "chart" || !strings.Contains(packaged.Content, "/etc/kubernetes/charts/my-packaged-chart.tgz") || !strings.Contains(packaged.Content, "node-role.kubernetes.io/master") {
+		t.Fatalf("expected the packaged chart to be installed from the masters, got %s", packaged.Content)
+	}
+	addons, err := getContainerAddonsString(cs, "k8s/containeraddons")
+	if err != nil || !strings.Contains(addons, "/etc/kubernetes/charts/my-packaged-chart.tgz") {
+		t.Fatalf("expected the packaged chart in the files of the masters, got %v", err)
+	}
+
+	// the job is replaced when the values change
+	cs.Properties.OrchestratorProfile.KubernetesConfig.Addons[0].Config["replicas"] = "3"
+	if manifests, err = RenderAddons(cs); err != nil {
+		t.Fatalf("unexpected error rendering the chart addons: %s", err)
+	}
+	for _, m := range manifests {
+		if m.Name == "my-chart" && strings.Contains(m.Content, job.Metadata.Name) {
+			t.Fatalf("expected the job to be renamed when the values change")
+		}
+	}
+
+	os.Remove(chartPath)
+	if _, err := RenderAddons(cs); err == nil {
+		t.Fatalf("expected an error rendering a missing packaged chart")
+	}
+}
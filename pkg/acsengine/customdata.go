@@ -0,0 +1,199 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package acsengine
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxCustomDataSize is the size of the largest custom data Azure accepts for a VM, measured
+// before the custom data is base64 encoded
+const maxCustomDataSize = 65535
+
+// validateCustomDataSize returns an error when the custom data of a VM or scale set of the
+// template templateRaw is larger than Azure accepts. The size is that of the concatenation
+// the custom data is the base64 of, with the variables and parameters holding strings, such as
+// the provisioning scripts, replaced by their values; the other expressions are not counted.
+func validateCustomDataSize(templateRaw string, parameters paramsMap) error {
+	var template struct {
+		Parameters map[string]struct {
+			DefaultValue interface{} `json:"defaultValue"`
+		} `json:"parameters"`
+		Variables map[string]interface{}   `json:"variables"`
+		Resources []map[string]interface{} `json:"resources"`
+	}
+	if err := json.Unmarshal([]byte(templateRaw), &template); err != nil {
+		return errors.Wrap(err, "error parsing the template to measure the custom data")
+	}
+	value := func(function, name string) string {
+		var v interface{}
+		switch function {
+		case "variables":
+			v = template.Variables[name]
+		case "parameters":
+			v = template.Parameters[name].DefaultValue
+			if p, ok := parameters[name].(paramsMap); ok {
+				v = p["value"]
+			}
+		}
+		s, _ := v.(string)
+		if strings.HasPrefix(s, "[") {
+			// an expression evaluated at deployment
+			return ""
+		}
+		return s
+	}
+
+	for _, resource := range template.Resources {
+		name, _ := resource["name"].(string)
+		for _, customData := range findCustomData(resource) {
+			args, ok := concatArgs(customData)
+			if !ok {
+				continue
+			}
+			size := 0
+			for _, arg := range args {
+				if arg.function == "" {
+					size += len(arg.literal)
+				} else {
+					size += len(value(arg.function, arg.literal))
+				}
+			}
+			if size > maxCustomDataSize {
+				return errors.Errorf("the custom data of resource %s is at least %d bytes, more than the %d bytes Azure accepts; "+
+					"use chart repositories rather than packaged charts, or fewer and smaller custom files and addons", name, size, maxCustomDataSize)
+			}
+		}
+	}
+	return nil
+}
+
+// findCustomData returns the custom data expressions of the osProfile objects of a resource
+func findCustomData(v interface{}) []string {
+	var found []string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if s, ok := child.(string); ok && key == "customData" {
+				found = append(found, s)
+			} else {
+				found = append(found, findCustomData(child)...)
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			found = append(found, findCustomData(child)...)
+		}
+	}
+	return found
+}
+
+// concatArg is an argument of the concat of a custom data expression: a string literal, or the
+// call of function with a single string literal argument, such as variables('name')
+type concatArg struct {
+	function string
+	literal  string
+}
+
+// concatArgs returns the arguments of a custom data expression of the form
+// [base64(concat(...))], or false when the custom data has another form
+func concatArgs(expression string) ([]concatArg, bool) {
+	const prefix, suffix = "[base64(concat(", "))]"
+	if !strings.HasPrefix(expression, prefix) || !strings.HasSuffix(expression, suffix) {
+		return nil, false
+	}
+	s := expression[len(prefix) : len(expression)-len(suffix)]
+	var args []concatArg
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			break
+		}
+		var arg concatArg
+		if s[0] == '\'' {
+			literal, rest, ok := readStringLiteral(s)
+			if !ok {
+				return nil, false
+			}
+			arg.literal, s = literal, rest
+		} else {
+			open := strings.IndexByte(s, '(')
+			if open < 0 {
+				return nil, false
+			}
+			function := strings.TrimSpace(s[:open])
+			s = s[open+1:]
+			closing := matchingParen(s, '(', ')')
+			if closing < 0 {
+				return nil, false
+			}
+			// only the calls with a single string literal argument, such as variables('name'),
+			// are evaluated
+			literal, rest, ok := readStringLiteral(strings.TrimSpace(s[:closing]))
+			if ok && strings.TrimSpace(rest) == "" {
+				arg.function, arg.literal = function, literal
+			}
+			s = s[closing+1:]
+			// an element of an array or object, such as variables('names')[copyIndex()], is
+			// not evaluated
+			for strings.HasPrefix(s, "[") {
+				if closing = matchingParen(s[1:], '[', ']'); closing < 0 {
+					return nil, false
+				}
+				arg = concatArg{}
+				s = s[closing+2:]
+			}
+		}
+		args = append(args, arg)
+	}
+	return args, true
+}
+
+// readStringLiteral reads the ARM string literal s starts with, in which a quote is doubled
+func readStringLiteral(s string) (string, string, bool) {
+	if s == "" || s[0] != '\'' {
+		return "", s, false
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != '\'' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '\'' {
+			b.WriteByte('\'')
+			i++
+			continue
+		}
+		return b.String(), s[i+1:], true
+	}
+	return "", s, false
+}
+
+// matchingParen returns the index of the close parenthesis or bracket matching the open one s
+// follows, skipping the string literals, or -1
+func matchingParen(s string, open, close byte) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			_, rest, ok := readStringLiteral(s[i:])
+			if !ok {
+				return -1
+			}
+			i = len(s) - len(rest) - 1
+		case open:
+			depth++
+		case close:
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
@@ -0,0 +1,100 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package acsengine
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/leonelquinteros/gotext"
+)
+
+func TestValidateCustomDataSize(t *testing.T) {
+	template := func(customData string) string {
+		return fmt.Sprintf(`{
+  "parameters": {"cert": {"type": "string", "defaultValue": "%s"}},
+  "variables": {"script": "%s", "name": "[concat('a', 'b')]"},
+  "resources": [{"name": "vm", "properties": {"osProfile": {"customData": "%s"}}}]
+}`, strings.Repeat("c", 1000), strings.Repeat("s", 60000), customData)
+	}
+
+	args, ok := concatArgs("[base64(concat('it''s', variables('script'),'\n', parameters('cert'), copyIndex(), variables(concat('a', 'b')), variables('names')[copyIndex()]))]")
+	expected := []concatArg{{literal: "it's"}, {function: "variables", literal: "script"}, {literal: "\n"}, {function: "parameters", literal: "cert"}, {}, {}, {}}
+	if !ok || fmt.Sprint(args) != fmt.Sprint(expected) {
+		t.Errorf("expected the arguments %v, got %v", expected, args)
+	}
+
+	cases := []struct {
+		customData string
+		parameters paramsMap
+		valid      bool
+	}{
+		{"[base64(concat('#cloud-config', variables('script'), parameters('cert')))]", nil, true},
+		{"[base64(concat('#cloud-config', variables('script'), variables('name'), parameters('cert')))]", paramsMap{"cert": paramsMap{"value": strings.Repeat("c", 6000)}}, false},
+		{"[base64(concat('#cloud-config', variables('script'), variables('script')))]", nil, false},
+		{"[variables('script')]", nil, true},
+	}
+	for _, c := range cases {
+		err := validateCustomDataSize(template(c.customData), c.parameters)
+		if c.valid && err != nil {
+			t.Errorf("unexpected error validating the size of %s: %s", c.customData, err)
+		}
+		if !c.valid && (err == nil || !strings.Contains(err.Error(), "custom data of resource vm")) {
+			t.Errorf("expected an error validating the size of %s, got %v", c.customData, err)
+		}
+	}
+}
+
+func TestGenerateTemplateCustomDataSize(t *testing.T) {
+	locale := gotext.NewLocale(path.Join("..", "..", "translations"), "en_US")
+	i18n.Initialize(locale)
+	apiloader := &api.Apiloader{Translator: &i18n.Translator{Locale: locale}}
+	templateGenerator, err := InitializeTemplateGenerator(Context{Translator: &i18n.Translator{Locale: locale}})
+	if err != nil {
+		t.Fatalf("failed to initialize template generator: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "acs-engine-charts")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	// random bytes are not compressed by gzip
+	chart := make([]byte, 20*1024)
+	if _, err = rand.Read(chart); err != nil {
+		t.Fatalf("unexpected error generating the chart: %s", err)
+	}
+	chartPath := filepath.Join(dir, "my-chart-1.0.0.tgz")
+	if err = ioutil.WriteFile(chartPath, chart, 0644); err != nil {
+		t.Fatalf("unexpected error writing the chart: %s", err)
+	}
+
+	containerService, _, err := apiloader.LoadContainerServiceFromFile("./testdata/simple/kubernetes.json", true, false, nil)
+	if err != nil {
+		t.Fatalf("failed to load container service from file: %v", err)
+	}
+	k := containerService.Properties.OrchestratorProfile.KubernetesConfig
+	k.Addons = append(k.Addons, api.KubernetesAddon{Name: "my-chart", Chart: &api.HelmChart{Path: chartPath}})
+	containerService.SetPropertiesDefaults(false, false)
+	if _, _, err = templateGenerator.GenerateTemplate(containerService, DefaultGeneratorCode, TestACSEngineVersion); err == nil || !strings.Contains(err.Error(), "custom data") {
+		t.Fatalf("expected an error generating masters with a custom data too large, got %v", err)
+	}
+
+	for i := range k.Addons {
+		if k.Addons[i].Name == "my-chart" {
+			k.Addons[i].Chart = &api.HelmChart{Repository: "https://contoso.github.io/charts", Name: "my-chart"}
+		}
+	}
+	if _, _, err = templateGenerator.GenerateTemplate(containerService, DefaultGeneratorCode, TestACSEngineVersion); err != nil {
+		t.Fatalf("unexpected error generating the template with a chart repository: %s", err)
+	}
+}
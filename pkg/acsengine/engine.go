@@ -42,12 +42,6 @@ var openshiftTemplateFiles = append(
 	openshift39MasterScript,
 )
 
-var keyvaultSecretPathRe *regexp.Regexp
-
-func init() {
-	keyvaultSecretPathRe = regexp.MustCompile(`^(/subscriptions/\S+/resourceGroups/\S+/providers/Microsoft.KeyVault/vaults/\S+)/secrets/([^/\s]+)(/(\S+))?$`)
-}
-
 // GenerateKubeConfig returns a JSON string representing the KubeConfig
 func GenerateKubeConfig(properties *api.Properties, location string) (string, error) {
 	if properties == nil {
@@ -183,8 +177,8 @@ func addSecret(m paramsMap, k string, v interface{}, encode bool) {
 		addValue(m, k, v)
 		return
 	}
-	parts := keyvaultSecretPathRe.FindStringSubmatch(str)
-	if parts == nil || len(parts) != 5 {
+	vaultID, secretName, secretVersion, ok := helpers.ParseKeyvaultSecretPath(str)
+	if !ok {
 		if encode {
 			addValue(m, k, base64.StdEncoding.EncodeToString([]byte(str)))
 		} else {
@@ -192,7 +186,7 @@ func addSecret(m paramsMap, k string, v interface{}, encode bool) {
 		}
 		return
 	}
-	addKeyvaultReference(m, k, parts[1], parts[2], parts[4])
+	addKeyvaultReference(m, k, vaultID, secretName, secretVersion)
 }
 
 // getStorageAccountType returns the support managed disk storage tier for a give VM size
@@ -405,14 +399,24 @@ func getDCOSAgentCustomNodeLabels(profile *api.AgentPoolProfile) string {
 
 	buf.WriteString(attrstring)
 	if len(profile.CustomNodeLabels) > 0 {
-		for k, v := range profile.CustomNodeLabels {
-			buf.WriteString(fmt.Sprintf(";%s:%s", k, v))
+		for _, k := range sortedKeys(profile.CustomNodeLabels) {
+			buf.WriteString(fmt.Sprintf(";%s:%s", k, profile.CustomNodeLabels[k]))
 		}
 	}
 	buf.WriteString("\"")
 	return buf.String()
 }
 
+// sortedKeys returns the keys of m in order, so that the maps written to templates are always written the same way
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func getDCOSWindowsAgentCustomAttributes(profile *api.AgentPoolProfile) string {
 	var buf bytes.Buffer
 	var attrstring string
@@ -427,8 +431,8 @@ func getDCOSWindowsAgentCustomAttributes(profile *api.AgentPoolProfile) string {
 	}
 	buf.WriteString(attrstring)
 	if len(profile.CustomNodeLabels) > 0 {
-		for k, v := range profile.CustomNodeLabels {
-			buf.WriteString(fmt.Sprintf(";%s:%s", k, v))
+		for _, k := range sortedKeys(profile.CustomNodeLabels) {
+			buf.WriteString(fmt.Sprintf(";%s:%s", k, profile.CustomNodeLabels[k]))
 		}
 	}
 	return buf.String()
@@ -696,76 +700,158 @@ func getDCOSProvisionScript(script string) string {
 	return strings.Replace(strings.Replace(provisionScript, "\r\n", "\n", -1), "\n", "\n\n    ", -1)
 }
 
-func getAddonFuncMap(addon api.KubernetesAddon) template.FuncMap {
+// AddonRenderError is returned when the manifest of an enabled container addon cannot be rendered
+type AddonRenderError struct {
+	Addon string
+	Err   error
+}
+
+// Error implements error interface
+func (e *AddonRenderError) Error() string {
+	return fmt.Sprintf("error rendering the manifest of addon %s: %s", e.Addon, e.Err)
+}
+
+// AddonManifest is the rendered manifest of an enabled container addon
+type AddonManifest struct {
+	// Name is the name of the addon
+	Name string
+	// DestinationFile is the name of the manifest in /etc/kubernetes/addons
+	DestinationFile string
+	// Content is the manifest deployed by the addon manager
+	Content string
+	// Chart is the packaged chart of a chart addon, written to /etc/kubernetes/charts
+	Chart []byte
+}
+
+func getAddonFuncMap(addon api.KubernetesAddon, properties *api.Properties) template.FuncMap {
+	container := func(name string) (api.KubernetesContainerSpec, error) {
+		i := addon.GetAddonContainersIndexByName(name)
+		if i < 0 {
+			return api.KubernetesContainerSpec{}, errors.Errorf("addon %s has no spec for container %s", addon.Name, name)
+		}
+		return addon.Containers[i], nil
+	}
 	return template.FuncMap{
-		"ContainerImage": func(name string) string {
-			i := addon.GetAddonContainersIndexByName(name)
-			return addon.Containers[i].Image
+		"ContainerImage": func(name string) (string, error) {
+			c, err := container(name)
+			return c.Image, err
 		},
 
-		"ContainerCPUReqs": func(name string) string {
-			i := addon.GetAddonContainersIndexByName(name)
-			return addon.Containers[i].CPURequests
+		"ContainerCPUReqs": func(name string) (string, error) {
+			c, err := container(name)
+			return c.CPURequests, err
 		},
 
-		"ContainerCPULimits": func(name string) string {
-			i := addon.GetAddonContainersIndexByName(name)
-			return addon.Containers[i].CPULimits
+		"ContainerCPULimits": func(name string) (string, error) {
+			c, err := container(name)
+			return c.CPULimits, err
 		},
 
-		"ContainerMemReqs": func(name string) string {
-			i := addon.GetAddonContainersIndexByName(name)
-			return addon.Containers[i].MemoryRequests
+		"ContainerMemReqs": func(name string) (string, error) {
+			c, err := container(name)
+			return c.MemoryRequests, err
 		},
 
-		"ContainerMemLimits": func(name string) string {
-			i := addon.GetAddonContainersIndexByName(name)
-			return addon.Containers[i].MemoryLimits
+		"ContainerMemLimits": func(name string) (string, error) {
+			c, err := container(name)
+			return c.MemoryLimits, err
 		},
 		"ContainerConfig": func(name string) string {
 			return addon.Config[name]
 		},
-	}
-}
 
-func getContainerAddonsString(properties *api.Properties, sourcePath string) string {
-	var result string
-	settingsMap := kubernetesContainerAddonSettingsInit(properties)
-
-	var addonNames []string
-
-	for addonName := range settingsMap {
-		addonNames = append(addonNames, addonName)
+		// ClusterAutoscalerNodes falls back to the min-nodes and max-nodes of the addon config
+		// and the primary scale set when no agent pool has autoscaling enabled
+		"ClusterAutoscalerNodes": func() []string {
+			if nodes := properties.GetClusterAutoscalerNodes(); len(nodes) > 0 {
+				return nodes
+			}
+			return []string{addon.Config["min-nodes"] + ":" + addon.Config["max-nodes"] + ":<vmssName>"}
+		},
 	}
+}
 
-	sort.Strings(addonNames)
+// RenderAddons returns the manifests of the enabled container addons of cs, sorted by addon name
+func RenderAddons(cs *api.ContainerService) ([]AddonManifest, error) {
+	return renderContainerAddons(cs, "k8s/containeraddons")
+}
 
-	for _, addonName := range addonNames {
-		setting := settingsMap[addonName]
-		if setting.isEnabled {
-			var input string
-			if setting.rawScript != "" {
-				input = setting.rawScript
-			} else {
-				addon := properties.OrchestratorProfile.KubernetesConfig.GetAddonByName(addonName)
-				templ := template.New("addon resolver template").Funcs(getAddonFuncMap(addon))
-				addonFile := sourcePath + "/" + setting.sourceFile
-				addonFileBytes, err := Asset(addonFile)
-				if err != nil {
-					return ""
-				}
-				_, err = templ.Parse(string(addonFileBytes))
+// renderContainerAddons returns the manifests of the enabled addons of the registry of cs, sorted
+// by addon name. The manifests of the built-in addons are read from sourcePath.
+func renderContainerAddons(cs *api.ContainerService, sourcePath string) ([]AddonManifest, error) {
+	var manifests []AddonManifest
+	properties := cs.Properties
+	descriptors := append([]*api.AddonDescriptor(nil), cs.AddonRegistry().Addons()...)
+	sort.Slice(descriptors, func(i, j int) bool {
+		return descriptors[i].Name < descriptors[j].Name
+	})
+
+	for _, d := range descriptors {
+		if !d.HasManifest() || !d.IsEnabled(properties) {
+			continue
+		}
+		addon := properties.OrchestratorProfile.KubernetesConfig.GetAddonByName(d.Name)
+		content := addon.Data
+		if content == "" {
+			manifest := d.Manifest
+			if d.ManifestAsset != "" {
+				addonFileBytes, err := Asset(sourcePath + "/" + d.ManifestAsset)
 				if err != nil {
-					return ""
+					return nil, &AddonRenderError{Addon: d.Name, Err: err}
 				}
-				var buffer bytes.Buffer
-				templ.Execute(&buffer, addon)
-				input = buffer.String()
+				manifest = string(addonFileBytes)
 			}
-			result += getAddonString(input, "/etc/kubernetes/addons", setting.destinationFile)
+			// the built-in addons may not be in the apimodel of a cluster they are enabled for
+			addon.Name = d.Name
+			templ := template.New(d.Name).Funcs(getAddonFuncMap(addon, properties))
+			if _, err := templ.Parse(manifest); err != nil {
+				return nil, &AddonRenderError{Addon: d.Name, Err: err}
+			}
+			var buffer bytes.Buffer
+			if err := templ.Execute(&buffer, addon); err != nil {
+				return nil, &AddonRenderError{Addon: d.Name, Err: err}
+			}
+			content = buffer.String()
 		}
+		manifests = append(manifests, AddonManifest{Name: d.Name, DestinationFile: d.GetDestinationFile(), Content: content})
 	}
-	return result
+
+	kubernetesConfig := properties.OrchestratorProfile.KubernetesConfig
+	for _, addon := range kubernetesConfig.Addons {
+		if !addon.IsChart() || !addon.IsEnabled(true) {
+			continue
+		}
+		tiller := kubernetesConfig.GetAddonByName(DefaultTillerAddonName)
+		i := tiller.GetAddonContainersIndexByName(DefaultTillerAddonName)
+		if i < 0 {
+			return nil, &AddonRenderError{Addon: addon.Name, Err: errors.Errorf("addon %s has no spec for container %s", DefaultTillerAddonName, DefaultTillerAddonName)}
+		}
+		m, err := renderChartAddon(addon, tiller.Containers[i].Image, sourcePath)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m)
+	}
+	sort.SliceStable(manifests, func(i, j int) bool {
+		return manifests[i].Name < manifests[j].Name
+	})
+	return manifests, nil
+}
+
+// getContainerAddonsString returns the cloud-init files of the manifests of the enabled addons of cs
+func getContainerAddonsString(cs *api.ContainerService, sourcePath string) (string, error) {
+	manifests, err := renderContainerAddons(cs, sourcePath)
+	if err != nil {
+		return "", err
+	}
+	var result string
+	for _, m := range manifests {
+		if m.Chart != nil {
+			result += getAddonString(string(m.Chart), ChartAddonsPath, m.Name+".tgz")
+		}
+		result += getAddonString(m.Content, "/etc/kubernetes/addons", m.DestinationFile)
+	}
+	return result, nil
 }
 
 func getDCOSAgentProvisionScript(profile *api.AgentPoolProfile, orchProfile *api.OrchestratorProfile, bootstrapIP string) string {
@@ -18,6 +18,7 @@ import (
 	"github.com/Azure/acs-engine/pkg/api/common"
 	"github.com/Azure/acs-engine/pkg/api/v20160330"
 	"github.com/Azure/acs-engine/pkg/api/vlabs"
+	"github.com/Azure/acs-engine/pkg/helpers"
 	"github.com/Azure/acs-engine/pkg/i18n"
 	"github.com/leonelquinteros/gotext"
 	"github.com/pkg/errors"
@@ -564,3 +565,141 @@ func TestGenerateKubeConfig(t *testing.T) {
 		t.Fatalf("Expected an error result from nil Properties child properties")
 	}
 }
+
+func TestGetContainerAddonsStringRegistry(t *testing.T) {
+	cs := api.CreateMockContainerService("testcluster", "1.10.8", 1, 3, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.Addons = []api.KubernetesAddon{
+		{
+			Name:       "my-addon",
+			Enabled:    helpers.PointerToBool(true),
+			Containers: []api.KubernetesContainerSpec{{Name: "my-addon", Image: "contoso/my-addon:1.0"}},
+			Config:     map[string]string{"replicas": "2"},
+		},
+	}
+	registry := api.NewAddonRegistry()
+	if err := registry.Register(&api.AddonDescriptor{
+		Name:     "my-addon",
+		Manifest: "image: {{ContainerImage \"my-addon\"}}\nreplicas: {{ContainerConfig \"replicas\"}}\n",
+	}); err != nil {
+		t.Fatalf("unexpected error registering the addon: %s", err)
+	}
+	cs.SetPropertiesDefaults(false, false)
+
+	addons, err := getContainerAddonsString(cs, "k8s/containeraddons")
+	if err != nil {
+		t.Fatalf("unexpected error rendering the addons: %s", err)
+	}
+	if strings.Contains(addons, "/etc/kubernetes/addons/my-addon.yaml") {
+		t.Fatalf("expected the addon not to be rendered without the registry holding it")
+	}
+	cs.SetAddonRegistry(registry)
+	if addons, err = getContainerAddonsString(cs, "k8s/containeraddons"); err != nil {
+		t.Fatalf("unexpected error rendering the addons: %s", err)
+	}
+	expected := getAddonString("image: contoso/my-addon:1.0\nreplicas: 2\n", "/etc/kubernetes/addons", "my-addon.yaml")
+	if !strings.Contains(addons, expected) {
+		t.Fatalf("expected the manifest of the addon rendered with the addon template functions, got %s", addons)
+	}
+	if !strings.Contains(addons, "/etc/kubernetes/addons/ip-masq-agent.yaml") {
+		t.Fatalf("expected the built-in addons to be rendered")
+	}
+}
+
+func TestRenderAddonsErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		manifest string
+	}{
+		{"missing container", "image: {{ContainerImage \"other\"}}\n"},
+		{"missing container resources", "cpu: {{ContainerCPULimits \"other\"}}\n"},
+		{"invalid template", "image: {{ContainerImage \"my-addon\"\n"},
+		{"unknown function", "image: {{Image \"my-addon\"}}\n"},
+	} {
+		cs := api.CreateMockContainerService("testcluster", "1.10.8", 1, 3, false)
+		cs.Properties.OrchestratorProfile.KubernetesConfig.Addons = []api.KubernetesAddon{
+			{
+				Name:       "my-addon",
+				Enabled:    helpers.PointerToBool(true),
+				Containers: []api.KubernetesContainerSpec{{Name: "my-addon", Image: "contoso/my-addon:1.0"}},
+			},
+		}
+		registry := api.NewAddonRegistry()
+		if err := registry.Register(&api.AddonDescriptor{Name: "my-addon", Manifest: test.manifest}); err != nil {
+			t.Fatalf("unexpected error registering the addon: %s", err)
+		}
+		cs.SetAddonRegistry(registry)
+		cs.SetPropertiesDefaults(false, false)
+
+		_, err := RenderAddons(cs)
+		renderErr, ok := err.(*AddonRenderError)
+		if !ok || renderErr.Addon != "my-addon" {
+			t.Errorf("%s: expected an error rendering my-addon, got %v", test.desc, err)
+		}
+	}
+}
+
+func TestRenderAddons(t *testing.T) {
+	cs := api.CreateMockContainerService("testcluster", "1.10.8", 1, 3, false)
+	cs.SetPropertiesDefaults(false, false)
+	manifests, err := RenderAddons(cs)
+	if err != nil {
+		t.Fatalf("unexpected error rendering the built-in addons: %s", err)
+	}
+	names := map[string]bool{}
+	for _, m := range manifests {
+		if m.Content == "" || m.DestinationFile == "" {
+			t.Errorf("expected the manifest of addon %s to be rendered", m.Name)
+		}
+		names[m.Name] = true
+	}
+	for _, name := range []string{DefaultTillerAddonName, DefaultDashboardAddonName, IPMASQAgentAddonName} {
+		if !names[name] {
+			t.Errorf("expected the enabled addon %s to be rendered", name)
+		}
+	}
+}
+
+func TestRenderAddonsClusterAutoscalerNodes(t *testing.T) {
+	cs := api.CreateMockContainerService("testcluster", "1.10.8", 1, 3, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.Addons = []api.KubernetesAddon{
+		{Name: api.DefaultClusterAutoscalerAddonName, Enabled: helpers.PointerToBool(true)},
+	}
+	cs.SetPropertiesDefaults(false, false)
+	autoscaler := func() string {
+		manifests, err := RenderAddons(cs)
+		if err != nil {
+			t.Fatalf("unexpected error rendering the addons: %s", err)
+		}
+		for _, m := range manifests {
+			if m.Name == api.DefaultClusterAutoscalerAddonName {
+				return m.Content
+			}
+		}
+		t.Fatalf("expected the cluster-autoscaler to be rendered")
+		return ""
+	}
+	if content := autoscaler(); !strings.Contains(content, "- --nodes=1:5:<vmssName>\n") {
+		t.Errorf("expected the node group of the addon config without autoscaled pools, got %s", content)
+	}
+
+	p := cs.Properties
+	p.AgentPoolProfiles[0].AvailabilityProfile = api.VirtualMachineScaleSets
+	p.AgentPoolProfiles = append(p.AgentPoolProfiles, &api.AgentPoolProfile{
+		Name:                "agentpool2",
+		Count:               2,
+		AvailabilityProfile: api.VirtualMachineScaleSets,
+	})
+	for i, pool := range p.AgentPoolProfiles {
+		pool.EnableAutoScaling, pool.MinCount, pool.MaxCount = helpers.PointerToBool(true), helpers.PointerToInt(i+1), helpers.PointerToInt(10)
+	}
+	content := autoscaler()
+	for i, pool := range p.AgentPoolProfiles {
+		expected := fmt.Sprintf("        - --nodes=%d:10:%s\n", i+1, p.GetAgentVMPrefix(pool))
+		if !strings.Contains(content, expected) {
+			t.Errorf("expected the node group %q, got %s", expected, content)
+		}
+	}
+	if strings.Contains(content, "<vmssName>") {
+		t.Errorf("expected no node group of the addon config with autoscaled pools")
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package acsengine
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/acsengine/transform"
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/Azure/acs-engine/pkg/i18n"
+)
+
+const (
+	ExamplesDir = "../../examples"
+	RepoDir     = "../.."
+	GoldenDir   = "./testdata/golden"
+	GoldenSeed  = "acs-engine golden files"
+)
+
+// updateGolden makes TestExamplesGolden rewrite the golden files rather than compare with them,
+// with go test ./pkg/acsengine -run TestExamplesGolden -update-golden
+var updateGolden = flag.Bool("update-golden", false, "rewrite the golden templates of the examples")
+
+// TestExamplesGolden generates the template and parameters of every apimodel in examples/
+// with the secrets derived from GoldenSeed and compares them with the golden files in
+// testdata/golden. The golden files of an example are named after it, such as
+// testdata/golden/kubernetes.json_expected_template.json.
+func TestExamplesGolden(t *testing.T) {
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = extensionsTransport{}
+	defer func() {
+		http.DefaultTransport = defaultTransport
+	}()
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{},
+	}
+	err := filepath.Walk(ExamplesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".json") {
+			return err
+		}
+		example, err := filepath.Rel(ExamplesDir, path)
+		if err != nil {
+			return err
+		}
+		example = filepath.ToSlash(example)
+		t.Run(example, func(t *testing.T) {
+			testExampleGolden(t, apiloader, path, filepath.Join(GoldenDir, filepath.FromSlash(example)))
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error walking %s: %s", ExamplesDir, err)
+	}
+}
+
+func testExampleGolden(t *testing.T, apiloader *api.Apiloader, path, golden string) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading %s: %s", path, err)
+	}
+	var document map[string]interface{}
+	if err = json.Unmarshal(contents, &document); err != nil {
+		t.Fatalf("error decoding %s: %s", path, err)
+	}
+	if _, ok := document["$schema"]; ok {
+		t.Skip("ARM template rather than an apimodel")
+	}
+
+	cs, _, err := apiloader.DeserializeContainerService(contents, false, false, nil)
+	if err != nil {
+		t.Fatalf("error loading %s: %s", path, err)
+	}
+	if cs.Properties.MasterProfile != nil && cs.Properties.MasterProfile.CustomFiles != nil {
+		// the custom files of the examples are paths on the machine of the user
+		dir, err := ioutil.TempDir("", "golden")
+		if err != nil {
+			t.Fatalf("error creating the directory of the custom files: %s", err)
+		}
+		defer os.RemoveAll(dir)
+		customFiles := *cs.Properties.MasterProfile.CustomFiles
+		for i := range customFiles {
+			customFiles[i].Source = filepath.Join(dir, strconv.Itoa(i))
+			if err = ioutil.WriteFile(customFiles[i].Source, []byte("golden "+customFiles[i].Dest+"\n"), 0644); err != nil {
+				t.Fatalf("error writing the custom file %s: %s", customFiles[i].Dest, err)
+			}
+		}
+	}
+	setGoldenPlaceholders(cs.Properties)
+	cs.SetSecretSource(helpers.NewSeededSecretSource(GoldenSeed, cs.Properties.GetDNSPrefix(), time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	if _, err = cs.SetPropertiesDefaults(false, false); err != nil {
+		t.Fatalf("error setting the defaults of %s: %s", path, err)
+	}
+
+	templateGenerator, err := InitializeTemplateGenerator(Context{
+		Translator: &i18n.Translator{},
+	})
+	if err != nil {
+		t.Fatalf("error initializing the template generator: %s", err)
+	}
+	template, parameters, err := templateGenerator.GenerateTemplate(cs, DefaultGeneratorCode, TestACSEngineVersion)
+	if err != nil {
+		t.Fatalf("error generating the template of %s: %s", path, err)
+	}
+	if template, err = transform.PrettyPrintArmTemplate(template); err != nil {
+		t.Fatalf("error pretty printing the template of %s: %s", path, err)
+	}
+	if parameters, err = transform.PrettyPrintJSON(parameters); err != nil {
+		t.Fatalf("error pretty printing the parameters of %s: %s", path, err)
+	}
+
+	for _, output := range []struct {
+		file     string
+		contents string
+	}{
+		{golden + "_expected_template.json", template},
+		{golden + "_expected_params.json", parameters},
+	} {
+		if *updateGolden {
+			if err = os.MkdirAll(filepath.Dir(output.file), 0755); err != nil {
+				t.Fatalf("error creating the directory of %s: %s", output.file, err)
+			}
+			if err = ioutil.WriteFile(output.file, []byte(output.contents), 0644); err != nil {
+				t.Fatalf("error writing %s: %s", output.file, err)
+			}
+			continue
+		}
+		expected, err := ioutil.ReadFile(output.file)
+		if err != nil {
+			t.Fatalf("error reading the golden file %s, run the test with -update-golden to write it: %s", output.file, err)
+		}
+		if !bytes.Equal(expected, []byte(output.contents)) {
+			t.Errorf("generated output of %s is different from %s: %s; run the test with -update-golden and review the changes",
+				path, output.file, firstDifference(string(expected), output.contents))
+		}
+	}
+}
+
+// setGoldenPlaceholders fills the fields the examples leave for users to set, and sets
+// fixed certificates so that the golden files do not depend on generated keys
+func setGoldenPlaceholders(p *api.Properties) {
+	if p.MasterProfile != nil && p.MasterProfile.DNSPrefix == "" {
+		p.MasterProfile.DNSPrefix = "golden"
+	}
+	if p.HostedMasterProfile != nil && p.HostedMasterProfile.DNSPrefix == "" {
+		p.HostedMasterProfile.DNSPrefix = "golden"
+	}
+	if p.LinuxProfile != nil {
+		for i := range p.LinuxProfile.SSH.PublicKeys {
+			if p.LinuxProfile.SSH.PublicKeys[i].KeyData == "" {
+				p.LinuxProfile.SSH.PublicKeys[i].KeyData = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQC golden@acs-engine"
+			}
+		}
+	}
+	if p.WindowsProfile != nil && p.WindowsProfile.AdminPassword == "" {
+		p.WindowsProfile.AdminPassword = "G0lden-Passw0rd"
+	}
+
+	o := p.OrchestratorProfile
+	if o == nil {
+		return
+	}
+	if (o.IsKubernetes() || o.IsOpenShift()) && (o.KubernetesConfig == nil || !o.KubernetesConfig.UseManagedIdentity) {
+		if p.ServicePrincipalProfile == nil {
+			p.ServicePrincipalProfile = &api.ServicePrincipalProfile{}
+		}
+		if p.ServicePrincipalProfile.ClientID == "" {
+			p.ServicePrincipalProfile.ClientID = "00000000-0000-0000-0000-000000000000"
+		}
+		if p.ServicePrincipalProfile.Secret == "" && p.ServicePrincipalProfile.KeyvaultSecretRef == nil {
+			p.ServicePrincipalProfile.Secret = "golden-secret"
+		}
+	}
+	if o.IsKubernetes() && p.MasterProfile != nil {
+		if p.CertificateProfile == nil {
+			p.CertificateProfile = &api.CertificateProfile{}
+		}
+		addTestCertificateProfile(p.CertificateProfile)
+		p.CertificateProfile.EtcdPeerCertificates = nil
+		p.CertificateProfile.EtcdPeerPrivateKeys = nil
+		for i := 0; i < p.MasterProfile.Count; i++ {
+			p.CertificateProfile.EtcdPeerCertificates = append(p.CertificateProfile.EtcdPeerCertificates, fmt.Sprintf("etcdPeerCertificate%d", i))
+			p.CertificateProfile.EtcdPeerPrivateKeys = append(p.CertificateProfile.EtcdPeerPrivateKeys, fmt.Sprintf("etcdPeerPrivateKey%d", i))
+		}
+	}
+	if o.IsOpenShift() && o.OpenShiftConfig != nil {
+		o.OpenShiftConfig.ConfigBundles = map[string][]byte{
+			"master":    []byte("masterBundle"),
+			"bootstrap": []byte("bootstrapBundle"),
+		}
+	}
+}
+
+// extensionsTransport serves the files under DefaultExtensionsRootURL from the repository,
+// so that the golden files of the examples with extensions do not depend on the network
+type extensionsTransport struct{}
+
+func (extensionsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := *req.URL
+	u.RawQuery = ""
+	response := &http.Response{
+		Status:     "404 Not Found",
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}
+	if !strings.HasPrefix(u.String(), DefaultExtensionsRootURL) {
+		return response, nil
+	}
+	b, err := ioutil.ReadFile(filepath.Join(RepoDir, filepath.FromSlash(strings.TrimPrefix(u.String(), DefaultExtensionsRootURL))))
+	if os.IsNotExist(err) {
+		return response, nil
+	} else if err != nil {
+		return nil, err
+	}
+	response.Status = "200 OK"
+	response.StatusCode = http.StatusOK
+	response.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return response, nil
+}
+
+// firstDifference returns the first line where expected and generated differ
+func firstDifference(expected, generated string) string {
+	e, g := strings.Split(expected, "\n"), strings.Split(generated, "\n")
+	for i := 0; i < len(e) && i < len(g); i++ {
+		if e[i] != g[i] {
+			return fmt.Sprintf("line %d is %q, expected %q", i+1, g[i], e[i])
+		}
+	}
+	return fmt.Sprintf("%d lines, expected %d", len(g), len(e))
+}
@@ -108,7 +108,7 @@ func getParameters(cs *api.ContainerService, generatorCode string, acsengineVers
 	// Kubernetes Parameters
 	if properties.OrchestratorProfile.IsKubernetes() ||
 		properties.OrchestratorProfile.IsOpenShift() {
-		assignKubernetesParameters(properties, parametersMap, cloudSpecConfig, generatorCode)
+		assignKubernetesParameters(properties, parametersMap, cloudSpecConfig, generatorCode, cs.SecretSource())
 	}
 
 	if strings.HasPrefix(properties.OrchestratorProfile.OrchestratorType, api.DCOS) {
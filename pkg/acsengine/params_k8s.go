@@ -5,10 +5,8 @@ package acsengine
 
 import (
 	"fmt"
-	"math/rand"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/Azure/acs-engine/pkg/api"
 	"github.com/Azure/acs-engine/pkg/api/common"
@@ -16,7 +14,7 @@ import (
 )
 
 func assignKubernetesParameters(properties *api.Properties, parametersMap paramsMap,
-	cloudSpecConfig api.AzureEnvironmentSpecConfig, generatorCode string) {
+	cloudSpecConfig api.AzureEnvironmentSpecConfig, generatorCode string, source *helpers.SecretSource) {
 	addValue(parametersMap, "generatorCode", generatorCode)
 
 	orchestratorProfile := properties.OrchestratorProfile
@@ -77,8 +75,7 @@ func assignKubernetesParameters(properties *api.Properties, parametersMap params
 				addValue(parametersMap, "kubernetesClusterAutoscalerEnabled", false)
 			}
 			if kubernetesConfig.LoadBalancerSku == "Standard" {
-				random := rand.New(rand.NewSource(time.Now().UnixNano()))
-				elbsvcName := random.Int()
+				elbsvcName := source.Int("kuberneteselbsvcname")
 				addValue(parametersMap, "kuberneteselbsvcname", fmt.Sprintf("%d", elbsvcName))
 			}
 			if common.IsKubernetesVersionGe(k8sVersion, "1.12.0") {
@@ -113,7 +110,7 @@ func assignKubernetesParameters(properties *api.Properties, parametersMap params
 			addValue(parametersMap, "etcdDownloadURLBase", cloudSpecConfig.KubernetesSpecConfig.EtcdDownloadURLBase)
 			addValue(parametersMap, "etcdVersion", kubernetesConfig.EtcdVersion)
 			addValue(parametersMap, "etcdDiskSizeGB", kubernetesConfig.EtcdDiskSizeGB)
-			addValue(parametersMap, "etcdEncryptionKey", kubernetesConfig.EtcdEncryptionKey)
+			addSecret(parametersMap, "etcdEncryptionKey", kubernetesConfig.EtcdEncryptionKey, false)
 			if kubernetesConfig.PrivateJumpboxProvision() {
 				addValue(parametersMap, "jumpboxVMName", kubernetesConfig.PrivateCluster.JumpboxProfile.Name)
 				addValue(parametersMap, "jumpboxVMSize", kubernetesConfig.PrivateCluster.JumpboxProfile.VMSize)
@@ -91,6 +91,16 @@ func (t *TemplateGenerator) GenerateTemplate(containerService *api.ContainerServ
 		return templateRaw, parametersRaw, errors.New("Invalid distro")
 	}
 
+	if err = containerService.ValidateAddons(); err != nil {
+		return templateRaw, parametersRaw, err
+	}
+	// render the addons before the template for their errors not to be wrapped in template errors
+	if properties.OrchestratorProfile.IsKubernetes() {
+		if _, err = RenderAddons(containerService); err != nil {
+			return templateRaw, parametersRaw, err
+		}
+	}
+
 	var b bytes.Buffer
 	if err = templ.ExecuteTemplate(&b, baseFile, properties); err != nil {
 		return templateRaw, parametersRaw, err
@@ -101,6 +111,9 @@ func (t *TemplateGenerator) GenerateTemplate(containerService *api.ContainerServ
 	if parametersMap, err = getParameters(containerService, generatorCode, acsengineVersion); err != nil {
 		return templateRaw, parametersRaw, err
 	}
+	if err = validateCustomDataSize(templateRaw, parametersMap); err != nil {
+		return templateRaw, parametersRaw, err
+	}
 
 	var parameterBytes []byte
 	if parameterBytes, err = helpers.JSONMarshal(parametersMap, false); err != nil {
@@ -157,7 +170,7 @@ func (t *TemplateGenerator) prepareTemplateFiles(properties *api.Properties) ([]
 	return files, baseFile, nil
 }
 
-func (t *TemplateGenerator) getMasterCustomData(cs *api.ContainerService, textFilename string, profile *api.Properties) string {
+func (t *TemplateGenerator) getMasterCustomData(cs *api.ContainerService, textFilename string, profile *api.Properties) (string, error) {
 	str, e := t.getSingleLineForTemplate(textFilename, cs, profile)
 	if e != nil {
 		panic(e)
@@ -196,12 +209,15 @@ func (t *TemplateGenerator) getMasterCustomData(cs *api.ContainerService, textFi
 		customFilesReader,
 		"MASTER_CUSTOM_FILES_PLACEHOLDER")
 
-	addonStr := getContainerAddonsString(cs.Properties, "k8s/containeraddons")
+	addonStr, err := getContainerAddonsString(cs, "k8s/containeraddons")
+	if err != nil {
+		return "", err
+	}
 
 	str = strings.Replace(str, "MASTER_CONTAINER_ADDONS_PLACEHOLDER", addonStr, -1)
 
 	// return the custom data
-	return fmt.Sprintf("\"customData\": \"[base64(concat('%s'))]\",", str)
+	return fmt.Sprintf("\"customData\": \"[base64(concat('%s'))]\",", str), nil
 }
 
 // getTemplateFuncMap returns all functions used in template generation
@@ -244,8 +260,8 @@ func (t *TemplateGenerator) getTemplateFuncMap(cs *api.ContainerService) templat
 				buf.WriteString(fmt.Sprintf(",accelerator=%s", accelerator))
 			}
 			buf.WriteString(fmt.Sprintf(",kubernetes.azure.com/cluster=%s", rg))
-			for k, v := range profile.CustomNodeLabels {
-				buf.WriteString(fmt.Sprintf(",%s=%s", k, v))
+			for _, k := range sortedKeys(profile.CustomNodeLabels) {
+				buf.WriteString(fmt.Sprintf(",%s=%s", k, profile.CustomNodeLabels[k]))
 			}
 			return buf.String()
 		},
@@ -560,9 +576,8 @@ func (t *TemplateGenerator) getTemplateFuncMap(cs *api.ContainerService) templat
 		"GetDefaultInternalLbStaticIPOffset": func() int {
 			return DefaultInternalLbStaticIPOffset
 		},
-		"GetKubernetesMasterCustomData": func(profile *api.Properties) string {
-			str := t.getMasterCustomData(cs, kubernetesMasterCustomDataYaml, profile)
-			return str
+		"GetKubernetesMasterCustomData": func(profile *api.Properties) (string, error) {
+			return t.getMasterCustomData(cs, kubernetesMasterCustomDataYaml, profile)
 		},
 		"GetKubernetesAgentCustomData": func(profile *api.AgentPoolProfile) string {
 			str, e := t.getSingleLineForTemplate(kubernetesAgentCustomDataYaml, cs, profile)
@@ -4,176 +4,522 @@
 package transform
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"os"
-	"regexp"
+	"reflect"
 	"strconv"
+	"strings"
 
-	"github.com/Jeffail/gabs"
+	"github.com/Azure/acs-engine/pkg/api/vlabs"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
-// APIModelValue represents a value in the APIModel JSON file
+// APIModelValue is an override of a value of an apimodel, such as masterProfile.count=3.
+// Its key is a path under properties made of field names, array indexes like [0] and
+// quoted map keys like ["--max-pods"].
 type APIModelValue struct {
-	stringValue   string
-	intValue      int64
-	arrayValue    bool
-	arrayIndex    int
-	arrayProperty string
-	arrayName     string
+	key  string
+	path []pathElement
+	// text is the value as written, without its quotes
+	text string
+	// quoted values and values read from files are always strings
+	quoted   bool
+	fromFile bool
+	// append adds the value to the array at path, for key+=value
+	append bool
 }
 
-// MapValues converts an arraw of rwa ApiModel values (like ["masterProfile.count=4","linuxProfile.adminUsername=admin"]) to a map
-func MapValues(m map[string]APIModelValue, setFlagValues []string) {
-	if len(setFlagValues) == 0 {
-		return
-	}
-
-	// regex to find array[index].property pattern in the key, like linuxProfile.ssh.publicKeys[0].keyData
-	re := regexp.MustCompile(`(.*?)\[(.*?)\]\.(.*?)$`)
+type pathElement struct {
+	name    string
+	index   int
+	isIndex bool
+}
 
+// MapValues parses the values of --set flags, like ["masterProfile.count=4","linuxProfile.adminUsername=admin"].
+// Each flag can hold several comma separated values.
+func MapValues(setFlagValues []string) ([]APIModelValue, error) {
+	values := []APIModelValue{}
 	for _, setFlagValue := range setFlagValues {
-		kvpMap := parseKeyValuePairs(setFlagValue)
-		for key, keyValue := range kvpMap {
-			flagValue := APIModelValue{}
-			// try to parse the value as integer or fallback to string
-			if keyValueAsInteger, err := strconv.ParseInt(keyValue, 10, 64); err == nil {
-				flagValue.intValue = keyValueAsInteger
-			} else {
-				flagValue.stringValue = keyValue
-			}
-
-			// check if the key is an array property
-			keyArrayMatch := re.FindStringSubmatch(key)
-
-			// it's an array
-			if keyArrayMatch != nil {
-				i, err := strconv.ParseInt(keyArrayMatch[2], 10, 32)
-				if err != nil {
-					log.Warnln(fmt.Sprintf("array index is not specified for property %s", key))
-				} else {
-					arrayIndex := int(i)
-					flagValue.arrayValue = true
-					flagValue.arrayName = keyArrayMatch[1]
-					flagValue.arrayIndex = arrayIndex
-					flagValue.arrayProperty = keyArrayMatch[3]
-					m[key] = flagValue
-				}
-			} else {
-				m[key] = flagValue
+		log.Debugln(fmt.Sprintf("parsing --set flag key/value pairs from %s", setFlagValue))
+		v, err := parseKeyValuePairs(setFlagValue)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing --set %s", setFlagValue)
+		}
+		values = append(values, v...)
+	}
+	return values, nil
+}
+
+// MapFileValues parses the values of --set-file flags, like ["linuxProfile.ssh.publicKeys[0].keyData=~/.ssh/id_rsa.pub"],
+// and reads the files. The content of a file, without its trailing newline, is the string value of its key.
+func MapFileValues(setFileFlagValues []string) ([]APIModelValue, error) {
+	values := []APIModelValue{}
+	for _, setFileFlagValue := range setFileFlagValues {
+		v, err := parseKeyValuePairs(setFileFlagValue)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing --set-file %s", setFileFlagValue)
+		}
+		for i := range v {
+			content, err := ioutil.ReadFile(v[i].text)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error reading the file of --set-file %s", v[i].key)
 			}
+			v[i].text = strings.TrimSuffix(strings.TrimSuffix(string(content), "\n"), "\r")
+			v[i].fromFile = true
 		}
+		values = append(values, v...)
 	}
+	return values, nil
 }
 
-// MergeValuesWithAPIModel takes the path to an ApiModel JSON file, loads it and merges it with the values in the map to another temp file
-func MergeValuesWithAPIModel(apiModelPath string, m map[string]APIModelValue) (string, error) {
+// MergeValuesWithAPIModel takes the path to an ApiModel JSON file, loads it, merges the overlay files into it
+// and then sets the values, in order. The merged apimodel is written to another temp file, whose path is returned.
+func MergeValuesWithAPIModel(apiModelPath string, overlayPaths []string, values []APIModelValue) (string, error) {
 	// load the apiModel file from path
 	fileContent, err := ioutil.ReadFile(apiModelPath)
 	if err != nil {
 		return "", err
 	}
+	apiModel, err := decodeJSONObject(fileContent)
+	if err != nil {
+		return "", errors.Wrapf(err, "error parsing %s", apiModelPath)
+	}
+
+	for _, overlayPath := range overlayPaths {
+		overlayContent, err := ioutil.ReadFile(overlayPath)
+		if err != nil {
+			return "", err
+		}
+		overlay, err := decodeJSONObject(overlayContent)
+		if err != nil {
+			return "", errors.Wrapf(err, "error parsing %s", overlayPath)
+		}
+		apiModel = mergeOverlay(apiModel, overlay).(map[string]interface{})
+	}
 
-	// parse the json from file content
-	jsonObj, err := gabs.ParseJSON(fileContent)
+	// update api model definition with each value, under properties
+	for _, v := range values {
+		log.Debugln(fmt.Sprintf("--set flag value detected. Key: %s", v.key))
+		properties, err := v.set(apiModel[lookupKey(apiModel, "properties")], reflect.TypeOf(vlabs.Properties{}), v.path)
+		if err != nil {
+			return "", errors.Wrapf(err, "error setting %s", v.key)
+		}
+		apiModel[lookupKey(apiModel, "properties")] = properties
+	}
+
+	b, err := json.MarshalIndent(apiModel, "", "  ")
 	if err != nil {
 		return "", err
 	}
 
-	// update api model definition with each value in the map
-	for key, flagValue := range m {
-		// working on an array
-		if flagValue.arrayValue {
-			log.Debugln(fmt.Sprintf("--set flag array value detected. Name: %s, Index: %b, PropertyName: %s", flagValue.arrayName, flagValue.arrayIndex, flagValue.arrayProperty))
-			arrayValue := jsonObj.Path(fmt.Sprint("properties.", flagValue.arrayName))
-			if flagValue.stringValue != "" {
-				arrayValue.Index(flagValue.arrayIndex).SetP(flagValue.stringValue, flagValue.arrayProperty)
-			} else {
-				arrayValue.Index(flagValue.arrayIndex).SetP(flagValue.intValue, flagValue.arrayProperty)
+	// generate a new file, only readable by its owner as it may contain secrets
+	tmpFile, err := ioutil.TempFile("", "mergedApiModel")
+	if err != nil {
+		return "", err
+	}
+	defer tmpFile.Close()
+	if _, err = tmpFile.Write(b); err != nil {
+		return "", err
+	}
+
+	return tmpFile.Name(), nil
+}
+
+// set sets the value at path under node, creating the missing objects, and returns the updated node.
+// t is the type of node in the vlabs apimodel, nil when it is not known.
+func (v *APIModelValue) set(node interface{}, t reflect.Type, path []pathElement) (interface{}, error) {
+	if len(path) == 0 {
+		if v.append {
+			array, ok := node.([]interface{})
+			if node != nil && !ok {
+				return nil, errors.New("cannot append to a value that is not an array")
 			}
-		} else {
-			if flagValue.stringValue != "" {
-				jsonObj.SetP(flagValue.stringValue, fmt.Sprint("properties.", key))
-			} else {
-				jsonObj.SetP(flagValue.intValue, fmt.Sprint("properties.", key))
+			value, err := v.value(nil, childType(t, pathElement{isIndex: true}))
+			if err != nil {
+				return nil, err
 			}
+			return append(array, value), nil
 		}
+		return v.value(node, t)
 	}
 
-	// generate a new file
-	tmpFile, err := ioutil.TempFile("", "mergedApiModel")
-	if err != nil {
-		return "", err
+	e := path[0]
+	if e.isIndex {
+		array, ok := node.([]interface{})
+		if !ok {
+			return nil, errors.Errorf("cannot index a value that is not an array with [%d]", e.index)
+		}
+		if e.index < 0 || e.index >= len(array) {
+			return nil, errors.Errorf("index [%d] is out of range of an array of %d items", e.index, len(array))
+		}
+		if len(path) == 1 && v.isNull() {
+			return append(array[:e.index], array[e.index+1:]...), nil
+		}
+		child, err := v.set(array[e.index], childType(t, e), path[1:])
+		if err != nil {
+			return nil, err
+		}
+		array[e.index] = child
+		return array, nil
 	}
 
-	tmpFileName := tmpFile.Name()
-	err = ioutil.WriteFile(tmpFileName, []byte(jsonObj.String()), os.ModeAppend)
+	object, ok := node.(map[string]interface{})
+	if node == nil {
+		object = map[string]interface{}{}
+	} else if !ok {
+		return nil, errors.Errorf("cannot set field %s of a value that is not an object", e.name)
+	}
+	name := lookupKey(object, e.name)
+	if len(path) == 1 && v.isNull() {
+		delete(object, name)
+		return object, nil
+	}
+	child, err := v.set(object[name], childType(t, e), path[1:])
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	object[name] = child
+	return object, nil
+}
 
-	return tmpFileName, nil
-}
-
-func parseKeyValuePairs(literal string) map[string]string {
-	log.Debugln(fmt.Sprintf("parsing --set flag key/value pairs from %s", literal))
-	inQuoteLiteral := false
-	inDblQuoteLiteral := false
-	inKey := true
-	kvpMap := map[string]string{}
-
-	currentKey := ""
-	currentValue := ""
-
-	for _, literalChar := range literal {
-		switch literalChar {
-		case '\'': // if we hit a ' char
-			if !inQuoteLiteral && !inDblQuoteLiteral { // and we are not already in a literal
-				inQuoteLiteral = true // start a new ' delimited literal value
-				inKey = false
-			} else if inQuoteLiteral { // we already are in a ' delimited literal value
-				inQuoteLiteral = false // stop it
-				inKey = true
-			}
-		case '"': // if we hit a " char
-			if !inDblQuoteLiteral && !inQuoteLiteral { // and we are not already in a literal
-				inDblQuoteLiteral = true // start a new " delimited literal value
-				inKey = false
-			} else if inDblQuoteLiteral { // we already are in a " delimited literal value
-				inDblQuoteLiteral = false // stop it
-				inKey = true
-			}
-		case ',': // if we hit a , char
-			if inQuoteLiteral || inDblQuoteLiteral { // we are in a literal
-				currentValue += string(literalChar)
-			} else {
-				log.Debugln(fmt.Sprintf("new key/value parsed: %s = %s", currentKey, currentValue))
-				kvpMap[currentKey] = currentValue
-				currentKey = ""
-				currentValue = ""
-				inKey = true
-			}
-		case '=': // if we hit a = char
-			if inQuoteLiteral || inDblQuoteLiteral || !inKey { // we are in a literal / value
-				currentValue += string(literalChar)
-			} else {
-				inKey = false
+// isNull tells whether the value removes its key
+func (v *APIModelValue) isNull() bool {
+	return !v.quoted && !v.fromFile && !v.append && v.text == "null"
+}
+
+// value returns the typed value replacing current. A value replacing a string, or set to a string
+// field or map of the apimodel, stays a string, so that values like "1.10" are not turned into numbers.
+func (v *APIModelValue) value(current interface{}, t reflect.Type) (interface{}, error) {
+	if v.quoted || v.fromFile {
+		return v.text, nil
+	}
+	if _, ok := current.(string); ok {
+		return v.text, nil
+	}
+	switch {
+	case v.text == "null":
+		return nil, nil
+	case t != nil && indirect(t).Kind() == reflect.String:
+		return v.text, nil
+	case v.text == "true":
+		return true, nil
+	case v.text == "false":
+		return false, nil
+	}
+	if strings.HasPrefix(v.text, "{") || strings.HasPrefix(v.text, "[") {
+		var value interface{}
+		d := json.NewDecoder(strings.NewReader(v.text))
+		d.UseNumber()
+		if err := d.Decode(&value); err != nil {
+			return nil, errors.Wrapf(err, "invalid JSON value %s", v.text)
+		}
+		if _, err := d.Token(); err != io.EOF {
+			return nil, errors.Errorf("invalid JSON value %s: unexpected data after the value", v.text)
+		}
+		return value, nil
+	}
+	// integers written as JSON would write them, so that values like "0123" stay strings
+	if n, err := strconv.ParseInt(v.text, 10, 64); err == nil && strconv.FormatInt(n, 10) == v.text {
+		return json.Number(v.text), nil
+	}
+	if _, ok := current.(json.Number); ok {
+		if _, err := strconv.ParseFloat(v.text, 64); err == nil && json.Valid([]byte(v.text)) {
+			return json.Number(v.text), nil
+		}
+	}
+	return v.text, nil
+}
+
+// childType returns the type of the element e of a value of type t, nil when it is not known
+func childType(t reflect.Type, e pathElement) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	t = indirect(t)
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if e.isIndex {
+			return t.Elem()
+		}
+	case reflect.Map:
+		if !e.isIndex {
+			return t.Elem()
+		}
+	case reflect.Struct:
+		if e.isIndex {
+			return nil
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+			if f.Anonymous && name == "" {
+				if ft := childType(f.Type, e); ft != nil {
+					return ft
+				}
+				continue
 			}
-		default: // we hit any other char
-			if inKey {
-				currentKey += string(literalChar)
-			} else {
-				currentValue += string(literalChar)
+			if name != "" && name != "-" && strings.EqualFold(name, e.name) {
+				return f.Type
 			}
 		}
 	}
+	return nil
+}
 
-	// push latest literal
-	if currentKey != "" {
-		log.Debugln(fmt.Sprintf("new key/value parsed: %s = %s", currentKey, currentValue))
-		kvpMap[currentKey] = currentValue
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
 	}
+	return t
+}
 
-	return kvpMap
+// mergeOverlay merges overlay into base. Objects are merged recursively and null removes a key.
+// Arrays of objects with a name, like agentPoolProfiles, are merged by name. Other values are replaced.
+func mergeOverlay(base, overlay interface{}) interface{} {
+	switch o := overlay.(type) {
+	case map[string]interface{}:
+		b, ok := base.(map[string]interface{})
+		if !ok {
+			return o
+		}
+		for key, value := range o {
+			name := lookupKey(b, key)
+			if value == nil {
+				delete(b, name)
+				continue
+			}
+			b[name] = mergeOverlay(b[name], value)
+		}
+		return b
+	case []interface{}:
+		b, ok := base.([]interface{})
+		if !ok || !namedObjects(b) || !namedObjects(o) {
+			return o
+		}
+		for _, item := range o {
+			name := objectName(item)
+			merged := false
+			for i := range b {
+				if objectName(b[i]) == name {
+					b[i] = mergeOverlay(b[i], item)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				b = append(b, item)
+			}
+		}
+		return b
+	}
+	return overlay
+}
+
+func namedObjects(array []interface{}) bool {
+	for _, item := range array {
+		if objectName(item) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func objectName(item interface{}) string {
+	object, ok := item.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _ := object[lookupKey(object, "name")].(string)
+	return name
+}
+
+// lookupKey returns the key of object matching name, case insensitively like the apimodel loader, or name
+func lookupKey(object map[string]interface{}, name string) string {
+	if _, ok := object[name]; ok {
+		return name
+	}
+	for key := range object {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
+
+func decodeJSONObject(data []byte) (map[string]interface{}, error) {
+	var object map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&object); err != nil {
+		return nil, err
+	}
+	if object == nil {
+		return nil, errors.New("expected a JSON object")
+	}
+	return object, nil
+}
+
+// parseKeyValuePairs parses comma separated key=value and key+=value pairs.
+// Values can be quoted with ' or " to hold commas, and JSON objects and arrays can hold commas.
+func parseKeyValuePairs(literal string) ([]APIModelValue, error) {
+	values := []APIModelValue{}
+	s := []rune(literal)
+	for i := 0; i < len(s); {
+		v := APIModelValue{}
+		keyEnd, valueStart, err := scanKey(s, i)
+		if err != nil {
+			return nil, err
+		}
+		v.key = string(s[i:keyEnd])
+		if strings.HasSuffix(v.key, "+") {
+			v.key = strings.TrimSuffix(v.key, "+")
+			v.append = true
+		}
+		if v.path, err = parsePath(v.key); err != nil {
+			return nil, err
+		}
+		i, err = v.scanValue(s, valueStart)
+		if err != nil {
+			return nil, err
+		}
+		log.Debugln(fmt.Sprintf("new key/value parsed: %s = %s", v.key, v.text))
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// scanKey returns the end of the key starting at start, and the start of its value
+func scanKey(s []rune, start int) (int, int, error) {
+	var quote rune
+	for i := start; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '\'' || s[i] == '"':
+			quote = s[i]
+		case s[i] == '=':
+			if i == start {
+				return 0, 0, errors.Errorf("missing key before = in %s", string(s[start:]))
+			}
+			return i, i + 1, nil
+		case s[i] == ',':
+			return 0, 0, errors.Errorf("missing value for key %s", string(s[start:i]))
+		}
+	}
+	return 0, 0, errors.Errorf("missing value for key %s", string(s[start:]))
+}
+
+// scanValue reads the value starting at start and returns the start of the next pair
+func (v *APIModelValue) scanValue(s []rune, start int) (int, error) {
+	var text bytes.Buffer
+	i := start
+	if i < len(s) && (s[i] == '{' || s[i] == '[') {
+		// JSON value, kept as written
+		depth := 0
+		inString := false
+		for ; i < len(s); i++ {
+			text.WriteRune(s[i])
+			switch {
+			case inString:
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					text.WriteRune(s[i])
+				} else if s[i] == '"' {
+					inString = false
+				}
+			case s[i] == '"':
+				inString = true
+			case s[i] == '{' || s[i] == '[':
+				depth++
+			case s[i] == '}' || s[i] == ']':
+				depth--
+			}
+			if depth == 0 && !inString {
+				i++
+				break
+			}
+		}
+		if depth != 0 || inString {
+			return 0, errors.Errorf("unterminated JSON value for key %s", v.key)
+		}
+	}
+	var quote rune
+	for ; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			} else {
+				text.WriteRune(s[i])
+			}
+		case s[i] == '\'' || s[i] == '"':
+			quote = s[i]
+			v.quoted = true
+		case s[i] == ',':
+			v.text = text.String()
+			return i + 1, nil
+		default:
+			text.WriteRune(s[i])
+		}
+	}
+	if quote != 0 {
+		return 0, errors.Errorf("unterminated quote in the value of key %s", v.key)
+	}
+	v.text = text.String()
+	return i, nil
+}
+
+// parsePath parses a key like agentPoolProfiles[0].name or kubernetesConfig.kubeletConfig["--max-pods"]
+func parsePath(key string) ([]pathElement, error) {
+	path := []pathElement{}
+	s := []rune(key)
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '.':
+			if i == 0 || i == len(s)-1 || s[i+1] == '.' {
+				return nil, errors.Errorf("invalid key %s: empty field name", key)
+			}
+			i++
+		case '[':
+			end := i + 1
+			if end < len(s) && (s[end] == '\'' || s[end] == '"') {
+				quote := s[end]
+				for end++; end < len(s) && s[end] != quote; end++ {
+				}
+				if end+1 >= len(s) || s[end+1] != ']' {
+					return nil, errors.Errorf("invalid key %s: unterminated map key", key)
+				}
+				path = append(path, pathElement{name: string(s[i+2 : end])})
+				i = end + 2
+				continue
+			}
+			for ; end < len(s) && s[end] != ']'; end++ {
+			}
+			if end == len(s) {
+				return nil, errors.Errorf("invalid key %s: unterminated index", key)
+			}
+			index, err := strconv.Atoi(string(s[i+1 : end]))
+			if err != nil {
+				return nil, errors.Errorf("invalid key %s: array index %s is not a number", key, string(s[i+1:end]))
+			}
+			path = append(path, pathElement{index: index, isIndex: true})
+			i = end + 1
+		default:
+			end := i
+			for ; end < len(s) && s[end] != '.' && s[end] != '['; end++ {
+			}
+			path = append(path, pathElement{name: string(s[i:end])})
+			i = end
+		}
+	}
+	if len(path) == 0 {
+		return nil, errors.Errorf("invalid key %s", key)
+	}
+	return path, nil
 }
@@ -5,6 +5,7 @@ package transform
 
 import (
 	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/Jeffail/gabs"
@@ -14,34 +15,74 @@ import (
 func TestAPIModelMergerMapValues(t *testing.T) {
 	RegisterTestingT(t)
 
-	m := make(map[string]APIModelValue)
 	values := []string{
 		"masterProfile.count=5",
 		"agentPoolProfiles[0].name=agentpool1",
 		"linuxProfile.adminUsername=admin",
 		"servicePrincipalProfile.clientId='123a1238-c6eb-4b61-9d6f-7db6f1e14123',servicePrincipalProfile.secret='=!,Test$^='",
+		`orchestratorProfile.kubernetesConfig.kubeletConfig["--max-pods"]="30"`,
+		`agentPoolProfiles[0].customNodeLabels={"a":"b","c":"d"},orchestratorProfile.kubernetesConfig.addons+={"name":"tiller"}`,
 	}
 
-	MapValues(m, values)
-	Expect(m["masterProfile.count"].intValue).To(BeIdenticalTo(int64(5)))
-	Expect(m["agentPoolProfiles[0].name"].arrayValue).To(BeTrue())
-	Expect(m["agentPoolProfiles[0].name"].arrayIndex).To(BeIdenticalTo(0))
-	Expect(m["agentPoolProfiles[0].name"].arrayProperty).To(BeIdenticalTo("name"))
-	Expect(m["agentPoolProfiles[0].name"].arrayName).To(BeIdenticalTo("agentPoolProfiles"))
-	Expect(m["agentPoolProfiles[0].name"].stringValue).To(BeIdenticalTo("agentpool1"))
-	Expect(m["linuxProfile.adminUsername"].stringValue).To(BeIdenticalTo("admin"))
-	Expect(m["servicePrincipalProfile.secret"].stringValue).To(BeIdenticalTo("=!,Test$^="))
-	Expect(m["servicePrincipalProfile.clientId"].stringValue).To(BeIdenticalTo("123a1238-c6eb-4b61-9d6f-7db6f1e14123"))
+	m, err := MapValues(values)
+	Expect(err).To(BeNil())
+	Expect(m).To(HaveLen(8))
+
+	Expect(m[0].key).To(Equal("masterProfile.count"))
+	Expect(m[0].path).To(Equal([]pathElement{{name: "masterProfile"}, {name: "count"}}))
+	Expect(m[0].text).To(Equal("5"))
+	Expect(m[0].quoted).To(BeFalse())
+
+	Expect(m[1].path).To(Equal([]pathElement{{name: "agentPoolProfiles"}, {index: 0, isIndex: true}, {name: "name"}}))
+	Expect(m[1].text).To(Equal("agentpool1"))
+
+	Expect(m[2].text).To(Equal("admin"))
+	Expect(m[3].text).To(Equal("123a1238-c6eb-4b61-9d6f-7db6f1e14123"))
+	Expect(m[4].key).To(Equal("servicePrincipalProfile.secret"))
+	Expect(m[4].text).To(Equal("=!,Test$^="))
+	Expect(m[4].quoted).To(BeTrue())
+
+	Expect(m[5].path).To(Equal([]pathElement{{name: "orchestratorProfile"}, {name: "kubernetesConfig"}, {name: "kubeletConfig"}, {name: "--max-pods"}}))
+	Expect(m[5].text).To(Equal("30"))
+	Expect(m[5].quoted).To(BeTrue())
+
+	Expect(m[6].text).To(Equal(`{"a":"b","c":"d"}`))
+	Expect(m[7].key).To(Equal("orchestratorProfile.kubernetesConfig.addons"))
+	Expect(m[7].append).To(BeTrue())
+	Expect(m[7].text).To(Equal(`{"name":"tiller"}`))
+}
+
+func TestAPIModelMergerMapValuesErrors(t *testing.T) {
+	RegisterTestingT(t)
+
+	for _, value := range []string{
+		"masterProfile.count",
+		"=5",
+		"masterProfile..count=5",
+		"agentPoolProfiles[a].count=5",
+		`kubeletConfig["--max-pods=30`,
+		"linuxProfile.adminUsername='admin",
+		`agentPoolProfiles[0].customNodeLabels={"a":"b"`,
+	} {
+		_, err := MapValues([]string{value})
+		Expect(err).NotTo(BeNil(), value)
+	}
 }
 
 func TestMergeValuesWithAPIModel(t *testing.T) {
 	RegisterTestingT(t)
 
-	m := make(map[string]APIModelValue)
 	values := []string{"masterProfile.count=5", "agentPoolProfiles[0].name=agentpool1", "linuxProfile.adminUsername=admin"}
 
-	MapValues(m, values)
-	tmpFile, _ := MergeValuesWithAPIModel("../testdata/simple/kubernetes.json", m)
+	m, err := MapValues(values)
+	Expect(err).To(BeNil())
+	tmpFile, err := MergeValuesWithAPIModel("../testdata/simple/kubernetes.json", nil, m)
+	Expect(err).To(BeNil())
+	defer os.Remove(tmpFile)
+
+	info, err := os.Stat(tmpFile)
+	Expect(err).To(BeNil())
+	Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
 
 	jsonFileContent, err := ioutil.ReadFile(tmpFile)
 	Expect(err).To(BeNil())
@@ -58,3 +99,145 @@ func TestMergeValuesWithAPIModel(t *testing.T) {
 	agentPoolProfileName := jsonAPIModel.Path("properties.agentPoolProfiles").Index(0).Path("name").Data().(string)
 	Expect(agentPoolProfileName).To(BeIdenticalTo("agentpool1"))
 }
+
+func TestMergeTypedValuesWithAPIModel(t *testing.T) {
+	RegisterTestingT(t)
+
+	m, err := MapValues([]string{
+		"orchestratorProfile.kubernetesConfig.enableRbac=false",
+		"orchestratorProfile.orchestratorRelease=1.10",
+		"servicePrincipalProfile.clientId=12345",
+		"masterProfile.dnsPrefix='007'",
+		`orchestratorProfile.kubernetesConfig.kubeletConfig["--max-pods"]="30"`,
+		`orchestratorProfile.kubernetesConfig.kubeletConfig["--node.status"]=10s`,
+		`orchestratorProfile.kubernetesConfig.kubeletConfig["--image-gc-high-threshold"]=85`,
+		"agentPoolProfiles[0].customNodeLabels.tier=1,orchestratorProfile.kubernetesConfig.clusterSubnet=10",
+		"masterProfile.count=3",
+		`orchestratorProfile.kubernetesConfig.addons+={"name":"tiller","enabled":true}`,
+		"linuxProfile.ssh.publicKeys+={\"keyData\":\"ssh-rsa SECONDKEY\"}",
+		"agentPoolProfiles[1]=null,certificateProfile=null",
+		"MASTERPROFILE.VMSIZE=Standard_D4_v2",
+	})
+	Expect(err).To(BeNil())
+	tmpFile, err := MergeValuesWithAPIModel("../testdata/simple/kubernetes.json", nil, m)
+	Expect(err).To(BeNil())
+	defer os.Remove(tmpFile)
+
+	jsonAPIModel, err := gabs.ParseJSONFile(tmpFile)
+	Expect(err).To(BeNil())
+
+	Expect(jsonAPIModel.Path("properties.orchestratorProfile.kubernetesConfig.enableRbac").Data()).To(BeIdenticalTo(false))
+	Expect(jsonAPIModel.Path("properties.orchestratorProfile.orchestratorRelease").Data()).To(BeIdenticalTo("1.10"))
+	// a string stays a string
+	Expect(jsonAPIModel.Path("properties.servicePrincipalProfile.clientId").Data()).To(BeIdenticalTo("12345"))
+	Expect(jsonAPIModel.Path("properties.masterProfile.dnsPrefix").Data()).To(BeIdenticalTo("007"))
+	Expect(jsonAPIModel.Path("properties.masterProfile.vmSize").Data()).To(BeIdenticalTo("Standard_D4_v2"))
+
+	kubeletConfig := jsonAPIModel.Path("properties.orchestratorProfile.kubernetesConfig.kubeletConfig").Data().(map[string]interface{})
+	// the values of string maps and new string fields are strings too
+	Expect(kubeletConfig).To(Equal(map[string]interface{}{"--max-pods": "30", "--node.status": "10s", "--image-gc-high-threshold": "85"}))
+	Expect(jsonAPIModel.Path("properties.agentPoolProfiles.customNodeLabels.tier").Data()).To(Equal([]interface{}{"1"}))
+	Expect(jsonAPIModel.Path("properties.orchestratorProfile.kubernetesConfig.clusterSubnet").Data()).To(BeIdenticalTo("10"))
+	Expect(jsonAPIModel.Path("properties.masterProfile.count").Data()).To(BeIdenticalTo(float64(3)))
+
+	addons, err := jsonAPIModel.Path("properties.orchestratorProfile.kubernetesConfig.addons").Children()
+	Expect(err).To(BeNil())
+	Expect(addons).To(HaveLen(1))
+	Expect(addons[0].Path("enabled").Data()).To(BeIdenticalTo(true))
+
+	publicKeys, err := jsonAPIModel.Path("properties.linuxProfile.ssh.publicKeys").Children()
+	Expect(err).To(BeNil())
+	Expect(publicKeys).To(HaveLen(2))
+	Expect(publicKeys[1].Path("keyData").Data()).To(BeIdenticalTo("ssh-rsa SECONDKEY"))
+
+	agentPoolProfiles, err := jsonAPIModel.Path("properties.agentPoolProfiles").Children()
+	Expect(err).To(BeNil())
+	Expect(agentPoolProfiles).To(HaveLen(1))
+	Expect(jsonAPIModel.ExistsP("properties.certificateProfile")).To(BeFalse())
+}
+
+func TestMergeValuesWithAPIModelErrors(t *testing.T) {
+	RegisterTestingT(t)
+
+	for _, value := range []string{
+		"agentPoolProfiles[2].count=1",
+		"masterProfile.count[0]=1",
+		"masterProfile.count.value=1",
+		"masterProfile+=1",
+		"masterProfile.extra={\"a\":1}}",
+	} {
+		m, err := MapValues([]string{value})
+		Expect(err).To(BeNil())
+		_, err = MergeValuesWithAPIModel("../testdata/simple/kubernetes.json", nil, m)
+		Expect(err).NotTo(BeNil(), value)
+	}
+}
+
+func TestMergeFileValuesWithAPIModel(t *testing.T) {
+	RegisterTestingT(t)
+
+	keyFile, err := ioutil.TempFile("", "publickey")
+	Expect(err).To(BeNil())
+	defer os.Remove(keyFile.Name())
+	keyFile.WriteString("ssh-rsa FILEKEY user@host\n")
+	keyFile.Close()
+
+	m, err := MapFileValues([]string{"linuxProfile.ssh.publicKeys[0].keyData=" + keyFile.Name()})
+	Expect(err).To(BeNil())
+	tmpFile, err := MergeValuesWithAPIModel("../testdata/simple/kubernetes.json", nil, m)
+	Expect(err).To(BeNil())
+	defer os.Remove(tmpFile)
+
+	jsonAPIModel, err := gabs.ParseJSONFile(tmpFile)
+	Expect(err).To(BeNil())
+	keyData := jsonAPIModel.Path("properties.linuxProfile.ssh.publicKeys").Index(0).Path("keyData").Data()
+	Expect(keyData).To(BeIdenticalTo("ssh-rsa FILEKEY user@host"))
+
+	_, err = MapFileValues([]string{"linuxProfile.ssh.publicKeys[0].keyData=/does/not/exist"})
+	Expect(err).NotTo(BeNil())
+}
+
+func TestMergeOverlaysWithAPIModel(t *testing.T) {
+	RegisterTestingT(t)
+
+	overlay, err := ioutil.TempFile("", "overlay")
+	Expect(err).To(BeNil())
+	defer os.Remove(overlay.Name())
+	overlay.WriteString(`{
+  "properties": {
+    "masterProfile": {"count": 3},
+    "agentPoolProfiles": [
+      {"name": "agentpool2", "count": 5},
+      {"name": "agentpool3", "count": 1, "vmSize": "Standard_D2_v2"}
+    ],
+    "certificateProfile": null,
+    "linuxProfile": {"ssh": {"publicKeys": [{"keyData": "ssh-rsa OVERLAY"}]}}
+  }
+}`)
+	overlay.Close()
+
+	m, err := MapValues([]string{"agentPoolProfiles[2].count=2"})
+	Expect(err).To(BeNil())
+	tmpFile, err := MergeValuesWithAPIModel("../testdata/simple/kubernetes.json", []string{overlay.Name()}, m)
+	Expect(err).To(BeNil())
+	defer os.Remove(tmpFile)
+
+	jsonAPIModel, err := gabs.ParseJSONFile(tmpFile)
+	Expect(err).To(BeNil())
+	Expect(jsonAPIModel.Path("properties.masterProfile.count").Data()).To(BeIdenticalTo(float64(3)))
+	Expect(jsonAPIModel.Path("properties.masterProfile.dnsPrefix").Data()).To(BeIdenticalTo("masterdns1"))
+	Expect(jsonAPIModel.ExistsP("properties.certificateProfile")).To(BeFalse())
+
+	agentPoolProfiles, err := jsonAPIModel.Path("properties.agentPoolProfiles").Children()
+	Expect(err).To(BeNil())
+	Expect(agentPoolProfiles).To(HaveLen(3))
+	Expect(agentPoolProfiles[1].Path("count").Data()).To(BeIdenticalTo(float64(5)))
+	Expect(agentPoolProfiles[1].Path("vmSize").Data()).To(BeIdenticalTo("Standard_D2_v2"))
+	// --set values apply after the overlays
+	Expect(agentPoolProfiles[2].Path("count").Data()).To(BeIdenticalTo(float64(2)))
+
+	publicKeys, err := jsonAPIModel.Path("properties.linuxProfile.ssh.publicKeys").Children()
+	Expect(err).To(BeNil())
+	Expect(publicKeys).To(HaveLen(1))
+	Expect(publicKeys[0].Path("keyData").Data()).To(BeIdenticalTo("ssh-rsa OVERLAY"))
+}
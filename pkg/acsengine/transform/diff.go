@@ -0,0 +1,568 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package transform
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	parametersFieldName = "parameters"
+	variablesFieldName  = "variables"
+	valueFieldName      = "value"
+	defaultValueField   = "defaultValue"
+
+	// redactedValue replaces the values of securestring and secureObject parameters in a diff
+	redactedValue = "<redacted>"
+
+	// diffContextLines is the number of unchanged lines shown around each decoded text change
+	diffContextLines = 3
+	// minEncodedBlobLength is the shortest string considered when looking for base64 encoded blobs
+	minEncodedBlobLength = 64
+)
+
+// ChangeType describes how an element of a template differs between two deployments
+type ChangeType string
+
+const (
+	// ChangeTypeAdded is an element only present in the new deployment
+	ChangeTypeAdded ChangeType = "Added"
+	// ChangeTypeRemoved is an element only present in the existing deployment
+	ChangeTypeRemoved ChangeType = "Removed"
+	// ChangeTypeModified is an element present in both deployments with different values
+	ChangeTypeModified ChangeType = "Modified"
+)
+
+// PropertyChange is a single changed value, addressed by its path within the parent element
+type PropertyChange struct {
+	Path     string      `json:"path"`
+	Change   ChangeType  `json:"change"`
+	OldValue interface{} `json:"oldValue,omitempty"`
+	NewValue interface{} `json:"newValue,omitempty"`
+	// TextDiff holds a line based diff when both values decode to text,
+	// such as base64 custom data or gzipped provisioning scripts
+	TextDiff []string `json:"textDiff,omitempty"`
+}
+
+// ResourceDiff describes the changes to one ARM resource, keyed by its type and name
+type ResourceDiff struct {
+	Type       string           `json:"type"`
+	Name       string           `json:"name"`
+	Change     ChangeType       `json:"change"`
+	Properties []PropertyChange `json:"properties,omitempty"`
+}
+
+// TemplateDiff is the set of differences between two ARM templates and their parameters
+type TemplateDiff struct {
+	Parameters []PropertyChange `json:"parameters,omitempty"`
+	Variables  []PropertyChange `json:"variables,omitempty"`
+	Resources  []ResourceDiff   `json:"resources,omitempty"`
+	Outputs    []PropertyChange `json:"outputs,omitempty"`
+}
+
+// DiffTemplates compares an existing ARM template and parameters with a new template and parameters.
+// Parameters maps are of the form produced by GenerateTemplate, { "name": { "value": ... } }.
+func DiffTemplates(oldTemplate, oldParameters, newTemplate, newParameters map[string]interface{}) *TemplateDiff {
+	d := &TemplateDiff{}
+	d.Parameters = diffMaps(
+		effectiveParameters(oldTemplate, oldParameters),
+		effectiveParameters(newTemplate, newParameters))
+	redactSecureParameters(d.Parameters, oldTemplate, newTemplate)
+	d.Variables = diffMaps(
+		getMap(oldTemplate, variablesFieldName),
+		getMap(newTemplate, variablesFieldName))
+	d.Outputs = diffMaps(
+		getMap(oldTemplate, outputsFieldName),
+		getMap(newTemplate, outputsFieldName))
+	d.Resources = diffResources(
+		getSlice(oldTemplate, resourcesFieldName),
+		getSlice(newTemplate, resourcesFieldName))
+	return d
+}
+
+// IsEmpty returns true if the templates compared were equivalent
+func (d *TemplateDiff) IsEmpty() bool {
+	return len(d.Parameters) == 0 && len(d.Variables) == 0 && len(d.Resources) == 0 && len(d.Outputs) == 0
+}
+
+// Write prints a human readable report of the differences
+func (d *TemplateDiff) Write(w io.Writer) error {
+	var buf bytes.Buffer
+	if d.IsEmpty() {
+		buf.WriteString("No changes\n")
+	}
+	writeSection(&buf, "Parameters", d.Parameters)
+	writeSection(&buf, "Variables", d.Variables)
+	if len(d.Resources) > 0 {
+		buf.WriteString("Resources:\n")
+		for _, r := range d.Resources {
+			fmt.Fprintf(&buf, "  %s %s %s\n", changeSymbol(r.Change), r.Type, r.Name)
+			for _, p := range r.Properties {
+				writeChange(&buf, "      ", p)
+			}
+		}
+	}
+	writeSection(&buf, "Outputs", d.Outputs)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeSection(buf *bytes.Buffer, title string, changes []PropertyChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, "%s:\n", title)
+	for _, c := range changes {
+		writeChange(buf, "  ", c)
+	}
+}
+
+func writeChange(buf *bytes.Buffer, indent string, c PropertyChange) {
+	switch {
+	case len(c.TextDiff) > 0:
+		fmt.Fprintf(buf, "%s%s %s:\n", indent, changeSymbol(c.Change), c.Path)
+		for _, line := range c.TextDiff {
+			fmt.Fprintf(buf, "%s    %s\n", indent, line)
+		}
+	case c.Change == ChangeTypeAdded:
+		fmt.Fprintf(buf, "%s+ %s: %s\n", indent, c.Path, formatValue(c.NewValue))
+	case c.Change == ChangeTypeRemoved:
+		fmt.Fprintf(buf, "%s- %s: %s\n", indent, c.Path, formatValue(c.OldValue))
+	default:
+		fmt.Fprintf(buf, "%s~ %s: %s => %s\n", indent, c.Path, formatValue(c.OldValue), formatValue(c.NewValue))
+	}
+}
+
+func changeSymbol(c ChangeType) string {
+	switch c {
+	case ChangeTypeAdded:
+		return "+"
+	case ChangeTypeRemoved:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+func formatValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// effectiveParameters resolves the value of each template parameter, preferring the
+// parameters file value over the template default value
+func effectiveParameters(template, parameters map[string]interface{}) map[string]interface{} {
+	values := map[string]interface{}{}
+	for name, definition := range getMap(template, parametersFieldName) {
+		if m, ok := definition.(map[string]interface{}); ok {
+			if v, ok := m[defaultValueField]; ok {
+				values[name] = v
+			}
+		}
+	}
+	for name, parameter := range parameters {
+		if m, ok := parameter.(map[string]interface{}); ok {
+			if v, ok := m[valueFieldName]; ok {
+				values[name] = v
+				continue
+			}
+		}
+		values[name] = parameter
+	}
+	return values
+}
+
+// redactSecureParameters hides the values of parameters declared as secure in either template
+func redactSecureParameters(changes []PropertyChange, templates ...map[string]interface{}) {
+	secure := map[string]bool{}
+	for _, template := range templates {
+		for name, definition := range getMap(template, parametersFieldName) {
+			if m, ok := definition.(map[string]interface{}); ok {
+				if t, ok := m[typeFieldName].(string); ok && strings.HasPrefix(strings.ToLower(t), "secure") {
+					secure[name] = true
+				}
+			}
+		}
+	}
+	for i := range changes {
+		name := strings.SplitN(strings.SplitN(changes[i].Path, ".", 2)[0], "[", 2)[0]
+		if !secure[name] {
+			continue
+		}
+		if changes[i].Change != ChangeTypeAdded {
+			changes[i].OldValue = redactedValue
+		}
+		if changes[i].Change != ChangeTypeRemoved {
+			changes[i].NewValue = redactedValue
+		}
+		changes[i].TextDiff = nil
+	}
+}
+
+func diffResources(oldResources, newResources []interface{}) []ResourceDiff {
+	oldByKey, oldKeys := indexResources(oldResources)
+	newByKey, newKeys := indexResources(newResources)
+
+	diffs := []ResourceDiff{}
+	for _, key := range oldKeys {
+		oldResource := oldByKey[key]
+		resourceType, resourceName := resourceTypeAndName(oldResource)
+		newResource, ok := newByKey[key]
+		if !ok {
+			diffs = append(diffs, ResourceDiff{Type: resourceType, Name: resourceName, Change: ChangeTypeRemoved})
+			continue
+		}
+		if changes := diffValues("", oldResource, newResource); len(changes) > 0 {
+			diffs = append(diffs, ResourceDiff{Type: resourceType, Name: resourceName, Change: ChangeTypeModified, Properties: changes})
+		}
+	}
+	for _, key := range newKeys {
+		if _, ok := oldByKey[key]; ok {
+			continue
+		}
+		resourceType, resourceName := resourceTypeAndName(newByKey[key])
+		diffs = append(diffs, ResourceDiff{Type: resourceType, Name: resourceName, Change: ChangeTypeAdded})
+	}
+	return diffs
+}
+
+// indexResources keys resources by type and name, disambiguating duplicates by their order
+func indexResources(resources []interface{}) (map[string]map[string]interface{}, []string) {
+	byKey := map[string]map[string]interface{}{}
+	keys := []string{}
+	for _, resource := range resources {
+		resourceMap, ok := resource.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		resourceType, resourceName := resourceTypeAndName(resourceMap)
+		key := resourceType + "/" + resourceName
+		for i := 2; byKey[key] != nil; i++ {
+			key = fmt.Sprintf("%s/%s#%d", resourceType, resourceName, i)
+		}
+		byKey[key] = resourceMap
+		keys = append(keys, key)
+	}
+	return byKey, keys
+}
+
+func resourceTypeAndName(resource map[string]interface{}) (string, string) {
+	resourceType, _ := resource[typeFieldName].(string)
+	resourceName, _ := resource[nameFieldName].(string)
+	return resourceType, resourceName
+}
+
+// DiffJSON returns the changes between two decoded JSON documents, addressed by their
+// path from the root of the documents, such as properties.agentPoolProfiles[0].count
+func DiffJSON(oldValue, newValue interface{}) []PropertyChange {
+	return diffValues("", oldValue, newValue)
+}
+
+func diffMaps(oldMap, newMap map[string]interface{}) []PropertyChange {
+	return diffValues("", oldMap, newMap)
+}
+
+func diffValues(path string, oldValue, newValue interface{}) []PropertyChange {
+	if reflect.DeepEqual(oldValue, newValue) {
+		return nil
+	}
+
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		changes := []PropertyChange{}
+		for _, key := range unionKeys(oldMap, newMap) {
+			childPath := joinPath(path, key)
+			o, inOld := oldMap[key]
+			n, inNew := newMap[key]
+			switch {
+			case !inOld:
+				changes = append(changes, PropertyChange{Path: childPath, Change: ChangeTypeAdded, NewValue: n})
+			case !inNew:
+				changes = append(changes, PropertyChange{Path: childPath, Change: ChangeTypeRemoved, OldValue: o})
+			default:
+				changes = append(changes, diffValues(childPath, o, n)...)
+			}
+		}
+		return changes
+	}
+
+	oldSlice, oldIsSlice := oldValue.([]interface{})
+	newSlice, newIsSlice := newValue.([]interface{})
+	if oldIsSlice && newIsSlice {
+		changes := []PropertyChange{}
+		for i := 0; i < len(oldSlice) || i < len(newSlice); i++ {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(oldSlice):
+				changes = append(changes, PropertyChange{Path: childPath, Change: ChangeTypeAdded, NewValue: newSlice[i]})
+			case i >= len(newSlice):
+				changes = append(changes, PropertyChange{Path: childPath, Change: ChangeTypeRemoved, OldValue: oldSlice[i]})
+			default:
+				changes = append(changes, diffValues(childPath, oldSlice[i], newSlice[i])...)
+			}
+		}
+		return changes
+	}
+
+	change := PropertyChange{Path: path, Change: ChangeTypeModified, OldValue: oldValue, NewValue: newValue}
+	oldString, oldIsString := oldValue.(string)
+	newString, newIsString := newValue.(string)
+	if oldIsString && newIsString {
+		oldText, oldDecoded := decodeText(oldString)
+		newText, newDecoded := decodeText(newString)
+		if oldDecoded && newDecoded {
+			change.OldValue = nil
+			change.NewValue = nil
+			change.TextDiff = DiffText(oldText, newText)
+		}
+	}
+	return []PropertyChange{change}
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := []string{}
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// joinPath appends key to path, quoted in brackets when it is not an identifier,
+// such as kubeletConfig["--max-pods"], the way --set addresses it
+func joinPath(path, key string) string {
+	if !identifierRegex.MatchString(key) {
+		return fmt.Sprintf("%s[%s]", path, strconv.Quote(key))
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func getMap(m map[string]interface{}, key string) map[string]interface{} {
+	if v, ok := m[key].(map[string]interface{}); ok {
+		return v
+	}
+	return map[string]interface{}{}
+}
+
+func getSlice(m map[string]interface{}, key string) []interface{} {
+	if v, ok := m[key].([]interface{}); ok {
+		return v
+	}
+	return []interface{}{}
+}
+
+// decodeText returns the text hidden inside an encoded template value. It understands
+// the "[base64(concat(...))]" expressions used for custom data, and plain base64 that
+// may additionally be gzipped, as used for the provisioning scripts.
+func decodeText(s string) (string, bool) {
+	if text, ok := decodeBase64ConcatExpression(s); ok {
+		return text, true
+	}
+	return decodeBase64Blob(s)
+}
+
+func decodeBase64ConcatExpression(s string) (string, bool) {
+	const prefix = "[base64(concat("
+	const suffix = "))]"
+	if !strings.HasPrefix(s, prefix) || !strings.HasSuffix(s, suffix) {
+		return "", false
+	}
+	args, ok := splitARMArguments(s[len(prefix) : len(s)-len(suffix)])
+	if !ok {
+		return "", false
+	}
+	var buf bytes.Buffer
+	for _, arg := range args {
+		if len(arg) >= 2 && arg[0] == '\'' && arg[len(arg)-1] == '\'' {
+			buf.WriteString(strings.Replace(arg[1:len(arg)-1], "''", "'", -1))
+		} else {
+			// keep non literal arguments visible, so that a changed variable reference is reported
+			buf.WriteString("{{" + arg + "}}")
+		}
+	}
+	return buf.String(), true
+}
+
+// splitARMArguments splits the top level, comma separated arguments of an ARM template function
+func splitARMArguments(s string) ([]string, bool) {
+	args := []string{}
+	depth := 0
+	inLiteral := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inLiteral:
+			if c == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					i++
+				} else {
+					inLiteral = false
+				}
+			}
+		case c == '\'':
+			inLiteral = true
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if inLiteral || depth != 0 {
+		return nil, false
+	}
+	return append(args, strings.TrimSpace(s[start:])), true
+}
+
+func decodeBase64Blob(s string) (string, bool) {
+	if len(s) < minEncodedBlobLength {
+		return "", false
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", false
+	}
+	if r, err := gzip.NewReader(bytes.NewReader(b)); err == nil {
+		if unzipped, err := ioutil.ReadAll(r); err == nil {
+			b = unzipped
+		}
+	}
+	if !utf8.Valid(b) {
+		return "", false
+	}
+	return string(b), true
+}
+
+// DiffText returns a unified style, line based diff of two texts
+func DiffText(oldText, newText string) []string {
+	a := strings.Split(oldText, "\n")
+	b := strings.Split(newText, "\n")
+
+	// trim the common prefix and suffix to keep the comparison table small
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	type op struct {
+		kind byte
+		line string
+		a, b int
+	}
+	ops := []op{}
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, op{' ', a[i], i, i})
+	}
+
+	ma := a[prefix : len(a)-suffix]
+	mb := b[prefix : len(b)-suffix]
+	// lcs[i][j] is the length of the longest common subsequence of ma[i:] and mb[j:]
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			ops = append(ops, op{' ', ma[i], prefix + i, prefix + j})
+			i++
+			j++
+		case i < len(ma) && (j == len(mb) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', ma[i], prefix + i, prefix + j})
+			i++
+		default:
+			ops = append(ops, op{'+', mb[j], prefix + i, prefix + j})
+			j++
+		}
+	}
+	for k := 0; k < suffix; k++ {
+		ops = append(ops, op{' ', a[len(a)-suffix+k], len(a) - suffix + k, len(b) - suffix + k})
+	}
+
+	// group the operations into hunks with context lines around the changes
+	lines := []string{}
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+		hunkStart := start - diffContextLines
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		hunkEnd := start
+		for k := start; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				hunkEnd = k
+			} else if k-hunkEnd > 2*diffContextLines {
+				break
+			}
+		}
+		hunkEnd += diffContextLines
+		if hunkEnd >= len(ops) {
+			hunkEnd = len(ops) - 1
+		}
+
+		oldCount, newCount := 0, 0
+		body := []string{}
+		for _, o := range ops[hunkStart : hunkEnd+1] {
+			if o.kind != '+' {
+				oldCount++
+			}
+			if o.kind != '-' {
+				newCount++
+			}
+			body = append(body, string(o.kind)+o.line)
+		}
+		lines = append(lines, fmt.Sprintf("@@ -%d,%d +%d,%d @@", ops[hunkStart].a+1, oldCount, ops[hunkStart].b+1, newCount))
+		lines = append(lines, body...)
+		start = hunkEnd + 1
+	}
+	return lines
+}
@@ -0,0 +1,213 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package transform
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func mustUnmarshal(s string) map[string]interface{} {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func TestDiffTemplatesNoChanges(t *testing.T) {
+	RegisterTestingT(t)
+	template := `{
+		"parameters": {"location": {"type": "string", "defaultValue": "westus2"}},
+		"variables": {"vmSize": "Standard_D2_v2"},
+		"resources": [{"type": "Microsoft.Compute/virtualMachines", "name": "vm", "properties": {"hardwareProfile": {"vmSize": "[variables('vmSize')]"}}}]
+	}`
+	d := DiffTemplates(mustUnmarshal(template), map[string]interface{}{}, mustUnmarshal(template), map[string]interface{}{})
+	Expect(d.IsEmpty()).To(BeTrue())
+
+	var buf bytes.Buffer
+	Expect(d.Write(&buf)).To(Succeed())
+	Expect(buf.String()).To(Equal("No changes\n"))
+}
+
+func TestDiffTemplatesResources(t *testing.T) {
+	RegisterTestingT(t)
+	oldTemplate := mustUnmarshal(`{
+		"resources": [
+			{"type": "Microsoft.Compute/virtualMachines", "name": "vm", "properties": {"hardwareProfile": {"vmSize": "Standard_D2_v2"}, "zones": ["1"]}},
+			{"type": "Microsoft.Network/publicIPAddresses", "name": "ip"}
+		]
+	}`)
+	newTemplate := mustUnmarshal(`{
+		"resources": [
+			{"type": "Microsoft.Compute/virtualMachines", "name": "vm", "properties": {"hardwareProfile": {"vmSize": "Standard_D4_v2"}, "zones": ["1", "2"]}},
+			{"type": "Microsoft.Network/loadBalancers", "name": "lb"}
+		]
+	}`)
+
+	d := DiffTemplates(oldTemplate, nil, newTemplate, nil)
+	Expect(d.Resources).To(HaveLen(3))
+
+	Expect(d.Resources[0].Type).To(Equal("Microsoft.Compute/virtualMachines"))
+	Expect(d.Resources[0].Name).To(Equal("vm"))
+	Expect(d.Resources[0].Change).To(Equal(ChangeTypeModified))
+	Expect(d.Resources[0].Properties).To(Equal([]PropertyChange{
+		{Path: "properties.hardwareProfile.vmSize", Change: ChangeTypeModified, OldValue: "Standard_D2_v2", NewValue: "Standard_D4_v2"},
+		{Path: "properties.zones[1]", Change: ChangeTypeAdded, NewValue: "2"},
+	}))
+
+	Expect(d.Resources[1].Type).To(Equal("Microsoft.Network/publicIPAddresses"))
+	Expect(d.Resources[1].Change).To(Equal(ChangeTypeRemoved))
+	Expect(d.Resources[2].Type).To(Equal("Microsoft.Network/loadBalancers"))
+	Expect(d.Resources[2].Change).To(Equal(ChangeTypeAdded))
+}
+
+func TestDiffTemplatesParameters(t *testing.T) {
+	RegisterTestingT(t)
+	oldTemplate := mustUnmarshal(`{"parameters": {
+		"kubernetesHyperkubeSpec": {"type": "string"},
+		"masterCount": {"type": "int", "defaultValue": 1},
+		"caPrivateKey": {"type": "securestring"}
+	}}`)
+	newTemplate := mustUnmarshal(`{"parameters": {
+		"kubernetesHyperkubeSpec": {"type": "string"},
+		"masterCount": {"type": "int", "defaultValue": 3},
+		"caPrivateKey": {"type": "securestring"}
+	}}`)
+	oldParameters := mustUnmarshal(`{"kubernetesHyperkubeSpec": {"value": "hyperkube:v1.10.8"}, "caPrivateKey": {"value": "old"}}`)
+	newParameters := mustUnmarshal(`{"kubernetesHyperkubeSpec": {"value": "hyperkube:v1.10.9"}, "caPrivateKey": {"value": "new"}}`)
+
+	d := DiffTemplates(oldTemplate, oldParameters, newTemplate, newParameters)
+	Expect(d.Parameters).To(Equal([]PropertyChange{
+		{Path: "caPrivateKey", Change: ChangeTypeModified, OldValue: redactedValue, NewValue: redactedValue},
+		{Path: "kubernetesHyperkubeSpec", Change: ChangeTypeModified, OldValue: "hyperkube:v1.10.8", NewValue: "hyperkube:v1.10.9"},
+		{Path: "masterCount", Change: ChangeTypeModified, OldValue: float64(1), NewValue: float64(3)},
+	}))
+}
+
+func TestDiffJSON(t *testing.T) {
+	RegisterTestingT(t)
+	oldDoc := mustUnmarshal(`{"kubeletConfig": {"--max-pods": "30"}, "tags": {"cost center": "a"}}`)
+	newDoc := mustUnmarshal(`{"kubeletConfig": {"--max-pods": "110"}, "tags": {"cost center": "a"}, "count": 3}`)
+
+	Expect(DiffJSON(oldDoc, newDoc)).To(Equal([]PropertyChange{
+		{Path: "count", Change: ChangeTypeAdded, NewValue: float64(3)},
+		{Path: `kubeletConfig["--max-pods"]`, Change: ChangeTypeModified, OldValue: "30", NewValue: "110"},
+	}))
+}
+
+func TestDiffTemplatesCustomData(t *testing.T) {
+	RegisterTestingT(t)
+	customData := func(maxPods string) string {
+		return "[base64(concat('#cloud-config\n\nwrite_files:\n- path: /etc/default/kubelet\n  content: |\n    KUBELET_FLAGS=--cluster-dns=10.0.0.10 --max-pods=" +
+			maxPods + "\n    KUBELET_IMAGE=',variables('kubernetesHyperkubeSpec'),'\n    KUBELET_NODE_LABELS=''role=agent''\n'))]"
+	}
+	template := func(maxPods string) map[string]interface{} {
+		return map[string]interface{}{
+			"resources": []interface{}{
+				map[string]interface{}{
+					"type": "Microsoft.Compute/virtualMachines",
+					"name": "vm",
+					"properties": map[string]interface{}{
+						"osProfile": map[string]interface{}{
+							"customData": customData(maxPods),
+						},
+					},
+				},
+			},
+		}
+	}
+
+	d := DiffTemplates(template("30"), nil, template("110"), nil)
+	Expect(d.Resources).To(HaveLen(1))
+	Expect(d.Resources[0].Properties).To(HaveLen(1))
+	change := d.Resources[0].Properties[0]
+	Expect(change.Path).To(Equal("properties.osProfile.customData"))
+	Expect(change.OldValue).To(BeNil())
+	Expect(change.NewValue).To(BeNil())
+	Expect(change.TextDiff).To(Equal([]string{
+		"@@ -3,7 +3,7 @@",
+		" write_files:",
+		" - path: /etc/default/kubelet",
+		"   content: |",
+		"-    KUBELET_FLAGS=--cluster-dns=10.0.0.10 --max-pods=30",
+		"+    KUBELET_FLAGS=--cluster-dns=10.0.0.10 --max-pods=110",
+		"     KUBELET_IMAGE={{variables('kubernetesHyperkubeSpec')}}",
+		"     KUBELET_NODE_LABELS='role=agent'",
+		" ",
+	}))
+
+	var buf bytes.Buffer
+	Expect(d.Write(&buf)).To(Succeed())
+	Expect(buf.String()).To(ContainSubstring("  ~ Microsoft.Compute/virtualMachines vm\n      ~ properties.osProfile.customData:\n          @@ -3,7 +3,7 @@\n"))
+}
+
+func TestDiffTemplatesGzippedVariable(t *testing.T) {
+	RegisterTestingT(t)
+	encode := func(s string) string {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(s))
+		w.Close()
+		return base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+	script := strings.Repeat("echo provisioning\n", 10)
+	oldTemplate := map[string]interface{}{"variables": map[string]interface{}{"provisionScript": encode(script + "exit 0\n")}}
+	newTemplate := map[string]interface{}{"variables": map[string]interface{}{"provisionScript": encode(script + "exit 1\n")}}
+
+	d := DiffTemplates(oldTemplate, nil, newTemplate, nil)
+	Expect(d.Variables).To(HaveLen(1))
+	Expect(d.Variables[0].TextDiff).To(ContainElement("-exit 0"))
+	Expect(d.Variables[0].TextDiff).To(ContainElement("+exit 1"))
+}
+
+func TestDiffText(t *testing.T) {
+	RegisterTestingT(t)
+	oldLines := []string{}
+	newLines := []string{}
+	for i := 0; i < 20; i++ {
+		line := string(rune('a' + i))
+		oldLines = append(oldLines, line)
+		if i != 2 && i != 15 {
+			newLines = append(newLines, line)
+		}
+	}
+	newLines = append(newLines, "z")
+
+	Expect(DiffText(strings.Join(oldLines, "\n"), strings.Join(newLines, "\n"))).To(Equal([]string{
+		"@@ -1,6 +1,5 @@",
+		" a",
+		" b",
+		"-c",
+		" d",
+		" e",
+		" f",
+		"@@ -13,8 +12,8 @@",
+		" m",
+		" n",
+		" o",
+		"-p",
+		" q",
+		" r",
+		" s",
+		" t",
+		"+z",
+	}))
+}
+
+func TestSplitARMArguments(t *testing.T) {
+	RegisterTestingT(t)
+	args, ok := splitARMArguments(`'a,b', variables('x')[div(1, 2)], 'it''s'`)
+	Expect(ok).To(BeTrue())
+	Expect(args).To(Equal([]string{`'a,b'`, `variables('x')[div(1, 2)]`, `'it''s'`}))
+
+	_, ok = splitARMArguments(`'unterminated`)
+	Expect(ok).To(BeFalse())
+}
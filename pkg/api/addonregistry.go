@@ -0,0 +1,288 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/acs-engine/pkg/api/common"
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/blang/semver"
+	"github.com/pkg/errors"
+)
+
+// AddonDescriptorFileName is the name of the file describing an addon in a subdirectory of an addons directory
+const AddonDescriptorFileName = "addon.json"
+
+// addonNameRegex matches the names of the addons, which name their manifests
+var addonNameRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// AddonDescriptor describes a Kubernetes container addon: its default configuration, when its
+// manifest is deployed and how its configuration is validated. The descriptors of the addons
+// loaded from a directory only use the fields read from their addon.json file.
+type AddonDescriptor struct {
+	// Name is the name of the addon in kubernetesConfig.addons
+	Name string `json:"name"`
+	// Containers are the default containers of the addon
+	Containers []KubernetesContainerSpec `json:"containers,omitempty"`
+	// Config is the default configuration of the addon
+	Config map[string]string `json:"config,omitempty"`
+	// EnabledByDefault enables the addon when the apimodel does not, on the Kubernetes versions it supports
+	EnabledByDefault bool `json:"enabledByDefault,omitempty"`
+	// MinKubernetesVersion is the first Kubernetes version the addon supports; empty supports all older versions
+	MinKubernetesVersion string `json:"minKubernetesVersion,omitempty"`
+	// MaxKubernetesVersion is the first Kubernetes version the addon does not support; empty supports all newer versions
+	MaxKubernetesVersion string `json:"maxKubernetesVersion,omitempty"`
+	// RequiredConfig are the keys of the configuration an enabled addon must set
+	RequiredConfig []string `json:"requiredConfig,omitempty"`
+	// ManifestFile is the manifest template of the addon, relative to its addon.json file
+	ManifestFile string `json:"manifest,omitempty"`
+	// DestinationFile is the name of the manifest in /etc/kubernetes/addons; defaults to the name of the addon
+	DestinationFile string `json:"destinationFile,omitempty"`
+
+	// Manifest is the manifest template read from ManifestFile
+	Manifest string `json:"-"`
+	// ManifestAsset is the manifest template of a built-in addon in parts/k8s/containeraddons
+	ManifestAsset string `json:"-"`
+	// Defaults returns the default configuration of the addon for a cluster, nil not to add it
+	// to the apimodel, instead of Containers, Config and EnabledByDefault
+	Defaults func(cs *ContainerService) *KubernetesAddon `json:"-"`
+	// Enabled tells whether the manifest of the addon is deployed, instead of the enabled
+	// field of the addon
+	Enabled func(p *Properties) bool `json:"-"`
+	// Validate validates the configuration of an enabled addon, in addition to its required
+	// configuration and Kubernetes versions
+	Validate func(addon KubernetesAddon, cs *ContainerService) error `json:"-"`
+}
+
+// HasManifest tells whether the descriptor has a manifest for the addon manager to deploy
+func (d *AddonDescriptor) HasManifest() bool {
+	return d.Manifest != "" || d.ManifestAsset != ""
+}
+
+// GetDestinationFile returns the name of the manifest of the addon in /etc/kubernetes/addons
+func (d *AddonDescriptor) GetDestinationFile() string {
+	if d.DestinationFile != "" {
+		return d.DestinationFile
+	}
+	return d.Name + ".yaml"
+}
+
+// IsEnabled tells whether the manifest of the addon is deployed to the cluster of p
+func (d *AddonDescriptor) IsEnabled(p *Properties) bool {
+	if d.Enabled != nil {
+		return d.Enabled(p)
+	}
+	addon := p.OrchestratorProfile.KubernetesConfig.GetAddonByName(d.Name)
+	return addon.IsEnabled(d.EnabledByDefault && d.supportsVersion(p.OrchestratorProfile.OrchestratorVersion))
+}
+
+// supportsVersion tells whether the addon supports a Kubernetes version
+func (d *AddonDescriptor) supportsVersion(version string) bool {
+	if d.MinKubernetesVersion != "" && !common.IsKubernetesVersionGe(version, d.MinKubernetesVersion) {
+		return false
+	}
+	return d.MaxKubernetesVersion == "" || !common.IsKubernetesVersionGe(version, d.MaxKubernetesVersion)
+}
+
+// defaultAddon returns the configuration of the addon added to the apimodel of cs
+func (d *AddonDescriptor) defaultAddon(cs *ContainerService) *KubernetesAddon {
+	if d.Defaults != nil {
+		return d.Defaults(cs)
+	}
+	addon := &KubernetesAddon{
+		Name:       d.Name,
+		Enabled:    helpers.PointerToBool(d.EnabledByDefault && d.supportsVersion(cs.Properties.OrchestratorProfile.OrchestratorVersion)),
+		Containers: append([]KubernetesContainerSpec(nil), d.Containers...),
+	}
+	if len(d.Config) > 0 {
+		addon.Config = map[string]string{}
+		for key, val := range d.Config {
+			addon.Config[key] = val
+		}
+	}
+	return addon
+}
+
+// validate validates the configuration of the addon of the cluster cs
+func (d *AddonDescriptor) validate(cs *ContainerService) error {
+	o := cs.Properties.OrchestratorProfile
+	addon := o.KubernetesConfig.GetAddonByName(d.Name)
+	if !d.supportsVersion(o.OrchestratorVersion) {
+		switch {
+		case d.MaxKubernetesVersion == "":
+			return errors.Errorf("addon %s requires Kubernetes %s or later, not %s", d.Name, d.MinKubernetesVersion, o.OrchestratorVersion)
+		case d.MinKubernetesVersion == "":
+			return errors.Errorf("addon %s requires a Kubernetes version older than %s, not %s", d.Name, d.MaxKubernetesVersion, o.OrchestratorVersion)
+		default:
+			return errors.Errorf("addon %s requires Kubernetes %s or later and older than %s, not %s", d.Name, d.MinKubernetesVersion, d.MaxKubernetesVersion, o.OrchestratorVersion)
+		}
+	}
+	for _, key := range d.RequiredConfig {
+		if addon.Config[key] == "" {
+			return errors.Errorf("addon %s requires config %s", d.Name, key)
+		}
+	}
+	if d.Validate != nil {
+		if err := d.Validate(addon, cs); err != nil {
+			return errors.Wrapf(err, "invalid addon %s", d.Name)
+		}
+	}
+	return nil
+}
+
+// AddonRegistry holds the container addons a cluster can deploy: the built-in addons and the
+// ones loaded from directories
+type AddonRegistry struct {
+	addons []*AddonDescriptor
+}
+
+// NewAddonRegistry returns a registry holding the built-in addons
+func NewAddonRegistry() *AddonRegistry {
+	return &AddonRegistry{addons: builtinAddons()}
+}
+
+// Addons returns the descriptors of the registry, in the order their addons are added to apimodels
+func (r *AddonRegistry) Addons() []*AddonDescriptor {
+	return r.addons
+}
+
+// Get returns the descriptor of the addon name; nil when the registry does not hold it
+func (r *AddonRegistry) Get(name string) *AddonDescriptor {
+	for _, d := range r.addons {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// Register adds an addon to the registry, replacing the addon of the same name if any
+func (r *AddonRegistry) Register(d *AddonDescriptor) error {
+	if !addonNameRegex.MatchString(d.Name) {
+		return errors.Errorf("addon name '%s' can only contain lowercase alphanumerics and dashes", d.Name)
+	}
+	for _, version := range []string{d.MinKubernetesVersion, d.MaxKubernetesVersion} {
+		if version == "" {
+			continue
+		}
+		if _, err := semver.Make(version); err != nil {
+			return errors.Errorf("addon %s has an invalid Kubernetes version '%s'", d.Name, version)
+		}
+	}
+	for i := range r.addons {
+		if r.addons[i].Name == d.Name {
+			r.addons[i] = d
+			return nil
+		}
+	}
+	r.addons = append(r.addons, d)
+	return nil
+}
+
+// LoadDir registers the addons described by the addon.json files of the subdirectories of dir
+func (r *AddonRegistry) LoadDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrapf(err, "error reading the addons directory %s", dir)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		descriptorPath := filepath.Join(dir, entry.Name(), AddonDescriptorFileName)
+		if _, err := os.Stat(descriptorPath); os.IsNotExist(err) {
+			continue
+		}
+		d, err := loadAddonDescriptor(descriptorPath)
+		if err != nil {
+			return err
+		}
+		if err := r.Register(d); err != nil {
+			return errors.Wrapf(err, "error registering the addon of %s", descriptorPath)
+		}
+	}
+	return nil
+}
+
+// loadAddonDescriptor reads an addon.json file and the manifest it names
+func loadAddonDescriptor(path string) (*AddonDescriptor, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading the addon descriptor %s", path)
+	}
+	d := &AddonDescriptor{}
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, errors.Wrapf(err, "error parsing the addon descriptor %s", path)
+	}
+	if d.ManifestFile == "" {
+		return nil, errors.Errorf("the addon descriptor %s does not name its manifest", path)
+	}
+	manifestPath := d.ManifestFile
+	if !filepath.IsAbs(manifestPath) {
+		manifestPath = filepath.Join(filepath.Dir(path), manifestPath)
+	}
+	manifest, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading the manifest of the addon descriptor %s", path)
+	}
+	d.Manifest = strings.Replace(string(manifest), "\r\n", "\n", -1)
+	return d, nil
+}
+
+// SetAddonRegistry makes the defaults and the templates of the cluster use the addons of r
+// rather than the built-in addons only
+func (cs *ContainerService) SetAddonRegistry(r *AddonRegistry) {
+	cs.addonRegistry = r
+}
+
+// AddonRegistry returns the registry of the addons of the cluster
+func (cs *ContainerService) AddonRegistry() *AddonRegistry {
+	if cs.addonRegistry == nil {
+		return NewAddonRegistry()
+	}
+	return cs.addonRegistry
+}
+
+// SetAddonDefaults assigns the default configuration of the registry to the values the addon
+// name of the apimodel does not set, as SetPropertiesDefaults does for the enabled addons
+func (cs *ContainerService) SetAddonDefaults(name string) {
+	d := cs.AddonRegistry().Get(name)
+	if d == nil {
+		return
+	}
+	if addon := d.defaultAddon(cs); addon != nil {
+		synthesizeAddonsConfig(cs.Properties.OrchestratorProfile.KubernetesConfig.Addons, *addon, false, false)
+	}
+}
+
+// ValidateAddons validates the configuration of the enabled addons of the registry of the cluster
+func (cs *ContainerService) ValidateAddons() error {
+	p := cs.Properties
+	if p == nil || p.OrchestratorProfile == nil || p.OrchestratorProfile.KubernetesConfig == nil {
+		return nil
+	}
+	for _, d := range cs.AddonRegistry().Addons() {
+		if !d.IsEnabled(p) {
+			continue
+		}
+		if err := d.validate(cs); err != nil {
+			return err
+		}
+	}
+	for _, addon := range p.OrchestratorProfile.KubernetesConfig.Addons {
+		if !addon.IsChart() || !addon.IsEnabled(true) {
+			continue
+		}
+		if err := cs.validateChartAddon(addon); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/pkg/errors"
+)
+
+func writeAddon(t *testing.T, dir, name, descriptor, manifest string) {
+	if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+		t.Fatalf("unexpected error creating the addon directory: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name, AddonDescriptorFileName), []byte(descriptor), 0644); err != nil {
+		t.Fatalf("unexpected error writing the addon descriptor: %s", err)
+	}
+	if manifest != "" {
+		if err := ioutil.WriteFile(filepath.Join(dir, name, "manifest.yaml"), []byte(manifest), 0644); err != nil {
+			t.Fatalf("unexpected error writing the addon manifest: %s", err)
+		}
+	}
+}
+
+func TestAddonRegistryLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acs-engine-addons")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeAddon(t, dir, "my-addon", `{
+  "name": "my-addon",
+  "containers": [{"name": "my-addon", "image": "contoso/my-addon:1.0", "cpuRequests": "10m"}],
+  "config": {"replicas": "2"},
+  "enabledByDefault": true,
+  "minKubernetesVersion": "1.10.0",
+  "requiredConfig": ["replicas"],
+  "manifest": "manifest.yaml"
+}`, "image: {{ContainerImage \"my-addon\"}}\r\n")
+	// directories without a descriptor are skipped
+	if err := os.MkdirAll(filepath.Join(dir, "docs"), 0755); err != nil {
+		t.Fatalf("unexpected error creating a directory: %s", err)
+	}
+
+	r := NewAddonRegistry()
+	builtins := len(r.Addons())
+	if err := r.LoadDir(dir); err != nil {
+		t.Fatalf("unexpected error loading the addons: %s", err)
+	}
+	if len(r.Addons()) != builtins+1 {
+		t.Fatalf("expected %d addons, got %d", builtins+1, len(r.Addons()))
+	}
+	d := r.Get("my-addon")
+	if d == nil || d.Manifest != "image: {{ContainerImage \"my-addon\"}}\n" || d.GetDestinationFile() != "my-addon.yaml" || !d.HasManifest() {
+		t.Fatalf("expected the addon and its manifest to be loaded, got %+v", d)
+	}
+
+	for _, test := range []struct {
+		desc       string
+		descriptor string
+		manifest   string
+	}{
+		{"invalid json", `{"name":`, ""},
+		{"no manifest", `{"name": "other-addon"}`, ""},
+		{"missing manifest", `{"name": "other-addon", "manifest": "missing.yaml"}`, ""},
+		{"invalid name", `{"name": "Other_Addon", "manifest": "manifest.yaml"}`, "kind: Pod"},
+		{"invalid version", `{"name": "other-addon", "manifest": "manifest.yaml", "maxKubernetesVersion": "1.x"}`, "kind: Pod"},
+	} {
+		invalidDir, err := ioutil.TempDir("", "acs-engine-addons")
+		if err != nil {
+			t.Fatalf("unexpected error creating temp dir: %s", err)
+		}
+		defer os.RemoveAll(invalidDir)
+		writeAddon(t, invalidDir, "other-addon", test.descriptor, test.manifest)
+		if err := NewAddonRegistry().LoadDir(invalidDir); err == nil {
+			t.Errorf("%s: expected an error loading the addon", test.desc)
+		}
+	}
+
+	if err := NewAddonRegistry().LoadDir(filepath.Join(dir, "does-not-exist")); err == nil {
+		t.Fatalf("expected an error loading a missing directory")
+	}
+}
+
+func TestAddonRegistryDefaultsAndValidation(t *testing.T) {
+	r := NewAddonRegistry()
+	validated := false
+	if err := r.Register(&AddonDescriptor{
+		Name:                 "my-addon",
+		Containers:           []KubernetesContainerSpec{{Name: "my-addon", Image: "contoso/my-addon:1.0"}},
+		Config:               map[string]string{"replicas": "2"},
+		EnabledByDefault:     true,
+		MinKubernetesVersion: "1.10.0",
+		MaxKubernetesVersion: "1.12.0",
+		RequiredConfig:       []string{"replicas"},
+		Manifest:             "kind: Pod",
+		Validate: func(addon KubernetesAddon, cs *ContainerService) error {
+			validated = true
+			if addon.Config["replicas"] == "0" {
+				return errors.New("replicas must be positive")
+			}
+			return nil
+		},
+	}); err != nil {
+		t.Fatalf("unexpected error registering the addon: %s", err)
+	}
+
+	cs := CreateMockContainerService("testcluster", "1.10.8", 1, 3, false)
+	cs.SetAddonRegistry(r)
+	cs.setAddonsConfig(false)
+	addon := cs.Properties.OrchestratorProfile.KubernetesConfig.GetAddonByName("my-addon")
+	if !helpers.IsTrueBoolPointer(addon.Enabled) || addon.Config["replicas"] != "2" || len(addon.Containers) != 1 {
+		t.Fatalf("expected the addon to be added enabled with its defaults, got %+v", addon)
+	}
+	if cs.Properties.OrchestratorProfile.KubernetesConfig.GetAddonByName(DefaultTillerAddonName).Name == "" {
+		t.Fatalf("expected the built-in addons to be added")
+	}
+	if err := cs.ValidateAddons(); err != nil || !validated {
+		t.Fatalf("unexpected error validating the addons: %v", err)
+	}
+
+	addon.Config["replicas"] = "0"
+	if err := cs.ValidateAddons(); err == nil {
+		t.Fatalf("expected the validation of the addon to fail")
+	}
+	addon.Config["replicas"] = ""
+	if err := cs.ValidateAddons(); err == nil {
+		t.Fatalf("expected an error for the missing required config")
+	}
+
+	cs = CreateMockContainerService("testcluster", "1.12.2", 1, 3, false)
+	cs.SetAddonRegistry(r)
+	cs.setAddonsConfig(false)
+	if d := r.Get("my-addon"); d.IsEnabled(cs.Properties) {
+		t.Fatalf("expected the addon not to be enabled by default on an unsupported version")
+	}
+	i := getAddonsIndexByName(cs.Properties.OrchestratorProfile.KubernetesConfig.Addons, "my-addon")
+	cs.Properties.OrchestratorProfile.KubernetesConfig.Addons[i].Enabled = helpers.PointerToBool(true)
+	if err := cs.ValidateAddons(); err == nil {
+		t.Fatalf("expected an error enabling the addon on an unsupported version")
+	}
+}
+
+func TestSetAddonDefaults(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.10.8", 1, 3, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.Addons = []KubernetesAddon{
+		{
+			Name:       DefaultClusterAutoscalerAddonName,
+			Enabled:    helpers.PointerToBool(true),
+			Containers: []KubernetesContainerSpec{{Name: DefaultClusterAutoscalerAddonName, CPULimits: "200m"}},
+		},
+	}
+	cs.SetAddonDefaults(DefaultClusterAutoscalerAddonName)
+	cs.SetAddonDefaults("not-an-addon")
+	addon := cs.Properties.OrchestratorProfile.KubernetesConfig.GetAddonByName(DefaultClusterAutoscalerAddonName)
+	c := addon.Containers[0]
+	if c.CPULimits != "200m" || c.CPURequests != "100m" || c.Image == "" || addon.Config["max-nodes"] != "5" {
+		t.Fatalf("expected the unset values of the addon to be defaulted, got %+v", addon)
+	}
+}
+
+func TestClusterAutoscalerAddonDefaults(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.10.8", 1, 3, false)
+	cs.SetPropertiesDefaults(false, false)
+	if cs.Properties.OrchestratorProfile.KubernetesConfig.IsClusterAutoscalerEnabled() {
+		t.Fatalf("expected the cluster-autoscaler to be disabled by default")
+	}
+
+	cs = CreateMockContainerService("testcluster", "1.10.8", 1, 3, false)
+	cs.Properties.AgentPoolProfiles[0].EnableAutoScaling = helpers.PointerToBool(true)
+	cs.SetPropertiesDefaults(false, false)
+	if !cs.Properties.OrchestratorProfile.KubernetesConfig.IsClusterAutoscalerEnabled() {
+		t.Fatalf("expected the cluster-autoscaler to be enabled when an agent pool has autoscaling enabled")
+	}
+}
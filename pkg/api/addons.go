@@ -10,259 +10,413 @@ import (
 	"github.com/Azure/acs-engine/pkg/helpers"
 )
 
-func (cs *ContainerService) setAddonsConfig(isUpdate bool) {
-	o := cs.Properties.OrchestratorProfile
-	cloudSpecConfig := cs.GetCloudSpecConfig()
-	k8sComponents := K8sComponentsByVersionMap[o.OrchestratorVersion]
-	specConfig := cloudSpecConfig.KubernetesSpecConfig
-	defaultTillerAddonsConfig := KubernetesAddon{
-		Name:    DefaultTillerAddonName,
-		Enabled: helpers.PointerToBool(DefaultTillerAddonEnabled),
-		Containers: []KubernetesContainerSpec{
-			{
-				Name:           DefaultTillerAddonName,
-				CPURequests:    "50m",
-				MemoryRequests: "150Mi",
-				CPULimits:      "50m",
-				MemoryLimits:   "150Mi",
-				Image:          specConfig.TillerImageBase + k8sComponents[DefaultTillerAddonName],
+// builtinAddons returns the descriptors of the container addons shipped with acs-engine, in the
+// order they are added to apimodels. Their manifests are in parts/k8s/containeraddons.
+func builtinAddons() []*AddonDescriptor {
+	return []*AddonDescriptor{
+		{
+			Name:            DefaultTillerAddonName,
+			ManifestAsset:   "kubernetesmasteraddons-tiller-deployment.yaml",
+			DestinationFile: "kube-tiller-deployment.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				specConfig, k8sComponents := addonImageConfig(cs)
+				return &KubernetesAddon{
+					Name:    DefaultTillerAddonName,
+					Enabled: helpers.PointerToBool(DefaultTillerAddonEnabled),
+					Containers: []KubernetesContainerSpec{
+						{
+							Name:           DefaultTillerAddonName,
+							CPURequests:    "50m",
+							MemoryRequests: "150Mi",
+							CPULimits:      "50m",
+							MemoryLimits:   "150Mi",
+							Image:          specConfig.TillerImageBase + k8sComponents[DefaultTillerAddonName],
+						},
+					},
+					Config: map[string]string{
+						"max-history": strconv.Itoa(DefaultTillerMaxHistory),
+					},
+				}
 			},
-		},
-		Config: map[string]string{
-			"max-history": strconv.Itoa(DefaultTillerMaxHistory),
-		},
-	}
-
-	defaultACIConnectorAddonsConfig := KubernetesAddon{
-		Name:    DefaultACIConnectorAddonName,
-		Enabled: helpers.PointerToBool(DefaultACIConnectorAddonEnabled),
-		Config: map[string]string{
-			"region":   "westus",
-			"nodeName": "aci-connector",
-			"os":       "Linux",
-			"taint":    "azure.com/aci",
-		},
-		Containers: []KubernetesContainerSpec{
-			{
-				Name:           DefaultACIConnectorAddonName,
-				CPURequests:    "50m",
-				MemoryRequests: "150Mi",
-				CPULimits:      "50m",
-				MemoryLimits:   "150Mi",
-				Image:          specConfig.ACIConnectorImageBase + k8sComponents[DefaultACIConnectorAddonName],
+			Enabled: func(p *Properties) bool {
+				return p.OrchestratorProfile.KubernetesConfig.IsTillerEnabled()
 			},
 		},
-	}
-
-	defaultClusterAutoscalerAddonsConfig := KubernetesAddon{
-		Name:    DefaultClusterAutoscalerAddonName,
-		Enabled: helpers.PointerToBool(DefaultClusterAutoscalerAddonEnabled),
-		Config: map[string]string{
-			"min-nodes": "1",
-			"max-nodes": "5",
-		},
-		Containers: []KubernetesContainerSpec{
-			{
-				Name:           DefaultClusterAutoscalerAddonName,
-				CPURequests:    "100m",
-				MemoryRequests: "300Mi",
-				CPULimits:      "100m",
-				MemoryLimits:   "300Mi",
-				Image:          specConfig.KubernetesImageBase + k8sComponents[DefaultClusterAutoscalerAddonName],
+		{
+			Name:            DefaultAADPodIdentityAddonName,
+			ManifestAsset:   "kubernetesmasteraddons-aad-pod-identity-deployment.yaml",
+			DestinationFile: "aad-pod-identity-deployment.yaml",
+			// the addon is only added to apimodels that enable it
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				return nil
+			},
+			Enabled: func(p *Properties) bool {
+				return p.OrchestratorProfile.KubernetesConfig.IsAADPodIdentityEnabled()
 			},
 		},
-	}
-
-	defaultBlobfuseFlexVolumeAddonsConfig := KubernetesAddon{
-		Name:    DefaultBlobfuseFlexVolumeAddonName,
-		Enabled: helpers.PointerToBool(common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.8.0") && DefaultBlobfuseFlexVolumeAddonEnabled),
-		Containers: []KubernetesContainerSpec{
-			{
-				Name:           DefaultBlobfuseFlexVolumeAddonName,
-				CPURequests:    "50m",
-				MemoryRequests: "10Mi",
-				CPULimits:      "50m",
-				MemoryLimits:   "10Mi",
-				Image:          "mcr.microsoft.com/k8s/flexvolume/blobfuse-flexvolume",
+		{
+			Name:            DefaultACIConnectorAddonName,
+			ManifestAsset:   "kubernetesmasteraddons-aci-connector-deployment.yaml",
+			DestinationFile: "aci-connector-deployment.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				specConfig, k8sComponents := addonImageConfig(cs)
+				return &KubernetesAddon{
+					Name:    DefaultACIConnectorAddonName,
+					Enabled: helpers.PointerToBool(DefaultACIConnectorAddonEnabled),
+					Config: map[string]string{
+						"region":   "westus",
+						"nodeName": "aci-connector",
+						"os":       "Linux",
+						"taint":    "azure.com/aci",
+					},
+					Containers: []KubernetesContainerSpec{
+						{
+							Name:           DefaultACIConnectorAddonName,
+							CPURequests:    "50m",
+							MemoryRequests: "150Mi",
+							CPULimits:      "50m",
+							MemoryLimits:   "150Mi",
+							Image:          specConfig.ACIConnectorImageBase + k8sComponents[DefaultACIConnectorAddonName],
+						},
+					},
+				}
+			},
+			Enabled: func(p *Properties) bool {
+				return p.OrchestratorProfile.KubernetesConfig.IsACIConnectorEnabled()
 			},
 		},
-	}
-
-	defaultSMBFlexVolumeAddonsConfig := KubernetesAddon{
-		Name:    DefaultSMBFlexVolumeAddonName,
-		Enabled: helpers.PointerToBool(common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.8.0") && DefaultSMBFlexVolumeAddonEnabled),
-		Containers: []KubernetesContainerSpec{
-			{
-				Name:           DefaultSMBFlexVolumeAddonName,
-				CPURequests:    "50m",
-				MemoryRequests: "10Mi",
-				CPULimits:      "50m",
-				MemoryLimits:   "10Mi",
-				Image:          "mcr.microsoft.com/k8s/flexvolume/smb-flexvolume",
+		{
+			Name:            DefaultClusterAutoscalerAddonName,
+			ManifestAsset:   "kubernetesmasteraddons-cluster-autoscaler-deployment.yaml",
+			DestinationFile: "cluster-autoscaler-deployment.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				specConfig, k8sComponents := addonImageConfig(cs)
+				return &KubernetesAddon{
+					Name:    DefaultClusterAutoscalerAddonName,
+					Enabled: helpers.PointerToBool(DefaultClusterAutoscalerAddonEnabled || cs.Properties.HasAutoScaledAgentPool()),
+					Config: map[string]string{
+						"min-nodes": "1",
+						"max-nodes": "5",
+					},
+					Containers: []KubernetesContainerSpec{
+						{
+							Name:           DefaultClusterAutoscalerAddonName,
+							CPURequests:    "100m",
+							MemoryRequests: "300Mi",
+							CPULimits:      "100m",
+							MemoryLimits:   "300Mi",
+							Image:          specConfig.KubernetesImageBase + k8sComponents[DefaultClusterAutoscalerAddonName],
+						},
+					},
+				}
+			},
+			Enabled: func(p *Properties) bool {
+				return p.OrchestratorProfile.KubernetesConfig.IsClusterAutoscalerEnabled()
 			},
 		},
-	}
-
-	defaultKeyVaultFlexVolumeAddonsConfig := KubernetesAddon{
-		Name:    DefaultKeyVaultFlexVolumeAddonName,
-		Enabled: helpers.PointerToBool(DefaultKeyVaultFlexVolumeAddonEnabled),
-		Containers: []KubernetesContainerSpec{
-			{
-				Name:           DefaultKeyVaultFlexVolumeAddonName,
-				CPURequests:    "50m",
-				MemoryRequests: "10Mi",
-				CPULimits:      "50m",
-				MemoryLimits:   "10Mi",
-				Image:          "mcr.microsoft.com/k8s/flexvolume/keyvault-flexvolume:v0.0.5",
+		{
+			Name:            DefaultBlobfuseFlexVolumeAddonName,
+			ManifestAsset:   "kubernetesmasteraddons-blobfuse-flexvolume-installer.yaml",
+			DestinationFile: "blobfuse-flexvolume-installer.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				return &KubernetesAddon{
+					Name:    DefaultBlobfuseFlexVolumeAddonName,
+					Enabled: helpers.PointerToBool(common.IsKubernetesVersionGe(cs.Properties.OrchestratorProfile.OrchestratorVersion, "1.8.0") && DefaultBlobfuseFlexVolumeAddonEnabled),
+					Containers: []KubernetesContainerSpec{
+						{
+							Name:           DefaultBlobfuseFlexVolumeAddonName,
+							CPURequests:    "50m",
+							MemoryRequests: "10Mi",
+							CPULimits:      "50m",
+							MemoryLimits:   "10Mi",
+							Image:          "mcr.microsoft.com/k8s/flexvolume/blobfuse-flexvolume",
+						},
+					},
+				}
+			},
+			Enabled: func(p *Properties) bool {
+				return p.OrchestratorProfile.KubernetesConfig.IsBlobfuseFlexVolumeEnabled()
 			},
 		},
-	}
-
-	defaultDashboardAddonsConfig := KubernetesAddon{
-		Name:    DefaultDashboardAddonName,
-		Enabled: helpers.PointerToBool(DefaultDashboardAddonEnabled),
-		Containers: []KubernetesContainerSpec{
-			{
-				Name:           DefaultDashboardAddonName,
-				CPURequests:    "300m",
-				MemoryRequests: "150Mi",
-				CPULimits:      "300m",
-				MemoryLimits:   "150Mi",
-				Image:          specConfig.KubernetesImageBase + k8sComponents[DefaultDashboardAddonName],
+		{
+			Name:            DefaultSMBFlexVolumeAddonName,
+			ManifestAsset:   "kubernetesmasteraddons-smb-flexvolume-installer.yaml",
+			DestinationFile: "smb-flexvolume-installer.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				return &KubernetesAddon{
+					Name:    DefaultSMBFlexVolumeAddonName,
+					Enabled: helpers.PointerToBool(common.IsKubernetesVersionGe(cs.Properties.OrchestratorProfile.OrchestratorVersion, "1.8.0") && DefaultSMBFlexVolumeAddonEnabled),
+					Containers: []KubernetesContainerSpec{
+						{
+							Name:           DefaultSMBFlexVolumeAddonName,
+							CPURequests:    "50m",
+							MemoryRequests: "10Mi",
+							CPULimits:      "50m",
+							MemoryLimits:   "10Mi",
+							Image:          "mcr.microsoft.com/k8s/flexvolume/smb-flexvolume",
+						},
+					},
+				}
+			},
+			Enabled: func(p *Properties) bool {
+				return p.OrchestratorProfile.KubernetesConfig.IsSMBFlexVolumeEnabled()
 			},
 		},
-	}
-
-	defaultReschedulerAddonsConfig := KubernetesAddon{
-		Name:    DefaultReschedulerAddonName,
-		Enabled: helpers.PointerToBool(DefaultReschedulerAddonEnabled),
-		Containers: []KubernetesContainerSpec{
-			{
-				Name:           DefaultReschedulerAddonName,
-				CPURequests:    "10m",
-				MemoryRequests: "100Mi",
-				CPULimits:      "10m",
-				MemoryLimits:   "100Mi",
-				Image:          specConfig.KubernetesImageBase + k8sComponents[DefaultReschedulerAddonName],
+		{
+			Name:            DefaultKeyVaultFlexVolumeAddonName,
+			ManifestAsset:   "kubernetesmasteraddons-keyvault-flexvolume-installer.yaml",
+			DestinationFile: "keyvault-flexvolume-installer.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				return &KubernetesAddon{
+					Name:    DefaultKeyVaultFlexVolumeAddonName,
+					Enabled: helpers.PointerToBool(DefaultKeyVaultFlexVolumeAddonEnabled),
+					Containers: []KubernetesContainerSpec{
+						{
+							Name:           DefaultKeyVaultFlexVolumeAddonName,
+							CPURequests:    "50m",
+							MemoryRequests: "10Mi",
+							CPULimits:      "50m",
+							MemoryLimits:   "10Mi",
+							Image:          "mcr.microsoft.com/k8s/flexvolume/keyvault-flexvolume:v0.0.5",
+						},
+					},
+				}
+			},
+			Enabled: func(p *Properties) bool {
+				return p.OrchestratorProfile.KubernetesConfig.IsKeyVaultFlexVolumeEnabled()
 			},
 		},
-	}
-
-	defaultMetricsServerAddonsConfig := KubernetesAddon{
-		Name:    DefaultMetricsServerAddonName,
-		Enabled: k8sVersionMetricsServerAddonEnabled(o),
-		Containers: []KubernetesContainerSpec{
-			{
-				Name:  DefaultMetricsServerAddonName,
-				Image: specConfig.KubernetesImageBase + k8sComponents[DefaultMetricsServerAddonName],
+		{
+			Name:            DefaultDashboardAddonName,
+			ManifestAsset:   "kubernetesmasteraddons-kubernetes-dashboard-deployment.yaml",
+			DestinationFile: "kubernetes-dashboard-deployment.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				specConfig, k8sComponents := addonImageConfig(cs)
+				return &KubernetesAddon{
+					Name:    DefaultDashboardAddonName,
+					Enabled: helpers.PointerToBool(DefaultDashboardAddonEnabled),
+					Containers: []KubernetesContainerSpec{
+						{
+							Name:           DefaultDashboardAddonName,
+							CPURequests:    "300m",
+							MemoryRequests: "150Mi",
+							CPULimits:      "300m",
+							MemoryLimits:   "150Mi",
+							Image:          specConfig.KubernetesImageBase + k8sComponents[DefaultDashboardAddonName],
+						},
+					},
+				}
+			},
+			Enabled: func(p *Properties) bool {
+				return p.OrchestratorProfile.KubernetesConfig.IsDashboardEnabled()
 			},
 		},
-	}
-
-	defaultNVIDIADevicePluginAddonsConfig := KubernetesAddon{
-		Name:    NVIDIADevicePluginAddonName,
-		Enabled: helpers.PointerToBool(cs.Properties.HasNSeriesSKU() && common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.10.0")),
-		Containers: []KubernetesContainerSpec{
-			{
-				Name: NVIDIADevicePluginAddonName,
-				// from https://github.com/kubernetes/kubernetes/blob/master/cluster/addons/device-plugins/nvidia-gpu/daemonset.yaml#L44
-				CPURequests:    "50m",
-				MemoryRequests: "10Mi",
-				CPULimits:      "50m",
-				MemoryLimits:   "10Mi",
-				Image:          specConfig.NVIDIAImageBase + k8sComponents[NVIDIADevicePluginAddonName],
+		{
+			Name:            DefaultReschedulerAddonName,
+			ManifestAsset:   "kubernetesmasteraddons-kube-rescheduler-deployment.yaml",
+			DestinationFile: "kube-rescheduler-deployment.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				specConfig, k8sComponents := addonImageConfig(cs)
+				return &KubernetesAddon{
+					Name:    DefaultReschedulerAddonName,
+					Enabled: helpers.PointerToBool(DefaultReschedulerAddonEnabled),
+					Containers: []KubernetesContainerSpec{
+						{
+							Name:           DefaultReschedulerAddonName,
+							CPURequests:    "10m",
+							MemoryRequests: "100Mi",
+							CPULimits:      "10m",
+							MemoryLimits:   "100Mi",
+							Image:          specConfig.KubernetesImageBase + k8sComponents[DefaultReschedulerAddonName],
+						},
+					},
+				}
+			},
+			Enabled: func(p *Properties) bool {
+				return p.OrchestratorProfile.KubernetesConfig.IsReschedulerEnabled()
 			},
 		},
-	}
-
-	defaultContainerMonitoringAddonsConfig := KubernetesAddon{
-		Name:    ContainerMonitoringAddonName,
-		Enabled: helpers.PointerToBool(DefaultContainerMonitoringAddonEnabled),
-		Config: map[string]string{
-			"omsAgentVersion":       "1.6.0-42",
-			"dockerProviderVersion": "2.0.0-3",
+		{
+			Name:            DefaultMetricsServerAddonName,
+			ManifestAsset:   "kubernetesmasteraddons-metrics-server-deployment.yaml",
+			DestinationFile: "kube-metrics-server-deployment.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				specConfig, k8sComponents := addonImageConfig(cs)
+				return &KubernetesAddon{
+					Name:    DefaultMetricsServerAddonName,
+					Enabled: k8sVersionMetricsServerAddonEnabled(cs.Properties.OrchestratorProfile),
+					Containers: []KubernetesContainerSpec{
+						{
+							Name:  DefaultMetricsServerAddonName,
+							Image: specConfig.KubernetesImageBase + k8sComponents[DefaultMetricsServerAddonName],
+						},
+					},
+				}
+			},
+			Enabled: func(p *Properties) bool {
+				return p.OrchestratorProfile.IsMetricsServerEnabled()
+			},
 		},
-		Containers: []KubernetesContainerSpec{
-			{
-				Name:           "omsagent",
-				CPURequests:    "50m",
-				MemoryRequests: "200Mi",
-				CPULimits:      "150m",
-				MemoryLimits:   "750Mi",
-				Image:          "microsoft/oms:ciprod11292018",
+		{
+			Name:            NVIDIADevicePluginAddonName,
+			ManifestAsset:   "kubernetesmasteraddons-nvidia-device-plugin-daemonset.yaml",
+			DestinationFile: "nvidia-device-plugin.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				specConfig, k8sComponents := addonImageConfig(cs)
+				return &KubernetesAddon{
+					Name:    NVIDIADevicePluginAddonName,
+					Enabled: helpers.PointerToBool(cs.Properties.HasNSeriesSKU() && common.IsKubernetesVersionGe(cs.Properties.OrchestratorProfile.OrchestratorVersion, "1.10.0")),
+					Containers: []KubernetesContainerSpec{
+						{
+							Name: NVIDIADevicePluginAddonName,
+							// from https://github.com/kubernetes/kubernetes/blob/master/cluster/addons/device-plugins/nvidia-gpu/daemonset.yaml#L44
+							CPURequests:    "50m",
+							MemoryRequests: "10Mi",
+							CPULimits:      "50m",
+							MemoryLimits:   "10Mi",
+							Image:          specConfig.NVIDIAImageBase + k8sComponents[NVIDIADevicePluginAddonName],
+						},
+					},
+				}
+			},
+			Enabled: func(p *Properties) bool {
+				return p.IsNVIDIADevicePluginEnabled()
 			},
 		},
-	}
-
-	defaultIPMasqAgentAddonsConfig := KubernetesAddon{
-		Name:    IPMASQAgentAddonName,
-		Enabled: helpers.PointerToBool(IPMasqAgentAddonEnabled),
-		Containers: []KubernetesContainerSpec{
-			{
-				Name:           IPMASQAgentAddonName,
-				CPURequests:    "50m",
-				MemoryRequests: "50Mi",
-				CPULimits:      "50m",
-				MemoryLimits:   "250Mi",
-				Image:          specConfig.KubernetesImageBase + "ip-masq-agent-amd64:v2.0.0",
+		{
+			Name:            ContainerMonitoringAddonName,
+			ManifestAsset:   "kubernetesmasteraddons-omsagent-daemonset.yaml",
+			DestinationFile: "omsagent-daemonset.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				return &KubernetesAddon{
+					Name:    ContainerMonitoringAddonName,
+					Enabled: helpers.PointerToBool(DefaultContainerMonitoringAddonEnabled),
+					Config: map[string]string{
+						"omsAgentVersion":       "1.6.0-42",
+						"dockerProviderVersion": "2.0.0-3",
+					},
+					Containers: []KubernetesContainerSpec{
+						{
+							Name:           "omsagent",
+							CPURequests:    "50m",
+							MemoryRequests: "200Mi",
+							CPULimits:      "150m",
+							MemoryLimits:   "750Mi",
+							Image:          "microsoft/oms:ciprod11292018",
+						},
+					},
+				}
+			},
+			Enabled: func(p *Properties) bool {
+				return p.OrchestratorProfile.KubernetesConfig.IsContainerMonitoringEnabled()
 			},
 		},
-		Config: map[string]string{
-			"non-masquerade-cidr": cs.Properties.GetNonMasqueradeCIDR(),
-			"non-masq-cni-cidr":   cs.Properties.GetAzureCNICidr(),
+		{
+			Name:            AzureCNINetworkMonitoringAddonName,
+			ManifestAsset:   "azure-cni-networkmonitor.yaml",
+			DestinationFile: "azure-cni-networkmonitor.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				specConfig, k8sComponents := addonImageConfig(cs)
+				return &KubernetesAddon{
+					Name:    AzureCNINetworkMonitoringAddonName,
+					Enabled: azureCNINetworkMonitorAddonEnabled(cs.Properties.OrchestratorProfile),
+					Containers: []KubernetesContainerSpec{
+						{
+							Name:  AzureCNINetworkMonitoringAddonName,
+							Image: specConfig.AzureCNIImageBase + k8sComponents[AzureCNINetworkMonitoringAddonName],
+						},
+					},
+				}
+			},
+			Enabled: func(p *Properties) bool {
+				return p.OrchestratorProfile.IsAzureCNI()
+			},
 		},
-	}
-
-	defaultAzureCNINetworkMonitorAddonsConfig := KubernetesAddon{
-		Name:    AzureCNINetworkMonitoringAddonName,
-		Enabled: azureCNINetworkMonitorAddonEnabled(o),
-		Containers: []KubernetesContainerSpec{
-			{
-				Name:  AzureCNINetworkMonitoringAddonName,
-				Image: specConfig.AzureCNIImageBase + k8sComponents[AzureCNINetworkMonitoringAddonName],
+		{
+			// the manifest of the network policy manager is a master addon, see kubernetesAddonSettingsInit
+			Name: AzureNetworkPolicyAddonName,
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				return &KubernetesAddon{
+					Name:    AzureNetworkPolicyAddonName,
+					Enabled: azureNetworkPolicyAddonEnabled(cs.Properties.OrchestratorProfile),
+					Containers: []KubernetesContainerSpec{
+						{
+							Name: AzureNetworkPolicyAddonName,
+						},
+					},
+				}
 			},
 		},
-	}
-
-	defaultAzureNetworkPolicyAddonsConfig := KubernetesAddon{
-		Name:    AzureNetworkPolicyAddonName,
-		Enabled: azureNetworkPolicyAddonEnabled(o),
-		Containers: []KubernetesContainerSpec{
-			{
-				Name: AzureNetworkPolicyAddonName,
+		{
+			Name:            IPMASQAgentAddonName,
+			ManifestAsset:   "ip-masq-agent.yaml",
+			DestinationFile: "ip-masq-agent.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				specConfig, _ := addonImageConfig(cs)
+				return &KubernetesAddon{
+					Name:    IPMASQAgentAddonName,
+					Enabled: helpers.PointerToBool(IPMasqAgentAddonEnabled),
+					Containers: []KubernetesContainerSpec{
+						{
+							Name:           IPMASQAgentAddonName,
+							CPURequests:    "50m",
+							MemoryRequests: "50Mi",
+							CPULimits:      "50m",
+							MemoryLimits:   "250Mi",
+							Image:          specConfig.KubernetesImageBase + "ip-masq-agent-amd64:v2.0.0",
+						},
+					},
+					Config: map[string]string{
+						"non-masquerade-cidr": cs.Properties.GetNonMasqueradeCIDR(),
+						"non-masq-cni-cidr":   cs.Properties.GetAzureCNICidr(),
+					},
+				}
+			},
+			Enabled: func(p *Properties) bool {
+				return true
 			},
 		},
-	}
-
-	defaultDNSAutoScalerAddonsConfig := KubernetesAddon{
-		Name:    DefaultDNSAutoscalerAddonName,
-		Enabled: helpers.PointerToBool(DefaultDNSAutoscalerAddonEnabled),
-		Containers: []KubernetesContainerSpec{
-			{
-				Name:           DefaultDNSAutoscalerAddonName,
-				Image:          specConfig.KubernetesImageBase + "cluster-proportional-autoscaler-amd64:1.1.1",
-				CPURequests:    "20m",
-				MemoryRequests: "10Mi",
+		{
+			Name:            DefaultDNSAutoscalerAddonName,
+			ManifestAsset:   "dns-autoscaler.yaml",
+			DestinationFile: "dns-autoscaler.yaml",
+			Defaults: func(cs *ContainerService) *KubernetesAddon {
+				specConfig, _ := addonImageConfig(cs)
+				return &KubernetesAddon{
+					Name:    DefaultDNSAutoscalerAddonName,
+					Enabled: helpers.PointerToBool(DefaultDNSAutoscalerAddonEnabled),
+					Containers: []KubernetesContainerSpec{
+						{
+							Name:           DefaultDNSAutoscalerAddonName,
+							Image:          specConfig.KubernetesImageBase + "cluster-proportional-autoscaler-amd64:1.1.1",
+							CPURequests:    "20m",
+							MemoryRequests: "10Mi",
+						},
+					},
+				}
+			},
+			Enabled: func(p *Properties) bool {
+				// TODO enable this when it has been smoke tested
+				//return common.IsKubernetesVersionGe(p.OrchestratorProfile.OrchestratorVersion, "1.12.0")
+				return false
 			},
 		},
 	}
+}
 
-	defaultAddons := []KubernetesAddon{
-		defaultTillerAddonsConfig,
-		defaultACIConnectorAddonsConfig,
-		defaultClusterAutoscalerAddonsConfig,
-		defaultBlobfuseFlexVolumeAddonsConfig,
-		defaultSMBFlexVolumeAddonsConfig,
-		defaultKeyVaultFlexVolumeAddonsConfig,
-		defaultDashboardAddonsConfig,
-		defaultReschedulerAddonsConfig,
-		defaultMetricsServerAddonsConfig,
-		defaultNVIDIADevicePluginAddonsConfig,
-		defaultContainerMonitoringAddonsConfig,
-		defaultAzureCNINetworkMonitorAddonsConfig,
-		defaultAzureNetworkPolicyAddonsConfig,
-		defaultIPMasqAgentAddonsConfig,
-		defaultDNSAutoScalerAddonsConfig,
+// addonImageConfig returns the image repositories of the cloud of cs and the images of the
+// components of its Kubernetes version
+func addonImageConfig(cs *ContainerService) (KubernetesSpecConfig, map[string]string) {
+	return cs.GetCloudSpecConfig().KubernetesSpecConfig, K8sComponentsByVersionMap[cs.Properties.OrchestratorProfile.OrchestratorVersion]
+}
+
+func (cs *ContainerService) setAddonsConfig(isUpdate bool) {
+	o := cs.Properties.OrchestratorProfile
+	var defaultAddons []KubernetesAddon
+	for _, d := range cs.AddonRegistry().Addons() {
+		if addon := d.defaultAddon(cs); addon != nil {
+			defaultAddons = append(defaultAddons, *addon)
+		}
 	}
 	// Add default addons specification, if no user-provided spec exists
 	if o.KubernetesConfig.Addons == nil {
@@ -279,6 +433,10 @@ func (cs *ContainerService) setAddonsConfig(isUpdate bool) {
 	for _, addon := range defaultAddons {
 		synthesizeAddonsConfig(o.KubernetesConfig.Addons, addon, false, isUpdate)
 	}
+
+	for i := range o.KubernetesConfig.Addons {
+		setChartAddonDefaults(&o.KubernetesConfig.Addons[i])
+	}
 }
 
 func getAddonsIndexByName(addons []KubernetesAddon, name string) int {
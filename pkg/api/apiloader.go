@@ -65,7 +65,7 @@ func LoadDefaultContainerServiceProperties() (TypeMeta, *vlabs.Properties) {
 func (a *Apiloader) DeserializeContainerService(contents []byte, validate, isUpdate bool, existingContainerService *ContainerService) (*ContainerService, string, error) {
 	m := &TypeMeta{}
 	if err := json.Unmarshal(contents, &m); err != nil {
-		return nil, "", err
+		return nil, "", jsonError(contents, err)
 	}
 
 	version := m.APIVersion
@@ -95,7 +95,7 @@ func (a *Apiloader) LoadContainerService(
 	case v20160930.APIVersion:
 		containerService := &v20160930.ContainerService{}
 		if e := json.Unmarshal(contents, &containerService); e != nil {
-			return nil, e
+			return nil, jsonError(contents, e)
 		}
 		if hasExistingCS {
 			vecs := ConvertContainerServiceToV20160930(existingContainerService)
@@ -118,7 +118,7 @@ func (a *Apiloader) LoadContainerService(
 	case v20160330.APIVersion:
 		containerService := &v20160330.ContainerService{}
 		if e := json.Unmarshal(contents, &containerService); e != nil {
-			return nil, e
+			return nil, jsonError(contents, e)
 		}
 		if hasExistingCS {
 			vecs := ConvertContainerServiceToV20160330(existingContainerService)
@@ -142,7 +142,7 @@ func (a *Apiloader) LoadContainerService(
 	case v20170131.APIVersion:
 		containerService := &v20170131.ContainerService{}
 		if e := json.Unmarshal(contents, &containerService); e != nil {
-			return nil, e
+			return nil, jsonError(contents, e)
 		}
 		if hasExistingCS {
 			vecs := ConvertContainerServiceToV20170131(existingContainerService)
@@ -166,7 +166,7 @@ func (a *Apiloader) LoadContainerService(
 	case v20170701.APIVersion:
 		containerService := &v20170701.ContainerService{}
 		if e := json.Unmarshal(contents, &containerService); e != nil {
-			return nil, e
+			return nil, jsonError(contents, e)
 		}
 		if hasExistingCS {
 			vecs := ConvertContainerServiceToV20170701(existingContainerService)
@@ -191,7 +191,7 @@ func (a *Apiloader) LoadContainerService(
 	case vlabs.APIVersion:
 		containerService := &vlabs.ContainerService{}
 		if e := json.Unmarshal(contents, &containerService); e != nil {
-			return nil, e
+			return nil, jsonError(contents, e)
 		}
 		if e := checkJSONKeys(contents, reflect.TypeOf(*containerService), reflect.TypeOf(TypeMeta{})); e != nil {
 			return nil, e
@@ -0,0 +1,50 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/pkg/errors"
+)
+
+// IsChart tells whether the addon installs a Helm chart rather than a manifest
+func (a *KubernetesAddon) IsChart() bool {
+	return a.Chart != nil
+}
+
+// IsPackaged tells whether the chart is a packaged chart delivered with the template
+func (c *HelmChart) IsPackaged() bool {
+	return c.Path != ""
+}
+
+// setChartAddonDefaults enables a chart addon unless it is disabled, and defaults the namespace
+// of its release and the name of its chart
+func setChartAddonDefaults(addon *KubernetesAddon) {
+	if !addon.IsChart() {
+		return
+	}
+	if addon.Enabled == nil {
+		addon.Enabled = helpers.PointerToBool(true)
+	}
+	if addon.Chart.Namespace == "" {
+		addon.Chart.Namespace = DefaultChartAddonNamespace
+	}
+	if !addon.Chart.IsPackaged() && addon.Chart.Name == "" {
+		addon.Chart.Name = addon.Name
+	}
+}
+
+// validateChartAddon validates an enabled chart addon of the cluster cs
+func (cs *ContainerService) validateChartAddon(addon KubernetesAddon) error {
+	if !addonNameRegex.MatchString(addon.Name) {
+		return errors.Errorf("chart addon name '%s' can only contain lowercase alphanumerics and dashes", addon.Name)
+	}
+	if cs.AddonRegistry().Get(addon.Name) != nil {
+		return errors.Errorf("addon %s deploys a manifest and cannot install a chart", addon.Name)
+	}
+	if !cs.Properties.OrchestratorProfile.KubernetesConfig.IsTillerEnabled() {
+		return errors.Errorf("chart addon %s requires the %s addon", addon.Name, DefaultTillerAddonName)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/helpers"
+)
+
+func TestChartAddonDefaultsAndValidation(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.10.8", 1, 3, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.Addons = []KubernetesAddon{
+		{Name: "my-chart", Chart: &HelmChart{Repository: "https://contoso.github.io/charts"}},
+		{Name: "my-packaged-chart", Chart: &HelmChart{Path: "my-packaged-chart.tgz", Namespace: "default"}},
+	}
+	cs.setAddonsConfig(false)
+	k := cs.Properties.OrchestratorProfile.KubernetesConfig
+	chart := k.GetAddonByName("my-chart")
+	if !helpers.IsTrueBoolPointer(chart.Enabled) || chart.Chart.Name != "my-chart" || chart.Chart.Namespace != DefaultChartAddonNamespace {
+		t.Fatalf("expected the chart addon to be enabled with the defaults of its chart, got %+v", chart.Chart)
+	}
+	packaged := k.GetAddonByName("my-packaged-chart")
+	if packaged.Chart.Name != "" || packaged.Chart.Namespace != "default" {
+		t.Fatalf("expected the packaged chart to keep its namespace and have no name, got %+v", packaged.Chart)
+	}
+	if err := cs.ValidateAddons(); err != nil {
+		t.Fatalf("unexpected error validating the chart addons: %s", err)
+	}
+
+	i := getAddonsIndexByName(k.Addons, DefaultTillerAddonName)
+	k.Addons[i].Enabled = helpers.PointerToBool(false)
+	if err := cs.ValidateAddons(); err == nil {
+		t.Fatalf("expected an error for chart addons without tiller")
+	}
+	k.Addons[i].Enabled = helpers.PointerToBool(true)
+
+	k.Addons = append(k.Addons, KubernetesAddon{Name: "Invalid_Chart", Chart: &HelmChart{Path: "chart.tgz"}})
+	if err := cs.ValidateAddons(); err == nil {
+		t.Fatalf("expected an error for an invalid chart addon name")
+	}
+	k.Addons[len(k.Addons)-1].Enabled = helpers.PointerToBool(false)
+	if err := cs.ValidateAddons(); err != nil {
+		t.Fatalf("unexpected error validating a disabled chart addon: %s", err)
+	}
+
+	i = getAddonsIndexByName(k.Addons, DefaultDashboardAddonName)
+	k.Addons[i].Chart = &HelmChart{Repository: "https://contoso.github.io/charts"}
+	if err := cs.ValidateAddons(); err == nil {
+		t.Fatalf("expected an error for a chart addon named after a built-in addon")
+	}
+}
@@ -487,6 +487,13 @@ func convertPropertiesToVLabs(api *Properties, vlabsProps *vlabs.Properties) {
 		vlabsProps.FeatureFlags = &vlabs.FeatureFlags{}
 		convertFeatureFlagsToVLabs(api.FeatureFlags, vlabsProps.FeatureFlags)
 	}
+
+	if api.SecretsKeyvault != nil {
+		vlabsProps.SecretsKeyvault = &vlabs.SecretsKeyvault{
+			VaultID:          api.SecretsKeyvault.VaultID,
+			SecretNamePrefix: api.SecretsKeyvault.SecretNamePrefix,
+		}
+	}
 }
 
 func convertLinuxProfileToV20160930(api *LinuxProfile, obj *v20160930.LinuxProfile) {
@@ -854,6 +861,15 @@ func convertAddonsToVlabs(a *KubernetesConfig, v *vlabs.KubernetesConfig) {
 			Config:  map[string]string{},
 			Data:    a.Addons[i].Data,
 		})
+		if a.Addons[i].Chart != nil {
+			v.Addons[i].Chart = &vlabs.HelmChart{
+				Path:       a.Addons[i].Chart.Path,
+				Repository: a.Addons[i].Chart.Repository,
+				Name:       a.Addons[i].Chart.Name,
+				Version:    a.Addons[i].Chart.Version,
+				Namespace:  a.Addons[i].Chart.Namespace,
+			}
+		}
 		for j := range a.Addons[i].Containers {
 			v.Addons[i].Containers = append(v.Addons[i].Containers, vlabs.KubernetesContainerSpec{
 				Name:           a.Addons[i].Containers[j].Name,
@@ -1026,6 +1042,9 @@ func convertAgentPoolProfileToVLabs(api *AgentPoolProfile, p *vlabs.AgentPoolPro
 	p.AcceleratedNetworkingEnabledWindows = api.AcceleratedNetworkingEnabledWindows
 	p.AvailabilityZones = api.AvailabilityZones
 	p.SinglePlacementGroup = api.SinglePlacementGroup
+	p.EnableAutoScaling = api.EnableAutoScaling
+	p.MinCount = api.MinCount
+	p.MaxCount = api.MaxCount
 
 	for k, v := range api.CustomNodeLabels {
 		p.CustomNodeLabels[k] = v
@@ -1173,6 +1192,12 @@ func convertCertificateProfileToVLabs(api *CertificateProfile, vlabs *vlabs.Cert
 	vlabs.EtcdClientPrivateKey = api.EtcdClientPrivateKey
 	vlabs.EtcdPeerCertificates = api.EtcdPeerCertificates
 	vlabs.EtcdPeerPrivateKeys = api.EtcdPeerPrivateKeys
+	vlabs.CaCertificateChain = api.CaCertificateChain
+	vlabs.KeyAlgorithm = api.KeyAlgorithm
+	vlabs.KeySize = api.KeySize
+	vlabs.CaValidityDays = api.CaValidityDays
+	vlabs.ServerValidityDays = api.ServerValidityDays
+	vlabs.ClientValidityDays = api.ClientValidityDays
 }
 
 func convertAADProfileToVLabs(api *AADProfile, vlabs *vlabs.AADProfile) {
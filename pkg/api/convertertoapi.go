@@ -407,6 +407,13 @@ func convertVLabsProperties(vlabs *vlabs.Properties, api *Properties, isUpdate b
 		api.FeatureFlags = &FeatureFlags{}
 		convertVLabsFeatureFlags(vlabs.FeatureFlags, api.FeatureFlags)
 	}
+
+	if vlabs.SecretsKeyvault != nil {
+		api.SecretsKeyvault = &SecretsKeyvault{
+			VaultID:          vlabs.SecretsKeyvault.VaultID,
+			SecretNamePrefix: vlabs.SecretsKeyvault.SecretNamePrefix,
+		}
+	}
 }
 
 func convertVLabsAZProfile(vlabs *vlabs.AzProfile, api *AzProfile) {
@@ -776,6 +783,15 @@ func convertAddonsToAPI(v *vlabs.KubernetesConfig, a *KubernetesConfig) {
 			Config:  map[string]string{},
 			Data:    v.Addons[i].Data,
 		})
+		if v.Addons[i].Chart != nil {
+			a.Addons[i].Chart = &HelmChart{
+				Path:       v.Addons[i].Chart.Path,
+				Repository: v.Addons[i].Chart.Repository,
+				Name:       v.Addons[i].Chart.Name,
+				Version:    v.Addons[i].Chart.Version,
+				Namespace:  v.Addons[i].Chart.Namespace,
+			}
+		}
 		for j := range v.Addons[i].Containers {
 			a.Addons[i].Containers = append(a.Addons[i].Containers, KubernetesContainerSpec{
 				Name:           v.Addons[i].Containers[j].Name,
@@ -1047,6 +1063,9 @@ func convertVLabsAgentPoolProfile(vlabs *vlabs.AgentPoolProfile, api *AgentPoolP
 	api.AcceleratedNetworkingEnabledWindows = vlabs.AcceleratedNetworkingEnabledWindows
 	api.AvailabilityZones = vlabs.AvailabilityZones
 	api.SinglePlacementGroup = vlabs.SinglePlacementGroup
+	api.EnableAutoScaling = vlabs.EnableAutoScaling
+	api.MinCount = vlabs.MinCount
+	api.MaxCount = vlabs.MaxCount
 
 	api.CustomNodeLabels = map[string]string{}
 	for k, v := range vlabs.CustomNodeLabels {
@@ -1208,6 +1227,12 @@ func convertVLabsCertificateProfile(vlabs *vlabs.CertificateProfile, api *Certif
 	api.EtcdClientPrivateKey = vlabs.EtcdClientPrivateKey
 	api.EtcdPeerCertificates = vlabs.EtcdPeerCertificates
 	api.EtcdPeerPrivateKeys = vlabs.EtcdPeerPrivateKeys
+	api.CaCertificateChain = vlabs.CaCertificateChain
+	api.KeyAlgorithm = vlabs.KeyAlgorithm
+	api.KeySize = vlabs.KeySize
+	api.CaValidityDays = vlabs.CaValidityDays
+	api.ServerValidityDays = vlabs.ServerValidityDays
+	api.ClientValidityDays = vlabs.ClientValidityDays
 }
 
 func convertVLabsAADProfile(vlabs *vlabs.AADProfile, api *AADProfile) {
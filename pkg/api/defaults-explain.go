@@ -0,0 +1,74 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultsStep is the state of the properties of a container service after one of the
+// rules of SetPropertiesDefaults ran
+type DefaultsStep struct {
+	// Rule is the function that set the defaults, such as setKubeletConfig. It is empty
+	// for the properties as they were before any default was set.
+	Rule string
+	// Because lists the values of the fields the rule depends on, such as networkPlugin=azure
+	Because string
+	// Properties are the properties of the container service after the rule ran, as JSON
+	Properties []byte
+}
+
+// ExplainDefaults makes SetPropertiesDefaults record the properties after each of its
+// rules, for the caller to tell which rule set which default
+func (cs *ContainerService) ExplainDefaults() {
+	cs.defaultsSteps = &[]DefaultsStep{}
+}
+
+// DefaultsSteps returns the steps recorded by SetPropertiesDefaults since ExplainDefaults was called
+func (cs *ContainerService) DefaultsSteps() []DefaultsStep {
+	if cs.defaultsSteps == nil {
+		return nil
+	}
+	return *cs.defaultsSteps
+}
+
+// traceDefaults records the properties after rule ran. because are pairs of names and
+// values of the fields the rule depends on; pairs without a value are left out.
+func (cs *ContainerService) traceDefaults(rule string, because ...string) {
+	if cs.defaultsSteps == nil {
+		return
+	}
+	properties, err := json.Marshal(cs.Properties)
+	if err != nil {
+		// the defaults of a step that cannot be recorded are attributed to the next one
+		return
+	}
+	reasons := []string{}
+	for i := 0; i+1 < len(because); i += 2 {
+		if because[i+1] != "" {
+			reasons = append(reasons, fmt.Sprintf("%s=%s", because[i], because[i+1]))
+		}
+	}
+	*cs.defaultsSteps = append(*cs.defaultsSteps, DefaultsStep{
+		Rule:       rule,
+		Because:    strings.Join(reasons, ", "),
+		Properties: properties,
+	})
+}
+
+// orchestratorInputs returns the orchestrator type and, for Kubernetes, the network
+// plugin and version, which most rules depend on
+func orchestratorInputs(p *Properties) []string {
+	if p.OrchestratorProfile == nil {
+		return nil
+	}
+	o := p.OrchestratorProfile
+	inputs := []string{"orchestratorType", o.OrchestratorType}
+	if o.KubernetesConfig != nil {
+		inputs = append(inputs, "networkPlugin", o.KubernetesConfig.NetworkPlugin)
+	}
+	return inputs
+}
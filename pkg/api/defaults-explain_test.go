@@ -0,0 +1,50 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestExplainDefaults(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.10.8", 3, 2, false)
+	if _, err := cs.SetPropertiesDefaults(false, false); err != nil {
+		t.Fatalf("unexpected error setting defaults: %s", err)
+	}
+	if steps := cs.DefaultsSteps(); steps != nil {
+		t.Fatalf("expected no steps unless ExplainDefaults is called, got %d", len(steps))
+	}
+
+	cs = CreateMockContainerService("testcluster", "1.10.8", 3, 2, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.NetworkPlugin = NetworkPluginAzure
+	cs.ExplainDefaults()
+	if _, err := cs.SetPropertiesDefaults(false, false); err != nil {
+		t.Fatalf("unexpected error setting defaults: %s", err)
+	}
+	steps := cs.DefaultsSteps()
+	if len(steps) == 0 || steps[0].Rule != "" {
+		t.Fatalf("expected the properties before any default to be recorded first, got %v", steps)
+	}
+
+	var kubelet *DefaultsStep
+	for i := range steps {
+		if steps[i].Rule == "setKubeletConfig" {
+			kubelet = &steps[i]
+		}
+	}
+	if kubelet == nil {
+		t.Fatalf("expected setKubeletConfig to be recorded")
+	}
+	if kubelet.Because != "orchestratorVersion=1.10.8, networkPlugin=azure" {
+		t.Errorf("unexpected inputs of setKubeletConfig: %s", kubelet.Because)
+	}
+	properties := Properties{}
+	if err := json.Unmarshal(kubelet.Properties, &properties); err != nil {
+		t.Fatalf("unable to decode the properties set by setKubeletConfig: %s", err)
+	}
+	if properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--max-pods"] != "30" {
+		t.Errorf("expected setKubeletConfig to set --max-pods to 30 with Azure CNI, got %v", properties.OrchestratorProfile.KubernetesConfig.KubeletConfig)
+	}
+}
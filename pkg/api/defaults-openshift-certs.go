@@ -8,6 +8,7 @@ import (
 	"net"
 
 	"github.com/Azure/acs-engine/pkg/api/common"
+	"github.com/Azure/acs-engine/pkg/helpers"
 	"github.com/Azure/acs-engine/pkg/openshift/certgen/release39"
 	"github.com/Azure/acs-engine/pkg/openshift/certgen/unstable"
 )
@@ -69,6 +70,8 @@ func createR39Config(a *Properties, orchestratorName, clusterID string) *release
 			SecurityGroupName:          fmt.Sprintf("%s-master-%s-nsg", orchestratorName, clusterID),
 			PrimaryAvailabilitySetName: fmt.Sprintf("compute-availabilityset-%s", clusterID),
 		},
+		PkiOptions: a.CertificateProfile.PkiOptions(),
+		CA:         openShiftCA(a.CertificateProfile),
 	}
 }
 
@@ -95,5 +98,16 @@ func createUnstableReleaseConfig(a *Properties, orchestratorName, clusterID stri
 			SecurityGroupName:          fmt.Sprintf("%s-master-%s-nsg", orchestratorName, clusterID),
 			PrimaryAvailabilitySetName: fmt.Sprintf("compute-availabilityset-%s", clusterID),
 		},
+		PkiOptions: a.CertificateProfile.PkiOptions(),
+		CA:         openShiftCA(a.CertificateProfile),
 	}
 }
+
+// openShiftCA returns the certificate authority OpenShift certgen signs the cluster certificates
+// with, when certificateProfile sets one issued by a certificate chain
+func openShiftCA(c *CertificateProfile) *helpers.PkiKeyCertPair {
+	if c == nil || c.CaCertificateChain == "" {
+		return nil
+	}
+	return &helpers.PkiKeyCertPair{CertificatePem: c.CaCertificate, PrivateKeyPem: c.CaPrivateKey}
+}
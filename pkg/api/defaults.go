@@ -5,10 +5,10 @@ package api
 
 import (
 	"bytes"
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"net"
 	"sort"
 	"strconv"
@@ -23,36 +23,45 @@ import (
 // SetPropertiesDefaults for the container Properties, returns true if certs are generated
 func (cs *ContainerService) SetPropertiesDefaults(isUpgrade, isScale bool) (bool, error) {
 	properties := cs.Properties
+	cs.traceDefaults("")
 
 	cs.setOrchestratorDefaults(isUpgrade || isScale)
 
 	// Set master profile defaults if this cluster configuration includes master node(s)
 	if cs.Properties.MasterProfile != nil {
 		properties.setMasterProfileDefaults(isUpgrade)
+		cs.traceDefaults("setMasterProfileDefaults", orchestratorInputs(properties)...)
 	}
 	// Set VMSS Defaults for Masters
 	if cs.Properties.MasterProfile != nil && cs.Properties.MasterProfile.IsVirtualMachineScaleSets() {
 		properties.setVMSSDefaultsForMasters()
+		cs.traceDefaults("setVMSSDefaultsForMasters", "masterProfile.availabilityProfile", VirtualMachineScaleSets)
 	}
 
 	properties.setAgentProfileDefaults(isUpgrade, isScale)
+	cs.traceDefaults("setAgentProfileDefaults", orchestratorInputs(properties)...)
 
 	properties.setStorageDefaults()
+	cs.traceDefaults("setStorageDefaults")
 	properties.setExtensionDefaults()
+	cs.traceDefaults("setExtensionDefaults")
 	// Set VMSS Defaults for Agents
 	if cs.Properties.HasVMSSAgentPool() {
 		properties.setVMSSDefaultsForAgents()
+		cs.traceDefaults("setVMSSDefaultsForAgents", "agentPoolProfiles.availabilityProfile", VirtualMachineScaleSets)
 	}
 
 	// Set hosted master profile defaults if this cluster configuration has a hosted control plane
 	if cs.Properties.HostedMasterProfile != nil {
 		properties.setHostedMasterProfileDefaults()
+		cs.traceDefaults("setHostedMasterProfileDefaults")
 	}
 
-	certsGenerated, _, e := properties.setDefaultCerts()
+	certsGenerated, _, e := properties.setDefaultCerts(cs.secretSource)
 	if e != nil {
 		return false, e
 	}
+	cs.traceDefaults("setDefaultCerts", orchestratorInputs(properties)...)
 	return certsGenerated, nil
 }
 
@@ -65,9 +74,11 @@ func (cs *ContainerService) setOrchestratorDefaults(isUpdate bool) {
 		return
 	}
 	o := a.OrchestratorProfile
+	requestedVersion := o.OrchestratorVersion
 	o.OrchestratorVersion = common.GetValidPatchVersion(
 		o.OrchestratorType,
 		o.OrchestratorVersion, isUpdate, a.HasWindows())
+	cs.traceDefaults("GetValidPatchVersion", "orchestratorType", o.OrchestratorType, "orchestratorVersion", requestedVersion)
 
 	switch o.OrchestratorType {
 	case Kubernetes:
@@ -178,7 +189,7 @@ func (cs *ContainerService) setOrchestratorDefaults(isUpdate bool) {
 
 		if helpers.IsTrueBoolPointer(o.KubernetesConfig.EnableDataEncryptionAtRest) {
 			if "" == a.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey {
-				a.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey = generateEtcdEncryptionKey()
+				a.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey = generateEtcdEncryptionKey(cs.secretSource)
 			}
 		}
 
@@ -228,18 +239,27 @@ func (cs *ContainerService) setOrchestratorDefaults(isUpdate bool) {
 			}
 		}
 
+		cs.traceDefaults("setOrchestratorDefaults", "networkPolicy", o.KubernetesConfig.NetworkPolicy, "networkPlugin", o.KubernetesConfig.NetworkPlugin,
+			"orchestratorVersion", o.OrchestratorVersion, "totalNodes", strconv.Itoa(a.TotalNodes()))
+
 		// Configure addons
 		cs.setAddonsConfig(isUpdate)
+		cs.traceDefaults("setAddonsConfig", "orchestratorVersion", o.OrchestratorVersion, "networkPolicy", o.KubernetesConfig.NetworkPolicy)
 		// Configure kubelet
 		cs.setKubeletConfig()
+		cs.traceDefaults("setKubeletConfig", "orchestratorVersion", o.OrchestratorVersion, "networkPlugin", o.KubernetesConfig.NetworkPlugin, "networkPolicy", o.KubernetesConfig.NetworkPolicy)
 		// Configure controller-manager
 		cs.setControllerManagerConfig()
+		cs.traceDefaults("setControllerManagerConfig", "orchestratorVersion", o.OrchestratorVersion)
 		// Configure cloud-controller-manager
 		cs.setCloudControllerManagerConfig()
+		cs.traceDefaults("setCloudControllerManagerConfig", "orchestratorVersion", o.OrchestratorVersion)
 		// Configure apiserver
 		cs.setAPIServerConfig()
+		cs.traceDefaults("setAPIServerConfig", "orchestratorVersion", o.OrchestratorVersion)
 		// Configure scheduler
 		cs.setSchedulerConfig()
+		cs.traceDefaults("setSchedulerConfig", "orchestratorVersion", o.OrchestratorVersion)
 
 	case DCOS:
 		if o.DcosConfig == nil {
@@ -255,6 +275,7 @@ func (cs *ContainerService) setOrchestratorDefaults(isUpdate bool) {
 				o.DcosConfig.BootstrapProfile.VMSize = "Standard_D2s_v3"
 			}
 		}
+		cs.traceDefaults("setOrchestratorDefaults", "orchestratorType", o.OrchestratorType, "orchestratorVersion", o.OrchestratorVersion)
 	case OpenShift:
 		kc := a.OrchestratorProfile.OpenShiftConfig.KubernetesConfig
 		if kc == nil {
@@ -266,6 +287,7 @@ func (cs *ContainerService) setOrchestratorDefaults(isUpdate bool) {
 		if kc.NetworkPlugin == "" {
 			kc.NetworkPlugin = DefaultNetworkPlugin
 		}
+		cs.traceDefaults("setOrchestratorDefaults", "orchestratorType", o.OrchestratorType, "orchestratorVersion", o.OrchestratorVersion)
 	}
 }
 
@@ -515,7 +537,7 @@ func (p *Properties) setHostedMasterProfileDefaults() {
 	p.HostedMasterProfile.Subnet = DefaultKubernetesMasterSubnet
 }
 
-func (p *Properties) setDefaultCerts() (bool, []net.IP, error) {
+func (p *Properties) setDefaultCerts(source *helpers.SecretSource) (bool, []net.IP, error) {
 	if p.MasterProfile != nil && p.OrchestratorProfile.OrchestratorType == OpenShift {
 		return setOpenShiftSetDefaultCerts(p, DefaultOpenshiftOrchestratorName, p.GetClusterID())
 	}
@@ -570,7 +592,7 @@ func (p *Properties) setDefaultCerts() (bool, []net.IP, error) {
 		caPair = &helpers.PkiKeyCertPair{CertificatePem: p.CertificateProfile.CaCertificate, PrivateKeyPem: p.CertificateProfile.CaPrivateKey}
 	} else {
 		var err error
-		caPair, err = helpers.CreatePkiKeyCertPair("ca")
+		caPair, err = helpers.CreatePkiKeyCertPair("ca", source, p.CertificateProfile.PkiOptions())
 		if err != nil {
 			return false, ips, err
 		}
@@ -584,7 +606,7 @@ func (p *Properties) setDefaultCerts() (bool, []net.IP, error) {
 	}
 	ips = append(ips, cidrFirstIP)
 
-	apiServerPair, clientPair, kubeConfigPair, etcdServerPair, etcdClientPair, etcdPeerPairs, err := helpers.CreatePki(masterExtraFQDNs, ips, DefaultKubernetesClusterDomain, caPair, p.MasterProfile.Count)
+	apiServerPair, clientPair, kubeConfigPair, etcdServerPair, etcdClientPair, etcdPeerPairs, err := helpers.CreatePki(masterExtraFQDNs, ips, DefaultKubernetesClusterDomain, caPair, p.MasterProfile.Count, source, p.CertificateProfile.PkiOptions())
 	if err != nil {
 		return false, ips, err
 	}
@@ -711,8 +733,8 @@ func mapToString(valueMap map[string]string) string {
 	return strings.TrimSuffix(buf.String(), ",")
 }
 
-func generateEtcdEncryptionKey() string {
+func generateEtcdEncryptionKey(source *helpers.SecretSource) string {
 	b := make([]byte, 32)
-	rand.Read(b)
+	io.ReadFull(source.Reader("etcdEncryptionKey"), b)
 	return base64.StdEncoding.EncodeToString(b)
 }
@@ -549,8 +549,8 @@ func TestEtcdDiskSize(t *testing.T) {
 }
 
 func TestGenerateEtcdEncryptionKey(t *testing.T) {
-	key1 := generateEtcdEncryptionKey()
-	key2 := generateEtcdEncryptionKey()
+	key1 := generateEtcdEncryptionKey(nil)
+	key2 := generateEtcdEncryptionKey(nil)
 	if key1 == key2 {
 		t.Fatalf("generateEtcdEncryptionKey should return a unique key each time, instead returned identical %s and %s", key1, key2)
 	}
@@ -1265,7 +1265,7 @@ func TestSetCertDefaults(t *testing.T) {
 
 	cs.setOrchestratorDefaults(false)
 	cs.Properties.setMasterProfileDefaults(false)
-	result, ips, err := cs.Properties.setDefaultCerts()
+	result, ips, err := cs.Properties.setDefaultCerts(nil)
 
 	if !result {
 		t.Error("expected setDefaultCerts to return true")
@@ -1330,7 +1330,7 @@ func TestSetOpenShiftCertDefaults(t *testing.T) {
 
 	cs.Properties.setMasterProfileDefaults(false)
 
-	result, _, err := cs.Properties.setDefaultCerts()
+	result, _, err := cs.Properties.setDefaultCerts(nil)
 	if !result {
 		t.Error("expected setOpenShiftDefaultCerts to return true")
 	}
@@ -1366,7 +1366,7 @@ func TestSetOpenShiftCertDefaults(t *testing.T) {
 	}
 
 	cs.Properties.setMasterProfileDefaults(false)
-	result, _, err = cs.Properties.setDefaultCerts()
+	result, _, err = cs.Properties.setDefaultCerts(nil)
 
 	if !result {
 		t.Error("expected setOpenShiftDefaultCerts to return true")
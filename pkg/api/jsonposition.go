@@ -0,0 +1,142 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// JSONFieldError is an error about a field of a JSON document
+type JSONFieldError struct {
+	// Path is the JSON path of the field, such as $.properties.agentPoolProfiles[0].count
+	Path string
+	// Line and Column locate the field in the document, starting at 1
+	Line   int
+	Column int
+	Err    error
+}
+
+// Error implements error interface
+func (e *JSONFieldError) Error() string {
+	return fmt.Sprintf("%s (line %d, column %d): %s", e.Path, e.Line, e.Column, e.Err)
+}
+
+// jsonPosition is the offset of a field in a JSON document
+type jsonPosition struct {
+	path   string
+	offset int
+}
+
+// jsonPositions indexes the fields of a JSON document, in document order. Object members are
+// located by their key, array items and the root by their value.
+type jsonPositions struct {
+	data      []byte
+	positions []jsonPosition
+}
+
+const jsonRootPath = "$"
+
+// newJSONPositions indexes data, as far as it is valid JSON
+func newJSONPositions(data []byte) *jsonPositions {
+	p := &jsonPositions{data: data}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	p.index(d, jsonRootPath, p.next(d))
+	return p
+}
+
+// index records the value at path, which starts at offset
+func (p *jsonPositions) index(d *json.Decoder, path string, offset int) error {
+	p.positions = append(p.positions, jsonPosition{path: path, offset: offset})
+	t, err := d.Token()
+	if err != nil {
+		return err
+	}
+	switch t {
+	case json.Delim('{'):
+		for d.More() {
+			keyOffset := p.next(d)
+			key, err := d.Token()
+			if err != nil {
+				return err
+			}
+			if err := p.index(d, fmt.Sprintf("%s.%s", path, key), keyOffset); err != nil {
+				return err
+			}
+		}
+		_, err = d.Token()
+	case json.Delim('['):
+		for i := 0; d.More(); i++ {
+			if err := p.index(d, fmt.Sprintf("%s[%d]", path, i), p.next(d)); err != nil {
+				return err
+			}
+		}
+		_, err = d.Token()
+	}
+	return err
+}
+
+// next returns the offset of the next token of d
+func (p *jsonPositions) next(d *json.Decoder) int {
+	offset := int(d.InputOffset())
+	for offset < len(p.data) {
+		switch p.data[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// fieldError returns an error located at the field at path, or at the root if it is not indexed
+func (p *jsonPositions) fieldError(path string, err error) *JSONFieldError {
+	offset := 0
+	for _, position := range p.positions {
+		if position.path == path {
+			offset = position.offset
+			break
+		}
+	}
+	return p.errorAt(path, offset, err)
+}
+
+// offsetError returns an error located at the field containing offset
+func (p *jsonPositions) offsetError(offset int, err error) *JSONFieldError {
+	path := jsonRootPath
+	for _, position := range p.positions {
+		if position.offset >= offset {
+			break
+		}
+		path = position.path
+	}
+	return p.errorAt(path, offset, err)
+}
+
+func (p *jsonPositions) errorAt(path string, offset int, err error) *JSONFieldError {
+	line, column := 1, 1
+	for i := 0; i < offset && i < len(p.data); i++ {
+		if p.data[i] == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return &JSONFieldError{Path: path, Line: line, Column: column, Err: err}
+}
+
+// jsonError locates the syntax and type errors of unmarshaling data, and returns other errors unchanged
+func jsonError(data []byte, err error) error {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return newJSONPositions(data).offsetError(int(e.Offset), err)
+	case *json.UnmarshalTypeError:
+		return newJSONPositions(data).offsetError(int(e.Offset), err)
+	}
+	return err
+}
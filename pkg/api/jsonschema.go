@@ -0,0 +1,295 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Azure/acs-engine/pkg/api/vlabs"
+	"github.com/pkg/errors"
+)
+
+// ValidateAPIModelSchema validates an apimodel against the JSON Schema of its API version, and returns
+// an error for each invalid field. Only vlabs apimodels have a schema; other versions and agent pool
+// only apimodels are not checked.
+func ValidateAPIModelSchema(contents []byte) ([]*JSONFieldError, error) {
+	m := &TypeMeta{}
+	if err := json.Unmarshal(contents, &m); err != nil {
+		return nil, jsonError(contents, err)
+	}
+	if m.APIVersion != vlabs.APIVersion || isAgentPoolOnlyClusterJSON(contents) {
+		return nil, nil
+	}
+	return ValidateJSONSchema(contents, vlabs.JSONSchema())
+}
+
+// ValidateJSONSchema validates a JSON document against a JSON Schema, and returns an error for each invalid field.
+// It supports the keywords of the schemas generated for the apimodel, and like the apimodel loader, it matches
+// property names case insensitively and accepts null for any field.
+func ValidateJSONSchema(contents []byte, schema map[string]interface{}) ([]*JSONFieldError, error) {
+	var document interface{}
+	d := json.NewDecoder(bytes.NewReader(contents))
+	d.UseNumber()
+	if err := d.Decode(&document); err != nil {
+		return nil, jsonError(contents, err)
+	}
+
+	v := &schemaValidator{root: schema}
+	v.validate(document, schema, jsonRootPath)
+
+	positions := newJSONPositions(contents)
+	errs := make([]*JSONFieldError, 0, len(v.errs))
+	for _, e := range v.errs {
+		errs = append(errs, positions.fieldError(e.path, e.err))
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Line < errs[j].Line || errs[i].Line == errs[j].Line && errs[i].Column < errs[j].Column
+	})
+	return errs, nil
+}
+
+type schemaValidator struct {
+	root map[string]interface{}
+	errs []keyError
+}
+
+func (v *schemaValidator) fail(path string, format string, args ...interface{}) {
+	v.errs = append(v.errs, keyError{path: path, err: errors.Errorf(format, args...)})
+}
+
+func (v *schemaValidator) validate(value interface{}, schema map[string]interface{}, path string) {
+	// the loader unmarshals null as the zero value of any field
+	if value == nil {
+		return
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := v.resolve(ref)
+		if err != nil {
+			v.fail(path, "%s", err)
+			return
+		}
+		schema = resolved
+	}
+
+	if t, ok := schema["type"].(string); ok && !isJSONType(value, t) {
+		v.fail(path, "expected %s, got %s", articled(t), articled(jsonType(value)))
+		return
+	}
+	if enum, ok := schema["enum"]; ok && !inEnum(value, enum) {
+		if values := reflect.ValueOf(enum); values.Len() > 10 {
+			v.fail(path, "%s is not one of the %d allowed values", formatJSON(value), values.Len())
+		} else {
+			v.fail(path, "%s is not one of the allowed values %s", formatJSON(value), formatJSON(enum))
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		v.validateAnyOf(value, anyOf, path)
+	}
+
+	switch value := value.(type) {
+	case string:
+		if pattern, ok := schema["pattern"].(string); ok {
+			if matched, err := regexp.MatchString(pattern, value); err != nil || !matched {
+				v.fail(path, "%q does not match the pattern %s", value, pattern)
+			}
+		}
+		length := utf8.RuneCountInString(value)
+		if min, ok := number(schema["minLength"]); ok && float64(length) < min {
+			v.fail(path, "must be at least %v characters long", min)
+		}
+		if max, ok := number(schema["maxLength"]); ok && float64(length) > max {
+			v.fail(path, "must be at most %v characters long", max)
+		}
+	case json.Number:
+		n, _ := value.Float64()
+		if min, ok := number(schema["minimum"]); ok && n < min {
+			v.fail(path, "must be at least %v", min)
+		}
+		if max, ok := number(schema["maximum"]); ok && n > max {
+			v.fail(path, "must be at most %v", max)
+		}
+	case []interface{}:
+		if min, ok := number(schema["minItems"]); ok && float64(len(value)) < min {
+			v.fail(path, "must have at least %v items", min)
+		}
+		if max, ok := number(schema["maxItems"]); ok && float64(len(value)) > max {
+			v.fail(path, "must have at most %v items", max)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				v.validate(item, items, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case map[string]interface{}:
+		v.validateObject(value, schema, path)
+	}
+}
+
+func (v *schemaValidator) validateObject(value map[string]interface{}, schema map[string]interface{}, path string) {
+	properties, _ := schema["properties"].(map[string]interface{})
+	lowerProperties := map[string]string{}
+	for name := range properties {
+		lowerProperties[strings.ToLower(name)] = name
+	}
+
+	keys := make([]string, 0, len(value))
+	present := map[string]bool{}
+	for key := range value {
+		keys = append(keys, key)
+		present[strings.ToLower(key)] = true
+	}
+	sort.Strings(keys)
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if !present[strings.ToLower(fmt.Sprint(name))] {
+				v.fail(path, "missing required field %s", name)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		childPath := path + "." + key
+		if name, ok := lowerProperties[strings.ToLower(key)]; ok {
+			if propertySchema, ok := properties[name].(map[string]interface{}); ok {
+				v.validate(value[key], propertySchema, childPath)
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(childPath, "Unknown JSON tag %s", key)
+			}
+		case map[string]interface{}:
+			v.validate(value[key], additional, childPath)
+		}
+	}
+}
+
+func (v *schemaValidator) validateAnyOf(value interface{}, anyOf []interface{}, path string) {
+	var firstErr *keyError
+	for _, s := range anyOf {
+		subSchema, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		sub := &schemaValidator{root: v.root}
+		sub.validate(value, subSchema, path)
+		if len(sub.errs) == 0 {
+			return
+		}
+		if firstErr == nil {
+			firstErr = &sub.errs[0]
+		}
+	}
+	if firstErr != nil {
+		v.errs = append(v.errs, *firstErr)
+	}
+}
+
+// resolve returns the schema of a reference to the definitions of the root schema
+func (v *schemaValidator) resolve(ref string) (map[string]interface{}, error) {
+	const prefix = "#/definitions/"
+	if strings.HasPrefix(ref, prefix) {
+		if definitions, ok := v.root["definitions"].(map[string]interface{}); ok {
+			if schema, ok := definitions[strings.TrimPrefix(ref, prefix)].(map[string]interface{}); ok {
+				return schema, nil
+			}
+		}
+	}
+	return nil, errors.Errorf("unresolved schema reference %s", ref)
+}
+
+func isJSONType(value interface{}, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(json.Number)
+		return ok && !strings.ContainsAny(string(n), ".eE")
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	}
+	return jsonType(value) == t
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func articled(t string) string {
+	switch t {
+	case "integer", "object", "array":
+		return "an " + t
+	case "null":
+		return t
+	}
+	return "a " + t
+}
+
+func inEnum(value interface{}, enum interface{}) bool {
+	values := reflect.ValueOf(enum)
+	if values.Kind() != reflect.Slice {
+		return true
+	}
+	for i := 0; i < values.Len(); i++ {
+		allowed := values.Index(i).Interface()
+		if n, ok := value.(json.Number); ok {
+			if f, ok := number(allowed); ok {
+				if v, err := n.Float64(); err == nil && v == f {
+					return true
+				}
+			}
+			continue
+		}
+		if reflect.DeepEqual(value, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// number returns the value of a number of a schema, which can be a Go or a decoded JSON number
+func number(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func formatJSON(value interface{}) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
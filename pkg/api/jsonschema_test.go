@@ -0,0 +1,104 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateAPIModelSchema(t *testing.T) {
+	contents, err := ioutil.ReadFile("../acsengine/testdata/simple/kubernetes.json")
+	if err != nil {
+		t.Fatalf("unable to read the apimodel: %s", err)
+	}
+	errs, err := ValidateAPIModelSchema(contents)
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("expected the apimodel to match the schema, got %v %v", errs, err)
+	}
+
+	contents = []byte(`{
+  "apiVersion": "vlabs",
+  "properties": {
+    "orchestratorProfile": {
+      "orchestratorType": "kubernetes",
+      "kubernetesConfig": {
+        "networkPlugin": "weave"
+      }
+    },
+    "masterProfile": {
+      "count": 2,
+      "dnsPrefix": "masterdns1",
+      "vmSize": "Standard_D2_v2"
+    },
+    "agentPoolProfiles": [
+      {
+        "name": "agentpool1",
+        "count": "3",
+        "VMSize": "Standard_D2_v2",
+        "osType": "Linux",
+        "diskSizesGB": [128, 2048],
+        "unknown": true
+      }
+    ]
+  }
+}`)
+	errs, err = ValidateAPIModelSchema(contents)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{
+		`$.properties (line 3, column 3): missing required field linuxProfile`,
+		`$.properties.orchestratorProfile.kubernetesConfig.networkPlugin (line 7, column 9): "weave" is not one of the allowed values`,
+		`$.properties.masterProfile.count (line 11, column 7): 2 is not one of the allowed values [1,3,5]`,
+		`$.properties.agentPoolProfiles[0].count (line 18, column 9): expected an integer, got a string`,
+		`$.properties.agentPoolProfiles[0].diskSizesGB[1] (line 21, column 30): must be at most 1023`,
+		`$.properties.agentPoolProfiles[0].unknown (line 22, column 9): Unknown JSON tag unknown`,
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, e := range errs {
+		if !strings.HasPrefix(e.Error(), expected[i]) {
+			t.Errorf("expected error %q, got %q", expected[i], e.Error())
+		}
+	}
+
+	errs, err = ValidateAPIModelSchema([]byte(`{"apiVersion": "2017-07-01", "properties": {"unknown": true}}`))
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("expected API versions without a schema not to be checked, got %v %v", errs, err)
+	}
+
+	if _, err = ValidateAPIModelSchema([]byte("{\n  \"apiVersion\": \"vlabs\",\n}")); err == nil {
+		t.Fatalf("expected an error for invalid JSON")
+	} else if fieldErr, ok := err.(*JSONFieldError); !ok || fieldErr.Line != 3 {
+		t.Fatalf("expected the syntax error on line 3, got %v", err)
+	}
+}
+
+func TestExamplesMatchSchema(t *testing.T) {
+	err := filepath.Walk("../../examples", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		errs, err := ValidateAPIModelSchema(contents)
+		if err != nil {
+			t.Errorf("unable to validate %s: %s", path, err)
+		}
+		for _, e := range errs {
+			t.Errorf("%s does not match the schema: %s", path, e)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read the examples: %s", err)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/pkg/errors"
+)
+
+// RedactedValue replaces the secrets of a redacted apimodel
+const RedactedValue = "<redacted>"
+
+// privateKeyRegex matches the PEM and OpenSSH private keys pasted in fields that are not tagged for redaction
+var privateKeyRegex = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----`)
+
+// Redact replaces with RedactedValue the fields of cs tagged with conform:"redact" and the fields
+// holding a private key, and returns the replaced values by JSON path, such as
+// properties.certificateProfile.caPrivateKey. Empty fields and references to Key Vault secrets
+// are kept. The values of []byte fields are returned in base64.
+func (cs *ContainerService) Redact() map[string]string {
+	secrets := map[string]string{}
+	walkSecretFields(reflect.ValueOf(cs), "", false, func(path string, v reflect.Value, redact bool) {
+		value := v.String()
+		if v.Kind() == reflect.Slice {
+			value = string(v.Bytes())
+		}
+		if value == "" || value == RedactedValue || !(redact || privateKeyRegex.MatchString(value)) {
+			return
+		}
+		if _, _, _, ok := helpers.ParseKeyvaultSecretPath(value); ok {
+			return
+		}
+		if v.Kind() == reflect.Slice {
+			secrets[path] = base64.StdEncoding.EncodeToString(v.Bytes())
+			v.SetBytes([]byte(RedactedValue))
+			return
+		}
+		secrets[path] = value
+		v.SetString(RedactedValue)
+	})
+	return secrets
+}
+
+// RestoreSecrets replaces the RedactedValue placeholders of cs with the values returned by Redact
+// for the same paths, and returns the sorted paths of the restored fields. It fails when a
+// placeholder has no value.
+func (cs *ContainerService) RestoreSecrets(secrets map[string]string) ([]string, error) {
+	restored := []string{}
+	missing := []string{}
+	var err error
+	walkSecretFields(reflect.ValueOf(cs), "", false, func(path string, v reflect.Value, redact bool) {
+		if v.Kind() == reflect.Slice {
+			if string(v.Bytes()) != RedactedValue {
+				return
+			}
+		} else if v.String() != RedactedValue {
+			return
+		}
+		value, ok := secrets[path]
+		if !ok {
+			missing = append(missing, path)
+			return
+		}
+		if v.Kind() == reflect.Slice {
+			b, decodeErr := base64.StdEncoding.DecodeString(value)
+			if decodeErr != nil {
+				err = errors.Wrapf(decodeErr, "the secret of %s is not base64 encoded", path)
+				return
+			}
+			v.SetBytes(b)
+		} else {
+			v.SetString(value)
+		}
+		restored = append(restored, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, errors.Errorf("no secret to restore %s", strings.Join(missing, ", "))
+	}
+	sort.Strings(restored)
+	return restored, nil
+}
+
+// walkSecretFields calls visit with the settable string and []byte values under v and their
+// JSON paths. redact tells whether the value is under a field tagged with conform:"redact".
+// Map values are visited on a copy that is stored back in the map.
+func walkSecretFields(v reflect.Value, path string, redact bool, visit func(path string, v reflect.Value, redact bool)) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			walkSecretFields(v.Elem(), path, redact, visit)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			fieldPath := path
+			if name != "" || !f.Anonymous {
+				if name == "" {
+					name = f.Name
+				}
+				fieldPath = joinSecretPath(path, name)
+			}
+			walkSecretFields(v.Field(i), fieldPath, redact || f.Tag.Get("conform") == "redact", visit)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			visit(path, v, redact)
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			walkSecretFields(v.Index(i), fmt.Sprintf("%s[%d]", path, i), redact, visit)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		for _, k := range v.MapKeys() {
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+			walkSecretFields(e, joinSecretPath(path, k.String()), redact, visit)
+			v.SetMapIndex(k, e)
+		}
+	case reflect.String:
+		visit(path, v, redact)
+	}
+}
+
+func joinSecretPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,126 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"strings"
+
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/pkg/errors"
+)
+
+// SetSecretSource makes SetPropertiesDefaults generate the certificates and keys of the
+// cluster from source rather than at random
+func (cs *ContainerService) SetSecretSource(source *helpers.SecretSource) {
+	cs.secretSource = source
+}
+
+// SecretSource returns the source of the secrets generated for the cluster; nil when they are random
+func (cs *ContainerService) SecretSource() *helpers.SecretSource {
+	return cs.secretSource
+}
+
+// ReuseSecrets copies the certificates, keys and etcd encryption key of existing, such as
+// the apimodel.json written by an earlier generate, to the fields cs leaves empty. The
+// certificates are not reused when cs brings its own certificate authority.
+func (cs *ContainerService) ReuseSecrets(existing *ContainerService) error {
+	if existing == nil || existing.Properties == nil || cs.Properties == nil {
+		return nil
+	}
+	p, e := cs.Properties, existing.Properties
+	if p.MasterProfile != nil && e.MasterProfile != nil && p.MasterProfile.DNSPrefix != e.MasterProfile.DNSPrefix {
+		return errors.Errorf("the secrets to reuse were generated for dnsPrefix %s, not %s", e.MasterProfile.DNSPrefix, p.MasterProfile.DNSPrefix)
+	}
+
+	if e.CertificateProfile != nil && e.CertificateProfile.CaCertificate != "" {
+		if p.CertificateProfile == nil {
+			p.CertificateProfile = &CertificateProfile{}
+		}
+		c, ec := p.CertificateProfile, e.CertificateProfile
+		if c.CaCertificate == "" || c.CaCertificate == ec.CaCertificate {
+			for _, field := range []struct {
+				value    *string
+				existing string
+			}{
+				{&c.CaCertificate, ec.CaCertificate},
+				{&c.CaPrivateKey, ec.CaPrivateKey},
+				{&c.CaCertificateChain, ec.CaCertificateChain},
+				{&c.APIServerCertificate, ec.APIServerCertificate},
+				{&c.APIServerPrivateKey, ec.APIServerPrivateKey},
+				{&c.ClientCertificate, ec.ClientCertificate},
+				{&c.ClientPrivateKey, ec.ClientPrivateKey},
+				{&c.KubeConfigCertificate, ec.KubeConfigCertificate},
+				{&c.KubeConfigPrivateKey, ec.KubeConfigPrivateKey},
+				{&c.EtcdServerCertificate, ec.EtcdServerCertificate},
+				{&c.EtcdServerPrivateKey, ec.EtcdServerPrivateKey},
+				{&c.EtcdClientCertificate, ec.EtcdClientCertificate},
+				{&c.EtcdClientPrivateKey, ec.EtcdClientPrivateKey},
+			} {
+				if *field.value == "" {
+					*field.value = field.existing
+				}
+			}
+			if len(c.EtcdPeerCertificates) == 0 && len(c.EtcdPeerPrivateKeys) == 0 {
+				c.EtcdPeerCertificates = append([]string(nil), ec.EtcdPeerCertificates...)
+				c.EtcdPeerPrivateKeys = append([]string(nil), ec.EtcdPeerPrivateKeys...)
+			}
+		}
+	}
+
+	if p.OrchestratorProfile != nil && p.OrchestratorProfile.KubernetesConfig != nil &&
+		e.OrchestratorProfile != nil && e.OrchestratorProfile.KubernetesConfig != nil &&
+		p.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey == "" {
+		p.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey = e.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey
+	}
+	return nil
+}
+
+// CertificatePairs are the certificate and key pairs of the CertificateProfile of a
+// Kubernetes cluster, by the names RotateCerts takes. "etcd" is the server, client
+// and peer pairs of etcd.
+var CertificatePairs = []string{"ca", "apiserver", "client", "kubeconfig", "etcd"}
+
+// RotateCerts replaces the named certificate and key pairs of the CertificateProfile
+// with new ones signed by its certificate authority. Rotating "ca" replaces the
+// certificate authority and every pair it signed, unless the certificate authority is
+// an intermediate of another PKI, which only that PKI can issue again.
+func (cs *ContainerService) RotateCerts(pairs []string) error {
+	p := cs.Properties
+	if p == nil || p.MasterProfile == nil || p.OrchestratorProfile == nil || p.OrchestratorProfile.OrchestratorType != Kubernetes {
+		return errors.New("only the certificates of Kubernetes clusters with a master profile can be rotated")
+	}
+	if p.CertificateProfile == nil {
+		p.CertificateProfile = &CertificateProfile{}
+	}
+	c := p.CertificateProfile
+	for _, pair := range pairs {
+		switch pair {
+		case "ca":
+			if c.CaCertificateChain != "" {
+				return errors.New("the certificate authority is issued by the certificate chain of the apimodel, issue a new one from its PKI and set caCertificate and caPrivateKey instead of rotating ca")
+			}
+			*c = CertificateProfile{
+				KeyAlgorithm:       c.KeyAlgorithm,
+				KeySize:            c.KeySize,
+				CaValidityDays:     c.CaValidityDays,
+				ServerValidityDays: c.ServerValidityDays,
+				ClientValidityDays: c.ClientValidityDays,
+			}
+		case "apiserver":
+			c.APIServerCertificate, c.APIServerPrivateKey = "", ""
+		case "client":
+			c.ClientCertificate, c.ClientPrivateKey = "", ""
+		case "kubeconfig":
+			c.KubeConfigCertificate, c.KubeConfigPrivateKey = "", ""
+		case "etcd":
+			c.EtcdServerCertificate, c.EtcdServerPrivateKey = "", ""
+			c.EtcdClientCertificate, c.EtcdClientPrivateKey = "", ""
+			c.EtcdPeerCertificates, c.EtcdPeerPrivateKeys = nil, nil
+		default:
+			return errors.Errorf("unknown certificate %s, expected one of %s", pair, strings.Join(CertificatePairs, ", "))
+		}
+	}
+	_, _, err := p.setDefaultCerts(cs.secretSource)
+	return err
+}
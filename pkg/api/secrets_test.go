@@ -0,0 +1,87 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"testing"
+)
+
+func TestReuseSecrets(t *testing.T) {
+	existing := CreateMockContainerService("testcluster", "1.10.8", 3, 2, false)
+	existing.Properties.CertificateProfile = &CertificateProfile{
+		CaCertificate:        "caCertificate",
+		CaPrivateKey:         "caPrivateKey",
+		APIServerCertificate: "apiServerCertificate",
+		EtcdPeerCertificates: []string{"etcdPeerCertificate0"},
+		EtcdPeerPrivateKeys:  []string{"etcdPeerPrivateKey0"},
+	}
+	existing.Properties.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey = "etcdEncryptionKey"
+
+	cs := CreateMockContainerService("testcluster", "1.10.8", 3, 2, false)
+	cs.Properties.CertificateProfile = nil
+	if err := cs.ReuseSecrets(existing); err != nil {
+		t.Fatalf("unexpected error reusing secrets: %s", err)
+	}
+	c := cs.Properties.CertificateProfile
+	if c == nil || c.CaPrivateKey != "caPrivateKey" || c.APIServerCertificate != "apiServerCertificate" || len(c.EtcdPeerCertificates) != 1 {
+		t.Fatalf("expected the certificates to be reused, got %+v", c)
+	}
+	if key := cs.Properties.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey; key != "etcdEncryptionKey" {
+		t.Fatalf("expected the etcd encryption key to be reused, got %s", key)
+	}
+
+	cs = CreateMockContainerService("testcluster", "1.10.8", 3, 2, false)
+	cs.Properties.CertificateProfile = &CertificateProfile{CaCertificate: "otherCaCertificate", CaPrivateKey: "otherCaPrivateKey"}
+	if err := cs.ReuseSecrets(existing); err != nil {
+		t.Fatalf("unexpected error reusing secrets: %s", err)
+	}
+	if cs.Properties.CertificateProfile.APIServerCertificate != "" {
+		t.Fatalf("expected the certificates of another certificate authority not to be reused")
+	}
+
+	cs = CreateMockContainerService("testcluster", "1.10.8", 3, 2, false)
+	cs.Properties.MasterProfile.DNSPrefix = "othercluster"
+	if err := cs.ReuseSecrets(existing); err == nil {
+		t.Fatalf("expected an error reusing the secrets of another dnsPrefix")
+	}
+}
+
+func TestRotateCerts(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.10.8", 3, 2, false)
+	cs.Properties.CertificateProfile = nil
+	if _, err := cs.SetPropertiesDefaults(false, false); err != nil {
+		t.Fatalf("unexpected error setting the defaults: %s", err)
+	}
+	old := *cs.Properties.CertificateProfile
+
+	if err := cs.RotateCerts([]string{"apiserver", "etcd"}); err != nil {
+		t.Fatalf("unexpected error rotating certificates: %s", err)
+	}
+	c := cs.Properties.CertificateProfile
+	if c.CaCertificate != old.CaCertificate || c.ClientCertificate != old.ClientCertificate || c.KubeConfigPrivateKey != old.KubeConfigPrivateKey {
+		t.Fatalf("expected the certificate authority and the pairs not rotated to be kept")
+	}
+	if c.APIServerCertificate == old.APIServerCertificate || c.EtcdServerPrivateKey == old.EtcdServerPrivateKey || c.EtcdClientCertificate == old.EtcdClientCertificate {
+		t.Fatalf("expected the apiserver and etcd pairs to be rotated")
+	}
+	if len(c.EtcdPeerCertificates) != 3 || c.EtcdPeerCertificates[0] == old.EtcdPeerCertificates[0] {
+		t.Fatalf("expected the 3 etcd peer pairs to be rotated, got %d", len(c.EtcdPeerCertificates))
+	}
+
+	if err := cs.RotateCerts([]string{"ca"}); err != nil {
+		t.Fatalf("unexpected error rotating certificates: %s", err)
+	}
+	if c.CaCertificate == old.CaCertificate || c.ClientCertificate == old.ClientCertificate || c.KubeConfigPrivateKey == old.KubeConfigPrivateKey {
+		t.Fatalf("expected rotating the certificate authority to rotate every pair")
+	}
+
+	if err := cs.RotateCerts([]string{"kubelet"}); err == nil {
+		t.Fatalf("expected an error rotating an unknown certificate")
+	}
+
+	c.CaCertificateChain = c.CaCertificate
+	if err := cs.RotateCerts([]string{"ca"}); err == nil {
+		t.Fatalf("expected an error rotating a certificate authority issued by a certificate chain")
+	}
+}
@@ -5,31 +5,51 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
 )
 
+// checkJSONKeys returns a *JSONFieldError locating the first key of data that is not a field of types
 func checkJSONKeys(data []byte, types ...reflect.Type) error {
 	var raw interface{}
 	if e := json.Unmarshal(data, &raw); e != nil {
-		return e
+		return jsonError(data, e)
 	}
 	o := raw.(map[string]interface{})
-	return checkMapKeys(o, types...)
+	if e := checkMapKeys(o, jsonRootPath, types...); e != nil {
+		return newJSONPositions(data).fieldError(e.path, e.err)
+	}
+	return nil
 }
 
-func checkMapKeys(o map[string]interface{}, types ...reflect.Type) error {
+// keyError is an unknown key at a JSON path
+type keyError struct {
+	path string
+	err  error
+}
+
+func checkMapKeys(o map[string]interface{}, path string, types ...reflect.Type) *keyError {
 	fieldMap := createJSONFieldMap(types)
-	for k, v := range o {
+	// sorted so that the same unknown key is reported on every run
+	keys := make([]string, 0, len(o))
+	for k := range o {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := o[k]
+		childPath := path + "." + k
 		f, present := fieldMap[strings.ToLower(k)]
 		if !present {
-			return errors.Errorf("Unknown JSON tag %s", k)
+			return &keyError{path: childPath, err: errors.Errorf("Unknown JSON tag %s", k)}
 		}
 		if f.Type.Kind() == reflect.Struct && v != nil {
 			if childMap, exists := v.(map[string]interface{}); exists {
-				if e := checkMapKeys(childMap, f.Type); e != nil {
+				if e := checkMapKeys(childMap, childPath, f.Type); e != nil {
 					return e
 				}
 			}
@@ -40,9 +60,9 @@ func checkMapKeys(o map[string]interface{}, types ...reflect.Type) error {
 				elementType = elementType.Elem()
 			}
 			if childSlice, exists := v.([]interface{}); exists {
-				for _, child := range childSlice {
+				for i, child := range childSlice {
 					if childMap, exists := child.(map[string]interface{}); exists {
-						if e := checkMapKeys(childMap, elementType); e != nil {
+						if e := checkMapKeys(childMap, fmt.Sprintf("%s[%d]", childPath, i), elementType); e != nil {
 							return e
 						}
 					}
@@ -52,7 +72,7 @@ func checkMapKeys(o map[string]interface{}, types ...reflect.Type) error {
 		if f.Type.Kind() == reflect.Ptr && v != nil {
 			elementType := f.Type.Elem()
 			if childMap, exists := v.(map[string]interface{}); exists {
-				if e := checkMapKeys(childMap, elementType); e != nil {
+				if e := checkMapKeys(childMap, childPath, elementType); e != nil {
 					return e
 				}
 			}
@@ -4,6 +4,7 @@
 package api
 
 import (
+	stdjson "encoding/json"
 	"reflect"
 	"strings"
 	"testing"
@@ -94,7 +95,10 @@ func TestCheckFailsOnUnexpectedJSONKeyAtSubLevel(t *testing.T) {
 		t.Fatal("Unexpected JSON key was not detected")
 	}
 	if !strings.Contains(e.Error(), "spx") {
-		t.Errorf("Error message did not name unexpected JSON key 'spx': was %v", e) // TODO: f2.spx would be better
+		t.Errorf("Error message did not name unexpected JSON key 'spx': was %v", e)
+	}
+	if fieldErr, ok := e.(*JSONFieldError); !ok || fieldErr.Path != "$.f2.spx" {
+		t.Errorf("Error did not locate the unexpected JSON key at $.f2.spx: was %v", e)
 	}
 }
 
@@ -122,7 +126,10 @@ func TestCheckFailsOnUnexpectedJSONKeyInArray(t *testing.T) {
 		t.Fatal("Unexpected JSON key was not detected")
 	}
 	if !strings.Contains(e.Error(), "spz") {
-		t.Errorf("Error message did not name unexpected JSON key 'spz': was %v", e) // TODO: f2[1].spz might be better
+		t.Errorf("Error message did not name unexpected JSON key 'spz': was %v", e)
+	}
+	if fieldErr, ok := e.(*JSONFieldError); !ok || fieldErr.Path != "$.f2.sp3[1].spz" {
+		t.Errorf("Error did not locate the unexpected JSON key at $.f2.sp3[1].spz: was %v", e)
 	}
 }
 
@@ -149,7 +156,10 @@ func TestCheckFailsOnUnexpectedJSONKeyInArrayAtSubLevel(t *testing.T) {
 		t.Fatal("Unexpected JSON key was not detected")
 	}
 	if !strings.Contains(e.Error(), "spy") {
-		t.Errorf("Error message did not name unexpected JSON key 'spy': was %v", e) // TODO: f3[0].spy might be better
+		t.Errorf("Error message did not name unexpected JSON key 'spy': was %v", e)
+	}
+	if fieldErr, ok := e.(*JSONFieldError); !ok || fieldErr.Path != "$.f3[0].spy" {
+		t.Errorf("Error did not locate the unexpected JSON key at $.f3[0].spy: was %v", e)
 	}
 }
 
@@ -167,7 +177,10 @@ func TestCheckFailsOnUnexpectedJSONKeyAtSubLevelViaPointer(t *testing.T) {
 		t.Fatal("Unexpected JSON key was not detected")
 	}
 	if !strings.Contains(e.Error(), "spx") {
-		t.Errorf("Error message did not name unexpected JSON key 'spx': was %v", e) // TODO: f4.spx would be better
+		t.Errorf("Error message did not name unexpected JSON key 'spx': was %v", e)
+	}
+	if fieldErr, ok := e.(*JSONFieldError); !ok || fieldErr.Path != "$.f4.spx" {
+		t.Errorf("Error did not locate the unexpected JSON key at $.f4.spx: was %v", e)
 	}
 }
 
@@ -194,7 +207,10 @@ func TestCheckFailsOnUnexpectedJSONKeyInArrayAtSubLevelViaPointer(t *testing.T)
 		t.Fatal("Unexpected JSON key was not detected")
 	}
 	if !strings.Contains(e.Error(), "spy") {
-		t.Errorf("Error message did not name unexpected JSON key 'spy': was %v", e) // TODO: f3[0].spy might be better
+		t.Errorf("Error message did not name unexpected JSON key 'spy': was %v", e)
+	}
+	if fieldErr, ok := e.(*JSONFieldError); !ok || fieldErr.Path != "$.f5[0].spy" {
+		t.Errorf("Error did not locate the unexpected JSON key at $.f5[0].spy: was %v", e)
 	}
 }
 
@@ -263,3 +279,38 @@ func TestStrictJSONValidationIsAppliedToVersionsAbove20170701(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckJSONKeysReportsLineAndColumn(t *testing.T) {
+	json := `{
+	"f1": 1,
+	"f3": [
+		{
+			"sp1": true,
+			"spy": "unexpected"
+		}
+	]
+}`
+	e := checkJSONKeys([]byte(json), reflect.TypeOf(TestProfile{}))
+	fieldErr, ok := e.(*JSONFieldError)
+	if !ok {
+		t.Fatalf("expected a JSON field error, got %v", e)
+	}
+	if fieldErr.Path != "$.f3[0].spy" || fieldErr.Line != 6 || fieldErr.Column != 4 {
+		t.Errorf("expected the unexpected JSON key at $.f3[0].spy, line 6, column 4, got %s", fieldErr)
+	}
+}
+
+func TestJSONErrorLocatesTypeErrors(t *testing.T) {
+	data := []byte(`{
+	"f1": "one"
+}`)
+	var profile TestProfile
+	e := jsonError(data, stdjson.Unmarshal(data, &profile))
+	fieldErr, ok := e.(*JSONFieldError)
+	if !ok {
+		t.Fatalf("expected a JSON field error, got %v", e)
+	}
+	if fieldErr.Path != "$.f1" || fieldErr.Line != 2 {
+		t.Errorf("expected the type error at $.f1 on line 2, got %s", fieldErr)
+	}
+}
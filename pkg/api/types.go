@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Azure/acs-engine/pkg/api/agentPoolOnlyApi/v20170831"
 	"github.com/Azure/acs-engine/pkg/api/agentPoolOnlyApi/v20180331"
@@ -51,6 +52,13 @@ type ContainerService struct {
 	Type     string                `json:"type"`
 
 	Properties *Properties `json:"properties,omitempty"`
+
+	// defaultsSteps are recorded by SetPropertiesDefaults once ExplainDefaults is called
+	defaultsSteps *[]DefaultsStep
+	// secretSource supplies the secrets generated by SetPropertiesDefaults; nil generates random ones
+	secretSource *helpers.SecretSource
+	// addonRegistry holds the addons of the cluster; nil holds the built-in addons only
+	addonRegistry *AddonRegistry
 }
 
 // Properties represents the ACS cluster definition
@@ -73,6 +81,7 @@ type Properties struct {
 	AddonProfiles           map[string]AddonProfile  `json:"addonProfiles,omitempty"`
 	AzProfile               *AzProfile               `json:"azProfile,omitempty"`
 	FeatureFlags            *FeatureFlags            `json:"featureFlags,omitempty"`
+	SecretsKeyvault         *SecretsKeyvault         `json:"secretsKeyvault,omitempty"`
 }
 
 // ClusterMetadata represents the metadata of the ACS cluster.
@@ -107,6 +116,12 @@ type FeatureFlags struct {
 	BlockOutboundInternet    bool `json:"blockOutboundInternet,omitempty"`
 }
 
+// SecretsKeyvault names the Azure Key Vault that stores the generated secrets of the cluster
+type SecretsKeyvault struct {
+	VaultID          string `json:"vaultID"`
+	SecretNamePrefix string `json:"secretNamePrefix,omitempty"`
+}
+
 // ServicePrincipalProfile contains the client and secret used by the cluster for Azure Resource CRUD
 type ServicePrincipalProfile struct {
 	ClientID          string             `json:"clientId"`
@@ -153,6 +168,19 @@ type CertificateProfile struct {
 	EtcdPeerCertificates []string `json:"etcdPeerCertificates,omitempty" conform:"redact"`
 	// EtcdPeerPrivateKeys is list of etcd peer private keys, and signed by the CA
 	EtcdPeerPrivateKeys []string `json:"etcdPeerPrivateKeys,omitempty" conform:"redact"`
+	// CaCertificateChain are the certificates from the issuer of the CA up to a self-signed root,
+	// when the CA is an intermediate of another PKI
+	CaCertificateChain string `json:"caCertificateChain,omitempty" conform:"redact"`
+	// KeyAlgorithm is the algorithm of the generated keys, RSA (default) or ECDSA
+	KeyAlgorithm string `json:"keyAlgorithm,omitempty"`
+	// KeySize is the size in bits of the generated RSA keys, or of the ECDSA curve
+	KeySize int `json:"keySize,omitempty"`
+	// CaValidityDays is how many days the generated CA is valid for
+	CaValidityDays int `json:"caValidityDays,omitempty"`
+	// ServerValidityDays is how many days the generated server certificates are valid for
+	ServerValidityDays int `json:"serverValidityDays,omitempty"`
+	// ClientValidityDays is how many days the generated client certificates are valid for
+	ClientValidityDays int `json:"clientValidityDays,omitempty"`
 }
 
 // LinuxProfile represents the linux parameters passed to the cluster
@@ -178,7 +206,7 @@ type PublicKey struct {
 type CustomSearchDomain struct {
 	Name          string `json:"name,omitempty"`
 	RealmUser     string `json:"realmUser,omitempty"`
-	RealmPassword string `json:"realmPassword,omitempty"`
+	RealmPassword string `json:"realmPassword,omitempty" conform:"redact"`
 }
 
 // CustomNodesDNS represents the Search Domain when the custom vnet for a custom DNS as a nameserver.
@@ -256,6 +284,22 @@ type KubernetesAddon struct {
 	Containers []KubernetesContainerSpec `json:"containers,omitempty"`
 	Config     map[string]string         `json:"config,omitempty"`
 	Data       string                    `json:"data,omitempty"`
+	Chart      *HelmChart                `json:"chart,omitempty"`
+}
+
+// HelmChart is the Helm chart installed by a chart addon with the addon config as values:
+// either a packaged chart delivered to the masters with the template, or a chart of a repository
+type HelmChart struct {
+	// Path is the packaged chart (.tgz), read when the template is generated
+	Path string `json:"path,omitempty"`
+	// Repository is the URL of the chart repository holding the chart
+	Repository string `json:"repository,omitempty"`
+	// Name is the name of the chart in Repository, the name of the addon if empty
+	Name string `json:"name,omitempty"`
+	// Version is the version of the chart in Repository, the latest version if empty
+	Version string `json:"version,omitempty"`
+	// Namespace is the namespace of the release
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // IsEnabled returns if the addon is explicitly enabled, or the user-provided default if non explicitly enabled
@@ -345,7 +389,7 @@ type KubernetesConfig struct {
 	GCLowThreshold                   int               `json:"gclowthreshold,omitempty"`
 	EtcdVersion                      string            `json:"etcdVersion,omitempty"`
 	EtcdDiskSizeGB                   string            `json:"etcdDiskSizeGB,omitempty"`
-	EtcdEncryptionKey                string            `json:"etcdEncryptionKey,omitempty"`
+	EtcdEncryptionKey                string            `json:"etcdEncryptionKey,omitempty" conform:"redact"`
 	EnableDataEncryptionAtRest       *bool             `json:"enableDataEncryptionAtRest,omitempty"`
 	EnableEncryptionWithExternalKms  *bool             `json:"enableEncryptionWithExternalKms,omitempty"`
 	EnablePodSecurityPolicy          *bool             `json:"enablePodSecurityPolicy,omitempty"`
@@ -399,7 +443,7 @@ type DcosConfig struct {
 	DcosWindowsBootstrapURL  string            `json:"dcosWindowsBootstrapURL,omitempty"`
 	Registry                 string            `json:"registry,omitempty"`
 	RegistryUser             string            `json:"registryUser,omitempty"`
-	RegistryPass             string            `json:"registryPassword,omitempty"`
+	RegistryPass             string            `json:"registryPassword,omitempty" conform:"redact"`
 	DcosRepositoryURL        string            `json:"dcosRepositoryURL,omitempty"`        // For CI use, you need to specify
 	DcosClusterPackageListID string            `json:"dcosClusterPackageListID,omitempty"` // all three of these items
 	DcosProviderPackageID    string            `json:"dcosProviderPackageID,omitempty"`    // repo url is the location of the build,
@@ -412,12 +456,12 @@ type OpenShiftConfig struct {
 
 	// ClusterUsername and ClusterPassword are temporary, do not rely on them.
 	ClusterUsername string `json:"clusterUsername,omitempty"`
-	ClusterPassword string `json:"clusterPassword,omitempty"`
+	ClusterPassword string `json:"clusterPassword,omitempty" conform:"redact"`
 
 	// EnableAADAuthentication is temporary, do not rely on it.
 	EnableAADAuthentication bool `json:"enableAADAuthentication,omitempty"`
 
-	ConfigBundles map[string][]byte `json:"configBundles,omitempty"`
+	ConfigBundles map[string][]byte `json:"configBundles,omitempty" conform:"redact"`
 
 	PublicHostname string
 	RouterProfiles []OpenShiftRouterProfile
@@ -761,6 +805,28 @@ func (p *Properties) HasVMSSAgentPool() bool {
 	return false
 }
 
+// HasAutoScaledAgentPool returns true if the cluster autoscaler scales any of the agent pools
+func (p *Properties) HasAutoScaledAgentPool() bool {
+	for _, agentPoolProfile := range p.AgentPoolProfiles {
+		if agentPoolProfile.IsAutoScalingEnabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// GetClusterAutoscalerNodes returns the node groups of the cluster autoscaler as min:max:name,
+// one for each scale set agent pool with autoscaling enabled
+func (p *Properties) GetClusterAutoscalerNodes() []string {
+	var nodes []string
+	for _, agentPoolProfile := range p.AgentPoolProfiles {
+		if agentPoolProfile.IsAutoScalingEnabled() && agentPoolProfile.IsVirtualMachineScaleSets() && agentPoolProfile.MinCount != nil && agentPoolProfile.MaxCount != nil {
+			nodes = append(nodes, fmt.Sprintf("%d:%d:%s", *agentPoolProfile.MinCount, *agentPoolProfile.MaxCount, p.GetAgentVMPrefix(agentPoolProfile)))
+		}
+	}
+	return nodes
+}
+
 // K8sOrchestratorName returns the 3 character orchestrator code for kubernetes-based clusters.
 func (p *Properties) K8sOrchestratorName() string {
 	if p.OrchestratorProfile.IsKubernetes() ||
@@ -923,6 +989,17 @@ func (p *Properties) GetClusterID() string {
 	return p.ClusterID
 }
 
+// GetDNSPrefix returns the DNS prefix of the masters, or of the hosted master
+func (p *Properties) GetDNSPrefix() string {
+	if p.MasterProfile != nil {
+		return p.MasterProfile.DNSPrefix
+	}
+	if p.HostedMasterProfile != nil {
+		return p.HostedMasterProfile.DNSPrefix
+	}
+	return ""
+}
+
 // GetClusterMetadata returns a instance of the struct type api.ClusterMetadata.
 func (p *Properties) GetClusterMetadata() *ClusterMetadata {
 	return &ClusterMetadata{
@@ -987,6 +1064,22 @@ func (p *Properties) GetAzureCNICidr() string {
 	return masqCNIIP
 }
 
+// PkiOptions returns the options the certificates and keys of the cluster are generated with
+func (c *CertificateProfile) PkiOptions() *helpers.PkiOptions {
+	if c == nil {
+		return nil
+	}
+	day := 24 * time.Hour
+	return &helpers.PkiOptions{
+		KeyAlgorithm:   c.KeyAlgorithm,
+		KeySize:        c.KeySize,
+		CAValidity:     time.Duration(c.CaValidityDays) * day,
+		ServerValidity: time.Duration(c.ServerValidityDays) * day,
+		ClientValidity: time.Duration(c.ClientValidityDays) * day,
+		CAChain:        c.CaCertificateChain,
+	}
+}
+
 // IsCustomVNET returns true if the customer brought their own VNET
 func (m *MasterProfile) IsCustomVNET() bool {
 	return len(m.VnetSubnetID) > 0
@@ -1086,6 +1179,11 @@ func (a *AgentPoolProfile) IsVirtualMachineScaleSets() bool {
 	return a.AvailabilityProfile == VirtualMachineScaleSets
 }
 
+// IsAutoScalingEnabled returns true if the cluster autoscaler scales the agent pool between MinCount and MaxCount
+func (a *AgentPoolProfile) IsAutoScalingEnabled() bool {
+	return helpers.IsTrueBoolPointer(a.EnableAutoScaling)
+}
+
 // IsLowPriorityScaleSet returns true if the VMSS is Low Priority
 func (a *AgentPoolProfile) IsLowPriorityScaleSet() bool {
 	return a.AvailabilityProfile == VirtualMachineScaleSets && a.ScaleSetPriority == ScaleSetPriorityLow
@@ -6,6 +6,7 @@ package api
 import (
 	"log"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/Azure/acs-engine/pkg/api/common"
@@ -2756,3 +2757,40 @@ func TestIsFeatureEnabled(t *testing.T) {
 		})
 	}
 }
+
+func TestGetClusterAutoscalerNodes(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.10.8", 1, 3, false)
+	p := cs.Properties
+	pool := p.AgentPoolProfiles[0]
+	pool.EnableAutoScaling, pool.MinCount, pool.MaxCount = helpers.PointerToBool(true), helpers.PointerToInt(1), helpers.PointerToInt(5)
+	if nodes := p.GetClusterAutoscalerNodes(); len(nodes) != 0 {
+		t.Errorf("expected no node groups for an availability set pool, got %v", nodes)
+	}
+
+	pool.AvailabilityProfile = VirtualMachineScaleSets
+	p.AgentPoolProfiles = append(p.AgentPoolProfiles, &AgentPoolProfile{
+		Name:                "agentpool2",
+		Count:               2,
+		AvailabilityProfile: VirtualMachineScaleSets,
+		EnableAutoScaling:   helpers.PointerToBool(true),
+		MinCount:            helpers.PointerToInt(2),
+		MaxCount:            helpers.PointerToInt(10),
+	}, &AgentPoolProfile{
+		Name:                "agentpool3",
+		Count:               2,
+		AvailabilityProfile: VirtualMachineScaleSets,
+	})
+	if !p.HasAutoScaledAgentPool() {
+		t.Errorf("expected the cluster to have autoscaled agent pools")
+	}
+	expected := []string{
+		"1:5:" + p.GetAgentVMPrefix(p.AgentPoolProfiles[0]),
+		"2:10:" + p.GetAgentVMPrefix(p.AgentPoolProfiles[1]),
+	}
+	if nodes := p.GetClusterAutoscalerNodes(); !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("expected node groups %v, got %v", expected, nodes)
+	}
+	if !strings.HasSuffix(expected[1], "vmss") {
+		t.Errorf("expected the node group to be named after the scale set, got %s", expected[1])
+	}
+}
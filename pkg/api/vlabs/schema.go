@@ -0,0 +1,319 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package vlabs
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/acs-engine/pkg/api/common"
+)
+
+// JSONSchemaID is the draft of JSON Schema that JSONSchema follows
+const JSONSchemaID = "http://json-schema.org/draft-07/schema#"
+
+// typeEnums are the values of the string types of vlabs, the empty string meaning the default value
+var typeEnums = map[reflect.Type][]interface{}{
+	reflect.TypeOf(OSType("")):               {"", string(Linux), string(Windows)},
+	reflect.TypeOf(Distro("")):               {"", string(Ubuntu), string(RHEL), string(CoreOS), string(AKS), string(AKSDockerEngine)},
+	reflect.TypeOf(AgentPoolProfileRole("")): {string(AgentPoolProfileRoleEmpty), string(AgentPoolProfileRoleInfra)},
+}
+
+// autofilledFields are the required fields that deploy fills in when they are missing from the apimodel
+var autofilledFields = map[string]bool{
+	"MasterProfile.dnsPrefix":    true,
+	"LinuxProfile.adminUsername": true,
+}
+
+// JSONSchema returns the JSON Schema of a vlabs apimodel. It is generated from the vlabs types:
+// their JSON tags, the constraints of their validate tags, the values of the vlabs enums and
+// the supported orchestrator versions.
+func JSONSchema() map[string]interface{} {
+	g := &schemaGenerator{definitions: map[string]interface{}{}}
+	root := g.structSchema(reflect.TypeOf(ContainerService{}))
+	root["$schema"] = JSONSchemaID
+	root["title"] = "acs-engine vlabs apimodel"
+	properties := root["properties"].(map[string]interface{})
+	properties["apiVersion"] = map[string]interface{}{
+		"type": "string",
+		"enum": []interface{}{APIVersion},
+	}
+	root["required"] = appendRequired(root["required"], "apiVersion", "properties")
+	root["definitions"] = g.definitions
+	return root
+}
+
+type schemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+// typeSchema returns the schema of a Go type, as a reference for structs
+func (g *schemaGenerator) typeSchema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if enum, ok := typeEnums[t]; ok {
+		return map[string]interface{}{"type": "string", "enum": enum}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			// anonymous structs, such as LinuxProfile.ssh, have no name to define them by
+			return g.structSchema(t)
+		}
+		if _, ok := g.definitions[t.Name()]; !ok {
+			// registered before the fields so that recursive types terminate
+			g.definitions[t.Name()] = nil
+			g.definitions[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema returns the schema of the JSON object of a struct
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []interface{}{}
+	g.addFields(t, properties, &required)
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (g *schemaGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.SplitN(tag, ",", 2)[0]
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		schema := g.typeSchema(f.Type)
+		if enum := fieldEnum(t, name); enum != nil {
+			schema = enum
+		}
+		if applyValidateTag(schema, f.Type, f.Tag.Get("validate")) && !autofilledFields[t.Name()+"."+name] {
+			*required = append(*required, name)
+		}
+		properties[name] = schema
+	}
+}
+
+// fieldEnum returns the schema of the string fields whose values are listed by vlabs
+func fieldEnum(t reflect.Type, name string) map[string]interface{} {
+	switch t.Name() + "." + name {
+	case "OrchestratorProfile.orchestratorType":
+		// the orchestrator type is case insensitive
+		orchestrators := []string{DCOS, Kubernetes, OpenShift, Swarm, SwarmMode}
+		patterns := make([]string, len(orchestrators))
+		for i, o := range orchestrators {
+			patterns[i] = caseInsensitivePattern(o)
+		}
+		return map[string]interface{}{
+			"type": "string",
+			"anyOf": []interface{}{
+				map[string]interface{}{"enum": stringValues(orchestrators)},
+				map[string]interface{}{"pattern": "^(" + strings.Join(patterns, "|") + ")$"},
+			},
+		}
+	case "OrchestratorProfile.orchestratorVersion":
+		// the version a cluster was deployed with may no longer be supported when it is upgraded or scaled,
+		// so the supported versions are listed as examples rather than as the allowed values
+		return map[string]interface{}{"type": "string", "examples": stringValues(orchestratorVersions())}
+	case "OrchestratorProfile.orchestratorRelease":
+		return map[string]interface{}{"type": "string", "examples": stringValues(orchestratorReleases())}
+	case "KubernetesConfig.networkPlugin":
+		return map[string]interface{}{"type": "string", "enum": stringValues(NetworkPluginValues[:])}
+	case "KubernetesConfig.networkPolicy":
+		return map[string]interface{}{"type": "string", "enum": stringValues(NetworkPolicyValues[:])}
+	case "KubernetesConfig.containerRuntime":
+		return map[string]interface{}{"type": "string", "enum": stringValues(ContainerRuntimeValues[:])}
+	}
+	return nil
+}
+
+// applyValidateTag adds the constraints of a validate tag to the schema of a field,
+// and returns whether the field is required
+func applyValidateTag(schema map[string]interface{}, t reflect.Type, tag string) bool {
+	if tag == "" {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		if rule == "dive" {
+			// the rules after dive apply to the items of the field
+			itemRules := strings.SplitN(tag, "dive,", 2)
+			if items, ok := schema["items"].(map[string]interface{}); ok && len(itemRules) == 2 {
+				applyValidateTag(items, t.Elem(), itemRules[1])
+			}
+			break
+		}
+		if rule == "required" {
+			required = true
+			continue
+		}
+		if strings.Contains(rule, "|") {
+			enum := []interface{}{}
+			for _, alternative := range strings.Split(rule, "|") {
+				switch {
+				case strings.HasPrefix(alternative, "eq="):
+					enum = append(enum, typedValue(t, strings.TrimPrefix(alternative, "eq=")))
+				case alternative == "len=0" && t.Kind() == reflect.String:
+					enum = append(enum, "")
+				}
+			}
+			schema["enum"] = enum
+			continue
+		}
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil {
+			continue
+		}
+		var minKey, maxKey string
+		switch t.Kind() {
+		case reflect.String:
+			minKey, maxKey = "minLength", "maxLength"
+		case reflect.Slice, reflect.Array, reflect.Map:
+			minKey, maxKey = "minItems", "maxItems"
+			if t.Kind() == reflect.Map {
+				minKey, maxKey = "minProperties", "maxProperties"
+			}
+		default:
+			minKey, maxKey = "minimum", "maximum"
+		}
+		switch parts[0] {
+		case "min":
+			schema[minKey] = n
+		case "max":
+			schema[maxKey] = n
+		case "len":
+			schema[minKey] = n
+			schema[maxKey] = n
+		}
+	}
+	return required
+}
+
+// orchestratorVersions returns the versions of all the orchestrators supported by vlabs
+func orchestratorVersions() []string {
+	versions := []string{}
+	for version := range common.AllKubernetesSupportedVersions {
+		versions = append(versions, version)
+	}
+	versions = append(versions, common.GetAllSupportedOpenShiftVersions()...)
+	versions = append(versions, common.AllDCOSSupportedVersions...)
+	return uniqueSorted(versions)
+}
+
+// orchestratorReleases returns the major.minor releases of the orchestrator versions
+func orchestratorReleases() []string {
+	releases := []string{}
+	for _, version := range orchestratorVersions() {
+		parts := strings.SplitN(version, ".", 3)
+		if len(parts) < 2 {
+			continue
+		}
+		releases = append(releases, parts[0]+"."+parts[1])
+	}
+	return uniqueSorted(releases)
+}
+
+func uniqueSorted(values []string) []string {
+	sort.Strings(values)
+	unique := []string{}
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+func stringValues(values []string) []interface{} {
+	ret := make([]interface{}, len(values))
+	for i, value := range values {
+		ret[i] = value
+	}
+	return ret
+}
+
+// typedValue converts the value of an eq validate rule to the type of its field
+func typedValue(t reflect.Type, value string) interface{} {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// caseInsensitivePattern returns a regular expression matching s in any case
+func caseInsensitivePattern(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		lower, upper := strings.ToLower(string(r)), strings.ToUpper(string(r))
+		if lower == upper {
+			b.WriteString(lower)
+			continue
+		}
+		b.WriteString("[" + upper + lower + "]")
+	}
+	return b.String()
+}
+
+func appendRequired(required interface{}, names ...string) []interface{} {
+	ret, _ := required.([]interface{})
+	for _, name := range names {
+		ret = append(ret, name)
+	}
+	return ret
+}
@@ -0,0 +1,78 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package vlabs
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	schema := JSONSchema()
+	if _, err := json.Marshal(schema); err != nil {
+		t.Fatalf("expected the schema to marshal to JSON: %s", err)
+	}
+	if schema["$schema"] != JSONSchemaID {
+		t.Fatalf("unexpected $schema %v", schema["$schema"])
+	}
+
+	definitions := schema["definitions"].(map[string]interface{})
+	pool, ok := definitions["AgentPoolProfile"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected an AgentPoolProfile definition")
+	}
+	if !reflect.DeepEqual(pool["required"], []interface{}{"name", "count", "vmSize"}) {
+		t.Fatalf("unexpected required fields of AgentPoolProfile: %v", pool["required"])
+	}
+	properties := pool["properties"].(map[string]interface{})
+	count := properties["count"].(map[string]interface{})
+	if count["type"] != "integer" || count["minimum"] != MinAgentCount || count["maximum"] != MaxAgentCount {
+		t.Fatalf("unexpected schema of AgentPoolProfile.count: %v", count)
+	}
+	diskSizes := properties["diskSizesGB"].(map[string]interface{})
+	if diskSizes["maxItems"] != MaxDisks || diskSizes["items"].(map[string]interface{})["maximum"] != MaxDiskSizeGB {
+		t.Fatalf("unexpected schema of AgentPoolProfile.diskSizesGB: %v", diskSizes)
+	}
+	if !reflect.DeepEqual(properties["osType"].(map[string]interface{})["enum"], []interface{}{"", "Linux", "Windows"}) {
+		t.Fatalf("unexpected schema of AgentPoolProfile.osType: %v", properties["osType"])
+	}
+	if !reflect.DeepEqual(properties["storageProfile"].(map[string]interface{})["enum"], []interface{}{StorageAccount, ManagedDisks, ""}) {
+		t.Fatalf("unexpected schema of AgentPoolProfile.storageProfile: %v", properties["storageProfile"])
+	}
+	if properties["kubernetesConfig"].(map[string]interface{})["$ref"] != "#/definitions/KubernetesConfig" {
+		t.Fatalf("expected AgentPoolProfile.kubernetesConfig to reference the KubernetesConfig definition")
+	}
+
+	if _, ok := definitions[""]; ok {
+		t.Fatalf("expected anonymous structs not to be defined")
+	}
+	linux := definitions["LinuxProfile"].(map[string]interface{})
+	if ssh := linux["properties"].(map[string]interface{})["ssh"].(map[string]interface{}); ssh["type"] != "object" || ssh["$ref"] != nil {
+		t.Fatalf("expected LinuxProfile.ssh to be inlined, got %v", ssh)
+	}
+	if !reflect.DeepEqual(linux["required"], []interface{}{"ssh"}) {
+		t.Fatalf("unexpected required fields of LinuxProfile: %v", linux["required"])
+	}
+	if !reflect.DeepEqual(definitions["MasterProfile"].(map[string]interface{})["required"], []interface{}{"count", "vmSize"}) {
+		t.Fatalf("unexpected required fields of MasterProfile: %v", definitions["MasterProfile"].(map[string]interface{})["required"])
+	}
+
+	orchestrator := definitions["OrchestratorProfile"].(map[string]interface{})["properties"].(map[string]interface{})
+	for field, example := range map[string]string{"orchestratorVersion": "1.10.8", "orchestratorRelease": "1.10"} {
+		schema := orchestrator[field].(map[string]interface{})
+		found := false
+		for _, v := range schema["examples"].([]interface{}) {
+			if v == example {
+				found = true
+			}
+		}
+		if _, ok := schema["enum"]; ok {
+			t.Fatalf("expected the %s of deployed clusters that are no longer supported to be allowed", field)
+		}
+		if !found {
+			t.Fatalf("expected the supported Kubernetes versions in the %s examples, got %v", field, schema["examples"])
+		}
+	}
+}
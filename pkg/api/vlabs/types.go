@@ -47,6 +47,7 @@ type Properties struct {
 	AADProfile              *AADProfile              `json:"aadProfile,omitempty"`
 	AzProfile               *AzProfile               `json:"azProfile,omitempty"`
 	FeatureFlags            *FeatureFlags            `json:"featureFlags,omitempty"`
+	SecretsKeyvault         *SecretsKeyvault         `json:"secretsKeyvault,omitempty"`
 }
 
 // AzProfile holds the azure context for where the cluster resides
@@ -63,6 +64,17 @@ type FeatureFlags struct {
 	BlockOutboundInternet    bool `json:"blockOutboundInternet,omitempty"`
 }
 
+// SecretsKeyvault names the Azure Key Vault that stores the CA, the certificates and keys,
+// the etcd encryption key and the admin kubeconfig generated for the cluster, so that
+// the apimodel written to disk only holds references to them.
+// VaultID is the resource ID of the vault:
+// "/subscriptions/<SUB_ID>/resourceGroups/<RG_NAME>/providers/Microsoft.KeyVault/vaults/<KV_NAME>"
+// SecretNamePrefix prefixes the names of the secrets (default: the master DNS prefix).
+type SecretsKeyvault struct {
+	VaultID          string `json:"vaultID" validate:"required"`
+	SecretNamePrefix string `json:"secretNamePrefix,omitempty"`
+}
+
 // ServicePrincipalProfile contains the client and secret used by the cluster for Azure Resource CRUD
 // The 'Secret' and 'KeyvaultSecretRef' parameters are mutually exclusive
 // The 'Secret' parameter should be a secret in plain text.
@@ -128,6 +140,19 @@ type CertificateProfile struct {
 	EtcdPeerCertificates []string `json:"etcdPeerCertificates,omitempty"`
 	// EtcdPeerPrivateKeys is list of etcd peer private keys, and signed by the CA
 	EtcdPeerPrivateKeys []string `json:"etcdPeerPrivateKeys,omitempty"`
+	// CaCertificateChain are the certificates from the issuer of the CA up to a self-signed root,
+	// when the CA is an intermediate of another PKI
+	CaCertificateChain string `json:"caCertificateChain,omitempty"`
+	// KeyAlgorithm is the algorithm of the generated keys, RSA (default) or ECDSA
+	KeyAlgorithm string `json:"keyAlgorithm,omitempty"`
+	// KeySize is the size in bits of the generated RSA keys, or of the ECDSA curve
+	KeySize int `json:"keySize,omitempty"`
+	// CaValidityDays is how many days the generated CA is valid for
+	CaValidityDays int `json:"caValidityDays,omitempty"`
+	// ServerValidityDays is how many days the generated server certificates are valid for
+	ServerValidityDays int `json:"serverValidityDays,omitempty"`
+	// ClientValidityDays is how many days the generated client certificates are valid for
+	ClientValidityDays int `json:"clientValidityDays,omitempty"`
 }
 
 // LinuxProfile represents the linux parameters passed to the cluster
@@ -247,6 +272,22 @@ type KubernetesAddon struct {
 	Containers []KubernetesContainerSpec `json:"containers,omitempty"`
 	Config     map[string]string         `json:"config,omitempty"`
 	Data       string                    `json:"data,omitempty"`
+	Chart      *HelmChart                `json:"chart,omitempty"`
+}
+
+// HelmChart is the Helm chart installed by a chart addon with the addon config as values:
+// either a packaged chart delivered to the masters with the template, or a chart of a repository
+type HelmChart struct {
+	// Path is the packaged chart (.tgz), read when the template is generated
+	Path string `json:"path,omitempty"`
+	// Repository is the URL of the chart repository holding the chart
+	Repository string `json:"repository,omitempty"`
+	// Name is the name of the chart in Repository, the name of the addon if empty
+	Name string `json:"name,omitempty"`
+	// Version is the version of the chart in Repository, the latest version if empty
+	Version string `json:"version,omitempty"`
+	// Namespace is the namespace of the release
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // IsEnabled returns if the addon is explicitly enabled, or the user-provided default if non explicitly enabled
@@ -464,6 +505,9 @@ type AgentPoolProfile struct {
 	Extensions            []Extension       `json:"extensions"`
 	SinglePlacementGroup  *bool             `json:"singlePlacementGroup,omitempty"`
 	AvailabilityZones     []string          `json:"availabilityZones,omitempty"`
+	EnableAutoScaling     *bool             `json:"enableAutoScaling,omitempty"`
+	MinCount              *int              `json:"minCount,omitempty"`
+	MaxCount              *int              `json:"maxCount,omitempty"`
 }
 
 // AgentPoolProfileRole represents an agent role
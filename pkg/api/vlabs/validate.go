@@ -4,7 +4,9 @@
 package vlabs
 
 import (
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"net"
 	"net/url"
@@ -27,6 +29,8 @@ var (
 	keyvaultIDRegex *regexp.Regexp
 	labelValueRegex *regexp.Regexp
 	labelKeyRegex   *regexp.Regexp
+	// keyvaultSecretNameRegex matches Key Vault secret names, made of alphanumerics and dashes
+	keyvaultSecretNameRegex *regexp.Regexp
 	// Any version has to be mirrored in https://acs-mirror.azureedge.net/github-coreos/etcd-v[Version]-linux-amd64.tar.gz
 	etcdValidVersions = [...]string{"2.2.5", "2.3.0", "2.3.1", "2.3.2", "2.3.3", "2.3.4", "2.3.5", "2.3.6", "2.3.7", "2.3.8",
 		"3.0.0", "3.0.1", "3.0.2", "3.0.3", "3.0.4", "3.0.5", "3.0.6", "3.0.7", "3.0.8", "3.0.9", "3.0.10", "3.0.11", "3.0.12", "3.0.13", "3.0.14", "3.0.15", "3.0.16", "3.0.17",
@@ -105,53 +109,82 @@ func init() {
 	keyvaultIDRegex = regexp.MustCompile(`^/subscriptions/\S+/resourceGroups/\S+/providers/Microsoft.KeyVault/vaults/[^/\s]+$`)
 	labelValueRegex = regexp.MustCompile(labelValueFormat)
 	labelKeyRegex = regexp.MustCompile(labelKeyFormat)
+	keyvaultSecretNameRegex = regexp.MustCompile(`^[0-9a-zA-Z-]{1,127}$`)
 }
 
-// Validate implements APIObject
+// Validate implements APIObject. It runs all the checks of the apimodel and returns
+// ValidationErrors with every error they found, along with the warnings.
+// When there are only warnings, they are logged and Validate returns nil.
 func (a *Properties) Validate(isUpdate bool) error {
-	if e := validate.Struct(a); e != nil {
-		return handleValidationErrors(e.(validator.ValidationErrors))
-	}
-	if e := a.validateOrchestratorProfile(isUpdate); e != nil {
-		return e
-	}
-	if e := a.validateMasterProfile(); e != nil {
-		return e
-	}
-	if e := a.validateAgentPoolProfiles(isUpdate); e != nil {
-		return e
-	}
-	if e := a.validateZones(); e != nil {
-		return e
-	}
-	if e := a.validateLinuxProfile(); e != nil {
-		return e
-	}
-	if e := a.validateAddons(); e != nil {
-		return e
+	errs := a.validateAll(isUpdate)
+	if len(errs.Errors()) > 0 {
+		return errs
 	}
-	if e := a.validateExtensions(); e != nil {
-		return e
-	}
-	if e := a.validateVNET(); e != nil {
-		return e
-	}
-	if e := a.validateServicePrincipalProfile(); e != nil {
-		return e
+	for _, w := range errs.Warnings() {
+		log.Warnf("%s: %s", w.Path, w.Err)
 	}
+	return nil
+}
 
-	if e := a.validateManagedIdentity(); e != nil {
-		return e
-	}
+func (a *Properties) validateAll(isUpdate bool) ValidationErrors {
+	if e := validate.Struct(a); e != nil {
+		// the other checks rely on the required fields
+		return structValidationErrors(e.(validator.ValidationErrors))
+	}
+	errs := ValidationErrors{}
+	errs.add("properties.orchestratorProfile", CodeInvalidOrchestratorProfile, a.validateOrchestratorProfile(isUpdate))
+	errs.add("properties.masterProfile", CodeInvalidMasterProfile, a.validateMasterProfile())
+	if e, ok := a.validateAgentPoolProfiles(isUpdate).(ValidationErrors); ok {
+		errs = append(errs, e...)
+	}
+	errs.add("properties.masterProfile.availabilityZones", CodeInvalidAvailabilityZones, a.validateZones())
+	errs.add("properties.linuxProfile", CodeInvalidLinuxProfile, a.validateLinuxProfile())
+	errs.add("properties.orchestratorProfile.kubernetesConfig.addons", CodeInvalidAddon, a.validateAddons())
+	errs.add("properties.extensionProfiles", CodeInvalidExtension, a.validateExtensions())
+	errs.add("properties.masterProfile.vnetSubnetID", CodeInvalidVNET, a.validateVNET())
+	errs.add("properties.servicePrincipalProfile", CodeInvalidServicePrincipalProfile, a.validateServicePrincipalProfile())
+	errs.add("properties.orchestratorProfile.kubernetesConfig.useManagedIdentity", CodeInvalidManagedIdentity, a.validateManagedIdentity())
+	errs.add("properties.aadProfile", CodeInvalidAADProfile, a.validateAADProfile())
+	errs.add("properties.azProfile", CodeInvalidAzProfile, a.validateAzProfile())
+	errs.add("properties.certificateProfile", CodeInvalidCertificateProfile, a.validateCertificateProfile())
+	errs.add("properties.secretsKeyvault", CodeInvalidSecretsKeyvault, a.validateSecretsKeyvault())
+	a.addWarnings(&errs)
+	return errs
+}
 
-	if e := a.validateAADProfile(); e != nil {
-		return e
+// addWarnings adds the warnings about fields that are ignored or limit the cluster
+func (a *Properties) addWarnings(errs *ValidationErrors) {
+	if o := a.OrchestratorProfile; o.OrchestratorType == Kubernetes && o.KubernetesConfig != nil && o.KubernetesConfig.DockerEngineVersion != "" {
+		errs.warn("properties.orchestratorProfile.kubernetesConfig.dockerEngineVersion", CodeDeprecatedField,
+			errors.New("docker-engine is deprecated in favor of moby, but you passed in a dockerEngineVersion configuration. This will be ignored."))
+	}
+	// OpenShift generates its own certificate authorities, valid for 5 years
+	if c := a.CertificateProfile; c != nil && a.OrchestratorProfile.OrchestratorType != OpenShift && (c.ServerValidityDays > 0 || c.ClientValidityDays > 0) {
+		days := c.ServerValidityDays
+		if c.ClientValidityDays > days {
+			days = c.ClientValidityDays
+		}
+		notAfter := time.Now().AddDate(0, 0, days)
+		if c.CaCertificate == "" {
+			caValidity := helpers.ValidityDuration
+			if c.CaValidityDays > 0 {
+				caValidity = time.Duration(c.CaValidityDays) * 24 * time.Hour
+			}
+			if time.Duration(days)*24*time.Hour > caValidity {
+				errs.warn("properties.certificateProfile.caValidityDays", CodeInvalidCertificateProfile,
+					errors.Errorf("the generated certificate authority is valid for %d days, the certificates it issues will expire with it rather than after %d days", int(caValidity.Hours()/24), days))
+			}
+		} else if block, _ := pem.Decode([]byte(c.CaCertificate)); block != nil {
+			if ca, err := x509.ParseCertificate(block.Bytes); err == nil && notAfter.After(ca.NotAfter) {
+				errs.warn("properties.certificateProfile.caCertificate", CodeInvalidCertificateProfile,
+					errors.Errorf("the certificate authority expires on %s, the certificates it issues will expire then rather than after %d days", ca.NotAfter.Format(time.RFC3339), days))
+			}
+		}
 	}
-
-	if e := a.validateAzProfile(); e != nil {
-		return e
+	if a.MasterProfile.IsVirtualMachineScaleSets() && a.OrchestratorProfile.OrchestratorType == Kubernetes {
+		errs.warn("properties.masterProfile.availabilityProfile", CodeNotUpgradable,
+			errors.New("Clusters with VMSS masters are not yet upgradable! You will not be able to upgrade your cluster until a future version of acs-engine!"))
 	}
-	return nil
 }
 
 func handleValidationErrors(e validator.ValidationErrors) error {
@@ -288,10 +321,6 @@ func (a *Properties) validateOrchestratorProfile(isUpdate bool) error {
 						return errors.Errorf("standard loadBalancerSku should exclude master nodes. Please set KubernetesConfig \"ExcludeMasterFromStandardLB\" to \"true\"")
 					}
 				}
-
-				if o.KubernetesConfig.DockerEngineVersion != "" {
-					log.Warnf("docker-engine is deprecated in favor of moby, but you passed in a dockerEngineVersion configuration. This will be ignored.")
-				}
 			}
 		case OpenShift:
 			// TODO: add appropriate additional validation logic
@@ -383,7 +412,6 @@ func (a *Properties) validateMasterProfile() error {
 	}
 
 	if m.IsVirtualMachineScaleSets() && a.OrchestratorProfile.OrchestratorType == Kubernetes {
-		log.Warnf("Clusters with VMSS masters are not yet upgradable! You will not be able to upgrade your cluster until a future version of acs-engine!")
 		e := validateVMSS(a.OrchestratorProfile, false, m.StorageProfile)
 		if e != nil {
 			return e
@@ -402,89 +430,73 @@ func (a *Properties) validateMasterProfile() error {
 	return common.ValidateDNSPrefix(m.DNSPrefix)
 }
 
+// validateAgentPoolProfiles returns ValidationErrors with the errors of all the pools
 func (a *Properties) validateAgentPoolProfiles(isUpdate bool) error {
-
+	errs := ValidationErrors{}
 	profileNames := make(map[string]bool)
 	for i, agentPoolProfile := range a.AgentPoolProfiles {
+		path := fmt.Sprintf("properties.agentPoolProfiles[%d]", i)
 
-		if e := validatePoolName(agentPoolProfile.Name); e != nil {
-			return e
-		}
+		errs.add(path+".name", CodeInvalidAgentPoolProfile, validatePoolName(agentPoolProfile.Name))
 
 		// validate that each AgentPoolProfile Name is unique
 		if _, ok := profileNames[agentPoolProfile.Name]; ok {
-			return errors.Errorf("profile name '%s' already exists, profile names must be unique across pools", agentPoolProfile.Name)
+			errs.add(path+".name", CodeDuplicatePoolName, errors.Errorf("profile name '%s' already exists, profile names must be unique across pools", agentPoolProfile.Name))
 		}
 		profileNames[agentPoolProfile.Name] = true
 
-		if e := validatePoolOSType(agentPoolProfile.OSType); e != nil {
-			return e
-		}
+		errs.add(path+".osType", CodeInvalidAgentPoolProfile, validatePoolOSType(agentPoolProfile.OSType))
 
 		if helpers.IsTrueBoolPointer(agentPoolProfile.AcceleratedNetworkingEnabled) || helpers.IsTrueBoolPointer(agentPoolProfile.AcceleratedNetworkingEnabledWindows) {
-			if e := validatePoolAcceleratedNetworking(agentPoolProfile.VMSize); e != nil {
-				return e
-			}
+			errs.add(path+".vmSize", CodeInvalidAgentPoolProfile, validatePoolAcceleratedNetworking(agentPoolProfile.VMSize))
 		}
 
-		if e := agentPoolProfile.validateOrchestratorSpecificProperties(a.OrchestratorProfile.OrchestratorType); e != nil {
-			return e
-		}
+		errs.add(path, CodeInvalidAgentPoolProfile, agentPoolProfile.validateOrchestratorSpecificProperties(a.OrchestratorProfile.OrchestratorType))
 
 		if agentPoolProfile.ImageRef != nil {
-			return agentPoolProfile.ImageRef.validateImageNameAndGroup()
-		}
-
-		if e := agentPoolProfile.validateAvailabilityProfile(a.OrchestratorProfile.OrchestratorType); e != nil {
-			return e
-		}
-
-		if e := agentPoolProfile.validateRoles(a.OrchestratorProfile.OrchestratorType); e != nil {
-			return e
-		}
-
-		if e := agentPoolProfile.validateStorageProfile(a.OrchestratorProfile.OrchestratorType); e != nil {
-			return e
+			errs.add(path+".imageReference", CodeInvalidAgentPoolProfile, agentPoolProfile.ImageRef.validateImageNameAndGroup())
 		}
 
-		if e := agentPoolProfile.validateCustomNodeLabels(a.OrchestratorProfile.OrchestratorType); e != nil {
-			return e
-		}
+		errs.add(path+".availabilityProfile", CodeInvalidAgentPoolProfile, agentPoolProfile.validateAvailabilityProfile(a.OrchestratorProfile.OrchestratorType))
+		errs.add(path+".role", CodeInvalidAgentPoolProfile, agentPoolProfile.validateRoles(a.OrchestratorProfile.OrchestratorType))
+		errs.add(path+".storageProfile", CodeInvalidAgentPoolProfile, agentPoolProfile.validateStorageProfile(a.OrchestratorProfile.OrchestratorType))
+		errs.add(path+".customNodeLabels", CodeInvalidAgentPoolProfile, agentPoolProfile.validateCustomNodeLabels(a.OrchestratorProfile.OrchestratorType))
+		errs.add(path+".enableAutoScaling", CodeInvalidAgentPoolProfile, agentPoolProfile.validateAutoScaling(a.OrchestratorProfile, isUpdate))
 
 		if agentPoolProfile.AvailabilityProfile == VirtualMachineScaleSets {
-			e := validateVMSS(a.OrchestratorProfile, isUpdate, agentPoolProfile.StorageProfile)
-			if e != nil {
-				return e
-			}
+			errs.add(path+".availabilityProfile", CodeInvalidAgentPoolProfile, validateVMSS(a.OrchestratorProfile, isUpdate, agentPoolProfile.StorageProfile))
 		}
 
 		if a.OrchestratorProfile.OrchestratorType == Kubernetes {
 			if a.AgentPoolProfiles[i].AvailabilityProfile != a.AgentPoolProfiles[0].AvailabilityProfile {
-				return errors.New("mixed mode availability profiles are not allowed. Please set either VirtualMachineScaleSets or AvailabilitySet in availabilityProfile for all agent pools")
+				errs.add(path+".availabilityProfile", CodeInvalidAgentPoolProfile, errors.New("mixed mode availability profiles are not allowed. Please set either VirtualMachineScaleSets or AvailabilitySet in availabilityProfile for all agent pools"))
 			}
 
 			if a.AgentPoolProfiles[i].SinglePlacementGroup != nil && a.AgentPoolProfiles[i].AvailabilityProfile == AvailabilitySet {
-				return errors.New("singlePlacementGroup is only supported with VirtualMachineScaleSets")
+				errs.add(path+".singlePlacementGroup", CodeInvalidAgentPoolProfile, errors.New("singlePlacementGroup is only supported with VirtualMachineScaleSets"))
 			}
 		}
 
 		if a.OrchestratorProfile.OrchestratorType == OpenShift {
 			if (agentPoolProfile.Name == "infra") != (agentPoolProfile.Role == "infra") {
-				return errors.New("OpenShift requires that the 'infra' agent pool profile, and no other, should have role 'infra'")
+				errs.add(path+".role", CodeInvalidAgentPoolProfile, errors.New("OpenShift requires that the 'infra' agent pool profile, and no other, should have role 'infra'"))
 			}
 		}
 
-		if e := agentPoolProfile.validateWindows(a.OrchestratorProfile, a.WindowsProfile, isUpdate); agentPoolProfile.OSType == Windows && e != nil {
-			return e
+		if agentPoolProfile.OSType == Windows {
+			errs.add(path, CodeInvalidAgentPoolProfile, agentPoolProfile.validateWindows(a.OrchestratorProfile, a.WindowsProfile, isUpdate))
 		}
 	}
 
 	if a.OrchestratorProfile.OrchestratorType == OpenShift {
 		if !reflect.DeepEqual(profileNames, map[string]bool{"compute": true, "infra": true}) {
-			return errors.New("OpenShift requires exactly two agent pool profiles: compute and infra")
+			errs.add("properties.agentPoolProfiles", CodeInvalidAgentPoolProfile, errors.New("OpenShift requires exactly two agent pool profiles: compute and infra"))
 		}
 	}
 
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
@@ -528,6 +540,7 @@ func (a *Properties) validateAddons() error {
 	if a.OrchestratorProfile.KubernetesConfig != nil && a.OrchestratorProfile.KubernetesConfig.Addons != nil {
 		var isAvailabilitySets bool
 		var IsNSeriesSKU bool
+		var isAutoScaling bool
 
 		for _, agentPool := range a.AgentPoolProfiles {
 			if agentPool.IsAvailabilitySets() {
@@ -537,6 +550,10 @@ func (a *Properties) validateAddons() error {
 			if agentPool.IsNSeriesSKU() {
 				IsNSeriesSKU = true
 			}
+
+			if helpers.IsTrueBoolPointer(agentPool.EnableAutoScaling) {
+				isAutoScaling = true
+			}
 		}
 		for _, addon := range a.OrchestratorProfile.KubernetesConfig.Addons {
 
@@ -549,11 +566,29 @@ func (a *Properties) validateAddons() error {
 				}
 			}
 
+			if addon.Chart != nil {
+				if addon.Data != "" || len(addon.Containers) > 0 {
+					return errors.Errorf("Addon %s's containers and data should be empty when addon.chart is specified", addon.Name)
+				}
+				if (addon.Chart.Path == "") == (addon.Chart.Repository == "") {
+					return errors.Errorf("Addon %s's chart should specify either a path or a repository", addon.Name)
+				}
+				if addon.Chart.Path != "" && (addon.Chart.Name != "" || addon.Chart.Version != "") {
+					return errors.Errorf("Addon %s's chart name and version are only used with a repository", addon.Name)
+				}
+				if addon.Chart.Path != "" && !strings.HasSuffix(addon.Chart.Path, ".tgz") {
+					return errors.Errorf("Addon %s's chart path should be a packaged chart (.tgz)", addon.Name)
+				}
+			}
+
 			switch addon.Name {
 			case "cluster-autoscaler":
 				if helpers.IsTrueBoolPointer(addon.Enabled) && isAvailabilitySets {
 					return errors.Errorf("Cluster Autoscaler add-on can only be used with VirtualMachineScaleSets. Please specify \"availabilityProfile\": \"%s\"", VirtualMachineScaleSets)
 				}
+				if helpers.IsFalseBoolPointer(addon.Enabled) && isAutoScaling {
+					return errors.New("Cluster Autoscaler add-on cannot be disabled when an agent pool has \"enableAutoScaling\": true")
+				}
 			case "nvidia-device-plugin":
 				if helpers.IsTrueBoolPointer(addon.Enabled) {
 					version := common.RationalizeReleaseAndVersion(
@@ -765,6 +800,66 @@ func (a *Properties) validateAzProfile() error {
 	return nil
 }
 
+func (a *Properties) validateCertificateProfile() error {
+	c := a.CertificateProfile
+	if c == nil {
+		return nil
+	}
+	switch strings.ToUpper(c.KeyAlgorithm) {
+	case "", helpers.PkiKeyAlgorithmRSA:
+		if c.KeySize != 0 && c.KeySize < helpers.MinRSAKeySize {
+			return errors.Errorf("keySize must be at least %d for RSA keys, got %d", helpers.MinRSAKeySize, c.KeySize)
+		}
+	case helpers.PkiKeyAlgorithmECDSA:
+		if _, err := helpers.ECDSACurve(c.KeySize); err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("keyAlgorithm must be %s or %s, got %s", helpers.PkiKeyAlgorithmRSA, helpers.PkiKeyAlgorithmECDSA, c.KeyAlgorithm)
+	}
+	if c.CaValidityDays < 0 || c.ServerValidityDays < 0 || c.ClientValidityDays < 0 {
+		return errors.New("caValidityDays, serverValidityDays and clientValidityDays cannot be negative")
+	}
+	if c.CaCertificateChain != "" {
+		if c.CaCertificate == "" || c.CaPrivateKey == "" {
+			return errors.New("caCertificateChain requires caCertificate and caPrivateKey, the intermediate certificate authority it issued")
+		}
+		// the chain cannot be checked against a CA that is stored in Key Vault
+		_, _, _, caInKeyvault := helpers.ParseKeyvaultSecretPath(c.CaCertificate)
+		_, _, _, caKeyInKeyvault := helpers.ParseKeyvaultSecretPath(c.CaPrivateKey)
+		if (caInKeyvault || caKeyInKeyvault) && a.OrchestratorProfile.OrchestratorType == OpenShift {
+			return errors.Errorf("caCertificateChain requires caCertificate and caPrivateKey outside of Key Vault for orchestrator '%v'", OpenShift)
+		}
+		if !caInKeyvault && !caKeyInKeyvault {
+			if err := helpers.ValidateCAChain(c.CaCertificate, c.CaPrivateKey, c.CaCertificateChain); err != nil {
+				return errors.Wrap(err, "invalid caCertificateChain")
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Properties) validateSecretsKeyvault() error {
+	k := a.SecretsKeyvault
+	if k == nil {
+		return nil
+	}
+	if a.OrchestratorProfile.OrchestratorType != Kubernetes {
+		return errors.Errorf("secretsKeyvault is only supported by orchestrator '%v'", Kubernetes)
+	}
+	if !keyvaultIDRegex.MatchString(k.VaultID) {
+		return errors.Errorf("vaultID '%s' is not a Key Vault resource ID of the form /subscriptions/<SUB_ID>/resourceGroups/<RG_NAME>/providers/Microsoft.KeyVault/vaults/<KV_NAME>", k.VaultID)
+	}
+	if k.SecretNamePrefix != "" && !keyvaultSecretNameRegex.MatchString(k.SecretNamePrefix) {
+		return errors.Errorf("secretNamePrefix '%s' can only contain alphanumerics and dashes", k.SecretNamePrefix)
+	}
+	// the kubeconfig of the jumpbox is written in the template, where the certificates are references
+	if c := a.OrchestratorProfile.KubernetesConfig; c != nil && c.PrivateCluster != nil && helpers.IsTrueBoolPointer(c.PrivateCluster.Enabled) && c.PrivateCluster.JumpboxProfile != nil {
+		return errors.New("secretsKeyvault is not supported with the jumpbox of privateCluster")
+	}
+	return nil
+}
+
 // Validate OpenShiftConfig ensures that the OpenShiftConfig is valid.
 func (o *OpenShiftConfig) Validate() error {
 	if o.ClusterUsername == "" || o.ClusterPassword == "" {
@@ -790,6 +885,33 @@ func (a *AgentPoolProfile) validateAvailabilityProfile(orchestratorType string)
 	return nil
 }
 
+// validateAutoScaling checks that an agent pool scaled by the cluster autoscaler is a scale set
+// whose count is within minCount and maxCount
+func (a *AgentPoolProfile) validateAutoScaling(o *OrchestratorProfile, isUpdate bool) error {
+	if !helpers.IsTrueBoolPointer(a.EnableAutoScaling) {
+		return nil
+	}
+	if o.OrchestratorType != Kubernetes {
+		return errors.Errorf("enableAutoScaling is only supported for Orchestrator '%s'", Kubernetes)
+	}
+	// agent pools without an availabilityProfile default to AvailabilitySet below Kubernetes 1.10.2
+	isAvailabilitySets := a.IsAvailabilitySets()
+	if a.AvailabilityProfile == "" {
+		version := common.RationalizeReleaseAndVersion(o.OrchestratorType, o.OrchestratorRelease, o.OrchestratorVersion, isUpdate, false)
+		isAvailabilitySets = version != "" && !common.IsKubernetesVersionGe(version, "1.10.2")
+	}
+	if isAvailabilitySets {
+		return errors.Errorf("enableAutoScaling can only be used with VirtualMachineScaleSets. Please specify \"availabilityProfile\": \"%s\" for agent pool '%s'", VirtualMachineScaleSets, a.Name)
+	}
+	if a.MinCount == nil || a.MaxCount == nil {
+		return errors.Errorf("minCount and maxCount must be set when enableAutoScaling is true for agent pool '%s'", a.Name)
+	}
+	if *a.MinCount < 0 || *a.MinCount > a.Count || a.Count > *a.MaxCount {
+		return errors.Errorf("agent pool '%s' must have 0 <= minCount <= count <= maxCount, got minCount %d, count %d and maxCount %d", a.Name, *a.MinCount, a.Count, *a.MaxCount)
+	}
+	return nil
+}
+
 func (a *AgentPoolProfile) validateRoles(orchestratorType string) error {
 	validRoles := []AgentPoolProfileRole{AgentPoolProfileRoleEmpty}
 	if orchestratorType == OpenShift {
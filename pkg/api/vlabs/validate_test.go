@@ -1025,6 +1025,177 @@ func TestValidateProperties_AzProfile(t *testing.T) {
 
 }
 
+func TestValidateProperties_CertificateProfile(t *testing.T) {
+	ca, err := helpers.CreatePkiKeyCertPair("ca", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating a CA: %s", err)
+	}
+	other, err := helpers.CreatePkiKeyCertPair("other", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating a CA: %s", err)
+	}
+
+	tests := []struct {
+		name        string
+		profile     CertificateProfile
+		openshift   bool
+		expectedErr string
+	}{
+		{
+			name:    "ECDSA with validity",
+			profile: CertificateProfile{KeyAlgorithm: "ECDSA", CaValidityDays: 1095, ServerValidityDays: 365, ClientValidityDays: 365},
+		},
+		{
+			name:        "unknown algorithm",
+			profile:     CertificateProfile{KeyAlgorithm: "DSA"},
+			expectedErr: "keyAlgorithm must be RSA or ECDSA, got DSA",
+		},
+		{
+			name:        "small RSA key",
+			profile:     CertificateProfile{KeySize: 1024},
+			expectedErr: "keySize must be at least 2048 for RSA keys, got 1024",
+		},
+		{
+			name:        "unknown curve",
+			profile:     CertificateProfile{KeyAlgorithm: "ECDSA", KeySize: 2048},
+			expectedErr: "unsupported ECDSA key size 2048, expected 256, 384 or 521",
+		},
+		{
+			name:        "negative validity",
+			profile:     CertificateProfile{ServerValidityDays: -1},
+			expectedErr: "caValidityDays, serverValidityDays and clientValidityDays cannot be negative",
+		},
+		{
+			name:    "chain",
+			profile: CertificateProfile{CaCertificate: ca.CertificatePem, CaPrivateKey: ca.PrivateKeyPem, CaCertificateChain: ca.CertificatePem},
+		},
+		{
+			name:        "chain without CA",
+			profile:     CertificateProfile{CaCertificateChain: ca.CertificatePem},
+			expectedErr: "caCertificateChain requires caCertificate and caPrivateKey, the intermediate certificate authority it issued",
+		},
+		{
+			name:        "chain not issuing the CA",
+			profile:     CertificateProfile{CaCertificate: ca.CertificatePem, CaPrivateKey: ca.PrivateKeyPem, CaCertificateChain: other.CertificatePem},
+			expectedErr: "invalid caCertificateChain: the certificate authority is not issued by the certificate chain",
+		},
+		{
+			name:      "chain with OpenShift",
+			profile:   CertificateProfile{CaCertificate: ca.CertificatePem, CaPrivateKey: ca.PrivateKeyPem, CaCertificateChain: ca.CertificatePem},
+			openshift: true,
+		},
+		{
+			name: "chain with OpenShift and the CA in Key Vault",
+			profile: CertificateProfile{
+				CaCertificate:      "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv/secrets/ca-certificate",
+				CaPrivateKey:       "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv/secrets/ca-private-key",
+				CaCertificateChain: other.CertificatePem,
+			},
+			openshift:   true,
+			expectedErr: "caCertificateChain requires caCertificate and caPrivateKey outside of Key Vault for orchestrator 'OpenShift'",
+		},
+		{
+			name: "chain with the CA in Key Vault",
+			profile: CertificateProfile{
+				CaCertificate:      "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv/secrets/ca-certificate",
+				CaPrivateKey:       "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv/secrets/ca-private-key",
+				CaCertificateChain: other.CertificatePem,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			p := getK8sDefaultProperties(false)
+			if test.openshift {
+				p.OrchestratorProfile.OrchestratorType = OpenShift
+			}
+			p.CertificateProfile = &test.profile
+			err := p.validateCertificateProfile()
+			if test.expectedErr == "" && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if test.expectedErr != "" && (err == nil || !strings.HasPrefix(err.Error(), test.expectedErr)) {
+				t.Errorf("expected error %s, got %v", test.expectedErr, err)
+			}
+		})
+	}
+
+	t.Run("certificates outliving the certificate authority", func(t *testing.T) {
+		t.Parallel()
+		p := getK8sDefaultProperties(false)
+		p.CertificateProfile = &CertificateProfile{CaValidityDays: 365, ServerValidityDays: 730}
+		errs := p.validateAll(false)
+		warnings := errs.Warnings()
+		if len(errs.Errors()) != 0 || len(warnings) != 1 || warnings[0].Path != "properties.certificateProfile.caValidityDays" {
+			t.Errorf("expected a warning about the validity of the certificate authority, got %v", errs)
+		}
+	})
+}
+
+func TestValidateProperties_SecretsKeyvault(t *testing.T) {
+	tests := []struct {
+		name        string
+		keyvault    SecretsKeyvault
+		openshift   bool
+		jumpbox     bool
+		expectedErr string
+	}{
+		{
+			name:     "vault",
+			keyvault: SecretsKeyvault{VaultID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv", SecretNamePrefix: "cluster-1"},
+		},
+		{
+			name:        "secret instead of vault",
+			keyvault:    SecretsKeyvault{VaultID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv/secrets/name"},
+			expectedErr: "vaultID '/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv/secrets/name' is not a Key Vault resource ID",
+		},
+		{
+			name:        "invalid prefix",
+			keyvault:    SecretsKeyvault{VaultID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv", SecretNamePrefix: "cluster_1"},
+			expectedErr: "secretNamePrefix 'cluster_1' can only contain alphanumerics and dashes",
+		},
+		{
+			name:        "OpenShift",
+			keyvault:    SecretsKeyvault{VaultID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv"},
+			openshift:   true,
+			expectedErr: "secretsKeyvault is only supported by orchestrator 'Kubernetes'",
+		},
+		{
+			name:        "private cluster jumpbox",
+			keyvault:    SecretsKeyvault{VaultID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv"},
+			jumpbox:     true,
+			expectedErr: "secretsKeyvault is not supported with the jumpbox of privateCluster",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			p := getK8sDefaultProperties(false)
+			if test.openshift {
+				p.OrchestratorProfile.OrchestratorType = OpenShift
+			}
+			if test.jumpbox {
+				p.OrchestratorProfile.KubernetesConfig = &KubernetesConfig{
+					PrivateCluster: &PrivateCluster{Enabled: helpers.PointerToBool(true), JumpboxProfile: &PrivateJumpboxProfile{Name: "jumpbox"}},
+				}
+			}
+			p.SecretsKeyvault = &test.keyvault
+			err := p.validateSecretsKeyvault()
+			if test.expectedErr == "" && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if test.expectedErr != "" && (err == nil || !strings.HasPrefix(err.Error(), test.expectedErr)) {
+				t.Errorf("expected error %s, got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
 func TestProperties_ValidateInvalidStruct(t *testing.T) {
 	p := getK8sDefaultProperties(false)
 	p.OrchestratorProfile = &OrchestratorProfile{}
@@ -1279,6 +1450,29 @@ func Test_Properties_ValidateAddons(t *testing.T) {
 			"should not error on providing valid addon.Data",
 		)
 	}
+
+	for _, test := range []struct {
+		desc  string
+		addon KubernetesAddon
+		ok    bool
+	}{
+		{"packaged chart", KubernetesAddon{Name: "my-chart", Chart: &HelmChart{Path: "charts/my-chart-1.0.0.tgz"}}, true},
+		{"repository chart", KubernetesAddon{Name: "my-chart", Chart: &HelmChart{Repository: "https://contoso.github.io/charts", Version: "1.0.0"}}, true},
+		{"no path nor repository", KubernetesAddon{Name: "my-chart", Chart: &HelmChart{}}, false},
+		{"path and repository", KubernetesAddon{Name: "my-chart", Chart: &HelmChart{Path: "my-chart.tgz", Repository: "https://contoso.github.io/charts"}}, false},
+		{"version of a packaged chart", KubernetesAddon{Name: "my-chart", Chart: &HelmChart{Path: "my-chart.tgz", Version: "1.0.0"}}, false},
+		{"unpackaged chart", KubernetesAddon{Name: "my-chart", Chart: &HelmChart{Path: "charts/my-chart"}}, false},
+		{"chart with containers", KubernetesAddon{Name: "my-chart", Containers: []KubernetesContainerSpec{{Name: "my-chart"}}, Chart: &HelmChart{Path: "my-chart.tgz"}}, false},
+	} {
+		p.OrchestratorProfile.KubernetesConfig = &KubernetesConfig{Addons: []KubernetesAddon{test.addon}}
+		err := p.validateAddons()
+		if test.ok && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.desc, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: expected an error", test.desc)
+		}
+	}
 }
 
 func TestWindowsVersions(t *testing.T) {
@@ -1926,7 +2120,7 @@ func TestProperties_ValidateZones(t *testing.T) {
 				ExcludeMasterFromStandardLB: helpers.PointerToBool(test.excludeMasterFromStandardLB),
 			}
 
-			if err := p.Validate(false); err != nil {
+			if err := firstError(p.Validate(false)); err != nil {
 				expectedMsg := test.expectedErr
 				if err.Error() != expectedMsg {
 					t.Errorf("expected error with message : %s, but got : %s", expectedMsg, err.Error())
@@ -2006,7 +2200,7 @@ func TestProperties_ValidateSinglePlacementGroup(t *testing.T) {
 			p.OrchestratorProfile.OrchestratorRelease = "1.12"
 			p.MasterProfile = test.masterProfile
 			p.AgentPoolProfiles = test.agentPoolProfiles
-			err := p.Validate(true)
+			err := firstError(p.Validate(true))
 			if err.Error() != test.expectedMsg {
 				t.Errorf("expected error message : %s, but got %s", test.expectedMsg, err.Error())
 			}
@@ -2180,7 +2374,7 @@ func TestProperties_ValidateVNET(t *testing.T) {
 			p.OrchestratorProfile.OrchestratorRelease = "1.10"
 			p.MasterProfile = test.masterProfile
 			p.AgentPoolProfiles = test.agentPoolProfiles
-			err := p.Validate(true)
+			err := firstError(p.Validate(true))
 			if err.Error() != test.expectedMsg {
 				t.Errorf("expected error message : %s, but got %s", test.expectedMsg, err.Error())
 			}
@@ -2342,7 +2536,7 @@ func TestOpenshiftValidate(t *testing.T) {
 		test := test
 		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
-			gotErr := test.properties.Validate(test.isUpgrade)
+			gotErr := firstError(test.properties.Validate(test.isUpgrade))
 			if !helpers.EqualError(gotErr, test.expectedErr) {
 				t.Logf("running scenario %q", test.name)
 				t.Errorf("expected error: %v\ngot error: %v", test.expectedErr, gotErr)
@@ -2580,7 +2774,7 @@ func TestValidateProperties_OrchestratorSpecificProperties(t *testing.T) {
 		agentPoolProfiles := p.AgentPoolProfiles
 		agentPoolProfiles[0].DNSPrefix = "sampleprefix"
 		expectedMsg := "AgentPoolProfile.DNSPrefix must be empty for Kubernetes"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s", expectedMsg)
 		}
 	})
@@ -2591,7 +2785,7 @@ func TestValidateProperties_OrchestratorSpecificProperties(t *testing.T) {
 		agentPoolProfiles := p.AgentPoolProfiles
 		agentPoolProfiles[0].Ports = []int{80, 443, 8080}
 		expectedMsg := "AgentPoolProfile.Ports must be empty for Kubernetes"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s, but got %s", expectedMsg, err.Error())
 		}
 	})
@@ -2604,7 +2798,7 @@ func TestValidateProperties_OrchestratorSpecificProperties(t *testing.T) {
 		agentPoolProfiles[0].ScaleSetPriority = "Regular"
 		agentPoolProfiles[0].ScaleSetEvictionPolicy = "Deallocate"
 		expectedMsg := "property 'AgentPoolProfile.ScaleSetEvictionPolicy' must be empty for AgentPoolProfile.Priority of Regular"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s, but got %s", expectedMsg, err.Error())
 		}
 	})
@@ -2616,7 +2810,7 @@ func TestValidateProperties_OrchestratorSpecificProperties(t *testing.T) {
 		agentPoolProfiles := p.AgentPoolProfiles
 		agentPoolProfiles[0].DNSPrefix = "invalid_prefix"
 		expectedMsg := "DNSPrefix 'invalid_prefix' is invalid. The DNSPrefix must contain between 3 and 45 characters and can contain only letters, numbers, and hyphens.  It must start with a letter and must end with a letter or a number. (length was 14)"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s, but got %s", expectedMsg, err.Error())
 		}
 	})
@@ -2628,7 +2822,7 @@ func TestValidateProperties_OrchestratorSpecificProperties(t *testing.T) {
 		agentPoolProfiles := p.AgentPoolProfiles
 		agentPoolProfiles[0].Ports = []int{80, 443}
 		expectedMsg := "AgentPoolProfile.Ports must be empty when AgentPoolProfile.DNSPrefix is empty for Orchestrator: OpenShift"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s, but got %s", expectedMsg, err.Error())
 		}
 	})
@@ -2641,7 +2835,7 @@ func TestValidateProperties_OrchestratorSpecificProperties(t *testing.T) {
 		agentPoolProfiles[0].Ports = []int{80, 443, 80}
 		agentPoolProfiles[0].DNSPrefix = "sampleprefix"
 		expectedMsg := "agent profile 'agentpool' has duplicate port '80', ports must be unique"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s, but got %s", expectedMsg, err.Error())
 		}
 	})
@@ -2654,7 +2848,7 @@ func TestValidateProperties_OrchestratorSpecificProperties(t *testing.T) {
 		agentPoolProfiles[0].DiskSizesGB = []int{512, 256, 768}
 		agentPoolProfiles[0].DNSPrefix = "sampleprefix"
 		expectedMsg := "property 'StorageProfile' must be set to either 'StorageAccount' or 'ManagedDisks' when attaching disks"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s, but got %s", expectedMsg, err.Error())
 		}
 	})
@@ -2668,7 +2862,7 @@ func TestValidateProperties_OrchestratorSpecificProperties(t *testing.T) {
 		agentPoolProfiles[0].StorageProfile = "ManagedDisks"
 		agentPoolProfiles[0].AvailabilityProfile = "InvalidAvailabilityProfile"
 		expectedMsg := "property 'AvailabilityProfile' must be set to either 'VirtualMachineScaleSets' or 'AvailabilitySet' when attaching disks"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s, but got %s", expectedMsg, err.Error())
 		}
 	})
@@ -2682,7 +2876,7 @@ func TestValidateProperties_OrchestratorSpecificProperties(t *testing.T) {
 		agentPoolProfiles[0].StorageProfile = "StorageAccount"
 		agentPoolProfiles[0].AvailabilityProfile = "VirtualMachineScaleSets"
 		expectedMsg := "VirtualMachineScaleSets does not support storage account attached disks.  Instead specify 'StorageAccount': 'ManagedDisks' or specify AvailabilityProfile 'AvailabilitySet'"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s, but got %s", expectedMsg, err.Error())
 		}
 	})
@@ -2698,7 +2892,7 @@ func TestValidateProperties_CustomNodeLabels(t *testing.T) {
 			"a/b/c": "a",
 		}
 		expectedMsg := "Label key 'a/b/c' is invalid. Valid label keys have two segments: an optional prefix and name, separated by a slash (/). The name segment is required and must be 63 characters or less, beginning and ending with an alphanumeric character ([a-z0-9A-Z]) with dashes (-), underscores (_), dots (.), and alphanumerics between. The prefix is optional. If specified, the prefix must be a DNS subdomain: a series of DNS labels separated by dots (.), not longer than 253 characters in total, followed by a slash (/)"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s, but got %s", expectedMsg, err.Error())
 		}
 	})
@@ -2711,7 +2905,7 @@ func TestValidateProperties_CustomNodeLabels(t *testing.T) {
 			"fookey": "b$$a$$r",
 		}
 		expectedMsg := "Label value 'b$$a$$r' is invalid. Valid label values must be 63 characters or less and must be empty or begin and end with an alphanumeric character ([a-z0-9A-Z]) with dashes (-), underscores (_), dots (.), and alphanumerics between"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s, but got %s", expectedMsg, err.Error())
 		}
 	})
@@ -2725,7 +2919,7 @@ func TestValidateProperties_CustomNodeLabels(t *testing.T) {
 			"foo": "bar",
 		}
 		expectedMsg := "Agent CustomNodeLabels are only supported for DCOS and Kubernetes"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s, but got %s", expectedMsg, err.Error())
 		}
 	})
@@ -2738,7 +2932,7 @@ func TestAgentPoolProfile_ValidateAvailabilityProfile(t *testing.T) {
 		agentPoolProfiles := p.AgentPoolProfiles
 		agentPoolProfiles[0].AvailabilityProfile = "InvalidAvailabilityProfile"
 		expectedMsg := "unknown availability profile type 'InvalidAvailabilityProfile' for agent pool 'agentpool'.  Specify either AvailabilitySet, or VirtualMachineScaleSets"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s, but got %s", expectedMsg, err.Error())
 		}
 	})
@@ -2750,8 +2944,108 @@ func TestAgentPoolProfile_ValidateAvailabilityProfile(t *testing.T) {
 		agentPoolProfiles := p.AgentPoolProfiles
 		agentPoolProfiles[0].AvailabilityProfile = VirtualMachineScaleSets
 		expectedMsg := "Only AvailabilityProfile: AvailabilitySet is supported for Orchestrator 'OpenShift'"
-		if err := p.validateAgentPoolProfiles(true); err.Error() != expectedMsg {
+		if err := firstError(p.validateAgentPoolProfiles(true)); err.Error() != expectedMsg {
 			t.Errorf("expected error with message : %s, but got %s", expectedMsg, err.Error())
 		}
 	})
 }
+
+func TestAgentPoolProfile_ValidateAutoScaling(t *testing.T) {
+	tests := []struct {
+		name                string
+		availabilityProfile string
+		release             string
+		minCount, maxCount  *int
+		expectedMsg         string
+	}{
+		{
+			name:                "VMSS pool within its bounds",
+			availabilityProfile: VirtualMachineScaleSets,
+			release:             "1.12",
+			minCount:            helpers.PointerToInt(1),
+			maxCount:            helpers.PointerToInt(5),
+		},
+		{
+			name:                "availability set pool",
+			availabilityProfile: AvailabilitySet,
+			release:             "1.12",
+			minCount:            helpers.PointerToInt(1),
+			maxCount:            helpers.PointerToInt(5),
+			expectedMsg:         `enableAutoScaling can only be used with VirtualMachineScaleSets. Please specify "availabilityProfile": "VirtualMachineScaleSets" for agent pool 'agentpool'`,
+		},
+		{
+			name:        "pool defaulting to availability sets",
+			release:     "1.9",
+			minCount:    helpers.PointerToInt(1),
+			maxCount:    helpers.PointerToInt(5),
+			expectedMsg: `enableAutoScaling can only be used with VirtualMachineScaleSets. Please specify "availabilityProfile": "VirtualMachineScaleSets" for agent pool 'agentpool'`,
+		},
+		{
+			name:                "missing maxCount",
+			availabilityProfile: VirtualMachineScaleSets,
+			release:             "1.12",
+			minCount:            helpers.PointerToInt(1),
+			expectedMsg:         "minCount and maxCount must be set when enableAutoScaling is true for agent pool 'agentpool'",
+		},
+		{
+			name:                "count above maxCount",
+			availabilityProfile: VirtualMachineScaleSets,
+			release:             "1.12",
+			minCount:            helpers.PointerToInt(1),
+			maxCount:            helpers.PointerToInt(1),
+			expectedMsg:         "agent pool 'agentpool' must have 0 <= minCount <= count <= maxCount, got minCount 1, count 2 and maxCount 1",
+		},
+		{
+			name:                "count below minCount",
+			availabilityProfile: VirtualMachineScaleSets,
+			release:             "1.12",
+			minCount:            helpers.PointerToInt(3),
+			maxCount:            helpers.PointerToInt(5),
+			expectedMsg:         "agent pool 'agentpool' must have 0 <= minCount <= count <= maxCount, got minCount 3, count 2 and maxCount 5",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			o := &OrchestratorProfile{OrchestratorType: Kubernetes, OrchestratorRelease: test.release}
+			a := &AgentPoolProfile{
+				Name:                "agentpool",
+				Count:               2,
+				AvailabilityProfile: test.availabilityProfile,
+				EnableAutoScaling:   helpers.PointerToBool(true),
+				MinCount:            test.minCount,
+				MaxCount:            test.maxCount,
+			}
+			err := a.validateAutoScaling(o, false)
+			if test.expectedMsg == "" && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if test.expectedMsg != "" && (err == nil || err.Error() != test.expectedMsg) {
+				t.Errorf("expected error message : %s, but got %v", test.expectedMsg, err)
+			}
+		})
+	}
+
+	t.Run("Should fail when the cluster-autoscaler addon is disabled", func(t *testing.T) {
+		t.Parallel()
+		p := getK8sDefaultProperties(false)
+		p.AgentPoolProfiles[0].EnableAutoScaling = helpers.PointerToBool(true)
+		p.OrchestratorProfile.KubernetesConfig = &KubernetesConfig{
+			Addons: []KubernetesAddon{{Name: "cluster-autoscaler", Enabled: helpers.PointerToBool(false)}},
+		}
+		expectedMsg := `Cluster Autoscaler add-on cannot be disabled when an agent pool has "enableAutoScaling": true`
+		if err := p.validateAddons(); err == nil || err.Error() != expectedMsg {
+			t.Errorf("expected error with message : %s, but got %v", expectedMsg, err)
+		}
+	})
+}
+
+// firstError returns the first error of ValidationErrors, the one Validate used to stop at
+func firstError(err error) error {
+	if errs, ok := err.(ValidationErrors); ok && len(errs.Errors()) > 0 {
+		return errs.Errors()[0]
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package vlabs
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// ValidationSeverity tells whether a validation error fails the validation of an apimodel
+type ValidationSeverity string
+
+const (
+	// SeverityError fails the validation
+	SeverityError ValidationSeverity = "error"
+	// SeverityWarning is reported without failing the validation, for instance for deprecated fields
+	SeverityWarning ValidationSeverity = "warning"
+)
+
+// Codes of the validation errors
+const (
+	CodeInvalidField                   = "InvalidField"
+	CodeMissingField                   = "MissingField"
+	CodeDeprecatedField                = "DeprecatedField"
+	CodeInvalidOrchestratorProfile     = "InvalidOrchestratorProfile"
+	CodeInvalidMasterProfile           = "InvalidMasterProfile"
+	CodeInvalidAgentPoolProfile        = "InvalidAgentPoolProfile"
+	CodeDuplicatePoolName              = "DuplicatePoolName"
+	CodeInvalidAvailabilityZones       = "InvalidAvailabilityZones"
+	CodeInvalidLinuxProfile            = "InvalidLinuxProfile"
+	CodeInvalidAddon                   = "InvalidAddon"
+	CodeInvalidExtension               = "InvalidExtension"
+	CodeInvalidVNET                    = "InvalidVNET"
+	CodeInvalidServicePrincipalProfile = "InvalidServicePrincipalProfile"
+	CodeInvalidManagedIdentity         = "InvalidManagedIdentity"
+	CodeInvalidAADProfile              = "InvalidAADProfile"
+	CodeInvalidAzProfile               = "InvalidAzProfile"
+	CodeInvalidCertificateProfile      = "InvalidCertificateProfile"
+	CodeInvalidSecretsKeyvault         = "InvalidSecretsKeyvault"
+	CodeNotUpgradable                  = "NotUpgradable"
+)
+
+// ValidationError is an invalid field of an apimodel
+type ValidationError struct {
+	// Path is the JSON path of the field, such as properties.agentPoolProfiles[2].vmSize
+	Path     string
+	Code     string
+	Severity ValidationSeverity
+	Err      error
+}
+
+// Error implements error interface
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+// String returns the error with its severity, path and code
+func (e *ValidationError) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", e.Severity, e.Path, e.Err, e.Code)
+}
+
+// ValidationErrors are all the validation errors and warnings of an apimodel
+type ValidationErrors []*ValidationError
+
+// Error implements error interface. A single error reads as its own message.
+func (e ValidationErrors) Error() string {
+	errs := e.Errors()
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d validation errors:", len(errs))
+	for _, err := range errs {
+		fmt.Fprintf(&b, "\n  %s: %s (%s)", err.Path, err.Err, err.Code)
+	}
+	return b.String()
+}
+
+// Errors returns the entries that fail the validation
+func (e ValidationErrors) Errors() ValidationErrors {
+	return e.bySeverity(SeverityError)
+}
+
+// Warnings returns the entries that do not fail the validation
+func (e ValidationErrors) Warnings() ValidationErrors {
+	return e.bySeverity(SeverityWarning)
+}
+
+func (e ValidationErrors) bySeverity(severity ValidationSeverity) ValidationErrors {
+	ret := ValidationErrors{}
+	for _, err := range e {
+		if err.Severity == severity {
+			ret = append(ret, err)
+		}
+	}
+	return ret
+}
+
+// add appends an error at path unless err is nil
+func (e *ValidationErrors) add(path, code string, err error) {
+	if err == nil {
+		return
+	}
+	*e = append(*e, &ValidationError{Path: path, Code: code, Severity: SeverityError, Err: err})
+}
+
+// warn appends a warning at path
+func (e *ValidationErrors) warn(path, code string, err error) {
+	*e = append(*e, &ValidationError{Path: path, Code: code, Severity: SeverityWarning, Err: err})
+}
+
+// structValidationErrors converts the errors of the validate tags of Properties
+func structValidationErrors(e validator.ValidationErrors) ValidationErrors {
+	errs := ValidationErrors{}
+	for _, fieldErr := range e {
+		code := CodeInvalidField
+		if fieldErr.Tag() == "required" {
+			code = CodeMissingField
+		}
+		errs.add(jsonPath(reflect.TypeOf(Properties{}), fieldErr.StructNamespace()), code,
+			handleValidationErrors(validator.ValidationErrors{fieldErr}))
+	}
+	return errs
+}
+
+var namespaceIndexRegex = regexp.MustCompile(`^(\w+)(\[.*\])?$`)
+
+// jsonPath converts the namespace of a field of a struct of type t, such as
+// Properties.AgentPoolProfiles[2].VMSize, to the JSON path of the field in an apimodel
+func jsonPath(t reflect.Type, namespace string) string {
+	parts := strings.Split(namespace, ".")
+	path := []string{"properties"}
+	for _, part := range parts[1:] {
+		m := namespaceIndexRegex.FindStringSubmatch(part)
+		if m == nil {
+			path = append(path, part)
+			continue
+		}
+		name, index := m[1], m[2]
+		for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map) {
+			t = t.Elem()
+		}
+		if t == nil || t.Kind() != reflect.Struct {
+			path = append(path, name+index)
+			continue
+		}
+		f, ok := t.FieldByName(name)
+		if !ok {
+			path = append(path, name+index)
+			t = nil
+			continue
+		}
+		if tag := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]; tag != "" && tag != "-" {
+			name = tag
+		}
+		path = append(path, name+index)
+		t = f.Type
+	}
+	return strings.Join(path, ".")
+}
@@ -0,0 +1,110 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package vlabs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	p := getK8sDefaultProperties(false)
+	p.MasterProfile.DNSPrefix = "-"
+	p.AgentPoolProfiles = append(p.AgentPoolProfiles, &AgentPoolProfile{
+		Name:                "agentpool",
+		VMSize:              "Standard_D2_v2",
+		Count:               1,
+		AvailabilityProfile: AvailabilitySet,
+	})
+	p.AADProfile = &AADProfile{ClientAppID: "invalid"}
+
+	err := p.Validate(false)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	type entry struct {
+		path string
+		code string
+	}
+	var got []entry
+	for _, e := range errs {
+		if e.Severity != SeverityError {
+			t.Errorf("expected %s to be an error, got %s", e.Path, e.Severity)
+		}
+		got = append(got, entry{e.Path, e.Code})
+	}
+	expected := []entry{
+		{"properties.masterProfile", CodeInvalidMasterProfile},
+		{"properties.agentPoolProfiles[1].name", CodeDuplicatePoolName},
+		{"properties.aadProfile", CodeInvalidAADProfile},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected errors %v, got %v", expected, got)
+	}
+	if len(errs.Errors()) != 3 || len(errs.Warnings()) != 0 {
+		t.Errorf("expected 3 errors and no warnings, got %d and %d", len(errs.Errors()), len(errs.Warnings()))
+	}
+}
+
+func TestValidateStructErrorPaths(t *testing.T) {
+	p := getK8sDefaultProperties(false)
+	p.AgentPoolProfiles[0].Count = 1000
+	p.AgentPoolProfiles[0].VMSize = ""
+
+	errs, ok := p.Validate(false).(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected ValidationErrors")
+	}
+	paths := map[string]string{}
+	for _, e := range errs {
+		paths[e.Path] = e.Code
+	}
+	expected := map[string]string{
+		"properties.agentPoolProfiles[0].count":  CodeInvalidField,
+		"properties.agentPoolProfiles[0].vmSize": CodeMissingField,
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected errors %v, got %v", expected, paths)
+	}
+}
+
+func TestValidateWarnings(t *testing.T) {
+	p := getK8sDefaultProperties(false)
+	p.OrchestratorProfile.KubernetesConfig = &KubernetesConfig{DockerEngineVersion: "17.03.*"}
+	if err := p.Validate(false); err != nil {
+		t.Fatalf("expected warnings not to fail the validation, got %v", err)
+	}
+
+	p.MasterProfile.DNSPrefix = "-"
+	errs, ok := p.Validate(false).(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected ValidationErrors")
+	}
+	warnings := errs.Warnings()
+	if len(warnings) != 1 || warnings[0].Path != "properties.orchestratorProfile.kubernetesConfig.dockerEngineVersion" || warnings[0].Code != CodeDeprecatedField {
+		t.Errorf("expected a deprecation warning for dockerEngineVersion, got %v", warnings)
+	}
+}
+
+func TestValidationErrorsError(t *testing.T) {
+	errs := ValidationErrors{
+		{Path: "properties.masterProfile.count", Code: CodeInvalidField, Severity: SeverityError, Err: errors.New("first")},
+		{Path: "properties.orchestratorProfile", Code: CodeDeprecatedField, Severity: SeverityWarning, Err: errors.New("ignored")},
+	}
+	if errs.Error() != "first" {
+		t.Errorf("expected a single error to read as its message, got %q", errs.Error())
+	}
+
+	errs = append(errs, &ValidationError{Path: "properties.agentPoolProfiles[2].vmSize", Code: CodeMissingField, Severity: SeverityError, Err: errors.New("second")})
+	expected := "2 validation errors:\n" +
+		"  properties.masterProfile.count: first (InvalidField)\n" +
+		"  properties.agentPoolProfiles[2].vmSize: second (MissingField)"
+	if errs.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, errs.Error())
+	}
+}
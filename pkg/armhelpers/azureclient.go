@@ -60,15 +60,19 @@ type AzureClient struct {
 	resourcesClient                 apimanagement.GroupClient
 	storageAccountsClient           storage.AccountsClient
 	interfacesClient                network.InterfacesClient
+	subnetsClient                   network.SubnetsClient
 	groupsClient                    resources.GroupsClient
 	providersClient                 resources.ProvidersClient
 	virtualMachinesClient           compute.VirtualMachinesClient
 	virtualMachineScaleSetsClient   compute.VirtualMachineScaleSetsClient
 	virtualMachineScaleSetVMsClient compute.VirtualMachineScaleSetVMsClient
 	disksClient                     compute.DisksClient
+	usageClient                     compute.UsageClient
 
 	applicationsClient      graphrbac.ApplicationsClient
 	servicePrincipalsClient graphrbac.ServicePrincipalsClient
+
+	keyVaultClient autorest.Client
 }
 
 // NewAzureClientWithDeviceAuth returns an AzureClient by having a user complete a device authentication flow
@@ -107,8 +111,13 @@ func NewAzureClientWithDeviceAuth(env azure.Environment, subscriptionID string)
 				return nil, err
 			}
 			graphSpt.Refresh()
+			keyVaultSpt, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, acsEngineClientID, keyVaultResource(env), armSpt.Token())
+			if err != nil {
+				return nil, err
+			}
+			keyVaultSpt.Refresh()
 
-			return getClient(env, subscriptionID, tenantID, armSpt, graphSpt), nil
+			return getClient(env, subscriptionID, tenantID, armSpt, graphSpt, keyVaultSpt), nil
 		}
 	}
 
@@ -140,7 +149,15 @@ func NewAzureClientWithDeviceAuth(env azure.Environment, subscriptionID string)
 	}
 	graphSpt.Refresh()
 
-	return getClient(env, subscriptionID, tenantID, armSpt, graphSpt), nil
+	kvRawToken := armSpt.Token()
+	kvRawToken.Resource = keyVaultResource(env)
+	keyVaultSpt, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, acsEngineClientID, keyVaultResource(env), kvRawToken)
+	if err != nil {
+		return nil, err
+	}
+	keyVaultSpt.Refresh()
+
+	return getClient(env, subscriptionID, tenantID, armSpt, graphSpt, keyVaultSpt), nil
 }
 
 // NewAzureClientWithClientSecret returns an AzureClient via client_id and client_secret
@@ -159,8 +176,12 @@ func NewAzureClientWithClientSecret(env azure.Environment, subscriptionID, clien
 		return nil, err
 	}
 	graphSpt.Refresh()
+	keyVaultSpt, err := adal.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, keyVaultResource(env))
+	if err != nil {
+		return nil, err
+	}
 
-	return getClient(env, subscriptionID, tenantID, armSpt, graphSpt), nil
+	return getClient(env, subscriptionID, tenantID, armSpt, graphSpt, keyVaultSpt), nil
 }
 
 // NewAzureClientWithClientSecretExternalTenant returns an AzureClient via client_id and client_secret from a tenant
@@ -179,8 +200,12 @@ func NewAzureClientWithClientSecretExternalTenant(env azure.Environment, subscri
 		return nil, err
 	}
 	graphSpt.Refresh()
+	keyVaultSpt, err := adal.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, keyVaultResource(env))
+	if err != nil {
+		return nil, err
+	}
 
-	return getClient(env, subscriptionID, tenantID, armSpt, graphSpt), nil
+	return getClient(env, subscriptionID, tenantID, armSpt, graphSpt, keyVaultSpt), nil
 }
 
 // NewAzureClientWithClientCertificateFile returns an AzureClient via client_id and jwt certificate assertion
@@ -246,8 +271,12 @@ func newAzureClientWithCertificate(env azure.Environment, oauthConfig *adal.OAut
 		return nil, err
 	}
 	graphSpt.Refresh()
+	keyVaultSpt, err := adal.NewServicePrincipalTokenFromCertificate(*oauthConfig, clientID, certificate, privateKey, keyVaultResource(env))
+	if err != nil {
+		return nil, err
+	}
 
-	return getClient(env, subscriptionID, tenantID, armSpt, graphSpt), nil
+	return getClient(env, subscriptionID, tenantID, armSpt, graphSpt, keyVaultSpt), nil
 }
 
 func tokenCallback(path string) func(t adal.Token) error {
@@ -304,7 +333,7 @@ func getAcsEngineClientID(envName string) string {
 	}
 }
 
-func getClient(env azure.Environment, subscriptionID, tenantID string, armSpt *adal.ServicePrincipalToken, graphSpt *adal.ServicePrincipalToken) *AzureClient {
+func getClient(env azure.Environment, subscriptionID, tenantID string, armSpt, graphSpt, keyVaultSpt *adal.ServicePrincipalToken) *AzureClient {
 	c := &AzureClient{
 		environment:    env,
 		subscriptionID: subscriptionID,
@@ -316,15 +345,19 @@ func getClient(env azure.Environment, subscriptionID, tenantID string, armSpt *a
 		resourcesClient:                 apimanagement.NewGroupClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 		storageAccountsClient:           storage.NewAccountsClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 		interfacesClient:                network.NewInterfacesClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
+		subnetsClient:                   network.NewSubnetsClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 		groupsClient:                    resources.NewGroupsClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 		providersClient:                 resources.NewProvidersClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 		virtualMachinesClient:           compute.NewVirtualMachinesClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 		virtualMachineScaleSetsClient:   compute.NewVirtualMachineScaleSetsClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 		virtualMachineScaleSetVMsClient: compute.NewVirtualMachineScaleSetVMsClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 		disksClient:                     compute.NewDisksClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
+		usageClient:                     compute.NewUsageClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 
 		applicationsClient:      graphrbac.NewApplicationsClientWithBaseURI(env.GraphEndpoint, tenantID),
 		servicePrincipalsClient: graphrbac.NewServicePrincipalsClientWithBaseURI(env.GraphEndpoint, tenantID),
+
+		keyVaultClient: autorest.NewClientWithUserAgent("acs-engine"),
 	}
 
 	authorizer := autorest.NewBearerAuthorizer(armSpt)
@@ -335,12 +368,14 @@ func getClient(env azure.Environment, subscriptionID, tenantID string, armSpt *a
 	c.resourcesClient.Authorizer = authorizer
 	c.storageAccountsClient.Authorizer = authorizer
 	c.interfacesClient.Authorizer = authorizer
+	c.subnetsClient.Authorizer = authorizer
 	c.groupsClient.Authorizer = authorizer
 	c.providersClient.Authorizer = authorizer
 	c.virtualMachinesClient.Authorizer = authorizer
 	c.virtualMachineScaleSetsClient.Authorizer = authorizer
 	c.virtualMachineScaleSetVMsClient.Authorizer = authorizer
 	c.disksClient.Authorizer = authorizer
+	c.usageClient.Authorizer = authorizer
 
 	c.deploymentsClient.PollingDelay = time.Second * 5
 	c.resourcesClient.PollingDelay = time.Second * 5
@@ -364,6 +399,9 @@ func getClient(env azure.Environment, subscriptionID, tenantID string, armSpt *a
 	c.applicationsClient.Authorizer = graphAuthorizer
 	c.servicePrincipalsClient.Authorizer = graphAuthorizer
 
+	// the Key Vault data plane is authorized by its own AAD resource
+	c.keyVaultClient.Authorizer = autorest.NewBearerAuthorizer(keyVaultSpt)
+
 	return c
 }
 
@@ -9,6 +9,20 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
 )
 
+// ListUsages returns the compute usages and limits of the subscription in the specified location.
+func (az *AzureClient) ListUsages(ctx context.Context, location string) ([]compute.Usage, error) {
+	usages := []compute.Usage{}
+	page, err := az.usageClient.List(ctx, location)
+	for err == nil && page.NotDone() {
+		usages = append(usages, page.Values()...)
+		err = page.Next()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return usages, nil
+}
+
 // ListVirtualMachines returns (the first page of) the machines in the specified resource group.
 func (az *AzureClient) ListVirtualMachines(ctx context.Context, resourceGroup string) (VirtualMachineListResultPage, error) {
 	page, err := az.virtualMachinesClient.List(ctx, resourceGroup)
@@ -36,13 +50,15 @@ func (az *AzureClient) DeleteVirtualMachine(ctx context.Context, resourceGroup,
 }
 
 // ListVirtualMachineScaleSets returns (the first page of) the vmss resources in the specified resource group.
-func (az *AzureClient) ListVirtualMachineScaleSets(ctx context.Context, resourceGroup string) (compute.VirtualMachineScaleSetListResultPage, error) {
-	return az.virtualMachineScaleSetsClient.List(ctx, resourceGroup)
+func (az *AzureClient) ListVirtualMachineScaleSets(ctx context.Context, resourceGroup string) (VirtualMachineScaleSetListResultPage, error) {
+	page, err := az.virtualMachineScaleSetsClient.List(ctx, resourceGroup)
+	return &page, err
 }
 
 // ListVirtualMachineScaleSetVMs returns the list of VMs per VMSS
-func (az *AzureClient) ListVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string) (compute.VirtualMachineScaleSetVMListResultPage, error) {
-	return az.virtualMachineScaleSetVMsClient.List(ctx, resourceGroup, virtualMachineScaleSet, "", "", "")
+func (az *AzureClient) ListVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string) (VirtualMachineScaleSetVMListResultPage, error) {
+	page, err := az.virtualMachineScaleSetVMsClient.List(ctx, resourceGroup, virtualMachineScaleSet, "", "", "")
+	return &page, err
 }
 
 // DeleteVirtualMachineScaleSetVM deletes a VM in a VMSS
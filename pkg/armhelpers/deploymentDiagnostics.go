@@ -0,0 +1,335 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package armhelpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// DeploymentFailureCategory classifies why a deployment operation failed
+type DeploymentFailureCategory string
+
+const (
+	// FailureQuotaExceeded means the deployment needs more of a resource than the subscription quota allows
+	FailureQuotaExceeded DeploymentFailureCategory = "QuotaExceeded"
+	// FailureSkuNotAvailable means a VM size is not offered to the subscription in the location or zone
+	FailureSkuNotAvailable DeploymentFailureCategory = "SkuNotAvailable"
+	// FailureCustomScriptExtension means the provisioning script run by the custom script extension failed
+	FailureCustomScriptExtension DeploymentFailureCategory = "CustomScriptExtension"
+	// FailureConflict means a resource was in a state that did not allow the operation
+	FailureConflict DeploymentFailureCategory = "Conflict"
+	// FailureThrottling means ARM or a resource provider throttled the requests of the subscription
+	FailureThrottling DeploymentFailureCategory = "Throttling"
+	// FailureUnknown is any other failure
+	FailureUnknown DeploymentFailureCategory = "Unknown"
+)
+
+var failureCauses = map[DeploymentFailureCategory]string{
+	FailureQuotaExceeded:   "the subscription quota is too low for the cluster, request a quota increase or deploy fewer or smaller VMs",
+	FailureSkuNotAvailable: "the VM size is not available to the subscription in this location or zone, pick another size or location",
+	FailureConflict:        "a resource was being modified by another operation, or a property that cannot change was changed",
+	FailureThrottling:      "too many requests were sent for the subscription, wait a few minutes before retrying",
+}
+
+// CSEExitCode describes an exit code of the provisioning script run by the custom script extension
+type CSEExitCode struct {
+	Name        string
+	Description string
+}
+
+// CSEExitCodes maps the exit codes of the provisioning scripts (parts/k8s/kubernetesprovisionsource.sh
+// and parts/k8s/kubernetescustomscript.sh) to their meaning
+var CSEExitCodes = map[int]CSEExitCode{
+	4:   {"ERR_SYSTEMCTL_START_FAIL", "Service could not be started or enabled by systemctl"},
+	5:   {"ERR_CLOUD_INIT_TIMEOUT", "Timeout waiting for cloud-init runcmd to complete"},
+	6:   {"ERR_FILE_WATCH_TIMEOUT", "Timeout waiting for a file"},
+	7:   {"ERR_HOLD_WALINUXAGENT", "Unable to place walinuxagent apt package on hold during install"},
+	8:   {"ERR_RELEASE_HOLD_WALINUXAGENT", "Unable to release hold on walinuxagent apt package after install"},
+	9:   {"ERR_APT_INSTALL_TIMEOUT", "Timeout installing required apt packages"},
+	10:  {"ERR_ETCD_DATA_DIR_NOT_FOUND", "Etcd data dir not found"},
+	11:  {"ERR_ETCD_RUNNING_TIMEOUT", "Timeout waiting for etcd to be accessible"},
+	12:  {"ERR_ETCD_DOWNLOAD_TIMEOUT", "Timeout waiting for etcd to download"},
+	13:  {"ERR_ETCD_VOL_MOUNT_FAIL", "Unable to mount etcd disk volume"},
+	14:  {"ERR_ETCD_START_TIMEOUT", "Unable to start etcd runtime"},
+	15:  {"ERR_ETCD_CONFIG_FAIL", "Unable to configure etcd cluster"},
+	20:  {"ERR_DOCKER_INSTALL_TIMEOUT", "Timeout waiting for docker install"},
+	21:  {"ERR_DOCKER_DOWNLOAD_TIMEOUT", "Timeout waiting for docker download(s)"},
+	22:  {"ERR_DOCKER_KEY_DOWNLOAD_TIMEOUT", "Timeout waiting to download docker repo key"},
+	23:  {"ERR_DOCKER_APT_KEY_TIMEOUT", "Timeout waiting for docker apt-key"},
+	24:  {"ERR_DOCKER_START_FAIL", "Docker could not be started by systemctl"},
+	25:  {"ERR_MOBY_APT_LIST_TIMEOUT", "Timeout waiting for moby apt sources"},
+	26:  {"ERR_MS_GPG_KEY_DOWNLOAD_TIMEOUT", "Timeout waiting for MS GPG key download"},
+	27:  {"ERR_MOBY_INSTALL_TIMEOUT", "Timeout waiting for moby install"},
+	30:  {"ERR_K8S_RUNNING_TIMEOUT", "Timeout waiting for k8s cluster to be healthy"},
+	31:  {"ERR_K8S_DOWNLOAD_TIMEOUT", "Timeout waiting for Kubernetes download(s)"},
+	32:  {"ERR_KUBECTL_NOT_FOUND", "kubectl client binary not found on local disk"},
+	33:  {"ERR_IMG_DOWNLOAD_TIMEOUT", "Timeout waiting for img download"},
+	34:  {"ERR_KUBELET_START_FAIL", "kubelet could not be started by systemctl"},
+	35:  {"ERR_CONTAINER_IMG_PULL_TIMEOUT", "Timeout trying to pull a container image"},
+	41:  {"ERR_CNI_DOWNLOAD_TIMEOUT", "Timeout waiting for CNI download(s)"},
+	42:  {"ERR_MS_PROD_DEB_DOWNLOAD_TIMEOUT", "Timeout waiting for https://packages.microsoft.com/config/ubuntu/16.04/packages-microsoft-prod.deb"},
+	43:  {"ERR_MS_PROD_DEB_PKG_ADD_FAIL", "Failed to add repo pkg file"},
+	49:  {"ERR_MODPROBE_FAIL", "Unable to load a kernel module using modprobe"},
+	50:  {"ERR_OUTBOUND_CONN_FAIL", "Unable to establish outbound connection"},
+	60:  {"ERR_KATA_KEY_DOWNLOAD_TIMEOUT", "Timeout waiting to download kata repo key"},
+	61:  {"ERR_KATA_APT_KEY_TIMEOUT", "Timeout waiting for kata apt-key"},
+	62:  {"ERR_KATA_INSTALL_TIMEOUT", "Timeout waiting for kata install"},
+	70:  {"ERR_CONTAINERD_DOWNLOAD_TIMEOUT", "Timeout waiting for containerd download(s)"},
+	80:  {"ERR_CUSTOM_SEARCH_DOMAINS_FAIL", "Unable to configure custom search domains"},
+	84:  {"ERR_GPU_DRIVERS_START_FAIL", "nvidia-modprobe could not be started by systemctl"},
+	85:  {"ERR_GPU_DRIVERS_INSTALL_TIMEOUT", "Timeout waiting for GPU drivers install"},
+	98:  {"ERR_APT_DAILY_TIMEOUT", "Timeout waiting for apt daily updates"},
+	99:  {"ERR_APT_UPDATE_TIMEOUT", "Timeout waiting for apt-get update to complete"},
+	100: {"ERR_CSE_PROVISION_SCRIPT_NOT_READY_TIMEOUT", "Timeout waiting for cloud-init to place the provisioning script on the vm"},
+}
+
+// DeploymentFailure is a typed failure of a deployment operation, or of the deployment itself
+// when ARM rejected it before any operation ran
+type DeploymentFailure struct {
+	Category     DeploymentFailureCategory `json:"category"`
+	Code         string                    `json:"code,omitempty"`
+	Message      string                    `json:"message,omitempty"`
+	ResourceType string                    `json:"resourceType,omitempty"`
+	ResourceName string                    `json:"resourceName,omitempty"`
+	// ExitCode and ExitCodeName are set when the custom script extension reported the exit status of the provisioning script
+	ExitCode     int    `json:"exitCode,omitempty"`
+	ExitCodeName string `json:"exitCodeName,omitempty"`
+	// Cause is a human readable explanation of the failure
+	Cause string `json:"cause,omitempty"`
+}
+
+// DeploymentDiagnostics are the failures of a deployment
+type DeploymentDiagnostics struct {
+	DeploymentName    string              `json:"deploymentName"`
+	ResourceGroup     string              `json:"resourceGroup"`
+	ProvisioningState string              `json:"provisioningState,omitempty"`
+	Failures          []DeploymentFailure `json:"failures"`
+}
+
+// armError is the error document returned by ARM, either as a response body or as the status message of an operation
+type armError struct {
+	Code    string     `json:"code"`
+	Message string     `json:"message"`
+	Details []armError `json:"details"`
+}
+
+var cseExitStatusRegexp = regexp.MustCompile(`exit status=(\d+)`)
+
+// Diagnostics parses the deployment operations into typed failures. When no operation failed, the
+// response of ARM, or the error returned by the SDK, is used instead.
+func (e *DeploymentError) Diagnostics() *DeploymentDiagnostics {
+	d := &DeploymentDiagnostics{
+		DeploymentName:    e.DeploymentName,
+		ResourceGroup:     e.ResourceGroup,
+		ProvisioningState: e.ProvisioningState,
+		Failures:          []DeploymentFailure{},
+	}
+
+	for _, operationsList := range e.OperationsLists {
+		if operationsList.Value == nil {
+			continue
+		}
+		for _, operation := range *operationsList.Value {
+			if operation.Properties == nil || to.String(operation.Properties.ProvisioningState) != string(api.Failed) {
+				continue
+			}
+			d.Failures = append(d.Failures, operationFailure(operation.Properties))
+		}
+	}
+
+	if len(d.Failures) == 0 {
+		if err := parseARMError(e.Response); err != nil {
+			d.Failures = append(d.Failures, classifyARMError(err, ""))
+		} else if e.TopError != nil {
+			d.Failures = append(d.Failures, DeploymentFailure{Category: FailureUnknown, Message: e.TopError.Error()})
+		}
+	}
+
+	return d
+}
+
+// String renders the diagnostics as text for humans
+func (d *DeploymentDiagnostics) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "deployment %s in resource group %s failed", d.DeploymentName, d.ResourceGroup)
+	if d.ProvisioningState != "" {
+		fmt.Fprintf(&b, " (%s)", d.ProvisioningState)
+	}
+	fmt.Fprintf(&b, " with %d errors\n", len(d.Failures))
+	for _, f := range d.Failures {
+		fmt.Fprintf(&b, "- %s", f.Category)
+		if f.ResourceType != "" || f.ResourceName != "" {
+			fmt.Fprintf(&b, " on %s %s", f.ResourceType, f.ResourceName)
+		}
+		b.WriteString("\n")
+		switch {
+		case f.ExitCodeName != "":
+			fmt.Fprintf(&b, "  exit code %d (%s): %s\n", f.ExitCode, f.ExitCodeName, f.Cause)
+		case f.ExitCode != 0:
+			fmt.Fprintf(&b, "  exit code %d\n", f.ExitCode)
+		case f.Cause != "":
+			fmt.Fprintf(&b, "  %s\n", f.Cause)
+		}
+		// extension messages carry the whole output of the script, only its first line is useful here
+		message := strings.SplitN(strings.TrimSpace(f.Message), "\n", 2)[0]
+		if f.Code != "" {
+			message = f.Code + ": " + message
+		}
+		if message != "" {
+			fmt.Fprintf(&b, "  %s\n", message)
+		}
+	}
+	return b.String()
+}
+
+// JSON renders the diagnostics as an indented JSON document
+func (d *DeploymentDiagnostics) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// operationFailure classifies a failed deployment operation
+func operationFailure(properties *resources.DeploymentOperationProperties) DeploymentFailure {
+	var f DeploymentFailure
+	if err := parseARMError(properties.StatusMessage); err != nil {
+		f = classifyARMError(err, to.String(properties.StatusCode))
+	} else {
+		f = classifyARMError(&armError{Code: to.String(properties.StatusCode)}, to.String(properties.StatusCode))
+	}
+	if properties.TargetResource != nil {
+		f.ResourceType = to.String(properties.TargetResource.ResourceType)
+		f.ResourceName = to.String(properties.TargetResource.ResourceName)
+	}
+	return f
+}
+
+// parseARMError returns the ARM error held by a status message or a response body, which is either
+// a raw JSON document or an already decoded one. It returns nil if there is none.
+func parseARMError(v interface{}) *armError {
+	var b []byte
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		b = t
+	case string:
+		b = []byte(t)
+	default:
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			return nil
+		}
+	}
+
+	var doc struct {
+		armError
+		Error *armError `json:"error"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil
+	}
+	if doc.Error != nil {
+		return doc.Error.expand()
+	}
+	if doc.Code != "" || doc.Message != "" {
+		return doc.armError.expand()
+	}
+	return nil
+}
+
+// expand parses the ARM errors that resource providers embed as JSON in the message of a detail
+func (e *armError) expand() *armError {
+	for i := range e.Details {
+		e.Details[i].expand()
+	}
+	if len(e.Details) == 0 && strings.HasPrefix(strings.TrimSpace(e.Message), "{") {
+		if nested := parseARMError(e.Message); nested != nil {
+			e.Details = []armError{*nested}
+		}
+	}
+	return e
+}
+
+// category returns the category of this error alone, without looking at its details
+func (e *armError) category() DeploymentFailureCategory {
+	message := strings.ToLower(e.Message)
+	switch {
+	case strings.Contains(e.Code, "QuotaExceeded") || strings.Contains(message, "exceeding quota limits"):
+		return FailureQuotaExceeded
+	case e.Code == "SkuNotAvailable":
+		return FailureSkuNotAvailable
+	case strings.HasPrefix(e.Code, "VMExtension") || cseExitStatusRegexp.MatchString(e.Message):
+		return FailureCustomScriptExtension
+	case e.Code == "TooManyRequests" || strings.HasSuffix(e.Code, "Throttled"):
+		return FailureThrottling
+	case e.Code == "Conflict":
+		return FailureConflict
+	}
+	return FailureUnknown
+}
+
+// find returns the first error of the tree, depth first, that has a known category
+func (e *armError) find() (*armError, DeploymentFailureCategory) {
+	if category := e.category(); category != FailureUnknown {
+		return e, category
+	}
+	for i := range e.Details {
+		if found, category := e.Details[i].find(); found != nil {
+			return found, category
+		}
+	}
+	return nil, FailureUnknown
+}
+
+// leaf returns the innermost error of the tree, which is the most specific one
+func (e *armError) leaf() *armError {
+	if len(e.Details) == 0 {
+		return e
+	}
+	return e.Details[0].leaf()
+}
+
+// classifyARMError turns an ARM error into a typed failure
+func classifyARMError(err *armError, statusCode string) DeploymentFailure {
+	found, category := err.find()
+	if found == nil {
+		// the status code of an operation is only a hint: extensions that fail report Conflict for instance
+		found = err
+		switch statusCode {
+		case "TooManyRequests":
+			category = FailureThrottling
+		case "Conflict":
+			category = FailureConflict
+		}
+	}
+	leaf := found.leaf()
+	f := DeploymentFailure{
+		Category: category,
+		Code:     leaf.Code,
+		Message:  leaf.Message,
+		Cause:    failureCauses[category],
+	}
+	if category == FailureCustomScriptExtension {
+		m := cseExitStatusRegexp.FindStringSubmatch(found.Message)
+		if m == nil {
+			m = cseExitStatusRegexp.FindStringSubmatch(leaf.Message)
+		}
+		if m != nil {
+			f.ExitCode, _ = strconv.Atoi(m[1])
+			if exitCode, ok := CSEExitCodes[f.ExitCode]; ok {
+				f.ExitCodeName = exitCode.Name
+				f.Cause = exitCode.Description
+			}
+		}
+	}
+	return f
+}
@@ -0,0 +1,159 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package armhelpers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/pkg/errors"
+)
+
+func failedOperation(resourceType, resourceName, statusCode, statusMessage string) resources.DeploymentOperation {
+	var message interface{}
+	if err := json.Unmarshal([]byte(statusMessage), &message); err != nil {
+		panic(err)
+	}
+	return resources.DeploymentOperation{
+		Properties: &resources.DeploymentOperationProperties{
+			ProvisioningState: to.StringPtr("Failed"),
+			StatusCode:        to.StringPtr(statusCode),
+			StatusMessage:     message,
+			TargetResource: &resources.TargetResource{
+				ResourceType: to.StringPtr(resourceType),
+				ResourceName: to.StringPtr(resourceName),
+			},
+		},
+	}
+}
+
+func TestDeploymentErrorDiagnostics(t *testing.T) {
+	operations := []resources.DeploymentOperation{
+		failedOperation("Microsoft.Compute/virtualMachines/extensions", "k8s-master-12345678-0/cse-master-0", "Conflict",
+			`{"status":"Failed","error":{"code":"ResourceDeploymentFailure","message":"The resource operation completed with terminal provisioning state 'Failed'.","details":[{"code":"VMExtensionProvisioningError","message":"VM has reported a failure when processing extension 'cse-master-0'. Error message: \"Enable failed: failed to execute command: command terminated with exit status=30\n[stdout]\n\n[stderr]\n\"."}]}}`),
+		failedOperation("Microsoft.Compute/virtualMachines", "k8s-agentpool1-12345678-0", "BadRequest",
+			`{"error":{"code":"SkuNotAvailable","message":"The requested size for resource 'k8s-agentpool1-12345678-0' is currently not available in location 'westus2' zones '3' for subscription '11111111-2222-3333-4444-555555555555'."}}`),
+		failedOperation("Microsoft.Network/loadBalancers", "k8s-master-lb", "TooManyRequests",
+			`{"error":{"code":"RetryableError","message":"A retryable error occurred."}}`),
+		failedOperation("Microsoft.Compute/virtualMachines/extensions", "k8s-agentpool1-12345678-1/cse-agent-1", "Conflict",
+			`{"status":"Failed","error":{"code":"VMExtensionProvisioningError","message":"Enable failed: command terminated with exit status=3"}}`),
+		{Properties: &resources.DeploymentOperationProperties{ProvisioningState: to.StringPtr("Succeeded")}},
+	}
+	deploymentErr := &DeploymentError{
+		DeploymentName:    "agentvm",
+		ResourceGroup:     "rg1",
+		ProvisioningState: "Failed",
+		OperationsLists:   []resources.DeploymentOperationsListResult{{Value: &operations}},
+	}
+
+	d := deploymentErr.Diagnostics()
+	if len(d.Failures) != 4 {
+		t.Fatalf("expected 4 failures, got %d", len(d.Failures))
+	}
+
+	cse := d.Failures[0]
+	if cse.Category != FailureCustomScriptExtension || cse.ExitCode != 30 || cse.ExitCodeName != "ERR_K8S_RUNNING_TIMEOUT" || cse.Code != "VMExtensionProvisioningError" {
+		t.Fatalf("unexpected custom script extension failure: %+v", cse)
+	}
+	if cse.Cause != "Timeout waiting for k8s cluster to be healthy" || cse.ResourceName != "k8s-master-12345678-0/cse-master-0" {
+		t.Fatalf("unexpected custom script extension failure: %+v", cse)
+	}
+	if d.Failures[1].Category != FailureSkuNotAvailable || d.Failures[1].Code != "SkuNotAvailable" {
+		t.Fatalf("unexpected SKU failure: %+v", d.Failures[1])
+	}
+	if d.Failures[2].Category != FailureThrottling {
+		t.Fatalf("expected the status code to classify the failure as throttling, got %+v", d.Failures[2])
+	}
+	if d.Failures[3].ExitCode != 3 || d.Failures[3].ExitCodeName != "" {
+		t.Fatalf("expected an exit code unknown to the provisioning scripts to be reported as is, got %+v", d.Failures[3])
+	}
+
+	text := d.String()
+	for _, expected := range []string{
+		"deployment agentvm in resource group rg1 failed (Failed) with 4 errors\n",
+		"- CustomScriptExtension on Microsoft.Compute/virtualMachines/extensions k8s-master-12345678-0/cse-master-0\n" +
+			"  exit code 30 (ERR_K8S_RUNNING_TIMEOUT): Timeout waiting for k8s cluster to be healthy\n" +
+			"  VMExtensionProvisioningError: VM has reported a failure when processing extension 'cse-master-0'. Error message: \"Enable failed: failed to execute command: command terminated with exit status=30\n- SkuNotAvailable",
+		"  exit code 3\n",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Fatalf("expected the text diagnostics to contain %q, got:\n%s", expected, text)
+		}
+	}
+
+	b, err := d.JSON()
+	if err != nil {
+		t.Fatalf("unexpected error rendering the diagnostics as JSON: %s", err)
+	}
+	var decoded DeploymentDiagnostics
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("unexpected error decoding the JSON diagnostics: %s", err)
+	}
+	if decoded.Failures[0] != cse {
+		t.Fatalf("expected the JSON diagnostics to round trip, got %+v", decoded.Failures[0])
+	}
+}
+
+func TestDeploymentErrorDiagnosticsFromResponse(t *testing.T) {
+	cases := []struct {
+		response []byte
+		topError error
+		category DeploymentFailureCategory
+		code     string
+	}{
+		{
+			response: []byte(`{"error":{"code":"InvalidTemplateDeployment","message":"The template deployment is not valid.","details":[{"code":"QuotaExceeded","message":"Operation results in exceeding quota limits of Core. Maximum allowed: 10, Current in use: 10, Additional requested: 2."}]}}`),
+			category: FailureQuotaExceeded,
+			code:     "QuotaExceeded",
+		},
+		{
+			// resource providers embed their own error document in the message of the detail
+			response: []byte(`{"status":"Failed","error":{"code":"DeploymentFailed","message":"At least one resource deployment operation failed.","details":[{"code":"Conflict","message":"{\r\n  \"error\": {\r\n    \"code\": \"PropertyChangeNotAllowed\",\r\n    \"target\": \"dataDisk.createOption\",\r\n    \"message\": \"Changing property 'dataDisk.createOption' is not allowed.\"\r\n  }\r\n}"}]}}`),
+			category: FailureConflict,
+			code:     "PropertyChangeNotAllowed",
+		},
+		{
+			response: []byte(`{"error":{"code":"InvalidTemplate","message":"Deployment template validation failed."}}`),
+			category: FailureUnknown,
+			code:     "InvalidTemplate",
+		},
+		{
+			topError: errors.New("DeployTemplate failed"),
+			category: FailureUnknown,
+		},
+	}
+
+	for _, c := range cases {
+		deploymentErr := &DeploymentError{Response: c.response, TopError: c.topError}
+		failures := deploymentErr.Diagnostics().Failures
+		if len(failures) != 1 {
+			t.Fatalf("expected 1 failure from %s, got %d", c.response, len(failures))
+		}
+		if failures[0].Category != c.category || failures[0].Code != c.code {
+			t.Fatalf("expected a %s failure with code %s, got %+v", c.category, c.code, failures[0])
+		}
+	}
+}
+
+func TestCSEExitCodesMatchProvisioningScripts(t *testing.T) {
+	errRegexp := regexp.MustCompile(`(?m)^(ERR_[A-Z0-9_]+)=(\d+)`)
+	for _, script := range []string{"../../parts/k8s/kubernetesprovisionsource.sh", "../../parts/k8s/kubernetescustomscript.sh"} {
+		b, err := ioutil.ReadFile(script)
+		if err != nil {
+			t.Fatalf("unable to read %s: %s", script, err)
+		}
+		for _, m := range errRegexp.FindAllStringSubmatch(string(b), -1) {
+			code, _ := strconv.Atoi(m[2])
+			if CSEExitCodes[code].Name != m[1] {
+				t.Errorf("%s defines %s=%d, but CSEExitCodes maps %d to %q", script, m[1], code, code, CSEExitCodes[code].Name)
+			}
+		}
+	}
+}
@@ -63,6 +63,11 @@ func (e *DeploymentValidationError) Error() string {
 func DeployTemplateSync(az ACSEngineClient, logger *logrus.Entry, resourceGroupName, deploymentName string, template map[string]interface{}, parameters map[string]interface{}) error {
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultARMOperationTimeout)
 	defer cancel()
+	return DeployTemplateSyncContext(ctx, az, logger, resourceGroupName, deploymentName, template, parameters)
+}
+
+// DeployTemplateSyncContext deploys the template until ctx is done and returns ArmError
+func DeployTemplateSyncContext(ctx context.Context, az ACSEngineClient, logger *logrus.Entry, resourceGroupName, deploymentName string, template map[string]interface{}, parameters map[string]interface{}) error {
 	deploymentExtended, err := az.DeployTemplate(ctx, resourceGroupName, deploymentName, template, parameters)
 	if err == nil {
 		return nil
@@ -14,6 +14,7 @@ import (
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/date"
 	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/pkg/errors"
 	"github.com/satori/go.uuid"
 	log "github.com/sirupsen/logrus"
 )
@@ -58,6 +59,20 @@ func (az *AzureClient) ListRoleAssignmentsForPrincipal(ctx context.Context, scop
 	return &page, err
 }
 
+// GetServicePrincipalObjectID returns the object ID of the service principal of the application with the given client ID
+func (az *AzureClient) GetServicePrincipalObjectID(ctx context.Context, clientID string) (string, error) {
+	page, err := az.servicePrincipalsClient.List(ctx, fmt.Sprintf("appId eq '%s'", clientID))
+	if err != nil {
+		return "", err
+	}
+	for _, sp := range page.Values() {
+		if sp.ObjectID != nil {
+			return *sp.ObjectID, nil
+		}
+	}
+	return "", errors.Errorf("no service principal found for application %s", clientID)
+}
+
 // CreateApp is a simpler method for creating an application
 func (az *AzureClient) CreateApp(ctx context.Context, appName, appURL string, replyURLs *[]string, requiredResourceAccess *[]graphrbac.RequiredResourceAccess) (applicationResp graphrbac.Application, servicePrincipalObjectID, servicePrincipalClientSecret string, err error) {
 	notBefore := time.Now()
@@ -10,12 +10,15 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/authorization/mgmt/2015-07-01/authorization"
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/graphrbac/1.6/graphrbac"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2018-08-01/network"
 	"github.com/Azure/azure-sdk-for-go/services/preview/msi/mgmt/2015-08-31-preview/msi"
 	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
 	azStorage "github.com/Azure/azure-sdk-for-go/storage"
 	"github.com/Azure/go-autorest/autorest"
 	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // VirtualMachineListResultPage is an interface for compute.VirtualMachineListResultPage to aid in mocking
@@ -42,6 +45,30 @@ type RoleAssignmentListResultPage interface {
 	Values() []authorization.RoleAssignment
 }
 
+// ProviderListResultPage is an interface for resources.ProviderListResultPage to aid in mocking
+type ProviderListResultPage interface {
+	Next() error
+	NotDone() bool
+	Response() resources.ProviderListResult
+	Values() []resources.Provider
+}
+
+// VirtualMachineScaleSetListResultPage is an interface for compute.VirtualMachineScaleSetListResultPage to aid in mocking
+type VirtualMachineScaleSetListResultPage interface {
+	Next() error
+	NotDone() bool
+	Response() compute.VirtualMachineScaleSetListResult
+	Values() []compute.VirtualMachineScaleSet
+}
+
+// VirtualMachineScaleSetVMListResultPage is an interface for compute.VirtualMachineScaleSetVMListResultPage to aid in mocking
+type VirtualMachineScaleSetVMListResultPage interface {
+	Next() error
+	NotDone() bool
+	Response() compute.VirtualMachineScaleSetVMListResult
+	Values() []compute.VirtualMachineScaleSetVM
+}
+
 // ACSEngineClient is the interface used to talk to an Azure environment.
 // This interface exposes just the subset of Azure APIs and clients needed for
 // ACS-Engine.
@@ -74,10 +101,10 @@ type ACSEngineClient interface {
 	DeleteVirtualMachine(ctx context.Context, resourceGroup, name string) error
 
 	// ListVirtualMachineScaleSets lists the vmss resources in the resource group
-	ListVirtualMachineScaleSets(ctx context.Context, resourceGroup string) (compute.VirtualMachineScaleSetListResultPage, error)
+	ListVirtualMachineScaleSets(ctx context.Context, resourceGroup string) (VirtualMachineScaleSetListResultPage, error)
 
 	// ListVirtualMachineScaleSetVMs lists the virtual machines contained in a vmss
-	ListVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string) (compute.VirtualMachineScaleSetVMListResultPage, error)
+	ListVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string) (VirtualMachineScaleSetVMListResultPage, error)
 
 	// DeleteVirtualMachineScaleSetVM deletes a VM in a VMSS
 	DeleteVirtualMachineScaleSetVM(ctx context.Context, resourceGroup, virtualMachineScaleSet, instanceID string) error
@@ -85,6 +112,12 @@ type ACSEngineClient interface {
 	// SetVirtualMachineScaleSetCapacity sets the VMSS capacity
 	SetVirtualMachineScaleSetCapacity(ctx context.Context, resourceGroup, virtualMachineScaleSet string, sku compute.Sku, location string) error
 
+	// ListUsages returns the compute usages and limits of the subscription in a location
+	ListUsages(ctx context.Context, location string) ([]compute.Usage, error)
+
+	// ListResourceSkus returns the compute SKUs of the subscription offered in a location
+	ListResourceSkus(ctx context.Context, location string) ([]ResourceSku, error)
+
 	//
 	// STORAGE
 
@@ -98,6 +131,18 @@ type ACSEngineClient interface {
 	// DeleteNetworkInterface deletes the specified network interface.
 	DeleteNetworkInterface(ctx context.Context, resourceGroup, nicName string) error
 
+	// GetSubnet returns the specified subnet of a virtual network.
+	GetSubnet(ctx context.Context, resourceGroup, virtualNetworkName, subnetName string) (network.Subnet, error)
+
+	//
+	// KEY VAULT
+
+	// SetKeyVaultSecret stores value as a new version of a Key Vault secret and returns the version
+	SetKeyVaultSecret(ctx context.Context, vaultID, secretName, value string) (string, error)
+
+	// GetKeyVaultSecret returns the value of a version of a Key Vault secret, the latest one when version is empty
+	GetKeyVaultSecret(ctx context.Context, vaultID, secretName, version string) (string, error)
+
 	//
 	// GRAPH
 
@@ -106,6 +151,9 @@ type ACSEngineClient interface {
 
 	// CreateGraphPrincipal creates a service principal via the graphrbac client
 	CreateGraphPrincipal(ctx context.Context, servicePrincipalCreateParameters graphrbac.ServicePrincipalCreateParameters) (graphrbac.ServicePrincipal, error)
+
+	// GetServicePrincipalObjectID returns the object ID of the service principal of an application
+	GetServicePrincipalObjectID(ctx context.Context, clientID string) (string, error)
 	CreateApp(ctx context.Context, applicationName, applicationURL string, replyURLs *[]string, requiredResourceAccess *[]graphrbac.RequiredResourceAccess) (result graphrbac.Application, servicePrincipalObjectID, secret string, err error)
 	DeleteApp(ctx context.Context, applicationName, applicationObjectID string) (autorest.Response, error)
 
@@ -125,7 +173,7 @@ type ACSEngineClient interface {
 
 	GetKubernetesClient(masterURL, kubeConfig string, interval, timeout time.Duration) (KubernetesClient, error)
 
-	ListProviders(ctx context.Context) (resources.ProviderListResultPage, error)
+	ListProviders(ctx context.Context) (ProviderListResultPage, error)
 
 	// DEPLOYMENTS
 
@@ -161,4 +209,12 @@ type KubernetesClient interface {
 	EvictPod(pod *v1.Pod, policyGroupVersion string) error
 	//WaitForDelete waits until all pods are deleted. Returns all pods not deleted and an error on failure
 	WaitForDelete(logger *log.Entry, pods []v1.Pod, usingEviction bool) ([]v1.Pod, error)
+	//ListPodDisruptionBudgets returns the PodDisruptionBudgets of all namespaces
+	ListPodDisruptionBudgets() (*policy.PodDisruptionBudgetList, error)
+	//GetObject returns the object of the api server with the kind, namespace and name of obj, nil when it does not exist
+	GetObject(obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	//ApplyObject creates obj in the api server, or merges it into the existing object
+	ApplyObject(obj *unstructured.Unstructured) error
+	//DeleteObject deletes the object of the api server with the kind, namespace and name of obj, if it exists
+	DeleteObject(obj *unstructured.Unstructured) error
 }
@@ -0,0 +1,116 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package armhelpers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/pkg/errors"
+)
+
+// keyVaultAPIVersion is the Key Vault data plane API version, which the vendored SDK does not cover
+const keyVaultAPIVersion = "7.0"
+
+type keyVaultSecret struct {
+	Value string `json:"value"`
+	ID    string `json:"id,omitempty"`
+}
+
+// keyVaultResource returns the AAD resource of the Key Vault data plane, which rejects the trailing slash of the endpoint
+func keyVaultResource(env azure.Environment) string {
+	return strings.TrimSuffix(env.KeyVaultEndpoint, "/")
+}
+
+// keyVaultBaseURI returns the data plane URI of the Key Vault with the resource ID vaultID
+func (az *AzureClient) keyVaultBaseURI(vaultID string) (string, error) {
+	i := strings.LastIndex(vaultID, "/")
+	name := vaultID[i+1:]
+	if name == "" || !strings.HasSuffix(strings.ToLower(vaultID[:i+1]), "/providers/microsoft.keyvault/vaults/") {
+		return "", errors.Errorf("'%s' is not a Key Vault resource ID", vaultID)
+	}
+	return "https://" + name + "." + az.environment.KeyVaultDNSSuffix, nil
+}
+
+// SetKeyVaultSecret stores value as a new version of the secret secretName in the Key Vault vaultID and returns the version
+func (az *AzureClient) SetKeyVaultSecret(ctx context.Context, vaultID, secretName, value string) (string, error) {
+	baseURI, err := az.keyVaultBaseURI(vaultID)
+	if err != nil {
+		return "", err
+	}
+	pathParameters := map[string]interface{}{
+		"secretName": autorest.Encode("path", secretName),
+	}
+	queryParameters := map[string]interface{}{
+		"api-version": keyVaultAPIVersion,
+	}
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx),
+		autorest.AsContentType("application/json; charset=utf-8"),
+		autorest.AsPut(),
+		autorest.WithBaseURL(baseURI),
+		autorest.WithPathParameters("/secrets/{secretName}", pathParameters),
+		autorest.WithJSON(keyVaultSecret{Value: value}),
+		autorest.WithQueryParameters(queryParameters))
+	if err != nil {
+		return "", autorest.NewErrorWithError(err, "armhelpers.AzureClient", "SetKeyVaultSecret", nil, "Failure preparing request")
+	}
+
+	secret, err := az.sendKeyVaultRequest(req, "SetKeyVaultSecret")
+	if err != nil {
+		return "", err
+	}
+	return secret.ID[strings.LastIndex(secret.ID, "/")+1:], nil
+}
+
+// GetKeyVaultSecret returns the value of the secret secretName in the Key Vault vaultID, the latest version when version is empty
+func (az *AzureClient) GetKeyVaultSecret(ctx context.Context, vaultID, secretName, version string) (string, error) {
+	baseURI, err := az.keyVaultBaseURI(vaultID)
+	if err != nil {
+		return "", err
+	}
+	pathParameters := map[string]interface{}{
+		"secretName":    autorest.Encode("path", secretName),
+		"secretVersion": autorest.Encode("path", version),
+	}
+	queryParameters := map[string]interface{}{
+		"api-version": keyVaultAPIVersion,
+	}
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx),
+		autorest.AsGet(),
+		autorest.WithBaseURL(baseURI),
+		autorest.WithPathParameters("/secrets/{secretName}/{secretVersion}", pathParameters),
+		autorest.WithQueryParameters(queryParameters))
+	if err != nil {
+		return "", autorest.NewErrorWithError(err, "armhelpers.AzureClient", "GetKeyVaultSecret", nil, "Failure preparing request")
+	}
+
+	secret, err := az.sendKeyVaultRequest(req, "GetKeyVaultSecret")
+	if err != nil {
+		return "", err
+	}
+	return secret.Value, nil
+}
+
+func (az *AzureClient) sendKeyVaultRequest(req *http.Request, method string) (*keyVaultSecret, error) {
+	client := az.keyVaultClient
+	resp, err := autorest.SendWithSender(client, req, autorest.DoRetryForStatusCodes(client.RetryAttempts, client.RetryDuration, autorest.StatusCodesForRetry...))
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "armhelpers.AzureClient", method, resp, "Failure sending request")
+	}
+
+	secret := keyVaultSecret{}
+	err = autorest.Respond(
+		resp,
+		client.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&secret),
+		autorest.ByClosing())
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "armhelpers.AzureClient", method, resp, "Failure responding to request")
+	}
+	return &secret, nil
+}
@@ -4,14 +4,20 @@
 package armhelpers
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	policy "k8s.io/api/policy/v1beta1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
@@ -49,6 +55,11 @@ func (c *KubernetesClientSetClient) ListPods(node *v1.Node) (*v1.PodList, error)
 		FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": node.Name}).String()})
 }
 
+//ListPodDisruptionBudgets returns the PodDisruptionBudgets of all namespaces
+func (c *KubernetesClientSetClient) ListPodDisruptionBudgets() (*policy.PodDisruptionBudgetList, error) {
+	return c.clientset.PolicyV1beta1().PodDisruptionBudgets(metav1.NamespaceAll).List(metav1.ListOptions{})
+}
+
 //GetNode returns details about node with passed in name
 func (c *KubernetesClientSetClient) GetNode(name string) (*v1.Node, error) {
 	return c.clientset.CoreV1().Nodes().Get(name, metav1.GetOptions{})
@@ -149,3 +160,90 @@ func (c *KubernetesClientSetClient) WaitForDelete(logger *log.Entry, pods []v1.P
 	})
 	return pods, err
 }
+
+//GetObject returns the object of the api server with the kind, namespace and name of obj, nil when it does not exist
+func (c *KubernetesClientSetClient) GetObject(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	resourcePath, err := c.resourcePath(obj)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.clientset.CoreV1().RESTClient().Get().AbsPath(resourcePath, obj.GetName()).Do().Raw()
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	existing := &unstructured.Unstructured{}
+	if err := existing.UnmarshalJSON(b); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+//ApplyObject creates obj in the api server, or merges it into the existing object
+func (c *KubernetesClientSetClient) ApplyObject(obj *unstructured.Unstructured) error {
+	resourcePath, err := c.resourcePath(obj)
+	if err != nil {
+		return err
+	}
+	body, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	client := c.clientset.CoreV1().RESTClient()
+	err = client.Post().AbsPath(resourcePath).SetHeader("Content-Type", "application/json").Body(body).Do().Error()
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	// a merge patch keeps the fields set by the api server, such as the cluster IP of a service
+	return client.Patch(types.MergePatchType).AbsPath(resourcePath, obj.GetName()).Body(body).Do().Error()
+}
+
+//DeleteObject deletes the object of the api server with the kind, namespace and name of obj, if it exists
+func (c *KubernetesClientSetClient) DeleteObject(obj *unstructured.Unstructured) error {
+	resourcePath, err := c.resourcePath(obj)
+	if err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	body, err := json.Marshal(&metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil {
+		return err
+	}
+	err = c.clientset.CoreV1().RESTClient().Delete().AbsPath(resourcePath, obj.GetName()).SetHeader("Content-Type", "application/json").Body(body).Do().Error()
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+//resourcePath returns the path of the collection of the api server holding obj
+func (c *KubernetesClientSetClient) resourcePath(obj *unstructured.Unstructured) (string, error) {
+	gv, err := schema.ParseGroupVersion(obj.GetAPIVersion())
+	if err != nil {
+		return "", err
+	}
+	resources, err := c.clientset.Discovery().ServerResourcesForGroupVersion(obj.GetAPIVersion())
+	if err != nil {
+		return "", err
+	}
+	prefix := "/apis/" + gv.Group + "/" + gv.Version
+	if gv.Group == "" {
+		prefix = "/api/" + gv.Version
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Kind != obj.GetKind() || strings.Contains(resource.Name, "/") {
+			continue
+		}
+		if !resource.Namespaced {
+			return prefix + "/" + resource.Name, nil
+		}
+		namespace := obj.GetNamespace()
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+		return prefix + "/namespaces/" + namespace + "/" + resource.Name, nil
+	}
+	return "", errors.Errorf("the api server does not serve %s %s", obj.GetAPIVersion(), obj.GetKind())
+}
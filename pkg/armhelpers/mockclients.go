@@ -17,12 +17,15 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/authorization/mgmt/2015-07-01/authorization"
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/graphrbac/1.6/graphrbac"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2018-08-01/network"
 	"github.com/Azure/azure-sdk-for-go/services/preview/msi/mgmt/2015-08-31-preview/msi"
 	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
 	azStorage "github.com/Azure/azure-sdk-for-go/storage"
 	"github.com/Azure/go-autorest/autorest"
 	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 //MockACSEngineClient is an implementation of ACSEngineClient where all requests error out
@@ -46,7 +49,29 @@ type MockACSEngineClient struct {
 	FailListProviders                     bool
 	ShouldSupportVMIdentity               bool
 	FailDeleteRoleAssignment              bool
+	FailListUsages                        bool
+	FailListResourceSkus                  bool
+	FailGetSubnet                         bool
+	FailGetServicePrincipalObjectID       bool
+	FailSetKeyVaultSecret                 bool
+	FailGetKeyVaultSecret                 bool
 	MockKubernetesClient                  *MockKubernetesClient
+
+	// Usages, ResourceSkus, Providers and RoleAssignments are returned by the list calls when set
+	Usages          []compute.Usage
+	ResourceSkus    []ResourceSku
+	Providers       []resources.Provider
+	RoleAssignments []authorization.RoleAssignment
+	// PageSize splits the Providers and RoleAssignments listed into pages of PageSize values when set
+	PageSize int
+	// ScaleSets are returned by ListVirtualMachineScaleSets and ScaleSetVMs, keyed by scale set name,
+	// by ListVirtualMachineScaleSetVMs when set
+	ScaleSets   []compute.VirtualMachineScaleSet
+	ScaleSetVMs map[string][]compute.VirtualMachineScaleSetVM
+	// Subnets are returned by GetSubnet keyed by "vnetName/subnetName" when set
+	Subnets map[string]network.Subnet
+	// KeyVaultSecrets holds the secrets stored by SetKeyVaultSecret keyed by "vaultID/secrets/secretName/version"
+	KeyVaultSecrets map[string]string
 }
 
 //MockStorageClient mock implementation of StorageClient
@@ -68,6 +93,20 @@ type MockKubernetesClient struct {
 	FailWaitForDelete     bool
 	ShouldSupportEviction bool
 	PodsList              *v1.PodList
+
+	FailListPodDisruptionBudgets bool
+	PodDisruptionBudgetsList     *policy.PodDisruptionBudgetList
+
+	FailGetObject    bool
+	FailApplyObject  bool
+	FailDeleteObject bool
+	// Objects holds the objects applied with ApplyObject keyed by MockObjectKey
+	Objects map[string]*unstructured.Unstructured
+}
+
+// MockObjectKey is the key of obj in MockKubernetesClient.Objects: kind/namespace/name
+func MockObjectKey(obj *unstructured.Unstructured) string {
+	return obj.GetKind() + "/" + obj.GetNamespace() + "/" + obj.GetName()
 }
 
 // MockVirtualMachineListResultPage contains a page of VirtualMachine values.
@@ -105,6 +144,84 @@ func (page MockVirtualMachineListResultPage) Values() []compute.VirtualMachine {
 	return *page.Vmlr.Value
 }
 
+// MockVirtualMachineScaleSetListResultPage contains a page of VirtualMachineScaleSet values.
+type MockVirtualMachineScaleSetListResultPage struct {
+	Fn     func(compute.VirtualMachineScaleSetListResult) (compute.VirtualMachineScaleSetListResult, error)
+	Vmsslr compute.VirtualMachineScaleSetListResult
+}
+
+// Next advances to the next page of values.  If there was an error making
+// the request the page does not advance and the error is returned.
+func (page *MockVirtualMachineScaleSetListResultPage) Next() error {
+	if page.Fn == nil {
+		page.Vmsslr = compute.VirtualMachineScaleSetListResult{}
+		return nil
+	}
+	next, err := page.Fn(page.Vmsslr)
+	if err != nil {
+		return err
+	}
+	page.Vmsslr = next
+	return nil
+}
+
+// NotDone returns true if the page enumeration should be started or is not yet complete.
+func (page MockVirtualMachineScaleSetListResultPage) NotDone() bool {
+	return !page.Vmsslr.IsEmpty()
+}
+
+// Response returns the raw server response from the last page request.
+func (page MockVirtualMachineScaleSetListResultPage) Response() compute.VirtualMachineScaleSetListResult {
+	return page.Vmsslr
+}
+
+// Values returns the slice of values for the current page or nil if there are no values.
+func (page MockVirtualMachineScaleSetListResultPage) Values() []compute.VirtualMachineScaleSet {
+	if page.Vmsslr.IsEmpty() {
+		return nil
+	}
+	return *page.Vmsslr.Value
+}
+
+// MockVirtualMachineScaleSetVMListResultPage contains a page of VirtualMachineScaleSetVM values.
+type MockVirtualMachineScaleSetVMListResultPage struct {
+	Fn      func(compute.VirtualMachineScaleSetVMListResult) (compute.VirtualMachineScaleSetVMListResult, error)
+	Vmssvlr compute.VirtualMachineScaleSetVMListResult
+}
+
+// Next advances to the next page of values.  If there was an error making
+// the request the page does not advance and the error is returned.
+func (page *MockVirtualMachineScaleSetVMListResultPage) Next() error {
+	if page.Fn == nil {
+		page.Vmssvlr = compute.VirtualMachineScaleSetVMListResult{}
+		return nil
+	}
+	next, err := page.Fn(page.Vmssvlr)
+	if err != nil {
+		return err
+	}
+	page.Vmssvlr = next
+	return nil
+}
+
+// NotDone returns true if the page enumeration should be started or is not yet complete.
+func (page MockVirtualMachineScaleSetVMListResultPage) NotDone() bool {
+	return !page.Vmssvlr.IsEmpty()
+}
+
+// Response returns the raw server response from the last page request.
+func (page MockVirtualMachineScaleSetVMListResultPage) Response() compute.VirtualMachineScaleSetVMListResult {
+	return page.Vmssvlr
+}
+
+// Values returns the slice of values for the current page or nil if there are no values.
+func (page MockVirtualMachineScaleSetVMListResultPage) Values() []compute.VirtualMachineScaleSetVM {
+	if page.Vmssvlr.IsEmpty() {
+		return nil
+	}
+	return *page.Vmssvlr.Value
+}
+
 // MockDeploymentOperationsListResultPage contains a page of DeploymentOperation values.
 type MockDeploymentOperationsListResultPage struct {
 	Fn   func(resources.DeploymentOperationsListResult) (resources.DeploymentOperationsListResult, error)
@@ -140,6 +257,45 @@ func (page MockDeploymentOperationsListResultPage) Values() []resources.Deployme
 	return *page.Dolr.Value
 }
 
+// MockProviderListResultPage contains a page of Provider values.
+type MockProviderListResultPage struct {
+	Fn  func(resources.ProviderListResult) (resources.ProviderListResult, error)
+	Plr resources.ProviderListResult
+}
+
+// Next advances to the next page of values.  If there was an error making
+// the request the page does not advance and the error is returned.
+func (page *MockProviderListResultPage) Next() error {
+	if page.Fn == nil {
+		page.Plr = resources.ProviderListResult{}
+		return nil
+	}
+	next, err := page.Fn(page.Plr)
+	if err != nil {
+		return err
+	}
+	page.Plr = next
+	return nil
+}
+
+// NotDone returns true if the page enumeration should be started or is not yet complete.
+func (page MockProviderListResultPage) NotDone() bool {
+	return !page.Plr.IsEmpty()
+}
+
+// Response returns the raw server response from the last page request.
+func (page MockProviderListResultPage) Response() resources.ProviderListResult {
+	return page.Plr
+}
+
+// Values returns the slice of values for the current page or nil if there are no values.
+func (page MockProviderListResultPage) Values() []resources.Provider {
+	if page.Plr.IsEmpty() {
+		return nil
+	}
+	return *page.Plr.Value
+}
+
 // MockRoleAssignmentListResultPage contains a page of RoleAssignment values.
 type MockRoleAssignmentListResultPage struct {
 	Fn   func(authorization.RoleAssignmentListResult) (authorization.RoleAssignmentListResult, error)
@@ -149,6 +305,10 @@ type MockRoleAssignmentListResultPage struct {
 // Next advances to the next page of values.  If there was an error making
 // the request the page does not advance and the error is returned.
 func (page *MockRoleAssignmentListResultPage) Next() error {
+	if page.Fn == nil {
+		page.Ralr = authorization.RoleAssignmentListResult{}
+		return nil
+	}
 	next, err := page.Fn(page.Ralr)
 	if err != nil {
 		return err
@@ -186,6 +346,17 @@ func (mkc *MockKubernetesClient) ListPods(node *v1.Node) (*v1.PodList, error) {
 	return &v1.PodList{}, nil
 }
 
+//ListPodDisruptionBudgets returns the PodDisruptionBudgets of all namespaces
+func (mkc *MockKubernetesClient) ListPodDisruptionBudgets() (*policy.PodDisruptionBudgetList, error) {
+	if mkc.FailListPodDisruptionBudgets {
+		return nil, errors.New("ListPodDisruptionBudgets failed")
+	}
+	if mkc.PodDisruptionBudgetsList != nil {
+		return mkc.PodDisruptionBudgetsList, nil
+	}
+	return &policy.PodDisruptionBudgetList{}, nil
+}
+
 //GetNode returns details about node with passed in name
 func (mkc *MockKubernetesClient) GetNode(name string) (*v1.Node, error) {
 	if mkc.FailGetNode {
@@ -251,6 +422,35 @@ func (mkc *MockKubernetesClient) WaitForDelete(logger *log.Entry, pods []v1.Pod,
 	return []v1.Pod{}, nil
 }
 
+//GetObject returns the object of Objects with the kind, namespace and name of obj, nil when it does not exist
+func (mkc *MockKubernetesClient) GetObject(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if mkc.FailGetObject {
+		return nil, errors.New("GetObject failed")
+	}
+	return mkc.Objects[MockObjectKey(obj)], nil
+}
+
+//ApplyObject adds obj to Objects
+func (mkc *MockKubernetesClient) ApplyObject(obj *unstructured.Unstructured) error {
+	if mkc.FailApplyObject {
+		return errors.New("ApplyObject failed")
+	}
+	if mkc.Objects == nil {
+		mkc.Objects = map[string]*unstructured.Unstructured{}
+	}
+	mkc.Objects[MockObjectKey(obj)] = obj
+	return nil
+}
+
+//DeleteObject removes the object with the kind, namespace and name of obj from Objects
+func (mkc *MockKubernetesClient) DeleteObject(obj *unstructured.Unstructured) error {
+	if mkc.FailDeleteObject {
+		return errors.New("DeleteObject failed")
+	}
+	delete(mkc.Objects, MockObjectKey(obj))
+	return nil
+}
+
 //DeleteBlob mock
 func (msc *MockStorageClient) DeleteBlob(container, blob string, options *azStorage.DeleteBlobOptions) error {
 	return nil
@@ -425,12 +625,17 @@ func (mc *MockACSEngineClient) ListVirtualMachines(ctx context.Context, resource
 }
 
 //ListVirtualMachineScaleSets mock
-func (mc *MockACSEngineClient) ListVirtualMachineScaleSets(ctx context.Context, resourceGroup string) (compute.VirtualMachineScaleSetListResultPage, error) {
+func (mc *MockACSEngineClient) ListVirtualMachineScaleSets(ctx context.Context, resourceGroup string) (VirtualMachineScaleSetListResultPage, error) {
 	if mc.FailListVirtualMachineScaleSets {
-		return compute.VirtualMachineScaleSetListResultPage{}, errors.New("ListVirtualMachines failed")
+		return &MockVirtualMachineScaleSetListResultPage{}, errors.New("ListVirtualMachines failed")
 	}
 
-	return compute.VirtualMachineScaleSetListResultPage{}, nil
+	page := &MockVirtualMachineScaleSetListResultPage{}
+	if len(mc.ScaleSets) > 0 {
+		scaleSets := append([]compute.VirtualMachineScaleSet{}, mc.ScaleSets...)
+		page.Vmsslr.Value = &scaleSets
+	}
+	return page, nil
 }
 
 //GetVirtualMachine mock
@@ -514,13 +719,61 @@ func (mc *MockACSEngineClient) SetVirtualMachineScaleSetCapacity(ctx context.Con
 	return nil
 }
 
+//ListUsages mock
+func (mc *MockACSEngineClient) ListUsages(ctx context.Context, location string) ([]compute.Usage, error) {
+	if mc.FailListUsages {
+		return nil, errors.New("ListUsages failed")
+	}
+
+	return mc.Usages, nil
+}
+
+//ListResourceSkus mock
+func (mc *MockACSEngineClient) ListResourceSkus(ctx context.Context, location string) ([]ResourceSku, error) {
+	if mc.FailListResourceSkus {
+		return nil, errors.New("ListResourceSkus failed")
+	}
+
+	return mc.ResourceSkus, nil
+}
+
+//SetKeyVaultSecret mock
+func (mc *MockACSEngineClient) SetKeyVaultSecret(ctx context.Context, vaultID, secretName, value string) (string, error) {
+	if mc.FailSetKeyVaultSecret {
+		return "", errors.New("SetKeyVaultSecret failed")
+	}
+	if mc.KeyVaultSecrets == nil {
+		mc.KeyVaultSecrets = map[string]string{}
+	}
+	version := fmt.Sprintf("%032d", len(mc.KeyVaultSecrets)+1)
+	mc.KeyVaultSecrets[vaultID+"/secrets/"+secretName+"/"+version] = value
+	return version, nil
+}
+
+//GetKeyVaultSecret mock
+func (mc *MockACSEngineClient) GetKeyVaultSecret(ctx context.Context, vaultID, secretName, version string) (string, error) {
+	if mc.FailGetKeyVaultSecret {
+		return "", errors.New("GetKeyVaultSecret failed")
+	}
+	value, ok := mc.KeyVaultSecrets[vaultID+"/secrets/"+secretName+"/"+version]
+	if !ok {
+		return "", fmt.Errorf("secret %s/secrets/%s/%s not found", vaultID, secretName, version)
+	}
+	return value, nil
+}
+
 //ListVirtualMachineScaleSetVMs mock
-func (mc *MockACSEngineClient) ListVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string) (compute.VirtualMachineScaleSetVMListResultPage, error) {
+func (mc *MockACSEngineClient) ListVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string) (VirtualMachineScaleSetVMListResultPage, error) {
 	if mc.FailDeleteVirtualMachineScaleSetVM {
-		return compute.VirtualMachineScaleSetVMListResultPage{}, errors.New("DeleteVirtualMachineScaleSetVM failed")
+		return &MockVirtualMachineScaleSetVMListResultPage{}, errors.New("DeleteVirtualMachineScaleSetVM failed")
 	}
 
-	return compute.VirtualMachineScaleSetVMListResultPage{}, nil
+	page := &MockVirtualMachineScaleSetVMListResultPage{}
+	if vms := mc.ScaleSetVMs[virtualMachineScaleSet]; len(vms) > 0 {
+		vms = append([]compute.VirtualMachineScaleSetVM{}, vms...)
+		page.Vmssvlr.Value = &vms
+	}
+	return page, nil
 }
 
 //GetStorageClient mock
@@ -541,6 +794,27 @@ func (mc *MockACSEngineClient) DeleteNetworkInterface(ctx context.Context, resou
 	return nil
 }
 
+//GetSubnet mock
+func (mc *MockACSEngineClient) GetSubnet(ctx context.Context, resourceGroup, virtualNetworkName, subnetName string) (network.Subnet, error) {
+	if mc.FailGetSubnet {
+		return network.Subnet{}, errors.New("GetSubnet failed")
+	}
+
+	if mc.Subnets == nil {
+		return network.Subnet{
+			Name: &subnetName,
+			SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+				AddressPrefix: helpers.PointerToString("10.0.0.0/8"),
+			},
+		}, nil
+	}
+	subnet, ok := mc.Subnets[virtualNetworkName+"/"+subnetName]
+	if !ok {
+		return network.Subnet{}, fmt.Errorf("subnet %s/%s not found", virtualNetworkName, subnetName)
+	}
+	return subnet, nil
+}
+
 var validOSDiskResourceName = "https://00k71r4u927seqiagnt0.blob.core.windows.net/osdisk/k8s-agentpool1-12345678-0-osdisk.vhd"
 var validNicResourceName = "/subscriptions/DEC923E3-1EF1-4745-9516-37906D56DEC4/resourceGroups/acsK8sTest/providers/Microsoft.Network/networkInterfaces/k8s-agent-12345678-nic-0"
 
@@ -559,6 +833,15 @@ func (mc *MockACSEngineClient) CreateGraphPrincipal(ctx context.Context, service
 	return graphrbac.ServicePrincipal{}, nil
 }
 
+// GetServicePrincipalObjectID mock
+func (mc *MockACSEngineClient) GetServicePrincipalObjectID(ctx context.Context, clientID string) (string, error) {
+	if mc.FailGetServicePrincipalObjectID {
+		return "", errors.New("GetServicePrincipalObjectID failed")
+	}
+
+	return "client-object-id", nil
+}
+
 // CreateApp is a simpler method for creating an application
 func (mc *MockACSEngineClient) CreateApp(ctx context.Context, applicationName, applicationURL string, replyURLs *[]string, requiredResourceAccess *[]graphrbac.RequiredResourceAccess) (result graphrbac.Application, servicePrincipalObjectID, secret string, err error) {
 	return graphrbac.Application{
@@ -613,12 +896,40 @@ func (mc *MockACSEngineClient) GetKubernetesClient(masterURL, kubeConfig string,
 }
 
 // ListProviders mock
-func (mc *MockACSEngineClient) ListProviders(ctx context.Context) (resources.ProviderListResultPage, error) {
+func (mc *MockACSEngineClient) ListProviders(ctx context.Context) (ProviderListResultPage, error) {
 	if mc.FailListProviders {
-		return resources.ProviderListResultPage{}, errors.New("ListProviders failed")
+		return &MockProviderListResultPage{}, errors.New("ListProviders failed")
 	}
 
-	return resources.ProviderListResultPage{}, nil
+	providers := mc.Providers
+	if providers == nil {
+		providers = []resources.Provider{}
+	}
+	pages := [][]resources.Provider{providers}
+	if mc.PageSize > 0 {
+		pages = nil
+		for start := 0; start < len(providers); start += mc.PageSize {
+			end := start + mc.PageSize
+			if end > len(providers) {
+				end = len(providers)
+			}
+			pages = append(pages, providers[start:end])
+		}
+	}
+	page := func(i int) resources.ProviderListResult {
+		if i >= len(pages) {
+			return resources.ProviderListResult{}
+		}
+		return resources.ProviderListResult{Value: &pages[i]}
+	}
+	next := 0
+	return &MockProviderListResultPage{
+		Plr: page(0),
+		Fn: func(resources.ProviderListResult) (resources.ProviderListResult, error) {
+			next++
+			return page(next), nil
+		},
+	}, nil
 }
 
 // ListDeploymentOperations gets all deployments operations for a deployment.
@@ -702,16 +1013,38 @@ func (mc *MockACSEngineClient) DeleteRoleAssignmentByID(ctx context.Context, rol
 func (mc *MockACSEngineClient) ListRoleAssignmentsForPrincipal(ctx context.Context, scope string, principalID string) (RoleAssignmentListResultPage, error) {
 	roleAssignments := []authorization.RoleAssignment{}
 
-	if mc.ShouldSupportVMIdentity {
+	if mc.RoleAssignments != nil {
+		roleAssignments = mc.RoleAssignments
+	} else if mc.ShouldSupportVMIdentity {
 		var assignmentID = "role-assignment-id"
 		var assignment = authorization.RoleAssignment{
 			ID: &assignmentID}
 		roleAssignments = append(roleAssignments, assignment)
 	}
 
+	pages := [][]authorization.RoleAssignment{roleAssignments}
+	if mc.PageSize > 0 {
+		pages = nil
+		for start := 0; start < len(roleAssignments); start += mc.PageSize {
+			end := start + mc.PageSize
+			if end > len(roleAssignments) {
+				end = len(roleAssignments)
+			}
+			pages = append(pages, roleAssignments[start:end])
+		}
+	}
+	page := func(i int) authorization.RoleAssignmentListResult {
+		if i >= len(pages) {
+			return authorization.RoleAssignmentListResult{}
+		}
+		return authorization.RoleAssignmentListResult{Value: &pages[i]}
+	}
+	next := 0
 	return &MockRoleAssignmentListResultPage{
-		Ralr: authorization.RoleAssignmentListResult{
-			Value: &roleAssignments,
+		Ralr: page(0),
+		Fn: func(authorization.RoleAssignmentListResult) (authorization.RoleAssignmentListResult, error) {
+			next++
+			return page(next), nil
 		},
 	}, nil
 }
@@ -5,8 +5,15 @@ package armhelpers
 
 import (
 	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2018-08-01/network"
 )
 
+// GetSubnet returns the specified subnet of a virtual network.
+func (az *AzureClient) GetSubnet(ctx context.Context, resourceGroup, virtualNetworkName, subnetName string) (network.Subnet, error) {
+	return az.subnetsClient.Get(ctx, resourceGroup, virtualNetworkName, subnetName, "")
+}
+
 // DeleteNetworkInterface deletes the specified network interface.
 func (az *AzureClient) DeleteNetworkInterface(ctx context.Context, resourceGroup, nicName string) error {
 	future, err := az.interfacesClient.Delete(ctx, resourceGroup, nicName)
@@ -0,0 +1,140 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package armhelpers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// resourceSkusAPIVersion is the Microsoft.Compute/skus API version, which the vendored compute SDK does not cover
+const resourceSkusAPIVersion = "2017-09-01"
+
+// ResourceSku describes a compute SKU, such as a VM size, and where it is offered
+type ResourceSku struct {
+	ResourceType string                    `json:"resourceType,omitempty"`
+	Name         string                    `json:"name,omitempty"`
+	Family       string                    `json:"family,omitempty"`
+	Locations    []string                  `json:"locations,omitempty"`
+	LocationInfo []ResourceSkuLocationInfo `json:"locationInfo,omitempty"`
+	Capabilities []ResourceSkuCapability   `json:"capabilities,omitempty"`
+	Restrictions []ResourceSkuRestriction  `json:"restrictions,omitempty"`
+}
+
+// ResourceSkuLocationInfo lists the availability zones a SKU is offered in for a location
+type ResourceSkuLocationInfo struct {
+	Location string   `json:"location,omitempty"`
+	Zones    []string `json:"zones,omitempty"`
+}
+
+// ResourceSkuCapability is a named capability of a SKU, such as its number of vCPUs
+type ResourceSkuCapability struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// ResourceSkuRestriction describes why a SKU cannot be used by the subscription in some locations or zones
+type ResourceSkuRestriction struct {
+	// Type is either Location or Zone
+	Type            string                     `json:"type,omitempty"`
+	Values          []string                   `json:"values,omitempty"`
+	RestrictionInfo ResourceSkuRestrictionInfo `json:"restrictionInfo,omitempty"`
+	ReasonCode      string                     `json:"reasonCode,omitempty"`
+}
+
+// ResourceSkuRestrictionInfo lists the locations and zones a restriction applies to
+type ResourceSkuRestrictionInfo struct {
+	Locations []string `json:"locations,omitempty"`
+	Zones     []string `json:"zones,omitempty"`
+}
+
+type resourceSkusResult struct {
+	Value    []ResourceSku `json:"value,omitempty"`
+	NextLink string        `json:"nextLink,omitempty"`
+}
+
+// ListResourceSkus returns the compute SKUs of the subscription offered in the specified location
+func (az *AzureClient) ListResourceSkus(ctx context.Context, location string) ([]ResourceSku, error) {
+	client := az.virtualMachinesClient.Client
+
+	pathParameters := map[string]interface{}{
+		"subscriptionId": autorest.Encode("path", az.subscriptionID),
+	}
+	queryParameters := map[string]interface{}{
+		"api-version": resourceSkusAPIVersion,
+	}
+	preparer := autorest.CreatePreparer(
+		autorest.AsGet(),
+		autorest.WithBaseURL(az.virtualMachinesClient.BaseURI),
+		autorest.WithPathParameters("/subscriptions/{subscriptionId}/providers/Microsoft.Compute/skus", pathParameters),
+		autorest.WithQueryParameters(queryParameters))
+	req, err := preparer.Prepare((&http.Request{}).WithContext(ctx))
+
+	skus := []ResourceSku{}
+	for err == nil {
+		var resp *http.Response
+		resp, err = autorest.SendWithSender(client, req, azure.DoRetryWithRegistration(client))
+		if err != nil {
+			return nil, autorest.NewErrorWithError(err, "armhelpers.AzureClient", "ListResourceSkus", resp, "Failure sending request")
+		}
+
+		result := resourceSkusResult{}
+		err = autorest.Respond(
+			resp,
+			client.ByInspecting(),
+			azure.WithErrorUnlessStatusCode(http.StatusOK),
+			autorest.ByUnmarshallingJSON(&result),
+			autorest.ByClosing())
+		if err != nil {
+			return nil, autorest.NewErrorWithError(err, "armhelpers.AzureClient", "ListResourceSkus", resp, "Failure responding to request")
+		}
+
+		for _, sku := range result.Value {
+			if sku.OfferedIn(location) {
+				skus = append(skus, sku)
+			}
+		}
+		if result.NextLink == "" {
+			return skus, nil
+		}
+		req, err = autorest.Prepare((&http.Request{}).WithContext(ctx),
+			autorest.AsGet(),
+			autorest.WithBaseURL(result.NextLink))
+	}
+	return nil, err
+}
+
+// OfferedIn returns true if the SKU is listed for location
+func (s ResourceSku) OfferedIn(location string) bool {
+	for _, l := range s.Locations {
+		if strings.EqualFold(l, location) {
+			return true
+		}
+	}
+	return false
+}
+
+// Zones returns the availability zones the SKU is offered in for location
+func (s ResourceSku) Zones(location string) []string {
+	for _, info := range s.LocationInfo {
+		if strings.EqualFold(info.Location, location) {
+			return info.Zones
+		}
+	}
+	return nil
+}
+
+// Capability returns the value of the named capability of the SKU, or "" if the SKU does not have it
+func (s ResourceSku) Capability(name string) string {
+	for _, c := range s.Capabilities {
+		if c.Name == name {
+			return c.Value
+		}
+	}
+	return ""
+}
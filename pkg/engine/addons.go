@@ -0,0 +1,746 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/acsengine"
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	// addonsDir is where the addon manager of the masters reads the manifests of the addons
+	addonsDir = "/etc/kubernetes/addons"
+	// addonsClientTimeout is how long the requests to the API server are retried
+	addonsClientTimeout = 5 * time.Minute
+	// addonManagerModeLabel is the label telling the addon manager how to deploy an object
+	addonManagerModeLabel = "addonmanager.kubernetes.io/mode"
+	// azureConfigCommand prints the cloud provider configuration written by the CSE script of a master
+	azureConfigCommand = "sudo cat /etc/kubernetes/azure.json"
+)
+
+// AddonsOptions are the options of EnableAddon, DisableAddon, UpdateAddon and AddonsStatus
+type AddonsOptions struct {
+	Client     armhelpers.ACSEngineClient
+	Logger     *logrus.Entry
+	Translator *i18n.Translator
+	// ContainerService is the deployed cluster, as loaded from the apimodel.json written by Generate,
+	// with the registry of the addons loaded from directories
+	ContainerService *api.ContainerService
+	// APIVersion is the version of the API the apimodel.json artifact is written in
+	APIVersion string
+	// DeploymentDirectory is the output directory of Generate; its artifacts are written again
+	// with the changed addon, and the previous apimodel.json is kept as apimodel.json.bak
+	DeploymentDirectory string
+	// Location is the location of the cluster, used to generate its admin kubeconfig
+	Location string
+	// KubernetesClient talks to the API server; nil connects to it with the admin kubeconfig
+	// of the cluster through Client
+	KubernetesClient armhelpers.KubernetesClient
+	// SSHPrivateKey authenticates the admin user on the masters
+	SSHPrivateKey []byte
+	// Runner runs the commands on the masters; nil connects to them over SSH with SSHPrivateKey
+	Runner NodeRunner
+	// BuildTag is the version of acs-engine recorded in the template
+	BuildTag string
+}
+
+// AddonChange is the configuration UpdateAddon merges into an addon of the apimodel
+type AddonChange struct {
+	// Name is the name of the addon
+	Name string
+	// Containers are merged into the containers of the addon with the same name; their empty
+	// fields keep the values of the apimodel
+	Containers []api.KubernetesContainerSpec
+	// Config is merged into the config of the addon
+	Config map[string]string
+}
+
+// AddonsResult is the result of EnableAddon, DisableAddon and UpdateAddon
+type AddonsResult struct {
+	// Applied are the objects of the addon created or updated in the API server, as "Kind namespace/name"
+	Applied []string
+	// Deleted are the objects of the addon removed from the API server, as "Kind namespace/name"
+	Deleted []string
+	// Artifacts are the paths of the files written to the deployment directory
+	Artifacts []string
+}
+
+// AddonStatus compares an addon of the apimodel with the objects deployed to the cluster
+type AddonStatus struct {
+	Name string `json:"name"`
+	// Enabled tells whether the apimodel deploys the addon
+	Enabled bool `json:"enabled"`
+	// Deployed tells whether objects of the addon exist in the cluster
+	Deployed bool `json:"deployed"`
+	// Drift lists the differences between the apimodel and the cluster
+	Drift []string `json:"drift,omitempty"`
+}
+
+// EnableAddon enables an addon of the registry of a deployed Kubernetes cluster, with the
+// defaults of the registry for the configuration the apimodel does not set
+func EnableAddon(ctx context.Context, o AddonsOptions, name string) (*AddonsResult, error) {
+	enabled := true
+	return changeAddon(ctx, o, name, &enabled, func(addon *api.KubernetesAddon) {
+		addon.Enabled = &enabled
+	})
+}
+
+// DisableAddon disables an addon of the registry of a deployed Kubernetes cluster and deletes
+// its objects
+func DisableAddon(ctx context.Context, o AddonsOptions, name string) (*AddonsResult, error) {
+	enabled := false
+	return changeAddon(ctx, o, name, &enabled, func(addon *api.KubernetesAddon) {
+		addon.Enabled = &enabled
+	})
+}
+
+// UpdateAddon changes the containers and the config of an addon of a deployed Kubernetes
+// cluster; the objects of an enabled addon are updated. The config of a chart addon holds the
+// values of its chart, which the new job installing the chart upgrades the release with.
+func UpdateAddon(ctx context.Context, o AddonsOptions, change AddonChange) (*AddonsResult, error) {
+	if len(change.Containers) > 0 && isChartAddon(o.ContainerService, change.Name) {
+		return nil, &ValidationError{Err: errors.Errorf("chart addon %s has no containers; change the values of its chart with its config", change.Name)}
+	}
+	return changeAddon(ctx, o, change.Name, nil, func(addon *api.KubernetesAddon) {
+		for _, c := range change.Containers {
+			i := addon.GetAddonContainersIndexByName(c.Name)
+			if i < 0 {
+				addon.Containers = append(addon.Containers, api.KubernetesContainerSpec{Name: c.Name})
+				i = len(addon.Containers) - 1
+			}
+			mergeContainerSpec(&addon.Containers[i], c)
+		}
+		for key, val := range change.Config {
+			if addon.Config == nil {
+				addon.Config = map[string]string{}
+			}
+			addon.Config[key] = val
+		}
+	})
+}
+
+// changeAddon changes an addon of the apimodel of a deployed cluster and rolls out the manifest
+// it renders: the apimodel and the artifacts of the deployment directory are written first,
+// then the manifest is written to, or removed from, the addons directory of every master for
+// the addon manager to keep deploying it, and finally its objects are applied to, or deleted
+// from, the API server for the change to take effect right away. enabled, when not nil, is
+// whether the addon must be deployed after change. The manifest of a chart addon is the job
+// installing its chart, written along with its packaged chart if any; the release of a disabled
+// chart addon is left for helm to delete.
+func changeAddon(ctx context.Context, o AddonsOptions, name string, enabled *bool, change func(addon *api.KubernetesAddon)) (*AddonsResult, error) {
+	logger := loggerOrDefault(o.Logger)
+	translator := translatorOrDefault(o.Translator)
+	cs := o.ContainerService
+	if err := validateAddonsCluster(cs); err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+	if err := setAddonsDefaults(cs); err != nil {
+		return nil, err
+	}
+	k := cs.Properties.OrchestratorProfile.KubernetesConfig
+	d := cs.AddonRegistry().Get(name)
+	chart := d == nil && isChartAddon(cs, name)
+	if !chart && (d == nil || !d.HasManifest()) {
+		return nil, &ValidationError{Err: errors.Errorf("addon %s is not in the registry of the cluster", name)}
+	}
+	// a chart addon is deployed when it is enabled, as it has no descriptor in the registry
+	deployed := func() bool {
+		if chart {
+			addon := k.GetAddonByName(name)
+			return addon.IsEnabled(true)
+		}
+		return d.IsEnabled(cs.Properties)
+	}
+	runner := o.Runner
+	if runner == nil {
+		if len(o.SSHPrivateKey) == 0 {
+			return nil, &ValidationError{Err: errors.New("an SSH private key is needed to reach the masters")}
+		}
+		runner = newSSHNodeRunner(cs, o.SSHPrivateKey)
+	}
+
+	before, err := renderAddonObjects(cs, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	i := -1
+	for j := range k.Addons {
+		if k.Addons[j].Name == name {
+			i = j
+		}
+	}
+	if i < 0 {
+		k.Addons = append(k.Addons, api.KubernetesAddon{Name: name})
+		i = len(k.Addons) - 1
+	}
+	change(&k.Addons[i])
+	if k.Addons[i].IsEnabled(false) {
+		cs.SetAddonDefaults(name)
+	}
+	if enabled != nil && deployed() != *enabled {
+		return nil, &ValidationError{Err: errors.Errorf("addon %s is deployed according to the configuration of the cluster rather than its enabled field", name)}
+	}
+	if err = cs.ValidateAddons(); err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+	var config *azureConfig
+	if deployed() {
+		if config, err = provisioningConfig(name, runner); err != nil {
+			return nil, err
+		}
+	}
+	after, err := renderAddonObjects(cs, name, config)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := otherAddonsObjects(cs, name)
+	if err != nil {
+		return nil, err
+	}
+	client, err := addonsKubernetesClient(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AddonsResult{}
+	if err = ctx.Err(); err != nil {
+		return result, err
+	}
+	if err = backupAPIModel(o.DeploymentDirectory); err != nil {
+		return result, err
+	}
+	if err = writeDeploymentArtifacts(translator, cs, o.APIVersion, o.DeploymentDirectory, o.BuildTag); err != nil {
+		return result, err
+	}
+	if result.Artifacts, err = listArtifacts(o.DeploymentDirectory); err != nil {
+		return result, err
+	}
+
+	commands := addonFileCommands(name, d, after.manifest)
+	for master := 0; master < cs.Properties.MasterProfile.Count; master++ {
+		if err = ctx.Err(); err != nil {
+			return result, err
+		}
+		logger.Infof("master %d: updating the manifest of addon %s", master, name)
+		for _, c := range commands {
+			if out, runErr := runner.RunOnMaster(master, c.command, c.input); runErr != nil {
+				return result, errors.Wrapf(runErr, "error updating the manifest of addon %s on master %d: %s; "+
+					"the apimodel in %s has the change, run the command again once the master is fixed", name, master, out, o.DeploymentDirectory)
+			}
+		}
+	}
+
+	applied := map[string]bool{}
+	for _, obj := range after.objects {
+		if err = ctx.Err(); err != nil {
+			return result, err
+		}
+		if err = client.ApplyObject(obj); err != nil {
+			return result, errors.Wrapf(err, "error applying %s", objectName(obj))
+		}
+		applied[objectName(obj)] = true
+		result.Applied = append(result.Applied, objectName(obj))
+	}
+	// deleted in the reverse order of the manifest; namespaces, the objects the addon manager
+	// only ensures exist and those of other enabled addons are left in place
+	for j := len(before.objects) - 1; j >= 0; j-- {
+		obj := before.objects[j]
+		if applied[objectName(obj)] || shared[objectName(obj)] || !deletable(obj) {
+			continue
+		}
+		if err = client.DeleteObject(obj); err != nil {
+			return result, errors.Wrapf(err, "error deleting %s", objectName(obj))
+		}
+		result.Deleted = append(result.Deleted, objectName(obj))
+	}
+	return result, nil
+}
+
+// AddonsStatus compares the addons of the apimodel of a deployed Kubernetes cluster with the
+// objects of the cluster: the objects of an enabled addon that are missing, and the images and
+// resources of its containers that differ from the apimodel, are drift, as are the objects of a
+// disabled addon that are still deployed. The addons are sorted by name.
+func AddonsStatus(ctx context.Context, o AddonsOptions) ([]AddonStatus, error) {
+	logger := loggerOrDefault(o.Logger)
+	cs := o.ContainerService
+	if err := validateAddonsCluster(cs); err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+	if err := setAddonsDefaults(cs); err != nil {
+		return nil, err
+	}
+	client, err := addonsKubernetesClient(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, d := range cs.AddonRegistry().Addons() {
+		if d.HasManifest() {
+			names = append(names, d.Name)
+		}
+	}
+	for _, addon := range cs.Properties.OrchestratorProfile.KubernetesConfig.Addons {
+		if addon.IsChart() {
+			names = append(names, addon.Name)
+		}
+	}
+	sort.Strings(names)
+
+	var statuses []AddonStatus
+	for _, name := range names {
+		if err = ctx.Err(); err != nil {
+			return statuses, err
+		}
+		status := AddonStatus{Name: name}
+		rendered, err := renderAddonObjects(cs, name, nil)
+		if err != nil {
+			return statuses, err
+		}
+		status.Enabled = rendered.manifest != nil
+		var kept map[string]bool
+		if !status.Enabled {
+			// the objects the addon would have, to find the ones left behind
+			if rendered, err = renderAddonObjects(enabledAddonCopy(cs, name), name, nil); err != nil {
+				logger.Debugf("unable to render the disabled addon %s: %s", name, err)
+				statuses = append(statuses, status)
+				continue
+			}
+			// the objects disabling the addon leaves in place
+			if kept, err = otherAddonsObjects(cs, name); err != nil {
+				return statuses, err
+			}
+		}
+		for _, obj := range rendered.objects {
+			if !status.Enabled && (kept[objectName(obj)] || !deletable(obj)) {
+				continue
+			}
+			existing, err := client.GetObject(obj)
+			if err != nil {
+				return statuses, errors.Wrapf(err, "error getting %s", objectName(obj))
+			}
+			switch {
+			case existing == nil && status.Enabled:
+				status.Drift = append(status.Drift, fmt.Sprintf("%s is missing", objectName(obj)))
+			case existing != nil:
+				status.Deployed = true
+				if status.Enabled {
+					status.Drift = append(status.Drift, containersDrift(obj, existing)...)
+				}
+			}
+		}
+		if status.Deployed && !status.Enabled {
+			status.Drift = append(status.Drift, "deployed but disabled in the apimodel")
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func validateAddonsCluster(cs *api.ContainerService) error {
+	if cs == nil || cs.Properties == nil || cs.Properties.OrchestratorProfile == nil || !cs.Properties.OrchestratorProfile.IsKubernetes() {
+		return errors.New("addons can only be managed on Kubernetes clusters")
+	}
+	p := cs.Properties
+	if p.MasterProfile == nil || p.LinuxProfile == nil {
+		return errors.New("addons can only be managed on clusters with a master profile and a linux profile")
+	}
+	return nil
+}
+
+// setAddonsDefaults defaults a deployed cluster as for a scale, keeping the images of its
+// addons that SetPropertiesDefaults resets to those of its Kubernetes version
+func setAddonsDefaults(cs *api.ContainerService) error {
+	images := map[string]string{}
+	if k := cs.Properties.OrchestratorProfile.KubernetesConfig; k != nil {
+		for _, addon := range k.Addons {
+			for _, c := range addon.Containers {
+				if c.Image != "" {
+					images[addon.Name+"/"+c.Name] = c.Image
+				}
+			}
+		}
+	}
+	if _, err := cs.SetPropertiesDefaults(false, true); err != nil {
+		return &ValidationError{Err: errors.Wrap(err, "error in SetPropertiesDefaults")}
+	}
+	addons := cs.Properties.OrchestratorProfile.KubernetesConfig.Addons
+	for i := range addons {
+		for j := range addons[i].Containers {
+			if image, ok := images[addons[i].Name+"/"+addons[i].Containers[j].Name]; ok {
+				addons[i].Containers[j].Image = image
+			}
+		}
+	}
+	return nil
+}
+
+// mergeContainerSpec sets the non-empty fields of from on c
+func mergeContainerSpec(c *api.KubernetesContainerSpec, from api.KubernetesContainerSpec) {
+	if from.Image != "" {
+		c.Image = from.Image
+	}
+	if from.CPURequests != "" {
+		c.CPURequests = from.CPURequests
+	}
+	if from.MemoryRequests != "" {
+		c.MemoryRequests = from.MemoryRequests
+	}
+	if from.CPULimits != "" {
+		c.CPULimits = from.CPULimits
+	}
+	if from.MemoryLimits != "" {
+		c.MemoryLimits = from.MemoryLimits
+	}
+}
+
+// enabledAddonCopy returns a copy of cs with the addon name enabled, leaving cs unchanged
+func enabledAddonCopy(cs *api.ContainerService, name string) *api.ContainerService {
+	enabled := *cs
+	properties := *cs.Properties
+	orchestratorProfile := *properties.OrchestratorProfile
+	kubernetesConfig := *orchestratorProfile.KubernetesConfig
+	kubernetesConfig.Addons = nil
+	found := false
+	for _, addon := range cs.Properties.OrchestratorProfile.KubernetesConfig.Addons {
+		if addon.Name == name {
+			found = true
+			addon.Enabled = helpers.PointerToBool(true)
+			addon.Containers = append([]api.KubernetesContainerSpec(nil), addon.Containers...)
+			config := map[string]string{}
+			for key, val := range addon.Config {
+				config[key] = val
+			}
+			addon.Config = config
+		}
+		kubernetesConfig.Addons = append(kubernetesConfig.Addons, addon)
+	}
+	if !found {
+		kubernetesConfig.Addons = append(kubernetesConfig.Addons, api.KubernetesAddon{Name: name, Enabled: helpers.PointerToBool(true)})
+	}
+	orchestratorProfile.KubernetesConfig = &kubernetesConfig
+	properties.OrchestratorProfile = &orchestratorProfile
+	enabled.Properties = &properties
+	enabled.SetAddonDefaults(name)
+	return &enabled
+}
+
+// addonObjects are the manifest of an addon and its objects, nil when it is not enabled
+type addonObjects struct {
+	manifest *acsengine.AddonManifest
+	objects  []*unstructured.Unstructured
+}
+
+// renderAddonObjects renders the manifest of the addon name of cs as GenerateTemplate does, with the
+// placeholders substituted by the CSE script replaced with the values of config
+func renderAddonObjects(cs *api.ContainerService, name string, config *azureConfig) (*addonObjects, error) {
+	manifests, err := acsengine.RenderAddons(cs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range manifests {
+		if manifests[i].Name != name {
+			continue
+		}
+		manifests[i].Content = substituteProvisioningPlaceholders(cs, name, manifests[i].Content, config)
+		objects, err := parseManifest(manifests[i].Content)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing the manifest of addon %s", name)
+		}
+		return &addonObjects{manifest: &manifests[i], objects: objects}, nil
+	}
+	return &addonObjects{}, nil
+}
+
+// otherAddonsObjects returns the names of the objects rendered by the enabled addons of cs other
+// than name
+func otherAddonsObjects(cs *api.ContainerService, name string) (map[string]bool, error) {
+	manifests, err := acsengine.RenderAddons(cs)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, manifest := range manifests {
+		if manifest.Name == name {
+			continue
+		}
+		objects, err := parseManifest(substituteProvisioningPlaceholders(cs, manifest.Name, manifest.Content, nil))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing the manifest of addon %s", manifest.Name)
+		}
+		for _, obj := range objects {
+			names[objectName(obj)] = true
+		}
+	}
+	return names, nil
+}
+
+// deletable tells whether obj is removed with its addon: namespaces may hold objects of other
+// addons or of users, and the addon manager never removes objects in EnsureExists mode
+func deletable(obj *unstructured.Unstructured) bool {
+	return obj.GetKind() != "Namespace" && obj.GetLabels()[addonManagerModeLabel] != "EnsureExists"
+}
+
+// azureConfig is the cloud provider configuration the CSE script writes on the masters
+type azureConfig struct {
+	TenantID            string `json:"tenantId"`
+	SubscriptionID      string `json:"subscriptionId"`
+	AADClientID         string `json:"aadClientId"`
+	AADClientSecret     string `json:"aadClientSecret"`
+	ResourceGroup       string `json:"resourceGroup"`
+	VMType              string `json:"vmType"`
+	PrimaryScaleSetName string `json:"primaryScaleSetName"`
+}
+
+// provisioningConfig returns the values the CSE script substitutes in the manifest of addon name
+// when the masters are provisioned, read from the first master, or nil when the manifest needs
+// none. The addons configured with files the CSE script creates on the masters cannot be deployed.
+func provisioningConfig(name string, runner NodeRunner) (*azureConfig, error) {
+	switch name {
+	case api.DefaultClusterAutoscalerAddonName:
+	case api.DefaultACIConnectorAddonName:
+		return nil, &ValidationError{Err: errors.Errorf("addon %s is configured when the masters are provisioned and cannot be deployed with acs-engine addons", name)}
+	default:
+		return nil, nil
+	}
+	out, err := runner.RunOnMaster(0, azureConfigCommand, "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading the cloud provider configuration of master 0: %s", out)
+	}
+	config := &azureConfig{}
+	if err = json.Unmarshal([]byte(out), config); err != nil {
+		return nil, errors.Wrap(err, "error parsing the cloud provider configuration of master 0")
+	}
+	return config, nil
+}
+
+// substituteProvisioningPlaceholders replaces the placeholders of the manifest of addon name that
+// the CSE script substitutes when the masters are provisioned with the values of config. A nil
+// config replaces them with empty values, which keeps the kinds, names and containers of the objects.
+func substituteProvisioningPlaceholders(cs *api.ContainerService, name, content string, config *azureConfig) string {
+	if name != api.DefaultClusterAutoscalerAddonName {
+		return content
+	}
+	if config == nil {
+		config = &azureConfig{}
+	}
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+	useManagedIdentity := cs.Properties.OrchestratorProfile.KubernetesConfig.UseManagedIdentity
+	var volumeMounts, volumes, hostNetwork string
+	if useManagedIdentity {
+		volumeMounts = "- mountPath: /var/lib/waagent/\n          name: waagent\n          readOnly: true"
+		volumes = "- hostPath:\n          path: /var/lib/waagent/\n        name: waagent"
+		hostNetwork = "hostNetwork: true"
+	}
+	return strings.NewReplacer(
+		"<clientID>", encode(config.AADClientID),
+		"<clientSec>", encode(config.AADClientSecret),
+		"<subID>", encode(config.SubscriptionID),
+		"<tenantID>", encode(config.TenantID),
+		"<rg>", encode(config.ResourceGroup),
+		"<vmType>", encode(config.VMType),
+		"<vmssName>", config.PrimaryScaleSetName,
+		"<cloud>", cs.GetCloudSpecConfig().CloudName,
+		"<useManagedIdentity>", fmt.Sprint(useManagedIdentity),
+		"<volMounts>", volumeMounts,
+		"<vols>", volumes,
+		"<hostNet>", hostNetwork,
+	).Replace(content)
+}
+
+// parseManifest returns the objects of the documents of a YAML or JSON manifest
+func parseManifest(content string) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(strings.NewReader(content), 4096)
+	for {
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(object) == 0 {
+			continue
+		}
+		obj := &unstructured.Unstructured{Object: object}
+		if obj.GetKind() == "" || obj.GetName() == "" {
+			return nil, errors.Errorf("the manifest has an object without a kind or a name")
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// addonsKubernetesClient returns the client of the API server of the cluster of o
+func addonsKubernetesClient(ctx context.Context, o AddonsOptions) (armhelpers.KubernetesClient, error) {
+	if o.KubernetesClient != nil {
+		return o.KubernetesClient, nil
+	}
+	if o.Client == nil {
+		return nil, &ValidationError{Err: errors.New("an Azure client is needed to connect to the API server")}
+	}
+	cs := o.ContainerService
+	kubeConfig, err := getKubeConfig(ctx, o.Client, cs, o.Location)
+	if err != nil {
+		return nil, err
+	}
+	fqdn := cs.Properties.MasterProfile.FQDN
+	if fqdn == "" {
+		fqdn = cs.GetAzureProdFQDN()
+	}
+	client, err := o.Client.GetKubernetesClient(masterURL(fqdn), kubeConfig, time.Second, addonsClientTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get a Kubernetes client")
+	}
+	return client, nil
+}
+
+// masterCommand is a command run on the masters with its standard input
+type masterCommand struct {
+	command string
+	input   string
+}
+
+// addonFileCommands returns the commands writing manifest, and the packaged chart of a chart
+// addon, to the masters, or removing the files of addon name, described by d unless it is a
+// chart addon, when manifest is nil. The files are read from the standard input as they may
+// hold secrets, such as the service principal of cluster-autoscaler.
+func addonFileCommands(name string, d *api.AddonDescriptor, manifest *acsengine.AddonManifest) []masterCommand {
+	if manifest == nil {
+		if d != nil {
+			return []masterCommand{{command: fmt.Sprintf("sudo rm -f %s/%s", addonsDir, d.GetDestinationFile())}}
+		}
+		return []masterCommand{{command: fmt.Sprintf("sudo rm -f %s/%s-chart.yaml %s/%s.tgz", addonsDir, name, acsengine.ChartAddonsPath, name)}}
+	}
+	var commands []masterCommand
+	if manifest.Chart != nil {
+		commands = append(commands, masterCommand{
+			command: fmt.Sprintf("sudo mkdir -p %s && sudo tee %s/%s.tgz >/dev/null", acsengine.ChartAddonsPath, acsengine.ChartAddonsPath, name),
+			input:   string(manifest.Chart),
+		})
+	}
+	return append(commands, masterCommand{command: fmt.Sprintf("sudo tee %s/%s >/dev/null", addonsDir, manifest.DestinationFile), input: manifest.Content})
+}
+
+// isChartAddon tells whether the addon name of cs installs a Helm chart
+func isChartAddon(cs *api.ContainerService, name string) bool {
+	if cs == nil || cs.Properties == nil || cs.Properties.OrchestratorProfile == nil || cs.Properties.OrchestratorProfile.KubernetesConfig == nil {
+		return false
+	}
+	addon := cs.Properties.OrchestratorProfile.KubernetesConfig.GetAddonByName(name)
+	return addon.IsChart()
+}
+
+// objectName names an object as "Kind namespace/name", or "Kind name" when it is not namespaced
+func objectName(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetKind() + " " + obj.GetName()
+	}
+	return obj.GetKind() + " " + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// podSpecFields are the fields of the pod template of the objects of a kind
+func podSpecFields(kind string) []string {
+	switch kind {
+	case "Pod":
+		return []string{"spec"}
+	case "CronJob":
+		return []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	default:
+		return []string{"spec", "template", "spec"}
+	}
+}
+
+// containersDrift compares the images and the resources of the containers of a rendered
+// object with those of the deployed object
+func containersDrift(rendered, deployed *unstructured.Unstructured) []string {
+	fields := append(podSpecFields(rendered.GetKind()), "containers")
+	want, _, _ := unstructured.NestedSlice(rendered.Object, fields...)
+	got, _, _ := unstructured.NestedSlice(deployed.Object, fields...)
+	deployedContainers := map[string]map[string]interface{}{}
+	for _, c := range got {
+		if container, ok := c.(map[string]interface{}); ok {
+			deployedContainers[fmt.Sprint(container["name"])] = container
+		}
+	}
+
+	var drift []string
+	for _, c := range want {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name := fmt.Sprint(container["name"])
+		prefix := fmt.Sprintf("%s container %s", objectName(rendered), name)
+		existing, ok := deployedContainers[name]
+		if !ok {
+			drift = append(drift, prefix+" is missing")
+			continue
+		}
+		if image, deployedImage := fieldString(container, "image"), fieldString(existing, "image"); image != deployedImage {
+			drift = append(drift, fmt.Sprintf("%s: image is %s, the apimodel has %s", prefix, deployedImage, image))
+		}
+		for _, section := range []string{"requests", "limits"} {
+			for _, r := range []string{"cpu", "memory"} {
+				value := fieldString(container, "resources", section, r)
+				deployedValue := fieldString(existing, "resources", section, r)
+				if !sameQuantity(value, deployedValue) {
+					drift = append(drift, fmt.Sprintf("%s: %s %s is %s, the apimodel has %s", prefix, section, r, orNone(deployedValue), orNone(value)))
+				}
+			}
+		}
+	}
+	return drift
+}
+
+// fieldString returns a nested field of obj as a string, empty when it is not set
+func fieldString(obj map[string]interface{}, fields ...string) string {
+	val, found, err := unstructured.NestedFieldNoCopy(obj, fields...)
+	if !found || err != nil || val == nil {
+		return ""
+	}
+	return fmt.Sprint(val)
+}
+
+// sameQuantity tells whether two resource quantities are equal, such as 1 and 1000m
+func sameQuantity(a, b string) bool {
+	if a == b {
+		return true
+	}
+	qa, err := resource.ParseQuantity(a)
+	if err != nil {
+		return false
+	}
+	qb, err := resource.ParseQuantity(b)
+	if err != nil {
+		return false
+	}
+	return qa.Cmp(qb) == 0
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
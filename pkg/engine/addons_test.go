@@ -0,0 +1,397 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/pkg/errors"
+)
+
+const dashboardDeployment = "Deployment/kube-system/kubernetes-dashboard"
+
+func addonsOptions(t *testing.T, dir string, client *armhelpers.MockKubernetesClient, runner NodeRunner) AddonsOptions {
+	cs, apiVersion := loadDeployment(t, dir)
+	return AddonsOptions{
+		ContainerService:    cs,
+		APIVersion:          apiVersion,
+		DeploymentDirectory: dir,
+		KubernetesClient:    client,
+		Runner:              runner,
+	}
+}
+
+func TestEnableDisableAddon(t *testing.T) {
+	dir := generateDeployment(t)
+	defer os.RemoveAll(dir)
+	client := &armhelpers.MockKubernetesClient{}
+
+	runner := &fakeNodeRunner{}
+	result, err := DisableAddon(context.Background(), addonsOptions(t, dir, client, runner), api.DefaultDashboardAddonName)
+	if err != nil {
+		t.Fatalf("unexpected error disabling the addon: %s", err)
+	}
+	if len(result.Applied) != 0 || !containsString(result.Deleted, "Deployment kube-system/kubernetes-dashboard") {
+		t.Errorf("expected the objects of the dashboard to be deleted, got %+v", result)
+	}
+	if len(runner.commands) != 3 || runner.commands[2] != "master 2: sudo rm -f /etc/kubernetes/addons/kubernetes-dashboard-deployment.yaml" {
+		t.Errorf("expected the manifest to be removed from the 3 masters, got %v", runner.commands)
+	}
+	if _, err = os.Stat(path.Join(dir, "apimodel.json.bak")); err != nil {
+		t.Errorf("expected the previous apimodel to be backed up: %s", err)
+	}
+	cs, _ := loadDeployment(t, dir)
+	if cs.Properties.OrchestratorProfile.KubernetesConfig.IsDashboardEnabled() {
+		t.Errorf("expected the dashboard to be disabled in apimodel.json")
+	}
+
+	runner = &fakeNodeRunner{}
+	if result, err = EnableAddon(context.Background(), addonsOptions(t, dir, client, runner), api.DefaultDashboardAddonName); err != nil {
+		t.Fatalf("unexpected error enabling the addon: %s", err)
+	}
+	if len(result.Deleted) != 0 || !containsString(result.Applied, "Deployment kube-system/kubernetes-dashboard") {
+		t.Errorf("expected the objects of the dashboard to be applied, got %+v", result)
+	}
+	if client.Objects[dashboardDeployment] == nil {
+		t.Errorf("expected the deployment of the dashboard to be created, got %v", client.Objects)
+	}
+	if len(runner.commands) != 3 || !strings.Contains(runner.commands[0], "sudo tee /etc/kubernetes/addons/kubernetes-dashboard-deployment.yaml") {
+		t.Errorf("expected the manifest to be written to the 3 masters, got %v", runner.commands)
+	}
+	cs, _ = loadDeployment(t, dir)
+	if !cs.Properties.OrchestratorProfile.KubernetesConfig.IsDashboardEnabled() {
+		t.Errorf("expected the dashboard to be enabled in apimodel.json")
+	}
+}
+
+func TestDisableAddonSecretsKeyvault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatalf("unable to create the deployment directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	cs, apiVersion := loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	cs.Location = "westus2"
+	cs.Properties.SecretsKeyvault = &api.SecretsKeyvault{VaultID: "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv"}
+	if _, err = Generate(context.Background(), GenerateOptions{ContainerService: cs, APIVersion: apiVersion, OutputDirectory: dir, Client: &armhelpers.MockACSEngineClient{}}); err != nil {
+		t.Fatalf("unexpected error generating the artifacts: %s", err)
+	}
+
+	if _, err = DisableAddon(context.Background(), addonsOptions(t, dir, &armhelpers.MockKubernetesClient{}, &fakeNodeRunner{}), api.DefaultDashboardAddonName); err != nil {
+		t.Fatalf("unexpected error disabling the addon: %s", err)
+	}
+	for _, artifact := range []string{"ca.key", "apiserver.key", "kubeconfig"} {
+		if _, err = os.Stat(path.Join(dir, artifact)); !os.IsNotExist(err) {
+			t.Errorf("expected no %s in the deployment directory of a cluster with a secrets Key Vault", artifact)
+		}
+	}
+}
+
+func TestUpdateAddon(t *testing.T) {
+	dir := generateDeployment(t)
+	defer os.RemoveAll(dir)
+	client := &armhelpers.MockKubernetesClient{}
+
+	change := AddonChange{
+		Name:       api.DefaultDashboardAddonName,
+		Containers: []api.KubernetesContainerSpec{{Name: api.DefaultDashboardAddonName, Image: "example.com/dashboard:v2", CPULimits: "500m"}},
+	}
+	if _, err := UpdateAddon(context.Background(), addonsOptions(t, dir, client, &fakeNodeRunner{}), change); err != nil {
+		t.Fatalf("unexpected error updating the addon: %s", err)
+	}
+	cs, _ := loadDeployment(t, dir)
+	addon := cs.Properties.OrchestratorProfile.KubernetesConfig.GetAddonByName(api.DefaultDashboardAddonName)
+	c := addon.Containers[0]
+	if c.Image != "example.com/dashboard:v2" || c.CPULimits != "500m" || c.CPURequests != "300m" {
+		t.Errorf("expected the container to be merged into the apimodel, got %+v", c)
+	}
+
+	statuses, err := AddonsStatus(context.Background(), addonsOptions(t, dir, client, nil))
+	if err != nil {
+		t.Fatalf("unexpected error getting the status of the addons: %s", err)
+	}
+	for _, status := range statuses {
+		if status.Name == api.DefaultDashboardAddonName && (!status.Enabled || !status.Deployed || len(status.Drift) != 0) {
+			t.Errorf("expected the updated dashboard to be deployed without drift, got %+v", status)
+		}
+	}
+
+	// the image of the deployment is changed by hand
+	deployed := client.Objects[dashboardDeployment].DeepCopy()
+	containers := deployed.Object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
+	containers[0].(map[string]interface{})["image"] = "example.com/dashboard:v1"
+	client.Objects[dashboardDeployment] = deployed
+	statuses, err = AddonsStatus(context.Background(), addonsOptions(t, dir, client, nil))
+	if err != nil {
+		t.Fatalf("unexpected error getting the status of the addons: %s", err)
+	}
+	for _, status := range statuses {
+		switch status.Name {
+		case api.DefaultDashboardAddonName:
+			expected := "Deployment kube-system/kubernetes-dashboard container kubernetes-dashboard: image is example.com/dashboard:v1, the apimodel has example.com/dashboard:v2"
+			if len(status.Drift) != 1 || status.Drift[0] != expected {
+				t.Errorf("expected the image to drift, got %v", status.Drift)
+			}
+		case api.DefaultClusterAutoscalerAddonName:
+			if status.Enabled || status.Deployed || len(status.Drift) != 0 {
+				t.Errorf("expected the disabled cluster-autoscaler not to drift, got %+v", status)
+			}
+		}
+	}
+}
+
+func TestChartAddon(t *testing.T) {
+	dir := generateDeployment(t)
+	defer os.RemoveAll(dir)
+	chartPath := path.Join(dir, "my-chart.tgz")
+	if err := ioutil.WriteFile(chartPath, []byte("packaged chart"), 0644); err != nil {
+		t.Fatalf("unable to write the packaged chart: %s", err)
+	}
+	client := &armhelpers.MockKubernetesClient{}
+	jobs := func() []string {
+		var names []string
+		for key := range client.Objects {
+			if strings.HasPrefix(key, "Job/kube-system/my-chart-chart-") {
+				names = append(names, key)
+			}
+		}
+		return names
+	}
+
+	o := addonsOptions(t, dir, client, &fakeNodeRunner{})
+	k := o.ContainerService.Properties.OrchestratorProfile.KubernetesConfig
+	k.Addons = append(k.Addons, api.KubernetesAddon{Name: "my-chart", Enabled: helpers.PointerToBool(false), Chart: &api.HelmChart{Path: chartPath}})
+	runner := &fakeNodeRunner{}
+	o.Runner = runner
+	if _, err := EnableAddon(context.Background(), o, "my-chart"); err != nil {
+		t.Fatalf("unexpected error enabling the chart addon: %s", err)
+	}
+	if len(runner.commands) != 6 || runner.commands[0] != "master 0: sudo mkdir -p /etc/kubernetes/charts && sudo tee /etc/kubernetes/charts/my-chart.tgz >/dev/null" ||
+		runner.inputs[0] != "packaged chart" || runner.commands[1] != "master 0: sudo tee /etc/kubernetes/addons/my-chart-chart.yaml >/dev/null" {
+		t.Errorf("expected the packaged chart and the job to be written to the 3 masters, got %v", runner.commands)
+	}
+	enabled := jobs()
+	if len(enabled) != 1 {
+		t.Fatalf("expected the job installing the chart to be created, got %v", enabled)
+	}
+
+	change := AddonChange{Name: "my-chart", Config: map[string]string{"replicaCount": "2"}}
+	result, err := UpdateAddon(context.Background(), addonsOptions(t, dir, client, &fakeNodeRunner{}), change)
+	if err != nil {
+		t.Fatalf("unexpected error updating the chart addon: %s", err)
+	}
+	updated := jobs()
+	if len(updated) != 1 || updated[0] == enabled[0] || len(result.Applied) != 1 || len(result.Deleted) != 1 {
+		t.Errorf("expected the job to be replaced by a job with the new values, got %+v", result)
+	}
+	cs, _ := loadDeployment(t, dir)
+	if addon := cs.Properties.OrchestratorProfile.KubernetesConfig.GetAddonByName("my-chart"); addon.Config["replicaCount"] != "2" {
+		t.Errorf("expected the values to be merged into the apimodel, got %v", addon.Config)
+	}
+
+	change = AddonChange{Name: "my-chart", Containers: []api.KubernetesContainerSpec{{Name: "my-chart", Image: "example.com/my-chart:v2"}}}
+	if _, err = UpdateAddon(context.Background(), addonsOptions(t, dir, client, &fakeNodeRunner{}), change); err == nil {
+		t.Errorf("expected an error changing the containers of a chart addon")
+	} else if _, ok := err.(*ValidationError); !ok {
+		t.Errorf("expected a validation error changing the containers of a chart addon, got %v", err)
+	}
+
+	runner = &fakeNodeRunner{}
+	if _, err = DisableAddon(context.Background(), addonsOptions(t, dir, client, runner), "my-chart"); err != nil {
+		t.Fatalf("unexpected error disabling the chart addon: %s", err)
+	}
+	if len(runner.commands) != 3 || runner.commands[0] != "master 0: sudo rm -f /etc/kubernetes/addons/my-chart-chart.yaml /etc/kubernetes/charts/my-chart.tgz" {
+		t.Errorf("expected the job and the packaged chart to be removed from the 3 masters, got %v", runner.commands)
+	}
+	if len(jobs()) != 0 {
+		t.Errorf("expected the job installing the chart to be deleted, got %v", jobs())
+	}
+}
+
+func TestAddonsStatusDisabledDeployed(t *testing.T) {
+	dir := generateDeployment(t)
+	defer os.RemoveAll(dir)
+	client := &armhelpers.MockKubernetesClient{}
+	if _, err := EnableAddon(context.Background(), addonsOptions(t, dir, client, &fakeNodeRunner{}), api.DefaultDashboardAddonName); err != nil {
+		t.Fatalf("unexpected error enabling the addon: %s", err)
+	}
+	// the apimodel is changed without rolling out the change
+	if err := os.Rename(path.Join(dir, "apimodel.json.bak"), path.Join(dir, "apimodel.json")); err != nil {
+		t.Fatalf("unable to restore the apimodel: %s", err)
+	}
+	o := addonsOptions(t, dir, client, nil)
+	o.ContainerService.Properties.OrchestratorProfile.KubernetesConfig.Addons = []api.KubernetesAddon{
+		{Name: api.DefaultDashboardAddonName, Enabled: helpers.PointerToBool(false)},
+	}
+	statuses, err := AddonsStatus(context.Background(), o)
+	if err != nil {
+		t.Fatalf("unexpected error getting the status of the addons: %s", err)
+	}
+	for _, status := range statuses {
+		if status.Name == api.DefaultDashboardAddonName && (status.Enabled || !status.Deployed || !containsString(status.Drift, "deployed but disabled in the apimodel")) {
+			t.Errorf("expected the disabled dashboard to be reported as deployed, got %+v", status)
+		}
+	}
+}
+
+func TestEnableAddonProvisioningPlaceholders(t *testing.T) {
+	dir := generateDeployment(t)
+	defer os.RemoveAll(dir)
+	client := &armhelpers.MockKubernetesClient{}
+
+	runner := &fakeNodeRunner{outputs: map[string]string{
+		azureConfigCommand: `{"cloud": "AzurePublicCloud", "tenantId": "tenant", "subscriptionId": "subscription", "aadClientId": "client", "aadClientSecret": "secret", ` +
+			`"resourceGroup": "rg1", "vmType": "vmss", "primaryScaleSetName": "k8s-agentpool1-12345678-vmss"}`,
+	}}
+	o := addonsOptions(t, dir, client, runner)
+	for _, pool := range o.ContainerService.Properties.AgentPoolProfiles {
+		pool.AvailabilityProfile = api.VirtualMachineScaleSets
+	}
+	if _, err := EnableAddon(context.Background(), o, api.DefaultClusterAutoscalerAddonName); err != nil {
+		t.Fatalf("unexpected error enabling the addon: %s", err)
+	}
+	placeholder := regexp.MustCompile(`<[A-Za-z]+>`)
+	for key, obj := range client.Objects {
+		b, err := json.Marshal(obj.Object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := placeholder.Find(b); p != nil {
+			t.Errorf("expected no placeholder in %s, got %s", key, p)
+		}
+	}
+	secret := client.Objects["Secret/kube-system/cluster-autoscaler-azure"]
+	if secret == nil {
+		t.Fatalf("expected the secret of the cluster-autoscaler to be applied, got %v", client.Objects)
+	}
+	clientSecret := base64.StdEncoding.EncodeToString([]byte("secret"))
+	if fieldString(secret.Object, "data", "ClientSecret") != clientSecret {
+		t.Errorf("expected the client secret of the cloud provider configuration, got %s", fieldString(secret.Object, "data", "ClientSecret"))
+	}
+	for i, command := range runner.commands {
+		if strings.Contains(command, "secret") || strings.Contains(command, clientSecret) {
+			t.Errorf("expected the manifest to be written from the standard input, got %s", command)
+		}
+		if !strings.Contains(runner.inputs[i], "kind: Deployment") {
+			t.Errorf("expected the manifest in the standard input of %s", command)
+		}
+		if p := placeholder.FindString(runner.inputs[i]); p != "" {
+			t.Errorf("expected no placeholder in the manifest written to the masters, got %s", p)
+		}
+	}
+
+	if _, err := EnableAddon(context.Background(), addonsOptions(t, dir, client, &fakeNodeRunner{}), api.DefaultACIConnectorAddonName); err == nil {
+		t.Errorf("expected an error enabling aci-connector")
+	} else if _, ok := err.(*ValidationError); !ok {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+}
+
+func TestDisableAddonSharedNamespace(t *testing.T) {
+	dir := generateDeployment(t)
+	defer os.RemoveAll(dir)
+	client := &armhelpers.MockKubernetesClient{}
+
+	for _, name := range []string{api.DefaultBlobfuseFlexVolumeAddonName, api.DefaultSMBFlexVolumeAddonName} {
+		if _, err := EnableAddon(context.Background(), addonsOptions(t, dir, client, &fakeNodeRunner{}), name); err != nil {
+			t.Fatalf("unexpected error enabling addon %s: %s", name, err)
+		}
+	}
+	result, err := DisableAddon(context.Background(), addonsOptions(t, dir, client, &fakeNodeRunner{}), api.DefaultSMBFlexVolumeAddonName)
+	if err != nil {
+		t.Fatalf("unexpected error disabling the addon: %s", err)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0] != "DaemonSet flex/smb-flexvol-installer" {
+		t.Errorf("expected only the DaemonSet of smb-flexvolume to be deleted, got %v", result.Deleted)
+	}
+	for _, key := range []string{"Namespace//flex", "DaemonSet/flex/blobfuse-flexvol-installer"} {
+		if client.Objects[key] == nil {
+			t.Errorf("expected %s to be kept, got %v", key, client.Objects)
+		}
+	}
+
+	statuses, err := AddonsStatus(context.Background(), addonsOptions(t, dir, client, nil))
+	if err != nil {
+		t.Fatalf("unexpected error getting the status of the addons: %s", err)
+	}
+	for _, status := range statuses {
+		if status.Name == api.DefaultSMBFlexVolumeAddonName && (status.Deployed || len(status.Drift) != 0) {
+			t.Errorf("expected the namespace left by smb-flexvolume not to be drift, got %+v", status)
+		}
+	}
+}
+
+func TestDeletable(t *testing.T) {
+	objects, err := parseManifest("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: ns\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n  namespace: ns\n  labels:\n    addonmanager.kubernetes.io/mode: EnsureExists\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm2\n  namespace: ns\n  labels:\n    addonmanager.kubernetes.io/mode: Reconcile\n")
+	if err != nil {
+		t.Fatalf("unexpected error parsing the manifest: %s", err)
+	}
+	for i, expected := range []bool{false, false, true} {
+		if deletable(objects[i]) != expected {
+			t.Errorf("expected deletable(%s) to be %v", objectName(objects[i]), expected)
+		}
+	}
+}
+
+func TestChangeAddonErrors(t *testing.T) {
+	dir := generateDeployment(t)
+	defer os.RemoveAll(dir)
+
+	_, err := EnableAddon(context.Background(), addonsOptions(t, dir, &armhelpers.MockKubernetesClient{}, &fakeNodeRunner{}), "not-an-addon")
+	if _, ok := err.(*ValidationError); !ok {
+		t.Errorf("expected a validation error for an unknown addon, got %v", err)
+	}
+
+	o := addonsOptions(t, dir, &armhelpers.MockKubernetesClient{}, nil)
+	if _, err = EnableAddon(context.Background(), o, api.DefaultDashboardAddonName); err == nil || !strings.Contains(err.Error(), "SSH private key") {
+		t.Errorf("expected an error without an SSH private key, got %v", err)
+	}
+
+	o = addonsOptions(t, dir, &armhelpers.MockKubernetesClient{FailApplyObject: true}, &fakeNodeRunner{})
+	if _, err = EnableAddon(context.Background(), o, api.DefaultDashboardAddonName); err == nil || errors.Cause(err).Error() != "ApplyObject failed" {
+		t.Errorf("expected the error applying the objects, got %v", err)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	objects, err := parseManifest("---\n# comment\n---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: ns\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n  namespace: ns\n")
+	if err != nil {
+		t.Fatalf("unexpected error parsing the manifest: %s", err)
+	}
+	if len(objects) != 2 || objectName(objects[0]) != "Namespace ns" || objectName(objects[1]) != "ConfigMap ns/cm" {
+		t.Errorf("expected a namespace and a config map, got %v", objects)
+	}
+	if _, err = parseManifest("apiVersion: v1\nmetadata:\n  name: ns\n"); err == nil {
+		t.Errorf("expected an error for an object without a kind")
+	}
+}
+
+func TestSameQuantity(t *testing.T) {
+	cases := []struct {
+		a, b string
+		same bool
+	}{
+		{"1", "1000m", true},
+		{"1Gi", "1024Mi", true},
+		{"100m", "200m", false},
+		{"", "100m", false},
+		{"", "", true},
+	}
+	for _, c := range cases {
+		if sameQuantity(c.a, c.b) != c.same {
+			t.Errorf("expected sameQuantity(%q, %q) to be %v", c.a, c.b, c.same)
+		}
+	}
+}
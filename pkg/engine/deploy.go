@@ -0,0 +1,72 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DeployOptions are the options of Deploy
+type DeployOptions struct {
+	Client armhelpers.ACSEngineClient
+	Logger *logrus.Entry
+	// ResourceGroup is the resource group to deploy to; it must exist
+	ResourceGroup string
+	// DeploymentName is the name of the ARM deployment; a random name is used when empty
+	DeploymentName string
+	// Template and Parameters are the template and the parameter values returned by Generate
+	Template   string
+	Parameters string
+}
+
+// DeployResult is the result of Deploy
+type DeployResult struct {
+	DeploymentName string
+}
+
+// Deploy deploys a template and waits for the deployment to complete. When the deployment
+// fails the error is an *armhelpers.DeploymentError describing its failed operations.
+func Deploy(ctx context.Context, o DeployOptions) (*DeployResult, error) {
+	templateJSON := make(map[string]interface{})
+	parametersJSON := make(map[string]interface{})
+
+	if err := json.Unmarshal([]byte(o.Template), &templateJSON); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling template")
+	}
+	if err := json.Unmarshal([]byte(o.Parameters), &parametersJSON); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling parameters")
+	}
+
+	result := &DeployResult{DeploymentName: o.DeploymentName}
+	if result.DeploymentName == "" {
+		result.DeploymentName = randomDeploymentName(o.ResourceGroup)
+	}
+	return result, deploy(ctx, o.Client, loggerOrDefault(o.Logger), o.ResourceGroup, result.DeploymentName, templateJSON, parametersJSON)
+}
+
+func deploy(ctx context.Context, client armhelpers.ACSEngineClient, logger *logrus.Entry, resourceGroup, deploymentName string, template, parameters map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	return armhelpers.DeployTemplateSyncContext(ctx, client, logger, resourceGroup, deploymentName, template, parameters)
+}
+
+func randomDeploymentName(resourceGroup string) string {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return fmt.Sprintf("%s-%d", resourceGroup, random.Int31())
+}
+
+func loggerOrDefault(logger *logrus.Entry) *logrus.Entry {
+	if logger == nil {
+		return logrus.NewEntry(logrus.StandardLogger())
+	}
+	return logger
+}
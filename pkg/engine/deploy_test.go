@@ -0,0 +1,44 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+)
+
+func TestDeploy(t *testing.T) {
+	cs, _ := loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	generated, err := Generate(context.Background(), GenerateOptions{ContainerService: cs})
+	if err != nil {
+		t.Fatalf("unexpected error generating the template: %s", err)
+	}
+
+	o := DeployOptions{
+		Client:        &armhelpers.MockACSEngineClient{},
+		ResourceGroup: "rg1",
+		Template:      generated.Template,
+		Parameters:    generated.Parameters,
+	}
+	result, err := Deploy(context.Background(), o)
+	if err != nil {
+		t.Fatalf("unexpected error deploying the template: %s", err)
+	}
+	if !strings.HasPrefix(result.DeploymentName, "rg1-") {
+		t.Fatalf("expected a random deployment name in the resource group, got %s", result.DeploymentName)
+	}
+
+	o.Client = &armhelpers.MockACSEngineClient{FailDeployTemplateQuota: true}
+	o.DeploymentName = "contoso"
+	result, err = Deploy(context.Background(), o)
+	if _, ok := err.(*armhelpers.DeploymentError); !ok {
+		t.Fatalf("expected a deployment error, got %v", err)
+	}
+	if result.DeploymentName != "contoso" {
+		t.Fatalf("expected the deployment name to be contoso, got %s", result.DeploymentName)
+	}
+}
@@ -0,0 +1,10 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+// Package engine is the Go API of acs-engine. It generates the templates of a cluster,
+// deploys them, and scales, upgrades and drains the nodes of deployed clusters.
+//
+// The functions of the package take a context and an options struct, never exit the
+// process, and return errors for the caller to handle. The acs-engine commands are
+// thin wrappers over them that read their options from flags and files.
+package engine
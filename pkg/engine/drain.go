@@ -0,0 +1,76 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/operations"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultDrainTimeout is how long Drain waits for a node to drain when DrainOptions.Timeout is 0
+const DefaultDrainTimeout = 60 * time.Minute
+
+// DrainOptions are the options of Drain
+type DrainOptions struct {
+	Client armhelpers.ACSEngineClient
+	Logger *logrus.Entry
+	// MasterURL is the URL of the API server; https:// is prepended when it has no scheme
+	MasterURL  string
+	KubeConfig string
+	NodeNames  []string
+	// Timeout is how long to wait for each node to drain
+	Timeout time.Duration
+}
+
+// Drain cordons and drains nodes in parallel. The error of a node that fails to drain
+// wraps an *operations.DrainError.
+func Drain(ctx context.Context, o DrainOptions) error {
+	logger := loggerOrDefault(o.Logger)
+	masterURL := masterURL(o.MasterURL)
+	timeout := o.Timeout
+	if timeout == 0 {
+		timeout = DefaultDrainTimeout
+	}
+
+	// buffered so that the drains still running when ctx is done do not block
+	errChan := make(chan *operations.VMScalingErrorDetails, len(o.NodeNames))
+	for _, nodeName := range o.NodeNames {
+		go func(nodeName string) {
+			err := operations.SafelyDrainNode(o.Client, logger, masterURL, o.KubeConfig, nodeName, timeout)
+			if err != nil {
+				logger.Errorf("Failed to drain node %s, got error %v", nodeName, err)
+				errChan <- &operations.VMScalingErrorDetails{Error: err, Name: nodeName}
+				return
+			}
+			errChan <- nil
+		}(nodeName)
+	}
+
+	for range o.NodeNames {
+		select {
+		case errDetails := <-errChan:
+			if errDetails != nil {
+				return errors.Wrapf(errDetails.Error, "Node %q failed to drain with error", errDetails.Name)
+			}
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "nodes did not drain")
+		}
+	}
+	return nil
+}
+
+// masterURL prepends https:// to the FQDN of the API server when it has no scheme
+func masterURL(fqdn string) string {
+	if !strings.HasPrefix(fqdn, "https://") {
+		return fmt.Sprintf("https://%s", fqdn)
+	}
+	return fqdn
+}
@@ -0,0 +1,35 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/operations"
+	"github.com/pkg/errors"
+)
+
+func TestDrain(t *testing.T) {
+	o := DrainOptions{
+		Client:     &armhelpers.MockACSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}},
+		MasterURL:  "contoso.westus2.cloudapp.azure.com",
+		KubeConfig: "kubeConfig",
+		NodeNames:  []string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-1"},
+	}
+	if err := Drain(context.Background(), o); err != nil {
+		t.Fatalf("unexpected error draining nodes: %s", err)
+	}
+
+	o.Client = &armhelpers.MockACSEngineClient{FailGetKubernetesClient: true}
+	err := Drain(context.Background(), o)
+	drainErr, ok := errors.Cause(err).(*operations.DrainError)
+	if !ok {
+		t.Fatalf("expected a drain error, got %v", err)
+	}
+	if drainErr.NodeName != "k8s-agentpool1-12345678-0" && drainErr.NodeName != "k8s-agentpool1-12345678-1" {
+		t.Fatalf("unexpected node in the drain error: %s", drainErr.NodeName)
+	}
+}
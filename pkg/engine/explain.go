@@ -0,0 +1,169 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Azure/acs-engine/pkg/acsengine/transform"
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/pkg/errors"
+)
+
+// DefaultsFileName is the name of the artifact listing the defaulted fields of the apimodel
+const DefaultsFileName = "apimodel-defaults.txt"
+
+const redactedValue = "<redacted>"
+
+// secretPathRegex matches the paths of the defaulted fields whose values are not listed
+var secretPathRegex = regexp.MustCompile(`(?i)(certificateProfile|privatekey|secret|password|encryptionkey)`)
+
+// DefaultedField is a field of an apimodel set by SetPropertiesDefaults rather than by the user
+type DefaultedField struct {
+	// Path is the JSON path of the field, such as properties.masterProfile.vmSize
+	Path string `json:"path"`
+	// Value is the value chosen by acs-engine; nil when the field was removed
+	Value interface{} `json:"value,omitempty"`
+	// PreviousValue is the value written by the user and replaced by acs-engine, if any
+	PreviousValue interface{} `json:"previousValue,omitempty"`
+	// Rule is the function that chose the value, such as setKubeletConfig
+	Rule string `json:"rule"`
+	// Because lists the values of the fields the rule depends on, such as networkPlugin=azure
+	Because string `json:"because,omitempty"`
+}
+
+// String returns the field as path=value from rule because inputs
+func (f DefaultedField) String() string {
+	s := fmt.Sprintf("%s=%s from %s", f.Path, formatDefaultedValue(f.Value), f.Rule)
+	if f.PreviousValue != nil {
+		s = fmt.Sprintf("%s=%s (was %s) from %s", f.Path, formatDefaultedValue(f.Value), formatDefaultedValue(f.PreviousValue), f.Rule)
+	}
+	if f.Because != "" {
+		s += " because " + f.Because
+	}
+	return s
+}
+
+// explainDefaults attributes every field changed between two steps recorded by
+// SetPropertiesDefaults to the rule of the later step. A field changed by several
+// rules is attributed to the last one.
+func explainDefaults(steps []api.DefaultsStep) ([]DefaultedField, error) {
+	fields := map[string]*DefaultedField{}
+	var previous interface{}
+	for i, step := range steps {
+		var properties interface{}
+		if err := json.Unmarshal(step.Properties, &properties); err != nil {
+			return nil, errors.Wrapf(err, "error decoding the properties set by %s", step.Rule)
+		}
+		current := map[string]interface{}{"properties": properties}
+		if i == 0 {
+			previous = current
+			continue
+		}
+		for _, c := range transform.DiffJSON(previous, current) {
+			for _, leaf := range leafChanges(c) {
+				field, ok := fields[leaf.Path]
+				if !ok {
+					field = &DefaultedField{Path: leaf.Path}
+					if !isZeroJSON(leaf.OldValue) {
+						field.PreviousValue = leaf.OldValue
+					}
+					fields[leaf.Path] = field
+				}
+				if leaf.Change == transform.ChangeTypeRemoved && field.PreviousValue == nil {
+					// added by a rule and removed by a later one
+					delete(fields, leaf.Path)
+					continue
+				}
+				field.Value = leaf.NewValue
+				field.Rule = step.Rule
+				field.Because = step.Because
+			}
+		}
+		previous = current
+	}
+
+	ret := []DefaultedField{}
+	for _, field := range fields {
+		if secretPathRegex.MatchString(field.Path) {
+			if field.Value != nil {
+				field.Value = redactedValue
+			}
+			if field.PreviousValue != nil {
+				field.PreviousValue = redactedValue
+			}
+		}
+		ret = append(ret, *field)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Path < ret[j].Path
+	})
+	return ret, nil
+}
+
+// leafChanges splits a change of a map or an array into a change per value it holds
+func leafChanges(c transform.PropertyChange) []transform.PropertyChange {
+	var value interface{}
+	switch c.Change {
+	case transform.ChangeTypeAdded:
+		value = c.NewValue
+	case transform.ChangeTypeRemoved:
+		value = c.OldValue
+	default:
+		return []transform.PropertyChange{c}
+	}
+
+	var children []transform.PropertyChange
+	switch v := value.(type) {
+	case map[string]interface{}:
+		children = transform.DiffJSON(map[string]interface{}{}, v)
+	case []interface{}:
+		children = transform.DiffJSON([]interface{}{}, v)
+	default:
+		return []transform.PropertyChange{c}
+	}
+
+	leaves := []transform.PropertyChange{}
+	for _, child := range children {
+		if strings.HasPrefix(child.Path, "[") {
+			child.Path = c.Path + child.Path
+		} else {
+			child.Path = c.Path + "." + child.Path
+		}
+		if c.Change == transform.ChangeTypeRemoved {
+			child.Change, child.OldValue, child.NewValue = c.Change, child.NewValue, nil
+		}
+		leaves = append(leaves, leafChanges(child)...)
+	}
+	return leaves
+}
+
+// formatDefaults returns the defaulted fields, one per line, under a header telling
+// which version of acs-engine chose them
+func formatDefaults(fields []DefaultedField, buildTag string) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Fields of the apimodel defaulted by acs-engine %s\n", buildTag)
+	fmt.Fprintf(&b, "# path=value from rule because inputs of the rule\n")
+	for _, field := range fields {
+		fmt.Fprintln(&b, field.String())
+	}
+	return b.String()
+}
+
+// formatDefaultedValue formats strings as they are and other values as JSON
+func formatDefaultedValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
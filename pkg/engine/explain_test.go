@@ -0,0 +1,87 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/api"
+)
+
+func TestExplainDefaults(t *testing.T) {
+	steps := []api.DefaultsStep{
+		{Properties: []byte(`{"masterProfile": {"count": 1, "subnet": ""}, "kubeletConfig": {"--max-pods": "110"}}`)},
+		{Rule: "setMasterProfileDefaults", Because: "orchestratorType=Kubernetes", Properties: []byte(
+			`{"masterProfile": {"count": 1, "subnet": "10.240.0.0/16", "vmSize": "Standard_D2_v2"}, "kubeletConfig": {"--max-pods": "110"}}`)},
+		{Rule: "setKubeletConfig", Because: "networkPlugin=azure", Properties: []byte(
+			`{"masterProfile": {"count": 1, "subnet": "10.240.0.0/16", "vmSize": "Standard_D2_v2"}, "kubeletConfig": {"--max-pods": "30", "--cluster-domain": "cluster.local"},
+			"certificateProfile": {"caPrivateKey": "secret"}}`)},
+		{Rule: "setStorageDefaults", Properties: []byte(
+			`{"masterProfile": {"count": 1, "subnet": "10.240.0.0/16", "vmSize": "Standard_D4_v2"}, "kubeletConfig": {"--max-pods": "30"},
+			"certificateProfile": {"caPrivateKey": "secret"}}`)},
+	}
+
+	fields, err := explainDefaults(steps)
+	if err != nil {
+		t.Fatalf("unexpected error explaining defaults: %s", err)
+	}
+	expected := []DefaultedField{
+		{Path: "properties.certificateProfile.caPrivateKey", Value: redactedValue, Rule: "setKubeletConfig", Because: "networkPlugin=azure"},
+		{Path: `properties.kubeletConfig["--max-pods"]`, Value: "30", PreviousValue: "110", Rule: "setKubeletConfig", Because: "networkPlugin=azure"},
+		{Path: "properties.masterProfile.subnet", Value: "10.240.0.0/16", Rule: "setMasterProfileDefaults", Because: "orchestratorType=Kubernetes"},
+		{Path: "properties.masterProfile.vmSize", Value: "Standard_D4_v2", Rule: "setStorageDefaults"},
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("expected defaulted fields %v, got %v", expected, fields)
+	}
+
+	line := `properties.kubeletConfig["--max-pods"]=30 (was 110) from setKubeletConfig because networkPlugin=azure`
+	if fields[1].String() != line {
+		t.Errorf("expected %q, got %q", line, fields[1].String())
+	}
+}
+
+func TestGenerateExplainDefaults(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatalf("unable to create the output directory: %s", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	cs, apiVersion := loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	result, err := Generate(context.Background(), GenerateOptions{
+		ContainerService: cs,
+		APIVersion:       apiVersion,
+		OutputDirectory:  outputDirectory,
+		BuildTag:         "v0.0.0-test",
+		ExplainDefaults:  true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error generating the artifacts: %s", err)
+	}
+	if len(result.Defaults) == 0 {
+		t.Fatalf("expected the defaulted fields in the result")
+	}
+
+	b, err := ioutil.ReadFile(path.Join(outputDirectory, DefaultsFileName))
+	if err != nil {
+		t.Fatalf("expected %s to be written: %s", DefaultsFileName, err)
+	}
+	defaults := string(b)
+	for _, s := range []string{
+		"# Fields of the apimodel defaulted by acs-engine v0.0.0-test\n",
+		"properties.orchestratorProfile.kubernetesConfig.kubeletConfig[\"--max-pods\"]=30 from setKubeletConfig because ",
+		"properties.masterProfile.distro=aks from setMasterProfileDefaults because orchestratorType=Kubernetes",
+	} {
+		if !strings.Contains(defaults, s) {
+			t.Errorf("expected %s to contain %q", DefaultsFileName, s)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"sort"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/pkg/errors"
+)
+
+// SealKeySize is the size in bytes of the keys secrets are sealed with
+const SealKeySize = 32
+
+// ExportOptions are the options of Export
+type ExportOptions struct {
+	// APIModel is the content of the apimodel to export
+	APIModel []byte
+	// APIVersion is the API version the apimodel is exported in; empty keeps its version
+	APIVersion string
+	// Redact replaces the secrets of the apimodel with placeholders
+	Redact bool
+	// SealKey is the key, generated by GenerateSealKey, the redacted secrets are sealed with
+	// and the secrets to restore are opened with. The redacted secrets are dropped when nil.
+	SealKey []byte
+	// Sealed are secrets sealed by an earlier Export, restored in place of the placeholders of the apimodel
+	Sealed []byte
+	// Translator translates messages; nil does not translate them
+	Translator *i18n.Translator
+}
+
+// ExportResult is the result of Export
+type ExportResult struct {
+	// APIModel is the exported apimodel
+	APIModel []byte
+	// SourceAPIVersion is the API version of the apimodel before the export
+	SourceAPIVersion string
+	// RedactedFields are the paths of the fields replaced by placeholders, sorted
+	RedactedFields []string
+	// RestoredFields are the paths of the fields restored from the sealed secrets, sorted
+	RestoredFields []string
+	// Sealed are the redacted secrets sealed with the seal key; nil without a seal key
+	Sealed []byte
+}
+
+// sealedSecrets is the document the redacted secrets are sealed in
+type sealedSecrets struct {
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Export serializes an apimodel in an API version, replacing with placeholders the fields of
+// the api types tagged with conform:"redact", such as the certificates, the service principal
+// secret and the Windows admin password, and the private keys pasted in other fields. The
+// redacted secrets can be sealed with a key and restored by a later Export.
+func Export(ctx context.Context, o ExportOptions) (*ExportResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if o.Redact && o.Sealed != nil {
+		return nil, &ValidationError{Err: errors.New("an apimodel cannot be redacted and restored at once")}
+	}
+	if o.Sealed != nil && o.SealKey == nil {
+		return nil, &ValidationError{Err: errors.New("a seal key is required to restore the sealed secrets")}
+	}
+	if o.SealKey != nil && len(o.SealKey) != SealKeySize {
+		return nil, &ValidationError{Err: errors.Errorf("the seal key must be %d bytes long, not %d", SealKeySize, len(o.SealKey))}
+	}
+	apiloader := &api.Apiloader{Translator: translatorOrDefault(o.Translator)}
+
+	cs, sourceVersion, err := apiloader.DeserializeContainerService(o.APIModel, false, false, nil)
+	if err != nil {
+		return nil, &ValidationError{Err: errors.Wrap(err, "error parsing the api model")}
+	}
+	version := o.APIVersion
+	if version == "" {
+		version = sourceVersion
+	}
+
+	result := &ExportResult{SourceAPIVersion: sourceVersion}
+	if o.Redact {
+		secrets := cs.Redact()
+		for path := range secrets {
+			result.RedactedFields = append(result.RedactedFields, path)
+		}
+		sort.Strings(result.RedactedFields)
+		if o.SealKey != nil {
+			if result.Sealed, err = sealSecrets(o.SealKey, secrets); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if o.Sealed != nil {
+		secrets, err := openSecrets(o.SealKey, o.Sealed)
+		if err != nil {
+			return nil, &ValidationError{Err: err}
+		}
+		if result.RestoredFields, err = cs.RestoreSecrets(secrets); err != nil {
+			return nil, &ValidationError{Err: err}
+		}
+	}
+
+	if result.APIModel, err = apiloader.SerializeContainerService(cs, version); err != nil {
+		return nil, &ValidationError{Err: errors.Wrapf(err, "error serializing the api model in version %s", version)}
+	}
+	return result, nil
+}
+
+// GenerateSealKey returns a random key to seal the redacted secrets of Export with
+func GenerateSealKey() ([]byte, error) {
+	key := make([]byte, SealKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.Wrap(err, "error generating the seal key")
+	}
+	return key, nil
+}
+
+// sealSecrets encrypts secrets with AES-GCM
+func sealSecrets(key []byte, secrets map[string]string) ([]byte, error) {
+	gcm, err := newSealCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding the secrets")
+	}
+	s := sealedSecrets{Nonce: make([]byte, gcm.NonceSize())}
+	if _, err := rand.Read(s.Nonce); err != nil {
+		return nil, errors.Wrap(err, "error generating the nonce")
+	}
+	s.Ciphertext = gcm.Seal(nil, s.Nonce, plaintext, nil)
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// openSecrets decrypts the secrets sealed by sealSecrets
+func openSecrets(key, sealed []byte) (map[string]string, error) {
+	gcm, err := newSealCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	s := sealedSecrets{}
+	if err := json.Unmarshal(sealed, &s); err != nil {
+		return nil, errors.Wrap(err, "error decoding the sealed secrets")
+	}
+	if len(s.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("the sealed secrets have an invalid nonce")
+	}
+	plaintext, err := gcm.Open(nil, s.Nonce, s.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("the sealed secrets cannot be opened with this seal key")
+	}
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, errors.Wrap(err, "error decoding the secrets")
+	}
+	return secrets, nil
+}
+
+func newSealCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid seal key")
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,64 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/api/vlabs"
+)
+
+func TestExportRedactAndRestore(t *testing.T) {
+	apimodel, err := ioutil.ReadFile("../../examples/windows/kubernetes.json")
+	if err != nil {
+		t.Fatalf("unable to read the api model: %s", err)
+	}
+	key, err := GenerateSealKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating the seal key: %s", err)
+	}
+
+	redacted, err := Export(context.Background(), ExportOptions{APIModel: apimodel, APIVersion: "2017-07-01", Redact: true, SealKey: key})
+	if err != nil {
+		t.Fatalf("unexpected error redacting the api model: %s", err)
+	}
+	if redacted.SourceAPIVersion != vlabs.APIVersion {
+		t.Fatalf("expected source version %s, got %s", vlabs.APIVersion, redacted.SourceAPIVersion)
+	}
+	if len(redacted.RedactedFields) != 1 || redacted.RedactedFields[0] != "properties.windowsProfile.adminPassword" {
+		t.Fatalf("expected the admin password to be redacted, got %v", redacted.RedactedFields)
+	}
+	if bytes.Contains(redacted.APIModel, []byte("replacepassword1234$")) || !bytes.Contains(redacted.APIModel, []byte(api.RedactedValue)) {
+		t.Fatalf("expected the admin password to be replaced by a placeholder:\n%s", redacted.APIModel)
+	}
+	if decodeAPIModel(t, redacted.APIModel)["apiVersion"] != "2017-07-01" {
+		t.Fatalf("expected the api model in version 2017-07-01")
+	}
+
+	if _, err := Export(context.Background(), ExportOptions{APIModel: redacted.APIModel, Sealed: redacted.Sealed}); err == nil {
+		t.Fatalf("expected an error restoring without the seal key")
+	}
+	otherKey, _ := GenerateSealKey()
+	if _, err := Export(context.Background(), ExportOptions{APIModel: redacted.APIModel, SealKey: otherKey, Sealed: redacted.Sealed}); err == nil {
+		t.Fatalf("expected an error restoring with another seal key")
+	}
+	if _, err := Export(context.Background(), ExportOptions{APIModel: redacted.APIModel, Redact: true, SealKey: key, Sealed: redacted.Sealed}); err == nil {
+		t.Fatalf("expected an error redacting and restoring at once")
+	}
+
+	restored, err := Export(context.Background(), ExportOptions{APIModel: redacted.APIModel, SealKey: key, Sealed: redacted.Sealed})
+	if err != nil {
+		t.Fatalf("unexpected error restoring the api model: %s", err)
+	}
+	if len(restored.RestoredFields) != 1 || !bytes.Contains(restored.APIModel, []byte("replacepassword1234$")) {
+		t.Fatalf("expected the admin password to be restored, got %v", restored.RestoredFields)
+	}
+	if restored.SourceAPIVersion != "2017-07-01" || decodeAPIModel(t, restored.APIModel)["apiVersion"] != "2017-07-01" {
+		t.Fatalf("expected the api model to keep version 2017-07-01")
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/Azure/acs-engine/pkg/acsengine"
+	"github.com/Azure/acs-engine/pkg/acsengine/transform"
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/pkg/errors"
+)
+
+// ValidationError is returned when the options or the apimodel given to an operation are invalid
+type ValidationError struct {
+	Err error
+}
+
+// Error implements error interface
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+// AddonsDirectoryName is the directory of the output directory the manifests of the addons are
+// written to with RenderAddons
+const AddonsDirectoryName = "addons"
+
+// GenerateOptions are the options of Generate
+type GenerateOptions struct {
+	// ContainerService is the cluster to generate templates for; its defaults are set by Generate
+	ContainerService *api.ContainerService
+	// APIVersion is the version of the API the apimodel.json artifact is written in
+	APIVersion string
+	// OutputDirectory is where the artifacts are written; nothing is written when empty
+	OutputDirectory string
+	// ParametersOnly writes the parameters files only
+	ParametersOnly bool
+	// NoPrettyPrint skips pretty printing the template and the parameters
+	NoPrettyPrint bool
+	// BuildTag is the version of acs-engine recorded in the template
+	BuildTag string
+	// ExplainDefaults lists the defaulted fields of the apimodel in the result and
+	// in the apimodel-defaults.txt artifact
+	ExplainDefaults bool
+	// SecretSource supplies the certificates and keys generated for the cluster; nil
+	// generates random ones
+	SecretSource *helpers.SecretSource
+	// Translator translates messages; nil does not translate them
+	Translator *i18n.Translator
+	// Client stores the secrets of a cluster with a secrets Key Vault; it is only needed then
+	Client armhelpers.ACSEngineClient
+	// RenderAddons writes the manifests of the enabled container addons to the addons
+	// directory of the output directory, for review
+	RenderAddons bool
+}
+
+// GenerateResult is the result of Generate
+type GenerateResult struct {
+	// Template is the ARM template of the cluster
+	Template string
+	// Parameters are the values of the parameters of the template
+	Parameters string
+	// Artifacts are the paths of the files written to the output directory
+	Artifacts []string
+	// Defaults are the fields of the apimodel set by acs-engine, with ExplainDefaults
+	Defaults []DefaultedField
+	// Secrets are the references to the secrets stored in the secrets Key Vault of the cluster
+	Secrets []string
+}
+
+// Generate generates the ARM template of a cluster and, when an output directory is
+// given, writes it along with its parameters, certificates and other artifacts.
+// The secrets of a cluster with a secrets Key Vault are stored in the vault instead, and the
+// apimodel, the template and its parameters only reference them.
+func Generate(ctx context.Context, o GenerateOptions) (*GenerateResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	translator := translatorOrDefault(o.Translator)
+	if o.SecretSource != nil && o.ContainerService.Properties.OrchestratorProfile.IsOpenShift() {
+		return nil, &ValidationError{Err: errors.New("the certificates of the OpenShift configuration bundles are generated at random and cannot be derived from a seed")}
+	}
+	if o.ContainerService.Properties.SecretsKeyvault != nil {
+		if o.Client == nil {
+			return nil, &ValidationError{Err: errors.New("the apimodel has a secrets Key Vault, Azure credentials are required to store the secrets")}
+		}
+		if o.ContainerService.Location == "" {
+			return nil, &ValidationError{Err: errors.New("the location of a cluster with a secrets Key Vault is required to store its kubeconfig")}
+		}
+	}
+
+	if o.ExplainDefaults {
+		o.ContainerService.ExplainDefaults()
+	}
+	if o.SecretSource != nil {
+		o.ContainerService.SetSecretSource(o.SecretSource)
+	}
+	certsGenerated, err := o.ContainerService.SetPropertiesDefaults(false, false)
+	if err != nil {
+		return nil, &ValidationError{Err: errors.Wrap(err, "error in SetPropertiesDefaults")}
+	}
+	var defaults []DefaultedField
+	if o.ExplainDefaults {
+		if defaults, err = explainDefaults(o.ContainerService.DefaultsSteps()); err != nil {
+			return nil, err
+		}
+	}
+	var secrets []string
+	if o.ContainerService.Properties.SecretsKeyvault != nil {
+		// the stored secrets are versions the template references, so it can only be generated once
+		// they are stored; what can fail is checked first so that a failure leaves the vault unchanged
+		if _, _, err = generateTemplate(translator, o.ContainerService, o.BuildTag); err != nil {
+			return nil, err
+		}
+		if o.OutputDirectory != "" {
+			if err = os.MkdirAll(o.OutputDirectory, 0755); err != nil {
+				return nil, errors.Wrap(err, "error creating the output directory")
+			}
+		}
+		if secrets, err = storeSecrets(ctx, o.Client, o.ContainerService); err != nil {
+			return nil, err
+		}
+		// the certificates, keys and kubeconfig are in Key Vault rather than in the output directory
+		certsGenerated = false
+	}
+	template, parameters, err := generateTemplate(translator, o.ContainerService, o.BuildTag)
+	if err != nil {
+		return nil, err
+	}
+	if !o.NoPrettyPrint {
+		if template, err = transform.PrettyPrintArmTemplate(template); err != nil {
+			return nil, errors.Wrap(err, "error pretty printing template")
+		}
+	}
+	result := &GenerateResult{Template: template, Parameters: parameters, Defaults: defaults, Secrets: secrets}
+	if o.OutputDirectory == "" {
+		return result, nil
+	}
+
+	parametersFile := parameters
+	if !o.NoPrettyPrint {
+		if parametersFile, err = transform.BuildAzureParametersFile(parameters); err != nil {
+			return nil, errors.Wrap(err, "error pretty printing template parameters")
+		}
+	}
+
+	writer := &acsengine.ArtifactWriter{
+		Translator: translator,
+	}
+	if err = writer.WriteTLSArtifacts(o.ContainerService, o.APIVersion, result.Template, parametersFile, o.OutputDirectory, certsGenerated, o.ParametersOnly); err != nil {
+		return nil, errors.Wrap(err, "error writing artifacts")
+	}
+	if o.ExplainDefaults {
+		f := &helpers.FileSaver{
+			Translator: translator,
+		}
+		if err = f.SaveFileString(o.OutputDirectory, DefaultsFileName, formatDefaults(defaults, o.BuildTag)); err != nil {
+			return nil, errors.Wrap(err, "error writing the defaulted fields")
+		}
+	}
+	if o.RenderAddons && o.ContainerService.Properties.OrchestratorProfile.IsKubernetes() {
+		if err = writeAddons(translator, o.ContainerService, filepath.Join(o.OutputDirectory, AddonsDirectoryName)); err != nil {
+			return nil, err
+		}
+	}
+	if result.Artifacts, err = listArtifacts(o.OutputDirectory); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// generateTemplate generates the template and parameters of a container service whose defaults are set
+func generateTemplate(translator *i18n.Translator, cs *api.ContainerService, buildTag string) (string, string, error) {
+	templateGenerator, err := acsengine.InitializeTemplateGenerator(acsengine.Context{
+		Translator: translator,
+	})
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to initialize template generator")
+	}
+	template, parameters, err := templateGenerator.GenerateTemplate(cs, acsengine.DefaultGeneratorCode, buildTag)
+	if err != nil {
+		return "", "", errors.Wrap(err, "error generating template")
+	}
+	return template, parameters, nil
+}
+
+// writeAddons writes the manifests of the enabled container addons of a container service whose
+// defaults are set to dir
+func writeAddons(translator *i18n.Translator, cs *api.ContainerService, dir string) error {
+	manifests, err := acsengine.RenderAddons(cs)
+	if err != nil {
+		return errors.Wrap(err, "error rendering addons")
+	}
+	f := &helpers.FileSaver{
+		Translator: translator,
+	}
+	for _, m := range manifests {
+		if err := f.SaveFileString(dir, m.DestinationFile, m.Content); err != nil {
+			return errors.Wrapf(err, "error writing the manifest of addon %s", m.Name)
+		}
+	}
+	return nil
+}
+
+func translatorOrDefault(translator *i18n.Translator) *i18n.Translator {
+	if translator == nil {
+		return &i18n.Translator{}
+	}
+	return translator
+}
+
+// listArtifacts returns the paths of the files written to dir
+func listArtifacts(dir string) ([]string, error) {
+	artifacts := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			artifacts = append(artifacts, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing the artifacts in %s", dir)
+	}
+	return artifacts, nil
+}
@@ -0,0 +1,192 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/acsengine"
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/pkg/errors"
+)
+
+func loadContainerService(t *testing.T, apimodelPath string) (*api.ContainerService, string) {
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{},
+	}
+	cs, apiVersion, err := apiloader.LoadContainerServiceFromFile(apimodelPath, true, false, nil)
+	if err != nil {
+		t.Fatalf("unable to load %s: %s", apimodelPath, err)
+	}
+	return cs, apiVersion
+}
+
+func TestGenerate(t *testing.T) {
+	cs, apiVersion := loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	result, err := Generate(context.Background(), GenerateOptions{ContainerService: cs, APIVersion: apiVersion})
+	if err != nil {
+		t.Fatalf("unexpected error generating the template: %s", err)
+	}
+	if !strings.Contains(result.Template, "Microsoft.Compute/virtualMachines") || result.Parameters == "" || len(result.Artifacts) != 0 {
+		t.Fatalf("expected a template and parameters without artifacts, got %d artifacts", len(result.Artifacts))
+	}
+
+	outputDirectory, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatalf("unable to create the output directory: %s", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	cs, apiVersion = loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	result, err = Generate(context.Background(), GenerateOptions{ContainerService: cs, APIVersion: apiVersion, OutputDirectory: outputDirectory})
+	if err != nil {
+		t.Fatalf("unexpected error generating the artifacts: %s", err)
+	}
+	written := map[string]bool{}
+	for _, artifact := range result.Artifacts {
+		written[artifact] = true
+	}
+	for _, artifact := range []string{"apimodel.json", "azuredeploy.json", "azuredeploy.parameters.json"} {
+		if !written[path.Join(outputDirectory, artifact)] {
+			t.Fatalf("expected %s in the artifacts, got %v", artifact, result.Artifacts)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = Generate(ctx, GenerateOptions{ContainerService: cs}); err != context.Canceled {
+		t.Fatalf("expected Generate to return the error of a done context, got %v", err)
+	}
+}
+
+func TestGenerateRenderAddons(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatalf("unable to create the output directory: %s", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	cs, apiVersion := loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	if _, err = Generate(context.Background(), GenerateOptions{ContainerService: cs, APIVersion: apiVersion, OutputDirectory: outputDirectory, RenderAddons: true}); err != nil {
+		t.Fatalf("unexpected error generating the artifacts: %s", err)
+	}
+	b, err := ioutil.ReadFile(path.Join(outputDirectory, AddonsDirectoryName, "kube-tiller-deployment.yaml"))
+	if err != nil || !strings.Contains(string(b), "kind: Deployment") {
+		t.Fatalf("expected the rendered manifest of tiller in the addons directory, got %v", err)
+	}
+
+	cs, apiVersion = loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	cs.Properties.OrchestratorProfile.KubernetesConfig.Addons = []api.KubernetesAddon{
+		{
+			Name:       "tiller",
+			Enabled:    helpers.PointerToBool(true),
+			Containers: []api.KubernetesContainerSpec{{Name: "helm", Image: "contoso/tiller"}},
+		},
+	}
+	registry := api.NewAddonRegistry()
+	registry.Register(&api.AddonDescriptor{
+		Name:     "tiller",
+		Manifest: "image: {{ContainerImage \"tiller\"}}\n",
+	})
+	cs.SetAddonRegistry(registry)
+	_, err = Generate(context.Background(), GenerateOptions{ContainerService: cs, APIVersion: apiVersion})
+	if _, ok := errors.Cause(err).(*acsengine.AddonRenderError); !ok {
+		t.Fatalf("expected an error rendering the addon without a spec for its container, got %v", err)
+	}
+}
+
+func TestGenerateSeedOpenShift(t *testing.T) {
+	cs, apiVersion := loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	cs.Properties.OrchestratorProfile.OrchestratorType = api.OpenShift
+	source := helpers.NewSeededSecretSource("seed", "openshift", time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC))
+	_, err := Generate(context.Background(), GenerateOptions{ContainerService: cs, APIVersion: apiVersion, SecretSource: source})
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("expected a validation error generating an OpenShift cluster from a seed, got %v", err)
+	}
+}
+
+func TestGenerateSecretsKeyvault(t *testing.T) {
+	vaultID := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv"
+	cs, apiVersion := loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	cs.Location = "westus2"
+	cs.Properties.SecretsKeyvault = &api.SecretsKeyvault{VaultID: vaultID}
+	if _, err := Generate(context.Background(), GenerateOptions{ContainerService: cs, APIVersion: apiVersion}); err == nil {
+		t.Fatalf("expected an error generating a cluster with a secrets Key Vault without a client")
+	}
+
+	outputDirectory, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatalf("unable to create the output directory: %s", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	// nothing is stored when the artifacts cannot be written
+	client := &armhelpers.MockACSEngineClient{}
+	notADirectory := path.Join(outputDirectory, "file")
+	if err = ioutil.WriteFile(notADirectory, nil, 0644); err != nil {
+		t.Fatalf("unable to write %s: %s", notADirectory, err)
+	}
+	if _, err = Generate(context.Background(), GenerateOptions{ContainerService: cs, APIVersion: apiVersion, OutputDirectory: notADirectory, Client: client}); err == nil {
+		t.Fatalf("expected an error generating the artifacts to a file")
+	}
+	if len(client.KeyVaultSecrets) != 0 {
+		t.Fatalf("expected no secret to be stored when generating fails, got %v", client.KeyVaultSecrets)
+	}
+	if err = os.Remove(notADirectory); err != nil {
+		t.Fatalf("unable to remove %s: %s", notADirectory, err)
+	}
+
+	result, err := Generate(context.Background(), GenerateOptions{ContainerService: cs, APIVersion: apiVersion, OutputDirectory: outputDirectory, Client: client})
+	if err != nil {
+		t.Fatalf("unexpected error generating the artifacts: %s", err)
+	}
+	if len(result.Secrets) == 0 || len(result.Secrets) != len(client.KeyVaultSecrets) {
+		t.Fatalf("expected the stored secrets in the result, got %v", result.Secrets)
+	}
+	if _, err := os.Stat(path.Join(outputDirectory, "ca.key")); !os.IsNotExist(err) {
+		t.Fatalf("expected no ca.key in the output directory")
+	}
+	if _, err := os.Stat(path.Join(outputDirectory, "kubeconfig")); !os.IsNotExist(err) {
+		t.Fatalf("expected no kubeconfig in the output directory")
+	}
+	// the PEM blocks are base64 encoded in the parameters
+	for artifact, pem := range map[string]string{"apimodel.json": "-----BEGIN", "azuredeploy.parameters.json": "LS0tLS1CRUdJTi"} {
+		b, err := ioutil.ReadFile(path.Join(outputDirectory, artifact))
+		if err != nil {
+			t.Fatalf("unable to read %s: %s", artifact, err)
+		}
+		if strings.Contains(string(b), pem) {
+			t.Fatalf("expected %s to hold references to the certificates and keys only", artifact)
+		}
+	}
+	if !strings.Contains(result.Parameters, `"secretName":"masterdns1-ca-private-key"`) {
+		t.Fatalf("expected the parameters to reference the CA private key, got %s", result.Parameters)
+	}
+
+	kubeConfig, err := getKubeConfig(context.Background(), client, cs, cs.Location)
+	if err != nil {
+		t.Fatalf("unexpected error getting the kube config: %s", err)
+	}
+	if stored := client.KeyVaultSecrets[result.Secrets[len(result.Secrets)-1]]; stored != kubeConfig {
+		t.Fatalf("expected the stored kube config to be the admin kube config, got %s", stored)
+	}
+
+	// the secrets are only stored once
+	result, err = Generate(context.Background(), GenerateOptions{ContainerService: cs, APIVersion: apiVersion, Client: client})
+	if err != nil {
+		t.Fatalf("unexpected error generating the template again: %s", err)
+	}
+	if len(result.Secrets) != 0 {
+		t.Fatalf("expected no secret to be stored again, got %v", result.Secrets)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/Azure/acs-engine/pkg/acsengine"
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/openshift/filesystem"
+	"github.com/pkg/errors"
+)
+
+// GetKubeConfig returns the admin kubeconfig of a Kubernetes or OpenShift cluster
+func GetKubeConfig(cs *api.ContainerService, location string) (string, error) {
+	if cs == nil || cs.Properties == nil || cs.Properties.OrchestratorProfile == nil {
+		return "", errors.New("the container service has no orchestrator profile")
+	}
+	switch orchestratorType := cs.Properties.OrchestratorProfile.OrchestratorType; orchestratorType {
+	case api.Kubernetes:
+		kubeConfig, err := acsengine.GenerateKubeConfig(cs.Properties, location)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to generate kube config")
+		}
+		return kubeConfig, nil
+	case api.OpenShift:
+		if cs.Properties.OrchestratorProfile.OpenShiftConfig == nil {
+			return "", errors.New("the container service has no OpenShift config")
+		}
+		bundle := bytes.NewReader(cs.Properties.OrchestratorProfile.OpenShiftConfig.ConfigBundles["master"])
+		fs, err := filesystem.NewTGZReader(bundle)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read master bundle")
+		}
+		kubeConfig, err := fs.ReadFile("etc/origin/master/admin.kubeconfig")
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read kube config")
+		}
+		return string(kubeConfig), nil
+	default:
+		return "", errors.Errorf("no kube config for orchestrator %q", orchestratorType)
+	}
+}
+
+// getKubeConfig returns the admin kubeconfig of a cluster, reading its certificates from Key Vault
+// when the apimodel references them
+func getKubeConfig(ctx context.Context, client armhelpers.ACSEngineClient, cs *api.ContainerService, location string) (string, error) {
+	if cs == nil || cs.Properties == nil {
+		return GetKubeConfig(cs, location)
+	}
+	properties, err := resolveSecrets(ctx, client, cs.Properties)
+	if err != nil {
+		return "", err
+	}
+	resolved := *cs
+	resolved.Properties = properties
+	return GetKubeConfig(&resolved, location)
+}
@@ -0,0 +1,27 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/api"
+)
+
+func TestGetKubeConfig(t *testing.T) {
+	cs, _ := loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	kubeConfig, err := GetKubeConfig(cs, "westus2")
+	if err != nil {
+		t.Fatalf("unexpected error getting the kube config: %s", err)
+	}
+	if !strings.Contains(kubeConfig, "masterdns1") {
+		t.Fatalf("expected the kube config to point to the master, got %s", kubeConfig)
+	}
+
+	cs.Properties.OrchestratorProfile.OrchestratorType = api.DCOS
+	if _, err = GetKubeConfig(cs, "westus2"); err == nil {
+		t.Fatalf("expected an error getting the kube config of a DC/OS cluster")
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/Azure/acs-engine/pkg/acsengine/transform"
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/api/v20160330"
+	"github.com/Azure/acs-engine/pkg/api/v20160930"
+	"github.com/Azure/acs-engine/pkg/api/v20170131"
+	"github.com/Azure/acs-engine/pkg/api/v20170701"
+	"github.com/Azure/acs-engine/pkg/api/vlabs"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/pkg/errors"
+)
+
+// MigrateAPIVersions are the API versions apimodels are migrated from and to
+var MigrateAPIVersions = []string{
+	v20160330.APIVersion,
+	v20160930.APIVersion,
+	v20170131.APIVersion,
+	v20170701.APIVersion,
+	vlabs.APIVersion,
+}
+
+// MigrateChangeKind describes how a field of an apimodel is affected by a migration
+type MigrateChangeKind string
+
+const (
+	// MigrateChangeLost is a field the target API version cannot hold
+	MigrateChangeLost MigrateChangeKind = "Lost"
+	// MigrateChangeDefaulted is a field the conversion sets although the apimodel does not
+	MigrateChangeDefaulted MigrateChangeKind = "Defaulted"
+	// MigrateChangeModified is a field whose value is changed by the conversion
+	MigrateChangeModified MigrateChangeKind = "Modified"
+)
+
+// MigrateChange is a field of an apimodel affected by a migration
+type MigrateChange struct {
+	// Path is the JSON path of the field, such as properties.masterProfile.vmSize
+	Path     string            `json:"path"`
+	Kind     MigrateChangeKind `json:"kind"`
+	OldValue interface{}       `json:"oldValue,omitempty"`
+	NewValue interface{}       `json:"newValue,omitempty"`
+}
+
+// MigrateOptions are the options of Migrate
+type MigrateOptions struct {
+	// APIModel is the content of the apimodel to migrate
+	APIModel []byte
+	// APIVersion is the API version the apimodel is migrated to
+	APIVersion string
+	// Translator translates messages; nil does not translate them
+	Translator *i18n.Translator
+}
+
+// MigrateResult is the result of Migrate
+type MigrateResult struct {
+	// APIModel is the apimodel in the target API version
+	APIModel []byte
+	// SourceAPIVersion is the API version of the migrated apimodel
+	SourceAPIVersion string
+	// Changes are the fields lost, defaulted or modified by the migration, sorted by path
+	Changes []MigrateChange
+}
+
+// Migrate converts an apimodel to another API version. The fields the target version
+// cannot hold are found by converting the result back to the source version.
+func Migrate(ctx context.Context, o MigrateOptions) (*MigrateResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !isMigrateAPIVersion(o.APIVersion) {
+		return nil, &ValidationError{Err: errors.Errorf("unsupported target API version %q, expected one of %v", o.APIVersion, MigrateAPIVersions)}
+	}
+	apiloader := &api.Apiloader{Translator: translatorOrDefault(o.Translator)}
+
+	cs, sourceVersion, err := apiloader.DeserializeContainerService(o.APIModel, false, false, nil)
+	if err != nil {
+		return nil, &ValidationError{Err: errors.Wrap(err, "error parsing the api model")}
+	}
+	if !isMigrateAPIVersion(sourceVersion) {
+		return nil, &ValidationError{Err: errors.Errorf("unsupported source API version %q, expected one of %v", sourceVersion, MigrateAPIVersions)}
+	}
+	if cs.Properties == nil || cs.Properties.MasterProfile == nil {
+		return nil, &ValidationError{Err: errors.New("agent pool only apimodels cannot be migrated")}
+	}
+
+	source, err := apiloader.SerializeContainerService(cs, sourceVersion)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error serializing the api model in version %s", sourceVersion)
+	}
+	migrated, err := apiloader.SerializeContainerService(cs, o.APIVersion)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error serializing the api model in version %s", o.APIVersion)
+	}
+	roundTripped, _, err := apiloader.DeserializeContainerService(migrated, false, false, nil)
+	if err != nil {
+		// the older versions do not know the newer orchestrators
+		return nil, &ValidationError{Err: errors.Wrapf(err, "the api model cannot be migrated to version %s", o.APIVersion)}
+	}
+	back, err := apiloader.SerializeContainerService(roundTripped, sourceVersion)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error serializing the api model in version %s", sourceVersion)
+	}
+
+	changes, err := migrateChanges(source, migrated, back)
+	if err != nil {
+		return nil, err
+	}
+	return &MigrateResult{
+		APIModel:         migrated,
+		SourceAPIVersion: sourceVersion,
+		Changes:          changes,
+	}, nil
+}
+
+// migrateChanges compares the source apimodel with the migrated one, for the defaulted
+// and modified fields, and with the one converted back to the source version, for the
+// lost fields
+func migrateChanges(source, migrated, back []byte) ([]MigrateChange, error) {
+	var sourceDoc, migratedDoc, backDoc map[string]interface{}
+	for _, doc := range []struct {
+		content []byte
+		v       *map[string]interface{}
+	}{{source, &sourceDoc}, {migrated, &migratedDoc}, {back, &backDoc}} {
+		if err := json.Unmarshal(doc.content, doc.v); err != nil {
+			return nil, errors.Wrap(err, "error decoding the api model")
+		}
+	}
+
+	changes := []MigrateChange{}
+	reported := map[string]bool{}
+	add := func(c transform.PropertyChange, kind MigrateChangeKind) {
+		if reported[c.Path] {
+			return
+		}
+		reported[c.Path] = true
+		change := MigrateChange{Path: c.Path, Kind: kind, OldValue: c.OldValue, NewValue: c.NewValue}
+		if kind == MigrateChangeDefaulted {
+			change.OldValue = nil
+		}
+		changes = append(changes, change)
+	}
+	// defaulted reports fields set by the conversion; fields without omitempty are
+	// written with their zero values, which are not reported
+	defaulted := func(c transform.PropertyChange) bool {
+		if c.Change != transform.ChangeTypeAdded && !isZeroJSON(c.OldValue) {
+			return false
+		}
+		if !isZeroJSON(c.NewValue) {
+			add(c, MigrateChangeDefaulted)
+		}
+		return true
+	}
+
+	for _, c := range transform.DiffJSON(sourceDoc, backDoc) {
+		if !defaulted(c) {
+			add(c, MigrateChangeLost)
+		}
+	}
+	delete(sourceDoc, "apiVersion")
+	delete(migratedDoc, "apiVersion")
+	for _, c := range transform.DiffJSON(sourceDoc, migratedDoc) {
+		if !defaulted(c) && c.Change == transform.ChangeTypeModified {
+			add(c, MigrateChangeModified)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// isZeroJSON tells whether a decoded JSON value is null, empty, false or zero
+func isZeroJSON(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return t == ""
+	case bool:
+		return !t
+	case float64:
+		return t == 0
+	case []interface{}:
+		return len(t) == 0
+	case map[string]interface{}:
+		return len(t) == 0
+	}
+	return false
+}
+
+func isMigrateAPIVersion(version string) bool {
+	for _, v := range MigrateAPIVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/acsengine/transform"
+	"github.com/Azure/acs-engine/pkg/api/v20160930"
+	"github.com/Azure/acs-engine/pkg/api/v20170701"
+	"github.com/Azure/acs-engine/pkg/api/vlabs"
+)
+
+func migrate(t *testing.T, apimodel []byte, apiVersion string) *MigrateResult {
+	result, err := Migrate(context.Background(), MigrateOptions{APIModel: apimodel, APIVersion: apiVersion})
+	if err != nil {
+		t.Fatalf("unexpected error migrating to %s: %s", apiVersion, err)
+	}
+	return result
+}
+
+func decodeAPIModel(t *testing.T, apimodel []byte) map[string]interface{} {
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(apimodel, &doc); err != nil {
+		t.Fatalf("unable to decode the api model: %s", err)
+	}
+	return doc
+}
+
+func TestMigrateRoundTrip(t *testing.T) {
+	for _, c := range []struct {
+		apimodel string
+		versions []string
+	}{
+		{"../../examples/v20170131/dcos.json", MigrateAPIVersions},
+		{"../../examples/v20170701/kubernetes.json", []string{v20170701.APIVersion, vlabs.APIVersion}},
+		{"../../examples/kubernetes-config/kubernetes-clustersubnet.json", []string{v20170701.APIVersion, vlabs.APIVersion}},
+	} {
+		apimodel, err := ioutil.ReadFile(c.apimodel)
+		if err != nil {
+			t.Fatalf("unable to read the api model: %s", err)
+		}
+		versions := c.versions
+		t.Run(path.Base(c.apimodel), func(t *testing.T) {
+			testMigrateRoundTrip(t, apimodel, versions)
+		})
+	}
+}
+
+// testMigrateRoundTrip migrates apimodel to each of versions, then to each of them and back, and
+// checks that the fields changed by the round trip are reported
+func testMigrateRoundTrip(t *testing.T, apimodel []byte, versions []string) {
+	for _, from := range versions {
+		source := migrate(t, apimodel, from).APIModel
+		normalized := decodeAPIModel(t, migrate(t, source, from).APIModel)
+
+		for _, to := range versions {
+			result := migrate(t, source, to)
+			if result.SourceAPIVersion != from {
+				t.Errorf("%s to %s: expected source version %s, got %s", from, to, from, result.SourceAPIVersion)
+			}
+			if version := decodeAPIModel(t, result.APIModel)["apiVersion"]; version != to {
+				t.Errorf("%s to %s: expected the migrated api model in version %s, got %v", from, to, to, version)
+			}
+
+			reported := map[string]bool{}
+			for _, c := range result.Changes {
+				reported[c.Path] = true
+			}
+			back := decodeAPIModel(t, migrate(t, result.APIModel, from).APIModel)
+			for _, c := range transform.DiffJSON(normalized, back) {
+				if !reported[c.Path] {
+					t.Errorf("%s to %s and back: %s was %s without being reported", from, to, c.Path, c.Change)
+				}
+			}
+		}
+	}
+}
+
+func TestMigrateReportsChanges(t *testing.T) {
+	dcos, err := ioutil.ReadFile("../../examples/v20170701/dcos.json")
+	if err != nil {
+		t.Fatalf("unable to read the api model: %s", err)
+	}
+
+	result := migrate(t, dcos, v20160930.APIVersion)
+	lost := map[string]interface{}{}
+	for _, c := range result.Changes {
+		if c.Kind == MigrateChangeLost {
+			lost[c.Path] = c.OldValue
+		}
+	}
+	if lost["properties.masterProfile.storageProfile"] != "ManagedDisks" || lost["properties.masterProfile.firstConsecutiveStaticIP"] != "10.240.255.5" {
+		t.Errorf("expected the storage profile and the first consecutive static IP to be lost, got %v", result.Changes)
+	}
+
+	result = migrate(t, dcos, vlabs.APIVersion)
+	for _, c := range result.Changes {
+		if c.Kind != MigrateChangeDefaulted {
+			t.Errorf("expected no field to be lost migrating to vlabs, got %s %s", c.Kind, c.Path)
+		}
+	}
+	expected := MigrateChange{Path: "properties.orchestratorProfile.orchestratorRelease", Kind: MigrateChangeDefaulted, NewValue: "1.9"}
+	if len(result.Changes) == 0 || result.Changes[len(result.Changes)-1] != expected {
+		t.Errorf("expected %v to be reported last, got %v", expected, result.Changes)
+	}
+
+	kubernetes, err := ioutil.ReadFile("../../examples/kubernetes-config/kubernetes-clustersubnet.json")
+	if err != nil {
+		t.Fatalf("unable to read the api model: %s", err)
+	}
+	result = migrate(t, kubernetes, v20170701.APIVersion)
+	lost = map[string]interface{}{}
+	for _, c := range result.Changes {
+		if c.Kind == MigrateChangeLost {
+			lost[c.Path] = c.OldValue
+		}
+	}
+	config, _ := lost["properties.orchestratorProfile.kubernetesConfig"].(map[string]interface{})
+	if config["clusterSubnet"] != "10.230.0.0/16" {
+		t.Errorf("expected the kubernetes config to be lost migrating to %s, got %v", v20170701.APIVersion, result.Changes)
+	}
+}
+
+func TestMigrateErrors(t *testing.T) {
+	kubernetes, err := ioutil.ReadFile("../../examples/v20170701/kubernetes.json")
+	if err != nil {
+		t.Fatalf("unable to read the api model: %s", err)
+	}
+
+	for _, o := range []MigrateOptions{
+		{APIModel: kubernetes, APIVersion: "2018-01-01"},
+		{APIModel: kubernetes, APIVersion: "2016-03-30"},
+		{APIModel: []byte(`{"apiVersion": "2017-07-01", "properties": `), APIVersion: v20170701.APIVersion},
+	} {
+		_, err := Migrate(context.Background(), o)
+		if _, ok := err.(*ValidationError); !ok {
+			t.Errorf("expected a validation error migrating to %s, got %v", o.APIVersion, err)
+		}
+	}
+}
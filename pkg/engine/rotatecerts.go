@@ -0,0 +1,512 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/acsengine"
+	"github.com/Azure/acs-engine/pkg/acsengine/transform"
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/Azure/acs-engine/pkg/operations"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// certsDir is where the nodes keep the certificates of the cluster
+	certsDir = "/etc/kubernetes/certs"
+	// listAgentsCommand lists the Linux agent nodes registered with the API server
+	listAgentsCommand = "sudo kubectl --kubeconfig /var/lib/kubelet/kubeconfig get nodes -l kubernetes.io/role=agent,beta.kubernetes.io/os=linux -o jsonpath='{.items[*].metadata.name}'"
+	// waitTimeout is how long a node is given for etcd or the API server to be healthy again
+	waitTimeout = 300
+)
+
+// DefaultRotatedCertificates are the pairs RotateCerts rotates when none are given; the
+// certificate authority is kept so that nodes and clients trusting it keep working
+var DefaultRotatedCertificates = []string{"apiserver", "client", "kubeconfig", "etcd"}
+
+// NodeRunner runs shell commands on the nodes of a cluster
+type NodeRunner interface {
+	// RunOnMaster runs command on the master at index, with input as its standard input, and
+	// returns its output
+	RunOnMaster(index int, command, input string) (string, error)
+	// RunOnAgent runs command on the agent node named name, with input as its standard input,
+	// and returns its output
+	RunOnAgent(name string, command, input string) (string, error)
+}
+
+// RotateCertsOptions are the options of RotateCerts
+type RotateCertsOptions struct {
+	Logger     *logrus.Entry
+	Translator *i18n.Translator
+	// ContainerService is the deployed cluster, as loaded from the apimodel.json written by Generate.
+	// RotateCerts replaces the rotated pairs of its CertificateProfile.
+	ContainerService *api.ContainerService
+	// APIVersion is the version of the API the apimodel.json artifact is written in
+	APIVersion string
+	// DeploymentDirectory is the output directory of Generate; its artifacts are written again
+	// with the new certificates, and the previous apimodel.json is kept as apimodel.json.bak
+	DeploymentDirectory string
+	// Certificates are the pairs to rotate, among api.CertificatePairs; empty means
+	// DefaultRotatedCertificates. Rotating "ca" rotates every pair.
+	Certificates []string
+	// RolloutOnly copies the certificates of the apimodel to the nodes without generating new
+	// ones, to finish a rotation that failed while rolling out
+	RolloutOnly bool
+	// SSHPrivateKey authenticates the admin user on the nodes
+	SSHPrivateKey []byte
+	// Runner runs the commands on the nodes; nil connects to them over SSH with SSHPrivateKey,
+	// reaching the agents through the first master
+	Runner NodeRunner
+	// BuildTag is the version of acs-engine recorded in the template
+	BuildTag string
+}
+
+// RotateCertsResult is the result of RotateCerts
+type RotateCertsResult struct {
+	// Rotated are the pairs that were rotated
+	Rotated []string
+	// Nodes are the nodes the certificates were copied to
+	Nodes []string
+	// Artifacts are the paths of the files written to the deployment directory
+	Artifacts []string
+}
+
+// CertificateInfo describes a certificate written to a deployment directory
+type CertificateInfo struct {
+	File      string    `json:"file"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// RotateCerts replaces the certificates of a deployed Kubernetes cluster. The new pairs are
+// written to the apimodel and the artifacts of the deployment directory first, so that a
+// failed rollout can be resumed with RolloutOnly. They are then copied to the nodes over SSH,
+// one master at a time, waiting for etcd and the API server to be healthy before moving on so
+// that etcd keeps its quorum, then to the agents. A new certificate authority is rolled out in
+// three passes: the nodes first trust both authorities, then get the certificates it signs,
+// and finally trust the new authority only.
+func RotateCerts(ctx context.Context, o RotateCertsOptions) (*RotateCertsResult, error) {
+	logger := loggerOrDefault(o.Logger)
+	translator := translatorOrDefault(o.Translator)
+	cs := o.ContainerService
+	if err := validateRotateCerts(cs); err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+	rotated, err := rotatedCertificates(o.Certificates)
+	if err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+	if o.RolloutOnly {
+		rotated = api.CertificatePairs
+	}
+	runner := o.Runner
+	if runner == nil {
+		if len(o.SSHPrivateKey) == 0 {
+			return nil, &ValidationError{Err: errors.New("an SSH private key is needed to reach the nodes")}
+		}
+		runner = newSSHNodeRunner(cs, o.SSHPrivateKey)
+	}
+	result := &RotateCertsResult{Rotated: rotated}
+
+	out, err := runner.RunOnMaster(0, listAgentsCommand, "")
+	if err != nil {
+		return result, errors.Wrapf(err, "error listing the agent nodes: %s", out)
+	}
+	agents := strings.Fields(out)
+	for _, pool := range cs.Properties.AgentPoolProfiles {
+		if pool.IsWindows() {
+			logger.Warnf("the nodes of the Windows pool %s are not rotated; they need to be redeployed to trust the new certificates", pool.Name)
+		}
+	}
+
+	old := *cs.Properties.CertificateProfile
+	if !o.RolloutOnly {
+		if err = ctx.Err(); err != nil {
+			return result, err
+		}
+		if err = backupAPIModel(o.DeploymentDirectory); err != nil {
+			return result, err
+		}
+		if err = cs.RotateCerts(rotated); err != nil {
+			return result, &ValidationError{Err: errors.Wrap(err, "error generating the certificates")}
+		}
+		if err = writeRotatedArtifacts(translator, o); err != nil {
+			return result, err
+		}
+		if result.Artifacts, err = listArtifacts(o.DeploymentDirectory); err != nil {
+			return result, err
+		}
+	}
+
+	if cs.Properties.MasterProfile.Count == 1 {
+		logger.Warnf("the cluster has a single master; its API server is unavailable while it restarts")
+	}
+	seen := map[string]bool{}
+	for _, step := range rotateCertsPlan(cs, &old, rotated, agents) {
+		if err = ctx.Err(); err != nil {
+			return result, err
+		}
+		logger.Infof("%s: %s", step.node(), step.Description)
+		if step.Master >= 0 {
+			out, err = runner.RunOnMaster(step.Master, step.Command, step.Input)
+		} else {
+			out, err = runner.RunOnAgent(step.Agent, step.Command, step.Input)
+		}
+		if err != nil {
+			return result, errors.Wrapf(err, "failed to %s on %s: %s; the new certificates are in %s, "+
+				"run rotate-certs again with --rollout-only once the node is fixed", step.Description, step.node(), out, o.DeploymentDirectory)
+		}
+		if !seen[step.node()] {
+			seen[step.node()] = true
+			result.Nodes = append(result.Nodes, step.node())
+		}
+	}
+	if containsString(rotated, "apiserver") {
+		logger.Warnf("the service account tokens were signed by the previous API server key and were recreated; " +
+			"restart the pods using them outside of kube-system")
+	}
+	return result, nil
+}
+
+// ListCertificates returns the certificates written to a deployment directory, sorted by file name
+func ListCertificates(dir string) ([]CertificateInfo, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.crt"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	certificates := []CertificateInfo{}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", file)
+		}
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, errors.Errorf("%s is not a PEM encoded certificate", file)
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", file)
+		}
+		certificates = append(certificates, CertificateInfo{
+			File:      filepath.Base(file),
+			Subject:   certificate.Subject.CommonName,
+			Issuer:    certificate.Issuer.CommonName,
+			NotBefore: certificate.NotBefore,
+			NotAfter:  certificate.NotAfter,
+		})
+	}
+	return certificates, nil
+}
+
+func validateRotateCerts(cs *api.ContainerService) error {
+	if cs == nil || cs.Properties == nil || cs.Properties.OrchestratorProfile == nil || !cs.Properties.OrchestratorProfile.IsKubernetes() {
+		return errors.New("certificates can only be rotated on Kubernetes clusters")
+	}
+	p := cs.Properties
+	if p.MasterProfile == nil || p.LinuxProfile == nil {
+		return errors.New("certificates can only be rotated on clusters with a master profile and a linux profile")
+	}
+	if k := p.OrchestratorProfile.KubernetesConfig; k != nil && k.PrivateCluster != nil && k.PrivateCluster.Enabled != nil && *k.PrivateCluster.Enabled {
+		return errors.New("the masters of a private cluster cannot be reached over SSH")
+	}
+	if p.CertificateProfile == nil || p.CertificateProfile.CaCertificate == "" {
+		return errors.New("the apimodel has no certificate profile; use the apimodel.json written by generate")
+	}
+	for _, s := range keyvaultSecrets(p) {
+		if isKeyvaultReference(*s.value) {
+			return errors.New("certificates stored in Key Vault cannot be rotated")
+		}
+	}
+	return nil
+}
+
+// rotatedCertificates validates the pairs to rotate, expanding "ca" to every pair
+func rotatedCertificates(certificates []string) ([]string, error) {
+	if len(certificates) == 0 {
+		return DefaultRotatedCertificates, nil
+	}
+	for _, c := range certificates {
+		if !containsString(api.CertificatePairs, c) {
+			return nil, errors.Errorf("unknown certificate %s, expected one of %s", c, strings.Join(api.CertificatePairs, ", "))
+		}
+		if c == "ca" {
+			return api.CertificatePairs, nil
+		}
+	}
+	rotated := []string{}
+	for _, c := range api.CertificatePairs {
+		if containsString(certificates, c) {
+			rotated = append(rotated, c)
+		}
+	}
+	return rotated, nil
+}
+
+// backupAPIModel keeps the apimodel.json of a deployment directory, before it is changed,
+// as apimodel.json.bak
+func backupAPIModel(dir string) error {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "apimodel.json"))
+	if err != nil {
+		return errors.Wrap(err, "error reading the apimodel to back up")
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "apimodel.json.bak"), b, 0600); err != nil {
+		return errors.Wrap(err, "error backing up the apimodel")
+	}
+	return nil
+}
+
+// writeRotatedArtifacts writes the template, parameters and certificates of the rotated cluster
+func writeRotatedArtifacts(translator *i18n.Translator, o RotateCertsOptions) error {
+	cs := o.ContainerService
+	if _, err := cs.SetPropertiesDefaults(false, true); err != nil {
+		return &ValidationError{Err: errors.Wrap(err, "error in SetPropertiesDefaults")}
+	}
+	return writeDeploymentArtifacts(translator, cs, o.APIVersion, o.DeploymentDirectory, o.BuildTag)
+}
+
+// writeDeploymentArtifacts writes the apimodel, template, parameters and certificates of a
+// defaulted cluster to its deployment directory
+func writeDeploymentArtifacts(translator *i18n.Translator, cs *api.ContainerService, apiVersion, dir, buildTag string) error {
+	template, parameters, err := generateTemplate(translator, cs, buildTag)
+	if err != nil {
+		return err
+	}
+	if template, err = transform.PrettyPrintArmTemplate(template); err != nil {
+		return errors.Wrap(err, "error pretty printing template")
+	}
+	if parameters, err = transform.BuildAzureParametersFile(parameters); err != nil {
+		return errors.Wrap(err, "error pretty printing template parameters")
+	}
+	writer := &acsengine.ArtifactWriter{
+		Translator: translator,
+	}
+	// the certificates, keys and kubeconfig of a cluster with a secrets Key Vault are not written
+	certsGenerated := cs.Properties.SecretsKeyvault == nil
+	if err = writer.WriteTLSArtifacts(cs, apiVersion, template, parameters, dir, certsGenerated, false); err != nil {
+		return errors.Wrap(err, "error writing artifacts")
+	}
+	return nil
+}
+
+// rotateCertsStep is a command run on a master, or on an agent when Master is -1
+type rotateCertsStep struct {
+	Master      int
+	Agent       string
+	Description string
+	Command     string
+	// Input is the standard input of Command, holding the keys it writes so that they are
+	// not on the command lines the other users of the node can see
+	Input string
+}
+
+func (s rotateCertsStep) node() string {
+	if s.Master >= 0 {
+		return fmt.Sprintf("master %d", s.Master)
+	}
+	return s.Agent
+}
+
+// rotateCertsPlan returns the commands copying the rotated certificates of cs to the nodes.
+// old is the certificate profile before the rotation; its certificate authority is trusted
+// along with the new one while the nodes get certificates signed by the new authority.
+func rotateCertsPlan(cs *api.ContainerService, old *api.CertificateProfile, rotated []string, agents []string) []rotateCertsStep {
+	c := cs.Properties.CertificateProfile
+	rotates := func(pair string) bool { return containsString(rotated, pair) }
+	var steps []rotateCertsStep
+	if !rotates("ca") || old.CaCertificate == c.CaCertificate {
+		steps = rotateCertsPhase(cs, rotated, c.CaCertificate, agents)
+	} else {
+		bundle := strings.TrimRight(c.CaCertificate, "\n") + "\n" + old.CaCertificate
+		steps = rotateCertsPhase(cs, nil, bundle, agents)
+		steps = append(steps, rotateCertsPhase(cs, rotated, bundle, agents)...)
+		steps = append(steps, rotateCertsPhase(cs, nil, c.CaCertificate, agents)...)
+	}
+
+	// the service account tokens are signed with the API server key and embed the certificate authority
+	if rotates("apiserver") {
+		kubectl := "sudo kubectl --kubeconfig /var/lib/kubelet/kubeconfig"
+		steps = append(steps, rotateCertsStep{Master: 0, Description: "recreate the service account tokens and the kube-system pods", Command: kubectl +
+			" delete secrets --all-namespaces --field-selector type=kubernetes.io/service-account-token && " + kubectl + " -n kube-system delete pods --all"})
+	}
+	return steps
+}
+
+// rotateCertsPhase writes the rotated pairs and the trusted certificate authorities ca to the
+// masters one at a time and then to the agents, restarting the components using them
+func rotateCertsPhase(cs *api.ContainerService, rotated []string, ca string, agents []string) []rotateCertsStep {
+	c := cs.Properties.CertificateProfile
+	rotates := func(pair string) bool { return containsString(rotated, pair) }
+	writeCA := rotates("ca") || len(rotated) == 0
+	var steps []rotateCertsStep
+
+	for i := 0; i < cs.Properties.MasterProfile.Count; i++ {
+		files := &certsFiles{}
+		if writeCA {
+			files.add("ca.crt", ca, "0644", "root:root")
+		}
+		if rotates("ca") {
+			files.add("ca.key", c.CaPrivateKey, "0600", "root:root")
+		}
+		if rotates("apiserver") {
+			files.add("apiserver.crt", c.APIServerCertificate, "0644", "root:root")
+			files.add("apiserver.key", c.APIServerPrivateKey, "0600", "root:root")
+		}
+		if rotates("client") {
+			files.add("client.crt", c.ClientCertificate, "0644", "root:root")
+			files.add("client.key", c.ClientPrivateKey, "0600", "root:root")
+		}
+		if rotates("etcd") {
+			files.add("etcdserver.crt", c.EtcdServerCertificate, "0644", "root:root")
+			files.add("etcdserver.key", c.EtcdServerPrivateKey, "0600", "etcd:etcd")
+			files.add("etcdclient.crt", c.EtcdClientCertificate, "0644", "root:root")
+			files.add("etcdclient.key", c.EtcdClientPrivateKey, "0600", "root:root")
+			files.add(fmt.Sprintf("etcdpeer%d.crt", i), c.EtcdPeerCertificates[i], "0644", "root:root")
+			files.add(fmt.Sprintf("etcdpeer%d.key", i), c.EtcdPeerPrivateKeys[i], "0600", "etcd:etcd")
+		}
+		if len(files.commands) > 0 {
+			steps = append(steps, rotateCertsStep{Master: i, Description: "write the certificates", Command: files.command(), Input: files.input})
+		}
+		if writeCA || rotates("kubeconfig") {
+			steps = append(steps, rotateCertsStep{Master: i, Description: "update the admin kubeconfig",
+				Command: kubeConfigCommand(cs.Properties.LinuxProfile.AdminUsername), Input: kubeConfigInput(ca, c.KubeConfigCertificate, c.KubeConfigPrivateKey)})
+		}
+		if writeCA || rotates("etcd") {
+			steps = append(steps,
+				rotateCertsStep{Master: i, Description: "restart etcd", Command: "sudo systemctl restart etcd"},
+				rotateCertsStep{Master: i, Description: "wait for the etcd cluster to be healthy", Command: waitCommand(
+					fmt.Sprintf("sudo env ETCDCTL_ENDPOINTS=https://127.0.0.1:%d ETCDCTL_CA_FILE=%s/ca.crt ETCDCTL_CERT_FILE=%s/etcdclient.crt ETCDCTL_KEY_FILE=%s/etcdclient.key etcdctl cluster-health",
+						api.DefaultMasterEtcdClientPort, certsDir, certsDir, certsDir))})
+		}
+		if writeCA || rotates("apiserver") || rotates("client") || rotates("etcd") {
+			steps = append(steps,
+				rotateCertsStep{Master: i, Description: "restart kubelet and the control plane", Command: "sudo systemctl restart kubelet && " +
+					"sudo docker ps -q --filter name=k8s_kube-apiserver --filter name=k8s_kube-controller-manager --filter name=k8s_kube-scheduler --filter name=k8s_kube-proxy | xargs -r sudo docker restart"},
+				rotateCertsStep{Master: i, Description: "wait for the API server to be healthy", Command: waitCommand(
+					"sudo kubectl --kubeconfig /var/lib/kubelet/kubeconfig get --raw /healthz")})
+		}
+	}
+
+	for _, agent := range agents {
+		files := &certsFiles{}
+		if writeCA {
+			files.add("ca.crt", ca, "0644", "root:root")
+		}
+		if rotates("apiserver") {
+			files.add("apiserver.crt", c.APIServerCertificate, "0644", "root:root")
+		}
+		if rotates("client") {
+			files.add("client.crt", c.ClientCertificate, "0644", "root:root")
+			files.add("client.key", c.ClientPrivateKey, "0600", "root:root")
+		}
+		if len(files.commands) == 0 {
+			continue
+		}
+		steps = append(steps,
+			rotateCertsStep{Master: -1, Agent: agent, Description: "write the certificates", Command: files.command(), Input: files.input},
+			rotateCertsStep{Master: -1, Agent: agent, Description: "restart kubelet and kube-proxy", Command: "sudo systemctl restart kubelet && " +
+				"sudo docker ps -q --filter name=k8s_kube-proxy | xargs -r sudo docker restart"})
+	}
+	return steps
+}
+
+// certsFiles is a command writing files to certsDir. The contents of the files are read from
+// its standard input, one base64 line per file, by the read builtin of the shell.
+type certsFiles struct {
+	commands []string
+	input    string
+}
+
+// add writes contents to a file of certsDir with the given mode and owner
+func (f *certsFiles) add(file, contents, mode, owner string) {
+	path := certsDir + "/" + file
+	f.commands = append(f.commands, fmt.Sprintf(`read -r contents && echo "$contents" | base64 -d | sudo tee %s >/dev/null && sudo chmod %s %s && sudo chown %s %s`,
+		path, mode, path, owner, path))
+	f.input += base64.StdEncoding.EncodeToString([]byte(contents)) + "\n"
+}
+
+func (f *certsFiles) command() string {
+	return strings.Join(f.commands, " && ")
+}
+
+// kubeConfigCommand replaces the certificates embedded in the admin kubeconfig of a master
+// with the sed script of kubeConfigInput
+func kubeConfigCommand(adminUsername string) string {
+	return fmt.Sprintf("sudo sed -i -f - /home/%s/.kube/config", adminUsername)
+}
+
+// kubeConfigInput is the sed script replacing the certificates of a kubeconfig
+func kubeConfigInput(ca, certificate, key string) string {
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	return fmt.Sprintf("s|certificate-authority-data: .*|certificate-authority-data: \"%s\"|\n"+
+		"s|client-certificate-data: .*|client-certificate-data: \"%s\"|\n"+
+		"s|client-key-data: .*|client-key-data: \"%s\"|\n", encode(ca), encode(certificate), encode(key))
+}
+
+// waitCommand runs command until it succeeds, for up to waitTimeout seconds
+func waitCommand(command string) string {
+	return fmt.Sprintf("timeout %d sh -c 'until %s >/dev/null 2>&1; do sleep 5; done'", waitTimeout, command)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sshNodeRunner runs commands over SSH, on the masters through the NAT rules of their load
+// balancer and on the agents through the first master
+type sshNodeRunner struct {
+	user       string
+	masterFQDN string
+	vmss       bool
+	key        []byte
+}
+
+func newSSHNodeRunner(cs *api.ContainerService, key []byte) *sshNodeRunner {
+	return &sshNodeRunner{
+		user:       cs.Properties.LinuxProfile.AdminUsername,
+		masterFQDN: cs.GetAzureProdFQDN(),
+		vmss:       cs.Properties.MasterProfile.IsVirtualMachineScaleSets(),
+		key:        key,
+	}
+}
+
+// masterPort is the SSH port of the master at index on the load balancer: the sshNatPorts of
+// the template for masters in an availability set, the inbound NAT pool for a scale set
+func (r *sshNodeRunner) masterPort(index int) int {
+	if r.vmss {
+		return 50001 + index
+	}
+	if index == 0 {
+		return 22
+	}
+	return 2200 + index
+}
+
+func (r *sshNodeRunner) RunOnMaster(index int, command, input string) (string, error) {
+	return operations.RemoteRunWithInput(r.user, r.masterFQDN, r.masterPort(index), r.key, command, input)
+}
+
+func (r *sshNodeRunner) RunOnAgent(name string, command, input string) (string, error) {
+	return operations.RemoteRunThrough(r.user, r.masterFQDN, r.masterPort(0), name, 22, r.key, command, input)
+}
@@ -0,0 +1,200 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/i18n"
+)
+
+// fakeNodeRunner records the commands run on the nodes and their standard input
+type fakeNodeRunner struct {
+	agents string
+	// outputs are the outputs of the commands run on the masters that read their state
+	outputs  map[string]string
+	commands []string
+	inputs   []string
+}
+
+func (r *fakeNodeRunner) RunOnMaster(index int, command, input string) (string, error) {
+	if command == listAgentsCommand {
+		return r.agents, nil
+	}
+	if out, ok := r.outputs[command]; ok {
+		return out, nil
+	}
+	r.commands = append(r.commands, fmt.Sprintf("master %d: %s", index, command))
+	r.inputs = append(r.inputs, input)
+	return "", nil
+}
+
+func (r *fakeNodeRunner) RunOnAgent(name string, command, input string) (string, error) {
+	r.commands = append(r.commands, fmt.Sprintf("%s: %s", name, command))
+	r.inputs = append(r.inputs, input)
+	return "", nil
+}
+
+// generateDeployment writes the artifacts of a cluster with 3 masters to a temporary directory
+func generateDeployment(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatalf("unable to create the deployment directory: %s", err)
+	}
+	cs, apiVersion := loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	cs.Properties.MasterProfile.Count = 3
+	cs.Properties.CertificateProfile = nil
+	if _, err = Generate(context.Background(), GenerateOptions{ContainerService: cs, APIVersion: apiVersion, OutputDirectory: dir}); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("unexpected error generating the artifacts: %s", err)
+	}
+	return dir
+}
+
+func loadDeployment(t *testing.T, dir string) (*api.ContainerService, string) {
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{},
+	}
+	cs, apiVersion, err := apiloader.LoadContainerServiceFromFile(path.Join(dir, "apimodel.json"), true, true, nil)
+	if err != nil {
+		t.Fatalf("unable to load the apimodel of %s: %s", dir, err)
+	}
+	return cs, apiVersion
+}
+
+func TestRotateCerts(t *testing.T) {
+	dir := generateDeployment(t)
+	defer os.RemoveAll(dir)
+	cs, apiVersion := loadDeployment(t, dir)
+	old := *cs.Properties.CertificateProfile
+
+	runner := &fakeNodeRunner{agents: "k8s-agentpool1-0 k8s-agentpool1-1"}
+	result, err := RotateCerts(context.Background(), RotateCertsOptions{
+		ContainerService:    cs,
+		APIVersion:          apiVersion,
+		DeploymentDirectory: dir,
+		Certificates:        []string{"etcd", "apiserver"},
+		Runner:              runner,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error rotating the certificates: %s", err)
+	}
+	if strings.Join(result.Rotated, ",") != "apiserver,etcd" {
+		t.Errorf("expected apiserver and etcd to be rotated, got %v", result.Rotated)
+	}
+	if strings.Join(result.Nodes, ",") != "master 0,master 1,master 2,k8s-agentpool1-0,k8s-agentpool1-1" {
+		t.Errorf("expected the masters then the agents to be rolled, got %v", result.Nodes)
+	}
+
+	if _, err = os.Stat(path.Join(dir, "apimodel.json.bak")); err != nil {
+		t.Errorf("expected the previous apimodel to be backed up: %s", err)
+	}
+	rotated, _ := loadDeployment(t, dir)
+	c := rotated.Properties.CertificateProfile
+	if c.CaCertificate != old.CaCertificate || c.ClientCertificate != old.ClientCertificate {
+		t.Errorf("expected the certificate authority and the client pair to be kept")
+	}
+	if c.APIServerCertificate == old.APIServerCertificate || c.EtcdPeerCertificates[2] == old.EtcdPeerCertificates[2] {
+		t.Errorf("expected the apiserver and etcd pairs to be rotated in apimodel.json")
+	}
+	b, err := ioutil.ReadFile(path.Join(dir, "apiserver.crt"))
+	if err != nil || string(b) != c.APIServerCertificate {
+		t.Errorf("expected apiserver.crt to be written again, got error %v", err)
+	}
+	key := base64.StdEncoding.EncodeToString([]byte(c.APIServerPrivateKey))
+	var written bool
+	for i, command := range runner.commands {
+		if strings.Contains(command, key) {
+			t.Fatalf("expected the private keys to be written from the standard input, got %s", command)
+		}
+		written = written || strings.Contains(runner.inputs[i], key+"\n")
+	}
+	if !written {
+		t.Errorf("expected the API server key in the standard input of the commands")
+	}
+	if !strings.Contains(runner.inputs[0], base64.StdEncoding.EncodeToString([]byte(c.EtcdPeerCertificates[0]))) || !strings.Contains(runner.commands[0], "etcdpeer0.crt") {
+		t.Errorf("expected the new etcd peer certificate to be written to master 0, got %s", runner.commands[0])
+	}
+
+	// etcd must be healthy again before the next master restarts it
+	var order []string
+	for _, command := range runner.commands {
+		node := command[:strings.Index(command, ":")]
+		switch {
+		case strings.Contains(command, "systemctl restart etcd"):
+			order = append(order, node+" etcd")
+		case strings.Contains(command, "etcdctl cluster-health"):
+			order = append(order, node+" wait")
+		case strings.Contains(command, "delete secrets"):
+			order = append(order, node+" tokens")
+		}
+	}
+	expected := "master 0 etcd,master 0 wait,master 1 etcd,master 1 wait,master 2 etcd,master 2 wait,master 0 tokens"
+	if strings.Join(order, ",") != expected {
+		t.Errorf("expected the restarts %s, got %s", expected, strings.Join(order, ","))
+	}
+}
+
+func TestRotateCertsPlanCertificateAuthority(t *testing.T) {
+	cs := api.CreateMockContainerService("testcluster", "1.10.8", 3, 2, false)
+	cs.Properties.CertificateProfile = nil
+	if _, err := cs.SetPropertiesDefaults(false, false); err != nil {
+		t.Fatalf("unexpected error setting the defaults: %s", err)
+	}
+	old := *cs.Properties.CertificateProfile
+	if err := cs.RotateCerts([]string{"ca"}); err != nil {
+		t.Fatalf("unexpected error rotating the certificates: %s", err)
+	}
+
+	steps := rotateCertsPlan(cs, &old, api.CertificatePairs, []string{"k8s-agentpool1-0"})
+	newCA := base64.StdEncoding.EncodeToString([]byte(cs.Properties.CertificateProfile.CaCertificate)) + "\n"
+	if steps[0].Master != 0 || strings.Contains(steps[0].Input, newCA) || !strings.Contains(steps[0].Command, "ca.crt") {
+		t.Errorf("expected the nodes to trust both certificate authorities first, got %s", steps[0].Command)
+	}
+	var agentSteps []rotateCertsStep
+	for _, step := range steps {
+		if step.Agent != "" && strings.Contains(step.Command, "ca.crt") {
+			agentSteps = append(agentSteps, step)
+		}
+	}
+	if len(agentSteps) != 3 {
+		t.Fatalf("expected the agent to get the certificate authorities in 3 passes, got %d", len(agentSteps))
+	}
+	if agentSteps[2].Input != newCA || strings.Contains(agentSteps[0].Input, newCA) {
+		t.Errorf("expected the agent to trust the new certificate authority only in the last pass")
+	}
+	if last := steps[len(steps)-1]; !strings.Contains(last.Command, "delete secrets") {
+		t.Errorf("expected the service account tokens to be recreated last, got %s", last.Description)
+	}
+}
+
+func TestListCertificates(t *testing.T) {
+	dir := generateDeployment(t)
+	defer os.RemoveAll(dir)
+
+	certificates, err := ListCertificates(dir)
+	if err != nil {
+		t.Fatalf("unexpected error listing the certificates: %s", err)
+	}
+	// ca, apiserver, client, kubectlClient, etcdserver, etcdclient and 3 etcd peers
+	if len(certificates) != 9 {
+		t.Fatalf("expected 9 certificates, got %d", len(certificates))
+	}
+	for _, c := range certificates {
+		if c.File == "ca.crt" && (c.Subject != "ca" || c.Issuer != "ca") {
+			t.Errorf("expected a self-signed ca.crt, got subject %s and issuer %s", c.Subject, c.Issuer)
+		}
+		if c.File == "apiserver.crt" && (c.Issuer != "ca" || !c.NotAfter.After(c.NotBefore)) {
+			t.Errorf("expected apiserver.crt to be issued by ca, got %+v", c)
+		}
+	}
+}
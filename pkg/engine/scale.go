@@ -0,0 +1,594 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/acsengine/transform"
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/armhelpers/utils"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/Azure/acs-engine/pkg/operations"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ScaleOptions are the options of Scale
+type ScaleOptions struct {
+	Client     armhelpers.ACSEngineClient
+	Logger     *logrus.Entry
+	Translator *i18n.Translator
+	// ContainerService is the deployed cluster, as loaded from the apimodel.json written by Generate.
+	// Scale leaves only the scaled pool in its agent pool profiles.
+	ContainerService *api.ContainerService
+	SubscriptionID   string
+	ResourceGroup    string
+	Location         string
+	// NameSuffix is the nameSuffix parameter of the deployed template
+	NameSuffix string
+	// AgentPoolName is the pool to scale; it can be omitted when the cluster has a single pool
+	AgentPoolName string
+	// NewCount is the number of nodes of the pool once scaled; 0 keeps the pool at its size after removing RemoveNodes.
+	// The number of nodes once scaled must be within MinCount and MaxCount when the pool has autoscaling enabled.
+	NewCount int
+	// RemoveNodes are VMs of the pool to drain and delete before scaling the pool to NewCount
+	RemoveNodes []string
+	// MasterFQDN is the FQDN of the API server, needed to drain Kubernetes and OpenShift nodes when scaling down
+	MasterFQDN string
+	// DrainTimeout is how long to wait for each node to drain; 0 uses DefaultDrainTimeout
+	DrainTimeout time.Duration
+	// ScaleDownPolicy chooses the instances removed when scaling down a VMSS pool; empty means operations.ScaleDownNewest
+	ScaleDownPolicy operations.ScaleDownPolicy
+	// BuildTag is the version of acs-engine recorded in the template
+	BuildTag string
+}
+
+// ScaleResult is the result of Scale
+type ScaleResult struct {
+	// AgentPoolName is the name of the scaled pool
+	AgentPoolName string
+	// Count is the number of nodes of the pool once scaled
+	Count int
+	// DeploymentName is the name of the ARM deployment that scaled the pool up, if any
+	DeploymentName string
+	VMsCreated     []string
+	VMsDeleted     []string
+}
+
+type scaler struct {
+	ScaleOptions
+	logger    *logrus.Entry
+	agentPool *api.AgentPoolProfile
+}
+
+// Scale sets the number of nodes of an agent pool. The nodes in RemoveNodes are drained and deleted first.
+// Scaling down then drains and deletes the nodes with the highest indexes, or the instances chosen by
+// ScaleDownPolicy for VMSS pools; scaling up deploys the pool with a higher count, after the highest index
+// in use for availability set pools so that the gaps left by removed nodes are kept.
+// The result lists the VMs that were created or deleted, even when Scale fails.
+func Scale(ctx context.Context, o ScaleOptions) (*ScaleResult, error) {
+	s := &scaler{ScaleOptions: o, logger: loggerOrDefault(o.Logger)}
+	s.Translator = translatorOrDefault(o.Translator)
+	if err := s.findAgentPool(); err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+	if s.NewCount < 0 || s.NewCount == 0 && len(s.RemoveNodes) == 0 {
+		return nil, &ValidationError{Err: errors.New("the new node count must be at least 1")}
+	}
+	// without NewCount the count is known once the nodes to remove are found
+	if s.NewCount > 0 {
+		if err := s.checkAutoscalerBounds(s.NewCount); err != nil {
+			return nil, err
+		}
+	}
+	result := &ScaleResult{AgentPoolName: s.agentPool.Name}
+
+	orchestratorInfo := s.ContainerService.Properties.OrchestratorProfile
+	var currentNodeCount, offset, index, winPoolIndex int
+	winPoolIndex = -1
+	indexes := make([]int, 0)
+	indexToVM := make(map[int]string)
+	if s.agentPool.IsAvailabilitySets() {
+		for vmsListPage, err := s.Client.ListVirtualMachines(ctx, s.ResourceGroup); vmsListPage.NotDone(); err = vmsListPage.Next() {
+			if err != nil {
+				return result, errors.Wrap(err, "failed to get vms in the resource group")
+			} else if len(vmsListPage.Values()) < 1 {
+				return result, errors.New("The provided resource group does not contain any vms")
+			}
+			for _, vm := range vmsListPage.Values() {
+				vmName := *vm.Name
+				if !s.vmInAgentPool(vmName, vm.Tags) {
+					continue
+				}
+
+				if isWindowsVM(vm.StorageProfile) {
+					_, _, winPoolIndex, index, err = utils.WindowsVMNameParts(vmName)
+				} else {
+					_, _, index, err = utils.K8sLinuxVMNameParts(vmName)
+				}
+				if err != nil {
+					return result, err
+				}
+
+				indexToVM[index] = vmName
+				indexes = append(indexes, index)
+			}
+		}
+		sort.Ints(indexes)
+
+		if len(s.RemoveNodes) > 0 {
+			var err error
+			if indexes, err = s.removeNodes(ctx, result, indexes, indexToVM); err != nil {
+				return result, err
+			}
+		}
+		currentNodeCount = len(indexes)
+		if s.NewCount == 0 {
+			s.NewCount = currentNodeCount
+		}
+		result.Count = s.NewCount
+
+		if currentNodeCount == s.NewCount {
+			s.logger.Info("Cluster is currently at the desired agent count.")
+			return result, nil
+		}
+		if currentNodeCount > 0 {
+			offset = indexes[len(indexes)-1] + 1
+		}
+
+		// Scale down Scenario
+		if currentNodeCount > s.NewCount {
+			vmsToDelete := make([]string, 0)
+			for i := currentNodeCount - 1; i >= s.NewCount; i-- {
+				vmsToDelete = append(vmsToDelete, indexToVM[indexes[i]])
+			}
+			return result, s.scaleDown(ctx, result, vmsToDelete)
+		}
+	} else {
+		for vmssListPage, err := s.Client.ListVirtualMachineScaleSets(ctx, s.ResourceGroup); vmssListPage.NotDone(); err = vmssListPage.Next() {
+			if err != nil {
+				return result, errors.Wrap(err, "failed to get vmss list in the resource group")
+			}
+			for _, vmss := range vmssListPage.Values() {
+				vmName := *vmss.Name
+				if !s.vmInAgentPool(vmName, vmss.Tags) {
+					continue
+				}
+
+				if vmss.VirtualMachineProfile != nil && isWindowsVMSS(vmss.VirtualMachineProfile.StorageProfile) {
+					if _, _, winPoolIndex, _, err = utils.WindowsVMNameParts(vmName); err != nil {
+						s.logger.Errorln(err)
+					}
+				}
+
+				currentNodeCount = int(*vmss.Sku.Capacity)
+
+				// Scale down Scenario
+				if currentNodeCount > s.NewCount || len(s.RemoveNodes) > 0 {
+					remaining, err := s.scaleDownScaleSet(ctx, result, vmss)
+					if err != nil {
+						return result, err
+					}
+					result.Count = s.NewCount
+					if remaining >= s.NewCount {
+						return result, nil
+					}
+					currentNodeCount = remaining
+				}
+				result.Count = s.NewCount
+			}
+		}
+		if s.NewCount == 0 {
+			return result, &ValidationError{Err: errors.Errorf("node %s was not found in node pool %s", s.RemoveNodes[0], s.agentPool.Name)}
+		}
+	}
+
+	s.ContainerService.Properties.AgentPoolProfiles = []*api.AgentPoolProfile{s.agentPool}
+
+	if _, err := s.ContainerService.SetPropertiesDefaults(false, true); err != nil {
+		return result, &ValidationError{Err: errors.Wrap(err, "error in SetPropertiesDefaults")}
+	}
+	template, parameters, err := generateTemplate(s.Translator, s.ContainerService, s.BuildTag)
+	if err != nil {
+		return result, err
+	}
+
+	if template, err = transform.PrettyPrintArmTemplate(template); err != nil {
+		return result, errors.Wrap(err, "error pretty printing template")
+	}
+
+	templateJSON := make(map[string]interface{})
+	parametersJSON := make(map[string]interface{})
+
+	err = json.Unmarshal([]byte(template), &templateJSON)
+	if err != nil {
+		return result, errors.Wrap(err, "error unmarshaling template")
+	}
+
+	err = json.Unmarshal([]byte(parameters), &parametersJSON)
+	if err != nil {
+		return result, errors.Wrap(err, "errror unmarshalling parameters")
+	}
+
+	transformer := transform.Transformer{Translator: s.Translator}
+	// Our templates generate a range of nodes based on a count and offset, it is possible for there to be holes in the template
+	// So we need to set the count in the template to get enough nodes for the range, if there are holes that number will be larger than the desired count
+	countForTemplate := s.NewCount
+	if s.agentPool.IsAvailabilitySets() {
+		countForTemplate += offset - currentNodeCount
+	}
+	addValue(parametersJSON, s.agentPool.Name+"Count", countForTemplate)
+
+	if winPoolIndex != -1 {
+		templateJSON["variables"].(map[string]interface{})[s.agentPool.Name+"Index"] = winPoolIndex
+	}
+	switch orchestratorInfo.OrchestratorType {
+	case api.OpenShift:
+		err = transformer.NormalizeForOpenShiftVMASScalingUp(s.logger, s.agentPool.Name, templateJSON)
+		if err != nil {
+			return result, errors.Wrap(err, "error tranforming the template for scaling")
+		}
+		if s.agentPool.IsAvailabilitySets() {
+			addValue(parametersJSON, fmt.Sprintf("%sOffset", s.agentPool.Name), offset)
+		}
+	case api.Kubernetes:
+		err = transformer.NormalizeForK8sVMASScalingUp(s.logger, templateJSON)
+		if err != nil {
+			return result, errors.Wrap(err, "error tranforming the template for scaling")
+		}
+		if s.agentPool.IsAvailabilitySets() {
+			addValue(parametersJSON, fmt.Sprintf("%sOffset", s.agentPool.Name), offset)
+		}
+	case api.Swarm:
+	case api.SwarmMode:
+	case api.DCOS:
+		if s.agentPool.IsAvailabilitySets() {
+			return result, &ValidationError{Err: errors.Errorf("scaling isn't supported for orchestrator %q, with availability sets", orchestratorInfo.OrchestratorType)}
+		}
+		transformer.NormalizeForVMSSScaling(s.logger, templateJSON)
+	}
+
+	vmsBefore, err := s.listPoolVMs(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	result.DeploymentName = randomDeploymentName(s.ResourceGroup)
+	if err = deploy(ctx, s.Client, s.logger, s.ResourceGroup, result.DeploymentName, templateJSON, parametersJSON); err != nil {
+		return result, err
+	}
+
+	vmsAfter, err := s.listPoolVMs(ctx)
+	if err != nil {
+		return result, err
+	}
+	existing := map[string]bool{}
+	for _, vmName := range vmsBefore {
+		existing[vmName] = true
+	}
+	for _, vmName := range vmsAfter {
+		if !existing[vmName] {
+			result.VMsCreated = append(result.VMsCreated, vmName)
+		}
+	}
+	return result, nil
+}
+
+// findAgentPool finds the pool to scale in the container service
+func (s *scaler) findAgentPool() error {
+	pools := s.ContainerService.Properties.AgentPoolProfiles
+	if s.AgentPoolName == "" {
+		switch len(pools) {
+		case 0:
+			return errors.New("No node pools found to scale")
+		case 1:
+			s.agentPool = pools[0]
+			s.AgentPoolName = pools[0].Name
+			return nil
+		default:
+			return errors.New("the node pool to scale is required if more than one agent pool is defined in the container service")
+		}
+	}
+	for _, pool := range pools {
+		if pool.Name == s.AgentPoolName {
+			s.agentPool = pool
+			return nil
+		}
+	}
+	return errors.Errorf("node pool %s was not found in the deployed api model", s.AgentPoolName)
+}
+
+// removeNodes drains and deletes the VMs of RemoveNodes from an availability set pool,
+// and returns the indexes of the VMs left in the pool
+func (s *scaler) removeNodes(ctx context.Context, result *ScaleResult, indexes []int, indexToVM map[int]string) ([]int, error) {
+	vmToIndex := map[string]int{}
+	for index, vmName := range indexToVM {
+		vmToIndex[strings.ToLower(vmName)] = index
+	}
+	removed := map[int]bool{}
+	vmsToDelete := make([]string, 0, len(s.RemoveNodes))
+	for _, vmName := range s.RemoveNodes {
+		index, ok := vmToIndex[strings.ToLower(vmName)]
+		if !ok {
+			return nil, &ValidationError{Err: errors.Errorf("node %s was not found in node pool %s", vmName, s.agentPool.Name)}
+		}
+		if !removed[index] {
+			removed[index] = true
+			vmsToDelete = append(vmsToDelete, indexToVM[index])
+		}
+	}
+	if s.NewCount == 0 {
+		if err := s.checkAutoscalerBounds(len(indexes) - len(vmsToDelete)); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.scaleDown(ctx, result, vmsToDelete); err != nil {
+		return nil, err
+	}
+
+	kept := make([]int, 0, len(indexes))
+	for _, index := range indexes {
+		if !removed[index] {
+			kept = append(kept, index)
+		}
+	}
+	return kept, nil
+}
+
+// checkAutoscalerBounds returns a validation error when the pool has autoscaling enabled and count
+// is outside its minCount and maxCount
+func (s *scaler) checkAutoscalerBounds(count int) error {
+	p := s.agentPool
+	if !p.IsAutoScalingEnabled() || p.MinCount == nil || p.MaxCount == nil || count >= *p.MinCount && count <= *p.MaxCount {
+		return nil
+	}
+	return &ValidationError{Err: errors.Errorf("the new node count %d is outside the autoscaler bounds of pool %s, minCount %d and maxCount %d",
+		count, p.Name, *p.MinCount, *p.MaxCount)}
+}
+
+// scaleDown drains and deletes the VMs of an availability set pool
+func (s *scaler) scaleDown(ctx context.Context, result *ScaleResult, vmsToDelete []string) error {
+	switch s.ContainerService.Properties.OrchestratorProfile.OrchestratorType {
+	case api.Kubernetes, api.OpenShift:
+		if s.MasterFQDN == "" {
+			return &ValidationError{Err: errors.New("master-FQDN is required to scale down a kubernetes cluster's agent pool")}
+		}
+		kubeConfig, err := getKubeConfig(ctx, s.Client, s.ContainerService, s.Location)
+		if err != nil {
+			return err
+		}
+		err = Drain(ctx, DrainOptions{
+			Client:     s.Client,
+			Logger:     s.logger,
+			MasterURL:  s.MasterFQDN,
+			KubeConfig: kubeConfig,
+			NodeNames:  vmsToDelete,
+			Timeout:    s.DrainTimeout,
+		})
+		if err != nil {
+			return errors.Wrap(err, "Got error while draining the nodes to be deleted")
+		}
+	}
+
+	errList := operations.ScaleDownVMs(s.Client, s.logger, s.SubscriptionID, s.ResourceGroup, vmsToDelete...)
+	failed, err := scaleDownErrors(errList)
+	for _, vmName := range vmsToDelete {
+		if !failed[vmName] {
+			result.VMsDeleted = append(result.VMsDeleted, vmName)
+		}
+	}
+	return err
+}
+
+// scaleDownScaleSet drains and deletes the instances of RemoveNodes and those chosen by the scale down policy
+// from a VMSS pool, then records the new capacity of the scale set unless it has to be scaled up.
+// It returns the number of instances left in the scale set.
+func (s *scaler) scaleDownScaleSet(ctx context.Context, result *ScaleResult, vmss compute.VirtualMachineScaleSet) (int, error) {
+	vmssName := *vmss.Name
+	instances, err := operations.ListScaleSetInstances(ctx, s.Client, s.ResourceGroup, vmssName)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := map[string]bool{}
+	victims := []operations.ScaleSetInstance{}
+	for _, nodeName := range s.RemoveNodes {
+		found := false
+		for _, instance := range instances {
+			if strings.EqualFold(instance.Name, nodeName) || strings.EqualFold(instance.NodeName, nodeName) {
+				found = true
+				if !removed[instance.InstanceID] {
+					removed[instance.InstanceID] = true
+					victims = append(victims, instance)
+				}
+			}
+		}
+		if !found {
+			return 0, &ValidationError{Err: errors.Errorf("node %s was not found in node pool %s", nodeName, s.agentPool.Name)}
+		}
+	}
+	kept := []operations.ScaleSetInstance{}
+	for _, instance := range instances {
+		if !removed[instance.InstanceID] {
+			kept = append(kept, instance)
+		}
+	}
+	if s.NewCount == 0 {
+		s.NewCount = len(kept)
+		if err := s.checkAutoscalerBounds(s.NewCount); err != nil {
+			return 0, err
+		}
+	}
+
+	var client armhelpers.KubernetesClient
+	switch s.ContainerService.Properties.OrchestratorProfile.OrchestratorType {
+	case api.Kubernetes, api.OpenShift:
+		if s.MasterFQDN == "" {
+			return 0, &ValidationError{Err: errors.New("master-FQDN is required to scale down a kubernetes cluster's agent pool")}
+		}
+		kubeConfig, err := getKubeConfig(ctx, s.Client, s.ContainerService, s.Location)
+		if err != nil {
+			return 0, err
+		}
+		if client, err = s.Client.GetKubernetesClient(masterURL(s.MasterFQDN), kubeConfig, time.Second, s.drainTimeout()); err != nil {
+			return 0, errors.Wrap(err, "failed to get a Kubernetes client")
+		}
+	}
+
+	if len(kept) > s.NewCount {
+		policy := s.ScaleDownPolicy
+		if policy == "" {
+			policy = operations.ScaleDownNewest
+		}
+		if policy == operations.ScaleDownLeastLoaded && client == nil {
+			return 0, &ValidationError{Err: errors.Errorf("the %s scale down policy is only supported for Kubernetes and OpenShift clusters", policy)}
+		}
+		selected, err := operations.SelectScaleSetInstances(client, s.logger, kept, len(kept)-s.NewCount, policy)
+		if err != nil {
+			return 0, err
+		}
+		victims = append(victims, selected...)
+	}
+
+	errList := operations.ScaleDownScaleSetVMs(ctx, s.Client, client, s.logger, s.ResourceGroup, vmssName, s.drainTimeout(), victims...)
+	failed, err := scaleDownErrors(errList)
+	for _, instance := range victims {
+		if !failed[instance.Name] {
+			result.VMsDeleted = append(result.VMsDeleted, instance.Name)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	remaining := len(instances) - len(victims)
+	if remaining < s.NewCount {
+		return remaining, nil
+	}
+
+	// deleting the instances lowers the capacity of the scale set, set it anyway in case it did not match the instances
+	sku := *vmss.Sku
+	capacity := int64(s.NewCount)
+	sku.Capacity = &capacity
+	location := s.Location
+	if vmss.Location != nil {
+		location = *vmss.Location
+	}
+	return remaining, s.Client.SetVirtualMachineScaleSetCapacity(ctx, s.ResourceGroup, vmssName, sku, location)
+}
+
+func (s *scaler) drainTimeout() time.Duration {
+	if s.DrainTimeout == 0 {
+		return DefaultDrainTimeout
+	}
+	return s.DrainTimeout
+}
+
+// scaleDownErrors returns the names of the VMs that failed to scale down and an error wrapping
+// the error of the first of them
+func scaleDownErrors(errList *list.List) (map[string]bool, error) {
+	failed := map[string]bool{}
+	if errList == nil {
+		return failed, nil
+	}
+	var err error
+	format := "Node '%s' failed to delete with error: '%s'"
+	for element := errList.Front(); element != nil; element = element.Next() {
+		vmError, ok := element.Value.(*operations.VMScalingErrorDetails)
+		if !ok {
+			continue
+		}
+		failed[vmError.Name] = true
+		if err == nil {
+			err = errors.Wrapf(vmError.Error, "Node '%s' failed to delete", vmError.Name)
+		} else {
+			err = errors.Wrapf(err, format, vmError.Name, vmError.Error.Error())
+		}
+	}
+	return failed, err
+}
+
+// listPoolVMs returns the names of the VMs of the agent pool to scale
+func (s *scaler) listPoolVMs(ctx context.Context) ([]string, error) {
+	vmNames := []string{}
+	if s.agentPool.IsAvailabilitySets() {
+		for page, err := s.Client.ListVirtualMachines(ctx, s.ResourceGroup); page.NotDone(); err = page.Next() {
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to get vms in the resource group")
+			}
+			for _, vm := range page.Values() {
+				if s.vmInAgentPool(*vm.Name, vm.Tags) {
+					vmNames = append(vmNames, *vm.Name)
+				}
+			}
+		}
+		return vmNames, nil
+	}
+
+	for page, err := s.Client.ListVirtualMachineScaleSets(ctx, s.ResourceGroup); page.NotDone(); err = page.Next() {
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get vmss list in the resource group")
+		}
+		for _, vmss := range page.Values() {
+			if !s.vmInAgentPool(*vmss.Name, vmss.Tags) {
+				continue
+			}
+			for vmPage, err := s.Client.ListVirtualMachineScaleSetVMs(ctx, s.ResourceGroup, *vmss.Name); vmPage.NotDone(); err = vmPage.Next() {
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to get the vms of vmss %s", *vmss.Name)
+				}
+				for _, vm := range vmPage.Values() {
+					vmNames = append(vmNames, *vm.Name)
+				}
+			}
+		}
+	}
+	return vmNames, nil
+}
+
+func (s *scaler) vmInAgentPool(vmName string, tags map[string]*string) bool {
+	// Try to locate the VM's agent pool by expected tags.
+	if tags != nil {
+		if poolName, ok := tags["poolName"]; ok {
+			if nameSuffix, ok := tags["resourceNameSuffix"]; ok {
+				// Use strings.Contains for the nameSuffix as the Windows Agent Pools use only
+				// a substring of the first 5 characters of the entire nameSuffix.
+				if strings.EqualFold(*poolName, s.AgentPoolName) && strings.Contains(s.NameSuffix, *nameSuffix) {
+					return true
+				}
+			}
+		}
+	}
+
+	// Fall back to checking the VM name to see if it fits the naming pattern.
+	return len(s.NameSuffix) >= 5 && strings.Contains(vmName, s.NameSuffix[:5]) && strings.Contains(vmName, s.AgentPoolName)
+}
+
+func isWindowsVM(profile *compute.StorageProfile) bool {
+	return profile != nil && profile.ImageReference != nil && isWindowsPublisher(profile.ImageReference.Publisher)
+}
+
+func isWindowsVMSS(profile *compute.VirtualMachineScaleSetStorageProfile) bool {
+	return profile != nil && profile.ImageReference != nil && isWindowsPublisher(profile.ImageReference.Publisher)
+}
+
+func isWindowsPublisher(publisher *string) bool {
+	return publisher != nil && strings.EqualFold(*publisher, "MicrosoftWindowsServer")
+}
+
+type paramsMap map[string]interface{}
+
+func addValue(m paramsMap, k string, v interface{}) {
+	m[k] = paramsMap{
+		"value": v,
+	}
+}
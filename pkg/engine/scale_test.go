@@ -0,0 +1,172 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
+)
+
+func TestScale(t *testing.T) {
+	cs, _ := loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	o := ScaleOptions{
+		Client:           &armhelpers.MockACSEngineClient{},
+		ContainerService: cs,
+		ResourceGroup:    "rg1",
+		Location:         "westus2",
+		NameSuffix:       "12345678",
+		AgentPoolName:    "agentpool1",
+		NewCount:         1,
+	}
+
+	// the mock client lists a single VM in agentpool1
+	result, err := Scale(context.Background(), o)
+	if err != nil {
+		t.Fatalf("unexpected error scaling to the current count: %s", err)
+	}
+	if result.DeploymentName != "" || len(result.VMsCreated) != 0 || len(result.VMsDeleted) != 0 {
+		t.Fatalf("expected no change when the pool is at the desired count, got %+v", result)
+	}
+
+	o.NewCount = 3
+	result, err = Scale(context.Background(), o)
+	if err != nil {
+		t.Fatalf("unexpected error scaling up: %s", err)
+	}
+	if !strings.HasPrefix(result.DeploymentName, "rg1-") || result.AgentPoolName != "agentpool1" {
+		t.Fatalf("expected the pool to be deployed, got %+v", result)
+	}
+	if len(cs.Properties.AgentPoolProfiles) != 1 || cs.Properties.AgentPoolProfiles[0].Name != "agentpool1" {
+		t.Fatalf("expected only the scaled pool in the container service")
+	}
+
+	cs, _ = loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	pool := cs.Properties.AgentPoolProfiles[0]
+	pool.EnableAutoScaling, pool.MinCount, pool.MaxCount = helpers.PointerToBool(true), helpers.PointerToInt(1), helpers.PointerToInt(2)
+	o.ContainerService = cs
+	if _, err = Scale(context.Background(), o); err == nil || !strings.Contains(err.Error(), "outside the autoscaler bounds") {
+		t.Fatalf("expected an error scaling beyond maxCount, got %v", err)
+	} else if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+
+	cs, _ = loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	o.ContainerService = cs
+	o.AgentPoolName = ""
+	if _, err = Scale(context.Background(), o); err == nil {
+		t.Fatalf("expected an error when the pool to scale is ambiguous")
+	} else if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+}
+
+func TestScaleRemoveNodes(t *testing.T) {
+	cs, _ := loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	o := ScaleOptions{
+		Client:           &armhelpers.MockACSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}},
+		ContainerService: cs,
+		ResourceGroup:    "rg1",
+		Location:         "westus2",
+		NameSuffix:       "12345678",
+		AgentPoolName:    "agentpool1",
+		MasterFQDN:       "masterdns1.westus2.cloudapp.azure.com",
+		RemoveNodes:      []string{"k8s-agentpool1-12345678-3"},
+	}
+
+	if _, err := Scale(context.Background(), o); err == nil {
+		t.Fatalf("expected an error removing a node that is not in the pool")
+	} else if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+
+	// the mock client lists a single VM in agentpool1
+	o.RemoveNodes = []string{"k8s-agentpool1-12345678-0"}
+	result, err := Scale(context.Background(), o)
+	if err != nil {
+		t.Fatalf("unexpected error removing a node: %s", err)
+	}
+	if result.Count != 0 || len(result.VMsDeleted) != 1 || result.VMsDeleted[0] != "k8s-agentpool1-12345678-0" || result.DeploymentName != "" {
+		t.Fatalf("expected the node to be removed without a deployment, got %+v", result)
+	}
+
+	o.NewCount = 2
+	result, err = Scale(context.Background(), o)
+	if err != nil {
+		t.Fatalf("unexpected error replacing a node: %s", err)
+	}
+	if result.Count != 2 || len(result.VMsDeleted) != 1 || result.DeploymentName == "" {
+		t.Fatalf("expected the node to be removed and the pool to be deployed, got %+v", result)
+	}
+
+	cs, _ = loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	pool := cs.Properties.AgentPoolProfiles[0]
+	pool.EnableAutoScaling, pool.MinCount, pool.MaxCount = helpers.PointerToBool(true), helpers.PointerToInt(1), helpers.PointerToInt(2)
+	o.ContainerService = cs
+	o.NewCount = 0
+	result, err = Scale(context.Background(), o)
+	if err == nil || !strings.Contains(err.Error(), "the new node count 0 is outside the autoscaler bounds") {
+		t.Fatalf("expected an error removing a node below minCount, got %v", err)
+	} else if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if len(result.VMsDeleted) != 0 {
+		t.Fatalf("expected no node to be deleted, got %+v", result)
+	}
+}
+
+func TestScaleRemoveNodesScaleSetBounds(t *testing.T) {
+	cs, _ := loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	pool := cs.Properties.AgentPoolProfiles[0]
+	pool.AvailabilityProfile = api.VirtualMachineScaleSets
+	pool.EnableAutoScaling, pool.MinCount, pool.MaxCount = helpers.PointerToBool(true), helpers.PointerToInt(3), helpers.PointerToInt(5)
+
+	vmssName := "k8s-agentpool1-12345678-vmss"
+	var capacity int64 = 3
+	vms := []compute.VirtualMachineScaleSetVM{}
+	for i := 0; i < 3; i++ {
+		vms = append(vms, compute.VirtualMachineScaleSetVM{
+			InstanceID: helpers.PointerToString(fmt.Sprint(i)),
+			Name:       helpers.PointerToString(fmt.Sprintf("%s_%d", vmssName, i)),
+		})
+	}
+	o := ScaleOptions{
+		Client: &armhelpers.MockACSEngineClient{
+			MockKubernetesClient: &armhelpers.MockKubernetesClient{},
+			ScaleSets: []compute.VirtualMachineScaleSet{{
+				Name: helpers.PointerToString(vmssName),
+				Tags: map[string]*string{
+					"poolName":           helpers.PointerToString("agentpool1"),
+					"resourceNameSuffix": helpers.PointerToString("12345678"),
+				},
+				Sku:                              &compute.Sku{Capacity: &capacity},
+				VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{},
+			}},
+			ScaleSetVMs: map[string][]compute.VirtualMachineScaleSetVM{vmssName: vms},
+		},
+		ContainerService: cs,
+		ResourceGroup:    "rg1",
+		Location:         "westus2",
+		NameSuffix:       "12345678",
+		AgentPoolName:    "agentpool1",
+		MasterFQDN:       "masterdns1.westus2.cloudapp.azure.com",
+		RemoveNodes:      []string{vmssName + "_1"},
+	}
+
+	result, err := Scale(context.Background(), o)
+	if err == nil || !strings.Contains(err.Error(), "the new node count 2 is outside the autoscaler bounds") {
+		t.Fatalf("expected an error removing a node below minCount, got %v", err)
+	} else if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if len(result.VMsDeleted) != 0 {
+		t.Fatalf("expected no instance to be deleted, got %+v", result)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+
+	"github.com/Azure/acs-engine/pkg/acsengine"
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/helpers"
+	"github.com/pkg/errors"
+)
+
+// KubeConfigSecretName is the name, after the secret name prefix, of the Key Vault secret
+// holding the admin kubeconfig of a cluster whose secrets are stored in Key Vault
+const KubeConfigSecretName = "kubeconfig"
+
+// keyvaultSecret is a secret field of the apimodel that can be stored in Key Vault
+type keyvaultSecret struct {
+	// name is the name of the secret after the secret name prefix
+	name  string
+	value *string
+	// encoded secrets are stored in base64, as the ARM parameters referencing them expect
+	encoded bool
+}
+
+// keyvaultSecrets returns the secret fields of p: the certificates and keys of its certificate profile
+// and the etcd encryption key
+func keyvaultSecrets(p *api.Properties) []keyvaultSecret {
+	var secrets []keyvaultSecret
+	if c := p.CertificateProfile; c != nil {
+		secrets = append(secrets,
+			keyvaultSecret{"ca-certificate", &c.CaCertificate, true},
+			keyvaultSecret{"ca-private-key", &c.CaPrivateKey, true},
+			keyvaultSecret{"ca-certificate-chain", &c.CaCertificateChain, true},
+			keyvaultSecret{"apiserver-certificate", &c.APIServerCertificate, true},
+			keyvaultSecret{"apiserver-private-key", &c.APIServerPrivateKey, true},
+			keyvaultSecret{"client-certificate", &c.ClientCertificate, true},
+			keyvaultSecret{"client-private-key", &c.ClientPrivateKey, true},
+			keyvaultSecret{"kubeconfig-certificate", &c.KubeConfigCertificate, true},
+			keyvaultSecret{"kubeconfig-private-key", &c.KubeConfigPrivateKey, true},
+			keyvaultSecret{"etcdserver-certificate", &c.EtcdServerCertificate, true},
+			keyvaultSecret{"etcdserver-private-key", &c.EtcdServerPrivateKey, true},
+			keyvaultSecret{"etcdclient-certificate", &c.EtcdClientCertificate, true},
+			keyvaultSecret{"etcdclient-private-key", &c.EtcdClientPrivateKey, true})
+		for i := range c.EtcdPeerCertificates {
+			secrets = append(secrets, keyvaultSecret{"etcdpeer" + strconv.Itoa(i) + "-certificate", &c.EtcdPeerCertificates[i], true})
+		}
+		for i := range c.EtcdPeerPrivateKeys {
+			secrets = append(secrets, keyvaultSecret{"etcdpeer" + strconv.Itoa(i) + "-private-key", &c.EtcdPeerPrivateKeys[i], true})
+		}
+	}
+	if p.OrchestratorProfile != nil && p.OrchestratorProfile.KubernetesConfig != nil {
+		// the key is already base64, and passed as is to the template
+		secrets = append(secrets, keyvaultSecret{"etcd-encryption-key", &p.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey, false})
+	}
+	return secrets
+}
+
+// secretNamePrefix returns the prefix of the names of the secrets of a cluster stored in Key Vault
+func secretNamePrefix(p *api.Properties) string {
+	if p.SecretsKeyvault.SecretNamePrefix != "" {
+		return p.SecretsKeyvault.SecretNamePrefix
+	}
+	return p.MasterProfile.DNSPrefix
+}
+
+// storeSecrets stores the secret fields of a cluster with a secrets Key Vault that are not references
+// yet, replaces them with references to the stored versions, and stores the admin kubeconfig for the
+// location of the cluster when its certificates are stored. It returns the references to the new secrets.
+func storeSecrets(ctx context.Context, client armhelpers.ACSEngineClient, cs *api.ContainerService) ([]string, error) {
+	p := cs.Properties
+	vaultID := p.SecretsKeyvault.VaultID
+	prefix := secretNamePrefix(p)
+
+	// the kubeconfig is built from the certificates before they are replaced
+	var kubeConfig string
+	if c := p.CertificateProfile; c != nil && (!isKeyvaultReference(c.CaCertificate) || !isKeyvaultReference(c.KubeConfigCertificate) || !isKeyvaultReference(c.KubeConfigPrivateKey)) {
+		resolved, err := resolveSecrets(ctx, client, p)
+		if err != nil {
+			return nil, err
+		}
+		if kubeConfig, err = acsengine.GenerateKubeConfig(resolved, cs.Location); err != nil {
+			return nil, errors.Wrap(err, "failed to generate kube config")
+		}
+	}
+
+	var stored []string
+	store := func(name, value string) (string, error) {
+		secretName := prefix + "-" + name
+		version, err := client.SetKeyVaultSecret(ctx, vaultID, secretName, value)
+		if err != nil {
+			return "", errors.Wrapf(err, "error storing secret %s in Key Vault %s", secretName, vaultID)
+		}
+		path := helpers.KeyvaultSecretPath(vaultID, secretName, version)
+		stored = append(stored, path)
+		return path, nil
+	}
+	for _, s := range keyvaultSecrets(p) {
+		if *s.value == "" || isKeyvaultReference(*s.value) {
+			continue
+		}
+		value := *s.value
+		if s.encoded {
+			value = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+		path, err := store(s.name, value)
+		if err != nil {
+			return stored, err
+		}
+		*s.value = path
+	}
+	if kubeConfig != "" {
+		if _, err := store(KubeConfigSecretName, kubeConfig); err != nil {
+			return stored, err
+		}
+	}
+	return stored, nil
+}
+
+// resolveSecrets returns p with the values of the secret fields that reference Key Vault secrets.
+// p is returned as is when none does; otherwise it is left unchanged and a copy is returned.
+func resolveSecrets(ctx context.Context, client armhelpers.ACSEngineClient, p *api.Properties) (*api.Properties, error) {
+	references := false
+	for _, s := range keyvaultSecrets(p) {
+		references = references || isKeyvaultReference(*s.value)
+	}
+	if !references {
+		return p, nil
+	}
+	if client == nil {
+		return nil, errors.New("the apimodel references secrets in Key Vault, Azure credentials are required to read them")
+	}
+
+	resolved := *p
+	if p.CertificateProfile != nil {
+		c := *p.CertificateProfile
+		c.EtcdPeerCertificates = append([]string(nil), c.EtcdPeerCertificates...)
+		c.EtcdPeerPrivateKeys = append([]string(nil), c.EtcdPeerPrivateKeys...)
+		resolved.CertificateProfile = &c
+	}
+	if p.OrchestratorProfile != nil && p.OrchestratorProfile.KubernetesConfig != nil {
+		o := *p.OrchestratorProfile
+		k := *o.KubernetesConfig
+		o.KubernetesConfig = &k
+		resolved.OrchestratorProfile = &o
+	}
+	for _, s := range keyvaultSecrets(&resolved) {
+		vaultID, secretName, version, ok := helpers.ParseKeyvaultSecretPath(*s.value)
+		if !ok {
+			continue
+		}
+		value, err := client.GetKeyVaultSecret(ctx, vaultID, secretName, version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading secret %s from Key Vault %s", secretName, vaultID)
+		}
+		if s.encoded {
+			b, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "secret %s of Key Vault %s is not base64 encoded", secretName, vaultID)
+			}
+			value = string(b)
+		}
+		*s.value = value
+	}
+	return &resolved, nil
+}
+
+func isKeyvaultReference(s string) bool {
+	_, _, _, ok := helpers.ParseKeyvaultSecretPath(s)
+	return ok
+}
@@ -0,0 +1,61 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	vaultID := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv"
+	p := &api.Properties{
+		OrchestratorProfile: &api.OrchestratorProfile{
+			OrchestratorType: api.Kubernetes,
+			KubernetesConfig: &api.KubernetesConfig{EtcdEncryptionKey: "key"},
+		},
+		MasterProfile:      &api.MasterProfile{DNSPrefix: "dns"},
+		CertificateProfile: &api.CertificateProfile{CaCertificate: "ca", EtcdPeerPrivateKeys: []string{"peer0"}},
+	}
+	if resolved, err := resolveSecrets(context.Background(), nil, p); err != nil || resolved != p {
+		t.Fatalf("expected properties without references to be returned as is, got %v", err)
+	}
+
+	client := &armhelpers.MockACSEngineClient{}
+	cs := &api.ContainerService{Location: "westus2", Properties: p}
+	p.SecretsKeyvault = &api.SecretsKeyvault{VaultID: vaultID, SecretNamePrefix: "prefix"}
+	if _, err := storeSecrets(context.Background(), client, cs); err != nil {
+		t.Fatalf("unexpected error storing the secrets: %s", err)
+	}
+	if !isKeyvaultReference(p.CertificateProfile.CaCertificate) || !isKeyvaultReference(p.CertificateProfile.EtcdPeerPrivateKeys[0]) ||
+		!isKeyvaultReference(p.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey) {
+		t.Fatalf("expected the secrets to be replaced by references, got %+v", p.CertificateProfile)
+	}
+	if p.CertificateProfile.CaPrivateKey != "" {
+		t.Fatalf("expected empty secrets not to be stored")
+	}
+	if _, err := resolveSecrets(context.Background(), nil, p); err == nil {
+		t.Fatalf("expected an error resolving references without a client")
+	}
+
+	resolved, err := resolveSecrets(context.Background(), client, p)
+	if err != nil {
+		t.Fatalf("unexpected error resolving the secrets: %s", err)
+	}
+	if resolved.CertificateProfile.CaCertificate != "ca" || resolved.CertificateProfile.EtcdPeerPrivateKeys[0] != "peer0" ||
+		resolved.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey != "key" {
+		t.Fatalf("expected the stored values, got %+v", resolved.CertificateProfile)
+	}
+	if !isKeyvaultReference(p.CertificateProfile.EtcdPeerPrivateKeys[0]) || !isKeyvaultReference(p.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey) {
+		t.Fatalf("expected the properties to keep their references")
+	}
+
+	client.FailGetKeyVaultSecret = true
+	if _, err := resolveSecrets(context.Background(), client, p); err == nil {
+		t.Fatalf("expected an error when a secret cannot be read")
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	"github.com/Azure/acs-engine/pkg/operations/kubernetesupgrade"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// UpgradeOptions are the options of Upgrade
+type UpgradeOptions struct {
+	Client     armhelpers.ACSEngineClient
+	Logger     *logrus.Entry
+	Translator *i18n.Translator
+	// ContainerService is the deployed cluster, as loaded from the apimodel.json written by Generate.
+	// Upgrade sets its orchestrator version to UpgradeVersion.
+	ContainerService *api.ContainerService
+	SubscriptionID   uuid.UUID
+	ResourceGroup    string
+	Location         string
+	// NameSuffix is the nameSuffix parameter of the deployed template
+	NameSuffix string
+	// UpgradeVersion is the Kubernetes version to upgrade to
+	UpgradeVersion string
+	// AgentPools are the names of the pools to upgrade; nil upgrades all the pools
+	AgentPools []string
+	// Journal records the progress of the upgrade so that it can be resumed; may be nil
+	Journal *kubernetesupgrade.UpgradeJournal
+	// StepTimeout is how long to wait for each node to be upgraded; nil uses the default
+	StepTimeout *time.Duration
+	// MaxSurge, MaxUnavailable and Concurrency are documented in kubernetesupgrade.UpgradeCluster
+	MaxSurge       int
+	MaxUnavailable int
+	Concurrency    int
+	// UpgradeTimeout bounds the whole upgrade; nil uses the default of 90 minutes
+	UpgradeTimeout *time.Duration
+	// BuildTag is the version of acs-engine recorded in the templates
+	BuildTag string
+}
+
+// UpgradeResult is the result of Upgrade
+type UpgradeResult struct {
+	// UpgradedNodes are the nodes the journal records as upgraded
+	UpgradedNodes []string
+}
+
+// Upgrade upgrades the masters and agents of a Kubernetes cluster to a new version.
+// The result lists the nodes upgraded so far, even when Upgrade fails.
+func Upgrade(ctx context.Context, o UpgradeOptions) (*UpgradeResult, error) {
+	if err := setUpgradeVersion(o.ContainerService, o.UpgradeVersion); err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+
+	agentPools := o.AgentPools
+	if agentPools == nil {
+		for _, agentPool := range o.ContainerService.Properties.AgentPoolProfiles {
+			agentPools = append(agentPools, agentPool.Name)
+		}
+	}
+
+	kubeConfig, err := getKubeConfig(ctx, o.Client, o.ContainerService, o.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	upgradeCluster := kubernetesupgrade.UpgradeCluster{
+		Translator:     translatorOrDefault(o.Translator),
+		Logger:         loggerOrDefault(o.Logger),
+		Client:         o.Client,
+		StepTimeout:    o.StepTimeout,
+		Journal:        o.Journal,
+		MaxSurge:       o.MaxSurge,
+		MaxUnavailable: o.MaxUnavailable,
+		Concurrency:    o.Concurrency,
+		UpgradeTimeout: o.UpgradeTimeout,
+		Context:        ctx,
+	}
+	err = upgradeCluster.UpgradeCluster(o.SubscriptionID, o.Client, kubeConfig, o.ResourceGroup,
+		o.ContainerService, o.NameSuffix, agentPools, o.BuildTag)
+	return &UpgradeResult{UpgradedNodes: o.Journal.UpgradedNodes()}, err
+}
+
+// setUpgradeVersion sets the orchestrator version of a cluster to a version it can be upgraded to
+func setUpgradeVersion(cs *api.ContainerService, upgradeVersion string) error {
+	orchestratorProfile := cs.Properties.OrchestratorProfile
+	orchestratorInfo, err := api.GetOrchestratorVersionProfile(orchestratorProfile, cs.Properties.HasWindows())
+	if err != nil {
+		return errors.Wrap(err, "error getting list of available upgrades")
+	}
+
+	// the current version can be upgraded to again if an upgrade has failed
+	if upgradeVersion == orchestratorProfile.OrchestratorVersion {
+		return nil
+	}
+	for _, up := range orchestratorInfo.Upgrades {
+		if up.OrchestratorVersion == upgradeVersion {
+			orchestratorProfile.OrchestratorVersion = upgradeVersion
+			return nil
+		}
+	}
+	return errors.Errorf("Upgrading to version %s is not supported. To see a list of available upgrades, use 'acs-engine orchestrators --orchestrator kubernetes --version %s'", upgradeVersion, orchestratorProfile.OrchestratorVersion)
+}
@@ -0,0 +1,28 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUpgradeVersion(t *testing.T) {
+	cs, _ := loadContainerService(t, "../acsengine/testdata/simple/kubernetes.json")
+	cs.Properties.OrchestratorProfile.OrchestratorVersion = "1.7.9"
+
+	_, err := Upgrade(context.Background(), UpgradeOptions{ContainerService: cs, UpgradeVersion: "1.6.9"})
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("expected a validation error upgrading to an older version, got %v", err)
+	}
+	if err = setUpgradeVersion(cs, "1.7.16"); err != nil {
+		t.Fatalf("unexpected error setting the upgrade version: %s", err)
+	}
+	if cs.Properties.OrchestratorProfile.OrchestratorVersion != "1.7.16" {
+		t.Fatalf("expected the orchestrator version to be set to 1.7.16, got %s", cs.Properties.OrchestratorProfile.OrchestratorVersion)
+	}
+	if err = setUpgradeVersion(cs, "1.7.16"); err != nil {
+		t.Fatalf("expected the current version to be accepted to resume a failed upgrade, got %s", err)
+	}
+}
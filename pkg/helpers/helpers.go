@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"runtime"
 	"strings"
 
@@ -24,6 +25,28 @@ const (
 	SSHKeySize = 4096
 )
 
+var keyvaultSecretPathRe = regexp.MustCompile(`^(/subscriptions/\S+/resourceGroups/\S+/providers/Microsoft.KeyVault/vaults/\S+)/secrets/([^/\s]+)(/(\S+))?$`)
+
+// ParseKeyvaultSecretPath splits a reference to a Key Vault secret, of the form
+// /subscriptions/<SUB_ID>/resourceGroups/<RG_NAME>/providers/Microsoft.KeyVault/vaults/<KV_NAME>/secrets/<NAME>[/<VERSION>],
+// into the ID of the vault, the name of the secret and its version. ok is false when s is not a reference.
+func ParseKeyvaultSecretPath(s string) (vaultID, secretName, version string, ok bool) {
+	parts := keyvaultSecretPathRe.FindStringSubmatch(s)
+	if len(parts) != 5 {
+		return "", "", "", false
+	}
+	return parts[1], parts[2], parts[4], true
+}
+
+// KeyvaultSecretPath returns the reference to a version of a Key Vault secret parsed by ParseKeyvaultSecretPath
+func KeyvaultSecretPath(vaultID, secretName, version string) string {
+	path := vaultID + "/secrets/" + secretName
+	if version != "" {
+		path += "/" + version
+	}
+	return path
+}
+
 // NormalizeAzureRegion returns a normalized Azure region with white spaces removed and converted to lower case
 func NormalizeAzureRegion(name string) string {
 	return strings.ToLower(strings.Replace(name, " ", "", -1))
@@ -174,7 +197,10 @@ func CreateSaveSSH(username, outputDirectory string, s *i18n.Translator) (privat
 		return nil, "", err
 	}
 
-	privateKeyPem := privateKeyToPem(privateKey)
+	privateKeyPem, err := privateKeyToPem(privateKey)
+	if err != nil {
+		return nil, "", err
+	}
 
 	f := &FileSaver{
 		Translator: s,
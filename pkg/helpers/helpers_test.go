@@ -253,6 +253,30 @@ func TestEqualError(t *testing.T) {
 	}
 }
 
+func TestParseKeyvaultSecretPath(t *testing.T) {
+	vaultID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv"
+	testcases := []struct {
+		path      string
+		secret    string
+		version   string
+		reference bool
+	}{
+		{vaultID + "/secrets/name", "name", "", true},
+		{vaultID + "/secrets/name/0123", "name", "0123", true},
+		{vaultID, "", "", false},
+		{"-----BEGIN CERTIFICATE-----", "", "", false},
+	}
+	for _, tc := range testcases {
+		id, secret, version, ok := ParseKeyvaultSecretPath(tc.path)
+		if ok != tc.reference || (ok && (id != vaultID || secret != tc.secret || version != tc.version)) {
+			t.Errorf("unexpected result parsing %s: %s %s %s %t", tc.path, id, secret, version, ok)
+		}
+		if ok && KeyvaultSecretPath(id, secret, version) != tc.path {
+			t.Errorf("expected KeyvaultSecretPath to return %s, got %s", tc.path, KeyvaultSecretPath(id, secret, version))
+		}
+	}
+}
+
 func TestShellQuote(t *testing.T) {
 	testcases := []struct {
 		input    string
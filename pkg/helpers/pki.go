@@ -5,17 +5,21 @@ package helpers
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
-	"errors"
 	"fmt"
 	"math/big"
 	"net"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 
 	log "github.com/sirupsen/logrus"
@@ -26,26 +30,186 @@ const (
 	ValidityDuration = time.Hour * 24 * 365 * 2
 	// PkiKeySize is the size in bytes of the PKI key
 	PkiKeySize = 4096
+	// PkiKeyAlgorithmRSA generates RSA keys
+	PkiKeyAlgorithmRSA = "RSA"
+	// PkiKeyAlgorithmECDSA generates ECDSA keys
+	PkiKeyAlgorithmECDSA = "ECDSA"
+	// DefaultECDSAKeySize is the size of the curve of the ECDSA keys, P-256
+	DefaultECDSAKeySize = 256
+	// MinRSAKeySize is the smallest RSA key size accepted
+	MinRSAKeySize = 2048
 )
 
+// PkiCertClass is a class of certificates sharing a validity period
+type PkiCertClass string
+
+const (
+	// PkiCertClassCA is the class of the certificate authorities
+	PkiCertClassCA PkiCertClass = "ca"
+	// PkiCertClassServer is the class of the server certificates, such as those of the API server and the etcd peers
+	PkiCertClassServer PkiCertClass = "server"
+	// PkiCertClassClient is the class of the client certificates, such as those of kubelet and kubectl
+	PkiCertClassClient PkiCertClass = "client"
+)
+
+// PkiOptions are the options of the keys and certificates generated for a cluster. A nil
+// *PkiOptions generates RSA keys of PkiKeySize bits and certificates valid for ValidityDuration.
+type PkiOptions struct {
+	// KeyAlgorithm is PkiKeyAlgorithmRSA or PkiKeyAlgorithmECDSA; empty means RSA
+	KeyAlgorithm string
+	// KeySize is the size of the RSA keys in bits, or the size of the ECDSA curve: 256, 384 or 521
+	KeySize int
+	// CAValidity, ServerValidity and ClientValidity are how long the certificates of each class
+	// are valid; 0 keeps the default of the generator
+	CAValidity     time.Duration
+	ServerValidity time.Duration
+	ClientValidity time.Duration
+	// CAChain are the PEM encoded certificates of the authorities above the certificate authority
+	// of the cluster, from its issuer up to the root, when it is an intermediate of another PKI.
+	// The server certificates are bundled with the certificate authority and the intermediates
+	// of the chain, without the root.
+	CAChain string
+}
+
+// Validity returns how long the certificates of class are valid, or defaultValidity when the
+// options do not set it
+func (o *PkiOptions) Validity(class PkiCertClass, defaultValidity time.Duration) time.Duration {
+	if o == nil {
+		return defaultValidity
+	}
+	validity := map[PkiCertClass]time.Duration{
+		PkiCertClassCA:     o.CAValidity,
+		PkiCertClassServer: o.ServerValidity,
+		PkiCertClassClient: o.ClientValidity,
+	}[class]
+	if validity <= 0 {
+		return defaultValidity
+	}
+	return validity
+}
+
+// IsECDSA returns true when the options generate ECDSA keys
+func (o *PkiOptions) IsECDSA() bool {
+	return o != nil && strings.EqualFold(o.KeyAlgorithm, PkiKeyAlgorithmECDSA)
+}
+
+// ECDSACurve returns the elliptic curve of the given size in bits
+func ECDSACurve(size int) (elliptic.Curve, error) {
+	switch size {
+	case 0, DefaultECDSAKeySize:
+		return elliptic.P256(), nil
+	case 384:
+		return elliptic.P384(), nil
+	case 521:
+		return elliptic.P521(), nil
+	}
+	return nil, errors.Errorf("unsupported ECDSA key size %d, expected 256, 384 or 521", size)
+}
+
+// GeneratePkiKey generates the key named label of source with the algorithm and size of the
+// options. RSA keys have defaultRSABits bits unless the options set their size.
+func GeneratePkiKey(options *PkiOptions, defaultRSABits int, source *SecretSource, label string) (crypto.Signer, error) {
+	if options.IsECDSA() {
+		curve, err := ECDSACurve(options.KeySize)
+		if err != nil {
+			return nil, err
+		}
+		return source.GenerateECDSAKey(label, curve)
+	}
+	if options != nil && options.KeyAlgorithm != "" && !strings.EqualFold(options.KeyAlgorithm, PkiKeyAlgorithmRSA) {
+		return nil, errors.Errorf("unsupported key algorithm %s, expected %s or %s", options.KeyAlgorithm, PkiKeyAlgorithmRSA, PkiKeyAlgorithmECDSA)
+	}
+	bits := defaultRSABits
+	if options != nil && options.KeySize > 0 {
+		bits = options.KeySize
+	}
+	if bits < MinRSAKeySize {
+		return nil, errors.Errorf("RSA keys must have at least %d bits, got %d", MinRSAKeySize, bits)
+	}
+	return source.GenerateRSAKey(label, bits)
+}
+
+// ValidateCAChain checks that a certificate authority and its key can sign the certificates
+// of a cluster, and that chain links it to a self-signed root
+func ValidateCAChain(caCertificatePem, caPrivateKeyPem, chain string) error {
+	caCertificate, err := pemToCertificate(caCertificatePem)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the certificate authority")
+	}
+	if !caCertificate.IsCA {
+		return errors.New("the certificate authority is not a CA certificate")
+	}
+	caPrivateKey, err := pemToKey(caPrivateKeyPem)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the key of the certificate authority")
+	}
+	if !publicKeysEqual(caCertificate.PublicKey, caPrivateKey.Public()) {
+		return errors.New("the key of the certificate authority does not match its certificate")
+	}
+	if chain == "" {
+		return nil
+	}
+
+	certificates, err := pemToCertificates(chain)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the certificate chain")
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	hasRoot := false
+	for _, c := range certificates {
+		if isSelfSigned(c) {
+			roots.AddCert(c)
+			hasRoot = true
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+	if !hasRoot {
+		return errors.New("the certificate chain does not end with a self-signed root")
+	}
+	if _, err = caCertificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return errors.Wrap(err, "the certificate authority is not issued by the certificate chain")
+	}
+	return nil
+}
+
 // PkiKeyCertPair represents an PKI public and private cert pair
 type PkiKeyCertPair struct {
 	CertificatePem string
 	PrivateKeyPem  string
 }
 
-// CreatePkiKeyCertPair generates a pair of PKI certificate and private key
-func CreatePkiKeyCertPair(commonName string) (*PkiKeyCertPair, error) {
-	caCertificate, caPrivateKey, err := createCertificate(commonName, nil, nil, false, false, nil, nil, nil)
+// CreatePkiKeyCertPair generates a pair of PKI certificate and private key from source;
+// a nil source generates a random pair
+func CreatePkiKeyCertPair(commonName string, source *SecretSource, options *PkiOptions) (*PkiKeyCertPair, error) {
+	caCertificate, caPrivateKey, err := createCertificate(commonName, nil, nil, false, false, nil, nil, nil, source, options, commonName)
 	if err != nil {
 		return nil, err
 	}
-	caPair := &PkiKeyCertPair{CertificatePem: string(certificateToPem(caCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(caPrivateKey))}
-	return caPair, nil
+	return newPkiKeyCertPair(caCertificate, caPrivateKey, "")
 }
 
-// CreatePki creates PKI certificates
-func CreatePki(extraFQDNs []string, extraIPs []net.IP, clusterDomain string, caPair *PkiKeyCertPair, masterCount int) (*PkiKeyCertPair, *PkiKeyCertPair, *PkiKeyCertPair, *PkiKeyCertPair, *PkiKeyCertPair, []*PkiKeyCertPair, error) {
+// ParsePkiKeyCertPair parses the certificate and the private key of a pair
+func ParsePkiKeyCertPair(pair *PkiKeyCertPair) (*x509.Certificate, crypto.Signer, error) {
+	certificate, err := pemToCertificate(pair.CertificatePem)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing the certificate")
+	}
+	key, err := pemToKey(pair.PrivateKeyPem)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing the private key")
+	}
+	return certificate, key, nil
+}
+
+// CreatePki creates PKI certificates from source; a nil source creates random certificates.
+// The server certificates are bundled with the chain of the certificate authority when the
+// options have one.
+func CreatePki(extraFQDNs []string, extraIPs []net.IP, clusterDomain string, caPair *PkiKeyCertPair, masterCount int, source *SecretSource, options *PkiOptions) (*PkiKeyCertPair, *PkiKeyCertPair, *PkiKeyCertPair, *PkiKeyCertPair, *PkiKeyCertPair, []*PkiKeyCertPair, error) {
 	start := time.Now()
 	defer func(s time.Time) {
 		log.Debugf("pki: PKI asset creation took %s", time.Since(s))
@@ -60,17 +224,17 @@ func CreatePki(extraFQDNs []string, extraIPs []net.IP, clusterDomain string, caP
 
 	var (
 		caCertificate         *x509.Certificate
-		caPrivateKey          *rsa.PrivateKey
+		caPrivateKey          crypto.Signer
 		apiServerCertificate  *x509.Certificate
-		apiServerPrivateKey   *rsa.PrivateKey
+		apiServerPrivateKey   crypto.Signer
 		clientCertificate     *x509.Certificate
-		clientPrivateKey      *rsa.PrivateKey
+		clientPrivateKey      crypto.Signer
 		kubeConfigCertificate *x509.Certificate
-		kubeConfigPrivateKey  *rsa.PrivateKey
+		kubeConfigPrivateKey  crypto.Signer
 		etcdServerCertificate *x509.Certificate
-		etcdServerPrivateKey  *rsa.PrivateKey
+		etcdServerPrivateKey  crypto.Signer
 		etcdClientCertificate *x509.Certificate
-		etcdClientPrivateKey  *rsa.PrivateKey
+		etcdClientPrivateKey  crypto.Signer
 		etcdPeerCertPairs     []*PkiKeyCertPair
 	)
 	var group errgroup.Group
@@ -84,37 +248,41 @@ func CreatePki(extraFQDNs []string, extraIPs []net.IP, clusterDomain string, caP
 	if err != nil {
 		return nil, nil, nil, nil, nil, nil, err
 	}
+	chain, err := ServerChain(caPair.CertificatePem, options)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, err
+	}
 
 	group.Go(func() (err error) {
-		apiServerCertificate, apiServerPrivateKey, err = createCertificate("apiserver", caCertificate, caPrivateKey, false, true, extraFQDNs, extraIPs, nil)
+		apiServerCertificate, apiServerPrivateKey, err = createCertificate("apiserver", caCertificate, caPrivateKey, false, true, extraFQDNs, extraIPs, nil, source, options, "apiserver")
 		return err
 	})
 
 	group.Go(func() (err error) {
 		organization := make([]string, 1)
 		organization[0] = "system:masters"
-		clientCertificate, clientPrivateKey, err = createCertificate("client", caCertificate, caPrivateKey, false, false, nil, nil, organization)
+		clientCertificate, clientPrivateKey, err = createCertificate("client", caCertificate, caPrivateKey, false, false, nil, nil, organization, source, options, "client")
 		return err
 	})
 
 	group.Go(func() (err error) {
 		organization := make([]string, 1)
 		organization[0] = "system:masters"
-		kubeConfigCertificate, kubeConfigPrivateKey, err = createCertificate("client", caCertificate, caPrivateKey, false, false, nil, nil, organization)
+		kubeConfigCertificate, kubeConfigPrivateKey, err = createCertificate("client", caCertificate, caPrivateKey, false, false, nil, nil, organization, source, options, "kubeconfig")
 		return err
 	})
 
 	group.Go(func() (err error) {
 		ip := net.ParseIP("127.0.0.1").To4()
 		peerIPs := append(extraIPs, ip)
-		etcdServerCertificate, etcdServerPrivateKey, err = createCertificate("etcdserver", caCertificate, caPrivateKey, true, true, nil, peerIPs, nil)
+		etcdServerCertificate, etcdServerPrivateKey, err = createCertificate("etcdserver", caCertificate, caPrivateKey, true, true, nil, peerIPs, nil, source, options, "etcdserver")
 		return err
 	})
 
 	group.Go(func() (err error) {
 		ip := net.ParseIP("127.0.0.1").To4()
 		peerIPs := append(extraIPs, ip)
-		etcdClientCertificate, etcdClientPrivateKey, err = createCertificate("etcdclient", caCertificate, caPrivateKey, true, false, nil, peerIPs, nil)
+		etcdClientCertificate, etcdClientPrivateKey, err = createCertificate("etcdclient", caCertificate, caPrivateKey, true, false, nil, peerIPs, nil, source, options, "etcdclient")
 		return err
 	})
 
@@ -124,8 +292,11 @@ func CreatePki(extraFQDNs []string, extraIPs []net.IP, clusterDomain string, caP
 		group.Go(func() (err error) {
 			ip := net.ParseIP("127.0.0.1").To4()
 			peerIPs := append(extraIPs, ip)
-			etcdPeerCertificate, etcdPeerPrivateKey, err := createCertificate("etcdpeer", caCertificate, caPrivateKey, true, false, nil, peerIPs, nil)
-			etcdPeerCertPairs[i] = &PkiKeyCertPair{CertificatePem: string(certificateToPem(etcdPeerCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(etcdPeerPrivateKey))}
+			etcdPeerCertificate, etcdPeerPrivateKey, err := createCertificate("etcdpeer", caCertificate, caPrivateKey, true, false, nil, peerIPs, nil, source, options, fmt.Sprintf("etcdpeer%d", i))
+			if err != nil {
+				return err
+			}
+			etcdPeerCertPairs[i], err = newPkiKeyCertPair(etcdPeerCertificate, etcdPeerPrivateKey, chain)
 			return err
 		})
 	}
@@ -134,30 +305,89 @@ func CreatePki(extraFQDNs []string, extraIPs []net.IP, clusterDomain string, caP
 		return nil, nil, nil, nil, nil, nil, err
 	}
 
-	return &PkiKeyCertPair{CertificatePem: string(certificateToPem(apiServerCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(apiServerPrivateKey))},
-		&PkiKeyCertPair{CertificatePem: string(certificateToPem(clientCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(clientPrivateKey))},
-		&PkiKeyCertPair{CertificatePem: string(certificateToPem(kubeConfigCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(kubeConfigPrivateKey))},
-		&PkiKeyCertPair{CertificatePem: string(certificateToPem(etcdServerCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(etcdServerPrivateKey))},
-		&PkiKeyCertPair{CertificatePem: string(certificateToPem(etcdClientCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(etcdClientPrivateKey))},
-		etcdPeerCertPairs,
-		nil
+	pairs := make([]*PkiKeyCertPair, 5)
+	for i, p := range []struct {
+		certificate *x509.Certificate
+		key         crypto.Signer
+		chain       string
+	}{
+		{apiServerCertificate, apiServerPrivateKey, chain},
+		{clientCertificate, clientPrivateKey, ""},
+		{kubeConfigCertificate, kubeConfigPrivateKey, ""},
+		{etcdServerCertificate, etcdServerPrivateKey, chain},
+		{etcdClientCertificate, etcdClientPrivateKey, ""},
+	} {
+		if pairs[i], err = newPkiKeyCertPair(p.certificate, p.key, p.chain); err != nil {
+			return nil, nil, nil, nil, nil, nil, err
+		}
+	}
+	return pairs[0], pairs[1], pairs[2], pairs[3], pairs[4], etcdPeerCertPairs, nil
+}
+
+// newPkiKeyCertPair encodes a certificate, followed by chain, and its key
+func newPkiKeyCertPair(certificate *x509.Certificate, key crypto.Signer, chain string) (*PkiKeyCertPair, error) {
+	keyPem, err := privateKeyToPem(key)
+	if err != nil {
+		return nil, err
+	}
+	return &PkiKeyCertPair{CertificatePem: string(certificateToPem(certificate.Raw)) + chain, PrivateKeyPem: string(keyPem)}, nil
 }
 
-func createCertificate(commonName string, caCertificate *x509.Certificate, caPrivateKey *rsa.PrivateKey, isEtcd bool, isServer bool, extraFQDNs []string, extraIPs []net.IP, organization []string) (*x509.Certificate, *rsa.PrivateKey, error) {
+// ServerChain returns the certificates the server certificates are bundled with: the certificate
+// authority and the intermediates of the chain of the options, without the root
+func ServerChain(caCertificatePem string, options *PkiOptions) (string, error) {
+	if options == nil || options.CAChain == "" {
+		return "", nil
+	}
+	caCertificate, err := pemToCertificate(caCertificatePem)
+	if err != nil {
+		return "", err
+	}
+	certificates, err := pemToCertificates(options.CAChain)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing the certificate chain")
+	}
+	chain := string(certificateToPem(caCertificate.Raw))
+	for _, c := range certificates {
+		if !isSelfSigned(c) {
+			chain += string(certificateToPem(c.Raw))
+		}
+	}
+	return chain, nil
+}
+
+// createCertificate creates a certificate and its key from the secret of source named label.
+// The certificate does not outlive the certificate authority signing it.
+func createCertificate(commonName string, caCertificate *x509.Certificate, caPrivateKey crypto.Signer, isEtcd bool, isServer bool, extraFQDNs []string, extraIPs []net.IP, organization []string, source *SecretSource, options *PkiOptions, label string) (*x509.Certificate, crypto.Signer, error) {
 	var err error
 
 	isCA := (caCertificate == nil)
 
-	now := time.Now()
+	now := source.Now()
+
+	class := PkiCertClassClient
+	if isCA {
+		class = PkiCertClassCA
+	} else if isServer || (isEtcd && commonName != "etcdclient") {
+		class = PkiCertClassServer
+	}
+	notAfter := now.Add(options.Validity(class, ValidityDuration))
+	if !isCA && notAfter.After(caCertificate.NotAfter) {
+		notAfter = caCertificate.NotAfter
+	}
 
 	template := x509.Certificate{
 		Subject:   pkix.Name{CommonName: commonName},
 		NotBefore: now,
-		NotAfter:  now.Add(ValidityDuration),
+		NotAfter:  notAfter,
 
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
 		BasicConstraintsValid: true,
 	}
+	// ECDSA keys cannot encipher keys
+	if !options.IsECDSA() {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
 
 	if organization != nil {
 		template.Subject.Organization = organization
@@ -187,14 +417,17 @@ func createCertificate(commonName string, caCertificate *x509.Certificate, caPri
 	}
 
 	snMax := new(big.Int).Lsh(big.NewInt(1), 128)
-	template.SerialNumber, err = rand.Int(rand.Reader, snMax)
+	template.SerialNumber, err = rand.Int(source.Reader(label+"/serial"), snMax)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	privateKey, _ := rsa.GenerateKey(rand.Reader, PkiKeySize)
+	privateKey, err := GeneratePkiKey(options, PkiKeySize, source, label)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	var privateKeyToUse *rsa.PrivateKey
+	var privateKeyToUse crypto.Signer
 	var certificateToUse *x509.Certificate
 	if !isCA {
 		privateKeyToUse = caPrivateKey
@@ -204,7 +437,7 @@ func createCertificate(commonName string, caCertificate *x509.Certificate, caPri
 		certificateToUse = &template
 	}
 
-	certDerBytes, err := x509.CreateCertificate(rand.Reader, &template, certificateToUse, &privateKey.PublicKey, privateKeyToUse)
+	certDerBytes, err := x509.CreateCertificate(source.Reader(label+"/signature"), &template, certificateToUse, privateKey.Public(), source.Signer(privateKeyToUse))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -228,15 +461,30 @@ func certificateToPem(derBytes []byte) []byte {
 	return pemBuffer.Bytes()
 }
 
-func privateKeyToPem(privateKey *rsa.PrivateKey) []byte {
-	pemBlock := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+func privateKeyToPem(privateKey crypto.Signer) ([]byte, error) {
+	var pemBlock *pem.Block
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		pemBlock = &pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		}
+	case *ecdsa.PrivateKey:
+		b, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		pemBlock = &pem.Block{
+			Type:  "EC PRIVATE KEY",
+			Bytes: b,
+		}
+	default:
+		return nil, errors.Errorf("unsupported private key type %T", privateKey)
 	}
 	pemBuffer := bytes.Buffer{}
 	pem.Encode(&pemBuffer, pemBlock)
 
-	return pemBuffer.Bytes()
+	return pemBuffer.Bytes(), nil
 }
 
 func pemToCertificate(raw string) (*x509.Certificate, error) {
@@ -247,10 +495,63 @@ func pemToCertificate(raw string) (*x509.Certificate, error) {
 	return x509.ParseCertificate(cpb.Bytes)
 }
 
-func pemToKey(raw string) (*rsa.PrivateKey, error) {
+// pemToCertificates parses every certificate of a PEM bundle
+func pemToCertificates(raw string) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	rest := []byte(raw)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, c)
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("The raw pem has no certificate")
+	}
+	return certificates, nil
+}
+
+// pemToKey parses an RSA or ECDSA private key, in PKCS #1, SEC 1 or PKCS #8 form
+func pemToKey(raw string) (crypto.Signer, error) {
 	kpb, _ := pem.Decode([]byte(raw))
 	if kpb == nil {
 		return nil, errors.New("The raw pem is not a valid PEM formatted block")
 	}
+	switch kpb.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(kpb.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(kpb.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
 	return x509.ParsePKCS1PrivateKey(kpb.Bytes)
 }
+
+func isSelfSigned(c *x509.Certificate) bool {
+	return bytes.Equal(c.RawSubject, c.RawIssuer) && c.CheckSignatureFrom(c) == nil
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	ab, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	bb, err := x509.MarshalPKIXPublicKey(b)
+	return err == nil && bytes.Equal(ab, bb)
+}
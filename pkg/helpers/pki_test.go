@@ -4,11 +4,13 @@
 package helpers
 
 import (
-	"crypto/rsa"
+	"crypto"
+	"crypto/rand"
 	"crypto/x509"
 	"encoding/pem"
 	"net"
 	"testing"
+	"time"
 )
 
 func TestCreateCertificateWithOrganisation(t *testing.T) {
@@ -17,15 +19,18 @@ func TestCreateCertificateWithOrganisation(t *testing.T) {
 
 	var (
 		caCertificate   *x509.Certificate
-		caPrivateKey    *rsa.PrivateKey
+		caPrivateKey    crypto.Signer
 		testCertificate *x509.Certificate
 	)
 
-	caCertificate, caPrivateKey, err = createCertificate("ca", nil, nil, false, false, nil, nil, nil)
+	caCertificate, caPrivateKey, err = createCertificate("ca", nil, nil, false, false, nil, nil, nil, nil, nil, "ca")
 	if err != nil {
 		t.Fatalf("failed to generate certificate: %s", err)
 	}
-	caPair = &PkiKeyCertPair{CertificatePem: string(certificateToPem(caCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(caPrivateKey))}
+	caPair, err = newPkiKeyCertPair(caCertificate, caPrivateKey, "")
+	if err != nil {
+		t.Fatalf("failed to encode certificate: %s", err)
+	}
 
 	caCertificate, err = pemToCertificate(caPair.CertificatePem)
 	if err != nil {
@@ -38,7 +43,7 @@ func TestCreateCertificateWithOrganisation(t *testing.T) {
 
 	organization := make([]string, 1)
 	organization[0] = "system:masters"
-	testCertificate, _, err = createCertificate("client", caCertificate, caPrivateKey, false, false, nil, nil, organization)
+	testCertificate, _, err = createCertificate("client", caCertificate, caPrivateKey, false, false, nil, nil, organization, nil, nil, "client")
 	if err != nil {
 		t.Fatalf("failed to generate certificate: %s", err)
 	}
@@ -56,15 +61,18 @@ func TestCreateCertificateWithoutOrganisation(t *testing.T) {
 
 	var (
 		caCertificate   *x509.Certificate
-		caPrivateKey    *rsa.PrivateKey
+		caPrivateKey    crypto.Signer
 		testCertificate *x509.Certificate
 	)
 
-	caCertificate, caPrivateKey, err = createCertificate("ca", nil, nil, false, false, nil, nil, nil)
+	caCertificate, caPrivateKey, err = createCertificate("ca", nil, nil, false, false, nil, nil, nil, nil, nil, "ca")
 	if err != nil {
 		t.Fatalf("failed to generate certificate: %s", err)
 	}
-	caPair = &PkiKeyCertPair{CertificatePem: string(certificateToPem(caCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(caPrivateKey))}
+	caPair, err = newPkiKeyCertPair(caCertificate, caPrivateKey, "")
+	if err != nil {
+		t.Fatalf("failed to encode certificate: %s", err)
+	}
 
 	caCertificate, err = pemToCertificate(caPair.CertificatePem)
 	if err != nil {
@@ -75,7 +83,7 @@ func TestCreateCertificateWithoutOrganisation(t *testing.T) {
 		t.Fatalf("failed to generate certificate: %s", err)
 	}
 
-	testCertificate, _, err = createCertificate("client", caCertificate, caPrivateKey, false, false, nil, nil, nil)
+	testCertificate, _, err = createCertificate("client", caCertificate, caPrivateKey, false, false, nil, nil, nil, nil, nil, "client")
 	if err != nil {
 		t.Fatalf("failed to generate certificate: %s", err)
 	}
@@ -92,11 +100,14 @@ func TestSubjectAltNameInCert(t *testing.T) {
 	roots := x509.NewCertPool()
 
 	// Prepare CA and add it to certificate store.
-	caCertificate, caPrivateKey, err := createCertificate("ca", nil, nil, false, false, nil, nil, nil)
+	caCertificate, caPrivateKey, err := createCertificate("ca", nil, nil, false, false, nil, nil, nil, nil, nil, "ca")
 	if err != nil {
 		t.Fatalf("failed to generate CA certificates: %s.", err)
 	}
-	caPair := &PkiKeyCertPair{CertificatePem: string(certificateToPem(caCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(caPrivateKey))}
+	caPair, err := newPkiKeyCertPair(caCertificate, caPrivateKey, "")
+	if err != nil {
+		t.Fatalf("failed to encode CA certificates: %s.", err)
+	}
 
 	ok := roots.AppendCertsFromPEM([]byte(caPair.CertificatePem))
 	if !ok {
@@ -157,7 +168,7 @@ func TestSubjectAltNameInCert(t *testing.T) {
 	masterExtraFQDNs := append(formattedDNSPrefixes, SubjectAltNames...)
 	expectedDNSNames := []string{"santest.australiaeast.cloudapp.azure.com", "santest.australiasoutheast.cloudapp.azure.com", "santest.brazilsouth.cloudapp.azure.com", "santest.canadacentral.cloudapp.azure.com", "santest.canadaeast.cloudapp.azure.com", "santest.centralindia.cloudapp.azure.com", "santest.centralus.cloudapp.azure.com", "santest.centraluseuap.cloudapp.azure.com", "santest.chinaeast.cloudapp.chinacloudapi.cn", "santest.chinaeast2.cloudapp.chinacloudapi.cn", "santest.chinanorth.cloudapp.chinacloudapi.cn", "santest.chinanorth2.cloudapp.chinacloudapi.cn", "santest.eastasia.cloudapp.azure.com", "santest.eastus.cloudapp.azure.com", "santest.eastus2.cloudapp.azure.com", "santest.eastus2euap.cloudapp.azure.com", "santest.japaneast.cloudapp.azure.com", "santest.japanwest.cloudapp.azure.com", "santest.koreacentral.cloudapp.azure.com", "santest.koreasouth.cloudapp.azure.com", "santest.northcentralus.cloudapp.azure.com", "santest.northeurope.cloudapp.azure.com", "santest.southcentralus.cloudapp.azure.com", "santest.southeastasia.cloudapp.azure.com", "santest.southindia.cloudapp.azure.com", "santest.uksouth.cloudapp.azure.com", "santest.ukwest.cloudapp.azure.com", "santest.westcentralus.cloudapp.azure.com", "santest.westeurope.cloudapp.azure.com", "santest.westindia.cloudapp.azure.com", "santest.westus.cloudapp.azure.com", "santest.westus2.cloudapp.azure.com", "santest.chinaeast.cloudapp.chinacloudapi.cn", "santest.chinanorth.cloudapp.chinacloudapi.cn", "santest.germanycentral.cloudapp.microsoftazure.de", "santest.germanynortheast.cloudapp.microsoftazure.de", "santest.usgovvirginia.cloudapp.usgovcloudapi.net", "santest.usgoviowa.cloudapp.usgovcloudapi.net", "santest.usgovarizona.cloudapp.usgovcloudapi.net", "santest.usgovtexas.cloudapp.usgovcloudapi.net", "santest.francecentral.cloudapp.azure.com", "santest.mydomain.com", "santest2.testdomain.net", "kubernetes", "kubernetes.default", "kubernetes.default.svc", "kubernetes.default.svc.cluster.local", "kubernetes.kube-system", "kubernetes.kube-system.svc", "kubernetes.kube-system.svc.cluster.local"}
 
-	apiServerPair, _, _, _, _, _, err := CreatePki(masterExtraFQDNs, extraIPs, "cluster.local", caPair, 1)
+	apiServerPair, _, _, _, _, _, err := CreatePki(masterExtraFQDNs, extraIPs, "cluster.local", caPair, 1, nil, nil)
 
 	if err != nil {
 		t.Fatalf("failed to generate certificates: %s.", err)
@@ -193,7 +204,7 @@ func TestSubjectAltNameInCert(t *testing.T) {
 	masterExtraFQDNs = append(formattedDNSPrefixes, SubjectAltNames...)
 	expectedDNSNames = []string{"santest.australiaeast.cloudapp.azure.com", "santest.australiasoutheast.cloudapp.azure.com", "santest.brazilsouth.cloudapp.azure.com", "santest.canadacentral.cloudapp.azure.com", "santest.canadaeast.cloudapp.azure.com", "santest.centralindia.cloudapp.azure.com", "santest.centralus.cloudapp.azure.com", "santest.centraluseuap.cloudapp.azure.com", "santest.chinaeast.cloudapp.chinacloudapi.cn", "santest.chinaeast2.cloudapp.chinacloudapi.cn", "santest.chinanorth.cloudapp.chinacloudapi.cn", "santest.chinanorth2.cloudapp.chinacloudapi.cn", "santest.eastasia.cloudapp.azure.com", "santest.eastus.cloudapp.azure.com", "santest.eastus2.cloudapp.azure.com", "santest.eastus2euap.cloudapp.azure.com", "santest.japaneast.cloudapp.azure.com", "santest.japanwest.cloudapp.azure.com", "santest.koreacentral.cloudapp.azure.com", "santest.koreasouth.cloudapp.azure.com", "santest.northcentralus.cloudapp.azure.com", "santest.northeurope.cloudapp.azure.com", "santest.southcentralus.cloudapp.azure.com", "santest.southeastasia.cloudapp.azure.com", "santest.southindia.cloudapp.azure.com", "santest.uksouth.cloudapp.azure.com", "santest.ukwest.cloudapp.azure.com", "santest.westcentralus.cloudapp.azure.com", "santest.westeurope.cloudapp.azure.com", "santest.westindia.cloudapp.azure.com", "santest.westus.cloudapp.azure.com", "santest.westus2.cloudapp.azure.com", "santest.chinaeast.cloudapp.chinacloudapi.cn", "santest.chinanorth.cloudapp.chinacloudapi.cn", "santest.germanycentral.cloudapp.microsoftazure.de", "santest.germanynortheast.cloudapp.microsoftazure.de", "santest.usgovvirginia.cloudapp.usgovcloudapi.net", "santest.usgoviowa.cloudapp.usgovcloudapi.net", "santest.usgovarizona.cloudapp.usgovcloudapi.net", "santest.usgovtexas.cloudapp.usgovcloudapi.net", "santest.francecentral.cloudapp.azure.com", "kubernetes", "kubernetes.default", "kubernetes.default.svc", "kubernetes.default.svc.cluster.local", "kubernetes.kube-system", "kubernetes.kube-system.svc", "kubernetes.kube-system.svc.cluster.local"}
 
-	apiServerPair, _, _, _, _, _, err = CreatePki(masterExtraFQDNs, extraIPs, "cluster.local", caPair, 1)
+	apiServerPair, _, _, _, _, _, err = CreatePki(masterExtraFQDNs, extraIPs, "cluster.local", caPair, 1, nil, nil)
 
 	if err != nil {
 		t.Fatalf("failed to generate certificates: %s.", err)
@@ -227,8 +238,133 @@ func TestSubjectAltNameInCert(t *testing.T) {
 
 func TestCreatePkiKeyCertPair(t *testing.T) {
 	subject := "foosubject"
-	_, err := CreatePkiKeyCertPair(subject)
+	_, err := CreatePkiKeyCertPair(subject, nil, nil)
 	if err != nil {
 		t.Errorf("unexpected error thrown while executing CreatePkiKeyCertPair : %s", err.Error())
 	}
 }
+
+func TestCreatePkiECDSA(t *testing.T) {
+	options := &PkiOptions{
+		KeyAlgorithm:   PkiKeyAlgorithmECDSA,
+		CAValidity:     3 * 365 * 24 * time.Hour,
+		ServerValidity: 365 * 24 * time.Hour,
+		ClientValidity: 30 * 24 * time.Hour,
+	}
+	caPair, err := CreatePkiKeyCertPair("ca", nil, options)
+	if err != nil {
+		t.Fatalf("unexpected error creating the CA: %s", err)
+	}
+	apiServerPair, clientPair, _, _, etcdClientPair, etcdPeerPairs, err := CreatePki(nil, nil, "cluster.local", caPair, 1, nil, options)
+	if err != nil {
+		t.Fatalf("unexpected error creating the certificates: %s", err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		pair     *PkiKeyCertPair
+		validity time.Duration
+	}{
+		{"ca", caPair, options.CAValidity},
+		{"apiserver", apiServerPair, options.ServerValidity},
+		{"etcdpeer0", etcdPeerPairs[0], options.ServerValidity},
+		{"client", clientPair, options.ClientValidity},
+		{"etcdclient", etcdClientPair, options.ClientValidity},
+	} {
+		certificate, err := pemToCertificate(c.pair.CertificatePem)
+		if err != nil {
+			t.Fatalf("unexpected error parsing the %s certificate: %s", c.name, err)
+		}
+		if certificate.PublicKeyAlgorithm != x509.ECDSA || certificate.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+			t.Errorf("expected the %s certificate to have an ECDSA key used for signatures only", c.name)
+		}
+		if validity := certificate.NotAfter.Sub(certificate.NotBefore); validity != c.validity {
+			t.Errorf("expected the %s certificate to be valid for %s, got %s", c.name, c.validity, validity)
+		}
+		key, err := pemToKey(c.pair.PrivateKeyPem)
+		if err != nil {
+			t.Fatalf("unexpected error parsing the %s key: %s", c.name, err)
+		}
+		if !publicKeysEqual(certificate.PublicKey, key.Public()) {
+			t.Errorf("expected the %s key to match its certificate", c.name)
+		}
+	}
+}
+
+func TestCreateCertificateValidityCappedByCA(t *testing.T) {
+	options := &PkiOptions{CAValidity: 24 * time.Hour}
+	caCertificate, caPrivateKey, err := createCertificate("ca", nil, nil, false, false, nil, nil, nil, nil, options, "ca")
+	if err != nil {
+		t.Fatalf("unexpected error creating the CA: %s", err)
+	}
+	certificate, _, err := createCertificate("apiserver", caCertificate, caPrivateKey, false, true, nil, nil, nil, nil, options, "apiserver")
+	if err != nil {
+		t.Fatalf("unexpected error creating the certificate: %s", err)
+	}
+	if !certificate.NotAfter.Equal(caCertificate.NotAfter) {
+		t.Errorf("expected the certificate to expire with the CA on %s, got %s", caCertificate.NotAfter, certificate.NotAfter)
+	}
+}
+
+func TestCreatePkiIntermediateCA(t *testing.T) {
+	// a corporate root and the intermediate of the cluster it issues
+	options := &PkiOptions{KeyAlgorithm: PkiKeyAlgorithmECDSA}
+	rootCertificate, rootPrivateKey, err := createCertificate("root", nil, nil, false, false, nil, nil, nil, nil, options, "root")
+	if err != nil {
+		t.Fatalf("unexpected error creating the root: %s", err)
+	}
+	intermediate, intermediatePrivateKey, err := createCertificate("intermediate", nil, nil, false, false, nil, nil, nil, nil, options, "intermediate")
+	if err != nil {
+		t.Fatalf("unexpected error creating the intermediate: %s", err)
+	}
+	intermediate.IsCA = true
+	intermediateDer, err := x509.CreateCertificate(rand.Reader, intermediate, rootCertificate, intermediatePrivateKey.Public(), rootPrivateKey)
+	if err != nil {
+		t.Fatalf("unexpected error signing the intermediate: %s", err)
+	}
+	intermediateKeyPem, err := privateKeyToPem(intermediatePrivateKey)
+	if err != nil {
+		t.Fatalf("unexpected error encoding the intermediate key: %s", err)
+	}
+	caPair := &PkiKeyCertPair{CertificatePem: string(certificateToPem(intermediateDer)), PrivateKeyPem: string(intermediateKeyPem)}
+	options.CAChain = string(certificateToPem(rootCertificate.Raw))
+
+	if err = ValidateCAChain(caPair.CertificatePem, caPair.PrivateKeyPem, options.CAChain); err != nil {
+		t.Fatalf("unexpected error validating the chain: %s", err)
+	}
+	if err = ValidateCAChain(caPair.CertificatePem, caPair.PrivateKeyPem, caPair.CertificatePem); err == nil {
+		t.Errorf("expected a chain without a root to be rejected")
+	}
+	other, err := CreatePkiKeyCertPair("other", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating another CA: %s", err)
+	}
+	if err = ValidateCAChain(other.CertificatePem, other.PrivateKeyPem, options.CAChain); err == nil {
+		t.Errorf("expected a CA not issued by the chain to be rejected")
+	}
+	if err = ValidateCAChain(caPair.CertificatePem, other.PrivateKeyPem, ""); err == nil {
+		t.Errorf("expected a key not matching the CA to be rejected")
+	}
+
+	apiServerPair, clientPair, _, _, _, _, err := CreatePki(nil, nil, "cluster.local", caPair, 1, nil, options)
+	if err != nil {
+		t.Fatalf("unexpected error creating the certificates: %s", err)
+	}
+	bundle, err := pemToCertificates(apiServerPair.CertificatePem)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the apiserver bundle: %s", err)
+	}
+	if len(bundle) != 2 || bundle[1].Subject.CommonName != "intermediate" {
+		t.Fatalf("expected the apiserver certificate to be bundled with the intermediate only, got %d certificates", len(bundle))
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCertificate)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(bundle[1])
+	if _, err = bundle[0].Verify(x509.VerifyOptions{DNSName: "kubernetes", Roots: roots, Intermediates: intermediates}); err != nil {
+		t.Errorf("expected the apiserver certificate to chain to the root: %s", err)
+	}
+	if clientBundle, _ := pemToCertificates(clientPair.CertificatePem); len(clientBundle) != 1 {
+		t.Errorf("expected the client certificate not to be bundled, got %d certificates", len(clientBundle))
+	}
+}
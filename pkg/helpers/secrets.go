@@ -0,0 +1,204 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package helpers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math/big"
+	mathrand "math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SecretSource supplies the randomness of the keys, certificates and secrets generated
+// for a cluster. A nil *SecretSource uses crypto/rand and the current time. A seeded
+// source derives every secret from its seed, the cluster and a label naming the secret,
+// so that generating the same cluster twice gives the same secrets.
+type SecretSource struct {
+	key       []byte
+	notBefore time.Time
+}
+
+// NewSeededSecretSource returns a source deriving every secret from seed and cluster, such
+// as the DNS prefix of the cluster, so that two clusters generated with the same seed do not
+// share their keys. The certificates it creates are valid from notBefore.
+func NewSeededSecretSource(seed, cluster string, notBefore time.Time) *SecretSource {
+	mac := hmac.New(sha256.New, []byte(seed))
+	mac.Write([]byte(cluster))
+	return &SecretSource{
+		key:       mac.Sum(nil),
+		notBefore: notBefore.UTC(),
+	}
+}
+
+// Reader returns the random stream of the secret named label
+func (s *SecretSource) Reader(label string) io.Reader {
+	if s == nil {
+		return rand.Reader
+	}
+	return &seededReader{key: s.key, label: label}
+}
+
+// Now returns the time the certificates are valid from
+func (s *SecretSource) Now() time.Time {
+	if s == nil {
+		return time.Now()
+	}
+	return s.notBefore
+}
+
+// Signer returns key, signing with the deterministic ECDSA signatures of RFC 6979 when s is seeded,
+// so that the certificates it signs are the same on every run; RSA signatures are deterministic
+func (s *SecretSource) Signer(key crypto.Signer) crypto.Signer {
+	if k, ok := key.(*ecdsa.PrivateKey); ok && s != nil {
+		return deterministicSigner{k}
+	}
+	return key
+}
+
+// deterministicSigner signs without randomness, with the nonce derived from the key and the digest
+type deterministicSigner struct {
+	*ecdsa.PrivateKey
+}
+
+func (d deterministicSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return d.PrivateKey.Sign(nil, digest, opts)
+}
+
+// Int returns a non-negative int named label
+func (s *SecretSource) Int(label string) int {
+	if s == nil {
+		return mathrand.New(mathrand.NewSource(time.Now().UnixNano())).Int()
+	}
+	var b [8]byte
+	io.ReadFull(s.Reader(label), b[:])
+	return int(binary.BigEndian.Uint64(b[:]) >> 1)
+}
+
+// GenerateRSAKey returns an RSA key of the given size for the secret named label.
+// crypto/rsa does not derive keys from the reader it is given, so the keys of a
+// seeded source are built from primes searched in its stream.
+func (s *SecretSource) GenerateRSAKey(label string, bits int) (*rsa.PrivateKey, error) {
+	if s == nil {
+		return rsa.GenerateKey(rand.Reader, bits)
+	}
+	r := s.Reader(label)
+	e := big.NewInt(65537)
+	one := big.NewInt(1)
+	for {
+		p, err := seededPrime(r, bits-bits/2)
+		if err != nil {
+			return nil, err
+		}
+		q, err := seededPrime(r, bits/2)
+		if err != nil {
+			return nil, err
+		}
+		if p.Cmp(q) == 0 {
+			continue
+		}
+		n := new(big.Int).Mul(p, q)
+		if n.BitLen() != bits {
+			continue
+		}
+		totient := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+		d := new(big.Int).ModInverse(e, totient)
+		if d == nil {
+			continue
+		}
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n, E: int(e.Int64())},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		key.Precompute()
+		if err := key.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "error deriving the key %s", label)
+		}
+		return key, nil
+	}
+}
+
+// GenerateECDSAKey returns an ECDSA key on curve for the secret named label.
+// crypto/ecdsa does not derive keys from the reader it is given either, so the
+// scalar of the keys of a seeded source is read from its stream.
+func (s *SecretSource) GenerateECDSAKey(label string, curve elliptic.Curve) (*ecdsa.PrivateKey, error) {
+	if s == nil {
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	}
+	params := curve.Params()
+	// 64 extra bits make the bias of the reduction negligible
+	b := make([]byte, (params.N.BitLen()+7)/8+8)
+	if _, err := io.ReadFull(s.Reader(label), b); err != nil {
+		return nil, err
+	}
+	one := big.NewInt(1)
+	d := new(big.Int).SetBytes(b)
+	d.Mod(d, new(big.Int).Sub(params.N, one))
+	d.Add(d, one)
+	key := &ecdsa.PrivateKey{D: d}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(d.FillBytes(make([]byte, (params.N.BitLen()+7)/8)))
+	return key, nil
+}
+
+// seededPrime returns the first prime of the given size at or after a number read from r
+func seededPrime(r io.Reader, bits int) (*big.Int, error) {
+	b := make([]byte, (bits+7)/8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	p := new(big.Int).SetBytes(b)
+	// the two top bits are set for the product of two primes to have twice their size
+	p.SetBit(p, bits-1, 1)
+	p.SetBit(p, bits-2, 1)
+	p.SetBit(p, 0, 1)
+	for i := len(b)*8 - 1; i >= bits; i-- {
+		p.SetBit(p, i, 0)
+	}
+	two := big.NewInt(2)
+	for ; p.BitLen() == bits; p.Add(p, two) {
+		if p.ProbablyPrime(20) {
+			return p, nil
+		}
+	}
+	return seededPrime(r, bits)
+}
+
+// seededReader is the stream HMAC-SHA256(key, label || counter) of the secret named label,
+// where key is HMAC-SHA256(seed, cluster)
+type seededReader struct {
+	key     []byte
+	label   string
+	counter uint64
+	block   []byte
+}
+
+func (r *seededReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.block) == 0 {
+			mac := hmac.New(sha256.New, r.key)
+			mac.Write([]byte(r.label))
+			var counter [8]byte
+			binary.BigEndian.PutUint64(counter[:], r.counter)
+			mac.Write(counter[:])
+			r.block = mac.Sum(nil)
+			r.counter++
+		}
+		c := copy(p[n:], r.block)
+		r.block = r.block[c:]
+		n += c
+	}
+	return n, nil
+}
@@ -0,0 +1,141 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package helpers
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSeededSecretSource(t *testing.T) {
+	notBefore := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+	source := NewSeededSecretSource("seed", "cluster", notBefore)
+
+	read := func(s *SecretSource, label string) []byte {
+		b := make([]byte, 100)
+		if _, err := io.ReadFull(s.Reader(label), b); err != nil {
+			t.Fatalf("unexpected error reading %s: %s", label, err)
+		}
+		return b
+	}
+	if !bytes.Equal(read(source, "a"), read(NewSeededSecretSource("seed", "cluster", notBefore), "a")) {
+		t.Errorf("expected the same seed and label to give the same stream")
+	}
+	if bytes.Equal(read(source, "a"), read(source, "b")) {
+		t.Errorf("expected different labels to give different streams")
+	}
+	if bytes.Equal(read(source, "a"), read(NewSeededSecretSource("other", "cluster", notBefore), "a")) {
+		t.Errorf("expected different seeds to give different streams")
+	}
+	if bytes.Equal(read(source, "a"), read(NewSeededSecretSource("seed", "other", notBefore), "a")) {
+		t.Errorf("expected different clusters to give different streams")
+	}
+	if source.Int("a") != source.Int("a") || source.Int("a") < 0 {
+		t.Errorf("expected Int to be the same non-negative int for a label")
+	}
+	if !source.Now().Equal(notBefore) {
+		t.Errorf("expected the certificates to be valid from %s, got %s", notBefore, source.Now())
+	}
+
+	key, err := source.GenerateRSAKey("key", 1024)
+	if err != nil {
+		t.Fatalf("unexpected error deriving a key: %s", err)
+	}
+	if key.N.BitLen() != 1024 {
+		t.Errorf("expected a 1024 bits key, got %d bits", key.N.BitLen())
+	}
+	again, err := source.GenerateRSAKey("key", 1024)
+	if err != nil {
+		t.Fatalf("unexpected error deriving a key: %s", err)
+	}
+	if key.N.Cmp(again.N) != 0 {
+		t.Errorf("expected the same label to give the same key")
+	}
+
+	var random *SecretSource
+	if random.Reader("a") == source.Reader("a") || random.Now().Equal(notBefore) {
+		t.Errorf("expected a nil source to be random")
+	}
+}
+
+func TestCreatePkiKeyCertPairSeeded(t *testing.T) {
+	notBefore := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+	pair, err := CreatePkiKeyCertPair("ca", NewSeededSecretSource("seed", "cluster", notBefore), nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating the pair: %s", err)
+	}
+	again, err := CreatePkiKeyCertPair("ca", NewSeededSecretSource("seed", "cluster", notBefore), nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating the pair: %s", err)
+	}
+	if *pair != *again {
+		t.Fatalf("expected the same seed to create the same pair")
+	}
+
+	certificate, err := pemToCertificate(pair.CertificatePem)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the certificate: %s", err)
+	}
+	if !certificate.NotBefore.Equal(notBefore) || !certificate.NotAfter.Equal(notBefore.Add(ValidityDuration)) {
+		t.Errorf("expected the certificate to be valid from %s, got %s to %s", notBefore, certificate.NotBefore, certificate.NotAfter)
+	}
+	if err = certificate.CheckSignatureFrom(certificate); err != nil {
+		t.Errorf("expected the certificate to be signed by its key: %s", err)
+	}
+}
+
+func TestCreatePkiSeededECDSA(t *testing.T) {
+	options := &PkiOptions{KeyAlgorithm: PkiKeyAlgorithmECDSA}
+	create := func() (*PkiKeyCertPair, *PkiKeyCertPair) {
+		source := NewSeededSecretSource("seed", "cluster", time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC))
+		ca, err := CreatePkiKeyCertPair("ca", source, options)
+		if err != nil {
+			t.Fatalf("unexpected error creating the certificate authority: %s", err)
+		}
+		apiServer, _, _, _, _, _, err := CreatePki(nil, nil, "cluster.local", ca, 1, source, options)
+		if err != nil {
+			t.Fatalf("unexpected error creating the certificates: %s", err)
+		}
+		return ca, apiServer
+	}
+	ca, apiServer := create()
+	caAgain, apiServerAgain := create()
+	if ca.CertificatePem != caAgain.CertificatePem {
+		t.Errorf("expected the same seed to sign the same ECDSA certificate authority")
+	}
+	if apiServer.CertificatePem != apiServerAgain.CertificatePem {
+		t.Errorf("expected the same seed to sign the same ECDSA API server certificate")
+	}
+
+	caCertificate, err := pemToCertificate(ca.CertificatePem)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the certificate authority: %s", err)
+	}
+	apiServerCertificate, err := pemToCertificate(apiServer.CertificatePem)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the API server certificate: %s", err)
+	}
+	if err = apiServerCertificate.CheckSignatureFrom(caCertificate); err != nil {
+		t.Errorf("expected the API server certificate to be signed by the certificate authority: %s", err)
+	}
+}
+
+func TestGenerateECDSAKeySeeded(t *testing.T) {
+	source := NewSeededSecretSource("seed", "cluster", time.Now())
+	key, err := source.GenerateECDSAKey("a", elliptic.P256())
+	if err != nil {
+		t.Fatalf("unexpected error generating the key: %s", err)
+	}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		t.Fatalf("expected the public key to be on the curve")
+	}
+	again, _ := source.GenerateECDSAKey("a", elliptic.P256())
+	other, _ := source.GenerateECDSAKey("b", elliptic.P256())
+	if key.D.Cmp(again.D) != 0 || key.D.Cmp(other.D) == 0 {
+		t.Errorf("expected the key to be derived from its label")
+	}
+}
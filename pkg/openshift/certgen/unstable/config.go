@@ -4,12 +4,13 @@
 package unstable
 
 import (
-	"crypto/rsa"
+	"crypto"
 	"crypto/x509"
 	"math/big"
 	"net"
 	"sync"
 
+	"github.com/Azure/acs-engine/pkg/helpers"
 	"github.com/Azure/acs-engine/pkg/openshift/filesystem"
 )
 
@@ -26,6 +27,12 @@ type Config struct {
 	ClusterPassword         string
 	EnableAADAuthentication bool
 	AzureConfig             AzureConfig
+	// PkiOptions are the key algorithm and size and the validity of the certificates
+	PkiOptions *helpers.PkiOptions
+	// CA, when set, is used as etc/origin/master/ca instead of a generated certificate authority.
+	// It is an intermediate issued by PkiOptions.CAChain, which the server certificates it signs
+	// are bundled with.
+	CA *helpers.PkiKeyCertPair
 }
 
 // AzureConfig represents the azure.conf configuration
@@ -54,7 +61,7 @@ type Master struct {
 // CertAndKey is a certificate and key
 type CertAndKey struct {
 	cert *x509.Certificate
-	key  *rsa.PrivateKey
+	key  crypto.Signer
 }
 
 type serial struct {
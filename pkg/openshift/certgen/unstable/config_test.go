@@ -4,12 +4,21 @@
 package unstable
 
 import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"net"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/Azure/acs-engine/pkg/helpers"
 	"github.com/Azure/acs-engine/pkg/openshift/filesystem"
 )
 
@@ -33,6 +42,21 @@ func (fakefilesystem) Close() error {
 
 var _ filesystem.Writer = &fakefilesystem{}
 
+type contentfilesystem map[string][]byte
+
+func (f contentfilesystem) WriteFile(filename string, data []byte, fi filesystem.Fileinfo) error {
+	f[filename] = data
+	return nil
+}
+
+func (contentfilesystem) Mkdir(filename string, fi filesystem.Fileinfo) error {
+	return nil
+}
+
+func (contentfilesystem) Close() error {
+	return nil
+}
+
 func TestConfigFilePermissions(t *testing.T) {
 	c := Config{
 		Master: &Master{
@@ -91,3 +115,133 @@ func TestConfigFilePermissions(t *testing.T) {
 		}
 	}
 }
+
+func TestPrepareMasterCertsPkiOptions(t *testing.T) {
+	c := Config{
+		Master: &Master{
+			Hostname: "test-master-test-0",
+			IPs: []net.IP{
+				net.ParseIP("10.0.0.1"),
+			},
+		},
+		PkiOptions: &helpers.PkiOptions{
+			KeyAlgorithm:   helpers.PkiKeyAlgorithmECDSA,
+			ServerValidity: 365 * 24 * time.Hour,
+			ClientValidity: 90 * 24 * time.Hour,
+		},
+	}
+
+	if err := c.PrepareMasterCerts(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"etc/origin/master/master.server", "etc/origin/master/admin", "etc/origin/master/master.etcd-client"} {
+		cert := c.Master.certs[name]
+		if _, ok := cert.key.(*ecdsa.PrivateKey); !ok || cert.cert.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+			t.Errorf("expected %s to have an ECDSA key used for signatures only", name)
+		}
+	}
+	if validity := c.Master.certs["etc/origin/master/master.server"].cert.NotAfter.Sub(c.Master.certs["etc/origin/master/master.server"].cert.NotBefore); validity != c.PkiOptions.ServerValidity {
+		t.Errorf("expected the server certificate to be valid for %s, got %s", c.PkiOptions.ServerValidity, validity)
+	}
+	if validity := c.Master.certs["etc/origin/master/admin"].cert.NotAfter.Sub(c.Master.certs["etc/origin/master/admin"].cert.NotBefore); validity != c.PkiOptions.ClientValidity {
+		t.Errorf("expected the client certificate to be valid for %s, got %s", c.PkiOptions.ClientValidity, validity)
+	}
+	if _, err := privateKeyAsBytes(c.cas["etc/origin/master/ca"].key); err != nil {
+		t.Errorf("unexpected error encoding an ECDSA key: %s", err)
+	}
+}
+
+func TestPrepareMasterCertsCAChain(t *testing.T) {
+	root, err := helpers.CreatePkiKeyCertPair("root", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCert, rootKey, err := helpers.ParsePkiKeyCertPair(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	b, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "intermediate"},
+		NotBefore:             now,
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, rootCert, key.Public(), rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem, err := certAsBytes(intermediate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPem, err := privateKeyAsBytes(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := Config{
+		Master: &Master{
+			Hostname: "test-master-test-0",
+			IPs: []net.IP{
+				net.ParseIP("10.0.0.1"),
+			},
+		},
+		PkiOptions: &helpers.PkiOptions{CAChain: root.CertificatePem},
+		CA:         &helpers.PkiKeyCertPair{CertificatePem: string(certPem), PrivateKeyPem: string(keyPem)},
+	}
+	if err := c.PrepareMasterCerts(); err != nil {
+		t.Fatal(err)
+	}
+	fs := contentfilesystem{}
+	if err := c.WriteMasterCerts(fs); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(fs["etc/origin/master/ca.crt"]) != string(certPem) {
+		t.Errorf("expected etc/origin/master/ca.crt to be the given certificate authority")
+	}
+	server := parseCertificates(t, fs["etc/origin/master/master.server.crt"])
+	if len(server) != 2 || !server[1].Equal(intermediate) {
+		t.Fatalf("expected the server certificate to be bundled with the certificate authority, got %d certificates", len(server))
+	}
+	if server[0].NotAfter.After(intermediate.NotAfter) {
+		t.Errorf("expected the server certificate not to outlive the certificate authority")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCert)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(server[1])
+	if _, err := server[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, DNSName: "openshift"}); err != nil {
+		t.Errorf("expected the server certificate to be verified by the root: %s", err)
+	}
+	if admin := parseCertificates(t, fs["etc/origin/master/admin.crt"]); len(admin) != 1 {
+		t.Errorf("expected the client certificate not to be bundled, got %d certificates", len(admin))
+	}
+}
+
+func parseCertificates(t *testing.T, b []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			return certs
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, cert)
+	}
+}
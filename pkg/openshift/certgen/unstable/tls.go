@@ -5,6 +5,8 @@ package unstable
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
@@ -17,6 +19,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/Azure/acs-engine/pkg/helpers"
 	"github.com/Azure/acs-engine/pkg/openshift/filesystem"
 )
 
@@ -30,16 +33,19 @@ type generalName struct {
 	DirectoryName pkix.RDNSequence `asn1:"optional,explicit,tag:4"`
 }
 
-func newCertAndKey(filename string, template, signingcert *x509.Certificate, signingkey *rsa.PrivateKey, etcdcaspecial, etcdclientspecial bool) (CertAndKey, error) {
+func newCertAndKey(filename string, template, signingcert *x509.Certificate, signingkey crypto.Signer, etcdcaspecial, etcdclientspecial bool, options *helpers.PkiOptions) (CertAndKey, error) {
 	bits := 2048
 	if etcdcaspecial {
 		bits = 4096
 	}
 
-	key, err := rsa.GenerateKey(rand.Reader, bits)
+	key, err := helpers.GeneratePkiKey(options, bits, nil, filename)
 	if err != nil {
 		return CertAndKey{}, err
 	}
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		template.KeyUsage &^= x509.KeyUsageKeyEncipherment
+	}
 
 	if signingcert == nil {
 		// make it self-signed
@@ -48,7 +54,7 @@ func newCertAndKey(filename string, template, signingcert *x509.Certificate, sig
 	}
 
 	if etcdcaspecial {
-		template.SubjectKeyId = intsha1(key.N)
+		template.SubjectKeyId = keyID(key.Public())
 		ext := pkix.Extension{
 			Id: []int{2, 5, 29, 35},
 		}
@@ -65,13 +71,13 @@ func newCertAndKey(filename string, template, signingcert *x509.Certificate, sig
 	}
 
 	if etcdclientspecial {
-		template.SubjectKeyId = intsha1(key.N)
+		template.SubjectKeyId = keyID(key.Public())
 		ext := pkix.Extension{
 			Id: []int{2, 5, 29, 35},
 		}
 		var err error
 		ext.Value, err = asn1.Marshal(authKeyID{
-			KeyIdentifier:             intsha1(signingkey.N),
+			KeyIdentifier:             keyID(signingkey.Public()),
 			AuthorityCertIssuer:       generalName{DirectoryName: signingcert.Subject.ToRDNSequence()},
 			AuthorityCertSerialNumber: signingcert.SerialNumber,
 		})
@@ -106,18 +112,37 @@ func certAsBytes(cert *x509.Certificate) ([]byte, error) {
 }
 
 func writeCert(fs filesystem.Writer, filename string, cert *x509.Certificate) error {
+	return writeCertChain(fs, filename, cert, nil)
+}
+
+// writeCertChain writes a certificate followed by the PEM certificates of chain
+func writeCertChain(fs filesystem.Writer, filename string, cert *x509.Certificate, chain []byte) error {
 	b, err := certAsBytes(cert)
 	if err != nil {
 		return err
 	}
 	fi := GetFileInfo(filename)
-	return fs.WriteFile(filename, b, fi)
+	return fs.WriteFile(filename, append(b, chain...), fi)
 }
 
-func privateKeyAsBytes(key *rsa.PrivateKey) ([]byte, error) {
+func privateKeyAsBytes(key crypto.Signer) ([]byte, error) {
 	buf := &bytes.Buffer{}
 
-	err := pem.Encode(buf, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	var block *pem.Block
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	case *ecdsa.PrivateKey:
+		b, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	err := pem.Encode(buf, block)
 	if err != nil {
 		return nil, err
 	}
@@ -125,7 +150,7 @@ func privateKeyAsBytes(key *rsa.PrivateKey) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func writePrivateKey(fs filesystem.Writer, filename string, key *rsa.PrivateKey) error {
+func writePrivateKey(fs filesystem.Writer, filename string, key crypto.Signer) error {
 	b, err := privateKeyAsBytes(key)
 	if err != nil {
 		return err
@@ -226,14 +251,23 @@ func (c *Config) PrepareMasterCerts() error {
 		template := &x509.Certificate{
 			SerialNumber:          c.serial.Get(),
 			NotBefore:             now,
-			NotAfter:              now.AddDate(5, 0, 0),
+			NotAfter:              c.notAfter(now, helpers.PkiCertClassCA, now.AddDate(5, 0, 0)),
 			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
 			BasicConstraintsValid: true,
 			IsCA:                  true,
 		}
 		template.Subject = cacert.template.Subject
 
-		certAndKey, err := newCertAndKey(cacert.filename, template, nil, nil, cacert.filename == "etc/origin/master/master.etcd-ca", false)
+		if cacert.filename == "etc/origin/master/ca" && c.CA != nil {
+			cert, key, err := helpers.ParsePkiKeyCertPair(c.CA)
+			if err != nil {
+				return err
+			}
+			c.cas[cacert.filename] = CertAndKey{cert: cert, key: key}
+			continue
+		}
+
+		certAndKey, err := newCertAndKey(cacert.filename, template, nil, nil, cacert.filename == "etc/origin/master/master.etcd-ca", false, c.PkiOptions)
 		if err != nil {
 			return err
 		}
@@ -341,7 +375,7 @@ func (c *Config) PrepareMasterCerts() error {
 		template := &x509.Certificate{
 			SerialNumber:          c.serial.Get(),
 			NotBefore:             now,
-			NotAfter:              now.AddDate(2, 0, 0),
+			NotAfter:              c.notAfter(now, certClass(cert.template), now.AddDate(2, 0, 0)),
 			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 			BasicConstraintsValid: true,
 		}
@@ -353,8 +387,11 @@ func (c *Config) PrepareMasterCerts() error {
 		if cert.signer == "" {
 			cert.signer = "etc/origin/master/ca"
 		}
+		if template.NotAfter.After(c.cas[cert.signer].cert.NotAfter) {
+			template.NotAfter = c.cas[cert.signer].cert.NotAfter
+		}
 
-		certAndKey, err := newCertAndKey(cert.filename, template, c.cas[cert.signer].cert, c.cas[cert.signer].key, false, cert.filename == "etc/origin/master/master.etcd-client")
+		certAndKey, err := newCertAndKey(cert.filename, template, c.cas[cert.signer].cert, c.cas[cert.signer].key, false, cert.filename == "etc/origin/master/master.etcd-client", c.PkiOptions)
 		if err != nil {
 			return err
 		}
@@ -393,7 +430,7 @@ func (c *Config) PrepareMasterCerts() error {
 		template := &x509.Certificate{
 			SerialNumber:          c.serial.Get(),
 			NotBefore:             now,
-			NotAfter:              now.AddDate(5, 0, 0),
+			NotAfter:              c.notAfter(now, certClass(cert.template), now.AddDate(5, 0, 0)),
 			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 			BasicConstraintsValid: true,
 		}
@@ -402,7 +439,7 @@ func (c *Config) PrepareMasterCerts() error {
 		template.DNSNames = cert.template.DNSNames
 		template.IPAddresses = cert.template.IPAddresses
 
-		certAndKey, err := newCertAndKey(cert.filename, template, c.cas[cert.signer].cert, c.cas[cert.signer].key, false, true)
+		certAndKey, err := newCertAndKey(cert.filename, template, c.cas[cert.signer].cert, c.cas[cert.signer].key, false, true, c.PkiOptions)
 		if err != nil {
 			return err
 		}
@@ -442,8 +479,17 @@ func (c *Config) WriteMasterCerts(fs filesystem.Writer) error {
 		return err
 	}
 
+	chain, err := c.serverChain()
+	if err != nil {
+		return err
+	}
+
 	for filename, cert := range c.Master.certs {
-		err := writeCert(fs, fmt.Sprintf("%s.crt", filename), cert.cert)
+		var certChain []byte
+		if certClass(cert.cert) == helpers.PkiCertClassServer && cert.cert.CheckSignatureFrom(c.cas["etc/origin/master/ca"].cert) == nil {
+			certChain = chain
+		}
+		err := writeCertChain(fs, fmt.Sprintf("%s.crt", filename), cert.cert, certChain)
 		if err != nil {
 			return err
 		}
@@ -500,6 +546,46 @@ func (c *Config) WriteMasterKeypair(fs filesystem.Writer) error {
 	return writePublicKey(fs, "etc/origin/master/serviceaccounts.public.key", &key.PublicKey)
 }
 
+// notAfter returns when a certificate of class created at now expires, or defaultNotAfter
+// when the PKI options do not set the validity of the class
+func (c *Config) notAfter(now time.Time, class helpers.PkiCertClass, defaultNotAfter time.Time) time.Time {
+	return now.Add(c.PkiOptions.Validity(class, defaultNotAfter.Sub(now)))
+}
+
+// serverChain returns the certificates the server certificates signed by etc/origin/master/ca are
+// bundled with, when it is an intermediate of another PKI
+func (c *Config) serverChain() ([]byte, error) {
+	if c.CA == nil {
+		return nil, nil
+	}
+	chain, err := helpers.ServerChain(c.CA.CertificatePem, c.PkiOptions)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(chain), nil
+}
+
+// certClass returns whether a certificate is a server or a client certificate
+func certClass(template *x509.Certificate) helpers.PkiCertClass {
+	for _, usage := range template.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageServerAuth {
+			return helpers.PkiCertClassServer
+		}
+	}
+	return helpers.PkiCertClassClient
+}
+
+// keyID returns the identifier of a public key; that of RSA keys is the hash of their modulus
+func keyID(key crypto.PublicKey) []byte {
+	if k, ok := key.(*rsa.PublicKey); ok {
+		return intsha1(k.N)
+	}
+	b, _ := x509.MarshalPKIXPublicKey(key)
+	h := sha1.New()
+	h.Write(b)
+	return h.Sum(nil)
+}
+
 func intsha1(n *big.Int) []byte {
 	h := sha1.New()
 	h.Write(n.Bytes())
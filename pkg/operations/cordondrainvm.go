@@ -33,18 +33,36 @@ type drainOperation struct {
 
 type podFilter func(v1.Pod) bool
 
+// DrainError is returned when a node could not be cordoned or drained
+type DrainError struct {
+	NodeName string
+	Err      error
+}
+
+// Error implements error interface
+func (e *DrainError) Error() string {
+	return e.Err.Error()
+}
+
 // SafelyDrainNode safely drains a node so that it can be deleted from the cluster
 func SafelyDrainNode(az armhelpers.ACSEngineClient, logger *log.Entry, masterURL, kubeConfig, nodeName string, timeout time.Duration) error {
 	//get client using kubeconfig
 	client, err := az.GetKubernetesClient(masterURL, kubeConfig, interval, timeout)
 	if err != nil {
-		return err
+		return &DrainError{NodeName: nodeName, Err: err}
 	}
 	return SafelyDrainNodeWithClient(client, logger, nodeName, timeout)
 }
 
 // SafelyDrainNodeWithClient safely drains a node so that it can be deleted from the cluster
 func SafelyDrainNodeWithClient(client armhelpers.KubernetesClient, logger *log.Entry, nodeName string, timeout time.Duration) error {
+	if err := cordonAndDrainNode(client, logger, nodeName, timeout); err != nil {
+		return &DrainError{NodeName: nodeName, Err: err}
+	}
+	return nil
+}
+
+func cordonAndDrainNode(client armhelpers.KubernetesClient, logger *log.Entry, nodeName string, timeout time.Duration) error {
 	//Mark the node unschedulable
 	var node *v1.Node
 	var err error
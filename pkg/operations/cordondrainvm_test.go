@@ -44,6 +44,9 @@ var _ = Describe("Safely Drain node operation tests", func() {
 		mockClient.MockKubernetesClient.FailUpdateNode = true
 		err := SafelyDrainNode(mockClient, log.NewEntry(log.New()), "http://bad.com/", "bad", "node", time.Minute)
 		Expect(err).Should(HaveOccurred())
+		drainErr, ok := err.(*DrainError)
+		Expect(ok).To(BeTrue())
+		Expect(drainErr.NodeName).To(Equal("node"))
 	})
 	It("Should return error messages for Failure to list pods ", func() {
 		mockClient := &armhelpers.MockACSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
@@ -45,25 +45,13 @@ type UpgradeAgentNode struct {
 // the node
 // The 'drain' flag is used to invoke 'cordon and drain' flow.
 func (kan *UpgradeAgentNode) DeleteNode(vmName *string, drain bool) error {
-	var kubeAPIServerURL string
-
-	if kan.UpgradeContainerService.Properties.HostedMasterProfile != nil {
-		kubeAPIServerURL = kan.UpgradeContainerService.Properties.HostedMasterProfile.FQDN
-	} else {
-		kubeAPIServerURL = kan.UpgradeContainerService.Properties.MasterProfile.FQDN
-	}
-
-	client, err := kan.Client.GetKubernetesClient(kubeAPIServerURL, kan.kubeConfig, interval, kan.timeout)
+	client, err := kan.getKubernetesClient()
 	if err != nil {
 		return err
 	}
 	// Cordon and drain the node
 	if drain {
-		err := operations.SafelyDrainNodeWithClient(client, kan.logger, *vmName, time.Minute)
-		if err != nil {
-			kan.logger.Warningf("Error draining agent VM %s. Proceeding with deletion. Error: %v", *vmName, err)
-			// Proceed with deletion anyways
-		}
+		kan.drainNode(client, *vmName)
 	}
 	// Delete VM in ARM
 	if err := operations.CleanDeleteVirtualMachine(kan.Client, kan.logger, kan.SubscriptionID, kan.ResourceGroup, *vmName); err != nil {
@@ -79,6 +67,37 @@ func (kan *UpgradeAgentNode) DeleteNode(vmName *string, drain bool) error {
 	return nil
 }
 
+// DrainNode cordons and drains the node ahead of its deletion.
+// Errors while draining are logged and otherwise ignored.
+func (kan *UpgradeAgentNode) DrainNode(vmName *string) error {
+	client, err := kan.getKubernetesClient()
+	if err != nil {
+		return err
+	}
+	kan.drainNode(client, *vmName)
+	return nil
+}
+
+func (kan *UpgradeAgentNode) drainNode(client armhelpers.KubernetesClient, vmName string) {
+	err := operations.SafelyDrainNodeWithClient(client, kan.logger, vmName, time.Minute)
+	if err != nil {
+		kan.logger.Warningf("Error draining agent VM %s. Proceeding with deletion. Error: %v", vmName, err)
+		// Proceed with deletion anyways
+	}
+}
+
+func (kan *UpgradeAgentNode) getKubernetesClient() (armhelpers.KubernetesClient, error) {
+	var kubeAPIServerURL string
+
+	if kan.UpgradeContainerService.Properties.HostedMasterProfile != nil {
+		kubeAPIServerURL = kan.UpgradeContainerService.Properties.HostedMasterProfile.FQDN
+	} else {
+		kubeAPIServerURL = kan.UpgradeContainerService.Properties.MasterProfile.FQDN
+	}
+
+	return kan.Client.GetKubernetesClient(kubeAPIServerURL, kan.kubeConfig, interval, kan.timeout)
+}
+
 // CreateNode creates a new master/agent node with the targeted version of Kubernetes
 func (kan *UpgradeAgentNode) CreateNode(ctx context.Context, poolName string, agentNo int) error {
 	poolCountParameter := kan.ParametersMap[poolName+"Count"].(map[string]interface{})
@@ -68,6 +68,19 @@ type UpgradeCluster struct {
 	ClusterTopology
 	Client      armhelpers.ACSEngineClient
 	StepTimeout *time.Duration
+	// Journal records the progress of the upgrade so that it can be resumed; may be nil
+	Journal *UpgradeJournal
+	// MaxSurge is the number of upgraded agent nodes created ahead of deleting old ones;
+	// 0 replaces agent nodes one at a time
+	MaxSurge int
+	// MaxUnavailable is the number of agent nodes that can be missing from a pool during a surge upgrade
+	MaxUnavailable int
+	// Concurrency is the number of nodes of a pool upgraded at the same time; 0 or 1 upgrades one node at a time
+	Concurrency int
+	// UpgradeTimeout bounds the whole upgrade; nil uses the default of 90 minutes
+	UpgradeTimeout *time.Duration
+	// Context stops the upgrade when it is done; nil never stops it before UpgradeTimeout
+	Context context.Context
 }
 
 // MasterVMNamePrefix is the prefix for all master VM names for Kubernetes clusters
@@ -104,17 +117,17 @@ func (uc *UpgradeCluster) UpgradeCluster(subscriptionID uuid.UUID, az armhelpers
 	switch {
 	case strings.HasPrefix(upgradeVersion, "1.6."):
 		upgrader16 := &Kubernetes16upgrader{}
-		upgrader16.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, kubeConfig, uc.StepTimeout, acsengineVersion)
+		upgrader16.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, kubeConfig, uc.StepTimeout, acsengineVersion, uc.Journal, uc.MaxSurge, uc.MaxUnavailable, uc.Concurrency, uc.UpgradeTimeout)
 		upgrader = upgrader16
 
 	case strings.HasPrefix(upgradeVersion, "1.7."):
 		upgrader17 := &Kubernetes17upgrader{}
-		upgrader17.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, kubeConfig, uc.StepTimeout, acsengineVersion)
+		upgrader17.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, kubeConfig, uc.StepTimeout, acsengineVersion, uc.Journal, uc.MaxSurge, uc.MaxUnavailable, uc.Concurrency, uc.UpgradeTimeout)
 		upgrader = upgrader17
 
 	case strings.HasPrefix(upgradeVersion, "1.8."):
 		upgrader18 := &Kubernetes18upgrader{}
-		upgrader18.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, kubeConfig, uc.StepTimeout, acsengineVersion)
+		upgrader18.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, kubeConfig, uc.StepTimeout, acsengineVersion, uc.Journal, uc.MaxSurge, uc.MaxUnavailable, uc.Concurrency, uc.UpgradeTimeout)
 		upgrader = upgrader18
 
 	case strings.HasPrefix(upgradeVersion, "1.9."),
@@ -123,14 +136,18 @@ func (uc *UpgradeCluster) UpgradeCluster(subscriptionID uuid.UUID, az armhelpers
 		strings.HasPrefix(upgradeVersion, "1.12."),
 		strings.HasPrefix(upgradeVersion, "1.13."):
 		u := &Upgrader{}
-		u.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, kubeConfig, uc.StepTimeout, acsengineVersion)
+		u.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, kubeConfig, uc.StepTimeout, acsengineVersion, uc.Journal, uc.MaxSurge, uc.MaxUnavailable, uc.Concurrency, uc.UpgradeTimeout)
 		upgrader = u
 
 	default:
 		return uc.Translator.Errorf("Upgrade to Kubernetes version %s is not supported", upgradeVersion)
 	}
 
-	if err := upgrader.RunUpgrade(); err != nil {
+	ctx := uc.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := upgrader.RunUpgrade(ctx); err != nil {
 		return err
 	}
 
@@ -0,0 +1,190 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+const defaultUpgradeTimeout = time.Minute * 90
+
+// runInBatches calls fn for each node, running up to limit nodes in parallel.
+// The nodes of a batch all run to completion; the next batch only starts if
+// none of them failed. When several nodes of a batch fail the errors are aggregated.
+func runInBatches(limit int, nodes []string, fn func(i int) error) error {
+	if limit < 1 {
+		limit = 1
+	}
+	for start := 0; start < len(nodes); start += limit {
+		end := start + limit
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+
+		errs := make([]error, end-start)
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i-start] = fn(i)
+			}(i)
+		}
+		wg.Wait()
+
+		var failed []error
+		var lastErr error
+		for i, err := range errs {
+			if err != nil {
+				lastErr = err
+				failed = append(failed, errors.Wrapf(err, "node %s", nodes[start+i]))
+			}
+		}
+		switch {
+		case len(failed) == 1:
+			// the error of a single failed node is returned as is
+			return lastErr
+		case len(failed) > 1:
+			return errors.Wrapf(utilerrors.NewAggregate(failed), "%d of %d nodes failed to upgrade", len(failed), end-start)
+		}
+	}
+	return nil
+}
+
+// createNode creates a node, one deployment at a time: concurrent deployments of the template
+// would conflict on the load balancer, availability sets and network security group they share
+func (ku *Upgrader) createNode(ctx context.Context, node UpgradeNode, poolName string, index int) error {
+	ku.deployLock.Lock()
+	defer ku.deployLock.Unlock()
+	return node.CreateNode(ctx, poolName, index)
+}
+
+// masterConcurrency returns how many masters can be upgraded at the same time
+// without losing etcd quorum
+func (ku *Upgrader) masterConcurrency(masterCount int) int {
+	limit := minInt(ku.concurrency, (masterCount-1)/2)
+	if limit < 1 {
+		return 1
+	}
+	return limit
+}
+
+// agentPoolConcurrency returns how many nodes of an agent pool can be upgraded at the same time.
+// The configured concurrency is lowered to the number of disruptions allowed by any
+// PodDisruptionBudget protecting pods on the nodes of the pool.
+func (ku *Upgrader) agentPoolConcurrency(poolName string, nodeNames []string) int {
+	if ku.concurrency <= 1 {
+		return 1
+	}
+
+	client, err := ku.getKubernetesClient()
+	if err != nil {
+		ku.logger.Warnf("Error getting Kubernetes client, upgrading pool %s one node at a time: %v", poolName, err)
+		return 1
+	}
+	pdbs, err := client.ListPodDisruptionBudgets()
+	if err != nil {
+		ku.logger.Warnf("Error listing PodDisruptionBudgets, upgrading pool %s one node at a time: %v", poolName, err)
+		return 1
+	}
+
+	pods := []v1.Pod{}
+	for _, name := range nodeNames {
+		podList, err := client.ListPods(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+		if err != nil {
+			ku.logger.Warnf("Error listing pods of node %s, upgrading pool %s one node at a time: %v", name, poolName, err)
+			return 1
+		}
+		pods = append(pods, podList.Items...)
+	}
+
+	limit := ku.concurrency
+	for _, pdb := range pdbs.Items {
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			ku.logger.Warnf("Ignoring PodDisruptionBudget %s/%s with an invalid selector: %v", pdb.Namespace, pdb.Name, err)
+			continue
+		}
+		for _, pod := range pods {
+			if pod.Namespace != pdb.Namespace || !selector.Matches(labels.Set(pod.Labels)) {
+				continue
+			}
+			allowed := int(pdb.Status.PodDisruptionsAllowed)
+			if allowed < 1 {
+				allowed = 1
+			}
+			if allowed < limit {
+				ku.logger.Infof("PodDisruptionBudget %s/%s allows %d disruptions, upgrading pool %s %d nodes at a time",
+					pdb.Namespace, pdb.Name, pdb.Status.PodDisruptionsAllowed, poolName, allowed)
+				limit = allowed
+			}
+			break
+		}
+	}
+	return limit
+}
+
+func (ku *Upgrader) getKubernetesClient() (armhelpers.KubernetesClient, error) {
+	var kubeAPIServerURL string
+	if ku.DataModel.Properties.HostedMasterProfile != nil {
+		kubeAPIServerURL = ku.DataModel.Properties.HostedMasterProfile.FQDN
+	} else {
+		kubeAPIServerURL = ku.DataModel.Properties.MasterProfile.FQDN
+	}
+	return ku.Client.GetKubernetesClient(kubeAPIServerURL, ku.kubeConfig, interval, 10*time.Second)
+}
+
+// copyTemplateMap returns a deep copy of a template or parameters map,
+// so that nodes created in parallel do not share their count and offset values
+func copyTemplateMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = copyTemplateValue(v)
+	}
+	return c
+}
+
+func copyTemplateValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return copyTemplateMap(t)
+	case []interface{}:
+		c := make([]interface{}, len(t))
+		for i, e := range t {
+			c[i] = copyTemplateValue(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// TimeoutError is returned when the upgrade did not complete within its timeout
+type TimeoutError struct {
+	Timeout time.Duration
+	Err     error
+}
+
+// Error implements error interface
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("upgrade did not complete within %v: %v", e.Timeout, e.Err)
+}
+
+// timeoutError returns a *TimeoutError if err happened after the deadline of ctx, err otherwise
+func timeoutError(ctx context.Context, timeout time.Duration, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &TimeoutError{Timeout: timeout, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,204 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Parallel upgrade tests", func() {
+	newUpgrader := func(mockClient *armhelpers.MockACSEngineClient, concurrency int, upgradeTimeout *time.Duration) *Upgrader {
+		cs := api.CreateMockContainerService("testcluster", "1.9.10", 3, 3, false)
+		ku := &Upgrader{}
+		ku.Init(&i18n.Translator{}, log.NewEntry(log.New()), ClusterTopology{DataModel: cs}, mockClient, "kubeConfig", nil, TestACSEngineVersion, nil, 0, 0, concurrency, upgradeTimeout)
+		return ku
+	}
+
+	It("Should run nodes in batches of at most limit nodes", func() {
+		var lock sync.Mutex
+		running, maxRunning := 0, 0
+		nodes := []string{"a", "b", "c", "d", "e"}
+		done := make([]bool, len(nodes))
+
+		err := runInBatches(2, nodes, func(i int) error {
+			lock.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			lock.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			lock.Lock()
+			running--
+			done[i] = true
+			lock.Unlock()
+			return nil
+		})
+		Expect(err).To(BeNil())
+		Expect(maxRunning).To(Equal(2))
+		Expect(done).To(Equal([]bool{true, true, true, true, true}))
+	})
+
+	It("Should return the error of a single failed node as is", func() {
+		failure := errors.New("DeleteNode failed")
+		err := runInBatches(2, []string{"a", "b", "c"}, func(i int) error {
+			if i == 1 {
+				return failure
+			}
+			return nil
+		})
+		Expect(err).To(Equal(failure))
+	})
+
+	It("Should aggregate the errors of a batch and stop before the next batch", func() {
+		ran := make([]bool, 3)
+		err := runInBatches(2, []string{"a", "b", "c"}, func(i int) error {
+			ran[i] = true
+			return errors.Errorf("failure %d", i)
+		})
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("2 of 2 nodes failed to upgrade"))
+		Expect(err.Error()).To(ContainSubstring("node a: failure 0"))
+		Expect(err.Error()).To(ContainSubstring("node b: failure 1"))
+		Expect(ran).To(Equal([]bool{true, true, false}))
+	})
+
+	It("Should report errors that happened after the upgrade timeout as timeouts", func() {
+		failure := errors.New("DeployTemplate failed")
+		Expect(timeoutError(context.Background(), time.Minute, failure)).To(Equal(failure))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+		defer cancel()
+		<-ctx.Done()
+		err := timeoutError(ctx, time.Minute, failure)
+		Expect(err).To(Equal(&TimeoutError{Timeout: time.Minute, Err: failure}))
+		Expect(err.Error()).To(Equal("upgrade did not complete within 1m0s: DeployTemplate failed"))
+	})
+
+	It("Should deploy the nodes of a batch one at a time", func() {
+		ku := newUpgrader(&armhelpers.MockACSEngineClient{}, 3, nil)
+		node := &fakeUpgradeNode{}
+		err := runInBatches(3, []string{"a", "b", "c"}, func(i int) error {
+			return ku.createNode(context.Background(), node, "agentpool1", i)
+		})
+		Expect(err).To(BeNil())
+		Expect(node.created).To(Equal(3))
+		Expect(node.maxDeploying).To(Equal(1))
+	})
+
+	It("Should keep a quorum of masters", func() {
+		ku := newUpgrader(&armhelpers.MockACSEngineClient{}, 5, nil)
+		Expect(ku.masterConcurrency(1)).To(Equal(1))
+		Expect(ku.masterConcurrency(3)).To(Equal(1))
+		Expect(ku.masterConcurrency(5)).To(Equal(2))
+
+		ku = newUpgrader(&armhelpers.MockACSEngineClient{}, 1, nil)
+		Expect(ku.masterConcurrency(5)).To(Equal(1))
+	})
+
+	It("Should lower the agent pool concurrency to the disruptions allowed by a PodDisruptionBudget", func() {
+		mockClient := &armhelpers.MockACSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
+		mockClient.MockKubernetesClient.PodsList = &v1.PodList{Items: []v1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default", Labels: map[string]string{"app": "web"}}},
+		}}
+		pdb := func(namespace, app string, allowed int32) policy.PodDisruptionBudget {
+			return policy.PodDisruptionBudget{
+				ObjectMeta: metav1.ObjectMeta{Name: app, Namespace: namespace},
+				Spec:       policy.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}}},
+				Status:     policy.PodDisruptionBudgetStatus{PodDisruptionsAllowed: allowed},
+			}
+		}
+		mockClient.MockKubernetesClient.PodDisruptionBudgetsList = &policy.PodDisruptionBudgetList{Items: []policy.PodDisruptionBudget{
+			pdb("default", "db", 0),
+			pdb("other", "web", 0),
+			pdb("default", "web", 2),
+		}}
+
+		ku := newUpgrader(mockClient, 4, nil)
+		Expect(ku.agentPoolConcurrency("agentpool1", []string{"k8s-agentpool1-12345678-0"})).To(Equal(2))
+
+		mockClient.MockKubernetesClient.PodDisruptionBudgetsList.Items[2].Status.PodDisruptionsAllowed = 0
+		Expect(ku.agentPoolConcurrency("agentpool1", []string{"k8s-agentpool1-12345678-0"})).To(Equal(1))
+	})
+
+	It("Should upgrade one node at a time when PodDisruptionBudgets cannot be listed", func() {
+		mockClient := &armhelpers.MockACSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
+		mockClient.MockKubernetesClient.FailListPodDisruptionBudgets = true
+
+		ku := newUpgrader(mockClient, 4, nil)
+		Expect(ku.agentPoolConcurrency("agentpool1", []string{"k8s-agentpool1-12345678-0"})).To(Equal(1))
+	})
+
+	It("Should upgrade a cluster with a concurrency above one", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 3, 3, false)
+		mockClient := &armhelpers.MockACSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
+		upgradeTimeout := 30 * time.Minute
+		uc := UpgradeCluster{
+			Translator:     &i18n.Translator{},
+			Logger:         log.NewEntry(log.New()),
+			Client:         mockClient,
+			Concurrency:    3,
+			UpgradeTimeout: &upgradeTimeout,
+		}
+		subID, _ := uuid.FromString("DEC923E3-1EF1-4745-9516-37906D56DEC4")
+		err := uc.UpgradeCluster(subID, nil, "kubeConfig", "TestRg", cs, "12345678", []string{"agentpool1"}, TestACSEngineVersion)
+		Expect(err).To(BeNil())
+	})
+
+	It("Should copy template maps deeply", func() {
+		m := map[string]interface{}{
+			"parameters": map[string]interface{}{"count": map[string]interface{}{"value": 1}},
+			"resources":  []interface{}{map[string]interface{}{"name": "vm"}},
+		}
+		c := copyTemplateMap(m)
+		c["parameters"].(map[string]interface{})["count"].(map[string]interface{})["value"] = 2
+		c["resources"].([]interface{})[0].(map[string]interface{})["name"] = "other"
+
+		Expect(m["parameters"].(map[string]interface{})["count"].(map[string]interface{})["value"]).To(Equal(1))
+		Expect(m["resources"].([]interface{})[0].(map[string]interface{})["name"]).To(Equal("vm"))
+	})
+})
+
+// fakeUpgradeNode records how many nodes it deploys at the same time
+type fakeUpgradeNode struct {
+	lock                             sync.Mutex
+	deploying, maxDeploying, created int
+}
+
+func (n *fakeUpgradeNode) DeleteNode(vmName *string, drain bool) error {
+	return nil
+}
+
+func (n *fakeUpgradeNode) CreateNode(ctx context.Context, poolName string, index int) error {
+	n.lock.Lock()
+	n.deploying++
+	if n.deploying > n.maxDeploying {
+		n.maxDeploying = n.deploying
+	}
+	n.lock.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	n.lock.Lock()
+	n.deploying--
+	n.created++
+	n.lock.Unlock()
+	return nil
+}
+
+func (n *fakeUpgradeNode) Validate(vmName *string) error {
+	return nil
+}
@@ -8,6 +8,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Azure/acs-engine/pkg/acsengine"
@@ -30,6 +33,14 @@ type Upgrader struct {
 	kubeConfig       string
 	stepTimeout      *time.Duration
 	ACSEngineVersion string
+	journal          *UpgradeJournal
+	maxSurge         int
+	maxUnavailable   int
+	concurrency      int
+	upgradeTimeout   *time.Duration
+	// deployLock serializes the deployments of the nodes upgraded in parallel, which all
+	// deploy the template of the cluster and its shared resources to the same resource group
+	deployLock sync.Mutex
 }
 
 type vmStatus int
@@ -47,7 +58,7 @@ type vmInfo struct {
 }
 
 // Init initializes an upgrader struct
-func (ku *Upgrader) Init(translator *i18n.Translator, logger *logrus.Entry, clusterTopology ClusterTopology, client armhelpers.ACSEngineClient, kubeConfig string, stepTimeout *time.Duration, acsEngineVersion string) {
+func (ku *Upgrader) Init(translator *i18n.Translator, logger *logrus.Entry, clusterTopology ClusterTopology, client armhelpers.ACSEngineClient, kubeConfig string, stepTimeout *time.Duration, acsEngineVersion string, journal *UpgradeJournal, maxSurge, maxUnavailable, concurrency int, upgradeTimeout *time.Duration) {
 	ku.Translator = translator
 	ku.logger = logger
 	ku.ClusterTopology = clusterTopology
@@ -55,21 +66,34 @@ func (ku *Upgrader) Init(translator *i18n.Translator, logger *logrus.Entry, clus
 	ku.kubeConfig = kubeConfig
 	ku.stepTimeout = stepTimeout
 	ku.ACSEngineVersion = acsEngineVersion
+	ku.journal = journal
+	ku.maxSurge = maxSurge
+	ku.maxUnavailable = maxUnavailable
+	ku.concurrency = concurrency
+	ku.upgradeTimeout = upgradeTimeout
 }
 
-// RunUpgrade runs the upgrade pipeline
-func (ku *Upgrader) RunUpgrade() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Minute)
+// RunUpgrade runs the upgrade pipeline, until it completes or ctx is done
+func (ku *Upgrader) RunUpgrade(parent context.Context) error {
+	timeout := defaultUpgradeTimeout
+	if ku.upgradeTimeout != nil {
+		timeout = *ku.upgradeTimeout
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
 	defer cancel()
 	if err := ku.upgradeMasterNodes(ctx); err != nil {
-		return err
+		return timeoutError(ctx, timeout, err)
 	}
 
 	if err := ku.upgradeAgentScaleSets(ctx); err != nil {
-		return err
+		return timeoutError(ctx, timeout, err)
+	}
+
+	if err := ku.upgradeAgentPools(ctx); err != nil {
+		return timeoutError(ctx, timeout, err)
 	}
 
-	return ku.upgradeAgentPools(ctx)
+	return ku.journal.Finish()
 }
 
 // Validate will run validation post upgrade
@@ -77,6 +101,22 @@ func (ku *Upgrader) Validate() error {
 	return nil
 }
 
+// runStep runs one upgrade step of a node and records it in the upgrade journal.
+// Steps the journal shows as completed by a previous run are skipped.
+func (ku *Upgrader) runStep(pool, node string, index int, step UpgradeStep, fn func() error) error {
+	if ku.journal.IsCompleted(pool, node, step) {
+		ku.logger.Infof("Skipping %s of node %s, completed by a previous upgrade", step, node)
+		return nil
+	}
+	if err := ku.journal.Start(pool, node, index, step); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return ku.journal.Complete(pool, node, index, step)
+}
+
 func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 	if ku.ClusterTopology.DataModel.Properties.MasterProfile == nil {
 		return nil
@@ -137,31 +177,63 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 		ku.logger.Infof("Master VM: %s is upgraded to expected orchestrator version", *vm.Name)
 		masterIndex, _ := utils.GetVMNameIndex(vm.StorageProfile.OsDisk.OsType, *vm.Name)
 		upgradedMastersIndex[masterIndex] = true
+
+		// a previous upgrade may have been interrupted before the master was validated
+		if ku.journal.HasNode(MasterPoolName, *vm.Name) {
+			err = ku.runStep(MasterPoolName, *vm.Name, masterIndex, UpgradeStepValidate, func() error {
+				return upgradeMasterNode.Validate(vm.Name)
+			})
+			if err != nil {
+				ku.logger.Infof("Error validating upgraded master VM: %s", *vm.Name)
+				return err
+			}
+		}
 	}
 
-	for _, vm := range *ku.ClusterTopology.MasterVMs {
+	masterVMs := *ku.ClusterTopology.MasterVMs
+	masterNames := make([]string, len(masterVMs))
+	for i, vm := range masterVMs {
+		masterNames[i] = *vm.Name
+	}
+	err = runInBatches(ku.masterConcurrency(expectedMasterCount), masterNames, func(i int) error {
+		vm := masterVMs[i]
+		node := upgradeMasterNode
+		node.TemplateMap = copyTemplateMap(upgradeMasterNode.TemplateMap)
+		node.ParametersMap = copyTemplateMap(upgradeMasterNode.ParametersMap)
 		ku.logger.Infof("Upgrading Master VM: %s", *vm.Name)
 
 		masterIndex, _ := utils.GetVMNameIndex(vm.StorageProfile.OsDisk.OsType, *vm.Name)
 
-		err := upgradeMasterNode.DeleteNode(vm.Name, false)
+		err := ku.runStep(MasterPoolName, *vm.Name, masterIndex, UpgradeStepDelete, func() error {
+			return node.DeleteNode(vm.Name, false)
+		})
 		if err != nil {
 			ku.logger.Infof("Error deleting master VM: %s, err: %v", *vm.Name, err)
 			return err
 		}
 
-		err = upgradeMasterNode.CreateNode(ctx, "master", masterIndex)
+		err = ku.runStep(MasterPoolName, *vm.Name, masterIndex, UpgradeStepCreate, func() error {
+			return ku.createNode(ctx, &node, "master", masterIndex)
+		})
 		if err != nil {
 			ku.logger.Infof("Error creating upgraded master VM: %s", *vm.Name)
 			return err
 		}
 
-		err = upgradeMasterNode.Validate(vm.Name)
+		err = ku.runStep(MasterPoolName, *vm.Name, masterIndex, UpgradeStepValidate, func() error {
+			return node.Validate(vm.Name)
+		})
 		if err != nil {
 			ku.logger.Infof("Error validating upgraded master VM: %s", *vm.Name)
 			return err
 		}
-
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, vm := range masterVMs {
+		masterIndex, _ := utils.GetVMNameIndex(vm.StorageProfile.OsDisk.OsType, *vm.Name)
 		upgradedMastersIndex[masterIndex] = true
 	}
 
@@ -175,24 +247,35 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 	mastersToCreate := expectedMasterCount - masterNodesInCluster
 	ku.logger.Infof("Expected master count: %d, Creating %d more master VMs", expectedMasterCount, mastersToCreate)
 
-	// NOTE: this is NOT completely idempotent because it assumes that
-	// the OS disk has been deleted
+	// Masters deleted by an interrupted upgrade are recreated with the index recorded in the
+	// upgrade journal. Without a journal this assumes that the OS disk has been deleted.
+	deletedMasters := ku.journal.nodesWith(MasterPoolName, UpgradeStepDelete, UpgradeStepCreate)
 	for i := 0; i < mastersToCreate; i++ {
 		masterIndexToCreate := 0
 		for upgradedMastersIndex[masterIndexToCreate] {
 			masterIndexToCreate++
 		}
+		for _, node := range deletedMasters {
+			if !upgradedMastersIndex[node.Index] {
+				masterIndexToCreate = node.Index
+				break
+			}
+		}
+		vmName := fmt.Sprintf("%s%s-%d", MasterVMNamePrefix, ku.ClusterTopology.NameSuffix, masterIndexToCreate)
 
 		ku.logger.Infof("Creating upgraded master VM with index: %d", masterIndexToCreate)
 
-		err = upgradeMasterNode.CreateNode(ctx, "master", masterIndexToCreate)
+		err = ku.runStep(MasterPoolName, vmName, masterIndexToCreate, UpgradeStepCreate, func() error {
+			return upgradeMasterNode.CreateNode(ctx, "master", masterIndexToCreate)
+		})
 		if err != nil {
 			ku.logger.Infof("Error creating upgraded master VM with index: %d", masterIndexToCreate)
 			return err
 		}
 
-		tempVMName := ""
-		err = upgradeMasterNode.Validate(&tempVMName)
+		err = ku.runStep(MasterPoolName, vmName, masterIndexToCreate, UpgradeStepValidate, func() error {
+			return upgradeMasterNode.Validate(&vmName)
+		})
 		if err != nil {
 			ku.logger.Infof("Error validating upgraded master VM with index: %d", masterIndexToCreate)
 			return err
@@ -282,6 +365,17 @@ func (ku *Upgrader) upgradeAgentPools(ctx context.Context) error {
 				agentVMs[agentIndex] = &vmInfo{*vm.Name, vmStatusUpgraded}
 				upgradedCount++
 
+				// a previous upgrade may have been interrupted before the agent was validated
+				if ku.journal.HasNode(*agentPool.Name, *vm.Name) {
+					err = ku.runStep(*agentPool.Name, *vm.Name, agentIndex, UpgradeStepValidate, func() error {
+						return upgradeAgentNode.Validate(vm.Name)
+					})
+					if err != nil {
+						ku.logger.Errorf("Error validating upgraded agent VM %s: %v", *vm.Name, err)
+						return err
+					}
+				}
+
 			case "Failed":
 				ku.logger.Infof("Deleting agent VM %s in provisioning state %s", *vm.Name, vmProvisioningState)
 				err := upgradeAgentNode.DeleteNode(vm.Name, false)
@@ -307,13 +401,28 @@ func (ku *Upgrader) upgradeAgentPools(ctx context.Context) error {
 		ku.logger.Infof("Starting upgrade of %d agent nodes (out of %d) in pool identifier: %s, name: %s...",
 			toBeUpgradedCount, agentCount, *agentPool.Identifier, *agentPool.Name)
 
+		if ku.maxSurge > 0 {
+			if err := ku.upgradeAgentPoolWithSurge(ctx, &upgradeAgentNode, *agentPool.Name, agentPoolIndex, agentCount, agentVMs); err != nil {
+				return err
+			}
+			continue
+		}
+
 		// Create missing nodes to match agentCount. This could be due to previous upgrade failure
 		// If there are nodes that need to be upgraded, create one extra node, which will be used to take on the load from upgrading nodes.
 		if toBeUpgradedCount > 0 {
 			agentCount++
 		}
+		deletedAgents := ku.journal.nodesWith(*agentPool.Name, UpgradeStepDelete, UpgradeStepCreate)
 		for upgradedCount+toBeUpgradedCount < agentCount {
 			agentIndex := getAvailableIndex(agentVMs)
+			// prefer the index of an agent deleted by an interrupted upgrade
+			for _, node := range deletedAgents {
+				if _, found := agentVMs[node.Index]; !found {
+					agentIndex = node.Index
+					break
+				}
+			}
 
 			vmName, err := utils.GetK8sVMName(ku.DataModel.Properties, agentPoolIndex, agentIndex)
 			if err != nil {
@@ -322,13 +431,17 @@ func (ku *Upgrader) upgradeAgentPools(ctx context.Context) error {
 			}
 			ku.logger.Infof("Creating new agent node %s (index %d)", vmName, agentIndex)
 
-			err = upgradeAgentNode.CreateNode(ctx, *agentPool.Name, agentIndex)
+			err = ku.runStep(*agentPool.Name, vmName, agentIndex, UpgradeStepCreate, func() error {
+				return upgradeAgentNode.CreateNode(ctx, *agentPool.Name, agentIndex)
+			})
 			if err != nil {
 				ku.logger.Errorf("Error creating agent node %s (index %d): %v", vmName, agentIndex, err)
 				return err
 			}
 
-			err = upgradeAgentNode.Validate(&vmName)
+			err = ku.runStep(*agentPool.Name, vmName, agentIndex, UpgradeStepValidate, func() error {
+				return upgradeAgentNode.Validate(&vmName)
+			})
 			if err != nil {
 				ku.logger.Infof("Error validating agent node %s (index %d): %v", vmName, agentIndex, err)
 				return err
@@ -344,14 +457,40 @@ func (ku *Upgrader) upgradeAgentPools(ctx context.Context) error {
 		}
 
 		// Upgrade nodes in agent pool
-		upgradedCount = 0
+		oldIndexes := []int{}
 		for agentIndex, vm := range agentVMs {
-			if vm.status != vmStatusNotUpgraded {
-				continue
+			if vm.status == vmStatusNotUpgraded {
+				oldIndexes = append(oldIndexes, agentIndex)
 			}
+		}
+		sort.Ints(oldIndexes)
+		oldNames := make([]string, len(oldIndexes))
+		for i, agentIndex := range oldIndexes {
+			oldNames[i] = agentVMs[agentIndex].name
+		}
+		// do not create last node in favor of already created extra node.
+		lastIndex := oldIndexes[len(oldIndexes)-1]
+
+		limit := ku.agentPoolConcurrency(*agentPool.Name, oldNames)
+		err = runInBatches(limit, oldNames, func(i int) error {
+			agentIndex := oldIndexes[i]
+			vm := agentVMs[agentIndex]
+			node := upgradeAgentNode
+			node.TemplateMap = copyTemplateMap(upgradeAgentNode.TemplateMap)
+			node.ParametersMap = copyTemplateMap(upgradeAgentNode.ParametersMap)
 			ku.logger.Infof("Upgrading Agent VM: %s, pool name: %s", vm.name, *agentPool.Name)
 
-			err := upgradeAgentNode.DeleteNode(&vm.name, true)
+			err := ku.runStep(*agentPool.Name, vm.name, agentIndex, UpgradeStepDrain, func() error {
+				return node.DrainNode(&vm.name)
+			})
+			if err != nil {
+				ku.logger.Errorf("Error draining agent VM %s: %v", vm.name, err)
+				return err
+			}
+
+			err = ku.runStep(*agentPool.Name, vm.name, agentIndex, UpgradeStepDelete, func() error {
+				return node.DeleteNode(&vm.name, false)
+			})
 			if err != nil {
 				ku.logger.Errorf("Error deleting agent VM %s: %v", vm.name, err)
 				return err
@@ -363,26 +502,33 @@ func (ku *Upgrader) upgradeAgentPools(ctx context.Context) error {
 				return err
 			}
 
-			// do not create last node in favor of already created extra node.
-			if upgradedCount == toBeUpgradedCount-1 {
+			if agentIndex == lastIndex {
 				ku.logger.Infof("Skipping creation of VM %s (index %d)", vmName, agentIndex)
-				delete(agentVMs, agentIndex)
-			} else {
-				err = upgradeAgentNode.CreateNode(ctx, *agentPool.Name, agentIndex)
-				if err != nil {
-					ku.logger.Errorf("Error creating upgraded agent VM %s: %v", vmName, err)
-					return err
-				}
+				return nil
+			}
 
-				err = upgradeAgentNode.Validate(&vmName)
-				if err != nil {
-					ku.logger.Errorf("Error validating upgraded agent VM %s: %v", vmName, err)
-					return err
-				}
-				vm.status = vmStatusUpgraded
+			err = ku.runStep(*agentPool.Name, vm.name, agentIndex, UpgradeStepCreate, func() error {
+				return ku.createNode(ctx, &node, *agentPool.Name, agentIndex)
+			})
+			if err != nil {
+				ku.logger.Errorf("Error creating upgraded agent VM %s: %v", vmName, err)
+				return err
 			}
-			upgradedCount++
+
+			err = ku.runStep(*agentPool.Name, vm.name, agentIndex, UpgradeStepValidate, func() error {
+				return node.Validate(&vmName)
+			})
+			if err != nil {
+				ku.logger.Errorf("Error validating upgraded agent VM %s: %v", vmName, err)
+				return err
+			}
+			vm.status = vmStatusUpgraded
+			return nil
+		})
+		if err != nil {
+			return err
 		}
+		delete(agentVMs, lastIndex)
 	}
 
 	return nil
@@ -434,7 +580,11 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 			continue
 		}
 
-		newCapacity := *vmssToUpgrade.Sku.Capacity + 1
+		newCapacity := *vmssToUpgrade.Sku.Capacity
+		// an interrupted upgrade may have already added the extra instance
+		if len(ku.journal.nodesWith(vmssToUpgrade.Name, UpgradeStepCreate, UpgradeStepDelete)) == 0 {
+			newCapacity++
+		}
 		ku.logger.Infof(
 			"VMSS %s current capacity is %d and new capacity will be %d while each node is swapped",
 			vmssToUpgrade.Name,
@@ -445,13 +595,18 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 		*vmssToUpgrade.Sku.Capacity = newCapacity
 
 		for _, vmToUpgrade := range vmssToUpgrade.VMsToUpgrade {
-			if err := ku.Client.SetVirtualMachineScaleSetCapacity(
-				ctx,
-				ku.ClusterTopology.ResourceGroup,
-				vmssToUpgrade.Name,
-				vmssToUpgrade.Sku,
-				vmssToUpgrade.Location,
-			); err != nil {
+			instanceIndex, _ := strconv.Atoi(vmToUpgrade.InstanceID)
+
+			err := ku.runStep(vmssToUpgrade.Name, vmToUpgrade.Name, instanceIndex, UpgradeStepCreate, func() error {
+				return ku.Client.SetVirtualMachineScaleSetCapacity(
+					ctx,
+					ku.ClusterTopology.ResourceGroup,
+					vmssToUpgrade.Name,
+					vmssToUpgrade.Sku,
+					vmssToUpgrade.Location,
+				)
+			})
+			if err != nil {
 				ku.logger.Errorf("Failure to set capacity for VMSS %s", vmssToUpgrade.Name)
 				return err
 			}
@@ -459,32 +614,34 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 			ku.logger.Infof("Successfully set capacity for VMSS %s", vmssToUpgrade.Name)
 
 			// Before we can delete the node we should safely and responsibly drain it
-			var kubeAPIServerURL string
-			getClientTimeout := 10 * time.Second
-
-			if ku.DataModel.Properties.HostedMasterProfile != nil {
-				kubeAPIServerURL = ku.DataModel.Properties.HostedMasterProfile.FQDN
-			} else {
-				kubeAPIServerURL = ku.DataModel.Properties.MasterProfile.FQDN
-			}
-			client, err := ku.Client.GetKubernetesClient(
-				kubeAPIServerURL,
-				ku.kubeConfig,
-				interval,
-				getClientTimeout,
-			)
-			if err != nil {
-				ku.logger.Errorf("Error getting Kubernetes client: %v", err)
-				return err
-			}
+			err = ku.runStep(vmssToUpgrade.Name, vmToUpgrade.Name, instanceIndex, UpgradeStepDrain, func() error {
+				var kubeAPIServerURL string
+				getClientTimeout := 10 * time.Second
+
+				if ku.DataModel.Properties.HostedMasterProfile != nil {
+					kubeAPIServerURL = ku.DataModel.Properties.HostedMasterProfile.FQDN
+				} else {
+					kubeAPIServerURL = ku.DataModel.Properties.MasterProfile.FQDN
+				}
+				client, err := ku.Client.GetKubernetesClient(
+					kubeAPIServerURL,
+					ku.kubeConfig,
+					interval,
+					getClientTimeout,
+				)
+				if err != nil {
+					ku.logger.Errorf("Error getting Kubernetes client: %v", err)
+					return err
+				}
 
-			ku.logger.Infof("Draining node %s", vmToUpgrade.Name)
-			err = operations.SafelyDrainNodeWithClient(
-				client,
-				ku.logger,
-				vmToUpgrade.Name,
-				time.Minute,
-			)
+				ku.logger.Infof("Draining node %s", vmToUpgrade.Name)
+				return operations.SafelyDrainNodeWithClient(
+					client,
+					ku.logger,
+					vmToUpgrade.Name,
+					time.Minute,
+				)
+			})
 			if err != nil {
 				ku.logger.Errorf("Error draining VM in VMSS: %v", err)
 				return err
@@ -498,12 +655,15 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 
 			// At this point we have our buffer node that will replace the node to delete
 			// so we can just remove this current node then
-			if err := ku.Client.DeleteVirtualMachineScaleSetVM(
-				ctx,
-				ku.ClusterTopology.ResourceGroup,
-				vmssToUpgrade.Name,
-				vmToUpgrade.InstanceID,
-			); err != nil {
+			err = ku.runStep(vmssToUpgrade.Name, vmToUpgrade.Name, instanceIndex, UpgradeStepDelete, func() error {
+				return ku.Client.DeleteVirtualMachineScaleSetVM(
+					ctx,
+					ku.ClusterTopology.ResourceGroup,
+					vmssToUpgrade.Name,
+					vmToUpgrade.InstanceID,
+				)
+			})
+			if err != nil {
 				ku.logger.Errorf(
 					"Failed to delete VM %s in VMSS %s",
 					vmToUpgrade.Name,
@@ -0,0 +1,263 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UpgradeStateFileName is the name of the upgrade state journal written to the deployment directory
+const UpgradeStateFileName = "upgrade-state.json"
+
+// UpgradeStep is a single step of the upgrade of a node
+type UpgradeStep string
+
+const (
+	// UpgradeStepDrain cordons and drains an agent node
+	UpgradeStepDrain UpgradeStep = "drain"
+	// UpgradeStepDelete deletes the VM of a node
+	UpgradeStepDelete UpgradeStep = "delete"
+	// UpgradeStepCreate creates the upgraded VM of a node, or adds capacity to a VMSS
+	UpgradeStepCreate UpgradeStep = "create"
+	// UpgradeStepValidate waits for an upgraded node to become ready
+	UpgradeStepValidate UpgradeStep = "validate"
+)
+
+// UpgradeStepStatus is the status of an upgrade step
+type UpgradeStepStatus string
+
+const (
+	// UpgradeStepStarted is recorded before a step runs
+	UpgradeStepStarted UpgradeStepStatus = "started"
+	// UpgradeStepCompleted is recorded after a step succeeded
+	UpgradeStepCompleted UpgradeStepStatus = "completed"
+)
+
+// UpgradeStateEntry records the status of one step of a node upgrade
+type UpgradeStateEntry struct {
+	Pool      string            `json:"pool"`
+	Node      string            `json:"node"`
+	Index     int               `json:"index"`
+	Step      UpgradeStep       `json:"step"`
+	Status    UpgradeStepStatus `json:"status"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// UpgradeState is the content of the upgrade state file
+type UpgradeState struct {
+	UpgradeVersion string              `json:"upgradeVersion"`
+	Completed      bool                `json:"completed"`
+	Entries        []UpgradeStateEntry `json:"entries"`
+}
+
+// UpgradeJournal persists the progress of an upgrade after each step,
+// so that an interrupted upgrade can be resumed where it stopped.
+// A nil *UpgradeJournal is valid and records nothing.
+type UpgradeJournal struct {
+	path  string
+	lock  sync.Mutex
+	state UpgradeState
+}
+
+// upgradeNodeProgress is the progress of a single node derived from the journal entries
+type upgradeNodeProgress struct {
+	Pool      string
+	Node      string
+	Index     int
+	completed map[UpgradeStep]bool
+}
+
+// NewUpgradeJournal returns a journal for a new upgrade to upgradeVersion, stored at path
+func NewUpgradeJournal(path, upgradeVersion string) *UpgradeJournal {
+	return &UpgradeJournal{
+		path: path,
+		state: UpgradeState{
+			UpgradeVersion: upgradeVersion,
+			Entries:        []UpgradeStateEntry{},
+		},
+	}
+}
+
+// LoadUpgradeJournal loads the journal of an interrupted upgrade to upgradeVersion from path
+func LoadUpgradeJournal(path, upgradeVersion string) (*UpgradeJournal, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading upgrade state file %s", path)
+	}
+	j := &UpgradeJournal{path: path}
+	if err = json.Unmarshal(contents, &j.state); err != nil {
+		return nil, errors.Wrapf(err, "error parsing upgrade state file %s", path)
+	}
+	if j.state.UpgradeVersion != upgradeVersion {
+		return nil, errors.Errorf("upgrade state file %s is for an upgrade to version %s, not %s", path, j.state.UpgradeVersion, upgradeVersion)
+	}
+	return j, nil
+}
+
+// State returns a copy of the state recorded so far
+func (j *UpgradeJournal) State() UpgradeState {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	state := j.state
+	state.Entries = append([]UpgradeStateEntry{}, j.state.Entries...)
+	return state
+}
+
+// IsCompleted returns true if step was completed for node in pool
+func (j *UpgradeJournal) IsCompleted(pool, node string, step UpgradeStep) bool {
+	if j == nil {
+		return false
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, e := range j.state.Entries {
+		if e.Pool == pool && e.Node == node && e.Step == step && e.Status == UpgradeStepCompleted {
+			return true
+		}
+	}
+	return false
+}
+
+// HasNode returns true if any step was recorded for node in pool
+func (j *UpgradeJournal) HasNode(pool, node string) bool {
+	if j == nil {
+		return false
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, e := range j.state.Entries {
+		if e.Pool == pool && e.Node == node {
+			return true
+		}
+	}
+	return false
+}
+
+// nodesWith returns the nodes in pool for which step was completed but not next,
+// in the order they were first recorded
+func (j *UpgradeJournal) nodesWith(pool string, step, next UpgradeStep) []upgradeNodeProgress {
+	nodes := []upgradeNodeProgress{}
+	for _, n := range j.progress(pool) {
+		if n.completed[step] && !n.completed[next] {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// UpgradedNodes returns the nodes that were upgraded and validated, in the order they completed
+func (j *UpgradeJournal) UpgradedNodes() []string {
+	if j == nil {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	nodes := []string{}
+	seen := map[string]bool{}
+	for _, e := range j.state.Entries {
+		if e.Step == UpgradeStepValidate && e.Status == UpgradeStepCompleted && !seen[e.Node] {
+			seen[e.Node] = true
+			nodes = append(nodes, e.Node)
+		}
+	}
+	return nodes
+}
+
+// Start records that step is about to run for node in pool
+func (j *UpgradeJournal) Start(pool, node string, index int, step UpgradeStep) error {
+	return j.record(pool, node, index, step, UpgradeStepStarted)
+}
+
+// Complete records that step succeeded for node in pool
+func (j *UpgradeJournal) Complete(pool, node string, index int, step UpgradeStep) error {
+	return j.record(pool, node, index, step, UpgradeStepCompleted)
+}
+
+// Finish records that the upgrade completed
+func (j *UpgradeJournal) Finish() error {
+	if j == nil {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.state.Completed = true
+	return j.save()
+}
+
+func (j *UpgradeJournal) progress(pool string) []upgradeNodeProgress {
+	if j == nil {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	nodes := []upgradeNodeProgress{}
+	indexes := map[string]int{}
+	for _, e := range j.state.Entries {
+		if e.Pool != pool {
+			continue
+		}
+		i, ok := indexes[e.Node]
+		if !ok {
+			i = len(nodes)
+			indexes[e.Node] = i
+			nodes = append(nodes, upgradeNodeProgress{Pool: e.Pool, Node: e.Node, Index: e.Index, completed: map[UpgradeStep]bool{}})
+		}
+		if e.Status == UpgradeStepCompleted {
+			nodes[i].completed[e.Step] = true
+		}
+	}
+	return nodes
+}
+
+func (j *UpgradeJournal) record(pool, node string, index int, step UpgradeStep, status UpgradeStepStatus) error {
+	if j == nil {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.state.Completed = false
+	j.state.Entries = append(j.state.Entries, UpgradeStateEntry{
+		Pool:      pool,
+		Node:      node,
+		Index:     index,
+		Step:      step,
+		Status:    status,
+		Timestamp: time.Now().UTC(),
+	})
+	return j.save()
+}
+
+// save writes the journal to a temporary file and renames it, so that an
+// interruption never leaves a truncated state file behind
+func (j *UpgradeJournal) save() error {
+	b, err := json.MarshalIndent(j.state, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error serializing upgrade state")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(j.path), UpgradeStateFileName)
+	if err != nil {
+		return errors.Wrap(err, "error writing upgrade state")
+	}
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "error writing upgrade state")
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "error writing upgrade state")
+	}
+	if err = os.Rename(tmp.Name(), j.path); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrapf(err, "error writing upgrade state file %s", j.path)
+	}
+	return nil
+}
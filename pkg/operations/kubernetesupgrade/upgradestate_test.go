@@ -0,0 +1,147 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+type journalStep struct {
+	Node   string
+	Step   UpgradeStep
+	Status UpgradeStepStatus
+}
+
+func journalSteps(j *UpgradeJournal) []journalStep {
+	steps := []journalStep{}
+	for _, e := range j.State().Entries {
+		steps = append(steps, journalStep{e.Node, e.Step, e.Status})
+	}
+	return steps
+}
+
+var _ = Describe("Upgrade state journal tests", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "upgradestate")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+		os.RemoveAll("./translations")
+	})
+
+	upgrade := func(cs *api.ContainerService, mockClient *armhelpers.MockACSEngineClient, journal *UpgradeJournal) error {
+		uc := UpgradeCluster{
+			Translator: &i18n.Translator{},
+			Logger:     log.NewEntry(log.New()),
+			Client:     mockClient,
+			Journal:    journal,
+		}
+		subID, _ := uuid.FromString("DEC923E3-1EF1-4745-9516-37906D56DEC4")
+		return uc.UpgradeCluster(subID, nil, "kubeConfig", "TestRg", cs, "12345678", []string{"agentpool1"}, TestACSEngineVersion)
+	}
+
+	It("Should record each upgrade step in the state file", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 1, 1, false)
+		statePath := path.Join(dir, UpgradeStateFileName)
+		journal := NewUpgradeJournal(statePath, "1.7.16")
+
+		err := upgrade(cs, &armhelpers.MockACSEngineClient{}, journal)
+		Expect(err).To(BeNil())
+
+		Expect(journalSteps(journal)).To(Equal([]journalStep{
+			{"k8s-master-12345678-0", UpgradeStepCreate, UpgradeStepStarted},
+			{"k8s-master-12345678-0", UpgradeStepCreate, UpgradeStepCompleted},
+			{"k8s-master-12345678-0", UpgradeStepValidate, UpgradeStepStarted},
+			{"k8s-master-12345678-0", UpgradeStepValidate, UpgradeStepCompleted},
+			{"k8s-agentpool1-22998975-1", UpgradeStepCreate, UpgradeStepStarted},
+			{"k8s-agentpool1-22998975-1", UpgradeStepCreate, UpgradeStepCompleted},
+			{"k8s-agentpool1-22998975-1", UpgradeStepValidate, UpgradeStepStarted},
+			{"k8s-agentpool1-22998975-1", UpgradeStepValidate, UpgradeStepCompleted},
+			{"k8s-agentpool1-12345678-0", UpgradeStepDrain, UpgradeStepStarted},
+			{"k8s-agentpool1-12345678-0", UpgradeStepDrain, UpgradeStepCompleted},
+			{"k8s-agentpool1-12345678-0", UpgradeStepDelete, UpgradeStepStarted},
+			{"k8s-agentpool1-12345678-0", UpgradeStepDelete, UpgradeStepCompleted},
+		}))
+
+		saved, err := LoadUpgradeJournal(statePath, "1.7.16")
+		Expect(err).To(BeNil())
+		Expect(saved.State().Completed).To(BeTrue())
+		Expect(journalSteps(saved)).To(Equal(journalSteps(journal)))
+		Expect(saved.UpgradedNodes()).To(Equal([]string{"k8s-master-12345678-0", "k8s-agentpool1-22998975-1"}))
+	})
+
+	It("Should leave an unfinished step in the state file when the upgrade fails", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 1, 1, false)
+		statePath := path.Join(dir, UpgradeStateFileName)
+		mockClient := armhelpers.MockACSEngineClient{}
+		mockClient.FailDeployTemplate = true
+
+		err := upgrade(cs, &mockClient, NewUpgradeJournal(statePath, "1.7.16"))
+		Expect(err).NotTo(BeNil())
+
+		saved, err := LoadUpgradeJournal(statePath, "1.7.16")
+		Expect(err).To(BeNil())
+		Expect(saved.State().Completed).To(BeFalse())
+		Expect(journalSteps(saved)).To(Equal([]journalStep{
+			{"k8s-master-12345678-0", UpgradeStepCreate, UpgradeStepStarted},
+		}))
+	})
+
+	It("Should recreate a master that was deleted but not recreated when resuming", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 3, 1, false)
+		journal := NewUpgradeJournal(path.Join(dir, UpgradeStateFileName), "1.7.16")
+		Expect(journal.Start(MasterPoolName, "k8s-master-12345678-2", 2, UpgradeStepDelete)).To(Succeed())
+		Expect(journal.Complete(MasterPoolName, "k8s-master-12345678-2", 2, UpgradeStepDelete)).To(Succeed())
+
+		err := upgrade(cs, &armhelpers.MockACSEngineClient{}, journal)
+		Expect(err).To(BeNil())
+
+		entries := journal.State().Entries
+		Expect(entries[2].Node).To(Equal("k8s-master-12345678-2"))
+		Expect(entries[2].Index).To(Equal(2))
+		Expect(entries[2].Step).To(Equal(UpgradeStepCreate))
+		Expect(journal.nodesWith(MasterPoolName, UpgradeStepDelete, UpgradeStepCreate)).To(BeEmpty())
+	})
+
+	It("Should skip steps completed by the interrupted upgrade when resuming", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 1, 1, false)
+		journal := NewUpgradeJournal(path.Join(dir, UpgradeStateFileName), "1.7.16")
+		for _, step := range []UpgradeStep{UpgradeStepDrain, UpgradeStepDelete} {
+			Expect(journal.Start("agentpool1", "k8s-agentpool1-12345678-0", 0, step)).To(Succeed())
+			Expect(journal.Complete("agentpool1", "k8s-agentpool1-12345678-0", 0, step)).To(Succeed())
+		}
+
+		// deleting the agent VM again would fail
+		mockClient := armhelpers.MockACSEngineClient{}
+		mockClient.FailDeleteVirtualMachine = true
+
+		err := upgrade(cs, &mockClient, journal)
+		Expect(err).To(BeNil())
+		Expect(journal.State().Completed).To(BeTrue())
+	})
+
+	It("Should refuse to resume an upgrade to a different version", func() {
+		statePath := path.Join(dir, UpgradeStateFileName)
+		Expect(NewUpgradeJournal(statePath, "1.7.16").Finish()).To(Succeed())
+
+		_, err := LoadUpgradeJournal(statePath, "1.8.15")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("is for an upgrade to version 1.7.16, not 1.8.15"))
+	})
+})
@@ -0,0 +1,199 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Azure/acs-engine/pkg/armhelpers/utils"
+	"github.com/pkg/errors"
+)
+
+// upgradeAgentPoolWithSurge upgrades the nodes of an agent pool by first creating up to maxSurge
+// upgraded nodes at free indexes and waiting until they are Ready, then draining and deleting old
+// nodes in batches so that no fewer than count - maxUnavailable nodes are running at any time.
+// Once all old nodes are gone the pool is compacted back to indexes 0 to count-1.
+func (ku *Upgrader) upgradeAgentPoolWithSurge(ctx context.Context, upgradeAgentNode *UpgradeAgentNode, poolName string, agentPoolIndex, agentCount int, agentVMs map[int]*vmInfo) error {
+	oldNodes := []int{}
+	upgradedCount := 0
+	for index, vm := range agentVMs {
+		switch vm.status {
+		case vmStatusNotUpgraded:
+			oldNodes = append(oldNodes, index)
+		case vmStatusUpgraded:
+			upgradedCount++
+		}
+	}
+	sort.Ints(oldNodes)
+
+	ku.logger.Infof("Upgrading %d agent nodes in pool %s with max surge %d and max unavailable %d",
+		len(oldNodes), poolName, ku.maxSurge, ku.maxUnavailable)
+
+	for len(oldNodes) > 0 || upgradedCount < agentCount {
+		// scale up to count + maxSurge nodes, without creating more upgraded nodes than count
+		toCreate := minInt(agentCount+ku.maxSurge-(upgradedCount+len(oldNodes)), agentCount-upgradedCount)
+		if toCreate > 0 {
+			indexes := make([]int, 0, toCreate)
+			for i := 0; i < toCreate; i++ {
+				index := getAvailableIndex(agentVMs)
+				agentVMs[index] = &vmInfo{"", vmStatusIgnored}
+				indexes = append(indexes, index)
+			}
+			if err := ku.createAgentNodes(ctx, upgradeAgentNode, poolName, agentPoolIndex, indexes, agentVMs); err != nil {
+				return err
+			}
+			upgradedCount += toCreate
+		}
+
+		// scale down old nodes to count - maxUnavailable nodes
+		toDelete := minInt(len(oldNodes), upgradedCount+len(oldNodes)-(agentCount-ku.maxUnavailable))
+		if toDelete > 0 {
+			if err := ku.removeAgentNodes(upgradeAgentNode, poolName, oldNodes[:toDelete], agentVMs); err != nil {
+				return err
+			}
+			oldNodes = oldNodes[toDelete:]
+		}
+
+		if toCreate <= 0 && toDelete <= 0 {
+			return errors.Errorf("unable to upgrade agent pool %s with max surge %d and max unavailable %d", poolName, ku.maxSurge, ku.maxUnavailable)
+		}
+	}
+
+	return ku.compactAgentPool(ctx, upgradeAgentNode, poolName, agentPoolIndex, agentVMs)
+}
+
+// compactAgentPool moves the nodes above index count-1 into the holes left below it, up to maxSurge
+// nodes at a time, by creating a node in a hole before removing the node it replaces.
+func (ku *Upgrader) compactAgentPool(ctx context.Context, upgradeAgentNode *UpgradeAgentNode, poolName string, agentPoolIndex int, agentVMs map[int]*vmInfo) error {
+	for {
+		holes := []int{}
+		for index := 0; index < len(agentVMs); index++ {
+			if _, found := agentVMs[index]; !found {
+				holes = append(holes, index)
+			}
+		}
+		outliers := []int{}
+		for index := range agentVMs {
+			if index >= len(agentVMs) {
+				outliers = append(outliers, index)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(outliers)))
+
+		moves := minInt(minInt(len(holes), len(outliers)), ku.maxSurge)
+		if moves == 0 {
+			return nil
+		}
+		ku.logger.Infof("Compacting agent pool %s: moving nodes %v to indexes %v", poolName, outliers[:moves], holes[:moves])
+
+		for _, index := range holes[:moves] {
+			agentVMs[index] = &vmInfo{"", vmStatusIgnored}
+		}
+		if err := ku.createAgentNodes(ctx, upgradeAgentNode, poolName, agentPoolIndex, holes[:moves], agentVMs); err != nil {
+			return err
+		}
+		if err := ku.removeAgentNodes(upgradeAgentNode, poolName, outliers[:moves], agentVMs); err != nil {
+			return err
+		}
+	}
+}
+
+// createAgentNodes creates upgraded agent nodes at the given indexes and waits until all of them are Ready.
+// The indexes must already be reserved in agentVMs.
+func (ku *Upgrader) createAgentNodes(ctx context.Context, upgradeAgentNode *UpgradeAgentNode, poolName string, agentPoolIndex int, indexes []int, agentVMs map[int]*vmInfo) error {
+	for _, agentIndex := range indexes {
+		vmName, err := utils.GetK8sVMName(ku.DataModel.Properties, agentPoolIndex, agentIndex)
+		if err != nil {
+			ku.logger.Errorf("Error reconstructing agent VM name with index %d: %v", agentIndex, err)
+			return err
+		}
+		agentVMs[agentIndex].name = vmName
+	}
+	names := make([]string, len(indexes))
+	for i, agentIndex := range indexes {
+		names[i] = agentVMs[agentIndex].name
+	}
+	limit := ku.agentPoolConcurrency(poolName, names)
+
+	err := runInBatches(limit, names, func(i int) error {
+		agentIndex := indexes[i]
+		vm := agentVMs[agentIndex]
+		node := *upgradeAgentNode
+		node.TemplateMap = copyTemplateMap(upgradeAgentNode.TemplateMap)
+		node.ParametersMap = copyTemplateMap(upgradeAgentNode.ParametersMap)
+		ku.logger.Infof("Creating new agent node %s (index %d)", vm.name, agentIndex)
+
+		err := ku.runStep(poolName, vm.name, agentIndex, UpgradeStepCreate, func() error {
+			return ku.createNode(ctx, &node, poolName, agentIndex)
+		})
+		if err != nil {
+			ku.logger.Errorf("Error creating agent node %s (index %d): %v", vm.name, agentIndex, err)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return runInBatches(limit, names, func(i int) error {
+		agentIndex := indexes[i]
+		vm := agentVMs[agentIndex]
+		err := ku.runStep(poolName, vm.name, agentIndex, UpgradeStepValidate, func() error {
+			return upgradeAgentNode.Validate(&vm.name)
+		})
+		if err != nil {
+			ku.logger.Errorf("Error validating agent node %s (index %d): %v", vm.name, agentIndex, err)
+			return err
+		}
+		vm.status = vmStatusUpgraded
+		return nil
+	})
+}
+
+// removeAgentNodes drains and then deletes the agent nodes at the given indexes
+func (ku *Upgrader) removeAgentNodes(upgradeAgentNode *UpgradeAgentNode, poolName string, indexes []int, agentVMs map[int]*vmInfo) error {
+	names := make([]string, len(indexes))
+	for i, agentIndex := range indexes {
+		names[i] = agentVMs[agentIndex].name
+	}
+	limit := ku.agentPoolConcurrency(poolName, names)
+
+	err := runInBatches(limit, names, func(i int) error {
+		err := ku.runStep(poolName, names[i], indexes[i], UpgradeStepDrain, func() error {
+			return upgradeAgentNode.DrainNode(&names[i])
+		})
+		if err != nil {
+			ku.logger.Errorf("Error draining agent VM %s: %v", names[i], err)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = runInBatches(limit, names, func(i int) error {
+		err := ku.runStep(poolName, names[i], indexes[i], UpgradeStepDelete, func() error {
+			return upgradeAgentNode.DeleteNode(&names[i], false)
+		})
+		if err != nil {
+			ku.logger.Errorf("Error deleting agent VM %s: %v", names[i], err)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, agentIndex := range indexes {
+		delete(agentVMs, agentIndex)
+	}
+	return nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,156 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/acs-engine/pkg/armhelpers/utils"
+	"github.com/Azure/acs-engine/pkg/i18n"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Surge upgrade tests", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "upgradesurge")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	// surgeUpgrade upgrades a pool of agentCount old nodes and returns the journal of the upgrade
+	surgeUpgrade := func(agentCount, maxSurge, maxUnavailable int) (*api.ContainerService, *UpgradeJournal) {
+		cs := api.CreateMockContainerService("testcluster", "1.9.10", 1, agentCount, false)
+		logger := log.NewEntry(log.New())
+		ku := &Upgrader{}
+		journal := NewUpgradeJournal(path.Join(dir, UpgradeStateFileName), "1.9.10")
+		ku.Init(&i18n.Translator{}, logger, ClusterTopology{DataModel: cs}, &armhelpers.MockACSEngineClient{}, "kubeConfig", nil, TestACSEngineVersion, journal, maxSurge, maxUnavailable, 1, nil)
+
+		upgradeAgentNode := &UpgradeAgentNode{
+			Translator:              ku.Translator,
+			logger:                  logger,
+			TemplateMap:             map[string]interface{}{"variables": map[string]interface{}{}},
+			ParametersMap:           map[string]interface{}{"agentpool1Count": map[string]interface{}{"value": agentCount}},
+			UpgradeContainerService: cs,
+			Client:                  ku.Client,
+			timeout:                 time.Minute,
+		}
+
+		agentVMs := map[int]*vmInfo{}
+		for i := 0; i < agentCount; i++ {
+			name, err := utils.GetK8sVMName(cs.Properties, 0, i)
+			Expect(err).To(BeNil())
+			agentVMs[i] = &vmInfo{name, vmStatusNotUpgraded}
+		}
+
+		err := ku.upgradeAgentPoolWithSurge(context.Background(), upgradeAgentNode, "agentpool1", 0, agentCount, agentVMs)
+		Expect(err).To(BeNil())
+		return cs, journal
+	}
+
+	poolNodes := func(cs *api.ContainerService, count int) []string {
+		nodes := []string{}
+		for i := 0; i < count; i++ {
+			name, _ := utils.GetK8sVMName(cs.Properties, 0, i)
+			nodes = append(nodes, name)
+		}
+		sort.Strings(nodes)
+		return nodes
+	}
+
+	// replay checks the number of nodes in the pool and the number of Ready nodes
+	// after each step, and returns the nodes left in the pool
+	replay := func(journal *UpgradeJournal, oldNodes []string, minReady, maxNodes int) []string {
+		ready := map[string]bool{}
+		for _, name := range oldNodes {
+			ready[name] = true
+		}
+		for _, e := range journal.State().Entries {
+			if e.Status != UpgradeStepCompleted {
+				continue
+			}
+			switch e.Step {
+			case UpgradeStepCreate, UpgradeStepDrain:
+				ready[e.Node] = false
+			case UpgradeStepValidate:
+				ready[e.Node] = true
+			case UpgradeStepDelete:
+				delete(ready, e.Node)
+			}
+			Expect(len(ready)).To(BeNumerically("<=", maxNodes))
+			readyCount := 0
+			for _, r := range ready {
+				if r {
+					readyCount++
+				}
+			}
+			Expect(readyCount).To(BeNumerically(">=", minReady))
+		}
+		nodes := []string{}
+		for name := range ready {
+			nodes = append(nodes, name)
+		}
+		sort.Strings(nodes)
+		return nodes
+	}
+
+	It("Should create new nodes before deleting old ones", func() {
+		cs, journal := surgeUpgrade(3, 1, 0)
+
+		entries := journal.State().Entries
+		Expect(entries[0].Step).To(Equal(UpgradeStepCreate))
+		Expect(entries[0].Index).To(Equal(3))
+		Expect(entries[2].Step).To(Equal(UpgradeStepValidate))
+		Expect(entries[4].Step).To(Equal(UpgradeStepDrain))
+		Expect(entries[4].Index).To(Equal(0))
+
+		Expect(replay(journal, poolNodes(cs, 3), 3, 4)).To(Equal(poolNodes(cs, 3)))
+	})
+
+	It("Should upgrade in batches of max surge plus max unavailable nodes", func() {
+		cs, journal := surgeUpgrade(5, 2, 1)
+
+		creates := 0
+		for _, e := range journal.State().Entries {
+			if e.Step == UpgradeStepCreate && e.Status == UpgradeStepCompleted {
+				creates++
+			}
+			if e.Step == UpgradeStepDrain {
+				break
+			}
+		}
+		Expect(creates).To(Equal(2))
+		Expect(replay(journal, poolNodes(cs, 5), 4, 7)).To(Equal(poolNodes(cs, 5)))
+	})
+
+	It("Should compact the pool once the old nodes are deleted", func() {
+		cs, journal := surgeUpgrade(1, 3, 0)
+
+		entries := journal.State().Entries
+		Expect(entries).To(HaveLen(16))
+		Expect(entries[0].Index).To(Equal(1))
+		Expect(entries[4].Index).To(Equal(0))
+		Expect(entries[4].Step).To(Equal(UpgradeStepDrain))
+		// the node created at index 1 is replaced by a new node at index 0
+		Expect(entries[8].Index).To(Equal(0))
+		Expect(entries[8].Step).To(Equal(UpgradeStepCreate))
+		Expect(entries[12].Index).To(Equal(1))
+		Expect(entries[12].Step).To(Equal(UpgradeStepDrain))
+		Expect(replay(journal, poolNodes(cs, 1), 1, 2)).To(Equal(poolNodes(cs, 1)))
+	})
+})
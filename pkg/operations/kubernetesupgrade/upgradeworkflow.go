@@ -10,7 +10,7 @@ import "context"
 type UpgradeWorkFlow interface {
 	// upgrade masters
 	// upgrade agent nodes
-	RunUpgrade() error
+	RunUpgrade(ctx context.Context) error
 
 	Validate() error
 }
@@ -0,0 +1,127 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package preflight
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+const (
+	// totalCoresUsage is the name of the usage limiting the vCPUs of all VM families in a location
+	totalCoresUsage = "cores"
+	// vCPUsCapability is the name of the SKU capability holding the number of vCPUs of a VM size
+	vCPUsCapability = "vCPUs"
+)
+
+// findVMSize returns the virtual machine SKU named vmSize, or nil if it is not offered
+func findVMSize(skus []armhelpers.ResourceSku, vmSize string) *armhelpers.ResourceSku {
+	for i := range skus {
+		if skus[i].ResourceType == "virtualMachines" && strings.EqualFold(skus[i].Name, vmSize) {
+			return &skus[i]
+		}
+	}
+	return nil
+}
+
+// checkVMSizes checks that the VM size of each pool is offered to the subscription
+// in the location and in each availability zone of the pool
+func (c *Checker) checkVMSizes(report *Report, pools []pool, skus []armhelpers.ResourceSku) {
+	for _, p := range pools {
+		sku := findVMSize(skus, p.vmSize)
+		if sku == nil {
+			report.add(CheckVMSizes, SeverityError, "VM size %s of pool %s is not offered in %s", p.vmSize, p.name, c.Location)
+			continue
+		}
+
+		restrictedZones := map[string]bool{}
+		restricted := false
+		for _, r := range sku.Restrictions {
+			switch r.Type {
+			case "Location":
+				restricted = true
+				report.add(CheckVMSizes, SeverityError, "VM size %s of pool %s is not available to the subscription in %s (%s)", p.vmSize, p.name, c.Location, r.ReasonCode)
+			case "Zone":
+				for _, zone := range r.RestrictionInfo.Zones {
+					restrictedZones[zone] = true
+				}
+			}
+		}
+		if restricted {
+			continue
+		}
+
+		offeredZones := map[string]bool{}
+		for _, zone := range sku.Zones(c.Location) {
+			offeredZones[zone] = !restrictedZones[zone]
+		}
+		for _, zone := range p.zones {
+			if !offeredZones[zone] {
+				report.add(CheckVMSizes, SeverityError, "VM size %s of pool %s is not available in zone %s of %s", p.vmSize, p.name, zone, c.Location)
+			}
+		}
+	}
+}
+
+// checkQuota checks that the vCPUs needed by the pools fit in the remaining quota
+// of each VM family and in the total regional quota
+func (c *Checker) checkQuota(ctx context.Context, report *Report, pools []pool, skus []armhelpers.ResourceSku) {
+	needed := map[string]int64{}
+	for _, p := range pools {
+		sku := findVMSize(skus, p.vmSize)
+		if sku == nil {
+			continue
+		}
+		vCPUs, err := strconv.ParseInt(sku.Capability(vCPUsCapability), 10, 64)
+		if err != nil {
+			report.add(CheckQuota, SeverityWarning, "unable to determine the vCPUs of VM size %s", p.vmSize)
+			continue
+		}
+		needed[sku.Family] += vCPUs * int64(p.count)
+		needed[totalCoresUsage] += vCPUs * int64(p.count)
+	}
+	if len(needed) == 0 {
+		return
+	}
+
+	usages, err := c.Client.ListUsages(ctx, c.Location)
+	if err != nil {
+		report.add(CheckQuota, SeverityWarning, "unable to list the compute quota of %s: %v", c.Location, err)
+		return
+	}
+
+	families := []string{}
+	for family := range needed {
+		families = append(families, family)
+	}
+	sort.Strings(families)
+
+	for _, family := range families {
+		for _, usage := range usages {
+			if usage.Name == nil || !strings.EqualFold(to.String(usage.Name.Value), family) {
+				continue
+			}
+			var current, limit int64
+			if usage.CurrentValue != nil {
+				current = int64(*usage.CurrentValue)
+			}
+			if usage.Limit != nil {
+				limit = *usage.Limit
+			}
+			if available := limit - current; needed[family] > available {
+				name := family
+				if usage.Name.LocalizedValue != nil {
+					name = *usage.Name.LocalizedValue
+				}
+				report.add(CheckQuota, SeverityError, "the cluster needs %d %s in %s, but only %d of the quota of %d are available",
+					needed[family], name, c.Location, available, limit)
+			}
+		}
+	}
+}
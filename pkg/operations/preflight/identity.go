@@ -0,0 +1,70 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/azure-sdk-for-go/services/authorization/mgmt/2015-07-01/authorization"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// ownerRoleID is the role id that exists in every subscription for 'Owner'
+const ownerRoleID = "8e3af657-a8ff-443c-a75c-2fe8c4bcb635"
+
+// checkServicePrincipal checks that the service principal of the cluster is assigned
+// the Contributor or Owner role on the resource group, directly or through the subscription
+func (c *Checker) checkServicePrincipal(ctx context.Context, report *Report, cs *api.ContainerService) {
+	p := cs.Properties
+	if p.OrchestratorProfile != nil && p.OrchestratorProfile.KubernetesConfig != nil && p.OrchestratorProfile.KubernetesConfig.UseManagedIdentity {
+		return
+	}
+	spp := p.ServicePrincipalProfile
+	if spp == nil || spp.ClientID == "" {
+		return
+	}
+
+	objectID := spp.ObjectID
+	if objectID == "" {
+		var err error
+		if objectID, err = c.Client.GetServicePrincipalObjectID(ctx, spp.ClientID); err != nil {
+			report.add(CheckServicePrincipal, SeverityWarning, "unable to look up the service principal of client ID %s: %v", spp.ClientID, err)
+			return
+		}
+	}
+
+	scope := fmt.Sprintf(armhelpers.AADRoleResourceGroupScopeTemplate, c.SubscriptionID, c.ResourceGroup)
+	page, err := c.Client.ListRoleAssignmentsForPrincipal(ctx, scope, objectID)
+	if err != nil {
+		report.add(CheckServicePrincipal, SeverityWarning, "unable to list the role assignments of service principal %s on resource group %s: %v", spp.ClientID, c.ResourceGroup, err)
+		return
+	}
+
+	var assignments []authorization.RoleAssignment
+	for page.NotDone() {
+		assignments = append(assignments, page.Values()...)
+		if err = page.Next(); err != nil {
+			report.add(CheckServicePrincipal, SeverityWarning, "unable to list the role assignments of service principal %s on resource group %s: %v", spp.ClientID, c.ResourceGroup, err)
+			return
+		}
+	}
+	if len(assignments) == 0 {
+		report.add(CheckServicePrincipal, SeverityError, "service principal %s has no role assignment on resource group %s", spp.ClientID, c.ResourceGroup)
+		return
+	}
+	for _, assignment := range assignments {
+		if assignment.Properties == nil {
+			continue
+		}
+		roleDefinitionID := strings.ToLower(to.String(assignment.Properties.RoleDefinitionID))
+		if strings.HasSuffix(roleDefinitionID, armhelpers.AADContributorRoleID) || strings.HasSuffix(roleDefinitionID, ownerRoleID) {
+			return
+		}
+	}
+	report.add(CheckServicePrincipal, SeverityWarning, "service principal %s is neither Contributor nor Owner of resource group %s, and may not be allowed to create the cluster resources", spp.ClientID, c.ResourceGroup)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package preflight
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/api/common"
+)
+
+// azureReservedIPs is the number of addresses Azure reserves in every subnet
+const azureReservedIPs = 5
+
+// ipsPerNode returns the number of subnet addresses used by each node: one for the node,
+// plus one for each pod when pods get their IP addresses from the subnet with Azure CNI
+func ipsPerNode(azureCNI bool, configs ...*api.KubernetesConfig) int {
+	if !azureCNI {
+		return 1
+	}
+	for _, config := range configs {
+		if config == nil {
+			continue
+		}
+		if maxPods, err := strconv.Atoi(config.KubeletConfig["--max-pods"]); err == nil && maxPods > 0 {
+			return 1 + maxPods
+		}
+		if config.MaxPods > 0 {
+			return 1 + config.MaxPods
+		}
+	}
+	return 1 + api.DefaultKubernetesMaxPodsVNETIntegrated
+}
+
+// checkSubnets checks that each custom subnet exists and has enough free addresses for the pools
+// deployed to it, and that the first static IP of the masters belongs to the master subnet
+func (c *Checker) checkSubnets(ctx context.Context, report *Report, cs *api.ContainerService, pools []pool) {
+	subnetIDs := []string{}
+	needed := map[string]int{}
+	for _, p := range pools {
+		if p.vnetSubnetID == "" {
+			continue
+		}
+		if _, found := needed[p.vnetSubnetID]; !found {
+			subnetIDs = append(subnetIDs, p.vnetSubnetID)
+		}
+		needed[p.vnetSubnetID] += p.count * p.ipsPerNode
+	}
+
+	for _, subnetID := range subnetIDs {
+		subscriptionID, resourceGroup, vnetName, subnetName, err := common.GetVNETSubnetIDComponents(subnetID)
+		if err != nil {
+			report.add(CheckSubnets, SeverityError, "%v", err)
+			continue
+		}
+		if !strings.EqualFold(subscriptionID, c.SubscriptionID) {
+			report.add(CheckSubnets, SeverityWarning, "subnet %s belongs to subscription %s and cannot be checked", subnetID, subscriptionID)
+			continue
+		}
+
+		subnet, err := c.Client.GetSubnet(ctx, resourceGroup, vnetName, subnetName)
+		if err != nil {
+			report.add(CheckSubnets, SeverityError, "subnet %s was not found: %v", subnetID, err)
+			continue
+		}
+		if subnet.SubnetPropertiesFormat == nil || subnet.AddressPrefix == nil {
+			report.add(CheckSubnets, SeverityWarning, "subnet %s has no address prefix", subnetID)
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(*subnet.AddressPrefix)
+		if err != nil {
+			report.add(CheckSubnets, SeverityWarning, "unable to parse the address prefix %s of subnet %s", *subnet.AddressPrefix, subnetID)
+			continue
+		}
+
+		ones, bits := cidr.Mask.Size()
+		free := (1 << uint(bits-ones)) - azureReservedIPs
+		if subnet.IPConfigurations != nil {
+			free -= len(*subnet.IPConfigurations)
+		}
+		if needed[subnetID] > free {
+			report.add(CheckSubnets, SeverityError, "subnet %s (%s) has %d free addresses, but the pools deployed to it need %d",
+				subnetName, *subnet.AddressPrefix, free, needed[subnetID])
+		}
+
+		master := cs.Properties.MasterProfile
+		if master != nil && master.VnetSubnetID == subnetID && master.FirstConsecutiveStaticIP != "" {
+			if ip := net.ParseIP(master.FirstConsecutiveStaticIP); ip == nil || !cidr.Contains(ip) {
+				report.add(CheckSubnets, SeverityError, "firstConsecutiveStaticIP %s is not in the address prefix %s of subnet %s",
+					master.FirstConsecutiveStaticIP, *subnet.AddressPrefix, subnetName)
+			}
+		}
+	}
+}
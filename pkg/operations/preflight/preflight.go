@@ -0,0 +1,159 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+// Package preflight checks an apimodel against the subscription it is about to be deployed to,
+// so that problems such as missing quota or an unknown subnet are reported before the deployment starts.
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	log "github.com/sirupsen/logrus"
+)
+
+// Severity is the severity of a problem found by a pre-flight check
+type Severity string
+
+const (
+	// SeverityError is a problem that will make the deployment fail
+	SeverityError Severity = "error"
+	// SeverityWarning is a problem that may make the deployment fail, or a check that could not be run
+	SeverityWarning Severity = "warning"
+)
+
+// Names of the pre-flight checks
+const (
+	CheckQuota            = "quota"
+	CheckVMSizes          = "vm-sizes"
+	CheckSubnets          = "subnets"
+	CheckServicePrincipal = "service-principal"
+	CheckProviders        = "providers"
+)
+
+// Problem is a single problem found by a pre-flight check
+type Problem struct {
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Severity, p.Check, p.Message)
+}
+
+// Report holds the problems found by all pre-flight checks
+type Report struct {
+	Problems []Problem `json:"problems"`
+}
+
+// Errors returns the number of problems that will make the deployment fail
+func (r *Report) Errors() int {
+	count := 0
+	for _, p := range r.Problems {
+		if p.Severity == SeverityError {
+			count++
+		}
+	}
+	return count
+}
+
+// String returns the problems of the report, one per line
+func (r *Report) String() string {
+	lines := []string{}
+	for _, p := range r.Problems {
+		lines = append(lines, p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *Report) add(check string, severity Severity, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, Problem{
+		Check:    check,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Checker runs the pre-flight checks of an apimodel against a subscription
+type Checker struct {
+	Client         armhelpers.ACSEngineClient
+	Logger         *log.Entry
+	SubscriptionID string
+	ResourceGroup  string
+	Location       string
+}
+
+// Run runs every pre-flight check and returns a single report of all the problems found
+func (c *Checker) Run(ctx context.Context, cs *api.ContainerService) *Report {
+	report := &Report{}
+	pools := getPools(cs)
+
+	c.Logger.Infof("Checking VM sizes and quota in %s", c.Location)
+	skus, err := c.Client.ListResourceSkus(ctx, c.Location)
+	if err != nil {
+		report.add(CheckVMSizes, SeverityWarning, "unable to list the VM sizes offered in %s: %v", c.Location, err)
+	} else {
+		c.checkVMSizes(report, pools, skus)
+		c.checkQuota(ctx, report, pools, skus)
+	}
+
+	c.Logger.Infoln("Checking custom subnets")
+	c.checkSubnets(ctx, report, cs, pools)
+
+	c.Logger.Infoln("Checking service principal role assignments")
+	c.checkServicePrincipal(ctx, report, cs)
+
+	c.Logger.Infoln("Checking resource provider registration")
+	c.checkProviders(ctx, report, cs)
+
+	return report
+}
+
+// pool is a group of VMs of the same size deployed by the apimodel
+type pool struct {
+	name         string
+	vmSize       string
+	count        int
+	zones        []string
+	vnetSubnetID string
+	ipsPerNode   int
+	master       bool
+}
+
+func getPools(cs *api.ContainerService) []pool {
+	p := cs.Properties
+	var clusterConfig *api.KubernetesConfig
+	azureCNI := false
+	if p.OrchestratorProfile != nil {
+		clusterConfig = p.OrchestratorProfile.KubernetesConfig
+		azureCNI = p.OrchestratorProfile.IsAzureCNI()
+	}
+
+	pools := []pool{}
+	if p.MasterProfile != nil {
+		pools = append(pools, pool{
+			name:         "master",
+			vmSize:       p.MasterProfile.VMSize,
+			count:        p.MasterProfile.Count,
+			zones:        p.MasterProfile.AvailabilityZones,
+			vnetSubnetID: p.MasterProfile.VnetSubnetID,
+			ipsPerNode:   ipsPerNode(azureCNI, p.MasterProfile.KubernetesConfig, clusterConfig),
+			master:       true,
+		})
+	}
+	for _, agentPool := range p.AgentPoolProfiles {
+		pools = append(pools, pool{
+			name:         agentPool.Name,
+			vmSize:       agentPool.VMSize,
+			count:        agentPool.Count,
+			zones:        agentPool.AvailabilityZones,
+			vnetSubnetID: agentPool.VnetSubnetID,
+			ipsPerNode:   ipsPerNode(azureCNI, agentPool.KubernetesConfig, clusterConfig),
+		})
+	}
+	return pools
+}
@@ -0,0 +1,220 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package preflight
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	. "github.com/Azure/acs-engine/pkg/test"
+	"github.com/Azure/azure-sdk-for-go/services/authorization/mgmt/2015-07-01/authorization"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2018-08-01/network"
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestPreflight(t *testing.T) {
+	RunSpecsWithReporters(t, "preflight", "Server Suite")
+}
+
+const (
+	testSubscriptionID = "11111111-2222-3333-4444-555555555555"
+	testSubnetID       = "/subscriptions/" + testSubscriptionID + "/resourceGroups/vnetrg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet"
+)
+
+func vmSku(name, family, vCPUs string, zones ...string) armhelpers.ResourceSku {
+	return armhelpers.ResourceSku{
+		ResourceType: "virtualMachines",
+		Name:         name,
+		Family:       family,
+		Locations:    []string{"westus2"},
+		LocationInfo: []armhelpers.ResourceSkuLocationInfo{{Location: "westus2", Zones: zones}},
+		Capabilities: []armhelpers.ResourceSkuCapability{{Name: "vCPUs", Value: vCPUs}},
+	}
+}
+
+func usage(name string, current int32, limit int64) compute.Usage {
+	return compute.Usage{
+		Name:         &compute.UsageName{Value: to.StringPtr(name), LocalizedValue: to.StringPtr(name + " vCPUs")},
+		CurrentValue: &current,
+		Limit:        &limit,
+	}
+}
+
+func registered(namespaces ...string) []resources.Provider {
+	providers := []resources.Provider{}
+	for _, namespace := range namespaces {
+		providers = append(providers, resources.Provider{Namespace: to.StringPtr(namespace), RegistrationState: to.StringPtr("Registered")})
+	}
+	return providers
+}
+
+// newMockClient returns a client for a subscription where a cluster of 1 master and 3 agents
+// of size Standard_D2_v2 passes every check
+func newMockClient() *armhelpers.MockACSEngineClient {
+	return &armhelpers.MockACSEngineClient{
+		ResourceSkus: []armhelpers.ResourceSku{
+			vmSku("Standard_D2_v2", "standardDv2Family", "2", "1", "2", "3"),
+			vmSku("Standard_D4_v2", "standardDv2Family", "8"),
+		},
+		Usages: []compute.Usage{
+			usage("cores", 10, 100),
+			usage("standardDv2Family", 10, 20),
+		},
+		Providers: registered("Microsoft.Compute", "Microsoft.Storage", "Microsoft.Network"),
+		RoleAssignments: []authorization.RoleAssignment{{
+			Properties: &authorization.RoleAssignmentPropertiesWithScope{
+				RoleDefinitionID: to.StringPtr("/subscriptions/" + testSubscriptionID + "/providers/Microsoft.Authorization/roleDefinitions/" + armhelpers.AADContributorRoleID),
+			},
+		}},
+	}
+}
+
+func runChecks(client *armhelpers.MockACSEngineClient, cs *api.ContainerService) *Report {
+	checker := &Checker{
+		Client:         client,
+		Logger:         log.NewEntry(log.New()),
+		SubscriptionID: testSubscriptionID,
+		ResourceGroup:  "testrg",
+		Location:       "westus2",
+	}
+	return checker.Run(context.Background(), cs)
+}
+
+func newContainerService() *api.ContainerService {
+	cs := api.CreateMockContainerService("testcluster", "1.10.8", 1, 3, false)
+	cs.Properties.MasterProfile.VMSize = "Standard_D2_v2"
+	cs.Properties.AgentPoolProfiles[0].VMSize = "Standard_D2_v2"
+	cs.Properties.ServicePrincipalProfile.ObjectID = "object-id"
+	return cs
+}
+
+var _ = Describe("Preflight checks", func() {
+	It("Should not report problems for a cluster that fits the subscription", func() {
+		report := runChecks(newMockClient(), newContainerService())
+		Expect(report.Problems).To(BeEmpty())
+	})
+
+	It("Should report every problem in a single report", func() {
+		client := newMockClient()
+		client.Providers = registered("Microsoft.Compute")
+		client.RoleAssignments = []authorization.RoleAssignment{}
+		cs := newContainerService()
+		cs.Properties.AgentPoolProfiles[0].VMSize = "Standard_NC6"
+
+		report := runChecks(client, cs)
+		Expect(report.Errors()).To(Equal(4))
+		Expect(report.String()).To(ContainSubstring("error: vm-sizes: VM size Standard_NC6 of pool agentpool1 is not offered in westus2"))
+		Expect(report.String()).To(ContainSubstring("error: providers: resource provider Microsoft.Storage is not available to the subscription"))
+		Expect(report.String()).To(ContainSubstring("error: service-principal: service principal"))
+	})
+
+	It("Should read the providers and role assignments of every page", func() {
+		client := newMockClient()
+		client.PageSize = 1
+		client.RoleAssignments = append([]authorization.RoleAssignment{{
+			Properties: &authorization.RoleAssignmentPropertiesWithScope{RoleDefinitionID: to.StringPtr("reader")},
+		}}, client.RoleAssignments...)
+		report := runChecks(client, newContainerService())
+		Expect(report.Problems).To(BeEmpty())
+	})
+
+	It("Should report VM sizes restricted for the subscription or not offered in a zone", func() {
+		client := newMockClient()
+		client.Usages[1] = usage("standardDv2Family", 10, 40)
+		client.ResourceSkus[0].Restrictions = []armhelpers.ResourceSkuRestriction{{
+			Type:            "Zone",
+			RestrictionInfo: armhelpers.ResourceSkuRestrictionInfo{Zones: []string{"3"}},
+			ReasonCode:      "NotAvailableForSubscription",
+		}}
+		cs := newContainerService()
+		cs.Properties.AgentPoolProfiles[0].AvailabilityZones = []string{"1", "3"}
+		cs.Properties.MasterProfile.VMSize = "Standard_D4_v2"
+		cs.Properties.MasterProfile.AvailabilityZones = []string{"1"}
+
+		report := runChecks(client, cs)
+		Expect(report.Problems).To(ConsistOf(
+			Problem{CheckVMSizes, SeverityError, "VM size Standard_D4_v2 of pool master is not available in zone 1 of westus2"},
+			Problem{CheckVMSizes, SeverityError, "VM size Standard_D2_v2 of pool agentpool1 is not available in zone 3 of westus2"},
+		))
+
+		client.ResourceSkus[0].Restrictions = []armhelpers.ResourceSkuRestriction{{Type: "Location", ReasonCode: "NotAvailableForSubscription"}}
+		report = runChecks(client, newContainerService())
+		Expect(report.Errors()).To(Equal(2))
+		Expect(report.Problems[0].Message).To(Equal("VM size Standard_D2_v2 of pool master is not available to the subscription in westus2 (NotAvailableForSubscription)"))
+	})
+
+	It("Should report pools that exceed the quota of their VM family", func() {
+		client := newMockClient()
+		cs := newContainerService()
+		cs.Properties.AgentPoolProfiles[0].Count = 5
+
+		report := runChecks(client, cs)
+		Expect(report.Problems).To(Equal([]Problem{
+			{CheckQuota, SeverityError, "the cluster needs 12 standardDv2Family vCPUs in westus2, but only 10 of the quota of 20 are available"},
+		}))
+	})
+
+	It("Should report a missing subnet", func() {
+		client := newMockClient()
+		client.Subnets = map[string]network.Subnet{}
+		cs := newContainerService()
+		cs.Properties.AgentPoolProfiles[0].VnetSubnetID = testSubnetID
+
+		report := runChecks(client, cs)
+		Expect(report.Problems).To(HaveLen(1))
+		Expect(report.Problems[0].Check).To(Equal(CheckSubnets))
+		Expect(report.Problems[0].Message).To(HavePrefix("subnet " + testSubnetID + " was not found"))
+	})
+
+	It("Should report subnets too small for the pools deployed to them", func() {
+		client := newMockClient()
+		client.Subnets = map[string]network.Subnet{
+			"vnet/subnet": {SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: to.StringPtr("10.240.0.0/25")}},
+		}
+		cs := newContainerService()
+		cs.Properties.OrchestratorProfile.KubernetesConfig.NetworkPlugin = "azure"
+		cs.Properties.MasterProfile.VnetSubnetID = testSubnetID
+		cs.Properties.MasterProfile.FirstConsecutiveStaticIP = "10.241.255.5"
+		cs.Properties.AgentPoolProfiles[0].VnetSubnetID = testSubnetID
+
+		report := runChecks(client, cs)
+		Expect(report.Problems).To(ConsistOf(
+			Problem{CheckSubnets, SeverityError, "subnet subnet (10.240.0.0/25) has 123 free addresses, but the pools deployed to it need 124"},
+			Problem{CheckSubnets, SeverityError, "firstConsecutiveStaticIP 10.241.255.5 is not in the address prefix 10.240.0.0/25 of subnet subnet"},
+		))
+	})
+
+	It("Should warn about checks that cannot be run", func() {
+		client := newMockClient()
+		client.FailListResourceSkus = true
+		client.FailListProviders = true
+		cs := newContainerService()
+		cs.Properties.ServicePrincipalProfile.ObjectID = ""
+		client.FailGetServicePrincipalObjectID = true
+
+		report := runChecks(client, cs)
+		Expect(report.Errors()).To(Equal(0))
+		Expect(report.Problems).To(HaveLen(3))
+		for _, p := range report.Problems {
+			Expect(p.Severity).To(Equal(SeverityWarning))
+		}
+	})
+
+	It("Should require the providers used by managed identities and key vault references", func() {
+		cs := newContainerService()
+		cs.Properties.OrchestratorProfile.KubernetesConfig.UseManagedIdentity = true
+		cs.Properties.ServicePrincipalProfile.KeyvaultSecretRef = &api.KeyvaultSecretRef{}
+		Expect(requiredProviders(cs)).To(Equal([]string{
+			"Microsoft.Compute", "Microsoft.Storage", "Microsoft.Network",
+			"Microsoft.ManagedIdentity", "Microsoft.Authorization", "Microsoft.KeyVault",
+		}))
+	})
+})
@@ -0,0 +1,56 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package preflight
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/acs-engine/pkg/api"
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// requiredProviders returns the resource providers the deployment of the cluster depends on
+func requiredProviders(cs *api.ContainerService) []string {
+	providers := append([]string{}, armhelpers.RequiredResourceProviders...)
+	p := cs.Properties
+	if p.OrchestratorProfile != nil && p.OrchestratorProfile.KubernetesConfig != nil && p.OrchestratorProfile.KubernetesConfig.UseManagedIdentity {
+		providers = append(providers, "Microsoft.ManagedIdentity", "Microsoft.Authorization")
+	}
+	if p.ServicePrincipalProfile != nil && p.ServicePrincipalProfile.KeyvaultSecretRef != nil {
+		providers = append(providers, "Microsoft.KeyVault")
+	}
+	return providers
+}
+
+// checkProviders checks that the subscription is registered to every resource provider the cluster needs
+func (c *Checker) checkProviders(ctx context.Context, report *Report, cs *api.ContainerService) {
+	page, err := c.Client.ListProviders(ctx)
+	if err != nil {
+		report.add(CheckProviders, SeverityWarning, "unable to list the resource providers of the subscription: %v", err)
+		return
+	}
+
+	states := map[string]string{}
+	for page.NotDone() {
+		for _, provider := range page.Values() {
+			states[strings.ToLower(to.String(provider.Namespace))] = to.String(provider.RegistrationState)
+		}
+		if err = page.Next(); err != nil {
+			report.add(CheckProviders, SeverityWarning, "unable to list the resource providers of the subscription: %v", err)
+			return
+		}
+	}
+
+	for _, provider := range requiredProviders(cs) {
+		state, found := states[strings.ToLower(provider)]
+		switch {
+		case !found:
+			report.add(CheckProviders, SeverityError, "resource provider %s is not available to the subscription", provider)
+		case state != "Registered":
+			report.add(CheckProviders, SeverityError, "resource provider %s is not registered (%s), run 'az provider register --namespace %s'", provider, state, provider)
+		}
+	}
+}
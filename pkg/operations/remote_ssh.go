@@ -6,33 +6,80 @@ package operations
 import (
 	"bytes"
 	"fmt"
-	"log"
 	"net"
+	"strings"
 
+	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
 )
 
 // RemoteRun executes remote command
 func RemoteRun(user string, addr string, port int, sshKey []byte, cmd string) (string, error) {
+	return RemoteRunWithInput(user, addr, port, sshKey, cmd, "")
+}
+
+// RemoteRunWithInput executes remote command with input as its standard input, to pass it
+// contents that should not appear on its command line
+func RemoteRunWithInput(user string, addr string, port int, sshKey []byte, cmd string, input string) (string, error) {
+	config, err := sshClientConfig(user, sshKey)
+	if err != nil {
+		return "", err
+	}
+	// Connect
+	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", addr, port), config)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	return runSession(client, cmd, input)
+}
+
+// RemoteRunThrough executes remote command, with input as its standard input, on a host only
+// reachable from the jump host, such as an agent node behind the masters, connecting to it
+// through an SSH tunnel
+func RemoteRunThrough(user string, jumpAddr string, jumpPort int, addr string, port int, sshKey []byte, cmd string, input string) (string, error) {
+	config, err := sshClientConfig(user, sshKey)
+	if err != nil {
+		return "", err
+	}
+	jump, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", jumpAddr, jumpPort), config)
+	if err != nil {
+		return "", err
+	}
+	defer jump.Close()
+	target := fmt.Sprintf("%s:%d", addr, port)
+	conn, err := jump.Dial("tcp", target)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to reach %s from %s", target, jumpAddr)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, target, config)
+	if err != nil {
+		conn.Close()
+		return "", err
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	defer client.Close()
+	return runSession(client, cmd, input)
+}
+
+func sshClientConfig(user string, sshKey []byte) (*ssh.ClientConfig, error) {
 	// Create the Signer for this private key.
 	signer, err := ssh.ParsePrivateKey(sshKey)
 	if err != nil {
-		log.Fatalf("unable to parse private key: %v", err)
+		return nil, errors.Wrap(err, "unable to parse private key")
 	}
 
 	// Authentication
-	config := &ssh.ClientConfig{
+	return &ssh.ClientConfig{
 		User: user,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
 		},
 		HostKeyCallback: func(string, net.Addr, ssh.PublicKey) error { return nil },
-	}
-	// Connect
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", addr, port), config)
-	if err != nil {
-		return "", err
-	}
+	}, nil
+}
+
+func runSession(client *ssh.Client, cmd string, input string) (string, error) {
 	// Create a session. It is one session per command.
 	session, err := client.NewSession()
 	if err != nil {
@@ -41,6 +88,9 @@ func RemoteRun(user string, addr string, port int, sshKey []byte, cmd string) (s
 	defer session.Close()
 	var b bytes.Buffer
 	session.Stdout = &b // get output
+	if input != "" {
+		session.Stdin = strings.NewReader(input)
+	}
 
 	err = session.Run(cmd)
 	return b.String(), err
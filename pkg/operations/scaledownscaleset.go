@@ -0,0 +1,171 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ScaleDownPolicy chooses the instances removed when a scale set is scaled down
+type ScaleDownPolicy string
+
+const (
+	// ScaleDownNewest removes the instances with the highest instance IDs, like Azure does
+	ScaleDownNewest ScaleDownPolicy = "newest"
+	// ScaleDownOldest removes the instances with the lowest instance IDs
+	ScaleDownOldest ScaleDownPolicy = "oldest"
+	// ScaleDownLeastLoaded removes the instances whose nodes run the fewest pods
+	ScaleDownLeastLoaded ScaleDownPolicy = "least-loaded"
+)
+
+// ScaleDownPolicies are the supported scale down policies
+var ScaleDownPolicies = []ScaleDownPolicy{ScaleDownNewest, ScaleDownOldest, ScaleDownLeastLoaded}
+
+// ScaleSetInstance is a VM of a scale set
+type ScaleSetInstance struct {
+	InstanceID string
+	// Name is the name of the VM
+	Name string
+	// NodeName is the name of the node of the VM in the cluster
+	NodeName string
+}
+
+// ListScaleSetInstances returns the instances of a scale set ordered by instance ID
+func ListScaleSetInstances(ctx context.Context, az armhelpers.ACSEngineClient, resourceGroup, vmssName string) ([]ScaleSetInstance, error) {
+	instances := []ScaleSetInstance{}
+	for page, err := az.ListVirtualMachineScaleSetVMs(ctx, resourceGroup, vmssName); page.NotDone(); err = page.Next() {
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get the vms of vmss %s", vmssName)
+		}
+		for _, vm := range page.Values() {
+			if vm.InstanceID == nil || vm.Name == nil {
+				continue
+			}
+			instance := ScaleSetInstance{InstanceID: *vm.InstanceID, Name: *vm.Name, NodeName: *vm.Name}
+			if vm.VirtualMachineScaleSetVMProperties != nil && vm.OsProfile != nil && vm.OsProfile.ComputerName != nil {
+				instance.NodeName = *vm.OsProfile.ComputerName
+			}
+			instances = append(instances, instance)
+		}
+	}
+	sortByInstanceID(instances)
+	return instances, nil
+}
+
+// SelectScaleSetInstances chooses count instances to remove from a scale set.
+// The least-loaded policy counts the pods of the nodes with client.
+func SelectScaleSetInstances(client armhelpers.KubernetesClient, logger *log.Entry, instances []ScaleSetInstance, count int, policy ScaleDownPolicy) ([]ScaleSetInstance, error) {
+	if count <= 0 {
+		return []ScaleSetInstance{}, nil
+	}
+	if count > len(instances) {
+		return nil, errors.Errorf("cannot remove %d instances from a scale set of %d", count, len(instances))
+	}
+	candidates := make([]ScaleSetInstance, len(instances))
+	copy(candidates, instances)
+	sortByInstanceID(candidates)
+
+	switch policy {
+	case ScaleDownNewest, "":
+		return candidates[len(candidates)-count:], nil
+	case ScaleDownOldest:
+		return candidates[:count], nil
+	case ScaleDownLeastLoaded:
+		if client == nil {
+			return nil, errors.New("the least-loaded scale down policy needs a Kubernetes client")
+		}
+		pods := map[string]int{}
+		for _, instance := range candidates {
+			pods[instance.InstanceID] = countPods(client, logger, instance.NodeName)
+		}
+		// newer instances go first among equally loaded ones
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return pods[candidates[i].InstanceID] < pods[candidates[j].InstanceID] ||
+				pods[candidates[i].InstanceID] == pods[candidates[j].InstanceID] && instanceIndex(candidates[i]) > instanceIndex(candidates[j])
+		})
+		return candidates[:count], nil
+	default:
+		return nil, errors.Errorf("unsupported scale down policy %q", policy)
+	}
+}
+
+// ScaleDownScaleSetVMs cordons and drains the nodes of instances of a scale set, when client is not nil,
+// and deletes the instances. Instances whose node fails to drain are not deleted.
+// Returns a list with details on each failure, all items in the list will always be of type *VMScalingErrorDetails
+func ScaleDownScaleSetVMs(ctx context.Context, az armhelpers.ACSEngineClient, client armhelpers.KubernetesClient, logger *log.Entry, resourceGroup, vmssName string, drainTimeout time.Duration, instances ...ScaleSetInstance) *list.List {
+	errChan := make(chan *VMScalingErrorDetails, len(instances))
+	for _, instance := range instances {
+		go func(instance ScaleSetInstance) {
+			if client != nil {
+				logger.Infof("Draining node %s", instance.NodeName)
+				if err := SafelyDrainNodeWithClient(client, logger, instance.NodeName, drainTimeout); err != nil {
+					errChan <- &VMScalingErrorDetails{Name: instance.Name, Error: err}
+					return
+				}
+			}
+			logger.Infof("Deleting VM %s in VMSS %s", instance.Name, vmssName)
+			if err := az.DeleteVirtualMachineScaleSetVM(ctx, resourceGroup, vmssName, instance.InstanceID); err != nil {
+				errChan <- &VMScalingErrorDetails{Name: instance.Name, Error: err}
+				return
+			}
+			errChan <- nil
+		}(instance)
+	}
+	failedVMDeletions := &list.List{}
+	for range instances {
+		errDetails := <-errChan
+		if errDetails != nil {
+			failedVMDeletions.PushBack(errDetails)
+			logger.Errorf("Vm '%s' failed to scale down with error: '%s'", errDetails.Name, errDetails.Error.Error())
+		}
+	}
+	if failedVMDeletions.Len() > 0 {
+		return failedVMDeletions
+	}
+	return nil
+}
+
+// countPods returns the number of pods running on a node, 0 when it is not part of the cluster
+func countPods(client armhelpers.KubernetesClient, logger *log.Entry, nodeName string) int {
+	node, err := client.GetNode(nodeName)
+	if err != nil {
+		logger.Warnf("unable to get node %s, counting it as empty: %v", nodeName, err)
+		return 0
+	}
+	pods, err := client.ListPods(node)
+	if err != nil {
+		logger.Warnf("unable to list the pods of node %s, counting it as empty: %v", nodeName, err)
+		return 0
+	}
+	count := 0
+	for _, pod := range pods.Items {
+		if !mirrorPodFilter(pod) || !daemonSetPodFilter(pod) {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+func sortByInstanceID(instances []ScaleSetInstance) {
+	sort.SliceStable(instances, func(i, j int) bool {
+		return instanceIndex(instances[i]) < instanceIndex(instances[j])
+	})
+}
+
+func instanceIndex(instance ScaleSetInstance) int {
+	index, err := strconv.Atoi(instance.InstanceID)
+	if err != nil {
+		return -1
+	}
+	return index
+}
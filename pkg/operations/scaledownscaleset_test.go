@@ -0,0 +1,73 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/acs-engine/pkg/armhelpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Scale down scale set operation tests", func() {
+	instances := []ScaleSetInstance{
+		{InstanceID: "10", Name: "k8s-agentpool1-12345678-vmss_10", NodeName: "k8s-agentpool1-12345678-vmss00000a"},
+		{InstanceID: "2", Name: "k8s-agentpool1-12345678-vmss_2", NodeName: "k8s-agentpool1-12345678-vmss000002"},
+		{InstanceID: "7", Name: "k8s-agentpool1-12345678-vmss_7", NodeName: "k8s-agentpool1-12345678-vmss000007"},
+	}
+	logger := log.NewEntry(log.New())
+
+	It("Should select the instances with the highest instance IDs with the newest policy", func() {
+		victims, err := SelectScaleSetInstances(nil, logger, instances, 2, ScaleDownNewest)
+		Expect(err).To(BeNil())
+		Expect(victims).To(Equal([]ScaleSetInstance{instances[2], instances[0]}))
+	})
+	It("Should select the instances with the lowest instance IDs with the oldest policy", func() {
+		victims, err := SelectScaleSetInstances(nil, logger, instances, 2, ScaleDownOldest)
+		Expect(err).To(BeNil())
+		Expect(victims).To(Equal([]ScaleSetInstance{instances[1], instances[2]}))
+	})
+	It("Should prefer the newest instances among equally loaded ones with the least-loaded policy", func() {
+		client := &armhelpers.MockKubernetesClient{FailGetNode: true}
+		victims, err := SelectScaleSetInstances(client, logger, instances, 1, ScaleDownLeastLoaded)
+		Expect(err).To(BeNil())
+		Expect(victims).To(Equal([]ScaleSetInstance{instances[0]}))
+	})
+	It("Should require a Kubernetes client with the least-loaded policy", func() {
+		_, err := SelectScaleSetInstances(nil, logger, instances, 1, ScaleDownLeastLoaded)
+		Expect(err).NotTo(BeNil())
+	})
+	It("Should return an error for an unsupported policy or too many instances", func() {
+		_, err := SelectScaleSetInstances(nil, logger, instances, 1, ScaleDownPolicy("random"))
+		Expect(err).NotTo(BeNil())
+		_, err = SelectScaleSetInstances(nil, logger, instances, 4, ScaleDownNewest)
+		Expect(err).NotTo(BeNil())
+	})
+	It("Should return nil for errors if all instances are drained and deleted", func() {
+		mockClient := armhelpers.MockACSEngineClient{}
+		errs := ScaleDownScaleSetVMs(context.Background(), &mockClient, &armhelpers.MockKubernetesClient{}, logger, "rg", "k8s-agentpool1-12345678-vmss", time.Minute, instances...)
+		Expect(errs).To(BeNil())
+	})
+	It("Should return error messages for instances that fail to delete", func() {
+		mockClient := armhelpers.MockACSEngineClient{FailDeleteVirtualMachineScaleSetVM: true}
+		errs := ScaleDownScaleSetVMs(context.Background(), &mockClient, nil, logger, "rg", "k8s-agentpool1-12345678-vmss", time.Minute, instances...)
+		Expect(errs.Len()).To(Equal(3))
+		for e := errs.Front(); e != nil; e = e.Next() {
+			output := e.Value.(*VMScalingErrorDetails)
+			Expect(output.Name).To(ContainSubstring("k8s-agentpool1-12345678-vmss_"))
+			Expect(output.Error).NotTo(BeNil())
+		}
+	})
+	It("Should not delete instances whose node fails to drain", func() {
+		mockClient := armhelpers.MockACSEngineClient{}
+		errs := ScaleDownScaleSetVMs(context.Background(), &mockClient, &armhelpers.MockKubernetesClient{FailUpdateNode: true}, logger, "rg", "k8s-agentpool1-12345678-vmss", time.Minute, instances[0])
+		Expect(errs.Len()).To(Equal(1))
+		output := errs.Front().Value.(*VMScalingErrorDetails)
+		_, ok := output.Error.(*DrainError)
+		Expect(ok).To(BeTrue())
+	})
+})